@@ -19,6 +19,12 @@ func initConfig() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == app.MigrateStoreCommand {
+		os.Exit(app.MigrateStore(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == app.SeedCommand {
+		os.Exit(app.Seed(os.Args[2:], os.Stdout, os.Stderr))
+	}
 	initConfig()
 	app.Run(cfg)
 }
@@ -6,37 +6,249 @@ import (
 	"log"
 	"os"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
 	Repository struct {
-		InMemory bool   `yaml:"inMemory" env:"IN_MEMORY" env-description:"In-memory mode"`
-		SavePath string `yaml:"savePath" env:"SAVE_PATH" env-description:"Path to save urls"`
+		InMemory    bool   `yaml:"inMemory" env:"IN_MEMORY" env-description:"In-memory mode"`
+		SavePath    string `yaml:"savePath" env:"SAVE_PATH" env-description:"Path to save urls"`
+		LegacyOwner string `yaml:"legacyOwner" env:"LEGACY_OWNER" env-default:"00000000-0000-0000-0000-000000000000" env-description:"UserID given to links loaded without an owner"`
 	} `yaml:"repository"`
 	Server struct {
-		Address     string `yaml:"address" env:"ADDRESS" env-description:"Address to host"`
-		BaseAddress string `yaml:"baseAddress" env:"BASE_ADDRESS" env-description:"Base address for shortlink"`
+		Address        string        `yaml:"address" env:"ADDRESS" env-description:"Address to host"`
+		BaseAddress    string        `yaml:"baseAddress" env:"BASE_ADDRESS" env-description:"Base address for shortlink"`
+		TrustedSubnet  string        `yaml:"trustedSubnet" env:"TRUSTED_SUBNET" env-description:"CIDR allowed to call internal endpoints"`
+		TrustedProxies string        `yaml:"trustedProxies" env:"TRUSTED_PROXIES" env-description:"Comma separated CIDRs or IPs of proxies whose X-Real-IP is the client address for the trusted subnet check, empty to use the peer address only"`
+		DebugEnabled   bool          `yaml:"debugEnabled" env:"DEBUG_ENABLED" env-description:"Serve pprof under /debug/pprof and expvar at /debug/vars to the trusted subnet"`
+		ReadOnly       bool          `yaml:"readOnly" env:"READ_ONLY" env-description:"Serve reads only, from a replica database"`
+		PrimaryAddress string        `yaml:"primaryAddress" env:"PRIMARY_ADDRESS" env-description:"Primary instance for mutations"`
+		DrainTimeout   time.Duration `yaml:"drainTimeout" env:"SERVER_DRAIN_TIMEOUT" env-default:"5s" env-description:"Time allowed on shutdown for requests being handled to finish"`
+		GracePeriod    time.Duration `yaml:"gracePeriod" env:"SERVER_GRACE_PERIOD" env-default:"10s" env-description:"Time allowed for the whole shutdown: requests, worker pools and repository"`
+		Environment    string        `yaml:"environment" env:"ENVIRONMENT" env-default:"development" env-description:"Environment name recorded in exported link bundles"`
+		RedirectCode   int           `yaml:"redirectCode" env:"REDIRECT_CODE" env-default:"307" env-description:"Status of redirects to the destination of a link, 301, 302, 307 or 308"`
+		RedirectMaxAge time.Duration `yaml:"redirectMaxAge" env:"REDIRECT_MAX_AGE" env-description:"How long clients may cache a redirect, 0 to send Cache-Control: no-store"`
+		MaxURLLength   int           `yaml:"maxURLLength" env:"MAX_URL_LENGTH" env-default:"2048" env-description:"Longest original URL accepted, in bytes"`
+		MaxBodyBytes   int64         `yaml:"maxBodyBytes" env:"MAX_BODY_BYTES" env-default:"1048576" env-description:"Largest request body accepted, in bytes; bundles to import must fit in it"`
+		MaxBatchSize   int           `yaml:"maxBatchSize" env:"MAX_BATCH_SIZE" env-default:"1000" env-description:"Most links one batch shorten request may hold"`
 	} `yaml:"server"`
 	Database struct {
-		Host     string `yaml:"host" env:"DB_HOST" env-description:"Database host-address"`
-		Port     string `yaml:"port" env:"DB_PORT" env-description:"Database port"`
-		Dbname   string `yaml:"dbname" env:"DB_NAME" env-description:"Database name"`
-		User     string `yaml:"user" env:"DB_USER" env-description:"Database user"`
-		Password string `yaml:"password" env:"DB_PASSWORD" env-description:"Database password"`
+		Host              string `yaml:"host" env:"DB_HOST" env-description:"Database host-address"`
+		Port              string `yaml:"port" env:"DB_PORT" env-description:"Database port"`
+		Dbname            string `yaml:"dbname" env:"DB_NAME" env-description:"Database name"`
+		User              string `yaml:"user" env:"DB_USER" env-description:"Database user"`
+		Password          string `yaml:"password" env:"DB_PASSWORD" env-description:"Database password"`
+		DeleteConcurrency int    `yaml:"deleteConcurrency" env:"DB_DELETE_CONCURRENCY" env-default:"4" env-description:"Users deleted in parallel by one batch delete"`
 	} `yaml:"database"`
 	Auth struct {
 		TokenExp  int    `yaml:"tokenExp" env:"TOKEN_EXP" env-description:"Expire time for token"`
-		SecretKey string `yaml:"secretKey" env:"SECRET_KEY" env-description:"Secret key for token"`
+		SecretKey string `yaml:"secretKey" env:"SECRET_KEY" env-description:"Secret key for token, at least 32 bytes"`
+		KeyID     string `yaml:"keyId" env:"SECRET_KEY_ID" env-default:"primary" env-description:"Key id of the secret key, set in the kid header of new tokens"`
+		// PreviousKeys are verified but never signed with, so tokens survive a rotation.
+		PreviousKeys string `yaml:"previousKeys" env:"PREVIOUS_SECRET_KEYS" env-description:"Comma separated id:secret keys still accepted after a rotation"`
 	} `yaml:"auth"`
 	Worker struct {
 		WorkersCount     int `yaml:"workersCount" env:"WORKERS_COUNT" env-description:"Count of workers"`
 		BufferSize       int `yaml:"bufferSize" env:"BUFFER_SIZE" env-description:"Buffer size for workers"`
 		ErrMaximumAmount int `yaml:"errMaximumAmount" env:"ERR_MAXIMUM_AMOUNT" env-description:"Maximum amount of errors"`
 	} `yaml:"worker"`
+	Pools       map[string]PoolConfig `yaml:"pools"`
+	PoolMetrics struct {
+		Path   string        `yaml:"path" env:"POOL_METRICS_PATH" env-description:"File worker pool counters are saved to on shutdown and restored from on startup, empty to disable"`
+		MaxAge time.Duration `yaml:"maxAge" env:"POOL_METRICS_MAX_AGE" env-default:"24h" env-description:"Age after which saved counters are ignored"`
+		Merge  bool          `yaml:"merge" env:"POOL_METRICS_MERGE" env-description:"Add restored counters to the live ones instead of reporting them separately"`
+	} `yaml:"poolMetrics"`
+	Delete struct {
+		FlushTimeout      time.Duration `yaml:"flushTimeout" env:"DELETE_FLUSH_TIMEOUT" env-default:"10s" env-description:"Timeout of one batched delete"`
+		FinalFlushTimeout time.Duration `yaml:"finalFlushTimeout" env:"DELETE_FINAL_FLUSH_TIMEOUT" env-default:"30s" env-description:"Timeout of the batched delete made on shutdown"`
+		BatchMax          int           `yaml:"batchMax" env:"DELETE_BATCH_MAX" env-default:"1000" env-description:"Most links one delete request may name"`
+	} `yaml:"delete"`
+	Archive struct {
+		Enabled   bool          `yaml:"enabled" env:"ARCHIVE_ENABLED" env-description:"Move old links to cold storage"`
+		MaxAge    time.Duration `yaml:"maxAge" env:"ARCHIVE_MAX_AGE" env-default:"8760h" env-description:"Age after which links are archived"`
+		IdleFor   time.Duration `yaml:"idleFor" env:"ARCHIVE_IDLE_FOR" env-default:"8760h" env-description:"Time without visits after which old links are archived; links visited more recently stay"`
+		Interval  time.Duration `yaml:"interval" env:"ARCHIVE_INTERVAL" env-default:"24h" env-description:"Interval of the archive job"`
+		Rehydrate bool          `yaml:"rehydrate" env:"ARCHIVE_REHYDRATE" env-description:"Move archived links back when accessed"`
+	} `yaml:"archive"`
+	Cache struct {
+		Enabled    bool          `yaml:"enabled" env:"CACHE_ENABLED" env-description:"Cache link lookups in process"`
+		TTL        time.Duration `yaml:"ttl" env:"CACHE_TTL" env-default:"1m" env-description:"Lifetime of cached links; older ones are read again before being served"`
+		SoftTTL    time.Duration `yaml:"softTTL" env:"CACHE_SOFT_TTL" env-description:"Age after which cached links are served stale while refreshed in background, zero to disable"`
+		MaxEntries int           `yaml:"maxEntries" env:"CACHE_MAX_ENTRIES" env-default:"10000" env-description:"Maximum cached links"`
+	} `yaml:"cache"`
+	AsyncPersist struct {
+		Enabled bool `yaml:"enabled" env:"ASYNC_PERSIST_ENABLED" env-description:"Allow shortens to persist in background"`
+	} `yaml:"asyncPersist"`
+	Encryption struct {
+		Enabled           bool          `yaml:"enabled" env:"ENCRYPTION_ENABLED" env-description:"Encrypt original URLs at rest"`
+		Keys              string        `yaml:"keys" env:"ENCRYPTION_KEYS" env-description:"Comma separated id:base64 AES-256 keys"`
+		PrimaryKeyID      string        `yaml:"primaryKeyId" env:"ENCRYPTION_PRIMARY_KEY_ID" env-description:"Key id used to encrypt"`
+		IndexKey          string        `yaml:"indexKey" env:"ENCRYPTION_INDEX_KEY" env-description:"Base64 HMAC key of the blind index"`
+		ReencryptInterval time.Duration `yaml:"reencryptInterval" env:"ENCRYPTION_REENCRYPT_INTERVAL" env-default:"1h" env-description:"Interval of the re-encryption job"`
+		BatchSize         int           `yaml:"batchSize" env:"ENCRYPTION_BATCH_SIZE" env-default:"500" env-description:"Rows re-encrypted per transaction"`
+	} `yaml:"encryption"`
+	Backpressure struct {
+		Enabled        bool          `yaml:"enabled" env:"BACKPRESSURE_ENABLED" env-description:"Shed shortens while the repository is degraded"`
+		LatencyP95     time.Duration `yaml:"latencyP95" env:"BACKPRESSURE_LATENCY_P95" env-default:"500ms" env-description:"Repository p95 latency above which the service is degraded"`
+		InFlight       int           `yaml:"inFlight" env:"BACKPRESSURE_IN_FLIGHT" env-default:"50" env-description:"Concurrent repository calls above which the service is degraded"`
+		RecoveryFactor float64       `yaml:"recoveryFactor" env:"BACKPRESSURE_RECOVERY_FACTOR" env-default:"0.5" env-description:"Fraction of the thresholds to drop below before recovering"`
+		Cooldown       time.Duration `yaml:"cooldown" env:"BACKPRESSURE_COOLDOWN" env-default:"10s" env-description:"Minimum time spent degraded"`
+		ShedFraction   float64       `yaml:"shedFraction" env:"BACKPRESSURE_SHED_FRACTION" env-default:"0.5" env-description:"Fraction of shortens rejected while degraded"`
+		RetryAfter     time.Duration `yaml:"retryAfter" env:"BACKPRESSURE_RETRY_AFTER" env-default:"5s" env-description:"Retry-After sent with shed requests"`
+		Window         int           `yaml:"window" env:"BACKPRESSURE_WINDOW" env-default:"200" env-description:"Latency samples kept per repository method"`
+	} `yaml:"backpressure"`
+	Timing struct {
+		Header      bool          `yaml:"header" env:"TIMING_HEADER" env-description:"Send Server-Timing to authenticated and internal callers"`
+		SlowRequest time.Duration `yaml:"slowRequest" env:"TIMING_SLOW_REQUEST" env-default:"1s" env-description:"Requests slower than this are logged with their phases"`
+	} `yaml:"timing"`
+	Outbound struct {
+		RatePerHost   float64       `yaml:"ratePerHost" env:"OUTBOUND_RATE_PER_HOST" env-default:"1" env-description:"Outbound requests per second to one host"`
+		BurstPerHost  int           `yaml:"burstPerHost" env:"OUTBOUND_BURST_PER_HOST" env-default:"5" env-description:"Outbound requests to one host allowed in a burst"`
+		MaxConcurrent int           `yaml:"maxConcurrent" env:"OUTBOUND_MAX_CONCURRENT" env-default:"16" env-description:"Outbound requests in flight across all hosts"`
+		Timeout       time.Duration `yaml:"timeout" env:"OUTBOUND_TIMEOUT" env-default:"10s" env-description:"Timeout of one outbound request"`
+	} `yaml:"outbound"`
+	Readiness struct {
+		Budget            time.Duration `yaml:"budget" env:"READINESS_BUDGET" env-default:"2s" env-description:"Time allowed for all readiness checks together"`
+		CacheTTL          time.Duration `yaml:"cacheTTL" env:"READINESS_CACHE_TTL" env-default:"3s" env-description:"How long a readiness report is reused"`
+		RepositoryTimeout time.Duration `yaml:"repositoryTimeout" env:"READINESS_REPOSITORY_TIMEOUT" env-default:"1s" env-description:"Timeout of the repository check"`
+		History           int           `yaml:"history" env:"READINESS_HISTORY" env-default:"50" env-description:"Check status transitions kept for the stats endpoint"`
+		PingTimeout       time.Duration `yaml:"pingTimeout" env:"READINESS_PING_TIMEOUT" env-default:"2s" env-description:"Timeout of the repository ping of /ping"`
+	} `yaml:"readiness"`
+	LinkCheck struct {
+		Enabled      bool          `yaml:"enabled" env:"LINK_CHECK_ENABLED" env-description:"Check destinations of links in background"`
+		Interval     time.Duration `yaml:"interval" env:"LINK_CHECK_INTERVAL" env-default:"1h" env-description:"Interval of the link check job"`
+		RecheckAfter time.Duration `yaml:"recheckAfter" env:"LINK_CHECK_RECHECK_AFTER" env-default:"168h" env-description:"Age of the last check after which a link is checked again"`
+		BatchSize    int           `yaml:"batchSize" env:"LINK_CHECK_BATCH_SIZE" env-default:"100" env-description:"Links checked by one run"`
+		Concurrency  int           `yaml:"concurrency" env:"LINK_CHECK_CONCURRENCY" env-default:"4" env-description:"Links checked in parallel"`
+		Timeout      time.Duration `yaml:"timeout" env:"LINK_CHECK_TIMEOUT" env-default:"5s" env-description:"Timeout of one check, redirects included"`
+		MaxRedirects int           `yaml:"maxRedirects" env:"LINK_CHECK_MAX_REDIRECTS" env-default:"2" env-description:"Redirects followed by one check"`
+	} `yaml:"linkCheck"`
+	Pages struct {
+		TemplateDir string `yaml:"templateDir" env:"PAGES_TEMPLATE_DIR" env-description:"Directory of page templates overriding the embedded ones"`
+	} `yaml:"pages"`
+	Errors struct {
+		LogInterval time.Duration `yaml:"logInterval" env:"ERRORS_LOG_INTERVAL" env-default:"1m" env-description:"Interval of the job logging new errors of worker pools and the delete batcher, 0 to disable"`
+	} `yaml:"errors"`
+	Reservation struct {
+		Status          int           `yaml:"status" env:"RESERVATION_STATUS" env-default:"404" env-description:"Status a reserved short URL resolves to until completed, 404 or 410"`
+		DefaultTTL      time.Duration `yaml:"defaultTTL" env:"RESERVATION_DEFAULT_TTL" env-default:"24h" env-description:"How long a short URL is reserved when the request sets no TTL"`
+		MaxTTL          time.Duration `yaml:"maxTTL" env:"RESERVATION_MAX_TTL" env-default:"168h" env-description:"Longest reservation a user may ask for"`
+		CleanupInterval time.Duration `yaml:"cleanupInterval" env:"RESERVATION_CLEANUP_INTERVAL" env-default:"10m" env-description:"Interval of the job removing expired reservations, 0 to disable"`
+	} `yaml:"reservation"`
+	Expiry struct {
+		CleanupInterval time.Duration `yaml:"cleanupInterval" env:"EXPIRY_CLEANUP_INTERVAL" env-default:"10m" env-description:"Interval of the job retiring expired links, 0 to disable"`
+	} `yaml:"expiry"`
+	CORS struct {
+		AllowedOrigins   string        `yaml:"allowedOrigins" env:"CORS_ALLOWED_ORIGINS" env-description:"Comma separated origins allowed to call the API from a browser, * for any, empty to disable CORS"`
+		AllowedMethods   string        `yaml:"allowedMethods" env:"CORS_ALLOWED_METHODS" env-default:"GET,POST,PUT,PATCH,DELETE" env-description:"Comma separated methods allowed by preflights"`
+		AllowedHeaders   string        `yaml:"allowedHeaders" env:"CORS_ALLOWED_HEADERS" env-default:"Content-Type,Accept-Language,Prefer" env-description:"Comma separated request headers allowed by preflights"`
+		ExposedHeaders   string        `yaml:"exposedHeaders" env:"CORS_EXPOSED_HEADERS" env-default:"X-Request-ID,Retry-After,Link,X-Total-Count" env-description:"Comma separated response headers readable by browser scripts"`
+		MaxAge           time.Duration `yaml:"maxAge" env:"CORS_MAX_AGE" env-default:"10m" env-description:"How long browsers may cache a preflight response"`
+		AllowCredentials bool          `yaml:"allowCredentials" env:"CORS_ALLOW_CREDENTIALS" env-description:"Let browsers send the auth cookie with cross-origin requests; needs origins listed, not *"`
+	} `yaml:"cors"`
+	Pagination struct {
+		DefaultLimit int           `yaml:"defaultLimit" env:"PAGE_DEFAULT_LIMIT" env-default:"100" env-description:"Links listed per page when the request sets no limit"`
+		MaxLimit     int           `yaml:"maxLimit" env:"PAGE_MAX_LIMIT" env-default:"1000" env-description:"Most links a request may list per page"`
+		MaxOffset    int           `yaml:"maxOffset" env:"PAGE_MAX_OFFSET" env-default:"10000" env-description:"Largest deprecated offset accepted; deeper pages need a cursor"`
+		CursorTTL    time.Duration `yaml:"cursorTTL" env:"PAGE_CURSOR_TTL" env-default:"24h" env-description:"How long a pagination cursor stays valid"`
+	} `yaml:"pagination"`
+	Failover struct {
+		Secondary    string        `yaml:"secondary" env:"FAILOVER_SECONDARY" env-description:"Driver of the read-only repository serving redirects while the primary is unreachable: file, or empty to disable"`
+		SnapshotPath string        `yaml:"snapshotPath" env:"FAILOVER_SNAPSHOT_PATH" env-default:"/tmp/short-url-failover.json" env-description:"Save file of the file secondary"`
+		SyncInterval time.Duration `yaml:"syncInterval" env:"FAILOVER_SYNC_INTERVAL" env-default:"1m" env-description:"Interval of the job writing the links copied to the secondary to its snapshot"`
+	} `yaml:"failover"`
+	Expand struct {
+		BatchMax    int           `yaml:"batchMax" env:"EXPAND_BATCH_MAX" env-default:"100" env-description:"Most codes one batch expand request may resolve"`
+		BatchRate   float64       `yaml:"batchRate" env:"EXPAND_BATCH_RATE" env-default:"1" env-description:"Batch expand requests per second allowed from one IP"`
+		BatchBurst  int           `yaml:"batchBurst" env:"EXPAND_BATCH_BURST" env-default:"5" env-description:"Batch expand requests allowed from one IP in a burst"`
+		CacheMaxAge time.Duration `yaml:"cacheMaxAge" env:"EXPAND_CACHE_MAX_AGE" env-default:"24h" env-description:"How long clients may cache a batch expand response whose links can no longer change"`
+	} `yaml:"expand"`
+	Quota struct {
+		MaxLinks    int           `yaml:"maxLinks" env:"QUOTA_MAX_LINKS" env-default:"0" env-description:"Links a user may own, archived ones included; 0 for no limit"`
+		WarnPercent int           `yaml:"warnPercent" env:"QUOTA_WARN_PERCENT" env-default:"80" env-description:"Percentage of the quota from which users are warned"`
+		CacheTTL    time.Duration `yaml:"cacheTTL" env:"QUOTA_CACHE_TTL" env-default:"5m" env-description:"How long the link count of a user is kept before counting again"`
+	} `yaml:"quota"`
+	RateLimit struct {
+		Rate          float64       `yaml:"rate" env:"RATE_LIMIT_RATE" env-default:"0" env-description:"Requests per second allowed on /api to one user; 0 for no limit"`
+		Burst         int           `yaml:"burst" env:"RATE_LIMIT_BURST" env-default:"20" env-description:"Requests allowed to one client in a burst"`
+		IPRate        float64       `yaml:"ipRate" env:"RATE_LIMIT_IP_RATE" env-default:"0" env-description:"Requests per second allowed on /api and /login to one IP, before auth and whatever the user; 0 for no limit"`
+		IPBurst       int           `yaml:"ipBurst" env:"RATE_LIMIT_IP_BURST" env-default:"100" env-description:"Requests allowed to one IP in a burst"`
+		SweepInterval time.Duration `yaml:"sweepInterval" env:"RATE_LIMIT_SWEEP_INTERVAL" env-default:"1m" env-description:"Interval of the job forgetting idle clients"`
+	} `yaml:"rateLimit"`
+	Webhooks struct {
+		Enabled bool          `yaml:"enabled" env:"WEBHOOKS_ENABLED" env-description:"Let users register webhooks, kept in memory by each instance"`
+		Timeout time.Duration `yaml:"timeout" env:"WEBHOOKS_TIMEOUT" env-default:"5s" env-description:"Timeout of one webhook delivery"`
+	} `yaml:"webhooks"`
+	Redirect struct {
+		Privacy string `yaml:"privacy" env:"REDIRECT_PRIVACY" env-default:"off" env-description:"Privacy of redirects of links without their own: off, no-referrer or dereferer"`
+	} `yaml:"redirect"`
+	Log struct {
+		Level string `yaml:"level" env:"LOG_LEVEL" env-default:"info" env-description:"Lowest level logged: debug, info, warn or error"`
+	} `yaml:"log"`
+}
+
+// PoolConfig configures one named worker pool. Zero values fall back to the Worker section,
+// except TaskTimeout, zero leaving tasks unbounded, the retry settings, zero disabling retries,
+// and RateLimit, zero leaving executions unlimited; RateBurst defaults to 1.
+type PoolConfig struct {
+	Workers          int           `yaml:"workers"`
+	BufferSize       int           `yaml:"bufferSize"`
+	ErrMaximumAmount int           `yaml:"errMaximumAmount"`
+	Stage            string        `yaml:"stage"`
+	TaskTimeout      time.Duration `yaml:"taskTimeout"`
+	MaxAttempts      int           `yaml:"maxAttempts"`
+	RetryBackoff     time.Duration `yaml:"retryBackoff"`
+	RetryBackoffMax  time.Duration `yaml:"retryBackoffMax"`
+	RateLimit        float64       `yaml:"rateLimit"`
+	RateBurst        int           `yaml:"rateBurst"`
+	LogSampling      int           `yaml:"logSampling"`
+	ShutdownTimeout  time.Duration `yaml:"shutdownTimeout"`
+	Sharded          bool          `yaml:"sharded"`
+	RequireStart     bool          `yaml:"requireStart"`
+}
+
+// RedirectCodes are the statuses server.redirectCode may be.
+var RedirectCodes = []int{301, 302, 307, 308}
+
+// Validate checks the values GetConfig cannot use as they are.
+func (c *Config) Validate() error {
+	if !slices.Contains(RedirectCodes, c.Server.RedirectCode) {
+		return fmt.Errorf("server.redirectCode %d is not one of %v", c.Server.RedirectCode, RedirectCodes)
+	}
+	if c.Server.RedirectMaxAge < 0 {
+		return fmt.Errorf("server.redirectMaxAge %s is negative", c.Server.RedirectMaxAge)
+	}
+	if c.Server.MaxBodyBytes <= 0 || c.Server.MaxBatchSize <= 0 {
+		return fmt.Errorf("server.maxBodyBytes %d and server.maxBatchSize %d must be positive", c.Server.MaxBodyBytes, c.Server.MaxBatchSize)
+	}
+	if c.Server.DebugEnabled && c.Server.TrustedSubnet == "" {
+		return fmt.Errorf("server.debugEnabled needs server.trustedSubnet: debug endpoints are only served to it")
+	}
+	if c.CORS.AllowCredentials {
+		for _, origin := range strings.Split(c.CORS.AllowedOrigins, ",") {
+			if strings.TrimSpace(origin) == "*" {
+				return fmt.Errorf("cors.allowedOrigins * cannot be combined with cors.allowCredentials: list the origins")
+			}
+		}
+	}
+	if c.RateLimit.Rate < 0 {
+		return fmt.Errorf("rateLimit.rate %v is negative", c.RateLimit.Rate)
+	}
+	if c.RateLimit.Rate > 0 && (c.RateLimit.Burst <= 0 || c.RateLimit.SweepInterval <= 0) {
+		return fmt.Errorf("rateLimit.burst %d and rateLimit.sweepInterval %s must be positive", c.RateLimit.Burst, c.RateLimit.SweepInterval)
+	}
+	if c.RateLimit.IPRate < 0 {
+		return fmt.Errorf("rateLimit.ipRate %v is negative", c.RateLimit.IPRate)
+	}
+	if c.RateLimit.IPRate > 0 && (c.RateLimit.IPBurst <= 0 || c.RateLimit.SweepInterval <= 0) {
+		return fmt.Errorf("rateLimit.ipBurst %d and rateLimit.sweepInterval %s must be positive", c.RateLimit.IPBurst, c.RateLimit.SweepInterval)
+	}
+	return nil
 }
 
 func (c *Config) UseDataBase() bool {
@@ -120,25 +332,36 @@ func GetConfig(argsToParse []string) (*Config, error) {
 		return nil, fmt.Errorf("config override error: %w", err)
 	}
 
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
 	logConfig(cfg)
 	return cfg, nil
 }
 
-var flagMapping = map[string]string{
-	"im":          "Repository.InMemory",
-	"s":           "Repository.SavePath",
-	"a":           "Server.Address",
-	"b":           "Server.BaseAddress",
-	"db-address":  "Database.Host",
-	"db-port":     "Database.Port",
-	"db-name":     "Database.Dbname",
-	"db-user":     "Database.User",
-	"db-password": "Database.Password",
-	"t":           "Auth.TokenExp",
-	"sk":          "Auth.SecretKey",
-	"wc":          "Worker.WorkersCount",
-	"bs":          "Worker.BufferSize",
-	"ema":         "Worker.ErrMaximumAmount",
+// flagTarget names the argsCommandLine field a flag is parsed into and the Config
+// field it overrides.
+type flagTarget struct {
+	arg    string
+	config string
+}
+
+var flagMapping = map[string]flagTarget{
+	"im":          {"InMemory", "Repository.InMemory"},
+	"s":           {"SavePath", "Repository.SavePath"},
+	"a":           {"Address", "Server.Address"},
+	"b":           {"BaseAddress", "Server.BaseAddress"},
+	"db-address":  {"Host", "Database.Host"},
+	"db-port":     {"DatabasePort", "Database.Port"},
+	"db-name":     {"Dbname", "Database.Dbname"},
+	"db-user":     {"DatabaseUser", "Database.User"},
+	"db-password": {"DatabasePassword", "Database.Password"},
+	"t":           {"TokenExp", "Auth.TokenExp"},
+	"sk":          {"SecretKey", "Auth.SecretKey"},
+	"wc":          {"WorkersCount", "Worker.WorkersCount"},
+	"bs":          {"BufferSize", "Worker.BufferSize"},
+	"ema":         {"ErrMaximumAmount", "Worker.ErrMaximumAmount"},
 }
 
 func overrideConfig(cfg *Config, args *argsCommandLine, setFlags map[string]bool) error {
@@ -146,20 +369,17 @@ func overrideConfig(cfg *Config, args *argsCommandLine, setFlags map[string]bool
 	cfgVal := reflect.ValueOf(cfg).Elem()
 
 	for flagName := range setFlags {
-		fieldPath, ok := flagMapping[flagName]
+		target, ok := flagMapping[flagName]
 		if !ok {
 			continue
 		}
 
-		field := argsVal.FieldByNameFunc(func(name string) bool {
-			return strings.EqualFold(name, flagName)
-		})
-
+		field := argsVal.FieldByName(target.arg)
 		if !field.IsValid() {
-			continue
+			return fmt.Errorf("invalid flag field: %s", target.arg)
 		}
 
-		if err := setConfigValue(cfgVal, fieldPath, field); err != nil {
+		if err := setConfigValue(cfgVal, target.config, field); err != nil {
 			return err
 		}
 	}
@@ -237,14 +457,112 @@ func logConfig(cfg *Config) {
 	log.Println("Loaded configuration:")
 	log.Printf("Repository.InMemory: %v", cfg.Repository.InMemory)
 	log.Printf("Repository.SavePath: %s", cfg.Repository.SavePath)
+	log.Printf("Repository.LegacyOwner: %s", cfg.Repository.LegacyOwner)
 	log.Printf("Server.Address: %s", cfg.Server.Address)
 	log.Printf("Server.BaseAddress: %s", cfg.Server.BaseAddress)
+	log.Printf("Server.TrustedSubnet: %s", cfg.Server.TrustedSubnet)
+	log.Printf("Server.TrustedProxies: %s", cfg.Server.TrustedProxies)
+	log.Printf("Server.DebugEnabled: %v", cfg.Server.DebugEnabled)
+	log.Printf("Server.ReadOnly: %v", cfg.Server.ReadOnly)
+	log.Printf("Server.PrimaryAddress: %s", cfg.Server.PrimaryAddress)
+	log.Printf("Server.DrainTimeout: %s", cfg.Server.DrainTimeout)
+	log.Printf("Server.GracePeriod: %s", cfg.Server.GracePeriod)
+	log.Printf("Server.Environment: %s", cfg.Server.Environment)
+	log.Printf("Server.MaxBodyBytes: %d", cfg.Server.MaxBodyBytes)
+	log.Printf("Server.MaxBatchSize: %d", cfg.Server.MaxBatchSize)
 	log.Printf("Database.Host: %s", cfg.Database.Host)
 	log.Printf("Database.Port: %s", cfg.Database.Port)
 	log.Printf("Database.Dbname: %s", cfg.Database.Dbname)
 	log.Printf("Database.User: %s", cfg.Database.User)
+	log.Printf("Database.DeleteConcurrency: %d", cfg.Database.DeleteConcurrency)
 	log.Printf("Auth.TokenExp: %v", cfg.Auth.TokenExp)
+	log.Printf("Auth.KeyID: %s", cfg.Auth.KeyID)
 	log.Printf("Worker.WorkersCount: %d", cfg.Worker.WorkersCount)
 	log.Printf("Worker.BufferSize: %d", cfg.Worker.BufferSize)
 	log.Printf("Worker.ErrMaximumAmount: %d", cfg.Worker.ErrMaximumAmount)
+	for name, pool := range cfg.Pools {
+		log.Printf("Pools.%s: %+v", name, pool)
+	}
+	log.Printf("PoolMetrics.Path: %s", cfg.PoolMetrics.Path)
+	log.Printf("PoolMetrics.MaxAge: %s", cfg.PoolMetrics.MaxAge)
+	log.Printf("PoolMetrics.Merge: %v", cfg.PoolMetrics.Merge)
+	log.Printf("Delete.FlushTimeout: %s", cfg.Delete.FlushTimeout)
+	log.Printf("Delete.FinalFlushTimeout: %s", cfg.Delete.FinalFlushTimeout)
+	log.Printf("Delete.BatchMax: %d", cfg.Delete.BatchMax)
+	log.Printf("Archive.Enabled: %v", cfg.Archive.Enabled)
+	log.Printf("Archive.MaxAge: %s", cfg.Archive.MaxAge)
+	log.Printf("Archive.IdleFor: %s", cfg.Archive.IdleFor)
+	log.Printf("Archive.Interval: %s", cfg.Archive.Interval)
+	log.Printf("Archive.Rehydrate: %v", cfg.Archive.Rehydrate)
+	log.Printf("Cache.Enabled: %v", cfg.Cache.Enabled)
+	log.Printf("Cache.TTL: %s", cfg.Cache.TTL)
+	log.Printf("Cache.SoftTTL: %s", cfg.Cache.SoftTTL)
+	log.Printf("Cache.MaxEntries: %d", cfg.Cache.MaxEntries)
+	log.Printf("AsyncPersist.Enabled: %v", cfg.AsyncPersist.Enabled)
+	log.Printf("Encryption.Enabled: %v", cfg.Encryption.Enabled)
+	log.Printf("Encryption.PrimaryKeyID: %s", cfg.Encryption.PrimaryKeyID)
+	log.Printf("Encryption.ReencryptInterval: %s", cfg.Encryption.ReencryptInterval)
+	log.Printf("Encryption.BatchSize: %d", cfg.Encryption.BatchSize)
+	log.Printf("Backpressure.Enabled: %v", cfg.Backpressure.Enabled)
+	log.Printf("Backpressure.LatencyP95: %s", cfg.Backpressure.LatencyP95)
+	log.Printf("Backpressure.InFlight: %d", cfg.Backpressure.InFlight)
+	log.Printf("Backpressure.RecoveryFactor: %v", cfg.Backpressure.RecoveryFactor)
+	log.Printf("Backpressure.Cooldown: %s", cfg.Backpressure.Cooldown)
+	log.Printf("Backpressure.ShedFraction: %v", cfg.Backpressure.ShedFraction)
+	log.Printf("Backpressure.RetryAfter: %s", cfg.Backpressure.RetryAfter)
+	log.Printf("Backpressure.Window: %d", cfg.Backpressure.Window)
+	log.Printf("Timing.Header: %v", cfg.Timing.Header)
+	log.Printf("Timing.SlowRequest: %s", cfg.Timing.SlowRequest)
+	log.Printf("Outbound.RatePerHost: %v", cfg.Outbound.RatePerHost)
+	log.Printf("Outbound.BurstPerHost: %d", cfg.Outbound.BurstPerHost)
+	log.Printf("Outbound.MaxConcurrent: %d", cfg.Outbound.MaxConcurrent)
+	log.Printf("Outbound.Timeout: %s", cfg.Outbound.Timeout)
+	log.Printf("Readiness.Budget: %s", cfg.Readiness.Budget)
+	log.Printf("Readiness.CacheTTL: %s", cfg.Readiness.CacheTTL)
+	log.Printf("Readiness.RepositoryTimeout: %s", cfg.Readiness.RepositoryTimeout)
+	log.Printf("Readiness.History: %d", cfg.Readiness.History)
+	log.Printf("Readiness.PingTimeout: %s", cfg.Readiness.PingTimeout)
+	log.Printf("LinkCheck.Enabled: %v", cfg.LinkCheck.Enabled)
+	log.Printf("LinkCheck.Interval: %s", cfg.LinkCheck.Interval)
+	log.Printf("LinkCheck.RecheckAfter: %s", cfg.LinkCheck.RecheckAfter)
+	log.Printf("LinkCheck.BatchSize: %d", cfg.LinkCheck.BatchSize)
+	log.Printf("LinkCheck.Concurrency: %d", cfg.LinkCheck.Concurrency)
+	log.Printf("LinkCheck.Timeout: %s", cfg.LinkCheck.Timeout)
+	log.Printf("LinkCheck.MaxRedirects: %d", cfg.LinkCheck.MaxRedirects)
+	log.Printf("Pages.TemplateDir: %s", cfg.Pages.TemplateDir)
+	log.Printf("Errors.LogInterval: %s", cfg.Errors.LogInterval)
+	log.Printf("Reservation.Status: %d", cfg.Reservation.Status)
+	log.Printf("Reservation.DefaultTTL: %s", cfg.Reservation.DefaultTTL)
+	log.Printf("Reservation.MaxTTL: %s", cfg.Reservation.MaxTTL)
+	log.Printf("Reservation.CleanupInterval: %s", cfg.Reservation.CleanupInterval)
+	log.Printf("Expiry.CleanupInterval: %s", cfg.Expiry.CleanupInterval)
+	log.Printf("CORS.AllowedOrigins: %s", cfg.CORS.AllowedOrigins)
+	log.Printf("CORS.AllowedMethods: %s", cfg.CORS.AllowedMethods)
+	log.Printf("CORS.AllowedHeaders: %s", cfg.CORS.AllowedHeaders)
+	log.Printf("CORS.ExposedHeaders: %s", cfg.CORS.ExposedHeaders)
+	log.Printf("CORS.MaxAge: %s", cfg.CORS.MaxAge)
+	log.Printf("CORS.AllowCredentials: %v", cfg.CORS.AllowCredentials)
+	log.Printf("Pagination.DefaultLimit: %d", cfg.Pagination.DefaultLimit)
+	log.Printf("Pagination.MaxLimit: %d", cfg.Pagination.MaxLimit)
+	log.Printf("Pagination.MaxOffset: %d", cfg.Pagination.MaxOffset)
+	log.Printf("Pagination.CursorTTL: %s", cfg.Pagination.CursorTTL)
+	log.Printf("Failover.Secondary: %s", cfg.Failover.Secondary)
+	log.Printf("Failover.SnapshotPath: %s", cfg.Failover.SnapshotPath)
+	log.Printf("Failover.SyncInterval: %s", cfg.Failover.SyncInterval)
+	log.Printf("Expand.BatchMax: %d", cfg.Expand.BatchMax)
+	log.Printf("Expand.BatchRate: %v", cfg.Expand.BatchRate)
+	log.Printf("Expand.BatchBurst: %d", cfg.Expand.BatchBurst)
+	log.Printf("Expand.CacheMaxAge: %s", cfg.Expand.CacheMaxAge)
+	log.Printf("Quota.MaxLinks: %d", cfg.Quota.MaxLinks)
+	log.Printf("Quota.WarnPercent: %d", cfg.Quota.WarnPercent)
+	log.Printf("Quota.CacheTTL: %s", cfg.Quota.CacheTTL)
+	log.Printf("RateLimit.Rate: %v", cfg.RateLimit.Rate)
+	log.Printf("RateLimit.Burst: %d", cfg.RateLimit.Burst)
+	log.Printf("RateLimit.IPRate: %v", cfg.RateLimit.IPRate)
+	log.Printf("RateLimit.IPBurst: %d", cfg.RateLimit.IPBurst)
+	log.Printf("RateLimit.SweepInterval: %s", cfg.RateLimit.SweepInterval)
+	log.Printf("Webhooks.Enabled: %v", cfg.Webhooks.Enabled)
+	log.Printf("Webhooks.Timeout: %s", cfg.Webhooks.Timeout)
+	log.Printf("Redirect.Privacy: %s", cfg.Redirect.Privacy)
+	log.Printf("Log.Level: %s", cfg.Log.Level)
 }
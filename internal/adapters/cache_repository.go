@@ -0,0 +1,331 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/logger"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+	"github.com/OrtemRepos/shortlink/internal/timing"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+// cacheEntry is fresh until staleAt and served at all until expiresAt.
+// seq tells a refreshed entry from one evicted and primed again meanwhile.
+type cacheEntry struct {
+	url       domain.URL
+	staleAt   time.Time
+	expiresAt time.Time
+	seq       uint64
+}
+
+// CacheStats counts Find calls by how the cache answered them.
+// StaleServes are hits on stale entries; each starts at most one refresh.
+type CacheStats struct {
+	Hits            int64 `json:"hits"`
+	Misses          int64 `json:"misses"`
+	StaleServes     int64 `json:"stale_serves"`
+	Refreshes       int64 `json:"refreshes"`
+	RefreshFailures int64 `json:"refresh_failures"`
+}
+
+// CachedRepository decorates a repository with an in-process cache of Find results.
+// Misses are not cached, nor Degraded links, so the cache recovers with the primary;
+// writes that change a link invalidate its entry.
+type CachedRepository struct {
+	ports.URLRepositoryPort
+	ttl        time.Duration
+	softTTL    time.Duration
+	refresher  worker.WorkerPool
+	many       ports.URLFindManyPort
+	maxEntries int
+	entries    map[string]cacheEntry
+	refreshing map[string]struct{}
+	seq        uint64
+	clock      clock.Clock
+	log        *zap.Logger
+	mu         sync.RWMutex
+
+	hits            atomic.Int64
+	misses          atomic.Int64
+	staleServes     atomic.Int64
+	refreshes       atomic.Int64
+	refreshFailures atomic.Int64
+}
+
+type CacheOption func(*CachedRepository)
+
+// WithStaleWhileRevalidate serves entries older than softTTL, but younger than the
+// TTL of the cache, at once while pool refreshes them from the repository, one
+// refresh per link at a time. A softTTL of zero, or not below the TTL, disables it.
+func WithStaleWhileRevalidate(softTTL time.Duration, pool worker.WorkerPool) CacheOption {
+	return func(cr *CachedRepository) {
+		cr.softTTL = softTTL
+		cr.refresher = pool
+	}
+}
+
+// WithCacheFindMany reads the misses of FindMany with many; it is usually the
+// repository under the decorators the cache wraps, which hide its FindMany.
+func WithCacheFindMany(many ports.URLFindManyPort) CacheOption {
+	return func(cr *CachedRepository) {
+		cr.many = many
+	}
+}
+
+// WithCacheClock sets the clock entries expire by; the default is the real clock.
+func WithCacheClock(c clock.Clock) CacheOption {
+	return func(cr *CachedRepository) {
+		cr.clock = clock.OrReal(c)
+	}
+}
+
+func NewCachedRepository(repo ports.URLRepositoryPort, ttl time.Duration, maxEntries int, opts ...CacheOption) *CachedRepository {
+	c := &CachedRepository{
+		URLRepositoryPort: repo,
+		ttl:               ttl,
+		maxEntries:        maxEntries,
+		entries:           make(map[string]cacheEntry),
+		refreshing:        make(map[string]struct{}),
+		clock:             clock.Real{},
+		log:               logger.GetLogger(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.softTTL <= 0 || c.softTTL >= c.ttl || c.refresher == nil {
+		c.softTTL = c.ttl
+	}
+	return c
+}
+
+func (c *CachedRepository) Find(ctx context.Context, shortURL string) (*domain.URL, error) {
+	start := time.Now()
+	if url, phase := c.lookup(shortURL); url != nil {
+		timing.Record(ctx, phase, start)
+		return url, nil
+	}
+	c.misses.Add(1)
+	timing.Record(ctx, "cache.miss", start)
+	url, err := c.URLRepositoryPort.Find(ctx, shortURL)
+	if err != nil {
+		return nil, err
+	}
+	if !url.Degraded {
+		c.Prime(url)
+	}
+	return url, nil
+}
+
+// lookup returns the entry of shortURL and the timing phase of the hit, counting
+// it, or nil on a miss, left for the caller to count. Stale entries are revalidated.
+func (c *CachedRepository) lookup(shortURL string) (*domain.URL, string) {
+	c.mu.RLock()
+	entry, ok := c.entries[shortURL]
+	c.mu.RUnlock()
+	now := c.clock.Now()
+	if !ok || !now.Before(entry.expiresAt) {
+		return nil, ""
+	}
+	phase := "cache.hit"
+	if now.Before(entry.staleAt) {
+		c.hits.Add(1)
+	} else {
+		phase = "cache.stale"
+		c.staleServes.Add(1)
+		c.revalidate(shortURL, entry.seq)
+	}
+	url := entry.url
+	return &url, phase
+}
+
+// FindMany answers the codes it holds from the cache, and reads the others with
+// one call to the repository of WithCacheFindMany, or one Find per code without it.
+// Each code counts as a hit or a miss, as with Find, and links read are primed.
+func (c *CachedRepository) FindMany(ctx context.Context, shortURLs []string) (map[string]domain.URL, error) {
+	start := time.Now()
+	found := make(map[string]domain.URL, len(shortURLs))
+	var missed []string
+	for _, short := range shortURLs {
+		if url, _ := c.lookup(short); url != nil {
+			found[short] = *url
+			continue
+		}
+		c.misses.Add(1)
+		missed = append(missed, short)
+	}
+	timing.Record(ctx, "cache.lookup", start)
+	if len(missed) == 0 {
+		return found, nil
+	}
+	read, err := c.readMany(ctx, missed)
+	if err != nil {
+		return nil, err
+	}
+	for short, url := range read {
+		if !url.Degraded {
+			c.Prime(&url)
+		}
+		found[short] = url
+	}
+	return found, nil
+}
+
+func (c *CachedRepository) readMany(ctx context.Context, shortURLs []string) (map[string]domain.URL, error) {
+	if c.many != nil {
+		return c.many.FindMany(ctx, shortURLs)
+	}
+	found := make(map[string]domain.URL, len(shortURLs))
+	for _, short := range shortURLs {
+		url, err := c.URLRepositoryPort.Find(ctx, short)
+		if errors.Is(err, domain.ErrURLNotFound) || errors.Is(err, domain.ErrCodeReserved) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found[short] = *url
+	}
+	return found, nil
+}
+
+// Prime stores url in the cache as if it had just been read from the repository.
+func (c *CachedRepository) Prime(url *domain.URL) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[url.ShortURL]; !ok && len(c.entries) >= c.maxEntries {
+		c.evictExpiredLocked()
+		if len(c.entries) >= c.maxEntries {
+			return
+		}
+	}
+	c.storeLocked(url)
+}
+
+func (c *CachedRepository) storeLocked(url *domain.URL) {
+	now := c.clock.Now()
+	c.seq++
+	c.entries[url.ShortURL] = cacheEntry{url: *url, staleAt: now.Add(c.softTTL), expiresAt: now.Add(c.ttl), seq: c.seq}
+}
+
+// revalidate submits a refresh of the entry seq of shortURL unless one is running.
+func (c *CachedRepository) revalidate(shortURL string, seq uint64) {
+	c.mu.Lock()
+	if _, ok := c.refreshing[shortURL]; ok {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[shortURL] = struct{}{}
+	c.mu.Unlock()
+	// The refresh outlives the request that found the entry stale.
+	if err := c.refresher.Submit(context.Background(), refreshTask{cache: c, shortURL: shortURL, seq: seq}); err != nil {
+		c.mu.Lock()
+		delete(c.refreshing, shortURL)
+		c.mu.Unlock()
+		c.log.Debug("cache refresh not submitted", zap.String("short_url", shortURL), zap.Error(err))
+	}
+}
+
+// refresh reads shortURL again and replaces entry seq with the result. An entry
+// evicted meanwhile is left out: the link changed after the read started.
+func (c *CachedRepository) refresh(ctx context.Context, shortURL string, seq uint64) error {
+	url, err := c.URLRepositoryPort.Find(ctx, shortURL)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.refreshing, shortURL)
+	if errors.Is(err, domain.ErrURLNotFound) {
+		if entry, ok := c.entries[shortURL]; ok && entry.seq == seq {
+			delete(c.entries, shortURL)
+		}
+	}
+	if err == nil && url.Degraded {
+		err = fmt.Errorf("refresh %s: %w", shortURL, ErrRepositoryUnavailable)
+	}
+	if err != nil {
+		c.refreshFailures.Add(1)
+		return err
+	}
+	c.refreshes.Add(1)
+	if entry, ok := c.entries[shortURL]; ok && entry.seq == seq {
+		c.storeLocked(url)
+	}
+	return nil
+}
+
+// CacheStats returns the counters of the cache; Stats counts the links of the repository.
+func (c *CachedRepository) CacheStats() CacheStats {
+	return CacheStats{
+		Hits:            c.hits.Load(),
+		Misses:          c.misses.Load(),
+		StaleServes:     c.staleServes.Load(),
+		Refreshes:       c.refreshes.Load(),
+		RefreshFailures: c.refreshFailures.Load(),
+	}
+}
+
+type refreshTask struct {
+	cache    *CachedRepository
+	shortURL string
+	seq      uint64
+}
+
+func (t refreshTask) Execute(ctx context.Context) error {
+	return t.cache.refresh(ctx, t.shortURL, t.seq)
+}
+
+func (t refreshTask) Stringer() string {
+	return fmt.Sprintf("CacheRefresh{%s}", t.shortURL)
+}
+
+func (c *CachedRepository) Evict(shortURL string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, shortURL)
+}
+
+func (c *CachedRepository) evictExpiredLocked() {
+	now := c.clock.Now()
+	for short, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, short)
+		}
+	}
+}
+
+func (c *CachedRepository) BatchDelete(ctx context.Context, ids map[string][]string) (int, error) {
+	n, err := c.URLRepositoryPort.BatchDelete(ctx, ids)
+	for _, shortURLs := range ids {
+		for _, short := range shortURLs {
+			c.Evict(short)
+		}
+	}
+	return n, err
+}
+
+func (c *CachedRepository) Unarchive(ctx context.Context, shortURLs []string) (int, error) {
+	n, err := c.URLRepositoryPort.Unarchive(ctx, shortURLs)
+	for _, short := range shortURLs {
+		c.Evict(short)
+	}
+	return n, err
+}
+
+func (c *CachedRepository) ReassignOwner(ctx context.Context, from, to string) (int, error) {
+	n, err := c.URLRepositoryPort.ReassignOwner(ctx, from, to)
+	c.mu.Lock()
+	for short, entry := range c.entries {
+		if entry.url.UUID == from || entry.url.UUID == to {
+			delete(c.entries, short)
+		}
+	}
+	c.mu.Unlock()
+	return n, err
+}
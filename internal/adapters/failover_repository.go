@@ -0,0 +1,164 @@
+package adapters
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/encryption"
+	"github.com/OrtemRepos/shortlink/internal/logger"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+	"github.com/OrtemRepos/shortlink/internal/timing"
+)
+
+// DegradedHeader is set on responses served from the secondary of a FailoverRepository.
+const DegradedHeader = "X-Served-Degraded"
+
+// SecondaryFile is the driver of a secondary kept in memory and snapshotted to a save file.
+const SecondaryFile = "file"
+
+var ErrUnsupportedSecondary = errors.New("unsupported secondary repository")
+
+// ErrRepositoryUnavailable may be wrapped by repositories, and the decorators
+// around them, failing because their storage cannot be reached.
+var ErrRepositoryUnavailable = errors.New("repository unavailable")
+
+// FailoverStats counts Find calls the primary failed to answer, by how the secondary
+// answered them, and the copies of links the secondary failed to keep.
+type FailoverStats struct {
+	DegradedServes    int64 `json:"degraded_serves"`
+	SecondaryMisses   int64 `json:"secondary_misses"`
+	SecondaryFailures int64 `json:"secondary_failures"`
+	MirrorFailures    int64 `json:"mirror_failures"`
+}
+
+// FailoverRepository serves Find from a secondary repository while the primary
+// is unreachable. Links are copied to the secondary as they are read from, or
+// saved to, the primary, so it holds the links resolved recently. Answers of the
+// secondary are marked Degraded. Every other call, writes included, needs the primary.
+type FailoverRepository struct {
+	ports.URLRepositoryPort
+	secondary ports.URLMirrorPort
+	log       *zap.Logger
+
+	degradedServes    atomic.Int64
+	secondaryMisses   atomic.Int64
+	secondaryFailures atomic.Int64
+	mirrorFailures    atomic.Int64
+}
+
+func NewFailoverRepository(primary ports.URLRepositoryPort, secondary ports.URLMirrorPort) *FailoverRepository {
+	return &FailoverRepository{URLRepositoryPort: primary, secondary: secondary, log: logger.GetLogger()}
+}
+
+// NewSecondaryRepository returns the secondary named by driver; only SecondaryFile is
+// supported. Its links are sealed with keyring, if any, like those of the primary.
+func NewSecondaryRepository(driver, snapshotPath string, keyring *encryption.Keyring) (*InMemoryURLRepository, error) {
+	switch driver {
+	case SecondaryFile:
+		return NewInMemoryURLRepository(snapshotPath, WithKeyring(keyring))
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedSecondary, driver)
+	}
+}
+
+// Find asks the secondary when the primary is unreachable. If the secondary does not
+// know the link either, the error of the primary is returned: the link may exist.
+func (f *FailoverRepository) Find(ctx context.Context, shortURL string) (*domain.URL, error) {
+	url, err := f.URLRepositoryPort.Find(ctx, shortURL)
+	if err == nil {
+		f.mirror(ctx, *url)
+		return url, nil
+	}
+	if !unavailable(ctx, err) {
+		return nil, err
+	}
+	defer timing.Record(ctx, "failover.secondary", time.Now())
+	fallback, secondaryErr := f.secondary.Find(ctx, shortURL)
+	switch {
+	case errors.Is(secondaryErr, domain.ErrURLNotFound):
+		f.secondaryMisses.Add(1)
+		return nil, err
+	case secondaryErr != nil:
+		f.secondaryFailures.Add(1)
+		f.log.Error("secondary repository failed", zap.String("short_url", shortURL), zap.Error(secondaryErr))
+		return nil, err
+	}
+	f.degradedServes.Add(1)
+	f.log.Warn("link served from secondary repository", zap.String("short_url", shortURL), zap.Error(err))
+	fallback.Degraded = true
+	return fallback, nil
+}
+
+func (f *FailoverRepository) Save(ctx context.Context, url *domain.URL) error {
+	if err := f.URLRepositoryPort.Save(ctx, url); err != nil {
+		return err
+	}
+	f.mirror(ctx, *url)
+	return nil
+}
+
+func (f *FailoverRepository) BatchSave(ctx context.Context, urls []*domain.URL) error {
+	if err := f.URLRepositoryPort.BatchSave(ctx, urls); err != nil {
+		return err
+	}
+	for _, url := range urls {
+		f.mirror(ctx, *url)
+	}
+	return nil
+}
+
+// mirror copies url to the secondary; a failure only costs the copy.
+func (f *FailoverRepository) mirror(ctx context.Context, url domain.URL) {
+	if err := f.secondary.Mirror(ctx, url); err != nil {
+		f.mirrorFailures.Add(1)
+		f.log.Debug("link not copied to secondary repository", zap.String("short_url", url.ShortURL), zap.Error(err))
+	}
+}
+
+// Close writes a last snapshot of the secondary, if it keeps one, and closes the primary.
+func (f *FailoverRepository) Close(ctx context.Context) error {
+	var errs []error
+	if snapshot, ok := f.secondary.(ports.URLSnapshotPort); ok {
+		errs = append(errs, snapshot.SaveSnapshot(ctx))
+	}
+	return errors.Join(append(errs, f.URLRepositoryPort.Close(ctx))...)
+}
+
+// FailoverStats returns the counters of the failover; Stats counts the links of the primary.
+func (f *FailoverRepository) FailoverStats() FailoverStats {
+	return FailoverStats{
+		DegradedServes:    f.degradedServes.Load(),
+		SecondaryMisses:   f.secondaryMisses.Load(),
+		SecondaryFailures: f.secondaryFailures.Load(),
+		MirrorFailures:    f.mirrorFailures.Load(),
+	}
+}
+
+// unavailable reports whether err tells that the storage could not be reached,
+// rather than answering about the link. Errors of an ended request are not.
+func unavailable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var netErr net.Error
+	var connectErr *pgconn.ConnectError
+	return errors.Is(err, ErrRepositoryUnavailable) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr) ||
+		errors.As(err, &connectErr) ||
+		pgconn.Timeout(err)
+}
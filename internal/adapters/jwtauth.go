@@ -3,43 +3,157 @@ package adapters
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"go.uber.org/zap"
 
 	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/clock"
 	"github.com/OrtemRepos/shortlink/internal/logger"
 	"github.com/OrtemRepos/shortlink/internal/ports"
 )
 
+// MinSecretKeyLength is the shortest secret accepted, in bytes: the size of an HS256 key.
+const MinSecretKeyLength = 32
+
+var (
+	ErrNotValidToken     = errors.New("not valid token")
+	ErrInvalidSigningKey = errors.New("invalid token signing key")
+)
+
+// exampleSecretKeys are secrets from the example config and the docs, which anybody can sign with.
+var exampleSecretKeys = []string{
+	"mySecretKey",
+	"secret",
+	"changeme",
+	"example-secret-key-change-me-in-production",
+}
+
+// ExampleSecretKey reports whether secret is a known example value, to warn about on startup.
+func ExampleSecretKey(secret string) bool {
+	for _, example := range exampleSecretKeys {
+		if secret == example {
+			return true
+		}
+	}
+	return false
+}
+
+// signingKey is a secret and the id it is known by in the kid header of tokens.
+type signingKey struct {
+	id     string
+	secret []byte
+}
+
 type ProviderJWT struct {
-	tokenExp  time.Duration
-	log       *zap.Logger
-	secretKey string
+	tokenExp time.Duration
+	log      *zap.Logger
+	// keys holds the key tokens are signed with first, then the previous ones still verified.
+	keys  []signingKey
+	clock clock.Clock
+}
+
+type ProviderJWTOption func(*ProviderJWT)
+
+// WithTokenClock sets the clock that stamps and validates token expiry; the default is the real clock.
+func WithTokenClock(c clock.Clock) ProviderJWTOption {
+	return func(pj *ProviderJWT) {
+		pj.clock = clock.OrReal(c)
+	}
+}
+
+// WithTokenLogger sets the logger of the provider; the default is the application logger.
+func WithTokenLogger(log *zap.Logger) ProviderJWTOption {
+	return func(pj *ProviderJWT) {
+		if log != nil {
+			pj.log = log
+		}
+	}
+}
+
+// NewProviderJWT returns a provider signing with Auth.SecretKey and verifying with it
+// and Auth.PreviousKeys. It fails on an empty or short key rather than mint tokens
+// that stop verifying once the key is fixed.
+func NewProviderJWT(cfg *configs.Config, opts ...ProviderJWTOption) (*ProviderJWT, error) {
+	keys, err := parseSigningKeys(cfg.Auth.KeyID, cfg.Auth.SecretKey, cfg.Auth.PreviousKeys)
+	if err != nil {
+		return nil, err
+	}
+	pj := &ProviderJWT{
+		tokenExp: time.Duration(cfg.Auth.TokenExp) * time.Second,
+		keys:     keys,
+		clock:    clock.Real{},
+		log:      logger.GetLogger(),
+	}
+	for _, opt := range opts {
+		opt(pj)
+	}
+	return pj, nil
 }
 
-func NewProviderJWT(cfg *configs.Config) *ProviderJWT {
-	return &ProviderJWT{
-		tokenExp:  time.Duration(cfg.Auth.TokenExp) * time.Second,
-		secretKey: cfg.Auth.SecretKey,
-		log:       logger.GetLogger(),
+// parseSigningKeys returns the primary key then the comma separated id:secret previous keys.
+func parseSigningKeys(primaryID, primary, previous string) ([]signingKey, error) {
+	keys := []signingKey{{id: primaryID, secret: []byte(primary)}}
+	for _, pair := range strings.Split(previous, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("%w: previous key %q is not id:secret", ErrInvalidSigningKey, pair)
+		}
+		keys = append(keys, signingKey{id: id, secret: []byte(secret)})
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if err := key.validate(); err != nil {
+			return nil, err
+		}
+		if seen[key.id] {
+			return nil, fmt.Errorf("%w: duplicate key id %q", ErrInvalidSigningKey, key.id)
+		}
+		seen[key.id] = true
 	}
+	return keys, nil
 }
 
-var ErrNotValidToken = errors.New("not valid token")
+func (k signingKey) validate() error {
+	if len(k.secret) == 0 {
+		return fmt.Errorf("%w: key %q is empty", ErrInvalidSigningKey, k.id)
+	}
+	if len(k.secret) < MinSecretKeyLength {
+		return fmt.Errorf("%w: key %q is %d bytes, at least %d are needed",
+			ErrInvalidSigningKey, k.id, len(k.secret), MinSecretKeyLength)
+	}
+	return nil
+}
 
+// BuildJWTString signs a token for id with the primary key. It refuses to sign if the
+// provider has no valid key, say when it was not made by NewProviderJWT.
 func (pj *ProviderJWT) BuildJWTString(id string) (string, error) {
+	if len(pj.keys) == 0 {
+		return "", fmt.Errorf("%w: no key", ErrInvalidSigningKey)
+	}
+	primary := pj.keys[0]
+	if err := primary.validate(); err != nil {
+		pj.log.Error("Refusing to sign token", zap.Error(err))
+		return "", err
+	}
 	token := jwt.NewWithClaims(
 		jwt.SigningMethodHS256,
 		ports.Claims{
 			RegisteredClaims: jwt.RegisteredClaims{
-				ExpiresAt: jwt.NewNumericDate(time.Now().Add(pj.tokenExp)),
+				ExpiresAt: jwt.NewNumericDate(pj.clock.Now().Add(pj.tokenExp)),
 			},
 			UserID: id,
 		},
 	)
-	tokenString, err := token.SignedString([]byte(pj.secretKey))
+	if primary.id != "" {
+		token.Header["kid"] = primary.id
+	}
+	tokenString, err := token.SignedString(primary.secret)
 	if err != nil {
 		pj.log.Error("Failed to sign token", zap.Error(err))
 		return "", err
@@ -48,24 +162,51 @@ func (pj *ProviderJWT) BuildJWTString(id string) (string, error) {
 	return tokenString, nil
 }
 
+// GetClaims verifies the token with the key named by its kid header, or with every
+// key for tokens without one. Failures are logged at debug level with the key ids tried.
 func (pj *ProviderJWT) GetClaims(tokenString string) (*ports.Claims, error) {
-	claims := &ports.Claims{}
-
-	token, err := jwt.ParseWithClaims(tokenString, claims,
-		func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpecred signing method %v", t.Header["alg"])
-			}
-			return []byte(pj.secretKey), nil
-		},
-	)
+	var tried []string
+	var claims *ports.Claims
+	var err error
+	for _, key := range pj.keys {
+		claims = &ports.Claims{}
+		var token *jwt.Token
+		token, err = jwt.ParseWithClaims(tokenString, claims,
+			func(t *jwt.Token) (interface{}, error) {
+				if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+					return nil, fmt.Errorf("unexpecred signing method %v", t.Header["alg"])
+				}
+				if kid, ok := t.Header["kid"].(string); ok && kid != key.id {
+					return nil, errSkipKey
+				}
+				tried = append(tried, key.id)
+				return key.secret, nil
+			},
+			jwt.WithTimeFunc(pj.clock.Now),
+		)
+		if errors.Is(err, errSkipKey) {
+			continue
+		}
+		if err == nil && !token.Valid {
+			err = ErrNotValidToken
+		}
+		// Only a bad signature can be fixed by another key.
+		if !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			break
+		}
+	}
+	if errors.Is(err, errSkipKey) {
+		err = fmt.Errorf("%w: unknown key id", ErrNotValidToken)
+	}
 	if err != nil {
+		if len(pj.keys) > 1 {
+			pj.log.Debug("token verification failed", zap.Strings("tried_key_ids", tried), zap.Error(err))
+		}
 		return nil, err
 	}
 
-	if !token.Valid {
-		return nil, ErrNotValidToken
-	}
-
 	return claims, nil
 }
+
+// errSkipKey tells GetClaims a key is not the one named by the token.
+var errSkipKey = errors.New("key id does not match")
@@ -0,0 +1,158 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/OrtemRepos/shortlink/internal/backpressure"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+	"github.com/OrtemRepos/shortlink/internal/timing"
+)
+
+// MetricsRepository reports the latency and concurrency of request-path calls
+// to a backpressure monitor and records them as request timing phases.
+// Background calls (deletes, archiving) are not reported: their duration says
+// nothing about what a client would wait for. The latency of both, BatchDelete
+// included, is exported by Collector. Find calls are also counted by the
+// backend that answered them, see Lookups.
+type MetricsRepository struct {
+	ports.URLRepositoryPort
+	monitor *backpressure.Monitor
+	latency *prometheus.HistogramVec
+
+	backend   string
+	failover  bool
+	primary   lookupCounter
+	secondary lookupCounter
+}
+
+// LookupCounts counts Find calls by outcome: a link returned, no link, which
+// reserved codes count as, or an error.
+type LookupCounts struct {
+	Found    int64 `json:"found"`
+	NotFound int64 `json:"not_found"`
+	Errors   int64 `json:"errors"`
+}
+
+type lookupCounter struct {
+	found, notFound, errors atomic.Int64
+}
+
+func (c *lookupCounter) counts() LookupCounts {
+	return LookupCounts{Found: c.found.Load(), NotFound: c.notFound.Load(), Errors: c.errors.Load()}
+}
+
+// NewMetricsRepository returns the decorator; monitor may be nil to record timing only.
+func NewMetricsRepository(repo ports.URLRepositoryPort, monitor *backpressure.Monitor) *MetricsRepository {
+	_, failover := repo.(*FailoverRepository)
+	backend := backendOf(repo)
+	latency := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        "shortlink_repository_operation_duration_seconds",
+		Help:        "Time taken by repository calls, by operation; Find calls answered by the cache are left out.",
+		Buckets:     prometheus.DefBuckets,
+		ConstLabels: prometheus.Labels{"backend": backend},
+	}, []string{"operation"})
+	return &MetricsRepository{URLRepositoryPort: repo, monitor: monitor, latency: latency, backend: backend, failover: failover}
+}
+
+// Collector exports the latency of repository calls as the
+// shortlink_repository_operation_duration_seconds histogram.
+func (m *MetricsRepository) Collector() prometheus.Collector {
+	return m.latency
+}
+
+// backendOf names the storage of repo, that of the primary of a FailoverRepository.
+func backendOf(repo ports.URLRepositoryPort) string {
+	switch r := repo.(type) {
+	case *PostgreRepository:
+		return "postgres"
+	case *InMemoryURLRepository:
+		return "memory"
+	case *FailoverRepository:
+		return backendOf(r.URLRepositoryPort)
+	}
+	return "other"
+}
+
+func (m *MetricsRepository) Save(ctx context.Context, url *domain.URL) error {
+	defer m.begin(ctx, "Save")()
+	return m.URLRepositoryPort.Save(ctx, url)
+}
+
+func (m *MetricsRepository) BatchSave(ctx context.Context, urls []*domain.URL) error {
+	defer m.begin(ctx, "BatchSave")()
+	return m.URLRepositoryPort.BatchSave(ctx, urls)
+}
+
+// BatchDelete runs in the background, so only its latency is exported.
+func (m *MetricsRepository) BatchDelete(ctx context.Context, ids map[string][]string) (int, error) {
+	defer m.observe("BatchDelete", time.Now())
+	return m.URLRepositoryPort.BatchDelete(ctx, ids)
+}
+
+func (m *MetricsRepository) Find(ctx context.Context, shortURL string) (*domain.URL, error) {
+	defer m.begin(ctx, "Find")()
+	url, err := m.URLRepositoryPort.Find(ctx, shortURL)
+	counter := &m.primary
+	if url != nil && url.Degraded {
+		counter = &m.secondary
+	}
+	switch {
+	case err == nil:
+		counter.found.Add(1)
+	case errors.Is(err, domain.ErrURLNotFound), errors.Is(err, domain.ErrCodeReserved):
+		counter.notFound.Add(1)
+	default:
+		counter.errors.Add(1)
+	}
+	return url, err
+}
+
+// Lookups returns the counts of Find calls by backend: the storage of the repository,
+// and "secondary" for the secondary of a FailoverRepository answering in its stead.
+func (m *MetricsRepository) Lookups() map[string]LookupCounts {
+	lookups := map[string]LookupCounts{m.backend: m.primary.counts()}
+	if m.failover {
+		lookups["secondary"] = m.secondary.counts()
+	}
+	return lookups
+}
+
+func (m *MetricsRepository) FindByUser(ctx context.Context, userID string, page domain.LinkPage) ([]domain.URL, error) {
+	defer m.begin(ctx, "FindByUser")()
+	return m.URLRepositoryPort.FindByUser(ctx, userID, page)
+}
+
+func (m *MetricsRepository) CountByQuery(ctx context.Context, userID, query string) (int, error) {
+	defer m.begin(ctx, "CountByQuery")()
+	return m.URLRepositoryPort.CountByQuery(ctx, userID, query)
+}
+
+func (m *MetricsRepository) Exists(ctx context.Context, shortURL string) (bool, error) {
+	defer m.begin(ctx, "Exists")()
+	return m.URLRepositoryPort.Exists(ctx, shortURL)
+}
+
+func (m *MetricsRepository) begin(ctx context.Context, method string) func() {
+	start := time.Now()
+	var end func()
+	if m.monitor != nil {
+		end = m.monitor.Begin(method)
+	}
+	return func() {
+		timing.Record(ctx, "repo."+method, start)
+		m.observe(method, start)
+		if end != nil {
+			end()
+		}
+	}
+}
+
+func (m *MetricsRepository) observe(method string, start time.Time) {
+	m.latency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
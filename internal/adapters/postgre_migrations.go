@@ -0,0 +1,243 @@
+package adapters
+
+import "github.com/OrtemRepos/shortlink/internal/migrations"
+
+// postgreMigrations is the schema history of PostgreRepository. Never edit an
+// applied migration; append a new one instead.
+var postgreMigrations = []migrations.Migration{
+	{
+		Version: 1,
+		Name:    "create_urls",
+		SQL: `
+CREATE TABLE IF NOT EXISTS urls (
+	user_id      UUID NOT NULL,
+	short_url    TEXT NOT NULL UNIQUE,
+	original_url TEXT NOT NULL,
+	is_deleted   BOOLEAN DEFAULT FALSE,
+	PRIMARY KEY (user_id, original_url)
+);`,
+	},
+	{
+		Version: 2,
+		Name:    "create_urls_archive",
+		SQL: `
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+CREATE TABLE IF NOT EXISTS urls_archive (
+	user_id      UUID NOT NULL,
+	short_url    TEXT NOT NULL UNIQUE,
+	original_url TEXT NOT NULL,
+	is_deleted   BOOLEAN DEFAULT FALSE,
+	created_at   TIMESTAMPTZ NOT NULL,
+	archived_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);`,
+	},
+	{
+		Version: 3,
+		Name:    "add_urls_updated_at",
+		SQL:     `ALTER TABLE urls ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now();`,
+	},
+	{
+		// short_url is UNIQUE, which already creates urls_short_url_key.
+		Version: 4,
+		Name:    "drop_idx_short_url",
+		SQL:     `DROP INDEX CONCURRENTLY IF EXISTS idx_short_url;`,
+		NoTx:    true,
+	},
+	{
+		// Listings filter by user and order by creation time.
+		Version: 5,
+		Name:    "create_idx_urls_user_created",
+		SQL:     `CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_urls_user_created ON urls (user_id, created_at);`,
+		NoTx:    true,
+	},
+	{
+		// idx_urls_user_created has user_id as its leading column.
+		Version: 6,
+		Name:    "drop_idx_user_id",
+		SQL:     `DROP INDEX CONCURRENTLY IF EXISTS idx_user_id;`,
+		NoTx:    true,
+	},
+	{
+		// Purge scans only soft-deleted rows, ordered by when they were deleted.
+		Version: 7,
+		Name:    "create_idx_urls_deleted",
+		SQL: `CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_urls_deleted
+	ON urls (is_deleted, updated_at) WHERE is_deleted;`,
+		NoTx: true,
+	},
+	{
+		// Blind index of original_url, set only when encryption at rest is enabled.
+		Version: 8,
+		Name:    "add_original_url_index",
+		SQL: `ALTER TABLE urls ADD COLUMN IF NOT EXISTS original_url_index TEXT;
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS original_url_index TEXT;`,
+	},
+	{
+		// Encrypted values are randomized, so dedup relies on the blind index instead of original_url.
+		Version: 9,
+		Name:    "create_idx_urls_user_url_index",
+		SQL: `CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS idx_urls_user_url_index
+	ON urls (user_id, original_url_index) WHERE original_url_index IS NOT NULL;`,
+		NoTx: true,
+	},
+	{
+		Version: 10,
+		Name:    "add_link_checks",
+		SQL: `ALTER TABLE urls ADD COLUMN IF NOT EXISTS last_checked_at TIMESTAMPTZ;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS last_status TEXT NOT NULL DEFAULT '';
+CREATE TABLE IF NOT EXISTS link_check_opt_outs (
+	user_id    UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);`,
+	},
+	{
+		// The link check job samples live links, least recently checked first.
+		Version: 11,
+		Name:    "create_idx_urls_last_checked",
+		SQL: `CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_urls_last_checked
+	ON urls (last_checked_at NULLS FIRST) WHERE NOT is_deleted;`,
+		NoTx: true,
+	},
+	{
+		// Labels of the destination host in reverse order, see domain.ReversedHost, so a
+		// host suffix is a prefix of the column. Written for encrypted rows too: the host
+		// is kept in plaintext. Rows encrypted before this migration are not backfilled.
+		Version: 12,
+		Name:    "add_dest_host_rev",
+		SQL: `ALTER TABLE urls ADD COLUMN IF NOT EXISTS dest_host_rev TEXT;
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS dest_host_rev TEXT;
+UPDATE urls SET dest_host_rev = (
+	SELECT string_agg(label, '.' ORDER BY n DESC) || '.'
+	FROM unnest(string_to_array(rtrim(lower(substring(original_url FROM '^[a-zA-Z]+://(?:[^/?#@]*@)?([^/?#:]+)')), '.'), '.'))
+		WITH ORDINALITY AS t(label, n)
+) WHERE dest_host_rev IS NULL AND original_url ~* '^https?://';
+UPDATE urls_archive SET dest_host_rev = (
+	SELECT string_agg(label, '.' ORDER BY n DESC) || '.'
+	FROM unnest(string_to_array(rtrim(lower(substring(original_url FROM '^[a-zA-Z]+://(?:[^/?#@]*@)?([^/?#:]+)')), '.'), '.'))
+		WITH ORDINALITY AS t(label, n)
+) WHERE dest_host_rev IS NULL AND original_url ~* '^https?://';`,
+	},
+	{
+		// text_pattern_ops lets LIKE 'prefix%' use the index whatever the collation.
+		Version: 13,
+		Name:    "create_idx_urls_user_host_rev",
+		SQL: `CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_urls_user_host_rev
+	ON urls (user_id, dest_host_rev text_pattern_ops) WHERE NOT is_deleted;`,
+		NoTx: true,
+	},
+	{
+		// A reservation is a row without original_url, held until reserved_until.
+		// original_url was part of the primary key, so the key becomes a unique constraint:
+		// NULLs never conflict, and ON CONFLICT (user_id, original_url) still infers it.
+		Version: 14,
+		Name:    "add_urls_reservations",
+		SQL: `ALTER TABLE urls ADD CONSTRAINT urls_user_id_original_url_key UNIQUE (user_id, original_url);
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_pkey;
+ALTER TABLE urls ALTER COLUMN original_url DROP NOT NULL;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS reserved_until TIMESTAMPTZ;`,
+	},
+	{
+		// The purge job deletes reservations by expiry.
+		Version: 15,
+		Name:    "create_idx_urls_reserved_until",
+		SQL: `CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_urls_reserved_until
+	ON urls (reserved_until) WHERE reserved_until IS NOT NULL;`,
+		NoTx: true,
+	},
+	{
+		// Moderation is keyed by short code rather than stored on the link, so it
+		// follows the link in and out of urls_archive.
+		Version: 16,
+		Name:    "create_url_moderation",
+		SQL: `
+CREATE TABLE IF NOT EXISTS url_moderation (
+	short_url    TEXT PRIMARY KEY,
+	status       TEXT NOT NULL,
+	reason       TEXT NOT NULL DEFAULT '',
+	note         TEXT NOT NULL DEFAULT '',
+	actor        TEXT NOT NULL DEFAULT '',
+	moderated_at TIMESTAMPTZ
+);
+CREATE TABLE IF NOT EXISTS url_moderation_events (
+	id           BIGSERIAL PRIMARY KEY,
+	short_url    TEXT NOT NULL,
+	from_status  TEXT NOT NULL,
+	status       TEXT NOT NULL,
+	reason       TEXT NOT NULL,
+	note         TEXT NOT NULL,
+	actor        TEXT NOT NULL,
+	moderated_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_url_moderation_status ON url_moderation (status);
+CREATE INDEX IF NOT EXISTS idx_url_moderation_events_short_url ON url_moderation_events (short_url, id);`,
+	},
+	{
+		// Pages of the links of a user seek to their cursor in these two indexes.
+		// This one reuses the name of the index of migration 5, so it creates
+		// nothing; migration 23 creates it.
+		Version: 17,
+		Name:    "create_idx_urls_user_created",
+		SQL: `CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_urls_user_created
+	ON urls (user_id, created_at, short_url) WHERE NOT is_deleted;`,
+		NoTx: true,
+	},
+	{
+		Version: 18,
+		Name:    "create_idx_urls_archive_user_created",
+		SQL: `CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_urls_archive_user_created
+	ON urls_archive (user_id, created_at, short_url) WHERE NOT is_deleted;`,
+		NoTx: true,
+	},
+	{
+		// Like moderation, the privacy mode of a link is keyed by short code so it
+		// follows the link in and out of urls_archive. Links without a row use the default.
+		Version: 19,
+		Name:    "create_url_privacy",
+		SQL: `
+CREATE TABLE IF NOT EXISTS url_privacy (
+	short_url TEXT PRIMARY KEY,
+	privacy   TEXT NOT NULL
+);`,
+	},
+	{
+		// Links without an expiry keep NULL. The column is copied in and out of
+		// urls_archive along with the row.
+		Version: 20,
+		Name:    "add_urls_expires_at",
+		SQL: `ALTER TABLE urls ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;`,
+	},
+	{
+		// The purge job soft-deletes live links by expiry.
+		Version: 21,
+		Name:    "create_idx_urls_expires_at",
+		SQL: `CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_urls_expires_at
+	ON urls (expires_at) WHERE expires_at IS NOT NULL AND NOT is_deleted;`,
+		NoTx: true,
+	},
+	{
+		// Visits are counted by short code, like moderation and privacy, so the
+		// count follows the link in and out of urls_archive. Links never visited have no row.
+		Version: 22,
+		Name:    "create_url_visits",
+		SQL: `
+CREATE TABLE IF NOT EXISTS url_visits (
+	short_url       TEXT PRIMARY KEY,
+	visits          BIGINT NOT NULL,
+	last_visited_at TIMESTAMPTZ NOT NULL
+);`,
+	},
+	{
+		// The index migration 17 meant to create.
+		Version: 23,
+		Name:    "create_idx_urls_user_created_short",
+		SQL: `CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_urls_user_created_short
+	ON urls (user_id, created_at, short_url) WHERE NOT is_deleted;`,
+		NoTx: true,
+	},
+}
+
+// PostgreMigrations returns the schema history applied by NewPostgreRepository.
+func PostgreMigrations() []migrations.Migration {
+	return append([]migrations.Migration(nil), postgreMigrations...)
+}
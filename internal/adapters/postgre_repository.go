@@ -2,77 +2,285 @@ package adapters
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 
 	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/batch"
 	"github.com/OrtemRepos/shortlink/internal/common"
 	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/encryption"
+	"github.com/OrtemRepos/shortlink/internal/inflight"
 	"github.com/OrtemRepos/shortlink/internal/logger"
+	"github.com/OrtemRepos/shortlink/internal/logsample"
+	"github.com/OrtemRepos/shortlink/internal/migrations"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
+const uniqueViolation = "23505"
+
+// ErrRepositoryClosed is returned by operations started once Close was called.
+var ErrRepositoryClosed = errors.New("repository closed")
+
 type PostgreRepository struct {
-	Database *sqlx.DB
-	log      *zap.Logger
+	Database          *sqlx.DB
+	log               *zap.Logger
+	rehydrate         bool
+	keyring           *encryption.Keyring
+	deleteConcurrency int
+	// ops counts the operations in progress, so Close can wait for them.
+	ops inflight.Tracker
+	// lookups samples the debug logs of Find; nil logs every lookup.
+	lookups *logsample.Sampler
 }
 
-const schema = `
-CREATE TABLE IF NOT EXISTS urls (
-	user_id      UUID NOT NULL,
-	short_url    TEXT NOT NULL UNIQUE,
-	original_url TEXT NOT NULL,
-	is_deleted   BOOLEAN DEFAULT FALSE,
-	PRIMARY KEY (user_id, original_url)
-);`
+const defaultDeleteConcurrency = 4
+
+// A code found by Find is logged at most once per lookupLogInterval, and the last
+// lookupLogCodes codes logged are remembered for it.
+const (
+	lookupLogInterval = time.Minute
+	lookupLogCodes    = 1024
+)
+
+// archiveQuery moves rows with a single data-modifying CTE, so a link is never
+// absent from both tables. Links visited since $2 are kept hot.
+const archiveQuery = `
+WITH moved AS (
+	INSERT INTO urls_archive (user_id, short_url, original_url, original_url_index, dest_host_rev, is_deleted, created_at, expires_at)
+	SELECT u.user_id, u.short_url, u.original_url, u.original_url_index, u.dest_host_rev, u.is_deleted, u.created_at, u.expires_at
+	FROM urls u
+	LEFT JOIN url_visits v ON v.short_url = u.short_url
+	WHERE u.created_at < $1 AND u.reserved_until IS NULL
+		AND (v.last_visited_at IS NULL OR v.last_visited_at < $2)
+	ON CONFLICT DO NOTHING
+	RETURNING short_url
+)
+DELETE FROM urls WHERE short_url IN (SELECT short_url FROM moved);`
 
-func NewPostgreRepository(ctx context.Context, cfg *configs.Config) *PostgreRepository {
+const unarchiveQuery = `
+WITH restored AS (
+	INSERT INTO urls (user_id, short_url, original_url, original_url_index, dest_host_rev, is_deleted, created_at, expires_at)
+	SELECT user_id, short_url, original_url, original_url_index, dest_host_rev, is_deleted, created_at, expires_at FROM urls_archive
+	WHERE short_url = ANY($1)
+	ON CONFLICT DO NOTHING
+	RETURNING short_url
+)
+DELETE FROM urls_archive WHERE short_url IN (SELECT short_url FROM restored);`
+
+// A link saved again keeps its expiry, unless it was deleted or had expired: it then
+// takes the expiry it is saved with.
+const insertQuery = `
+INSERT INTO urls (user_id, short_url, original_url, dest_host_rev, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id, original_url)
+DO UPDATE SET is_deleted = FALSE, updated_at = now(),
+	expires_at = CASE WHEN urls.is_deleted OR urls.expires_at <= now() THEN EXCLUDED.expires_at ELSE urls.expires_at END
+RETURNING user_id, short_url, is_deleted;`
+
+// Encrypted values differ on every write, so duplicates are detected by the blind index.
+// Rows written before encryption was enabled have no index until Reencrypt reaches them.
+const insertEncryptedQuery = `
+INSERT INTO urls (user_id, short_url, original_url, original_url_index, dest_host_rev, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (user_id, original_url_index) WHERE original_url_index IS NOT NULL
+DO UPDATE SET is_deleted = FALSE, updated_at = now(),
+	expires_at = CASE WHEN urls.is_deleted OR urls.expires_at <= now() THEN EXCLUDED.expires_at ELSE urls.expires_at END
+RETURNING user_id, short_url, is_deleted;`
+
+// NewPostgreRepository connects and migrates the database.
+// A nil keyring stores original URLs in plaintext.
+func NewPostgreRepository(ctx context.Context, cfg *configs.Config, keyring *encryption.Keyring) *PostgreRepository {
 	db := common.GetConnection(cfg)
 	log := logger.GetLogger()
 	if err := db.PingContext(ctx); err != nil {
 		log.Panic("PostgreRepository: failed to ping database", zap.Error(err))
 	}
-	checkExistsTable(ctx, db)
+	if cfg.Server.ReadOnly {
+		log.Info("PostgreRepository: read-only mode, skipping migrations")
+	} else if err := migrations.Run(ctx, db, postgreMigrations); err != nil {
+		log.Panic("PostgreRepository: failed to migrate database", zap.Error(err))
+	}
 	return &PostgreRepository{
-		Database: db,
-		log:      log,
+		Database:          db,
+		log:               log,
+		rehydrate:         cfg.Archive.Rehydrate && !cfg.Server.ReadOnly,
+		keyring:           keyring,
+		deleteConcurrency: cfg.Database.DeleteConcurrency,
+		lookups:           logsample.New(lookupLogCodes, lookupLogInterval, nil),
 	}
 }
 
-func (p *PostgreRepository) Close() error {
-	return p.Database.Close()
+// Close refuses new operations with ErrRepositoryClosed and waits for those in
+// progress until ctx ends, then closes the database.
+func (p *PostgreRepository) Close(ctx context.Context) error {
+	var errs []error
+	if err := p.ops.Wait(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("%d operations still in progress: %w", p.ops.InFlight(), err))
+	}
+	return errors.Join(append(errs, p.Database.Close())...)
 }
 
 func (p *PostgreRepository) Ping(ctx context.Context) error {
+	if !p.ops.Enter() {
+		return ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
 	return p.Database.PingContext(ctx)
 }
 
-func checkExistsTable(ctx context.Context, db *sqlx.DB) {
-	db.MustExecContext(ctx, schema)
+// reservableURL is a row of urls that may be a reservation, without an original URL.
+type reservableURL struct {
+	domain.URL
+	ReservedUntil *time.Time `db:"reserved_until"`
+}
 
-	db.MustExecContext(ctx, "CREATE INDEX IF NOT EXISTS idx_short_url ON urls (short_url);")
-	db.MustExecContext(ctx, "CREATE INDEX IF NOT EXISTS idx_user_id ON urls (user_id);")
+// Exists counts expired reservations not purged yet too: their rows still hold the unique code.
+func (p *PostgreRepository) Exists(ctx context.Context, shortURL string) (bool, error) {
+	if !p.ops.Enter() {
+		return false, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	var exists bool
+	err := p.Database.GetContext(ctx, &exists,
+		`SELECT EXISTS (SELECT 1 FROM urls WHERE short_url = $1)
+		     OR EXISTS (SELECT 1 FROM urls_archive WHERE short_url = $1)`,
+		shortURL,
+	)
+	if err != nil {
+		return false, fmt.Errorf("unable to check short URL: %w", err)
+	}
+	return exists, nil
 }
 
 func (p *PostgreRepository) Find(ctx context.Context, shortURL string) (*domain.URL, error) {
+	if !p.ops.Enter() {
+		return nil, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	var row reservableURL
+	err := p.Database.GetContext(ctx, &row,
+		`SELECT u.user_id, COALESCE(u.original_url, '') AS original_url, u.short_url, u.is_deleted, u.created_at,
+		        u.expires_at, u.reserved_until, COALESCE(m.status, '') AS moderation_status, COALESCE(pr.privacy, '') AS privacy
+		 FROM urls u LEFT JOIN url_moderation m ON m.short_url = u.short_url
+		 LEFT JOIN url_privacy pr ON pr.short_url = u.short_url WHERE u.short_url = $1`,
+		shortURL,
+	)
+	url := row.URL
+	if errors.Is(err, sql.ErrNoRows) {
+		return p.findArchived(ctx, shortURL)
+	}
+	if err != nil {
+		p.log.Error("Error in find url", zap.Any("URL", url), zap.Error(err))
+		return nil, err
+	}
+	if row.ReservedUntil != nil {
+		if time.Now().Before(*row.ReservedUntil) {
+			return nil, domain.ErrCodeReserved
+		}
+		return nil, domain.ErrURLNotFound
+	}
+	p.logLookup(shortURL)
+	if err := p.decrypt(&url); err != nil {
+		return nil, err
+	}
+	return &url, nil
+}
+
+// logLookup logs a code found by Find at debug level, sampled per code so a popular
+// link does not flood the logs. Lookups are counted by MetricsRepository instead.
+func (p *PostgreRepository) logLookup(shortURL string) {
+	if !p.log.Core().Enabled(zap.DebugLevel) || (p.lookups != nil && !p.lookups.Allow(shortURL)) {
+		return
+	}
+	p.log.Debug("Find in storage", zap.String("short_url", shortURL))
+}
+
+func (p *PostgreRepository) decrypt(url *domain.URL) error {
+	if p.keyring == nil {
+		return nil
+	}
+	plaintext, err := p.keyring.Decrypt(url.OriginalURL)
+	if err != nil {
+		p.log.Error("failed to decrypt url", zap.String("short_url", url.ShortURL), zap.Error(err))
+		return fmt.Errorf("unable to decrypt URL: %w", err)
+	}
+	url.OriginalURL = plaintext
+	return nil
+}
+
+func (p *PostgreRepository) findArchived(ctx context.Context, shortURL string) (*domain.URL, error) {
 	var url domain.URL
 	err := p.Database.GetContext(ctx, &url,
-		"SELECT user_id, original_url, short_url, is_deleted FROM urls WHERE short_url = $1",
+		`SELECT a.user_id, a.original_url, a.short_url, a.is_deleted, a.created_at, a.expires_at, TRUE AS archived,
+		        COALESCE(m.status, '') AS moderation_status, COALESCE(pr.privacy, '') AS privacy
+		 FROM urls_archive a LEFT JOIN url_moderation m ON m.short_url = a.short_url
+		 LEFT JOIN url_privacy pr ON pr.short_url = a.short_url WHERE a.short_url = $1`,
 		shortURL,
 	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrURLNotFound
+	}
 	if err != nil {
-		p.log.Error("Error in find url", zap.Any("URL", url), zap.Error(err))
+		p.log.Error("Error in find archived url", zap.String("short_url", shortURL), zap.Error(err))
+		return nil, err
+	}
+	if err := p.decrypt(&url); err != nil {
 		return nil, err
 	}
-	p.log.Info("Find in storage", zap.Any("url", url))
+	if p.rehydrate {
+		if _, err := p.unarchive(ctx, []string{shortURL}); err != nil {
+			p.log.Warn("failed to rehydrate archived url", zap.String("short_url", shortURL), zap.Error(err))
+		} else {
+			url.Archived = false
+		}
+	}
 	return &url, nil
 }
 
+func (p *PostgreRepository) Archive(ctx context.Context, olderThan, idleSince time.Time) (int, error) {
+	if !p.ops.Enter() {
+		return 0, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	res, err := p.Database.ExecContext(ctx, archiveQuery, olderThan, idleSince)
+	if err != nil {
+		return 0, fmt.Errorf("unable to archive URLs: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (p *PostgreRepository) Unarchive(ctx context.Context, shortURLs []string) (int, error) {
+	if !p.ops.Enter() {
+		return 0, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	return p.unarchive(ctx, shortURLs)
+}
+
+func (p *PostgreRepository) unarchive(ctx context.Context, shortURLs []string) (int, error) {
+	res, err := p.Database.ExecContext(ctx, unarchiveQuery, shortURLs)
+	if err != nil {
+		return 0, fmt.Errorf("unable to unarchive URLs: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
 func (p *PostgreRepository) Save(ctx context.Context, url *domain.URL) error {
+	if !p.ops.Enter() {
+		return ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
 	tx := p.Database.MustBeginTx(ctx, nil)
 
 	defer func() { _ = tx.Rollback() }()
@@ -93,23 +301,32 @@ func (p *PostgreRepository) Save(ctx context.Context, url *domain.URL) error {
 }
 
 func (p *PostgreRepository) save(ctx context.Context, tx *sqlx.Tx, url *domain.URL) error {
-	url.GenerateShortURL()
-
-	stmt, err := tx.PreparexContext(
-		ctx,
-		`INSERT INTO urls (user_id, short_url, original_url)
-	 	 VALUES ($1, $2, $3)
-		 ON CONFLICT (user_id, original_url) 
-		 DO UPDATE SET is_deleted = FALSE
-		 RETURNING user_id, short_url, original_url, is_deleted;`,
-	)
+	if url.ShortURL == "" {
+		return domain.ErrShortURLRequired
+	}
+
+	hostRev := domain.ReversedHost(url.OriginalURL)
+	query, args := insertQuery, []any{url.UUID, url.ShortURL, url.OriginalURL, hostRev, url.ExpiresAt}
+	if p.keyring != nil {
+		encrypted, err := p.keyring.Encrypt(url.OriginalURL)
+		if err != nil {
+			return fmt.Errorf("unable to encrypt URL: %w", err)
+		}
+		query, args = insertEncryptedQuery, []any{url.UUID, url.ShortURL, encrypted, p.keyring.BlindIndex(url.OriginalURL), hostRev, url.ExpiresAt}
+	}
+
+	stmt, err := tx.PreparexContext(ctx, query)
 	if err != nil {
 		return fmt.Errorf("unable to prepare statement: %w", err)
 	}
 	defer stmt.Close()
 
 	existingURL := &domain.URL{}
-	err = stmt.QueryRowxContext(ctx, url.UUID, url.ShortURL, url.OriginalURL).StructScan(existingURL)
+	err = stmt.QueryRowxContext(ctx, args...).StructScan(existingURL)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return domain.ErrShortURLTaken
+	}
 	if err != nil {
 		return fmt.Errorf("query row error: %w", err)
 	}
@@ -119,11 +336,51 @@ func (p *PostgreRepository) save(ctx context.Context, tx *sqlx.Tx, url *domain.U
 		url.DeletedFlag = existingURL.DeletedFlag
 		return domain.ErrURLAlreadyExists
 	}
+	if url.Privacy != domain.PrivacyDefault {
+		if _, err := tx.ExecContext(ctx, upsertPrivacyQuery, url.ShortURL, url.Privacy); err != nil {
+			return fmt.Errorf("unable to save privacy: %w", err)
+		}
+	}
+
+	return nil
+}
+
+const upsertPrivacyQuery = `
+INSERT INTO url_privacy (short_url, privacy) VALUES ($1, $2)
+ON CONFLICT (short_url) DO UPDATE SET privacy = EXCLUDED.privacy`
 
+// setPrivacyQuery writes the privacy of a link only if userID owns it, live.
+const setPrivacyQuery = `
+INSERT INTO url_privacy (short_url, privacy)
+SELECT $2, $3
+WHERE EXISTS (SELECT 1 FROM urls WHERE short_url = $2 AND user_id = $1 AND NOT is_deleted AND reserved_until IS NULL)
+	OR EXISTS (SELECT 1 FROM urls_archive WHERE short_url = $2 AND user_id = $1 AND NOT is_deleted)
+ON CONFLICT (short_url) DO UPDATE SET privacy = EXCLUDED.privacy`
+
+func (p *PostgreRepository) SetPrivacy(ctx context.Context, userID, shortURL string, privacy domain.Privacy) error {
+	if !p.ops.Enter() {
+		return ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	res, err := p.Database.ExecContext(ctx, setPrivacyQuery, userID, shortURL, privacy)
+	if err != nil {
+		return fmt.Errorf("unable to set privacy: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrURLNotFound
+	}
 	return nil
 }
 
 func (p *PostgreRepository) BatchSave(ctx context.Context, urls []*domain.URL) error {
+	if !p.ops.Enter() {
+		return ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
 	tx := p.Database.MustBeginTx(ctx, nil)
 
 	defer func() { _ = tx.Rollback() }()
@@ -138,35 +395,855 @@ func (p *PostgreRepository) BatchSave(ctx context.Context, urls []*domain.URL) e
 	return tx.Commit()
 }
 
-func (p *PostgreRepository) delete(ctx context.Context, tx *sqlx.Tx, userID, shortURL string) error {
-	stmt, err := tx.PrepareContext(ctx, "UPDATE urls SET is_deleted = true WHERE user_id = $1 AND short_url = $2;")
+const deleteQuery = `
+UPDATE urls SET is_deleted = true, updated_at = now()
+WHERE user_id = $1 AND short_url = ANY($2) AND is_deleted = false`
+
+// deleteUser soft-deletes the links of one user in a single statement, so in its own short transaction.
+func (p *PostgreRepository) deleteUser(ctx context.Context, userID string, shortURLs []string) (int, error) {
+	res, err := p.Database.ExecContext(ctx, deleteQuery, userID, shortURLs)
 	if err != nil {
-		p.log.Error("failed to prepare delete statement", zap.Error(err))
-		return fmt.Errorf("failed to prepare delete statement: %w", err)
+		return 0, fmt.Errorf("unable to delete URLs: %w", err)
 	}
-	defer stmt.Close()
-	_, err = stmt.ExecContext(ctx, userID, shortURL)
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// BatchDelete deletes the links of up to deleteConcurrency users at a time, one transaction each,
+// so a slow user holds neither the others nor a long transaction.
+func (p *PostgreRepository) BatchDelete(ctx context.Context, ids map[string][]string) (int, error) {
+	if !p.ops.Enter() {
+		return 0, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	concurrency := p.deleteConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultDeleteConcurrency
+	}
+	deleted, err := batch.PerKey(ctx, ids, concurrency, p.deleteUser)
 	if err != nil {
-		p.log.Error("failed to delete URL", zap.Error(err))
-		return fmt.Errorf("failed to delete URL: %w", err)
+		p.log.Error("failed to delete URLs", zap.Error(err), zap.Int("deleted", deleted))
 	}
-	return nil
+	return deleted, err
 }
 
-func (p *PostgreRepository) BatchDelete(ctx context.Context, ids map[string][]string) error {
-	tx := p.Database.MustBeginTx(ctx, nil)
-	errs := make([]error, 0, len(ids))
-	defer func() { _ = tx.Rollback() }()
-	for userID, linkIDs := range ids {
-		for _, linkID := range linkIDs {
-			err := p.delete(ctx, tx, userID, linkID)
+// Reencrypt encrypts rows that are plaintext or use an old key with the primary key,
+// batchSize rows per transaction; duplicates from before encryption are skipped.
+func (p *PostgreRepository) Reencrypt(ctx context.Context, batchSize int) (int, error) {
+	if !p.ops.Enter() {
+		return 0, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	if p.keyring == nil {
+		return 0, nil
+	}
+	total := 0
+	for _, table := range []string{"urls", "urls_archive"} {
+		skipped := make([]string, 0)
+		for {
+			if err := ctx.Err(); err != nil {
+				return total, err
+			}
+			updated, conflicts, err := p.reencryptBatch(ctx, table, batchSize, skipped)
+			total += updated
 			if err != nil {
-				p.log.Error("failed to delete URL", zap.Error(err), zap.String("user_id", userID), zap.String("link_id", linkID))
-				errs = append(errs, fmt.Errorf("unable to delete URL: %w", err))
+				return total, err
+			}
+			skipped = append(skipped, conflicts...)
+			if updated == 0 && len(conflicts) == 0 {
+				break
 			}
 		}
+		if len(skipped) > 0 {
+			p.log.Warn("rows left unencrypted due to duplicate blind index",
+				zap.String("table", table), zap.Strings("short_urls", skipped))
+		}
+	}
+	return total, nil
+}
+
+func (p *PostgreRepository) reencryptBatch(ctx context.Context, table string, batchSize int, skip []string) (int, []string, error) {
+	tx, err := p.Database.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows := make([]domain.URL, 0, batchSize)
+	err = tx.SelectContext(ctx, &rows,
+		`SELECT user_id, short_url, original_url FROM `+table+`
+		 WHERE left(original_url, length($1)) <> $1 AND NOT (short_url = ANY($2))
+		 ORDER BY short_url LIMIT $3 FOR UPDATE SKIP LOCKED`,
+		p.keyring.CurrentPrefix(), skip, batchSize,
+	)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to select rows to re-encrypt: %w", err)
+	}
+
+	update := `UPDATE ` + table + ` SET original_url = $1, original_url_index = $2 WHERE short_url = $3`
+	if table == "urls" {
+		update += ` AND NOT EXISTS (
+			SELECT 1 FROM urls other
+			WHERE other.user_id = urls.user_id AND other.original_url_index = $2 AND other.short_url <> $3)`
+	}
+	updated, conflicts := 0, make([]string, 0)
+	for _, row := range rows {
+		plaintext, err := p.keyring.Decrypt(row.OriginalURL)
+		if err != nil {
+			return 0, nil, fmt.Errorf("unable to decrypt %s: %w", row.ShortURL, err)
+		}
+		encrypted, err := p.keyring.Encrypt(plaintext)
+		if err != nil {
+			return 0, nil, fmt.Errorf("unable to encrypt %s: %w", row.ShortURL, err)
+		}
+		res, err := tx.ExecContext(ctx, update, encrypted, p.keyring.BlindIndex(plaintext), row.ShortURL)
+		if err != nil {
+			return 0, nil, fmt.Errorf("unable to re-encrypt %s: %w", row.ShortURL, err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			conflicts = append(conflicts, row.ShortURL)
+			continue
+		}
+		updated++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, nil, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+	return updated, conflicts, nil
+}
+
+// findByHostQuery narrows by the reversed host prefix, an index range scan on
+// idx_urls_user_host_rev; url prefixes are then matched on the decrypted URLs.
+const findByHostQuery = `
+SELECT short_url, original_url FROM urls
+WHERE user_id = $1 AND NOT is_deleted AND dest_host_rev LIKE $2 || '%'`
+
+const findByExactHostQuery = `
+SELECT short_url, original_url FROM urls
+WHERE user_id = $1 AND NOT is_deleted AND dest_host_rev = $2`
+
+func (p *PostgreRepository) FindByUserAndHost(ctx context.Context, userID string, filter domain.URLFilter) ([]string, error) {
+	if !p.ops.Enter() {
+		return nil, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	query := findByHostQuery
+	if filter.Exact() {
+		query = findByExactHostQuery
+	}
+	rows := make([]domain.URL, 0)
+	if err := p.Database.SelectContext(ctx, &rows, query, userID, filter.ReversedHost()); err != nil {
+		return nil, fmt.Errorf("unable to find URLs by host: %w", err)
+	}
+	shortURLs := make([]string, 0, len(rows))
+	for i := range rows {
+		if err := p.decrypt(&rows[i]); err != nil {
+			return nil, err
+		}
+		if filter.Matches(rows[i].OriginalURL) {
+			shortURLs = append(shortURLs, rows[i].ShortURL)
+		}
+	}
+	return shortURLs, nil
+}
+
+const exportByUserQuery = `
+SELECT user_id, short_url, original_url, created_at, expires_at, FALSE AS archived FROM urls
+WHERE user_id = $1 AND NOT is_deleted AND reserved_until IS NULL
+UNION ALL
+SELECT user_id, short_url, original_url, created_at, expires_at, TRUE AS archived FROM urls_archive
+WHERE user_id = $1 AND NOT is_deleted
+ORDER BY short_url`
+
+func (p *PostgreRepository) ExportByUser(ctx context.Context, userID string) ([]domain.URL, error) {
+	if !p.ops.Enter() {
+		return nil, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	links := make([]domain.URL, 0)
+	if err := p.Database.SelectContext(ctx, &links, exportByUserQuery, userID); err != nil {
+		return nil, fmt.Errorf("unable to export URLs: %w", err)
+	}
+	for i := range links {
+		if err := p.decrypt(&links[i]); err != nil {
+			return nil, err
+		}
+	}
+	return links, nil
+}
+
+const countByUserQuery = `
+SELECT (SELECT COUNT(*) FROM urls WHERE user_id = $1 AND NOT is_deleted AND reserved_until IS NULL)
+	+ (SELECT COUNT(*) FROM urls_archive WHERE user_id = $1 AND NOT is_deleted)`
+
+func (p *PostgreRepository) CountByUser(ctx context.Context, userID string) (int, error) {
+	if !p.ops.Enter() {
+		return 0, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	var count int
+	if err := p.Database.GetContext(ctx, &count, countByUserQuery, userID); err != nil {
+		return 0, fmt.Errorf("unable to count user URLs: %w", err)
+	}
+	return count, nil
+}
+
+const countLinksQuery = `SELECT (SELECT COUNT(*) FROM urls) + (SELECT COUNT(*) FROM urls_archive)`
+
+func (p *PostgreRepository) CountLinks(ctx context.Context) (int, error) {
+	if !p.ops.Enter() {
+		return 0, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	var count int
+	if err := p.Database.GetContext(ctx, &count, countLinksQuery); err != nil {
+		return 0, fmt.Errorf("unable to count URLs: %w", err)
+	}
+	return count, nil
+}
+
+const statsQuery = `
+SELECT COUNT(*) AS urls, COUNT(DISTINCT user_id) AS users FROM (
+	SELECT user_id FROM urls WHERE NOT is_deleted AND reserved_until IS NULL
+	UNION ALL
+	SELECT user_id FROM urls_archive WHERE NOT is_deleted
+) live`
+
+func (p *PostgreRepository) Stats(ctx context.Context) (domain.Stats, error) {
+	if !p.ops.Enter() {
+		return domain.Stats{}, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	var stats domain.Stats
+	if err := p.Database.GetContext(ctx, &stats, statsQuery); err != nil {
+		return domain.Stats{}, fmt.Errorf("unable to count URLs and users: %w", err)
+	}
+	return stats, nil
+}
+
+// findManyQuery leaves out reservations, expired ones too: their codes resolve as unknown.
+const findManyQuery = `
+SELECT u.user_id, u.original_url, u.short_url, u.is_deleted, u.created_at, u.expires_at, FALSE AS archived,
+	COALESCE(m.status, '') AS moderation_status FROM urls u
+LEFT JOIN url_moderation m ON m.short_url = u.short_url
+WHERE u.short_url = ANY($1) AND u.reserved_until IS NULL
+UNION ALL
+SELECT a.user_id, a.original_url, a.short_url, a.is_deleted, a.created_at, a.expires_at, TRUE AS archived,
+	COALESCE(m.status, '') FROM urls_archive a
+LEFT JOIN url_moderation m ON m.short_url = a.short_url
+WHERE a.short_url = ANY($1)`
+
+// FindMany reads every code in one query and never rehydrates archived links, unlike Find.
+func (p *PostgreRepository) FindMany(ctx context.Context, shortURLs []string) (map[string]domain.URL, error) {
+	if !p.ops.Enter() {
+		return nil, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	rows := make([]domain.URL, 0, len(shortURLs))
+	if err := p.Database.SelectContext(ctx, &rows, findManyQuery, shortURLs); err != nil {
+		return nil, fmt.Errorf("unable to find URLs: %w", err)
+	}
+	found := make(map[string]domain.URL, len(rows))
+	for i := range rows {
+		if err := p.decrypt(&rows[i]); err != nil {
+			return nil, err
+		}
+		found[rows[i].ShortURL] = rows[i]
+	}
+	return found, nil
+}
+
+// findByUserQuery lists links by (created_at, short_url) from offset $3. $4 keeps
+// the original URLs containing it, in any case.
+const findByUserQuery = `
+SELECT * FROM (
+	SELECT u.user_id, u.original_url, u.short_url, u.created_at, u.expires_at, FALSE AS archived, u.last_checked_at, u.last_status,
+	COALESCE(m.status, '') AS moderation_status FROM urls u
+	LEFT JOIN url_moderation m ON m.short_url = u.short_url
+	WHERE NOT u.is_deleted AND u.user_id = $1 AND u.reserved_until IS NULL
+		AND ($4 = '' OR strpos(lower(u.original_url), lower($4)) > 0)
+	UNION ALL
+	SELECT a.user_id, a.original_url, a.short_url, a.created_at, a.expires_at, TRUE AS archived, NULL::timestamptz, '',
+	COALESCE(m.status, '') FROM urls_archive a
+	LEFT JOIN url_moderation m ON m.short_url = a.short_url
+	WHERE NOT a.is_deleted AND a.user_id = $1
+		AND ($4 = '' OR strpos(lower(a.original_url), lower($4)) > 0)
+) links
+ORDER BY created_at, short_url
+LIMIT $2 OFFSET $3`
+
+// findByUserAfterQuery is findByUserQuery after the cursor ($2, $3), a row comparison
+// the indexes of migrations 18 and 23 seek to. $5 is the search.
+const findByUserAfterQuery = `
+SELECT * FROM (
+	SELECT u.user_id, u.original_url, u.short_url, u.created_at, u.expires_at, FALSE AS archived, u.last_checked_at, u.last_status,
+	COALESCE(m.status, '') AS moderation_status FROM urls u
+	LEFT JOIN url_moderation m ON m.short_url = u.short_url
+	WHERE NOT u.is_deleted AND u.user_id = $1 AND u.reserved_until IS NULL
+		AND (u.created_at, u.short_url) > ($2, $3)
+		AND ($5 = '' OR strpos(lower(u.original_url), lower($5)) > 0)
+	UNION ALL
+	SELECT a.user_id, a.original_url, a.short_url, a.created_at, a.expires_at, TRUE AS archived, NULL::timestamptz, '',
+	COALESCE(m.status, '') FROM urls_archive a
+	LEFT JOIN url_moderation m ON m.short_url = a.short_url
+	WHERE NOT a.is_deleted AND a.user_id = $1
+		AND (a.created_at, a.short_url) > ($2, $3)
+		AND ($5 = '' OR strpos(lower(a.original_url), lower($5)) > 0)
+) links
+ORDER BY created_at, short_url
+LIMIT $4`
+
+// findByUserShortURLQuery is findByUserQuery listing links by short_url; short codes
+// are unique, so $2 alone is the cursor, the empty string before the first page.
+const findByUserShortURLQuery = `
+SELECT * FROM (
+	SELECT u.user_id, u.original_url, u.short_url, u.created_at, u.expires_at, FALSE AS archived, u.last_checked_at, u.last_status,
+	COALESCE(m.status, '') AS moderation_status FROM urls u
+	LEFT JOIN url_moderation m ON m.short_url = u.short_url
+	WHERE NOT u.is_deleted AND u.user_id = $1 AND u.reserved_until IS NULL AND u.short_url > $2
+		AND ($5 = '' OR strpos(lower(u.original_url), lower($5)) > 0)
+	UNION ALL
+	SELECT a.user_id, a.original_url, a.short_url, a.created_at, a.expires_at, TRUE AS archived, NULL::timestamptz, '',
+	COALESCE(m.status, '') FROM urls_archive a
+	LEFT JOIN url_moderation m ON m.short_url = a.short_url
+	WHERE NOT a.is_deleted AND a.user_id = $1 AND a.short_url > $2
+		AND ($5 = '' OR strpos(lower(a.original_url), lower($5)) > 0)
+) links
+ORDER BY short_url
+LIMIT $3 OFFSET $4`
+
+// FindByUser searches plaintext original URLs only: encrypted ones differ on every
+// write, so a page with a Query fails with domain.ErrQueryUnsupported under a keyring.
+func (p *PostgreRepository) FindByUser(ctx context.Context, userID string, page domain.LinkPage) ([]domain.URL, error) {
+	if page.Query != "" && p.keyring != nil {
+		return nil, domain.ErrQueryUnsupported
+	}
+	if !p.ops.Enter() {
+		return nil, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	var query string
+	var args []any
+	switch {
+	case page.Sort == domain.SortByShortURL && page.After != nil:
+		query, args = findByUserShortURLQuery, []any{userID, page.After.ShortURL, page.Limit, 0, page.Query}
+	case page.Sort == domain.SortByShortURL:
+		query, args = findByUserShortURLQuery, []any{userID, "", page.Limit, page.Offset, page.Query}
+	case page.After != nil:
+		query, args = findByUserAfterQuery, []any{userID, page.After.CreatedAt, page.After.ShortURL, page.Limit, page.Query}
+	default:
+		query, args = findByUserQuery, []any{userID, page.Limit, page.Offset, page.Query}
+	}
+	links := make([]domain.URL, 0, page.Limit)
+	if err := p.Database.SelectContext(ctx, &links, query, args...); err != nil {
+		return nil, fmt.Errorf("unable to select user URLs: %w", err)
+	}
+	for i := range links {
+		if err := p.decrypt(&links[i]); err != nil {
+			return nil, err
+		}
+	}
+	return links, nil
+}
+
+// PostgreUserLinksQueries returns the queries of FindByUser by creation time, for
+// tests to check their plans.
+func PostgreUserLinksQueries() map[string]string {
+	return map[string]string{"first": findByUserQuery, "after": findByUserAfterQuery}
+}
+
+const countByQueryQuery = `
+SELECT (SELECT COUNT(*) FROM urls WHERE user_id = $1 AND NOT is_deleted AND reserved_until IS NULL
+		AND ($2 = '' OR strpos(lower(original_url), lower($2)) > 0))
+	+ (SELECT COUNT(*) FROM urls_archive WHERE user_id = $1 AND NOT is_deleted
+		AND ($2 = '' OR strpos(lower(original_url), lower($2)) > 0))`
+
+func (p *PostgreRepository) CountByQuery(ctx context.Context, userID, query string) (int, error) {
+	if query != "" && p.keyring != nil {
+		return 0, domain.ErrQueryUnsupported
+	}
+	if !p.ops.Enter() {
+		return 0, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	var count int
+	if err := p.Database.GetContext(ctx, &count, countByQueryQuery, userID, query); err != nil {
+		return 0, fmt.Errorf("unable to count user URLs: %w", err)
+	}
+	return count, nil
+}
+
+const linksToCheckQuery = `
+SELECT u.user_id, u.short_url, u.original_url, u.last_checked_at, u.last_status FROM urls u
+WHERE NOT u.is_deleted AND u.reserved_until IS NULL AND (u.last_checked_at IS NULL OR u.last_checked_at < $1)
+	AND NOT EXISTS (SELECT 1 FROM link_check_opt_outs o WHERE o.user_id = u.user_id)
+ORDER BY u.last_checked_at NULLS FIRST, u.short_url
+LIMIT $2`
+
+const recordChecksQuery = `
+UPDATE urls SET last_checked_at = c.checked_at, last_status = c.status
+FROM unnest($1::text[], $2::timestamptz[], $3::text[]) AS c(short_url, checked_at, status)
+WHERE urls.short_url = c.short_url`
+
+func (p *PostgreRepository) LinksToCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]domain.URL, error) {
+	if !p.ops.Enter() {
+		return nil, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	links := make([]domain.URL, 0, limit)
+	if err := p.Database.SelectContext(ctx, &links, linksToCheckQuery, checkedBefore, limit); err != nil {
+		return nil, fmt.Errorf("unable to select links to check: %w", err)
+	}
+	for i := range links {
+		if err := p.decrypt(&links[i]); err != nil {
+			return nil, err
+		}
+	}
+	return links, nil
+}
+
+// RecordChecks stores all checks in one statement. Checks of links archived meanwhile are dropped.
+func (p *PostgreRepository) RecordChecks(ctx context.Context, checks []domain.LinkCheck) error {
+	if !p.ops.Enter() {
+		return ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	shortURLs := make([]string, 0, len(checks))
+	checkedAt := make([]time.Time, 0, len(checks))
+	statuses := make([]string, 0, len(checks))
+	for _, check := range checks {
+		shortURLs = append(shortURLs, check.ShortURL)
+		checkedAt = append(checkedAt, check.CheckedAt)
+		statuses = append(statuses, check.Status)
+	}
+	if _, err := p.Database.ExecContext(ctx, recordChecksQuery, shortURLs, checkedAt, statuses); err != nil {
+		return fmt.Errorf("unable to record link checks: %w", err)
+	}
+	return nil
+}
+
+func (p *PostgreRepository) SetLinkChecks(ctx context.Context, userID string, enabled bool) error {
+	if !p.ops.Enter() {
+		return ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	query := `INSERT INTO link_check_opt_outs (user_id) VALUES ($1) ON CONFLICT DO NOTHING`
+	if enabled {
+		query = `DELETE FROM link_check_opt_outs WHERE user_id = $1`
+	}
+	if _, err := p.Database.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("unable to set link checks: %w", err)
+	}
+	return nil
+}
+
+// mergeLosersQuery finds, among links of $1 and $2 to the same original URL,
+// every link but the one to keep: live before deleted, then the oldest.
+const mergeLosersQuery = `
+SELECT d.short_url, d.user_id FROM urls d
+JOIN urls k ON k.user_id IN ($1, $2) AND k.user_id <> d.user_id
+	AND (k.original_url = d.original_url OR k.original_url_index = d.original_url_index)
+	AND (k.is_deleted, k.created_at, k.short_url) < (d.is_deleted, d.created_at, d.short_url)
+WHERE d.user_id IN ($1, $2)`
+
+// ReassignOwner moves the links of from to to in one transaction.
+func (p *PostgreRepository) ReassignOwner(ctx context.Context, from, to string) (int, error) {
+	if !p.ops.Enter() {
+		return 0, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	tx, err := p.Database.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM urls WHERE user_id IN ($1, $2) FOR UPDATE`, from, to); err != nil {
+		return 0, fmt.Errorf("unable to lock links: %w", err)
+	}
+	var losers []struct {
+		ShortURL string `db:"short_url"`
+		UserID   string `db:"user_id"`
+	}
+	if err := tx.SelectContext(ctx, &losers, mergeLosersQuery, from, to); err != nil {
+		return 0, fmt.Errorf("unable to find duplicate links: %w", err)
+	}
+	all, ofTarget := make([]string, 0, len(losers)), make([]string, 0)
+	for _, l := range losers {
+		all = append(all, l.ShortURL)
+		if l.UserID == to {
+			ofTarget = append(ofTarget, l.ShortURL)
+		}
+	}
+
+	parking := uuid.NewString()
+	steps := []struct {
+		query string
+		args  []any
+	}{
+		{`UPDATE urls SET user_id = $1 WHERE short_url = ANY($2)`, []any{parking, ofTarget}},
+		{`UPDATE urls SET is_deleted = TRUE, updated_at = now() WHERE short_url = ANY($1) AND NOT is_deleted`, []any{all}},
+	}
+	for _, step := range steps {
+		if _, err := tx.ExecContext(ctx, step.query, step.args...); err != nil {
+			return 0, fmt.Errorf("unable to set aside duplicate links: %w", err)
+		}
+	}
+	res, err := tx.ExecContext(ctx,
+		`UPDATE urls SET user_id = $2, updated_at = now() WHERE user_id = $1 AND NOT (short_url = ANY($3))`,
+		from, to, all)
+	if err != nil {
+		return 0, fmt.Errorf("unable to reassign links: %w", err)
+	}
+	moved, _ := res.RowsAffected()
+	if _, err := tx.ExecContext(ctx, `UPDATE urls SET user_id = $1 WHERE user_id = $2`, from, parking); err != nil {
+		return 0, fmt.Errorf("unable to reassign duplicate links: %w", err)
+	}
+	res, err = tx.ExecContext(ctx, `UPDATE urls_archive SET user_id = $2 WHERE user_id = $1`, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("unable to reassign archived links: %w", err)
+	}
+	archived, _ := res.RowsAffected()
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+	return int(moved + archived), nil
+}
+
+// reserveQuery inserts the reservation, or takes over an expired one of the code.
+// Nothing is returned when the code is a link, archived or not, or an active reservation.
+const reserveQuery = `
+INSERT INTO urls (user_id, short_url, reserved_until)
+SELECT $1, $2, $3
+WHERE NOT EXISTS (SELECT 1 FROM urls_archive WHERE short_url = $2)
+ON CONFLICT (short_url) DO UPDATE
+SET user_id = EXCLUDED.user_id, reserved_until = EXCLUDED.reserved_until,
+	is_deleted = FALSE, created_at = now(), updated_at = now()
+WHERE urls.reserved_until <= now()
+RETURNING short_url`
+
+func (p *PostgreRepository) Reserve(ctx context.Context, userID, code string, ttl time.Duration) error {
+	if !p.ops.Enter() {
+		return ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	var reserved string
+	err := p.Database.GetContext(ctx, &reserved, reserveQuery, userID, code, time.Now().Add(ttl))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrShortURLTaken
+	}
+	if err != nil {
+		return fmt.Errorf("unable to reserve short URL: %w", err)
+	}
+	return nil
+}
+
+const completeReservationQuery = `
+UPDATE urls SET original_url = $2, original_url_index = $3, dest_host_rev = $4,
+	reserved_until = NULL, created_at = now(), updated_at = now()
+WHERE short_url = $1`
+
+// CompleteReservation locks the reservation row, so a purge or a second completion waits for it.
+// A user already having a link to originalURL fails on the unique key with domain.ErrURLAlreadyExists.
+func (p *PostgreRepository) CompleteReservation(ctx context.Context, userID, code, originalURL string) error {
+	if !p.ops.Enter() {
+		return ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	tx, err := p.Database.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var reservation domain.Reservation
+	err = tx.GetContext(ctx, &reservation,
+		`SELECT short_url, user_id, reserved_until FROM urls
+		 WHERE short_url = $1 AND reserved_until IS NOT NULL FOR UPDATE`, code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrReservationNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("unable to find reservation: %w", err)
+	}
+	if !reservation.Active(time.Now()) {
+		return domain.ErrReservationNotFound
+	}
+	if reservation.UserID != userID {
+		return domain.ErrNotReservationOwner
+	}
+	stored, index := originalURL, sql.NullString{}
+	if p.keyring != nil {
+		if stored, err = p.keyring.Encrypt(originalURL); err != nil {
+			return fmt.Errorf("unable to encrypt URL: %w", err)
+		}
+		index = sql.NullString{String: p.keyring.BlindIndex(originalURL), Valid: true}
+	}
+	_, err = tx.ExecContext(ctx, completeReservationQuery, code, stored, index, domain.ReversedHost(originalURL))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return domain.ErrURLAlreadyExists
+	}
+	if err != nil {
+		return fmt.Errorf("unable to complete reservation: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (p *PostgreRepository) Reservations(ctx context.Context, userID string) ([]domain.Reservation, error) {
+	if !p.ops.Enter() {
+		return nil, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	reservations := make([]domain.Reservation, 0)
+	err := p.Database.SelectContext(ctx, &reservations,
+		`SELECT short_url, user_id, reserved_until FROM urls
+		 WHERE user_id = $1 AND reserved_until > now() ORDER BY short_url`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list reservations: %w", err)
+	}
+	return reservations, nil
+}
+
+func (p *PostgreRepository) PurgeExpiredReservations(ctx context.Context, now time.Time) (int, error) {
+	if !p.ops.Enter() {
+		return 0, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	res, err := p.Database.ExecContext(ctx, `DELETE FROM urls WHERE reserved_until <= $1`, now)
+	if err != nil {
+		return 0, fmt.Errorf("unable to purge expired reservations: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// incrementVisitQuery counts a visit of a link, hot or archived; it inserts nothing
+// for an unknown code.
+const incrementVisitQuery = `
+INSERT INTO url_visits (short_url, visits, last_visited_at)
+SELECT $1, 1, now()
+WHERE EXISTS (SELECT 1 FROM urls WHERE short_url = $1 AND reserved_until IS NULL)
+	OR EXISTS (SELECT 1 FROM urls_archive WHERE short_url = $1)
+ON CONFLICT (short_url) DO UPDATE SET visits = url_visits.visits + 1, last_visited_at = now()`
+
+func (p *PostgreRepository) IncrementVisit(ctx context.Context, shortURL string) error {
+	if !p.ops.Enter() {
+		return ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	res, err := p.Database.ExecContext(ctx, incrementVisitQuery, shortURL)
+	if err != nil {
+		return fmt.Errorf("unable to count visit: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrURLNotFound
+	}
+	return nil
+}
+
+// linkStatsQuery reads the visits of a live link of $1, with no row if $1 owns no such link.
+const linkStatsQuery = `
+SELECT l.short_url, COALESCE(v.visits, 0) AS visits, v.last_visited_at FROM (
+	SELECT short_url FROM urls
+	WHERE short_url = $2 AND user_id = $1 AND NOT is_deleted AND reserved_until IS NULL
+	UNION ALL
+	SELECT short_url FROM urls_archive WHERE short_url = $2 AND user_id = $1 AND NOT is_deleted
+) l
+LEFT JOIN url_visits v ON v.short_url = l.short_url`
+
+func (p *PostgreRepository) LinkStats(ctx context.Context, userID, shortURL string) (domain.LinkStats, error) {
+	if !p.ops.Enter() {
+		return domain.LinkStats{}, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	var stats domain.LinkStats
+	err := p.Database.GetContext(ctx, &stats, linkStatsQuery, userID, shortURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.LinkStats{}, domain.ErrURLNotFound
+	}
+	if err != nil {
+		return domain.LinkStats{}, fmt.Errorf("unable to read link stats: %w", err)
+	}
+	return stats, nil
+}
+
+// purgeExpiredQuery soft-deletes the expired links of both tables: their codes stay
+// taken, and Find still tells them apart from unknown codes.
+const purgeExpiredQuery = `
+WITH hot AS (
+	UPDATE urls SET is_deleted = TRUE, updated_at = now()
+	WHERE expires_at <= $1 AND NOT is_deleted
+	RETURNING 1
+), cold AS (
+	UPDATE urls_archive SET is_deleted = TRUE
+	WHERE expires_at <= $1 AND NOT is_deleted
+	RETURNING 1
+)
+SELECT (SELECT COUNT(*) FROM hot) + (SELECT COUNT(*) FROM cold)`
+
+func (p *PostgreRepository) PurgeExpiredLinks(ctx context.Context, now time.Time) (int, error) {
+	if !p.ops.Enter() {
+		return 0, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	var purged int
+	if err := p.Database.GetContext(ctx, &purged, purgeExpiredQuery, now); err != nil {
+		return 0, fmt.Errorf("unable to purge expired links: %w", err)
+	}
+	return purged, nil
+}
+
+// moderationRow is a row of url_moderation or url_moderation_events.
+type moderationRow struct {
+	ShortURL   string     `db:"short_url"`
+	UserID     string     `db:"user_id"`
+	FromStatus string     `db:"from_status"`
+	Status     string     `db:"status"`
+	Reason     string     `db:"reason"`
+	Note       string     `db:"note"`
+	Actor      string     `db:"actor"`
+	At         *time.Time `db:"moderated_at"`
+}
+
+func (row moderationRow) moderation() domain.Moderation {
+	m := domain.Moderation{
+		Status: domain.ModerationStatus(row.Status),
+		Reason: domain.ModerationReason(row.Reason),
+		Note:   row.Note,
+		Actor:  row.Actor,
+	}
+	if row.At != nil {
+		m.At = *row.At
+	}
+	return m
+}
+
+const linkOwnerQuery = `
+SELECT user_id FROM urls WHERE short_url = $1 AND reserved_until IS NULL
+UNION ALL
+SELECT user_id FROM urls_archive WHERE short_url = $1
+LIMIT 1`
+
+func (p *PostgreRepository) Moderate(ctx context.Context, shortURL string, change domain.Moderation) (domain.Moderation, error) {
+	if !p.ops.Enter() {
+		return domain.Moderation{}, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	tx, err := p.Database.BeginTxx(ctx, nil)
+	if err != nil {
+		return domain.Moderation{}, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var owner string
+	err = tx.GetContext(ctx, &owner, linkOwnerQuery, shortURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Moderation{}, domain.ErrURLNotFound
+	}
+	if err != nil {
+		return domain.Moderation{}, fmt.Errorf("unable to find url: %w", err)
+	}
+	// A clean row is inserted first so FOR UPDATE also serializes the first decision on a link.
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO url_moderation (short_url, status) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		shortURL, domain.ModerationClean)
+	if err != nil {
+		return domain.Moderation{}, fmt.Errorf("unable to moderate url: %w", err)
+	}
+	var current domain.ModerationStatus
+	err = tx.GetContext(ctx, &current, `SELECT status FROM url_moderation WHERE short_url = $1 FOR UPDATE`, shortURL)
+	if err != nil {
+		return domain.Moderation{}, fmt.Errorf("unable to read moderation: %w", err)
+	}
+	if err := domain.CheckModeration(current, change); err != nil {
+		return domain.Moderation{}, err
+	}
+	change.At = time.Now().UTC()
+	_, err = tx.ExecContext(ctx,
+		`UPDATE url_moderation SET status = $2, reason = $3, note = $4, actor = $5, moderated_at = $6
+		 WHERE short_url = $1`,
+		shortURL, change.Status, change.Reason, change.Note, change.Actor, change.At)
+	if err != nil {
+		return domain.Moderation{}, fmt.Errorf("unable to moderate url: %w", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO url_moderation_events (short_url, from_status, status, reason, note, actor, moderated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		shortURL, current, change.Status, change.Reason, change.Note, change.Actor, change.At)
+	if err != nil {
+		return domain.Moderation{}, fmt.Errorf("unable to audit moderation: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return domain.Moderation{}, fmt.Errorf("unable to commit transaction: %w", err)
+	}
+	return change, nil
+}
+
+func (p *PostgreRepository) Moderation(ctx context.Context, shortURL string) (domain.Moderation, []domain.ModerationEvent, error) {
+	if !p.ops.Enter() {
+		return domain.Moderation{}, nil, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	var owner string
+	err := p.Database.GetContext(ctx, &owner, linkOwnerQuery, shortURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Moderation{}, nil, domain.ErrURLNotFound
+	}
+	if err != nil {
+		return domain.Moderation{}, nil, fmt.Errorf("unable to find url: %w", err)
+	}
+	var current moderationRow
+	err = p.Database.GetContext(ctx, &current,
+		`SELECT short_url, status, reason, note, actor, moderated_at FROM url_moderation WHERE short_url = $1`, shortURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Moderation{Status: domain.ModerationClean}, []domain.ModerationEvent{}, nil
+	}
+	if err != nil {
+		return domain.Moderation{}, nil, fmt.Errorf("unable to read moderation: %w", err)
+	}
+	var rows []moderationRow
+	err = p.Database.SelectContext(ctx, &rows,
+		`SELECT short_url, from_status, status, reason, note, actor, moderated_at FROM url_moderation_events
+		 WHERE short_url = $1 ORDER BY id`, shortURL)
+	if err != nil {
+		return domain.Moderation{}, nil, fmt.Errorf("unable to read moderation log: %w", err)
+	}
+	events := make([]domain.ModerationEvent, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, domain.ModerationEvent{From: domain.ModerationStatus(row.FromStatus), Moderation: row.moderation()})
+	}
+	return current.moderation(), events, nil
+}
+
+func (p *PostgreRepository) ModeratedLinks(ctx context.Context, status domain.ModerationStatus) ([]domain.ModeratedLink, error) {
+	if !p.ops.Enter() {
+		return nil, ErrRepositoryClosed
+	}
+	defer p.ops.Leave()
+	var rows []moderationRow
+	err := p.Database.SelectContext(ctx, &rows, `
+SELECT m.short_url, l.user_id, m.status, m.reason, m.note, m.actor, m.moderated_at
+FROM url_moderation m
+JOIN (
+	SELECT short_url, user_id FROM urls WHERE reserved_until IS NULL
+	UNION ALL
+	SELECT short_url, user_id FROM urls_archive
+) l ON l.short_url = m.short_url
+WHERE m.status = $1 ORDER BY m.short_url`, status)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list moderated urls: %w", err)
+	}
+	links := make([]domain.ModeratedLink, 0, len(rows))
+	for _, row := range rows {
+		links = append(links, domain.ModeratedLink{ShortURL: row.ShortURL, UserID: row.UserID, Moderation: row.moderation()})
 	}
-	errs = append(errs, tx.Commit())
-	err := errors.Join(errs...)
-	return err
+	return links, nil
 }
@@ -1,35 +1,147 @@
 package adapters
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"maps"
 	"os"
+	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/encryption"
+	"github.com/OrtemRepos/shortlink/internal/ports"
 )
 
 const (
 	filePerm = 0662 // owner and group: read/write; others: read
+	dirPerm  = 0755
+
+	archiveSuffix = ".archive.gz"
+	// optOutSuffix names the file listing users opted out of link checks.
+	optOutSuffix = ".link_checks.json"
+	// moderationSuffix names the file of moderation decisions by short code.
+	moderationSuffix = ".moderation.json"
+	// visitsSuffix names the file of visit counts by short code.
+	visitsSuffix = ".visits.json"
+
+	// fileFormatVersion is written in the header of both save files.
+	// Files without a header are version 1 (records) or older (short code to URL strings).
+	fileFormatVersion = 2
 )
 
+var ErrUnsupportedFormat = errors.New("unsupported save file format")
+
+type record struct {
+	OriginalURL string    `json:"original_url"`
+	UserID      string    `json:"user_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	LastCheckedAt *time.Time `json:"last_checked_at,omitempty"`
+	LastStatus    string     `json:"last_status,omitempty"`
+
+	Privacy domain.Privacy `json:"privacy,omitempty"`
+
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// ReservedUntil is set while the record is a reservation, without an original URL.
+	ReservedUntil *time.Time `json:"reserved_until,omitempty"`
+}
+
+func (rec *record) reserved() bool {
+	return rec.ReservedUntil != nil
+}
+
+// expired reports whether rec is a reservation that no longer holds its code at now.
+func (rec *record) expired(now time.Time) bool {
+	return rec.reserved() && !now.Before(*rec.ReservedUntil)
+}
+
+type archivedRecord struct {
+	record
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
 type urls struct {
-	m  map[string]string
-	mu sync.RWMutex
+	m          map[string]*record
+	archive    map[string]*archivedRecord
+	optOut     map[string]bool
+	moderation map[string]*moderationRecord
+	visits     map[string]*visitRecord
+	mu         sync.RWMutex
+}
+
+// visitRecord counts the visits of a link. Like moderation, it is kept apart from
+// the link, and counts are written out with snapshots rather than on every visit.
+type visitRecord struct {
+	Visits        int64     `json:"visits"`
+	LastVisitedAt time.Time `json:"last_visited_at"`
+}
+
+// moderationRecord is the current moderation of a link and its audit log.
+// It is kept apart from the link, so archiving does not lose it.
+type moderationRecord struct {
+	Current domain.Moderation        `json:"current"`
+	Log     []domain.ModerationEvent `json:"log"`
 }
 
 type InMemoryURLRepository struct {
 	urls
-	savePath string
+	savePath    string
+	rehydrate   bool
+	keyring     *encryption.Keyring
+	legacyOwner string
+	// mirrored tells, under mu, whether Mirror changed links since the last snapshot.
+	mirrored bool
+	// visited tells, under mu, whether visits were counted since they were last written.
+	visited bool
+}
+
+type InMemoryOption func(*InMemoryURLRepository)
+
+// WithRehydrate moves archived links back to the hot store when they are found.
+func WithRehydrate(enabled bool) InMemoryOption {
+	return func(r *InMemoryURLRepository) {
+		r.rehydrate = enabled
+	}
+}
+
+// WithKeyring encrypts original URLs in the save files. Links are kept in plaintext in memory.
+func WithKeyring(keyring *encryption.Keyring) InMemoryOption {
+	return func(r *InMemoryURLRepository) {
+		r.keyring = keyring
+	}
+}
+
+// WithLegacyOwner sets the UserID given to links loaded without an owner; the default is domain.LegacyOwner.
+func WithLegacyOwner(owner string) InMemoryOption {
+	return func(r *InMemoryURLRepository) {
+		if owner != "" {
+			r.legacyOwner = owner
+		}
+	}
 }
 
-func NewInMemoryURLRepository(savePath string) (*InMemoryURLRepository, error) {
+func NewInMemoryURLRepository(savePath string, opts ...InMemoryOption) (*InMemoryURLRepository, error) {
 	repo := &InMemoryURLRepository{
 		urls: urls{
-			m: make(map[string]string),
+			m:          make(map[string]*record),
+			archive:    make(map[string]*archivedRecord),
+			optOut:     make(map[string]bool),
+			moderation: make(map[string]*moderationRecord),
+			visits:     make(map[string]*visitRecord),
 		},
-		savePath: savePath,
+		savePath:    savePath,
+		legacyOwner: domain.LegacyOwner,
+	}
+	for _, opt := range opts {
+		opt(repo)
 	}
 	err := repo.load()
 	if err != nil {
@@ -43,47 +155,889 @@ func (r *InMemoryURLRepository) Ping(ctx context.Context) error {
 }
 
 func (r *InMemoryURLRepository) Save(ctx context.Context, url *domain.URL) error {
+	if !r.realOwner(url.UUID) {
+		return domain.ErrOwnerRequired
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if shortURL, ok := r.longURLExists(url.OriginalURL); ok {
 		url.ShortURL = shortURL
 		return domain.ErrURLAlreadyExists
 	}
-	url.GenerateShortURL()
-	r.m[url.ShortURL] = url.OriginalURL
+	if err := r.insert(url); err != nil {
+		return err
+	}
 	return r.saveToFile()
 }
 func (r *InMemoryURLRepository) BatchSave(ctx context.Context, urls []*domain.URL) error {
+	for _, url := range urls {
+		if !r.realOwner(url.UUID) {
+			return domain.ErrOwnerRequired
+		}
+	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	for _, url := range urls {
 		if shortURL, ok := r.longURLExists(url.OriginalURL); ok {
 			url.ShortURL = shortURL
-		} else {
-			url.GenerateShortURL()
-			r.m[url.ShortURL] = url.OriginalURL
+		} else if err := r.insert(url); err != nil {
+			return err
 		}
 	}
 	return r.saveToFile()
 }
 
-func (r *InMemoryURLRepository) BatchDelete(ctx context.Context, ids map[string][]string) error {
+func (r *InMemoryURLRepository) insert(url *domain.URL) error {
+	if url.ShortURL == "" {
+		return domain.ErrShortURLRequired
+	} else if r.shortURLExists(url.ShortURL) {
+		return domain.ErrShortURLTaken
+	}
+	url.CreatedAt = time.Now()
+	r.m[url.ShortURL] = &record{OriginalURL: url.OriginalURL, UserID: url.UUID, CreatedAt: url.CreatedAt, Privacy: url.Privacy, ExpiresAt: url.ExpiresAt}
 	return nil
 }
 
-func (r *InMemoryURLRepository) Find(ctx context.Context, shortURL string) (*domain.URL, error) {
+// realOwner reports whether a new link may be saved for owner: legacy links are only ever loaded.
+func (r *InMemoryURLRepository) realOwner(owner string) bool {
+	return owner != r.legacyOwner
+}
+
+func (r *InMemoryURLRepository) Exists(ctx context.Context, shortURL string) (bool, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	longURL, ok := r.m[shortURL]
+	return r.shortURLExists(shortURL), nil
+}
+
+// shortURLExists reports whether shortURL is a link or an active reservation.
+func (r *InMemoryURLRepository) shortURLExists(shortURL string) bool {
+	rec, hot := r.m[shortURL]
+	_, archived := r.archive[shortURL]
+	return (hot && !rec.expired(time.Now())) || archived
+}
+
+func (r *InMemoryURLRepository) BatchDelete(ctx context.Context, ids map[string][]string) (int, error) {
+	return 0, nil
+}
+
+// Find looks up the hot store first and falls through to the archive on a miss.
+func (r *InMemoryURLRepository) Find(ctx context.Context, shortURL string) (*domain.URL, error) {
+	url, err := r.find(shortURL)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	if moderation, ok := r.moderation[shortURL]; ok {
+		url.Moderation = moderation.Current.Status
+	}
+	r.mu.RUnlock()
+	return url, nil
+}
+
+func (r *InMemoryURLRepository) find(shortURL string) (*domain.URL, error) {
+	r.mu.RLock()
+	if rec, ok := r.m[shortURL]; ok {
+		r.mu.RUnlock()
+		if rec.reserved() {
+			return nil, reservationError(rec)
+		}
+		return rec.toURL(shortURL), nil
+	}
+	arch, ok := r.archive[shortURL]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, domain.ErrURLNotFound
+	}
+	if !r.rehydrate {
+		url := arch.toURL(shortURL)
+		url.Archived = true
+		return url, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rec, ok := r.m[shortURL]; ok {
+		return rec.toURL(shortURL), nil
+	}
+	arch, ok = r.archive[shortURL]
 	if !ok {
 		return nil, domain.ErrURLNotFound
 	}
-	return &domain.URL{OriginalURL: longURL, ShortURL: shortURL}, nil
+	r.m[shortURL] = &arch.record
+	if err := r.saveToFile(); err != nil {
+		delete(r.m, shortURL)
+		url := arch.toURL(shortURL)
+		url.Archived = true
+		return url, nil
+	}
+	delete(r.archive, shortURL)
+	_ = r.saveArchive()
+	return arch.toURL(shortURL), nil
+}
+
+// Archive moves old links nobody visited lately to the compressed archive file.
+// The archive is written before the hot file, so a crash in between leaves
+// the link in both places (resolved by load) rather than in neither.
+func (r *InMemoryURLRepository) Archive(ctx context.Context, olderThan, idleSince time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	moved := make([]string, 0)
+	for short, rec := range r.m {
+		if visit, ok := r.visits[short]; ok && !visit.LastVisitedAt.Before(idleSince) {
+			continue
+		}
+		if !rec.reserved() && rec.CreatedAt.Before(olderThan) {
+			r.archive[short] = &archivedRecord{record: *rec, ArchivedAt: now}
+			moved = append(moved, short)
+		}
+	}
+	if len(moved) == 0 {
+		return 0, nil
+	}
+	if err := r.saveArchive(); err != nil {
+		for _, short := range moved {
+			delete(r.archive, short)
+		}
+		return 0, err
+	}
+	for _, short := range moved {
+		delete(r.m, short)
+	}
+	return len(moved), r.saveToFile()
+}
+
+// Unarchive moves links back to the hot store; the hot file is written first.
+func (r *InMemoryURLRepository) Unarchive(ctx context.Context, shortURLs []string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	restored := make([]string, 0, len(shortURLs))
+	for _, short := range shortURLs {
+		arch, ok := r.archive[short]
+		if !ok {
+			continue
+		}
+		if _, exists := r.m[short]; !exists {
+			r.m[short] = &arch.record
+		}
+		restored = append(restored, short)
+	}
+	if len(restored) == 0 {
+		return 0, nil
+	}
+	if err := r.saveToFile(); err != nil {
+		for _, short := range restored {
+			delete(r.m, short)
+		}
+		return 0, err
+	}
+	for _, short := range restored {
+		delete(r.archive, short)
+	}
+	return len(restored), r.saveArchive()
+}
+
+// ReassignOwner moves links of from to to under the write lock.
+// Original URLs are unique across users here, so two owners never conflict.
+func (r *InMemoryURLRepository) ReassignOwner(ctx context.Context, from, to string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hot, archived := make([]*record, 0), make([]*record, 0)
+	for _, rec := range r.m {
+		if rec.UserID == from {
+			hot = append(hot, rec)
+		}
+	}
+	for _, arch := range r.archive {
+		if arch.UserID == from {
+			archived = append(archived, &arch.record)
+		}
+	}
+	if len(hot)+len(archived) == 0 {
+		return 0, nil
+	}
+	setOwner := func(recs []*record, owner string) {
+		for _, rec := range recs {
+			rec.UserID = owner
+		}
+	}
+	setOwner(hot, to)
+	if err := r.saveToFile(); err != nil {
+		setOwner(hot, from)
+		return 0, err
+	}
+	setOwner(archived, to)
+	if err := r.saveArchive(); err != nil {
+		setOwner(archived, from)
+		return len(hot), err
+	}
+	return len(hot) + len(archived), nil
+}
+
+// LegacyLinks returns the links loaded without an owner and not claimed yet, sorted by short code.
+func (r *InMemoryURLRepository) LegacyLinks(ctx context.Context) ([]domain.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	links := make([]domain.URL, 0)
+	for short, rec := range r.m {
+		if rec.UserID == r.legacyOwner && !rec.reserved() {
+			links = append(links, *rec.toURL(short))
+		}
+	}
+	for short, arch := range r.archive {
+		if arch.UserID == r.legacyOwner {
+			url := arch.toURL(short)
+			url.Archived = true
+			links = append(links, *url)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].ShortURL < links[j].ShortURL })
+	return links, nil
+}
+
+// ClaimLegacy gives owner the listed links still owned by the legacy owner.
+// Files are written hot first, like ReassignOwner.
+func (r *InMemoryURLRepository) ClaimLegacy(ctx context.Context, owner string, shortURLs []string) (int, error) {
+	if owner == "" || !r.realOwner(owner) {
+		return 0, domain.ErrOwnerRequired
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hot, archived := make([]*record, 0), make([]*record, 0)
+	for _, short := range shortURLs {
+		if rec, ok := r.m[short]; ok && rec.UserID == r.legacyOwner {
+			hot = append(hot, rec)
+		} else if arch, ok := r.archive[short]; ok && arch.UserID == r.legacyOwner {
+			archived = append(archived, &arch.record)
+		}
+	}
+	if len(hot)+len(archived) == 0 {
+		return 0, nil
+	}
+	setOwner := func(recs []*record, owner string) {
+		for _, rec := range recs {
+			rec.UserID = owner
+		}
+	}
+	setOwner(hot, owner)
+	if err := r.saveToFile(); err != nil {
+		setOwner(hot, r.legacyOwner)
+		return 0, err
+	}
+	setOwner(archived, owner)
+	if err := r.saveArchive(); err != nil {
+		setOwner(archived, r.legacyOwner)
+		return len(hot), err
+	}
+	return len(hot) + len(archived), nil
+}
+
+// FindByUserAndHost scans the hot links of userID.
+func (r *InMemoryURLRepository) FindByUserAndHost(ctx context.Context, userID string, filter domain.URLFilter) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	shortURLs := make([]string, 0)
+	for short, rec := range r.m {
+		if rec.UserID == userID && !rec.reserved() && filter.Matches(rec.OriginalURL) {
+			shortURLs = append(shortURLs, short)
+		}
+	}
+	sort.Strings(shortURLs)
+	return shortURLs, nil
+}
+
+func (r *InMemoryURLRepository) ExportByUser(ctx context.Context, userID string) ([]domain.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	links := make([]domain.URL, 0)
+	for short, rec := range r.m {
+		if rec.UserID == userID && !rec.reserved() {
+			links = append(links, *rec.toURL(short))
+		}
+	}
+	for short, arch := range r.archive {
+		if arch.UserID == userID {
+			url := arch.toURL(short)
+			url.Archived = true
+			links = append(links, *url)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].ShortURL < links[j].ShortURL })
+	return links, nil
+}
+
+func (r *InMemoryURLRepository) CountByUser(ctx context.Context, userID string) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	count := 0
+	for _, rec := range r.m {
+		if rec.UserID == userID && !rec.reserved() {
+			count++
+		}
+	}
+	for _, arch := range r.archive {
+		if arch.UserID == userID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *InMemoryURLRepository) CountLinks(ctx context.Context) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.m) + len(r.archive), nil
+}
+
+func (r *InMemoryURLRepository) Stats(ctx context.Context) (domain.Stats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var stats domain.Stats
+	users := make(map[string]struct{})
+	for _, rec := range r.m {
+		if !rec.reserved() {
+			stats.URLs++
+			users[rec.UserID] = struct{}{}
+		}
+	}
+	for _, arch := range r.archive {
+		stats.URLs++
+		users[arch.UserID] = struct{}{}
+	}
+	stats.Users = len(users)
+	return stats, nil
+}
+
+// FindMany never rehydrates archived links, unlike Find.
+func (r *InMemoryURLRepository) FindMany(ctx context.Context, shortURLs []string) (map[string]domain.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	found := make(map[string]domain.URL, len(shortURLs))
+	for _, short := range shortURLs {
+		var url *domain.URL
+		if rec, ok := r.m[short]; ok {
+			if rec.reserved() {
+				continue
+			}
+			url = rec.toURL(short)
+		} else if arch, ok := r.archive[short]; ok {
+			url = arch.toURL(short)
+			url.Archived = true
+		} else {
+			continue
+		}
+		if moderation, ok := r.moderation[short]; ok {
+			url.Moderation = moderation.Current.Status
+		}
+		found[short] = *url
+	}
+	return found, nil
+}
+
+// FindByUser sorts every link of the user on each call; pages are cheap to skip here,
+// it is Postgres that needs After to avoid scanning the skipped links.
+func (r *InMemoryURLRepository) FindByUser(ctx context.Context, userID string, page domain.LinkPage) ([]domain.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	links := make([]domain.URL, 0)
+	add := func(url *domain.URL) {
+		if (page.After != nil && !page.After.Precedes(*url)) || !page.Matches(*url) {
+			return
+		}
+		if moderation, ok := r.moderation[url.ShortURL]; ok {
+			url.Moderation = moderation.Current.Status
+		}
+		links = append(links, *url)
+	}
+	for short, rec := range r.m {
+		if rec.UserID == userID && !rec.reserved() {
+			add(rec.toURL(short))
+		}
+	}
+	for short, arch := range r.archive {
+		if arch.UserID == userID {
+			url := arch.toURL(short)
+			url.Archived = true
+			// Archived links are not checked, as in Postgres where urls_archive has no check columns.
+			url.LastCheckedAt, url.LastStatus = nil, ""
+			add(url)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return domain.CursorOf(links[i], page.Sort).Precedes(links[j]) })
+	if page.After == nil {
+		links = links[min(page.Offset, len(links)):]
+	}
+	return links[:min(page.Limit, len(links))], nil
+}
+
+func (r *InMemoryURLRepository) CountByQuery(ctx context.Context, userID, query string) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	page := domain.LinkPage{Query: query}
+	count := 0
+	for short, rec := range r.m {
+		if rec.UserID == userID && !rec.reserved() && page.Matches(*rec.toURL(short)) {
+			count++
+		}
+	}
+	for short, arch := range r.archive {
+		if arch.UserID == userID && page.Matches(*arch.toURL(short)) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// LinksToCheck returns hot links never checked or checked before checkedBefore, least recently checked first.
+func (r *InMemoryURLRepository) LinksToCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]domain.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	links := make([]domain.URL, 0)
+	for short, rec := range r.m {
+		if rec.reserved() || r.optOut[rec.UserID] || (rec.LastCheckedAt != nil && !rec.LastCheckedAt.Before(checkedBefore)) {
+			continue
+		}
+		links = append(links, *rec.toURL(short))
+	}
+	sort.Slice(links, func(i, j int) bool {
+		a, b := links[i].LastCheckedAt, links[j].LastCheckedAt
+		switch {
+		case a == nil || b == nil:
+			return a == nil && b != nil
+		case !a.Equal(*b):
+			return a.Before(*b)
+		default:
+			return links[i].ShortURL < links[j].ShortURL
+		}
+	})
+	if len(links) > limit {
+		links = links[:limit]
+	}
+	return links, nil
+}
+
+// RecordChecks stores the outcome of checks of hot links; checks of links no longer hot are dropped.
+func (r *InMemoryURLRepository) RecordChecks(ctx context.Context, checks []domain.LinkCheck) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous := make(map[string]record, len(checks))
+	for _, check := range checks {
+		rec, ok := r.m[check.ShortURL]
+		if !ok {
+			continue
+		}
+		if _, seen := previous[check.ShortURL]; !seen {
+			previous[check.ShortURL] = *rec
+		}
+		checkedAt := check.CheckedAt
+		rec.LastCheckedAt, rec.LastStatus = &checkedAt, check.Status
+	}
+	if len(previous) == 0 {
+		return nil
+	}
+	if err := r.saveToFile(); err != nil {
+		for short, rec := range previous {
+			r.m[short].LastCheckedAt, r.m[short].LastStatus = rec.LastCheckedAt, rec.LastStatus
+		}
+		return err
+	}
+	return nil
+}
+
+// SetLinkChecks records the choice of userID in the opt-out file.
+func (r *InMemoryURLRepository) SetLinkChecks(ctx context.Context, userID string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.optOut[userID] == !enabled {
+		return nil
+	}
+	if enabled {
+		delete(r.optOut, userID)
+	} else {
+		r.optOut[userID] = true
+	}
+	if err := r.saveOptOut(); err != nil {
+		if enabled {
+			r.optOut[userID] = true
+		} else {
+			delete(r.optOut, userID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *InMemoryURLRepository) SetPrivacy(ctx context.Context, userID, shortURL string, privacy domain.Privacy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, save := r.m[shortURL], r.saveToFile
+	if rec == nil {
+		if arch, ok := r.archive[shortURL]; ok {
+			rec, save = &arch.record, r.saveArchive
+		}
+	}
+	if rec == nil || rec.reserved() || rec.UserID != userID {
+		return domain.ErrURLNotFound
+	}
+	previous := rec.Privacy
+	rec.Privacy = privacy
+	if err := save(); err != nil {
+		rec.Privacy = previous
+		return err
+	}
+	return nil
+}
+
+// reservationError is the error Find returns for the reservation rec.
+func reservationError(rec *record) error {
+	if rec.expired(time.Now()) {
+		return domain.ErrURLNotFound
+	}
+	return domain.ErrCodeReserved
+}
+
+// Reserve stores the reservation as a hot record without an original URL.
+// An expired reservation of code not purged yet is replaced.
+func (r *InMemoryURLRepository) Reserve(ctx context.Context, userID, code string, ttl time.Duration) error {
+	if userID == "" || !r.realOwner(userID) {
+		return domain.ErrOwnerRequired
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.shortURLExists(code) {
+		return domain.ErrShortURLTaken
+	}
+	previous, hadPrevious := r.m[code]
+	now := time.Now()
+	until := now.Add(ttl)
+	r.m[code] = &record{UserID: userID, CreatedAt: now, ReservedUntil: &until}
+	if err := r.saveToFile(); err != nil {
+		if hadPrevious {
+			r.m[code] = previous
+		} else {
+			delete(r.m, code)
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *InMemoryURLRepository) CompleteReservation(ctx context.Context, userID, code, originalURL string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.m[code]
+	if !ok || !rec.reserved() || rec.expired(time.Now()) {
+		return domain.ErrReservationNotFound
+	}
+	if rec.UserID != userID {
+		return domain.ErrNotReservationOwner
+	}
+	if _, exists := r.longURLExists(originalURL); exists {
+		return domain.ErrURLAlreadyExists
+	}
+	previous := *rec
+	rec.OriginalURL, rec.CreatedAt, rec.ReservedUntil = originalURL, time.Now(), nil
+	if err := r.saveToFile(); err != nil {
+		*rec = previous
+		return err
+	}
+	return nil
+}
+
+func (r *InMemoryURLRepository) Reservations(ctx context.Context, userID string) ([]domain.Reservation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	now := time.Now()
+	reservations := make([]domain.Reservation, 0)
+	for short, rec := range r.m {
+		if rec.UserID == userID && rec.reserved() && !rec.expired(now) {
+			reservations = append(reservations, domain.Reservation{ShortURL: short, UserID: userID, ExpiresAt: *rec.ReservedUntil})
+		}
+	}
+	sort.Slice(reservations, func(i, j int) bool { return reservations[i].ShortURL < reservations[j].ShortURL })
+	return reservations, nil
+}
+
+func (r *InMemoryURLRepository) PurgeExpiredReservations(ctx context.Context, now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	purged := make(map[string]*record)
+	for short, rec := range r.m {
+		if rec.expired(now) {
+			purged[short] = rec
+		}
+	}
+	if len(purged) == 0 {
+		return 0, nil
+	}
+	for short := range purged {
+		delete(r.m, short)
+	}
+	if err := r.saveToFile(); err != nil {
+		for short, rec := range purged {
+			r.m[short] = rec
+		}
+		return 0, err
+	}
+	return len(purged), nil
+}
+
+// PurgeExpiredLinks removes the expired links, hot and archived: the file keeps no
+// deleted links, so their codes are free again once purged.
+func (r *InMemoryURLRepository) PurgeExpiredLinks(ctx context.Context, now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hot := make(map[string]*record)
+	for short, rec := range r.m {
+		if rec.toURL(short).Expired(now) {
+			hot[short] = rec
+		}
+	}
+	archived := make(map[string]*archivedRecord)
+	for short, arch := range r.archive {
+		if arch.toURL(short).Expired(now) {
+			archived[short] = arch
+		}
+	}
+	if len(hot) == 0 && len(archived) == 0 {
+		return 0, nil
+	}
+	for short := range hot {
+		delete(r.m, short)
+	}
+	for short := range archived {
+		delete(r.archive, short)
+	}
+	if err := r.saveToFile(); err != nil {
+		maps.Copy(r.m, hot)
+		maps.Copy(r.archive, archived)
+		return 0, err
+	}
+	if len(archived) > 0 {
+		if err := r.saveArchive(); err != nil {
+			maps.Copy(r.archive, archived)
+			return len(hot), err
+		}
+	}
+	return len(hot) + len(archived), nil
+}
+
+func (r *InMemoryURLRepository) IncrementVisit(ctx context.Context, shortURL string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.ownerOf(shortURL); !ok {
+		return domain.ErrURLNotFound
+	}
+	visit, ok := r.visits[shortURL]
+	if !ok {
+		visit = &visitRecord{}
+		r.visits[shortURL] = visit
+	}
+	visit.Visits++
+	visit.LastVisitedAt = time.Now()
+	r.visited = true
+	return nil
+}
+
+func (r *InMemoryURLRepository) LinkStats(ctx context.Context, userID, shortURL string) (domain.LinkStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if owner, ok := r.ownerOf(shortURL); !ok || owner != userID {
+		return domain.LinkStats{}, domain.ErrURLNotFound
+	}
+	stats := domain.LinkStats{ShortURL: shortURL}
+	if visit, ok := r.visits[shortURL]; ok {
+		lastVisitedAt := visit.LastVisitedAt
+		stats.Visits, stats.LastVisitedAt = visit.Visits, &lastVisitedAt
+	}
+	return stats, nil
+}
+
+func (r *InMemoryURLRepository) saveVisits() error {
+	if err := os.MkdirAll(filepath.Dir(r.savePath), dirPerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.savePath+visitsSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePerm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := json.NewEncoder(file).Encode(r.visits); err != nil {
+		return err
+	}
+	r.visited = false
+	return nil
+}
+
+func (r *InMemoryURLRepository) loadVisits() (map[string]*visitRecord, error) {
+	visits := make(map[string]*visitRecord)
+	file, err := os.Open(r.savePath + visitsSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return visits, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+	if err := json.NewDecoder(file).Decode(&visits); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return visits, nil
+}
+
+// ownerOf returns the owner of the link shortURL, hot or archived, reservations excluded.
+func (r *InMemoryURLRepository) ownerOf(shortURL string) (string, bool) {
+	if rec, ok := r.m[shortURL]; ok {
+		return rec.UserID, !rec.reserved()
+	}
+	if arch, ok := r.archive[shortURL]; ok {
+		return arch.UserID, true
+	}
+	return "", false
+}
+
+func (r *InMemoryURLRepository) Moderate(ctx context.Context, shortURL string, change domain.Moderation) (domain.Moderation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.ownerOf(shortURL); !ok {
+		return domain.Moderation{}, domain.ErrURLNotFound
+	}
+	stored, moderated := r.moderation[shortURL]
+	current := domain.ModerationClean
+	if moderated {
+		current = stored.Current.Status
+	}
+	if err := domain.CheckModeration(current, change); err != nil {
+		return domain.Moderation{}, err
+	}
+	change.At = time.Now().UTC()
+	updated := &moderationRecord{Current: change}
+	if moderated {
+		updated.Log = append(updated.Log, stored.Log...)
+	}
+	updated.Log = append(updated.Log, domain.ModerationEvent{From: current, Moderation: change})
+	r.moderation[shortURL] = updated
+	if err := r.saveModeration(); err != nil {
+		if moderated {
+			r.moderation[shortURL] = stored
+		} else {
+			delete(r.moderation, shortURL)
+		}
+		return domain.Moderation{}, err
+	}
+	return change, nil
+}
+
+func (r *InMemoryURLRepository) Moderation(ctx context.Context, shortURL string) (domain.Moderation, []domain.ModerationEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if _, ok := r.ownerOf(shortURL); !ok {
+		return domain.Moderation{}, nil, domain.ErrURLNotFound
+	}
+	stored, ok := r.moderation[shortURL]
+	if !ok {
+		return domain.Moderation{Status: domain.ModerationClean}, []domain.ModerationEvent{}, nil
+	}
+	return stored.Current, append([]domain.ModerationEvent(nil), stored.Log...), nil
+}
+
+func (r *InMemoryURLRepository) ModeratedLinks(ctx context.Context, status domain.ModerationStatus) ([]domain.ModeratedLink, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	links := make([]domain.ModeratedLink, 0)
+	for short, stored := range r.moderation {
+		owner, ok := r.ownerOf(short)
+		if !ok || stored.Current.Status != status {
+			continue
+		}
+		links = append(links, domain.ModeratedLink{ShortURL: short, UserID: owner, Moderation: stored.Current})
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].ShortURL < links[j].ShortURL })
+	return links, nil
+}
+
+type moderationFile struct {
+	Links map[string]*moderationRecord `json:"links"`
+}
+
+func (r *InMemoryURLRepository) saveModeration() error {
+	if err := os.MkdirAll(filepath.Dir(r.savePath), dirPerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.savePath+moderationSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePerm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(moderationFile{Links: r.moderation})
+}
+
+func (r *InMemoryURLRepository) loadModeration() (map[string]*moderationRecord, error) {
+	moderation := make(map[string]*moderationRecord)
+	file, err := os.Open(r.savePath + moderationSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return moderation, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+	var stored moderationFile
+	if err := json.NewDecoder(file).Decode(&stored); err != nil && err != io.EOF {
+		return nil, err
+	}
+	for short, rec := range stored.Links {
+		moderation[short] = rec
+	}
+	return moderation, nil
+}
+
+type optOutFile struct {
+	Users []string `json:"users"`
+}
+
+func (r *InMemoryURLRepository) saveOptOut() error {
+	if err := os.MkdirAll(filepath.Dir(r.savePath), dirPerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.savePath+optOutSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePerm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	users := make([]string, 0, len(r.optOut))
+	for user := range r.optOut {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return json.NewEncoder(file).Encode(optOutFile{Users: users})
 }
 
+func (r *InMemoryURLRepository) loadOptOut() (map[string]bool, error) {
+	optOut := make(map[string]bool)
+	file, err := os.Open(r.savePath + optOutSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return optOut, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+	var stored optOutFile
+	if err := json.NewDecoder(file).Decode(&stored); err != nil && err != io.EOF {
+		return nil, err
+	}
+	for _, user := range stored.Users {
+		optOut[user] = true
+	}
+	return optOut, nil
+}
+
+// longURLExists skips expired links not purged yet, so the URL can be shortened anew.
 func (r *InMemoryURLRepository) longURLExists(longURL string) (string, bool) {
-	for short, l := range r.m {
-		if l == longURL {
+	now := time.Now()
+	for short, rec := range r.m {
+		if !rec.reserved() && rec.OriginalURL == longURL && !rec.toURL(short).Expired(now) {
 			return short, true
 		}
 	}
@@ -93,23 +1047,160 @@ func (r *InMemoryURLRepository) longURLExists(longURL string) (string, bool) {
 func (r *InMemoryURLRepository) GetAll() map[string]string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	return r.m
+	all := make(map[string]string, len(r.m))
+	for short, rec := range r.m {
+		if !rec.reserved() {
+			all[short] = rec.OriginalURL
+		}
+	}
+	return all
+}
+
+func (rec *record) toURL(shortURL string) *domain.URL {
+	return &domain.URL{
+		OriginalURL:   rec.OriginalURL,
+		ShortURL:      shortURL,
+		UUID:          rec.UserID,
+		CreatedAt:     rec.CreatedAt,
+		LastCheckedAt: rec.LastCheckedAt,
+		LastStatus:    rec.LastStatus,
+		Privacy:       rec.Privacy,
+		ExpiresAt:     rec.ExpiresAt,
+	}
+}
+
+// Mirror keeps a copy of url in memory only, CreatedAt included, so that the
+// repository can serve as a secondary; SaveSnapshot writes the copies out.
+func (r *InMemoryURLRepository) Mirror(ctx context.Context, url domain.URL) error {
+	if url.ShortURL == "" {
+		return domain.ErrShortURLRequired
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.archive, url.ShortURL)
+	r.mirrored = true
+	if url.DeletedFlag || url.Moderation == domain.ModerationBlocked {
+		delete(r.m, url.ShortURL)
+		return nil
+	}
+	r.m[url.ShortURL] = &record{
+		OriginalURL:   url.OriginalURL,
+		UserID:        url.UUID,
+		CreatedAt:     url.CreatedAt,
+		LastCheckedAt: url.LastCheckedAt,
+		LastStatus:    url.LastStatus,
+		Privacy:       url.Privacy,
+		ExpiresAt:     url.ExpiresAt,
+	}
+	return nil
+}
+
+// SaveSnapshot writes the links held in memory, and the visits counted, to the save files.
+func (r *InMemoryURLRepository) SaveSnapshot(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.saveSnapshot()
+}
+
+func (r *InMemoryURLRepository) saveSnapshot() error {
+	if err := r.saveToFile(); err != nil {
+		return err
+	}
+	r.mirrored = false
+	if err := r.saveArchive(); err != nil {
+		return err
+	}
+	if !r.visited {
+		return nil
+	}
+	return r.saveVisits()
 }
 
 func (r *InMemoryURLRepository) saveToFile() error {
-	file, err := os.OpenFile(r.savePath, os.O_WRONLY|os.O_TRUNC, filePerm)
+	if err := os.MkdirAll(filepath.Dir(r.savePath), dirPerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.savePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePerm)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(r.m); err != nil {
+	stored := r.m
+	if r.keyring != nil {
+		stored = make(map[string]*record, len(r.m))
+		for short, rec := range r.m {
+			enc, err := r.sealRecord(*rec)
+			if err != nil {
+				return err
+			}
+			stored[short] = &enc
+		}
+	}
+	return encodeStore(file, fileFormatVersion, stored)
+}
+
+func (r *InMemoryURLRepository) sealRecord(rec record) (record, error) {
+	if r.keyring == nil {
+		return rec, nil
+	}
+	enc, err := r.keyring.Encrypt(rec.OriginalURL)
+	if err != nil {
+		return rec, err
+	}
+	rec.OriginalURL = enc
+	return rec, nil
+}
+
+func (r *InMemoryURLRepository) openRecord(rec *record) error {
+	if r.keyring == nil {
+		return nil
+	}
+	plain, err := r.keyring.Decrypt(rec.OriginalURL)
+	if err != nil {
 		return err
 	}
+	rec.OriginalURL = plain
 	return nil
 }
 
+// Reencrypt rewrites both save files with the primary key.
+// Files are rewritten whole, so batchSize is ignored.
+func (r *InMemoryURLRepository) Reencrypt(ctx context.Context, batchSize int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.keyring == nil {
+		return 0, nil
+	}
+	if err := r.saveToFile(); err != nil {
+		return 0, err
+	}
+	return len(r.m) + len(r.archive), r.saveArchive()
+}
+
+func (r *InMemoryURLRepository) saveArchive() error {
+	file, err := os.OpenFile(r.savePath+archiveSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePerm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stored := r.archive
+	if r.keyring != nil {
+		stored = make(map[string]*archivedRecord, len(r.archive))
+		for short, arch := range r.archive {
+			enc, err := r.sealRecord(arch.record)
+			if err != nil {
+				return err
+			}
+			stored[short] = &archivedRecord{record: enc, ArchivedAt: arch.ArchivedAt}
+		}
+	}
+	gw := gzip.NewWriter(file)
+	if err := json.NewEncoder(gw).Encode(fileHeader[*archivedRecord]{Version: fileFormatVersion, URLs: stored}); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
 func (r *InMemoryURLRepository) load() error {
 	file, err := os.Open(r.savePath)
 	if err != nil {
@@ -119,17 +1210,99 @@ func (r *InMemoryURLRepository) load() error {
 		return err
 	}
 	defer file.Close()
-	decoder := json.NewDecoder(file)
-	var urls map[string]string
-	if err := decoder.Decode(&urls); err != nil && err != io.EOF {
+	decoded, err := decodeStore(file, r.legacyOwner, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := decoded.firstInvalid(); err != nil {
+		return err
+	}
+	loaded := decoded.records
+	for short, rec := range loaded {
+		if err := r.openRecord(rec); err != nil {
+			return fmt.Errorf("decrypt %s: %w", short, err)
+		}
+	}
+	archive, err := r.loadArchive()
+	if err != nil {
+		return err
+	}
+	for short := range loaded {
+		delete(archive, short)
+	}
+	optOut, err := r.loadOptOut()
+	if err != nil {
+		return err
+	}
+	moderation, err := r.loadModeration()
+	if err != nil {
+		return err
+	}
+	visits, err := r.loadVisits()
+	if err != nil {
 		return err
 	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.m = urls
+	r.m = loaded
+	r.archive = archive
+	r.optOut = optOut
+	r.moderation = moderation
+	r.visits = visits
 	return nil
 }
 
-func (r *InMemoryURLRepository) Close() error {
-	return nil
+func (r *InMemoryURLRepository) loadArchive() (map[string]*archivedRecord, error) {
+	archive := make(map[string]*archivedRecord)
+	file, err := os.Open(r.savePath + archiveSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return archive, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return archive, nil
+		}
+		return nil, err
+	}
+	defer gr.Close()
+	raw, version, err := decodeFile(gr)
+	if err != nil {
+		return nil, err
+	}
+	for short, value := range raw {
+		arch := &archivedRecord{}
+		if err := json.Unmarshal(value, arch); err != nil {
+			return nil, err
+		}
+		if err := r.openRecord(&arch.record); err != nil {
+			return nil, fmt.Errorf("decrypt archived %s: %w", short, err)
+		}
+		if version < 2 && arch.UserID == "" {
+			arch.UserID = r.legacyOwner
+		}
+		archive[short] = arch
+	}
+	return archive, nil
+}
+
+// Close waits for the writes in progress, which save themselves, then writes out
+// the copies Mirror kept and the visits counted since the last snapshot. It returns ctx.Err() if that does
+// not end within ctx, the flush then going on in the background.
+func (r *InMemoryURLRepository) Close(ctx context.Context) error {
+	return ports.CloseWithin(ctx, func() error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.mirrored {
+			return r.saveSnapshot()
+		}
+		if r.visited {
+			return r.saveVisits()
+		}
+		return nil
+	})
 }
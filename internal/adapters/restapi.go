@@ -1,24 +1,62 @@
 package adapters
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"maps"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 
 	"github.com/OrtemRepos/shortlink/configs"
 	"github.com/OrtemRepos/shortlink/internal/auth"
-	"github.com/OrtemRepos/shortlink/internal/common"
+	"github.com/OrtemRepos/shortlink/internal/backpressure"
+	"github.com/OrtemRepos/shortlink/internal/bodylimit"
+	"github.com/OrtemRepos/shortlink/internal/bundle"
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/cors"
+	"github.com/OrtemRepos/shortlink/internal/debug"
 	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/encryption"
+	"github.com/OrtemRepos/shortlink/internal/errstore"
+	"github.com/OrtemRepos/shortlink/internal/events"
+	"github.com/OrtemRepos/shortlink/internal/health"
+	"github.com/OrtemRepos/shortlink/internal/httpmetrics"
+	"github.com/OrtemRepos/shortlink/internal/inflight"
+	"github.com/OrtemRepos/shortlink/internal/linkcheck"
 	"github.com/OrtemRepos/shortlink/internal/logger"
+	"github.com/OrtemRepos/shortlink/internal/outbound"
+	"github.com/OrtemRepos/shortlink/internal/pages"
+	"github.com/OrtemRepos/shortlink/internal/pagination"
 	"github.com/OrtemRepos/shortlink/internal/ports"
+	"github.com/OrtemRepos/shortlink/internal/quota"
+	"github.com/OrtemRepos/shortlink/internal/ratelimit"
+	"github.com/OrtemRepos/shortlink/internal/readonly"
+	"github.com/OrtemRepos/shortlink/internal/requestid"
+	"github.com/OrtemRepos/shortlink/internal/scheduler"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+	"github.com/OrtemRepos/shortlink/internal/subnet"
 	"github.com/OrtemRepos/shortlink/internal/task"
+	"github.com/OrtemRepos/shortlink/internal/taskgroup"
+	"github.com/OrtemRepos/shortlink/internal/webhook"
 	"github.com/OrtemRepos/shortlink/internal/worker"
 
 	"github.com/gin-gonic/gin"
@@ -27,255 +65,2178 @@ import (
 type RestAPI struct {
 	cfg           *configs.Config
 	workerPool    worker.WorkerPool
+	jobPool       worker.WorkerPool
+	persistPool   worker.WorkerPool
+	cachePool     worker.WorkerPool
+	visitPool     worker.WorkerPool
+	visitsDropped atomic.Int64
+	pools         *worker.Registry
+	scheduler     *scheduler.Scheduler
+	health        *health.Registry
+	inflight      *inflight.Tracker
+	tasks         *taskgroup.Group
+	events        *events.Bus
+	keyring       *encryption.Keyring
+	backpressure  *backpressure.Monitor
+	outbound      *outbound.Governor
+	prometheus    *prometheus.Registry
+	httpMetrics   *httpmetrics.Metrics
+	legacy        ports.URLLegacyPort
+	linkHealth    ports.URLHealthPort
+	pages         *pages.Renderer
+	export        ports.URLExportPort
+	failover      *FailoverRepository
+	lookups       *MetricsRepository
+	findMany      ports.URLFindManyPort
+	expandLimiter *ratelimit.Limiter
+	rateLimiter   *ratelimit.Limiter
+	ipLimiter     *ratelimit.Limiter
+	webhooks      *webhook.Store
+	webhookSender *webhook.Sender
+	cursors       *pagination.Codec
+	counter       ports.URLCountPort
+	quota         *quota.Tracker
+	reservations  ports.URLReservationPort
+	moderation    ports.URLModerationPort
+	privacy       ports.URLPrivacyPort
+	linkStats     ports.URLStatsPort
+	clock         clock.Clock
 	tokenProvider ports.PortJWT
 	repo          ports.URLRepositoryPort
-	deleteChan    chan map[string][]string
+	shortener     *shortener.Service
+	generator     shortener.CodeGenerator
+	deleteChan    chan task.DeleteRequest
+	deleteTask    *task.BatcherDeleteTask
+	stopFlush     worker.CancelFunc
 	log           *zap.Logger
 	*gin.Engine
 }
 
+type RestAPIOption func(*RestAPI)
+
+// WithBackpressure sheds shortens while monitor reports the repository degraded.
+// The monitor must be fed by the repository, see NewMetricsRepository.
+func WithBackpressure(monitor *backpressure.Monitor) RestAPIOption {
+	return func(r *RestAPI) {
+		r.backpressure = monitor
+	}
+}
+
+// WithOutbound exposes the counters of the outbound request governor on the stats endpoint.
+func WithOutbound(governor *outbound.Governor) RestAPIOption {
+	return func(r *RestAPI) {
+		r.outbound = governor
+	}
+}
+
+// WithWebhooks enables the webhook endpoints, keeping webhooks in store and sending with sender.
+func WithWebhooks(store *webhook.Store, sender *webhook.Sender) RestAPIOption {
+	return func(r *RestAPI) {
+		r.webhooks, r.webhookSender = store, sender
+	}
+}
+
+// WithPrometheus serves /metrics from registry; pools passed with WithPools must be
+// built with worker.WithPrometheus.
+func WithPrometheus(registry *prometheus.Registry) RestAPIOption {
+	return func(r *RestAPI) {
+		r.prometheus = registry
+	}
+}
+
+// WithPools takes the worker pools from pools instead of building them from the config.
+func WithPools(pools *worker.Registry) RestAPIOption {
+	return func(r *RestAPI) {
+		r.pools = pools
+	}
+}
+
+// WithTaskGroup runs the background goroutines of the API and its pools in tasks;
+// pools passed with WithPools must be built with worker.WithTaskGroup.
+func WithTaskGroup(tasks *taskgroup.Group) RestAPIOption {
+	return func(r *RestAPI) {
+		r.tasks = tasks
+	}
+}
+
+// WithLegacyLinks enables the admin endpoints that list and hand out links loaded without an owner.
+func WithLegacyLinks(legacy ports.URLLegacyPort) RestAPIOption {
+	return func(r *RestAPI) {
+		r.legacy = legacy
+	}
+}
+
+// WithLinkHealth enables the endpoint users opt out of link checks with.
+func WithLinkHealth(linkHealth ports.URLHealthPort) RestAPIOption {
+	return func(r *RestAPI) {
+		r.linkHealth = linkHealth
+	}
+}
+
+// WithFindMany enables POST /api/expand_batch, resolving codes with findMany; the
+// default is the repository given to NewRestAPI, when it implements ports.URLFindManyPort.
+func WithFindMany(findMany ports.URLFindManyPort) RestAPIOption {
+	return func(r *RestAPI) {
+		r.findMany = findMany
+	}
+}
+
+// WithLinkCounter counts the links of users with counter to enforce Quota.MaxLinks; the
+// default is the repository given to NewRestAPI, when it implements ports.URLCountPort.
+func WithLinkCounter(counter ports.URLCountPort) RestAPIOption {
+	return func(r *RestAPI) {
+		r.counter = counter
+	}
+}
+
+// WithLinkPrivacy enables PATCH /api/user/urls/:code; the default is the repository
+// given to NewRestAPI, when it implements ports.URLPrivacyPort.
+func WithLinkPrivacy(privacy ports.URLPrivacyPort) RestAPIOption {
+	return func(r *RestAPI) {
+		r.privacy = privacy
+	}
+}
+
+// WithLinkStats enables GET /api/user/urls/:code/stats; the default is the repository
+// given to NewRestAPI, when it implements ports.URLStatsPort.
+func WithLinkStats(stats ports.URLStatsPort) RestAPIOption {
+	return func(r *RestAPI) {
+		r.linkStats = stats
+	}
+}
+
+// WithFailover reports the counters of failover with the stats; NewRestAPI is given
+// the repository decorating it, so it cannot be found there.
+func WithFailover(failover *FailoverRepository) RestAPIOption {
+	return func(r *RestAPI) {
+		r.failover = failover
+	}
+}
+
+// WithLookupMetrics reports the lookups counted by metrics with the stats; the
+// default is the repository given to NewRestAPI, when it is a MetricsRepository.
+func WithLookupMetrics(metrics *MetricsRepository) RestAPIOption {
+	return func(r *RestAPI) {
+		r.lookups = metrics
+	}
+}
+
+// WithExport enables exporting the links of a user as a signed bundle.
+func WithExport(export ports.URLExportPort) RestAPIOption {
+	return func(r *RestAPI) {
+		r.export = export
+	}
+}
+
+// WithReservations enables the endpoints reserving a short URL before its destination is known.
+func WithReservations(reservations ports.URLReservationPort) RestAPIOption {
+	return func(r *RestAPI) {
+		r.reservations = reservations
+	}
+}
+
+// WithModeration enables the internal moderation endpoints and the blocking of links by it.
+func WithModeration(moderation ports.URLModerationPort) RestAPIOption {
+	return func(r *RestAPI) {
+		r.moderation = moderation
+	}
+}
+
+// WithCodeGenerator sets the generator of short codes; the default is shortener.RandomGenerator.
+func WithCodeGenerator(generator shortener.CodeGenerator) RestAPIOption {
+	return func(r *RestAPI) {
+		r.generator = generator
+	}
+}
+
+// WithClock sets the clock for token expiry and delete batching; the default is the real clock.
+func WithClock(c clock.Clock) RestAPIOption {
+	return func(r *RestAPI) {
+		r.clock = clock.OrReal(c)
+	}
+}
+
+// WithLogger sets the logger of handler errors and delete batching; the default is the application logger.
+func WithLogger(log *zap.Logger) RestAPIOption {
+	return func(r *RestAPI) {
+		r.log = log
+	}
+}
+
+// NewRestAPI panics if a worker pool it needs is not configured.
 func NewRestAPI(repo ports.URLRepositoryPort,
-	engine *gin.Engine, cfg *configs.Config,
+	engine *gin.Engine, cfg *configs.Config, opts ...RestAPIOption,
 ) *RestAPI {
 	log := logger.GetLogger()
-	tokenProvider := NewProviderJWT(cfg)
-	workerPool := worker.NewWorkerPool(
-		"deleteWorker",
-		cfg.Worker.WorkersCount,
-		cfg.Worker.BufferSize,
-		cfg.Worker.ErrMaximumAmount,
-		worker.NewPoolMetrics(),
-		worker.NewWorkerMetrics,
-	)
-	deleteChan := make(chan map[string][]string, cfg.Worker.BufferSize)
-	return &RestAPI{
-		repo:          repo,
-		tokenProvider: tokenProvider,
-		workerPool:    workerPool,
-		Engine:        engine,
-		log:           log,
-		cfg:           cfg,
-		deleteChan:    deleteChan,
+	keyring, err := encryption.FromConfig(cfg)
+	if err != nil {
+		log.Panic("RestAPI: invalid encryption config", zap.Error(err))
+	}
+	bus := events.NewBus()
+	bus.Subscribe(events.AuditLog(log))
+	deleteChan := make(chan task.DeleteRequest, cfg.Worker.BufferSize)
+	api := &RestAPI{
+		repo:       repo,
+		clock:      clock.Real{},
+		events:     bus,
+		inflight:   inflight.NewTracker(),
+		keyring:    keyring,
+		Engine:     engine,
+		log:        log,
+		cfg:        cfg,
+		deleteChan: deleteChan,
+		pages:      pages.NewRenderer(cfg.Pages.TemplateDir),
+	}
+	api.findMany, _ = repo.(ports.URLFindManyPort)
+	api.counter, _ = repo.(ports.URLCountPort)
+	api.privacy, _ = repo.(ports.URLPrivacyPort)
+	api.linkStats, _ = repo.(ports.URLStatsPort)
+	api.lookups, _ = repo.(*MetricsRepository)
+	for _, opt := range opts {
+		opt(api)
+	}
+	if api.tasks == nil {
+		api.tasks = taskgroup.New()
+	}
+	if api.prometheus == nil {
+		api.prometheus = prometheus.NewRegistry()
+	}
+	if api.tokenProvider, err = NewProviderJWT(cfg, WithTokenClock(api.clock)); err != nil {
+		log.Panic("RestAPI: invalid auth config", zap.Error(err))
+	}
+	api.expandLimiter = ratelimit.New(cfg.Expand.BatchRate, cfg.Expand.BatchBurst, api.clock)
+	if cfg.RateLimit.Rate > 0 {
+		api.rateLimiter = ratelimit.New(cfg.RateLimit.Rate, cfg.RateLimit.Burst, api.clock)
+	}
+	if cfg.RateLimit.IPRate > 0 {
+		api.ipLimiter = ratelimit.New(cfg.RateLimit.IPRate, cfg.RateLimit.IPBurst, api.clock)
+	}
+	api.cursors = pagination.NewCodec([]byte(cfg.Auth.SecretKey), cfg.Pagination.CursorTTL, api.clock)
+	api.shortener = shortener.NewService(repo, shortener.WithGenerator(api.generator))
+	batcherOpts := []task.BatcherOption{
+		task.WithBatcherClock(api.clock),
+		task.WithBatcherLogger(api.log),
+		task.WithBatcherTaskGroup(api.tasks),
+		task.WithFlushTimeouts(cfg.Delete.FlushTimeout, cfg.Delete.FinalFlushTimeout),
+	}
+	if cfg.Quota.MaxLinks > 0 && api.counter != nil {
+		api.quota = quota.New(api.counter, cfg.Quota.MaxLinks, cfg.Quota.WarnPercent, cfg.Quota.CacheTTL, api.clock)
+		batcherOpts = append(batcherOpts, task.WithOnFlushed(func(userIDs []string) {
+			api.quota.Invalidate(userIDs...)
+		}))
+	}
+	api.deleteTask = task.NewBatcherDeleteTask(deleteChan, repo, cfg.Worker.BufferSize, deleteFlushInterval, batcherOpts...)
+	if api.pools == nil {
+		poolOpts := []worker.PoolOption{worker.WithTaskGroup(api.tasks), worker.WithPrometheus(api.prometheus)}
+		if api.pools, err = worker.NewRegistryFromConfig(cfg, poolOpts...); err != nil {
+			log.Panic("RestAPI: invalid worker pool config", zap.Error(err))
+		}
+	}
+	api.workerPool = api.pools.MustGet("deleteWorker")
+	api.jobPool = api.pools.MustGet("jobWorker")
+	api.persistPool = api.pools.MustGet("persistWorker")
+	// Refreshes of the cache are optional and run on read-only instances too.
+	api.cachePool, _ = api.pools.Get("cacheWorker")
+	// Visits are only counted with a visitWorker pool.
+	api.visitPool, _ = api.pools.Get("visitWorker")
+	api.scheduler = scheduler.NewScheduler(api.jobPool, scheduler.Standalone{})
+	api.health = health.NewRegistry(cfg.Readiness.Budget, cfg.Readiness.CacheTTL, cfg.Readiness.History)
+	err = api.health.Register(health.Check{
+		Name:     "repository",
+		Timeout:  cfg.Readiness.RepositoryTimeout,
+		Critical: true,
+		Probe:    repo.Ping,
+	})
+	if err != nil {
+		log.Panic("RestAPI: invalid readiness config", zap.Error(err))
+	}
+	if api.rateLimiter != nil || api.ipLimiter != nil {
+		err = api.scheduler.Register(
+			scheduler.Spec{Name: "ratelimit-sweep", Interval: cfg.RateLimit.SweepInterval},
+			scheduler.JobFunc(func(context.Context) error {
+				if api.rateLimiter != nil {
+					api.rateLimiter.Sweep()
+				}
+				if api.ipLimiter != nil {
+					api.ipLimiter.Sweep()
+				}
+				return nil
+			}),
+		)
+		if err != nil {
+			log.Panic("RestAPI: invalid rate limit config", zap.Error(err))
+		}
+	}
+	api.httpMetrics = httpmetrics.New(api.clock)
+	err = api.prometheus.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "shortlink_http_requests_in_flight",
+		Help: "Requests being handled.",
+	}, func() float64 { return float64(api.inflight.InFlight()) }))
+	if err == nil {
+		err = api.prometheus.Register(api.tasks.Collector())
+	}
+	if err == nil {
+		err = api.prometheus.Register(api.httpMetrics)
+	}
+	if err == nil && api.lookups != nil {
+		err = api.prometheus.Register(api.lookups.Collector())
+	}
+	if err == nil && api.visitPool != nil {
+		err = api.prometheus.Register(prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "shortlink_visits_dropped_total",
+			Help: "Redirects not counted because the visitWorker pool was full.",
+		}, func() float64 { return float64(api.visitsDropped.Load()) }))
+	}
+	if err == nil && api.rateLimiter != nil {
+		err = registerRateLimitMetrics(api.prometheus, "user", api.rateLimiter)
+	}
+	if err == nil && api.ipLimiter != nil {
+		err = registerRateLimitMetrics(api.prometheus, "ip", api.ipLimiter)
+	}
+	if err != nil {
+		log.Panic("RestAPI: failed to register metrics", zap.Error(err))
+	}
+	return api
+}
+
+// registerRateLimitMetrics exports the counters of limiter, which tells clients apart by client.
+func registerRateLimitMetrics(registry *prometheus.Registry, client string, limiter *ratelimit.Limiter) error {
+	for result, count := range map[string]func() uint64{
+		"allowed":  func() uint64 { return limiter.Stats().Allowed },
+		"rejected": func() uint64 { return limiter.Stats().Rejected },
+	} {
+		err := registry.Register(prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "shortlink_rate_limit_requests_total",
+			Help:        "Requests seen by the per-client rate limits, by client kind and result.",
+			ConstLabels: prometheus.Labels{"client": client, "result": result},
+		}, func() float64 { return float64(count()) }))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const cookieExpTime = 3 * time.Hour
+
+const deleteFlushInterval = time.Second
+
+// Events returns the bus domain events are published on.
+func (r *RestAPI) Events() *events.Bus {
+	return r.events
+}
+
+// ErrorStores returns the error stores of the worker pools and of the delete batcher.
+func (r *RestAPI) ErrorStores() map[string]*errstore.Store {
+	stores := r.pools.Errors()
+	stores["deleteBatcher"] = r.deleteTask.Errors()
+	return stores
+}
+
+// Scheduler returns the scheduler of periodic jobs; jobs must be registered before Serve.
+func (r *RestAPI) Scheduler() *scheduler.Scheduler {
+	return r.scheduler
+}
+
+// Health returns the readiness checks; integrations register theirs before Serve.
+func (r *RestAPI) Health() *health.Registry {
+	return r.health
+}
+
+// InFlight returns the tracker of requests being handled.
+func (r *RestAPI) InFlight() *inflight.Tracker {
+	return r.inflight
+}
+
+// Serve serves until ctx is done or SIGINT or SIGTERM is received, then calls Stop.
+func (r *RestAPI) Serve(ctx context.Context) error {
+	if err := r.RegisterRoutes(); err != nil {
+		return err
+	}
+	// Stop drains the pools itself; they must outlive ctx to do so.
+	r.StartBackground(context.WithoutCancel(ctx))
+	srv := &http.Server{Addr: r.cfg.Server.Address, Handler: r.Engine}
+	signals, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	served := make(chan error, 1)
+	_ = r.tasks.Go(context.Background(), "http.serve", func() { served <- srv.ListenAndServe() })
+	var serveErr error
+	select {
+	case serveErr = <-served:
+	case <-signals.Done():
+		r.log.Info("shutting down")
+	}
+	stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.cfg.Server.GracePeriod)
+	defer cancel()
+	var errs []error
+	if serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+		errs = append(errs, fmt.Errorf("serve: %w", serveErr))
+	}
+	if err := r.Stop(stopCtx, srv); err != nil {
+		errs = append(errs, fmt.Errorf("graceful shutdown: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// Stop refuses new requests, gives running handlers Server.DrainTimeout, then
+// drains the pools and closes the repository.
+func (r *RestAPI) Stop(ctx context.Context, srv *http.Server) error {
+	r.inflight.StartDraining()
+	errs := []error{srv.Shutdown(ctx)}
+	drainCtx, cancel := context.WithTimeout(ctx, r.cfg.Server.DrainTimeout)
+	if err := r.inflight.Wait(drainCtx); err != nil {
+		errs = append(errs, fmt.Errorf("%d requests still in flight: %w", r.inflight.InFlight(), err))
+	}
+	cancel()
+	errs = append(errs, r.Shutdown(ctx), r.repo.Close(ctx))
+	return errors.Join(errs...)
+}
+
+// Shutdown stops the scheduler and drains the ingest pools, then the flush pools.
+// It must be called once, after the server stopped taking requests.
+func (r *RestAPI) Shutdown(ctx context.Context) error {
+	errs := []error{
+		r.scheduler.Stop(ctx),
+		r.pools.DrainStage(ctx, worker.StageIngest),
+	}
+	close(r.deleteChan)
+	if r.stopFlush != nil {
+		r.stopFlush()
+	}
+	errs = append(errs, r.pools.DrainStage(ctx, worker.StageFlush))
+	if !r.cfg.Server.ReadOnly {
+		if err := r.deleteTask.FinalFlush(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("final delete flush: %w", err))
+		}
+	}
+	if path := r.cfg.PoolMetrics.Path; path != "" {
+		if err := r.pools.SaveSnapshot(path, r.clock.Now()); err != nil {
+			errs = append(errs, fmt.Errorf("save worker pool metrics: %w", err))
+		}
+	}
+	errs = append(errs, r.tasks.Wait(ctx))
+	return errors.Join(errs...)
+}
+
+// StartBackground starts the worker pools, the delete batcher and the scheduler; a
+// read-only instance starts only the scheduler and the cache refresh pool.
+func (r *RestAPI) StartBackground(ctx context.Context) {
+	r.startPool(ctx, r.jobPool)
+	if r.cachePool != nil {
+		r.startPool(ctx, r.cachePool)
+	}
+	r.scheduler.Start(ctx)
+	if r.cfg.Server.ReadOnly {
+		r.log.Info("read-only mode: background writers are not started")
+		return
+	}
+	r.startPool(ctx, r.workerPool)
+	r.startPool(ctx, r.persistPool)
+	if r.visitPool != nil {
+		r.startPool(ctx, r.visitPool)
+	}
+
+	stopFlush, err := r.workerPool.SubmitEvery(ctx, r.deleteTask.FlushTask(), deleteFlushInterval)
+	if err != nil {
+		r.log.Error("failed to schedule delete flushes", zap.Error(err))
+		return
+	}
+	r.stopFlush = stopFlush
+}
+
+func (r *RestAPI) startPool(ctx context.Context, pool worker.WorkerPool) {
+	if err := pool.Start(ctx); err != nil {
+		r.log.Error("failed to start worker pool", zap.Error(err))
+	}
+}
+
+func (r *RestAPI) RegisterRoutes() error {
+	trustedSubnet, err := subnet.ParseSubnet(r.cfg.Server.TrustedSubnet)
+	if err != nil {
+		return err
+	}
+	proxies, err := subnet.ParseProxies(r.cfg.Server.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	// The request ID and the request metrics come first so every response,
+	// rejections included, carries the ID and is counted.
+	r.Use(requestid.Middleware(), r.httpMetrics.Middleware())
+	// CORS comes before auth and load shedding so their rejections carry its headers.
+	if cors.Enabled(r.cfg) {
+		r.Use(cors.Middleware(r.cfg))
+	}
+	// Probes and metrics stay outside the tracker so they keep answering while draining.
+	tracked := r.Group("/", inflight.Middleware(r.inflight), bodylimit.Middleware(r.cfg.Server.MaxBodyBytes))
+	protectedRouters := tracked.Group("/api")
+	if r.cfg.Server.ReadOnly {
+		protectedRouters.Use(readonly.Middleware(r.cfg.Server.PrimaryAddress))
+	}
+	// Each IP is limited before auth, so requests it rejects count too, then each
+	// user: /login hands out a user per call, so user budgets alone are free to reset.
+	var ipLimit []gin.HandlerFunc
+	if r.ipLimiter != nil {
+		ipLimit = append(ipLimit, ratelimit.Middleware(r.ipLimiter, proxies...))
+	}
+	protectedRouters.Use(ipLimit...)
+	protectedRouters.Use(auth.AuthMiddleware(r.tokenProvider))
+	if r.rateLimiter != nil {
+		protectedRouters.Use(ratelimit.KeyedMiddleware(r.rateLimiter, ratelimit.UserOrIP(proxies)))
+	}
+	shorten := []gin.HandlerFunc{}
+	if r.backpressure != nil {
+		shorten = append(shorten, backpressure.Middleware(r.backpressure, r.cfg.Backpressure.RetryAfter))
+	}
+	protectedRouters.POST("/shorten", append(shorten, r.JSONShortURL)...)
+	protectedRouters.POST("/batch_shorten", append(shorten, r.BatchShortURL)...)
+	protectedRouters.DELETE("/user/urls", r.DeleteLink)
+	protectedRouters.POST("/user/urls/delete_by_filter", r.DeleteByFilter)
+	protectedRouters.GET("/user/urls", r.GetAllUserLinks)
+	if r.linkHealth != nil {
+		protectedRouters.PUT("/user/link_checks", r.SetLinkChecks)
+	}
+	if r.export != nil {
+		protectedRouters.GET("/user/urls/export", r.ExportLinks)
+	}
+	protectedRouters.POST("/user/urls/import_bundle", r.ImportBundle)
+	if r.quota != nil {
+		protectedRouters.GET("/user/usage", r.Usage)
+	}
+	if r.privacy != nil {
+		protectedRouters.PATCH("/user/urls/:code", r.UpdateLink)
+	}
+	if r.linkStats != nil {
+		protectedRouters.GET("/user/urls/:code/stats", r.LinkStats)
+	}
+	if r.reservations != nil {
+		protectedRouters.POST("/reserve", r.Reserve)
+		protectedRouters.POST("/reserve/:code/complete", r.CompleteReservation)
+		protectedRouters.GET("/user/reservations", r.ListReservations)
+	}
+	if r.webhooks != nil {
+		protectedRouters.POST("/user/webhooks", r.CreateWebhook)
+		protectedRouters.GET("/user/webhooks", r.ListWebhooks)
+		protectedRouters.DELETE("/user/webhooks/:id", r.DeleteWebhook)
+		protectedRouters.POST("/user/webhooks/:id/test", r.TestWebhook)
+	}
+
+	if trustedSubnet != nil {
+		internalRouters := tracked.Group("/api/internal")
+		internalRouters.Use(subnet.TrustedSubnetMiddleware(trustedSubnet, proxies...))
+		if r.cfg.Server.ReadOnly {
+			internalRouters.Use(readonly.Middleware(r.cfg.Server.PrimaryAddress))
+		}
+		internalRouters.GET("/stats", r.Stats)
+		internalRouters.GET("/jobs", r.ListJobs)
+		internalRouters.GET("/errors", r.RecentErrors)
+		internalRouters.POST("/jobs/:name/run", r.RunJob)
+		internalRouters.POST("/urls/unarchive", r.UnarchiveLinks)
+		internalRouters.POST("/users/merge", r.MergeUsers)
+		if r.moderation != nil {
+			internalRouters.GET("/moderation", r.ModeratedLinks)
+			internalRouters.GET("/urls/:code/moderation", r.LinkModeration)
+			internalRouters.POST("/urls/:code/moderation", r.ModerateLink)
+		}
+		if r.legacy != nil {
+			internalRouters.GET("/legacy", r.LegacyLinks)
+			internalRouters.POST("/claim", r.ClaimLegacy)
+		}
+	}
+
+	tracked.POST("login", append(ipLimit, r.Auth)...)
+	r.GET("/ping", r.Ping)
+	r.GET("/readyz", r.readyz(trustedSubnet))
+	r.GET("/metrics", gin.WrapH(promhttp.HandlerFor(r.prometheus, promhttp.HandlerOpts{})))
+	r.GET("/metrics/worker-pool", r.WorkerPoolMetrics)
+	r.POST("/metrics/reset", auth.AuthMiddleware(r.tokenProvider), r.ResetWorkerPoolMetrics)
+	// Profiles run for as long as asked, so they stay outside the tracker too.
+	if r.cfg.Server.DebugEnabled {
+		debug.Register(r.Group("/debug", subnet.TrustedSubnetMiddleware(trustedSubnet, proxies...)))
+	}
+	// Links are handed out as BaseAddress/<code>; the routes above take precedence,
+	// and /api/<code> stays for links handed out before.
+	tracked.GET("/:shortURL", r.GetLongURL)
+	tracked.GET("/api/:shortURL", r.GetLongURL)
+	if r.findMany != nil {
+		tracked.POST("/api/expand_batch", ratelimit.Middleware(r.expandLimiter, proxies...), r.ExpandBatch)
+	}
+	r.NoRoute(func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "404 Not Found",
+			"message": "The requested resource was not found on this server.",
+		})
+	})
+	return nil
+}
+
+func (r *RestAPI) GetLongURL(c *gin.Context) {
+	shortURL := c.Param("shortURL")
+	url, err := r.repo.Find(c.Request.Context(), shortURL)
+	if err == domain.ErrURLNotFound {
+		c.String(http.StatusNotFound, err.Error())
+		return
+	} else if err == domain.ErrCodeReserved {
+		c.String(r.reservedStatus(), domain.ErrURLNotFound.Error())
+		return
+	} else if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if url.Degraded {
+		c.Header(DegradedHeader, "secondary")
+	}
+	if url.Moderation == domain.ModerationBlocked {
+		c.String(http.StatusUnavailableForLegalReasons, "URL has been blocked for policy reasons")
+		return
+	}
+	if url.Expired(r.clock.Now()) {
+		c.String(http.StatusGone, "URL has expired")
+		return
+	}
+	if url.DeletedFlag {
+		if c.NegotiateFormat(gin.MIMEPlain, gin.MIMEHTML) == gin.MIMEHTML {
+			r.renderPage(c, http.StatusGone, pages.Tombstone, pages.TombstoneData{ShortURL: shortURL})
+			return
+		}
+		c.String(http.StatusGone, "URL has been deleted")
+		return
+	}
+	r.redirect(c, url)
+	r.countVisit(c, url)
+}
+
+// requestLog returns the logger of the request ctx belongs to, tagging entries with its ID.
+func (r *RestAPI) requestLog(ctx context.Context) *zap.Logger {
+	return r.log.With(requestid.Field(ctx))
+}
+
+// countVisit submits the count of a redirect to the visitWorker pool, dropping it
+// if the pool is full.
+func (r *RestAPI) countVisit(c *gin.Context, url *domain.URL) {
+	if r.visitPool == nil || r.cfg.Server.ReadOnly || url.Degraded {
+		return
+	}
+	if err := r.visitPool.Submit(c.Request.Context(), task.NewVisitTask(r.repo, url.ShortURL)); err != nil {
+		r.visitsDropped.Add(1)
+		r.requestLog(c.Request.Context()).Debug("visit not counted", zap.String("short_url", url.ShortURL), zap.Error(err))
+	}
+}
+
+// LinkStats returns the visits of a link of the user.
+func (r *RestAPI) LinkStats(c *gin.Context) {
+	code := c.Param("code")
+	stats, err := r.linkStats.LinkStats(c.Request.Context(), c.GetString("UserID"), code)
+	switch {
+	case errors.Is(err, domain.ErrURLNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		r.requestLog(c.Request.Context()).Error("LinkStats error", zap.Error(err), zap.String("short_url", code))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read link stats"})
+	default:
+		c.JSON(http.StatusOK, stats)
+	}
+}
+
+const referrerPolicyHeader = "Referrer-Policy"
+
+// redirect sends the visitor on to url in the privacy mode of the link, or else
+// of Redirect.Privacy.
+func (r *RestAPI) redirect(c *gin.Context, url *domain.URL) {
+	c.Header("Cache-Control", r.redirectCacheControl())
+	switch url.Privacy.Or(r.defaultPrivacy()) {
+	case domain.PrivacyDereferer:
+		c.Header(referrerPolicyHeader, "no-referrer")
+		if dest := strings.ToLower(url.OriginalURL); strings.HasPrefix(dest, "http://") || strings.HasPrefix(dest, "https://") {
+			r.renderPage(c, http.StatusOK, pages.Dereferer, pages.DerefererData{Destination: url.OriginalURL})
+			return
+		}
+	case domain.PrivacyNoReferrer:
+		c.Header(referrerPolicyHeader, "no-referrer")
+	}
+	c.Redirect(r.redirectCode(), url.OriginalURL)
+}
+
+// redirectCode is the status of redirects, Server.RedirectCode or else 307.
+func (r *RestAPI) redirectCode() int {
+	if code := r.cfg.Server.RedirectCode; slices.Contains(configs.RedirectCodes, code) {
+		return code
+	}
+	return http.StatusTemporaryRedirect
+}
+
+// redirectCacheControl lets clients cache redirects for Server.RedirectMaxAge, not
+// at all by default, so that every visit is seen.
+func (r *RestAPI) redirectCacheControl() string {
+	if maxAge := r.cfg.Server.RedirectMaxAge; maxAge > 0 {
+		return fmt.Sprintf("max-age=%d", int(maxAge.Seconds()))
+	}
+	return "no-store"
+}
+
+// defaultPrivacy is the privacy of links without their own, off unless Redirect.Privacy
+// names another mode.
+func (r *RestAPI) defaultPrivacy() domain.Privacy {
+	if privacy := domain.Privacy(r.cfg.Redirect.Privacy); privacy.Valid() {
+		return privacy.Or(domain.PrivacyOff)
+	}
+	return domain.PrivacyOff
+}
+
+type updateLinkRequest struct {
+	Privacy *domain.Privacy `json:"privacy"`
+}
+
+// UpdateLink changes the privacy mode of a link of the user.
+func (r *RestAPI) UpdateLink(c *gin.Context) {
+	var req updateLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Privacy == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a JSON object with privacy"})
+		return
+	}
+	if !req.Privacy.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": domain.ErrInvalidPrivacy.Error()})
+		return
+	}
+	code := c.Param("code")
+	err := r.privacy.SetPrivacy(c.Request.Context(), c.GetString("UserID"), code, *req.Privacy)
+	switch {
+	case errors.Is(err, domain.ErrURLNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		r.requestLog(c.Request.Context()).Error("UpdateLink error", zap.Error(err), zap.String("short_url", code))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update link"})
+	default:
+		if cache, ok := r.repo.(ports.URLCachePort); ok {
+			cache.Evict(code)
+		}
+		c.JSON(http.StatusOK, gin.H{"short_url": code, "privacy": *req.Privacy})
+	}
+}
+
+// Statuses of the links resolved by ExpandBatch.
+const (
+	expandOK       = "ok"
+	expandNotFound = "not_found"
+	expandGone     = "gone"
+	expandBlocked  = "blocked"
+)
+
+type expandResult struct {
+	OriginalURL string `json:"original_url,omitempty"`
+	Status      string `json:"status"`
+}
+
+// ExpandBatch resolves a JSON array of up to Expand.BatchMax codes in one pass.
+func (r *RestAPI) ExpandBatch(c *gin.Context) {
+	var codes []string
+	if err := c.ShouldBindJSON(&codes); err != nil || len(codes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a JSON array of short codes"})
+		return
+	}
+	if len(codes) > r.cfg.Expand.BatchMax {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d codes per request", r.cfg.Expand.BatchMax)})
+		return
+	}
+	seen := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		if code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Empty short code"})
+			return
+		}
+		if seen[code] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Duplicate short code", "code": code})
+			return
+		}
+		seen[code] = true
+	}
+
+	found, err := r.findMany.FindMany(c.Request.Context(), codes)
+	if err != nil {
+		r.requestLog(c.Request.Context()).Error("ExpandBatch error", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve short codes"})
+		return
+	}
+	results := make(map[string]expandResult, len(codes))
+	immutable := true
+	for _, code := range codes {
+		url, ok := found[code]
+		var result expandResult
+		switch {
+		case !ok:
+			result.Status = expandNotFound
+		case url.DeletedFlag, url.Expired(r.clock.Now()):
+			result.Status = expandGone
+		case url.Moderation.Restricted():
+			result.Status = expandBlocked
+		default:
+			result = expandResult{OriginalURL: url.OriginalURL, Status: expandOK}
+		}
+		// A link that expires is not cached as if it resolved forever.
+		if (result.Status != expandOK && result.Status != expandGone) || (result.Status == expandOK && url.ExpiresAt != nil) {
+			immutable = false
+		}
+		results[code] = result
+	}
+	if immutable {
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(r.cfg.Expand.CacheMaxAge.Seconds())))
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// renderPage writes page in the language the client prefers.
+func (r *RestAPI) renderPage(c *gin.Context, status int, page string, data any) {
+	var body bytes.Buffer
+	lang, err := r.pages.Render(&body, page, c.GetHeader("Accept-Language"), data)
+	if err != nil {
+		r.requestLog(c.Request.Context()).Error("renderPage error", zap.String("page", page), zap.Error(err))
+		c.String(http.StatusInternalServerError, "Failed to render page")
+		return
+	}
+	c.Header("Content-Language", lang)
+	c.Header("Vary", "Accept-Language")
+	c.Data(status, "text/html; charset=utf-8", body.Bytes())
+}
+
+// Ping reports the status of the repository and of every worker pool.
+func (r *RestAPI) Ping(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), r.pingTimeout())
+	defer cancel()
+	status, repository := http.StatusOK, "ok"
+	if err := r.repo.Ping(ctx); err != nil {
+		status, repository = http.StatusServiceUnavailable, "down"
+		if errors.Is(err, context.DeadlineExceeded) {
+			repository = "timeout"
+		}
+		r.requestLog(c.Request.Context()).Error("Ping error", zap.Error(err))
+	}
+	pools := make(gin.H)
+	for _, name := range r.pools.Names() {
+		pool := r.pools.MustGet(name)
+		state := pool.State()
+		pools[name] = gin.H{
+			"state":       state.String(),
+			"closed":      state >= worker.StateDraining,
+			"queue_depth": pool.Metrics().PoolMetrics.QueueDepth(),
+		}
+	}
+	c.JSON(status, gin.H{"repository": repository, "pools": pools})
+}
+
+// pingTimeout is Readiness.PingTimeout, or else 2s.
+func (r *RestAPI) pingTimeout() time.Duration {
+	if timeout := r.cfg.Readiness.PingTimeout; timeout > 0 {
+		return timeout
+	}
+	return 2 * time.Second
+}
+
+// decodeJSON decodes the body of c into v, refusing unknown and miscased fields,
+// or answers 400 or 413 and reports false.
+func (r *RestAPI) decodeJSON(c *gin.Context, v any) bool {
+	body, err := io.ReadAll(c.Request.Body)
+	if err == nil {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(v)
+	}
+	if err == nil {
+		err = exactFields(body, v)
+	}
+	switch {
+	case err == nil:
+		return true
+	case bodylimit.Exceeded(err):
+		bodylimit.Abort(c, r.cfg.Server.MaxBodyBytes)
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "400 Bad Request",
+			"message": err.Error(),
+		})
+	}
+	return false
+}
+
+// exactFields checks that the keys of the JSON object body are named exactly as
+// the fields of the struct v points to; values of other types are not checked.
+func exactFields(body []byte, v any) error {
+	t := reflect.TypeOf(v).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return err
+	}
+	names := jsonNames(t)
+	for key := range fields {
+		if !names[key] {
+			return fmt.Errorf("json: unknown field %q", key)
+		}
+	}
+	return nil
+}
+
+// jsonNames returns the names struct type t is encoded with, those of the fields
+// of its embedded structs included.
+func jsonNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || (field.Anonymous && field.Type.Kind() == reflect.Struct) {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+		case "":
+			names[field.Name] = true
+		default:
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// shortenRequest is a link to save, with its expiry given either as expires_at or as ttl.
+// It has only the fields a client sets, so the others of domain.URL are unknown fields.
+type shortenRequest struct {
+	OriginalURL string     `json:"longURL"`
+	Alias       string     `json:"alias"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	// TTL is a duration such as "720h" after which the link expires.
+	TTL     string         `json:"ttl"`
+	Privacy domain.Privacy `json:"privacy"`
+}
+
+func (r *RestAPI) JSONShortURL(c *gin.Context) {
+	result := c.GetStringMap("result")
+	if result == nil {
+		result = make(map[string]interface{})
+	}
+	status := http.StatusCreated
+	c.Header("Content-Type", "application/json")
+	var req shortenRequest
+	if !r.decodeJSON(c, &req) {
+		return
+	}
+	url := domain.URL{OriginalURL: req.OriginalURL, Alias: req.Alias, ExpiresAt: req.ExpiresAt, Privacy: req.Privacy}
+	if url.OriginalURL == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			gin.H{
+				"error":   "400 Bad Request",
+				"message": "url is required",
+			},
+		)
+		return
+	}
+	if !url.Privacy.Valid() {
+		c.AbortWithStatusJSON(http.StatusBadRequest,
+			gin.H{
+				"error":   "400 Bad Request",
+				"message": domain.ErrInvalidPrivacy.Error(),
+			},
+		)
+		return
+	}
+	originalURL, ok := r.validateURL(c, "longURL", url.OriginalURL)
+	if !ok {
+		return
+	}
+	url.OriginalURL = originalURL
+	if url.ExpiresAt, ok = r.linkExpiry(c, req.TTL, url.ExpiresAt); !ok {
+		return
+	}
+	if url.Alias != "" {
+		if err := domain.ValidateShortCode(url.Alias); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "400 Bad Request",
+				"message": err.Error(),
+				"field":   "alias",
+			})
+			return
+		}
+	}
+	url.UUID = c.GetString("UserID")
+	url.ShortURL = url.Alias
+	usage, ok := r.reserveQuota(c, url.UUID, 1)
+	if !ok {
+		return
+	}
+	// An alias is saved synchronously: whether it is free is only known once saved.
+	if r.cfg.AsyncPersist.Enabled && url.Alias == "" && c.GetHeader("Prefer") == preferAsync {
+		if err := r.persistAsync(c.Request.Context(), &url); err == nil {
+			result["result"] = fmt.Sprintf("%s/%s", r.cfg.Server.BaseAddress, url.ShortURL)
+			if warnings := r.quotaUsed(c, url.UUID, usage, 1); warnings != nil {
+				result["warnings"] = warnings
+			}
+			c.Set("result", result)
+			c.Header("Preference-Applied", preferAsync)
+			c.JSON(http.StatusAccepted, result)
+			return
+		}
+		url.ShortURL = ""
+	}
+	if err := r.shortener.Save(c.Request.Context(), &url); errors.Is(err, domain.ErrURLAlreadyExists) {
+		status = http.StatusConflict
+		r.releaseQuota(url.UUID, 1)
+	} else if url.Alias != "" && errors.Is(err, domain.ErrShortURLTaken) {
+		r.releaseQuota(url.UUID, 1)
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error":   "409 Conflict",
+			"message": fmt.Sprintf("alias %q is already taken", url.Alias),
+			"field":   "alias",
+		})
+		return
+	} else if err != nil {
+		r.releaseQuota(url.UUID, 1)
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	} else if warnings := r.quotaUsed(c, url.UUID, usage, 1); warnings != nil {
+		result["warnings"] = warnings
+	}
+	result["result"] = fmt.Sprintf("%s/%s", r.cfg.Server.BaseAddress, url.ShortURL)
+	c.Set("result", result)
+	c.JSON(status, result)
+}
+
+// validateURL returns raw normalized by domain.ValidateURL, or answers 400 naming
+// field, the key of the request holding raw, and reports false.
+func (r *RestAPI) validateURL(c *gin.Context, field, raw string) (string, bool) {
+	normalized, err := domain.ValidateURL(raw, r.cfg.Server.MaxURLLength)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "400 Bad Request",
+			"message": err.Error(),
+			"field":   field,
+		})
+		return "", false
+	}
+	return normalized, true
+}
+
+// linkExpiry returns when a new link expires, after ttl or at expiresAt, or answers
+// 400 and reports false.
+func (r *RestAPI) linkExpiry(c *gin.Context, ttl string, expiresAt *time.Time) (*time.Time, bool) {
+	invalid := func(field, message string) (*time.Time, bool) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "400 Bad Request",
+			"message": fmt.Sprintf("%s: %s", domain.ErrInvalidExpiry, message),
+			"field":   field,
+		})
+		return nil, false
+	}
+	now := r.clock.Now()
+	switch {
+	case ttl != "" && expiresAt != nil:
+		return invalid("ttl", "set either ttl or expires_at")
+	case ttl != "":
+		parsed, err := time.ParseDuration(ttl)
+		if err != nil || parsed <= 0 {
+			return invalid("ttl", "ttl must be a positive duration")
+		}
+		at := now.Add(parsed)
+		return &at, true
+	case expiresAt != nil && !expiresAt.After(now):
+		return invalid("expires_at", "expires_at must be in the future")
+	}
+	return expiresAt, true
+}
+
+// quotaHeader tells clients how many more links they may create.
+const quotaHeader = "X-Quota-Remaining"
+
+// reserveQuota takes n links of the quota of userID, or answers 403 or 500 and
+// reports false. Without a quota it returns a nil usage.
+func (r *RestAPI) reserveQuota(c *gin.Context, userID string, n int) (*quota.Usage, bool) {
+	if r.quota == nil {
+		return nil, true
+	}
+	usage, err := r.quota.Reserve(c.Request.Context(), userID, n)
+	if errors.Is(err, quota.ErrQuotaExceeded) {
+		c.Header(quotaHeader, strconv.Itoa(usage.Remaining))
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Link quota exceeded", "usage": usage})
+		return nil, false
+	}
+	if err != nil {
+		r.requestLog(c.Request.Context()).Error("quota check failed", zap.Error(err), zap.String("user_id", userID))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check link quota"})
+		return nil, false
+	}
+	return &usage, true
+}
+
+// invalidateQuota makes the link counts of userIDs be counted again, after links
+// were added or removed other than by shortening.
+func (r *RestAPI) invalidateQuota(userIDs ...string) {
+	if r.quota != nil {
+		r.quota.Invalidate(userIDs...)
+	}
+}
+
+// releaseQuota gives back n links reserved for userID that were not created.
+func (r *RestAPI) releaseQuota(userID string, n int) {
+	if r.quota != nil {
+		r.quota.Release(userID, n)
+	}
+}
+
+// quotaUsed reports usage once its last n links are created and returns the
+// warnings to show the user.
+func (r *RestAPI) quotaUsed(c *gin.Context, userID string, usage *quota.Usage, n int) []string {
+	if usage == nil {
+		return nil
+	}
+	c.Header(quotaHeader, strconv.Itoa(usage.Remaining))
+	if usage.Crossed(n) {
+		r.events.Publish(events.Event{
+			Type:   events.QuotaWarning,
+			UserID: userID,
+			Attrs:  map[string]string{"used": strconv.Itoa(usage.Used), "limit": strconv.Itoa(usage.Limit)},
+		})
+	}
+	if !usage.Warning {
+		return nil
+	}
+	return []string{fmt.Sprintf("%d of your %d links are used", usage.Used, usage.Limit)}
+}
+
+// Usage returns how much of their link quota the user has used.
+func (r *RestAPI) Usage(c *gin.Context) {
+	userID := c.GetString("UserID")
+	usage, err := r.quota.Usage(c.Request.Context(), userID)
+	if err != nil {
+		r.requestLog(c.Request.Context()).Error("Usage error", zap.Error(err), zap.String("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count links"})
+		return
+	}
+	c.Header(quotaHeader, strconv.Itoa(usage.Remaining))
+	c.JSON(http.StatusOK, usage)
+}
+
+// preferAsync is the Prefer header value opting a shorten request into background persistence.
+const preferAsync = "respond-async"
+
+// persistAsync primes the cache and leaves the repository write to the persist pool.
+// On error nothing was primed and the caller should save synchronously.
+func (r *RestAPI) persistAsync(ctx context.Context, url *domain.URL) error {
+	code, err := r.shortener.Code(ctx, url.OriginalURL)
+	if err != nil {
+		r.requestLog(ctx).Warn("async persist unavailable, saving synchronously", zap.Error(err))
+		return err
+	}
+	url.ShortURL = code
+	cache, _ := r.repo.(ports.URLCachePort)
+	if cache != nil {
+		cache.Prime(url)
+	}
+	err = r.persistPool.Submit(ctx, task.NewPersistTask(r.repo, cache, r.events, *url))
+	if err != nil {
+		if cache != nil {
+			cache.Evict(url.ShortURL)
+		}
+		r.requestLog(ctx).Warn("async persist unavailable, saving synchronously", zap.Error(err))
+	}
+	return err
+}
+
+func (r *RestAPI) BatchShortURL(c *gin.Context) {
+	c.Header("Content-Type", "application/json")
+	result := c.GetStringMap("result")
+	if result == nil {
+		result = make(map[string]any)
+	}
+	var urlsToShorten map[string]string
+	if !r.decodeJSON(c, &urlsToShorten) {
+		return
+	}
+
+	if len(urlsToShorten) < 1 {
+		c.String(http.StatusBadRequest, "Urls not found")
+		return
+	}
+	if len(urlsToShorten) > r.cfg.Server.MaxBatchSize {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":   "413 Request Entity Too Large",
+			"message": fmt.Sprintf("at most %d links per request", r.cfg.Server.MaxBatchSize),
+		})
+		return
+	}
+	var expiresAt *time.Time
+	if raw := c.Query("expires_at"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "400 Bad Request",
+				"message": fmt.Sprintf("%s: expires_at must be an RFC 3339 time", domain.ErrInvalidExpiry),
+				"field":   "expires_at",
+			})
+			return
+		}
+		expiresAt = &parsed
+	}
+	expiresAt, ok := r.linkExpiry(c, c.Query("ttl"), expiresAt)
+	if !ok {
+		return
+	}
+	// Keys are checked in order so that of several invalid URLs the same one is named.
+	keys := slices.Sorted(maps.Keys(urlsToShorten))
+	for _, key := range keys {
+		originalURL, ok := r.validateURL(c, key, urlsToShorten[key])
+		if !ok {
+			return
+		}
+		urlsToShorten[key] = originalURL
+	}
+
+	userID := c.GetString("UserID")
+	usage, ok := r.reserveQuota(c, userID, len(urlsToShorten))
+	if !ok {
+		return
+	}
+	urlsToSave := make([]*domain.URL, 0, len(keys))
+	for _, key := range keys {
+		url := domain.NewURL(urlsToShorten[key])
+		url.UUID = userID
+		url.ExpiresAt = expiresAt
+		urlsToSave = append(urlsToSave, url)
+	}
+	if err := r.shortener.BatchSave(c.Request.Context(), urlsToSave); err != nil {
+		r.releaseQuota(userID, len(urlsToShorten))
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	// The keys of the response are those of the request: warnings are left to the header and usage endpoint.
+	r.quotaUsed(c, userID, usage, len(urlsToShorten))
+
+	for i, key := range keys {
+		urlsToSave[i].ShortURL = fmt.Sprintf("%s/%s", r.cfg.Server.BaseAddress, urlsToSave[i].ShortURL)
+		result[key] = *urlsToSave[i]
+	}
+	c.Set("result", result)
+	c.JSON(http.StatusCreated, result)
+}
+
+func (r *RestAPI) Auth(c *gin.Context) {
+	tokenString, err := c.Cookie("auth")
+	if err == nil && tokenString != "" {
+		claims, errCheck := auth.CheckToken(tokenString, r.tokenProvider)
+		if errCheck == nil {
+			c.AbortWithStatusJSON(http.StatusOK, gin.H{"UserID": claims.UserID, "msg": "You alredy login!"})
+			return
+		}
+		r.requestLog(c.Request.Context()).Info("Token err")
+	}
+	userID := uuid.NewString()
+	tokenString, err = r.tokenProvider.BuildJWTString(userID)
+	if err != nil {
+		r.requestLog(c.Request.Context()).Info("LoginMeddleware error", zap.Error(err))
+		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.Set("UserID", userID)
+	c.SetCookie("auth", tokenString, int(cookieExpTime), "/", "", false, true)
+	c.JSON(http.StatusOK, gin.H{"UserID": userID})
+}
+
+// GetAllUserLinks lists a page of the live links of the user.
+func (r *RestAPI) GetAllUserLinks(c *gin.Context) {
+	userID := c.GetString("UserID")
+	if r.isLegacyOwner(c, userID) {
+		return
+	}
+	healthFilter := c.Query("health")
+	switch healthFilter {
+	case "", linkcheck.HealthOK, linkcheck.HealthBroken, linkcheck.HealthUnknown:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "health must be one of ok, broken, unknown"})
+		return
+	}
+	page, ok := r.linkPage(c, userID)
+	if !ok {
+		return
+	}
+	result := c.GetStringMap("result")
+	if result == nil {
+		result = make(map[string]interface{})
+	}
+
+	limit := page.Limit
+	page.Limit++
+	found, err := r.repo.FindByUser(c.Request.Context(), userID, page)
+	if errors.Is(err, domain.ErrQueryUnsupported) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": "q"})
+		return
+	}
+	if err != nil {
+		r.requestLog(c.Request.Context()).Error("GetAllUserLinks error", zap.Error(err))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user links"})
+		return
+	}
+	var next string
+	if len(found) > limit {
+		found = found[:limit]
+		if next, err = r.cursors.Encode(userID, domain.CursorOf(found[limit-1], page.Sort)); err != nil {
+			r.requestLog(c.Request.Context()).Error("GetAllUserLinks cursor error", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user links"})
+			return
+		}
+	}
+	urls := make([]domain.URL, 0, len(found))
+	for _, link := range found {
+		link.ShortURL = fmt.Sprintf("%s/%s", r.cfg.Server.BaseAddress, link.ShortURL)
+		link.Health = linkcheck.HealthOf(link.LastStatus)
+		if link.Moderation.Restricted() {
+			link.Policy = domain.PolicyNotice
+		}
+		if healthFilter != "" && link.Health != healthFilter {
+			continue
+		}
+		urls = append(urls, link)
+	}
+	if len(urls) == 0 && next == "" {
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	result["urls"] = urls
+	if healthFilter == "" {
+		total, err := r.repo.CountByQuery(c.Request.Context(), userID, page.Query)
+		if err != nil {
+			r.requestLog(c.Request.Context()).Error("GetAllUserLinks count error", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user links"})
+			return
+		}
+		result["total"] = total
+	}
+	if next != "" {
+		query := url.Values{"cursor": {next}, "limit": {strconv.Itoa(limit)}}
+		for key, value := range map[string]string{"health": healthFilter, "sort": c.Query("sort"), "q": page.Query} {
+			if value != "" {
+				query.Set(key, value)
+			}
+		}
+		result["next_cursor"] = next
+		result["next"] = fmt.Sprintf("%s?%s", c.Request.URL.Path, query.Encode())
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"next\"", result["next"]))
+	}
+	c.Set("result", result)
+	c.JSON(http.StatusOK, result)
+}
+
+// linkPage reads the page asked for by the query of GetAllUserLinks, or answers
+// 400 and reports false.
+func (r *RestAPI) linkPage(c *gin.Context, userID string) (domain.LinkPage, bool) {
+	cfg := r.cfg.Pagination
+	page := domain.LinkPage{Limit: cfg.DefaultLimit, Sort: domain.SortByCreated, Query: c.Query("q")}
+	if raw := c.Query("sort"); raw != "" {
+		if page.Sort = domain.LinkSort(raw); !page.Sort.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be created_at or short_url", "field": "sort"})
+			return page, false
+		}
+	}
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > cfg.MaxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be 1 to %d", cfg.MaxLimit)})
+			return page, false
+		}
+		page.Limit = limit
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		after, err := r.cursors.Decode(userID, cursor)
+		switch {
+		case errors.Is(err, pagination.ErrExpiredCursor):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "cursor_expired"})
+			return page, false
+		case err != nil:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "cursor_invalid"})
+			return page, false
+		case after.Sort != domain.CursorOf(domain.URL{}, page.Sort).Sort:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cursor was issued for another sort", "code": "cursor_invalid"})
+			return page, false
+		}
+		page.After = &after
+		return page, true
+	}
+	if raw := c.Query("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 || offset > cfg.MaxOffset {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("offset must be 0 to %d; page with cursor instead", cfg.MaxOffset)})
+			return page, false
+		}
+		c.Header("Deprecation", "true")
+		page.Offset = offset
+	}
+	return page, true
+}
+
+// DeleteLink deletes the links of the user named by a JSON array of short codes or URLs.
+func (r *RestAPI) DeleteLink(c *gin.Context) {
+	userID := c.GetString("UserID")
+	if r.isLegacyOwner(c, userID) {
+		return
+	}
+	var linkIDs []string
+	if c.ContentType() == "application/json" {
+		if err := c.ShouldBindJSON(&linkIDs); err != nil || len(linkIDs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a JSON array of short URLs"})
+			return
+		}
+	} else if ids := formLinkIDs(c); len(ids) > 0 {
+		linkIDs = ids
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or missing link_ids"})
+		return
+	}
+	if len(linkIDs) > r.cfg.Delete.BatchMax {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("At most %d links per request", r.cfg.Delete.BatchMax)})
+		return
+	}
+	invalid := make([]string, 0)
+	for i, id := range linkIDs {
+		linkIDs[i] = strings.TrimPrefix(id, r.cfg.Server.BaseAddress+"/")
+		if linkIDs[i] == "" || strings.Contains(linkIDs[i], "/") {
+			invalid = append(invalid, id)
+		}
+	}
+	if len(invalid) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid short URLs", "invalid": invalid})
+		return
+	}
+	request := task.DeleteRequest{
+		IDs:       map[string][]string{userID: linkIDs},
+		RequestID: requestid.FromContext(c.Request.Context()),
+	}
+
+	select {
+	case r.deleteChan <- request:
+		c.JSON(http.StatusAccepted, gin.H{"message": "Link deletion initiated"})
+	default:
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later"})
+	}
+}
+
+// formLinkIDs reads link_ids from a form-encoded body, which net/http parses for
+// POST, PUT and PATCH only.
+func formLinkIDs(c *gin.Context) []string {
+	if c.ContentType() != "application/x-www-form-urlencoded" {
+		return nil
+	}
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(c.Request.Body); err != nil {
+		return nil
+	}
+	form, err := url.ParseQuery(body.String())
+	if err != nil {
+		return nil
+	}
+	return form["link_ids"]
+}
+
+type linkChecksRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// SetLinkChecks opts the user in or out of background checks of their links.
+func (r *RestAPI) SetLinkChecks(c *gin.Context) {
+	userID := c.GetString("UserID")
+	if r.isLegacyOwner(c, userID) {
+		return
+	}
+	var req linkChecksRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Enabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a JSON object with enabled"})
+		return
+	}
+	if err := r.linkHealth.SetLinkChecks(c.Request.Context(), userID, *req.Enabled); err != nil {
+		r.requestLog(c.Request.Context()).Error("SetLinkChecks error", zap.Error(err), zap.String("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update link checks"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": *req.Enabled})
+}
+
+type reserveRequest struct {
+	Code string `json:"code"`
+	// TTL is a duration such as "48h"; Reservation.DefaultTTL when empty.
+	TTL string `json:"ttl"`
+}
+
+// Reserve holds a short URL for the user until Reservation.MaxTTL at most.
+func (r *RestAPI) Reserve(c *gin.Context) {
+	userID := c.GetString("UserID")
+	if r.isLegacyOwner(c, userID) {
+		return
+	}
+	var req reserveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a JSON object with code"})
+		return
 	}
+	if err := domain.ValidateShortCode(req.Code); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ttl := r.cfg.Reservation.DefaultTTL
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ttl must be a positive duration"})
+			return
+		}
+		ttl = parsed
+	}
+	if maxTTL := r.cfg.Reservation.MaxTTL; maxTTL > 0 && ttl > maxTTL {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ttl must not exceed %s", maxTTL)})
+		return
+	}
+	err := r.reservations.Reserve(c.Request.Context(), userID, req.Code, ttl)
+	if errors.Is(err, domain.ErrShortURLTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		r.requestLog(c.Request.Context()).Error("Reserve error", zap.Error(err), zap.String("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reserve short URL"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"result":     fmt.Sprintf("%s/%s", r.cfg.Server.BaseAddress, req.Code),
+		"expires_at": time.Now().Add(ttl),
+	})
 }
 
-const cookieExpTime = 3 * time.Hour
-
-func (r *RestAPI) Serve() {
-	r.workerPool.Start(context.TODO())
-
-	timeout := time.Second
-
-	deleteTask := task.NewBatcherDeleteTask(
-		r.deleteChan,
-		r.repo,
-		r.cfg.Worker.BufferSize,
-		timeout,
-	)
+type completeReservationRequest struct {
+	URL string `json:"url"`
+}
 
-	for i := 0; i < r.cfg.Worker.WorkersCount; i++ {
-		_ = r.workerPool.Submit(context.TODO(), deleteTask)
+// CompleteReservation points a short URL reserved by the user at its destination.
+func (r *RestAPI) CompleteReservation(c *gin.Context) {
+	userID := c.GetString("UserID")
+	if r.isLegacyOwner(c, userID) {
+		return
 	}
-	protectedRouters := r.Group("/api")
-	protectedRouters.Use(auth.AuthMiddleware(r.tokenProvider))
-	protectedRouters.POST("/shorten", r.JSONShortURL)
-	protectedRouters.POST("/batch_shorten", r.BatchShortURL)
-	protectedRouters.DELETE("/user/urls", r.DeleteLink)
-	protectedRouters.GET("/user/urls", r.GetAllUserLinks)
+	var req completeReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.URL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a JSON object with url"})
+		return
+	}
+	originalURL, ok := r.validateURL(c, "url", req.URL)
+	if !ok {
+		return
+	}
+	code := c.Param("code")
+	err := r.reservations.CompleteReservation(c.Request.Context(), userID, code, originalURL)
+	switch {
+	case errors.Is(err, domain.ErrReservationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrNotReservationOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrURLAlreadyExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		r.requestLog(c.Request.Context()).Error("CompleteReservation error", zap.Error(err), zap.String("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete reservation"})
+	default:
+		if cache, ok := r.repo.(ports.URLCachePort); ok {
+			cache.Evict(code)
+		}
+		r.invalidateQuota(userID)
+		c.JSON(http.StatusCreated, gin.H{"result": fmt.Sprintf("%s/%s", r.cfg.Server.BaseAddress, code)})
+	}
+}
 
-	authRouter := r.Group("/")
-	authRouter.POST("login", r.Auth)
-	r.GET("/ping", r.Ping)
-	r.GET("/metrics", r.WorkerPoolMetrics)
-	r.GET("/api/:shortURL", r.GetLongURL)
-	r.NoRoute(func(c *gin.Context) {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error":   "404 Not Found",
-			"message": "The requested resource was not found on this server.",
-		})
-	})
-	if err := r.Run(r.cfg.Server.Address); err != nil {
-		log.Fatal(err)
+// ListReservations returns the active reservations of the user.
+func (r *RestAPI) ListReservations(c *gin.Context) {
+	userID := c.GetString("UserID")
+	reservations, err := r.reservations.Reservations(c.Request.Context(), userID)
+	if err != nil {
+		r.requestLog(c.Request.Context()).Error("ListReservations error", zap.Error(err), zap.String("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reservations"})
+		return
 	}
+	c.JSON(http.StatusOK, gin.H{"reservations": reservations})
 }
 
-func (r *RestAPI) GetLongURL(c *gin.Context) {
-	shortURL := c.Param("shortURL")
-	url, err := r.repo.Find(context.TODO(), shortURL)
-	if err == domain.ErrURLNotFound {
-		c.String(http.StatusNotFound, err.Error())
+type webhookRequest struct {
+	URL string `json:"url"`
+}
+
+// CreateWebhook registers a webhook of the user; only this answer shows its secret.
+func (r *RestAPI) CreateWebhook(c *gin.Context) {
+	userID := c.GetString("UserID")
+	if r.isLegacyOwner(c, userID) {
 		return
-	} else if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	}
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a JSON object with url"})
 		return
 	}
-	if url.DeletedFlag {
-		c.String(http.StatusGone, "URL has been deleted")
+	hook, err := r.webhooks.Add(userID, req.URL)
+	switch {
+	case errors.Is(err, webhook.ErrInvalidTarget):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, webhook.ErrTooManyWebhooks):
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("At most %d webhooks per user", webhook.MaxPerUser)})
+		return
+	case err != nil:
+		r.requestLog(c.Request.Context()).Error("CreateWebhook error", zap.Error(err), zap.String("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
 		return
 	}
-	c.Redirect(http.StatusMovedPermanently, url.OriginalURL)
+	c.JSON(http.StatusCreated, hook)
 }
 
-func (r *RestAPI) Ping(c *gin.Context) {
-	err := r.repo.Ping(context.TODO())
+// ListWebhooks lists the webhooks of the user, without their secrets.
+func (r *RestAPI) ListWebhooks(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"webhooks": r.webhooks.List(c.GetString("UserID"))})
+}
+
+func (r *RestAPI) DeleteWebhook(c *gin.Context) {
+	if err := r.webhooks.Delete(c.GetString("UserID"), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// TestWebhook sends a signed webhook.test event to the webhook and reports the delivery.
+func (r *RestAPI) TestWebhook(c *gin.Context) {
+	userID := c.GetString("UserID")
+	hook, err := r.webhooks.Get(userID, c.Param("id"))
 	if err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
 	}
-	c.String(http.StatusOK, "OK")
+	delivery, err := r.webhookSender.Send(c.Request.Context(), hook.Target, hook.Secret, webhook.TestEvent(userID))
+	result := gin.H{
+		"delivered":   err == nil,
+		"status_code": delivery.StatusCode,
+		"duration_ms": delivery.Duration.Milliseconds(),
+	}
+	if err != nil {
+		r.requestLog(c.Request.Context()).Info("webhook test delivery failed", zap.Error(err),
+			zap.String("user_id", userID), zap.String("webhook_id", hook.ID))
+		result["error"] = err.Error()
+	}
+	c.JSON(http.StatusOK, result)
 }
 
-func (r *RestAPI) JSONShortURL(c *gin.Context) {
-	result := c.GetStringMap("result")
-	if result == nil {
-		result = make(map[string]interface{})
+// reservedStatus is the status a reserved short URL resolves to, 404 unless Reservation.Status is 410.
+func (r *RestAPI) reservedStatus() int {
+	if r.cfg.Reservation.Status == http.StatusGone {
+		return http.StatusGone
 	}
-	status := http.StatusCreated
-	c.Header("Content-Type", "application/json")
-	var url domain.URL
-	if err := json.NewDecoder(c.Request.Body).Decode(&url); err != nil {
-		_ = c.AbortWithError(http.StatusBadRequest, err)
+	return http.StatusNotFound
+}
+
+// DeleteByFilter deletes the links of the user matching a host suffix or URL prefix.
+func (r *RestAPI) DeleteByFilter(c *gin.Context) {
+	userID := c.GetString("UserID")
+	if r.isLegacyOwner(c, userID) {
 		return
 	}
-	if url.OriginalURL == "" {
-		c.AbortWithStatusJSON(http.StatusBadRequest,
-			gin.H{
-				"error":   "400 Bad Request",
-				"message": "The request body is empty or malformed.",
-			},
-		)
+	var filter domain.URLFilter
+	if err := c.ShouldBind(&filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected host_suffix or url_prefix"})
 		return
 	}
-	url.UUID = c.GetString("UserID")
-	if err := r.repo.Save(context.TODO(), &url); errors.Is(err, domain.ErrURLAlreadyExists) {
-		status = http.StatusConflict
-	} else if err != nil {
-		_ = c.AbortWithError(http.StatusInternalServerError, err)
+	if err := filter.Normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	result["result"] = fmt.Sprintf("%s/%s", r.cfg.Server.BaseAddress, url.ShortURL)
-	c.Set("result", result)
-	c.JSON(status, result)
+	shortURLs, err := r.repo.FindByUserAndHost(c.Request.Context(), userID, filter)
+	if err != nil {
+		r.requestLog(c.Request.Context()).Error("DeleteByFilter error", zap.Error(err), zap.String("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find links"})
+		return
+	}
+	if c.Query("dry_run") == "true" {
+		c.JSON(http.StatusOK, gin.H{"matched": len(shortURLs)})
+		return
+	}
+	if len(shortURLs) == 0 {
+		c.JSON(http.StatusOK, gin.H{"scheduled": 0})
+		return
+	}
+	select {
+	case r.deleteChan <- task.DeleteRequest{
+		IDs:       map[string][]string{userID: shortURLs},
+		RequestID: requestid.FromContext(c.Request.Context()),
+	}:
+		c.JSON(http.StatusAccepted, gin.H{"scheduled": len(shortURLs)})
+	default:
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later"})
+	}
 }
 
-func (r *RestAPI) BatchShortURL(c *gin.Context) {
-	c.Header("Content-Type", "application/json")
-	result := c.GetStringMap("result")
-	if result == nil {
-		result = make(map[string]any)
+// ExportLinks returns the links of the user as a bundle signed with the server secret.
+func (r *RestAPI) ExportLinks(c *gin.Context) {
+	userID := c.GetString("UserID")
+	if r.isLegacyOwner(c, userID) {
+		return
 	}
-	var urlsToShorten map[string]string
-	if err := c.ShouldBindJSON(&urlsToShorten); err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+	if c.Query("format") != "bundle" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be bundle"})
+		return
+	}
+	urls, err := r.export.ExportByUser(c.Request.Context(), userID)
+	if err != nil {
+		r.requestLog(c.Request.Context()).Error("ExportLinks error", zap.Error(err), zap.String("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export links"})
+		return
+	}
+	links := make([]bundle.Link, len(urls))
+	for i, url := range urls {
+		links[i] = bundle.Link{ShortURL: url.ShortURL, OriginalURL: url.OriginalURL}
+	}
+	b, err := bundle.New(r.cfg.Server.Environment, userID, r.clock.Now(), links, []byte(r.cfg.Auth.SecretKey))
+	if err != nil {
+		r.requestLog(c.Request.Context()).Error("ExportLinks error", zap.Error(err), zap.String("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export links"})
 		return
 	}
+	c.JSON(http.StatusOK, b)
+}
 
-	if len(urlsToShorten) < 1 {
-		c.String(http.StatusBadRequest, "Urls not found")
+// importChunkSize bounds the links saved by one BatchSave of an import.
+const importChunkSize = 100
+
+// Statuses of imported links.
+const (
+	// importCreated links were saved with their code.
+	importCreated = "created"
+	// importUnchanged links already had their code and destination for the user.
+	importUnchanged = "unchanged"
+	// importRenamed links had their code taken by another link and got a new one.
+	importRenamed = "renamed"
+	// importExisting links were not saved: a link to the destination already
+	// exists, and its code is returned.
+	importExisting = "exists"
+	importFailed   = "failed"
+)
+
+type importResult struct {
+	RequestedShortURL string `json:"requested_short_url"`
+	ShortURL          string `json:"short_url,omitempty"`
+	OriginalURL       string `json:"original_url"`
+	Status            string `json:"status"`
+	Error             string `json:"error,omitempty"`
+}
+
+// ImportBundle saves the links of a bundle for the user, keeping their codes where free.
+func (r *RestAPI) ImportBundle(c *gin.Context) {
+	userID := c.GetString("UserID")
+	if r.isLegacyOwner(c, userID) {
+		return
+	}
+	var b bundle.Bundle
+	if err := c.ShouldBindJSON(&b); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a link bundle"})
 		return
 	}
+	verified := true
+	if err := b.Verify([]byte(r.cfg.Auth.SecretKey)); err != nil {
+		if c.Query("unsafe") != "true" || !errors.Is(err, bundle.ErrInvalidSignature) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		verified = false
+		r.requestLog(c.Request.Context()).Warn("importing a bundle with an invalid signature",
+			zap.String("user_id", userID), zap.String("environment", b.Environment))
+	}
+	results := make([]importResult, len(b.Links))
+	for start := 0; start < len(b.Links); start += importChunkSize {
+		end := min(start+importChunkSize, len(b.Links))
+		r.importChunk(c.Request.Context(), userID, b.Links[start:end], results[start:end])
+	}
+	r.invalidateQuota(userID)
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.Status]++
+	}
+	attrs := map[string]string{
+		"environment": b.Environment,
+		"source_user": b.UserID,
+		"verified":    strconv.FormatBool(verified),
+	}
+	for status, n := range counts {
+		attrs[status] = strconv.Itoa(n)
+	}
+	r.events.Publish(events.Event{Type: events.LinksImported, UserID: userID, Attrs: attrs})
+	c.JSON(http.StatusOK, gin.H{"counts": counts, "results": results})
+}
 
-	urlsToSave := make([]*domain.URL, 0, len(urlsToShorten))
-	for _, longURL := range urlsToShorten {
-		url := domain.NewURL(longURL)
-		url.UUID = c.GetString("UserID")
-		urlsToSave = append(urlsToSave, url)
+// importChunk saves links with one BatchSave, or one by one if the batch fails, so
+// every link gets its own result.
+func (r *RestAPI) importChunk(ctx context.Context, userID string, links []bundle.Link, results []importResult) {
+	var pending []*domain.URL
+	var wanted []string
+	var index []int
+	for i, link := range links {
+		results[i] = importResult{RequestedShortURL: link.ShortURL, OriginalURL: link.OriginalURL}
+		if _, ok := domain.NormalizeURL(link.OriginalURL); !ok {
+			results[i].Status, results[i].Error = importFailed, "original_url must be an http or https URL"
+			continue
+		}
+		url := &domain.URL{UUID: userID, ShortURL: link.ShortURL, OriginalURL: link.OriginalURL}
+		if link.ShortURL != "" {
+			existing, err := r.repo.Find(ctx, link.ShortURL)
+			switch {
+			case err == nil && existing.UUID == userID && existing.OriginalURL == link.OriginalURL:
+				results[i].ShortURL, results[i].Status = link.ShortURL, importUnchanged
+				continue
+			case err != nil && !errors.Is(err, domain.ErrURLNotFound):
+				r.requestLog(ctx).Error("ImportBundle lookup error", zap.Error(err), zap.String("short_url", link.ShortURL))
+				results[i].Status, results[i].Error = importFailed, "failed to look up short code"
+				continue
+			case err == nil:
+				results[i].Status = importRenamed
+				url.ShortURL = ""
+			}
+		}
+		// A code set in advance tells a saved link from one the repository
+		// answered with an existing link to the same destination.
+		if url.ShortURL == "" {
+			code, err := r.shortener.Code(ctx, url.OriginalURL)
+			if err != nil {
+				r.requestLog(ctx).Error("ImportBundle code error", zap.Error(err))
+				results[i].Status, results[i].Error = importFailed, "failed to generate short code"
+				continue
+			}
+			url.ShortURL = code
+		}
+		pending = append(pending, url)
+		wanted = append(wanted, url.ShortURL)
+		index = append(index, i)
 	}
-	if err := r.repo.BatchSave(context.TODO(), urlsToSave); err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+	if len(pending) == 0 {
+		return
+	}
+	if err := r.repo.BatchSave(ctx, pending); err == nil {
+		for j, url := range pending {
+			importOutcome(&results[index[j]], url, wanted[j], nil)
+		}
 		return
 	}
+	for j, url := range pending {
+		url.ShortURL = wanted[j]
+		err := r.repo.Save(ctx, url)
+		if err != nil && !errors.Is(err, domain.ErrURLAlreadyExists) && !errors.Is(err, domain.ErrShortURLTaken) {
+			r.requestLog(ctx).Error("ImportBundle save error", zap.Error(err), zap.String("short_url", wanted[j]))
+		}
+		importOutcome(&results[index[j]], url, wanted[j], err)
+	}
+}
 
-	i := 0
-	for key := range urlsToShorten {
-		urlsToSave[i].ShortURL = fmt.Sprintf("%s/%s", r.cfg.Server.BaseAddress, urlsToSave[i].ShortURL)
-		result[key] = *urlsToSave[i]
-		i++
+func importOutcome(result *importResult, url *domain.URL, wanted string, err error) {
+	switch {
+	case errors.Is(err, domain.ErrShortURLTaken):
+		result.Status, result.Error = importFailed, "short code taken"
+	case err != nil && !errors.Is(err, domain.ErrURLAlreadyExists):
+		result.Status, result.Error = importFailed, "failed to save link"
+	case url.ShortURL != wanted && url.ShortURL == result.RequestedShortURL:
+		result.ShortURL, result.Status = url.ShortURL, importUnchanged
+	case url.ShortURL != wanted:
+		result.ShortURL, result.Status = url.ShortURL, importExisting
+	case result.Status == importRenamed:
+		result.ShortURL = url.ShortURL
+	default:
+		result.ShortURL, result.Status = url.ShortURL, importCreated
 	}
-	c.Set("result", result)
-	c.JSON(http.StatusCreated, result)
 }
 
-func (r *RestAPI) Auth(c *gin.Context) {
-	tokenString, err := c.Cookie("auth")
-	if err == nil && tokenString != "" {
-		claims, errCheck := auth.CheckToken(tokenString, r.tokenProvider)
-		if errCheck == nil {
-			c.AbortWithStatusJSON(http.StatusOK, gin.H{"UserID": claims.UserID, "msg": "You alredy login!"})
-			return
+// Stats reports the link counts, the repository health and the counters of every component.
+func (r *RestAPI) Stats(c *gin.Context) {
+	stats := gin.H{"delete": r.deleteTask.Metrics()}
+	if counts, err := r.repo.Stats(c.Request.Context()); err != nil {
+		r.requestLog(c.Request.Context()).Error("Stats error", zap.Error(err))
+	} else {
+		stats["urls"], stats["users"] = counts.URLs, counts.Users
+	}
+	if r.backpressure != nil {
+		stats["backpressure"] = r.backpressure.Stats()
+	}
+	if r.outbound != nil {
+		stats["outbound"] = r.outbound.Stats()
+	}
+	if cache, ok := r.repo.(*CachedRepository); ok {
+		stats["cache"] = cache.CacheStats()
+	}
+	if r.failover != nil {
+		stats["failover"] = r.failover.FailoverStats()
+	}
+	if r.lookups != nil {
+		stats["lookups"] = r.lookups.Lookups()
+	}
+	if r.findMany != nil {
+		stats["expand_batch"] = r.expandLimiter.Stats()
+	}
+	if r.visitPool != nil {
+		stats["visits"] = gin.H{"dropped": r.visitsDropped.Load()}
+	}
+	if r.rateLimiter != nil {
+		stats["rate_limit"] = r.rateLimiter.Stats()
+	}
+	if r.ipLimiter != nil {
+		stats["rate_limit_ip"] = r.ipLimiter.Stats()
+	}
+	stats["readiness"] = gin.H{"history": r.health.History()}
+	stats["http"] = gin.H{"in_flight": r.inflight.InFlight(), "draining": r.inflight.Draining()}
+	stats["goroutines"] = r.tasks.Running()
+	stats["config"] = gin.H{"pools": r.pools.Configs(), "delete": r.deleteTask.Config()}
+	c.JSON(http.StatusOK, stats)
+}
+
+// readyz reports readiness; error messages are only shown to the trusted subnet.
+func (r *RestAPI) readyz(trusted *net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := r.health.Check(c.Request.Context())
+		if r.inflight.Draining() {
+			report.Ready, report.Draining = false, true
 		}
-		r.log.Info("Token err")
+		status := http.StatusOK
+		if !report.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		ip := net.ParseIP(c.RemoteIP())
+		if trusted == nil || ip == nil || !trusted.Contains(ip) {
+			report = report.Redacted()
+		}
+		c.JSON(status, report)
 	}
-	userID := uuid.NewString()
-	tokenString, err = r.tokenProvider.BuildJWTString(userID)
+}
+
+type errorReport struct {
+	Total  int64            `json:"total"`
+	Groups []errstore.Group `json:"groups"`
+	Recent []errstore.Entry `json:"recent"`
+}
+
+// RecentErrors returns the errors kept for every component, grouped by error string.
+func (r *RestAPI) RecentErrors(c *gin.Context) {
+	sources := make(map[string]errorReport)
+	for name, store := range r.ErrorStores() {
+		recent := store.Recent()
+		sources[name] = errorReport{Total: store.Total(), Groups: errstore.GroupByError(recent), Recent: recent}
+	}
+	c.JSON(http.StatusOK, gin.H{"sources": sources})
+}
+
+func (r *RestAPI) WorkerPoolMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, r.pools.Metrics())
+}
+
+// ResetWorkerPoolMetrics zeroes the counters of the worker pools and answers their values before.
+func (r *RestAPI) ResetWorkerPoolMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, r.pools.SnapshotAndReset())
+}
+
+func (r *RestAPI) ListJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"jobs": r.scheduler.Jobs()})
+}
+
+func (r *RestAPI) RunJob(c *gin.Context) {
+	name := c.Param("name")
+	err := r.scheduler.Trigger(c.Request.Context(), name)
+	switch {
+	case errors.Is(err, scheduler.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, scheduler.ErrJobRunning), errors.Is(err, scheduler.ErrNotLeader):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		r.requestLog(c.Request.Context()).Error("RunJob error", zap.String("job", name), zap.Error(err))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusAccepted, gin.H{"message": "Job triggered", "job": name})
+	}
+}
+
+func (r *RestAPI) UnarchiveLinks(c *gin.Context) {
+	var shortURLs []string
+	if err := c.ShouldBindJSON(&shortURLs); err != nil || len(shortURLs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a JSON array of short URLs"})
+		return
+	}
+	restored, err := r.repo.Unarchive(c.Request.Context(), shortURLs)
 	if err != nil {
-		r.log.Info("LoginMeddleware error", zap.Error(err))
-		_ = c.AbortWithError(http.StatusInternalServerError, err)
+		r.requestLog(c.Request.Context()).Error("UnarchiveLinks error", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unarchive links"})
 		return
 	}
-	c.Set("UserID", userID)
-	c.SetCookie("auth", tokenString, int(cookieExpTime), "/", "", false, true)
-	c.JSON(http.StatusOK, gin.H{"UserID": userID})
+	c.JSON(http.StatusOK, gin.H{"restored": restored})
 }
 
-func (r *RestAPI) GetAllUserLinks(c *gin.Context) {
-	userID := c.GetString("UserID")
-	result := c.GetStringMap("result")
-	if result == nil {
-		result = make(map[string]interface{})
+// isLegacyOwner rejects requests made as the legacy owner: its links are only visible to admins.
+func (r *RestAPI) isLegacyOwner(c *gin.Context, userID string) bool {
+	if userID != r.cfg.Repository.LegacyOwner {
+		return false
 	}
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+	return true
+}
 
-	db := common.GetConnection(r.cfg)
-	query := `
-    SELECT user_id, original_url, short_url FROM urls
-	WHERE is_deleted = false AND user_id = $1;
-    `
-	rows, err := db.Queryx(query, userID)
+func (r *RestAPI) LegacyLinks(c *gin.Context) {
+	links, err := r.legacy.LegacyLinks(c.Request.Context())
 	if err != nil {
-		r.log.Error("GetAllUserLinks error", zap.Error(err))
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user links"})
+		r.requestLog(c.Request.Context()).Error("LegacyLinks error", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve legacy links"})
 		return
 	}
-	defer rows.Close()
-	var urls []domain.URL
-	for rows.Next() {
-		var url domain.URL
-		err := rows.StructScan(&url)
-		url.ShortURL = fmt.Sprintf("%s/%s", r.cfg.Server.BaseAddress, url.ShortURL)
-		if err != nil {
-			r.log.Error("GetAllUserLinks error", zap.Error(err))
-			continue
+	c.JSON(http.StatusOK, gin.H{"urls": links})
+}
+
+type claimLegacyRequest struct {
+	UserID    string   `json:"user_id"`
+	ShortURLs []string `json:"short_urls"`
+}
+
+// ClaimLegacy hands legacy links to a user. Calling it is the admin's approval of the claim.
+func (r *RestAPI) ClaimLegacy(c *gin.Context) {
+	var req claimLegacyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.ShortURLs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a JSON object with user_id and short_urls"})
+		return
+	}
+	if _, err := uuid.Parse(req.UserID); err != nil || req.UserID == r.cfg.Repository.LegacyOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id must be a UserID"})
+		return
+	}
+	claimed, err := r.legacy.ClaimLegacy(c.Request.Context(), req.UserID, req.ShortURLs)
+	if cache, ok := r.repo.(ports.URLCachePort); ok {
+		for _, short := range req.ShortURLs {
+			cache.Evict(short)
 		}
-		urls = append(urls, url)
 	}
-	if len(urls) == 0 {
-		c.AbortWithStatus(http.StatusNoContent)
+	r.invalidateQuota(req.UserID)
+	if err != nil {
+		r.requestLog(c.Request.Context()).Error("ClaimLegacy error", zap.Error(err), zap.String("user_id", req.UserID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim links"})
 		return
 	}
-	result["urls"] = urls
-	c.Set("result", result)
-	c.JSON(http.StatusOK, result)
+	r.events.Publish(events.Event{
+		Type:   events.LegacyClaimed,
+		UserID: req.UserID,
+		Attrs: map[string]string{
+			"requested": strconv.Itoa(len(req.ShortURLs)),
+			"claimed":   strconv.Itoa(claimed),
+		},
+	})
+	c.JSON(http.StatusOK, gin.H{"claimed": claimed})
 }
 
-func (r *RestAPI) DeleteLink(c *gin.Context) {
-	userID := c.GetString("UserID")
-	linkIDs, ok := c.GetPostFormArray("link_ids")
-	if !ok || len(linkIDs) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or missing link_ids"})
+type moderateRequest struct {
+	Status domain.ModerationStatus `json:"status"`
+	Reason domain.ModerationReason `json:"reason"`
+	Note   string                  `json:"note"`
+	Actor  string                  `json:"actor"`
+}
+
+// ModerateLink applies a moderation decision to a link: flag, block or clear it.
+func (r *RestAPI) ModerateLink(c *gin.Context) {
+	var req moderateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a JSON object with status, reason and actor"})
 		return
 	}
-	request := map[string][]string{
-		userID: linkIDs,
+	code := c.Param("code")
+	moderation, err := r.moderation.Moderate(c.Request.Context(), code, domain.Moderation{
+		Status: req.Status,
+		Reason: req.Reason,
+		Note:   req.Note,
+		Actor:  req.Actor,
+	})
+	switch {
+	case errors.Is(err, domain.ErrInvalidModeration):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrURLNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, domain.ErrModerationTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		r.requestLog(c.Request.Context()).Error("ModerateLink error", zap.Error(err), zap.String("short_url", code))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to moderate link"})
+	default:
+		r.requestLog(c.Request.Context()).Info("link moderated",
+			zap.String("short_url", code),
+			zap.String("status", string(moderation.Status)),
+			zap.String("reason", string(moderation.Reason)),
+			zap.String("actor", moderation.Actor),
+		)
+		if cache, ok := r.repo.(ports.URLCachePort); ok {
+			cache.Evict(code)
+		}
+		c.JSON(http.StatusOK, gin.H{"moderation": moderation})
 	}
+}
 
-	select {
-	case r.deleteChan <- request:
-		c.JSON(http.StatusAccepted, gin.H{"message": "Link deletion initiated"})
+// LinkModeration returns the current moderation of a link and its audit log.
+func (r *RestAPI) LinkModeration(c *gin.Context) {
+	code := c.Param("code")
+	moderation, history, err := r.moderation.Moderation(c.Request.Context(), code)
+	switch {
+	case errors.Is(err, domain.ErrURLNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		r.requestLog(c.Request.Context()).Error("LinkModeration error", zap.Error(err), zap.String("short_url", code))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve moderation"})
 	default:
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later"})
+		c.JSON(http.StatusOK, gin.H{"moderation": moderation, "history": history})
 	}
 }
 
-func (r *RestAPI) WorkerPoolMetrics(c *gin.Context) {
-	metrics := r.workerPool.Metrics()
-	c.JSON(http.StatusOK, metrics)
+// ModeratedLinks lists the links in a moderation status, flagged unless ?status= says otherwise.
+func (r *RestAPI) ModeratedLinks(c *gin.Context) {
+	status := domain.ModerationStatus(c.DefaultQuery("status", string(domain.ModerationFlagged)))
+	switch status {
+	case domain.ModerationFlagged, domain.ModerationBlocked, domain.ModerationCleared:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of flagged, blocked, cleared"})
+		return
+	}
+	links, err := r.moderation.ModeratedLinks(c.Request.Context(), status)
+	if err != nil {
+		r.requestLog(c.Request.Context()).Error("ModeratedLinks error", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve moderated links"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"urls": links})
+}
+
+type mergeUsersRequest struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// MergeUsers moves every link of the source user to the target user.
+func (r *RestAPI) MergeUsers(c *gin.Context) {
+	var req mergeUsersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a JSON object with source and target"})
+		return
+	}
+	_, errSource := uuid.Parse(req.Source)
+	_, errTarget := uuid.Parse(req.Target)
+	if errSource != nil || errTarget != nil || req.Source == req.Target {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source and target must be two different UserIDs"})
+		return
+	}
+	moved, err := r.repo.ReassignOwner(c.Request.Context(), req.Source, req.Target)
+	r.invalidateQuota(req.Source, req.Target)
+	if err != nil {
+		r.requestLog(c.Request.Context()).Error("MergeUsers error", zap.Error(err), zap.String("source", req.Source), zap.String("target", req.Target))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge users"})
+		return
+	}
+	r.events.Publish(events.Event{
+		Type:   events.UsersMerged,
+		UserID: req.Target,
+		Attrs: map[string]string{
+			"source": req.Source,
+			"target": req.Target,
+			"moved":  strconv.Itoa(moved),
+		},
+	})
+	c.JSON(http.StatusOK, gin.H{"moved": moved})
 }
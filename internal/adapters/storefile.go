@@ -0,0 +1,253 @@
+package adapters
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OrtemRepos/shortlink/internal/domain"
+)
+
+// Save file formats, by version:
+//   - 0: a bare map of short codes to URL strings, from before records existed;
+//   - 1: a bare map of short codes to records, the owner optional;
+//   - 2: records under a header with the version, every record owned.
+//
+// decodeFile reports both headerless formats as version 1; decodeStore tells them apart.
+const legacyFormatVersion = 0
+
+var ErrInvalidEntry = errors.New("invalid save file entry")
+
+// decodeFile returns the entries of a save file keyed by short code, and its format version.
+// Files without a header are a bare map of entries and reported as version 1.
+// Entries of files before version 2 that have no owner belong to the legacy owner.
+func decodeFile(reader io.Reader) (map[string]json.RawMessage, int, error) {
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(reader).Decode(&raw); err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	version, hasVersion := raw["version"]
+	entries, hasURLs := raw["urls"]
+	if !hasVersion || !hasURLs || len(raw) != 2 {
+		return raw, 1, nil
+	}
+	header := fileHeader[json.RawMessage]{}
+	if json.Unmarshal(version, &header.Version) != nil || json.Unmarshal(entries, &header.URLs) != nil {
+		// A headerless file that happens to have "version" and "urls" short codes.
+		return raw, 1, nil
+	}
+	if header.Version > fileFormatVersion {
+		return nil, 0, fmt.Errorf("%w: version %d", ErrUnsupportedFormat, header.Version)
+	}
+	return header.URLs, header.Version, nil
+}
+
+type fileHeader[T any] struct {
+	Version int          `json:"version"`
+	URLs    map[string]T `json:"urls"`
+}
+
+// storeFile is a decoded save file: its records as load keeps them, and what had
+// to be made of the entries of older formats.
+type storeFile struct {
+	version int
+	records map[string]*record
+	// invalid are the entries that are neither a URL string nor a record.
+	invalid map[string]error
+	// legacy are the URL strings and unowned the records without an owner,
+	// both given the legacy owner.
+	legacy  []string
+	unowned []string
+}
+
+// decodeStore reads a save file of any version. URL strings become records created
+// at now, and entries before version 2 without an owner belong to legacyOwner.
+// Records are returned as stored, encrypted or not.
+func decodeStore(reader io.Reader, legacyOwner string, now time.Time) (*storeFile, error) {
+	raw, version, err := decodeFile(reader)
+	if err != nil {
+		return nil, err
+	}
+	decoded := &storeFile{
+		version: version,
+		records: make(map[string]*record, len(raw)),
+		invalid: make(map[string]error),
+	}
+	for short, value := range raw {
+		var longURL string
+		if err := json.Unmarshal(value, &longURL); err == nil {
+			decoded.records[short] = &record{OriginalURL: longURL, UserID: legacyOwner, CreatedAt: now}
+			decoded.legacy = append(decoded.legacy, short)
+			continue
+		}
+		rec := &record{}
+		if err := json.Unmarshal(value, rec); err != nil {
+			decoded.invalid[short] = err
+			continue
+		}
+		if version < 2 && rec.UserID == "" {
+			rec.UserID = legacyOwner
+			decoded.unowned = append(decoded.unowned, short)
+		}
+		decoded.records[short] = rec
+	}
+	if version == 1 && len(raw) > 0 && len(decoded.legacy) == len(raw) {
+		decoded.version = legacyFormatVersion
+	}
+	sort.Strings(decoded.legacy)
+	sort.Strings(decoded.unowned)
+	return decoded, nil
+}
+
+// firstInvalid returns the error of the first invalid entry by short code, if any.
+func (f *storeFile) firstInvalid() error {
+	shorts := make([]string, 0, len(f.invalid))
+	for short := range f.invalid {
+		shorts = append(shorts, short)
+	}
+	if len(shorts) == 0 {
+		return nil
+	}
+	sort.Strings(shorts)
+	return fmt.Errorf("%w %s: %w", ErrInvalidEntry, shorts[0], f.invalid[shorts[0]])
+}
+
+// encodeStore writes records in the format of version, 1 or 2.
+func encodeStore(writer io.Writer, version int, records map[string]*record) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	switch version {
+	case 1:
+		return encoder.Encode(records)
+	case fileFormatVersion:
+		return encoder.Encode(fileHeader[*record]{Version: version, URLs: records})
+	}
+	return fmt.Errorf("%w: cannot write version %d", ErrUnsupportedFormat, version)
+}
+
+// StoreMigration configures MigrateStore.
+type StoreMigration struct {
+	From string
+	To   string
+	// Version is the format to write, 1 or 2.
+	Version int
+	// LegacyOwner owns the entries of older formats without one; the default is domain.LegacyOwner.
+	LegacyOwner string
+	// Check validates From without writing To.
+	Check bool
+	// Now is the creation time given to URL strings; the default is the current time.
+	Now time.Time
+}
+
+// StoreMigrationSummary tells what MigrateStore made of a save file.
+type StoreMigrationSummary struct {
+	FromVersion int      `json:"from_version"`
+	ToVersion   int      `json:"to_version"`
+	Converted   int      `json:"converted"`
+	Skipped     int      `json:"skipped"`
+	Warnings    []string `json:"warnings"`
+}
+
+// MigrateStore converts the save file of the in-memory repository at m.From, of any
+// version, to m.Version and writes it to m.To, replacing it atomically. It decodes
+// the file like the repository does on load; entries the repository could not use
+// are skipped with a warning instead of failing the run. Only the main file is
+// converted: the archive, opt-out and moderation files are left as they are.
+func MigrateStore(m StoreMigration) (StoreMigrationSummary, error) {
+	summary := StoreMigrationSummary{ToVersion: m.Version, Warnings: []string{}}
+	if m.Version != 1 && m.Version != fileFormatVersion {
+		return summary, fmt.Errorf("%w: cannot write version %d", ErrUnsupportedFormat, m.Version)
+	}
+	if m.LegacyOwner == "" {
+		m.LegacyOwner = domain.LegacyOwner
+	}
+	if m.Now.IsZero() {
+		m.Now = time.Now()
+	}
+	file, err := os.Open(m.From)
+	if err != nil {
+		return summary, err
+	}
+	defer file.Close()
+	decoded, err := decodeStore(file, m.LegacyOwner, m.Now.UTC())
+	if err != nil {
+		return summary, err
+	}
+	summary.FromVersion = decoded.version
+
+	shorts := make([]string, 0, len(decoded.invalid))
+	for short := range decoded.invalid {
+		shorts = append(shorts, short)
+	}
+	for short, rec := range decoded.records {
+		if err := validateEntry(short, rec); err != nil {
+			decoded.invalid[short] = err
+			delete(decoded.records, short)
+			shorts = append(shorts, short)
+		}
+	}
+	sort.Strings(shorts)
+	for _, short := range shorts {
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("skipped %q: %v", short, decoded.invalid[short]))
+	}
+	if n := len(decoded.legacy); n > 0 {
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("%d URL strings became records owned by %s", n, m.LegacyOwner))
+	}
+	if n := len(decoded.unowned); n > 0 {
+		summary.Warnings = append(summary.Warnings, fmt.Sprintf("%d records without an owner were given %s", n, m.LegacyOwner))
+	}
+	summary.Skipped = len(shorts)
+	summary.Converted = len(decoded.records)
+	if m.Check {
+		return summary, nil
+	}
+	return summary, writeFileAtomic(m.To, func(w io.Writer) error {
+		return encodeStore(w, m.Version, decoded.records)
+	})
+}
+
+// validateEntry checks what the repository relies on: a short code usable in a
+// path and, unless the record is a reservation, a URL.
+func validateEntry(short string, rec *record) error {
+	if short == "" || strings.ContainsAny(short, "/?# \t\n") {
+		return fmt.Errorf("%w: short code %q", ErrInvalidEntry, short)
+	}
+	if rec.OriginalURL == "" && !rec.reserved() {
+		return fmt.Errorf("%w: no original_url", ErrInvalidEntry)
+	}
+	return nil
+}
+
+// writeFileAtomic writes path through a temporary file renamed over it, so readers
+// see either the old file or the whole new one.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), filePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
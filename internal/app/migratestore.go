@@ -0,0 +1,60 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+)
+
+// MigrateStoreCommand is the subcommand that runs MigrateStore.
+const MigrateStoreCommand = "migrate-store"
+
+// MigrateStore converts an in-memory save file offline, see adapters.MigrateStore:
+//
+//	shortlink migrate-store --from old.json --to new.json --format v2 [--check]
+//
+// It prints a summary to stdout and returns the exit code.
+func MigrateStore(args []string, stdout, stderr io.Writer) int {
+	f := flag.NewFlagSet(MigrateStoreCommand, flag.ContinueOnError)
+	f.SetOutput(stderr)
+	from := f.String("from", "", "Save file to convert, of any version")
+	to := f.String("to", "", "File to write, replaced atomically")
+	format := f.String("format", "v2", "Version to write: v1 or v2")
+	legacyOwner := f.String("legacy-owner", domain.LegacyOwner, "Owner of entries saved without one")
+	check := f.Bool("check", false, "Validate --from without writing --to")
+	if err := f.Parse(args); err != nil {
+		return 2
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(*format, "v"))
+	if err != nil || *from == "" || (*to == "" && !*check) {
+		fmt.Fprintln(stderr, "migrate-store needs --from, --to unless --check, and --format v1 or v2")
+		f.PrintDefaults()
+		return 2
+	}
+	summary, err := adapters.MigrateStore(adapters.StoreMigration{
+		From:        *from,
+		To:          *to,
+		Version:     version,
+		LegacyOwner: *legacyOwner,
+		Check:       *check,
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "migrate-store: %v\n", err)
+		return 1
+	}
+	for _, warning := range summary.Warnings {
+		fmt.Fprintf(stdout, "warning: %s\n", warning)
+	}
+	action := "converted"
+	if *check {
+		action = "valid"
+	}
+	fmt.Fprintf(stdout, "v%d to v%d: %d entries %s, %d skipped, %d warnings\n",
+		summary.FromVersion, summary.ToVersion, summary.Converted, action, summary.Skipped, len(summary.Warnings))
+	return 0
+}
@@ -4,41 +4,235 @@ import (
 	"context"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.uber.org/zap"
 
 	"github.com/OrtemRepos/shortlink/internal/gzip"
 	log "github.com/OrtemRepos/shortlink/internal/logger"
 
 	"github.com/OrtemRepos/shortlink/configs"
 	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/backpressure"
+	"github.com/OrtemRepos/shortlink/internal/encryption"
+	"github.com/OrtemRepos/shortlink/internal/linkcheck"
+	"github.com/OrtemRepos/shortlink/internal/outbound"
 	"github.com/OrtemRepos/shortlink/internal/ports"
+	"github.com/OrtemRepos/shortlink/internal/scheduler"
+	"github.com/OrtemRepos/shortlink/internal/subnet"
+	"github.com/OrtemRepos/shortlink/internal/task"
+	"github.com/OrtemRepos/shortlink/internal/taskgroup"
+	"github.com/OrtemRepos/shortlink/internal/timing"
+	"github.com/OrtemRepos/shortlink/internal/webhook"
+	"github.com/OrtemRepos/shortlink/internal/worker"
 )
 
-func run(restAPI ports.RestAPIPort) {
-	restAPI.Serve()
+func run(restAPI ports.RestAPIPort) error {
+	return restAPI.Serve(context.Background())
 }
 
 func Run(cfg *configs.Config) {
+	levelErr := log.SetLevel(cfg.Log.Level)
 	logger, err := log.InitLogger()
 	if err != nil {
 		panic(err)
 	}
+	if levelErr != nil {
+		logger.Warn("invalid log level, logging from info", zap.String("level", cfg.Log.Level), zap.Error(levelErr))
+	}
 	defer func() {
 		if errSync := logger.Sync(); errSync != nil {
 			logger.Error(errSync.Error())
 		}
 	}()
+	if _, err := adapters.NewProviderJWT(cfg); err != nil {
+		logger.Fatal("invalid auth config", zap.Error(err))
+	}
+	if adapters.ExampleSecretKey(cfg.Auth.SecretKey) {
+		logger.Warn("auth secret key is a known example value, anybody can sign tokens: set SECRET_KEY")
+	}
+	keyring, err := encryption.FromConfig(cfg)
+	if err != nil {
+		logger.Fatal("invalid encryption config", zap.Error(err))
+	}
 	var repository ports.URLRepositoryPort
 	if cfg.UseDataBase() {
-		repository = adapters.NewPostgreRepository(context.TODO(), cfg)
+		repository = adapters.NewPostgreRepository(context.TODO(), cfg, keyring)
 	} else {
-		repository, err = adapters.NewInMemoryURLRepository(cfg.Repository.SavePath)
+		repository, err = adapters.NewInMemoryURLRepository(cfg.Repository.SavePath,
+			adapters.WithRehydrate(cfg.Archive.Rehydrate && !cfg.Server.ReadOnly),
+			adapters.WithKeyring(keyring),
+			adapters.WithLegacyOwner(cfg.Repository.LegacyOwner))
 		if err != nil {
 			logger.Error(err.Error())
 		}
 	}
+	reencrypter, _ := repository.(ports.URLReencryptPort)
+	legacy, _ := repository.(ports.URLLegacyPort)
+	linkHealth, _ := repository.(ports.URLHealthPort)
+	exporter, _ := repository.(ports.URLExportPort)
+	finder, _ := repository.(ports.URLFindManyPort)
+	counter, _ := repository.(ports.URLCountPort)
+	reservations, _ := repository.(ports.URLReservationPort)
+	expiry, _ := repository.(ports.URLExpiryPort)
+	moderation, _ := repository.(ports.URLModerationPort)
+	privacy, _ := repository.(ports.URLPrivacyPort)
+	linkStats, _ := repository.(ports.URLStatsPort)
+
+	tasks := taskgroup.New()
+	metricsRegistry := prometheus.NewRegistry()
+	metricsRegistry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	poolOpts := []worker.PoolOption{worker.WithTaskGroup(tasks), worker.WithPrometheus(metricsRegistry)}
+	pools, err := worker.NewRegistryFromConfig(cfg, poolOpts...)
+	if err != nil {
+		logger.Fatal("invalid worker pool config", zap.Error(err))
+	}
+	governor := outbound.NewGovernor(cfg)
+	apiOpts := []adapters.RestAPIOption{
+		adapters.WithPools(pools),
+		adapters.WithOutbound(governor),
+		adapters.WithTaskGroup(tasks),
+		adapters.WithPrometheus(metricsRegistry),
+	}
+	if legacy != nil {
+		apiOpts = append(apiOpts, adapters.WithLegacyLinks(legacy))
+	}
+	if linkHealth != nil {
+		apiOpts = append(apiOpts, adapters.WithLinkHealth(linkHealth))
+	}
+	if exporter != nil {
+		apiOpts = append(apiOpts, adapters.WithExport(exporter))
+	}
+	if cfg.Webhooks.Enabled {
+		sender := webhook.NewSender(governor.Client(cfg.Webhooks.Timeout))
+		apiOpts = append(apiOpts, adapters.WithWebhooks(webhook.NewStore(nil), sender))
+	}
+	if finder != nil && !cfg.Cache.Enabled {
+		apiOpts = append(apiOpts, adapters.WithFindMany(finder))
+	}
+	if counter != nil {
+		apiOpts = append(apiOpts, adapters.WithLinkCounter(counter))
+	}
+	if reservations != nil {
+		apiOpts = append(apiOpts, adapters.WithReservations(reservations))
+	}
+	if moderation != nil {
+		apiOpts = append(apiOpts, adapters.WithModeration(moderation))
+	}
+	if privacy != nil {
+		apiOpts = append(apiOpts, adapters.WithLinkPrivacy(privacy))
+	}
+	if linkStats != nil {
+		apiOpts = append(apiOpts, adapters.WithLinkStats(linkStats))
+	}
+	var monitor *backpressure.Monitor
+	if cfg.Backpressure.Enabled {
+		monitor = backpressure.NewMonitor(cfg)
+		apiOpts = append(apiOpts, adapters.WithBackpressure(monitor))
+	}
+	var secondary *adapters.InMemoryURLRepository
+	if cfg.Failover.Secondary != "" {
+		secondary, err = adapters.NewSecondaryRepository(cfg.Failover.Secondary, cfg.Failover.SnapshotPath, keyring)
+		if err != nil {
+			logger.Fatal("invalid failover config", zap.Error(err))
+		}
+		failover := adapters.NewFailoverRepository(repository, secondary)
+		apiOpts = append(apiOpts, adapters.WithFailover(failover))
+		repository = failover
+	}
+	lookups := adapters.NewMetricsRepository(repository, monitor)
+	apiOpts = append(apiOpts, adapters.WithLookupMetrics(lookups))
+	repository = lookups
+	if cfg.Cache.Enabled {
+		var cacheOpts []adapters.CacheOption
+		if cfg.Cache.SoftTTL > 0 {
+			refresher, err := pools.Get("cacheWorker")
+			if err != nil {
+				logger.Fatal("stale-while-revalidate needs the cacheWorker pool", zap.Error(err))
+			}
+			cacheOpts = append(cacheOpts, adapters.WithStaleWhileRevalidate(cfg.Cache.SoftTTL, refresher))
+		}
+		if finder != nil {
+			cacheOpts = append(cacheOpts, adapters.WithCacheFindMany(finder))
+		}
+		repository = adapters.NewCachedRepository(repository, cfg.Cache.TTL, cfg.Cache.MaxEntries, cacheOpts...)
+	}
 
-	restAPI := adapters.NewRestAPI(repository, gin.Default(), cfg)
+	restAPI := adapters.NewRestAPI(repository, gin.Default(), cfg, apiOpts...)
+	if cfg.Archive.Enabled && !cfg.Server.ReadOnly {
+		err = restAPI.Scheduler().Register(
+			scheduler.Spec{Name: "archive", Interval: cfg.Archive.Interval, RequiresLeader: true},
+			task.NewArchiveJob(repository, cfg.Archive.MaxAge, cfg.Archive.IdleFor),
+		)
+		if err != nil {
+			logger.Fatal("failed to register archive job", zap.Error(err))
+		}
+	}
+	if keyring != nil && reencrypter != nil && !cfg.Server.ReadOnly {
+		err = restAPI.Scheduler().Register(
+			scheduler.Spec{Name: "reencrypt", Interval: cfg.Encryption.ReencryptInterval, RequiresLeader: true},
+			task.NewReencryptJob(reencrypter, cfg.Encryption.BatchSize),
+		)
+		if err != nil {
+			logger.Fatal("failed to register reencrypt job", zap.Error(err))
+		}
+	}
+	if cfg.LinkCheck.Enabled && linkHealth != nil && !cfg.Server.ReadOnly {
+		err = restAPI.Scheduler().Register(
+			scheduler.Spec{Name: "linkcheck", Interval: cfg.LinkCheck.Interval, RequiresLeader: true},
+			task.NewLinkCheckJob(linkHealth,
+				linkcheck.NewChecker(governor.Client(cfg.LinkCheck.Timeout), cfg.LinkCheck.MaxRedirects),
+				cfg.LinkCheck.RecheckAfter, cfg.LinkCheck.BatchSize, cfg.LinkCheck.Concurrency,
+				task.WithLinkCheckTaskGroup(tasks)),
+		)
+		if err != nil {
+			logger.Fatal("failed to register linkcheck job", zap.Error(err))
+		}
+	}
+	if reservations != nil && cfg.Reservation.CleanupInterval > 0 && !cfg.Server.ReadOnly {
+		err = restAPI.Scheduler().Register(
+			scheduler.Spec{Name: "reservations", Interval: cfg.Reservation.CleanupInterval, RequiresLeader: true},
+			task.NewReservationCleanupJob(reservations),
+		)
+		if err != nil {
+			logger.Fatal("failed to register reservations job", zap.Error(err))
+		}
+	}
+	if expiry != nil && cfg.Expiry.CleanupInterval > 0 && !cfg.Server.ReadOnly {
+		err = restAPI.Scheduler().Register(
+			scheduler.Spec{Name: "expiry", Interval: cfg.Expiry.CleanupInterval, RequiresLeader: true},
+			task.NewExpiredLinksJob(expiry),
+		)
+		if err != nil {
+			logger.Fatal("failed to register expiry job", zap.Error(err))
+		}
+	}
+	if secondary != nil && cfg.Failover.SyncInterval > 0 {
+		err = restAPI.Scheduler().Register(
+			scheduler.Spec{Name: "failover-snapshot", Interval: cfg.Failover.SyncInterval},
+			task.NewSnapshotJob(secondary),
+		)
+		if err != nil {
+			logger.Fatal("failed to register failover-snapshot job", zap.Error(err))
+		}
+	}
+	if cfg.Errors.LogInterval > 0 {
+		err = restAPI.Scheduler().Register(
+			scheduler.Spec{Name: "errorlog", Interval: cfg.Errors.LogInterval},
+			task.NewErrorLogJob(restAPI.ErrorStores()),
+		)
+		if err != nil {
+			logger.Fatal("failed to register errorlog job", zap.Error(err))
+		}
+	}
+	trustedSubnet, err := subnet.ParseSubnet(cfg.Server.TrustedSubnet)
+	if err != nil {
+		logger.Fatal("invalid trusted subnet", zap.Error(err))
+	}
+	restAPI.Engine.Use(timing.Middleware(cfg.Timing.Header, trustedSubnet, cfg.Timing.SlowRequest, logger))
 	restAPI.Engine.Use(gzip.GzipMiddleware())
 	restAPI.Engine.Use(log.LoggerMiddleware(logger))
-	run(restAPI)
+	if err := run(restAPI); err != nil {
+		logger.Fatal("serve failed", zap.Error(err))
+	}
 }
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/encryption"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+	"github.com/OrtemRepos/shortlink/internal/seed"
+)
+
+// SeedCommand is the subcommand that runs Seed.
+const SeedCommand = "seed"
+
+// sampleUsers is how many users Seed prints a token for.
+const sampleUsers = 3
+
+// Seed fills the repository of the configuration with demo data, see seed.Generate:
+//
+//	shortlink seed --users 50 --links 5000 --clicks 100000 --seed 42 [--force] [-- config flags]
+//
+// Arguments after -- are read as those of the server. A production store that holds
+// links is left alone unless --force is given. It prints a summary and tokens of a
+// few users to stdout and returns the exit code.
+func Seed(args []string, stdout, stderr io.Writer) int {
+	f := flag.NewFlagSet(SeedCommand, flag.ContinueOnError)
+	f.SetOutput(stderr)
+	var opts seed.Options
+	f.IntVar(&opts.Users, "users", 50, "Users owning the links")
+	f.IntVar(&opts.Links, "links", 5000, "Links to create")
+	f.IntVar(&opts.Clicks, "clicks", 100000, "Clicks to spread over the links")
+	f.Int64Var(&opts.Seed, "seed", 42, "Seed of the generator: the same seed gives the same data")
+	force := f.Bool("force", false, "Seed a production store even if it holds links")
+	if err := f.Parse(args); err != nil {
+		return 2
+	}
+	ds, err := seed.Generate(opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "seed: %v\n", err)
+		f.PrintDefaults()
+		return 2
+	}
+	cfg, err := configs.GetConfig(f.Args())
+	if err != nil {
+		fmt.Fprintf(stderr, "seed: %v\n", err)
+		return 2
+	}
+
+	ctx := context.Background()
+	repo, err := openRepository(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "seed: %v\n", err)
+		return 1
+	}
+	defer func() {
+		if err := repo.Close(ctx); err != nil {
+			fmt.Fprintf(stderr, "seed: close repository: %v\n", err)
+		}
+	}()
+	if err := seed.Guard(ctx, repo, cfg.Server.Environment); err != nil {
+		if !*force || !errors.Is(err, seed.ErrProductionStore) {
+			fmt.Fprintf(stderr, "seed: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(stderr, "warning: %v, seeding anyway\n", err)
+	}
+	summary, err := seed.Load(ctx, repo, ds)
+	if err != nil {
+		fmt.Fprintf(stderr, "seed: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "seed %d: %d users, %d links, %d deleted, %d flagged, %d blocked, %d clicks generated (not stored)\n",
+		opts.Seed, summary.Users, summary.Links, summary.Deleted, summary.Flagged, summary.Blocked, summary.Clicks)
+	provider, err := adapters.NewProviderJWT(cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "seed: no tokens: %v\n", err)
+		return 0
+	}
+	for _, user := range ds.Users[:min(sampleUsers, len(ds.Users))] {
+		token, err := provider.BuildJWTString(user)
+		if err != nil {
+			fmt.Fprintf(stderr, "seed: no token for %s: %v\n", user, err)
+			continue
+		}
+		fmt.Fprintf(stdout, "user %s: curl --cookie auth=%s %s/user/urls\n", user, token, cfg.Server.BaseAddress)
+	}
+	return 0
+}
+
+// openRepository opens the repository Run would serve from.
+func openRepository(ctx context.Context, cfg *configs.Config) (ports.URLRepositoryPort, error) {
+	keyring, err := encryption.FromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.UseDataBase() {
+		return adapters.NewPostgreRepository(ctx, cfg, keyring), nil
+	}
+	return adapters.NewInMemoryURLRepository(cfg.Repository.SavePath,
+		adapters.WithKeyring(keyring),
+		adapters.WithLegacyOwner(cfg.Repository.LegacyOwner))
+}
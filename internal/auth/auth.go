@@ -2,12 +2,14 @@ package auth
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
 	"github.com/OrtemRepos/shortlink/internal/logger"
 	"github.com/OrtemRepos/shortlink/internal/ports"
+	"github.com/OrtemRepos/shortlink/internal/timing"
 )
 
 var log = logger.GetLogger()
@@ -25,7 +27,9 @@ func AuthMiddleware(providerJWT ports.PortJWT) gin.HandlerFunc {
 			return
 		}
 
+		start := time.Now()
 		claims, err := CheckToken(tokenString, providerJWT)
+		timing.Record(c.Request.Context(), "auth", start)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "BAD CREND"})
 			return
@@ -0,0 +1,249 @@
+package backpressure
+
+import (
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/logger"
+)
+
+type State string
+
+const (
+	Healthy  State = "healthy"
+	Degraded State = "degraded"
+)
+
+// minSamples keeps a handful of slow calls after startup from flipping the state.
+const minSamples = 20
+
+type method struct {
+	samples  []time.Duration
+	next     int
+	count    int
+	inFlight atomic.Int64
+}
+
+func (m *method) observe(latency time.Duration) {
+	m.samples[m.next] = latency
+	m.next = (m.next + 1) % len(m.samples)
+	if m.count < len(m.samples) {
+		m.count++
+	}
+}
+
+// p95 sorts the window into scratch; callers hold the monitor lock.
+func (m *method) p95(scratch []time.Duration) time.Duration {
+	if m.count == 0 {
+		return 0
+	}
+	scratch = append(scratch[:0], m.samples[:m.count]...)
+	sort.Slice(scratch, func(i, j int) bool { return scratch[i] < scratch[j] })
+	return scratch[int(math.Ceil(0.95*float64(m.count)))-1]
+}
+
+type MethodStats struct {
+	P95      time.Duration `json:"p95"`
+	InFlight int64         `json:"in_flight"`
+	Samples  int           `json:"samples"`
+}
+
+type Stats struct {
+	State             State                  `json:"state"`
+	Since             time.Time              `json:"since"`
+	Transitions       uint64                 `json:"transitions"`
+	Shed              uint64                 `json:"shed"`
+	LatencyThreshold  time.Duration          `json:"latency_threshold"`
+	InFlightThreshold int64                  `json:"in_flight_threshold"`
+	RecoveryFactor    float64                `json:"recovery_factor"`
+	ShedFraction      float64                `json:"shed_fraction"`
+	Methods           map[string]MethodStats `json:"methods"`
+}
+
+// Monitor tracks latency and concurrency of repository calls per method and
+// derives a shared health state from them.
+// The service becomes degraded when any method exceeds a threshold and
+// recovers only once every method is below RecoveryFactor of the thresholds
+// and the cooldown has passed, so it does not flap around the limit.
+type Monitor struct {
+	latency      time.Duration
+	inFlight     int64
+	recovery     float64
+	cooldown     time.Duration
+	shedFraction float64
+	window       int
+	clock        clock.Clock
+
+	mu          sync.Mutex
+	methods     map[string]*method
+	scratch     []time.Duration
+	state       State
+	since       time.Time
+	transitions uint64
+
+	degraded atomic.Bool
+	shed     atomic.Uint64
+	log      *zap.Logger
+}
+
+type MonitorOption func(*Monitor)
+
+// WithClock sets the clock used for latencies and the cooldown; the default is the real clock.
+func WithClock(c clock.Clock) MonitorOption {
+	return func(m *Monitor) {
+		m.clock = clock.OrReal(c)
+	}
+}
+
+func NewMonitor(cfg *configs.Config, opts ...MonitorOption) *Monitor {
+	window := cfg.Backpressure.Window
+	if window <= 0 {
+		window = 200
+	}
+	m := &Monitor{
+		latency:      cfg.Backpressure.LatencyP95,
+		inFlight:     int64(cfg.Backpressure.InFlight),
+		recovery:     cfg.Backpressure.RecoveryFactor,
+		cooldown:     cfg.Backpressure.Cooldown,
+		shedFraction: cfg.Backpressure.ShedFraction,
+		window:       window,
+		methods:      make(map[string]*method),
+		scratch:      make([]time.Duration, 0, window),
+		state:        Healthy,
+		clock:        clock.Real{},
+		log:          logger.GetLogger().Named("backpressure"),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.since = m.clock.Now()
+	return m
+}
+
+func (m *Monitor) method(name string) *method {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.methodLocked(name)
+}
+
+func (m *Monitor) methodLocked(name string) *method {
+	mt, ok := m.methods[name]
+	if !ok {
+		mt = &method{samples: make([]time.Duration, m.window)}
+		m.methods[name] = mt
+	}
+	return mt
+}
+
+// Begin marks the start of a call to name; the returned func records its end.
+func (m *Monitor) Begin(name string) func() {
+	mt := m.method(name)
+	if mt.inFlight.Add(1) > m.inFlight && m.inFlight > 0 && !m.degraded.Load() {
+		m.mu.Lock()
+		m.evaluateLocked(m.clock.Now())
+		m.mu.Unlock()
+	}
+	start := m.clock.Now()
+	return func() {
+		mt.inFlight.Add(-1)
+		m.Observe(name, m.clock.Now().Sub(start))
+	}
+}
+
+// Observe records a completed call and re-evaluates the state.
+func (m *Monitor) Observe(name string, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.methodLocked(name).observe(latency)
+	m.evaluateLocked(m.clock.Now())
+}
+
+func (m *Monitor) evaluateLocked(now time.Time) {
+	exceeded, recovered := false, true
+	for _, mt := range m.methods {
+		inFlight := mt.inFlight.Load()
+		if m.inFlight > 0 {
+			exceeded = exceeded || inFlight > m.inFlight
+			recovered = recovered && float64(inFlight) <= float64(m.inFlight)*m.recovery
+		}
+		if m.latency > 0 && mt.count >= minSamples {
+			p95 := mt.p95(m.scratch)
+			exceeded = exceeded || p95 > m.latency
+			recovered = recovered && float64(p95) <= float64(m.latency)*m.recovery
+		}
+	}
+	switch {
+	case m.state == Healthy && exceeded:
+		m.transitionLocked(Degraded, now)
+	case m.state == Degraded && recovered && now.Sub(m.since) >= m.cooldown:
+		m.transitionLocked(Healthy, now)
+	}
+}
+
+func (m *Monitor) transitionLocked(state State, now time.Time) {
+	m.log.Warn("repository health changed", zap.String("from", string(m.state)), zap.String("to", string(state)))
+	m.state = state
+	m.since = now
+	m.transitions++
+	m.degraded.Store(state == Degraded)
+}
+
+func (m *Monitor) State() State {
+	if m.degraded.Load() {
+		return Degraded
+	}
+	return Healthy
+}
+
+// Shed reports whether a request should be rejected, counting it if so.
+func (m *Monitor) Shed() bool {
+	if !m.degraded.Load() || rand.Float64() >= m.shedFraction {
+		return false
+	}
+	m.shed.Add(1)
+	return true
+}
+
+func (m *Monitor) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := Stats{
+		State:             m.state,
+		Since:             m.since,
+		Transitions:       m.transitions,
+		Shed:              m.shed.Load(),
+		LatencyThreshold:  m.latency,
+		InFlightThreshold: m.inFlight,
+		RecoveryFactor:    m.recovery,
+		ShedFraction:      m.shedFraction,
+		Methods:           make(map[string]MethodStats, len(m.methods)),
+	}
+	for name, mt := range m.methods {
+		stats.Methods[name] = MethodStats{P95: mt.p95(m.scratch), InFlight: mt.inFlight.Load(), Samples: mt.count}
+	}
+	return stats
+}
+
+// Middleware rejects a share of requests with 503 while the monitor is degraded.
+func Middleware(m *Monitor, retryAfter time.Duration) gin.HandlerFunc {
+	seconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+	return func(c *gin.Context) {
+		if m.Shed() {
+			c.Header("Retry-After", seconds)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Service is degraded, retry later"})
+			return
+		}
+		c.Next()
+	}
+}
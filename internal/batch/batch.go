@@ -0,0 +1,66 @@
+// Package batch runs the groups of a batch operation concurrently.
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// GroupFunc processes the values of one group and returns how many items it affected.
+type GroupFunc func(ctx context.Context, key string, values []string) (int, error)
+
+// PerKey calls fn for every group of groups with at most limit calls in flight.
+// Groups fail independently: the result is the sum of the counts and the errors
+// of failed groups joined, each prefixed with its key. Once ctx is done no new
+// group is started; groups already running get ctx and decide themselves.
+func PerKey(ctx context.Context, groups map[string][]string, limit int, fn GroupFunc) (int, error) {
+	if limit <= 0 {
+		limit = 1
+	}
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total int
+		errs  []error
+	)
+	sem := make(chan struct{}, limit)
+	record := func(n int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		total += n
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	stopped := false
+	for key, values := range groups {
+		select {
+		case <-ctx.Done():
+			stopped = true
+		case sem <- struct{}{}:
+			// sem and ctx may both be ready; do not start a group after ctx is done.
+			if ctx.Err() != nil {
+				<-sem
+				stopped = true
+			}
+		}
+		if stopped {
+			record(0, fmt.Errorf("groups not started: %w", ctx.Err()))
+			break
+		}
+		wg.Add(1)
+		go func(key string, values []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			n, err := fn(ctx, key, values)
+			if err != nil {
+				err = fmt.Errorf("%s: %w", key, err)
+			}
+			record(n, err)
+		}(key, values)
+	}
+	wg.Wait()
+	return total, errors.Join(errs...)
+}
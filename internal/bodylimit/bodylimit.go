@@ -0,0 +1,39 @@
+// Package bodylimit bounds the size of request bodies.
+package bodylimit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware answers 413 to requests declaring a body of more than limit bytes,
+// and makes reading past limit fail for the others, see Exceeded.
+func Middleware(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			Abort(c, limit)
+			return
+		}
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+		c.Next()
+	}
+}
+
+// Exceeded reports whether err comes from reading a body past the limit of Middleware.
+func Exceeded(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
+
+// Abort answers 413 for a body over limit bytes.
+func Abort(c *gin.Context, limit int64) {
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error":   "413 Request Entity Too Large",
+		"message": fmt.Sprintf("request body is larger than %d bytes", limit),
+	})
+}
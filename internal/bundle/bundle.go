@@ -0,0 +1,83 @@
+package bundle
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Version is the bundle format written by New.
+const Version = 1
+
+var ErrInvalidSignature = errors.New("bundle signature does not match")
+var ErrUnsupportedVersion = errors.New("unsupported bundle version")
+
+// Link is one link of a bundle; its short code is kept on import when free.
+type Link struct {
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+}
+
+// Bundle moves the links of a user between environments. Signature is the
+// hex HMAC-SHA256 of the other fields under the secret of the exporting server.
+type Bundle struct {
+	Version     int       `json:"version"`
+	Environment string    `json:"environment"`
+	UserID      string    `json:"user_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Links       []Link    `json:"links"`
+	Signature   string    `json:"signature"`
+}
+
+// New returns a bundle of links signed with secret.
+func New(environment, userID string, createdAt time.Time, links []Link, secret []byte) (Bundle, error) {
+	b := Bundle{
+		Version:     Version,
+		Environment: environment,
+		UserID:      userID,
+		CreatedAt:   createdAt.UTC(),
+		Links:       links,
+	}
+	mac, err := b.mac(secret)
+	if err != nil {
+		return Bundle{}, err
+	}
+	b.Signature = hex.EncodeToString(mac)
+	return b, nil
+}
+
+// Verify checks the version of b and that it was signed with secret.
+func (b Bundle) Verify(secret []byte) error {
+	if b.Version != Version {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, b.Version)
+	}
+	signature, err := hex.DecodeString(b.Signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	mac, err := b.mac(secret)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(signature, mac) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// mac signs the JSON encoding of b without its signature; encoding/json writes
+// struct fields in declaration order, so both sides get the same bytes.
+func (b Bundle) mac(secret []byte) ([]byte, error) {
+	b.Signature = ""
+	payload, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha256.New, secret)
+	h.Write(payload)
+	return h.Sum(nil), nil
+}
@@ -16,6 +16,10 @@ func GetConnection(cfg *configs.Config) *sqlx.DB {
 	}
 	credential := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.Dbname)
+	if cfg.Server.ReadOnly {
+		// Replica connections refuse writes even if a code path forgets the read-only mode.
+		credential += " default_transaction_read_only=on"
+	}
 
 	var err error
 	db, err = sqlx.Open("pgx", credential)
@@ -0,0 +1,81 @@
+package cors
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/OrtemRepos/shortlink/configs"
+)
+
+// Enabled reports whether the config allows any origin.
+func Enabled(cfg *configs.Config) bool {
+	return len(split(cfg.CORS.AllowedOrigins)) > 0
+}
+
+// Middleware sets the CORS headers on every response to an allowed origin before
+// the handlers run, so rejections by later middleware, such as a 401 or a 429,
+// stay readable by browser scripts. Preflights are answered with 204 and not
+// passed on, so they need no auth cookie. Requests from other origins get no
+// CORS headers and are left to the browser to block. With credentials, * matches
+// no origin: configs.Config.Validate refuses it, as it would let any site act
+// with the auth cookie of its visitors.
+func Middleware(cfg *configs.Config) gin.HandlerFunc {
+	origins := split(cfg.CORS.AllowedOrigins)
+	credentials := cfg.CORS.AllowCredentials
+	anyOrigin := slices.Contains(origins, "*") && !credentials
+	methods := strings.Join(split(cfg.CORS.AllowedMethods), ", ")
+	exposed := strings.Join(split(cfg.CORS.ExposedHeaders), ", ")
+	headers := strings.Join(split(cfg.CORS.AllowedHeaders), ", ")
+	maxAge := strconv.Itoa(int(cfg.CORS.MaxAge.Seconds()))
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+		if !anyOrigin && !slices.Contains(origins, origin) {
+			c.Next()
+			return
+		}
+		if anyOrigin {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if credentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			header.Set("Access-Control-Allow-Methods", methods)
+			if headers != "" {
+				header.Set("Access-Control-Allow-Headers", headers)
+			}
+			if cfg.CORS.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		if exposed != "" {
+			header.Set("Access-Control-Expose-Headers", exposed)
+		}
+		c.Next()
+	}
+}
+
+// split returns the non-empty items of a comma separated list.
+func split(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,36 @@
+// Package debug serves the runtime profiles of net/http/pprof and the variables
+// of expvar, to diagnose a running instance without rebuilding it.
+package debug
+
+import (
+	"expvar"
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Register serves the pprof index and profiles under pprof/ and expvar at vars,
+// relative to routes, which is meant to be mounted at /debug: the pprof index
+// links to its profiles by their /debug/pprof/ paths.
+func Register(routes gin.IRoutes) {
+	routes.GET("/pprof/*profile", profile)
+	// pprof resolves symbols posted in the body too.
+	routes.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	routes.GET("/vars", gin.WrapH(expvar.Handler()))
+}
+
+// profile serves the profiles pprof.Index does not, and the index for the rest.
+func profile(c *gin.Context) {
+	switch c.Param("profile") {
+	case "/cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "/profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "/symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "/trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Index(c.Writer, c.Request)
+	}
+}
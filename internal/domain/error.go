@@ -4,3 +4,14 @@ import "errors"
 
 var ErrURLNotFound = errors.New("URL not found")
 var ErrURLAlreadyExists = errors.New("URL already exists")
+var ErrShortURLTaken = errors.New("short URL already taken")
+var ErrShortURLRequired = errors.New("short URL required")
+var ErrOwnerRequired = errors.New("URL must have a real owner")
+var ErrCodeReserved = errors.New("short URL reserved")
+var ErrReservationNotFound = errors.New("reservation not found")
+var ErrNotReservationOwner = errors.New("reservation belongs to another user")
+var ErrInvalidShortCode = errors.New("invalid short code")
+var ErrInvalidURL = errors.New("invalid URL")
+var ErrInvalidExpiry = errors.New("invalid expiry")
+var ErrInvalidModeration = errors.New("invalid moderation")
+var ErrModerationTransition = errors.New("moderation status cannot change this way")
@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidFilter = errors.New("invalid URL filter")
+
+// hostnamePattern accepts dot-separated labels of letters, digits and hyphens.
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// URLFilter selects links by destination: exactly one of HostSuffix, a host and
+// its subdomains, and URLPrefix, a literal http(s) URL prefix, must be set.
+type URLFilter struct {
+	HostSuffix string `json:"host_suffix" form:"host_suffix"`
+	URLPrefix  string `json:"url_prefix" form:"url_prefix"`
+}
+
+// Normalize validates the filter and lowercases its host.
+func (f *URLFilter) Normalize() error {
+	if (f.HostSuffix == "") == (f.URLPrefix == "") {
+		return fmt.Errorf("%w: exactly one of host_suffix and url_prefix is required", ErrInvalidFilter)
+	}
+	if f.HostSuffix != "" {
+		f.HostSuffix = strings.TrimSuffix(strings.ToLower(f.HostSuffix), ".")
+		if !hostnamePattern.MatchString(f.HostSuffix) {
+			return fmt.Errorf("%w: host_suffix must be a host name", ErrInvalidFilter)
+		}
+		return nil
+	}
+	prefix, ok := NormalizeURL(f.URLPrefix)
+	if !ok {
+		return fmt.Errorf("%w: url_prefix must be an http or https URL with a host", ErrInvalidFilter)
+	}
+	f.URLPrefix = prefix
+	return nil
+}
+
+// ReversedHost returns the host of the filter in the form of ReversedHost;
+// links matching the filter have a reversed host starting with it.
+func (f URLFilter) ReversedHost() string {
+	if f.HostSuffix != "" {
+		return reverseHost(f.HostSuffix)
+	}
+	return ReversedHost(f.URLPrefix)
+}
+
+// Exact reports whether matching links have exactly the reversed host of the filter.
+func (f URLFilter) Exact() bool {
+	return f.URLPrefix != ""
+}
+
+// Matches reports whether a link to originalURL matches the normalized filter.
+func (f URLFilter) Matches(originalURL string) bool {
+	if f.HostSuffix != "" {
+		host := ReversedHost(originalURL)
+		return host != "" && strings.HasPrefix(host, f.ReversedHost())
+	}
+	normalized, ok := NormalizeURL(originalURL)
+	return ok && strings.HasPrefix(normalized, f.URLPrefix)
+}
+
+// NormalizeURL lowercases the scheme and host of an http(s) URL.
+func NormalizeURL(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return "", false
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false
+	}
+	u.Host = strings.ToLower(u.Host)
+	return u.String(), true
+}
+
+// ReversedHost returns the labels of the host of rawURL in reverse order, each
+// followed by a dot: "https://a.Example.com/x" gives "com.example.a.".
+// A host suffix then matches a prefix of the reversed host, which an index can serve.
+// It returns "" if rawURL has no host.
+func ReversedHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	return reverseHost(strings.TrimSuffix(strings.ToLower(u.Hostname()), "."))
+}
+
+func reverseHost(host string) string {
+	labels := strings.Split(host, ".")
+	slices.Reverse(labels)
+	return strings.Join(labels, ".") + "."
+}
@@ -0,0 +1,107 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// ModerationStatus is where a link stands with moderation. Links never moderated are clean.
+type ModerationStatus string
+
+const (
+	ModerationClean   ModerationStatus = "clean"
+	ModerationFlagged ModerationStatus = "flagged"
+	ModerationBlocked ModerationStatus = "blocked"
+	ModerationCleared ModerationStatus = "cleared"
+)
+
+// moderationTransitions lists the statuses each status may move to. Clean is never
+// returned to: cleared records that the link was reviewed.
+var moderationTransitions = map[ModerationStatus][]ModerationStatus{
+	ModerationClean:   {ModerationFlagged, ModerationBlocked},
+	ModerationFlagged: {ModerationBlocked, ModerationCleared},
+	ModerationBlocked: {ModerationCleared},
+	ModerationCleared: {ModerationFlagged, ModerationBlocked},
+}
+
+// CanBecome reports whether a link in status s may be moved to next.
+func (s ModerationStatus) CanBecome(next ModerationStatus) bool {
+	for _, allowed := range moderationTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Restricted reports whether owners are told their link is held for policy reasons.
+func (s ModerationStatus) Restricted() bool {
+	return s == ModerationFlagged || s == ModerationBlocked
+}
+
+// ModerationReason says what led to a moderation decision.
+type ModerationReason string
+
+const (
+	ReasonBlocklist   ModerationReason = "blocklist"
+	ReasonAbuseReport ModerationReason = "abuse_report"
+	ReasonAdminReview ModerationReason = "admin_review"
+)
+
+// MaxModerationNote bounds the free-text note of a decision, in bytes.
+const MaxModerationNote = 1000
+
+// PolicyNotice is all owners see of the moderation of a restricted link.
+const PolicyNotice = "flagged for policy reasons"
+
+// Moderation is a decision on a link: its new status, why, by whom and when.
+type Moderation struct {
+	Status ModerationStatus `json:"status"`
+	Reason ModerationReason `json:"reason,omitempty"`
+	Note   string           `json:"note,omitempty"`
+	Actor  string           `json:"actor,omitempty"`
+	At     time.Time        `json:"at,omitempty"`
+}
+
+// Validate checks a decision before it is applied; At is set by the repository.
+func (m Moderation) Validate() error {
+	if _, ok := moderationTransitions[m.Status]; !ok || m.Status == ModerationClean {
+		return fmt.Errorf("%w: status must be flagged, blocked or cleared", ErrInvalidModeration)
+	}
+	switch m.Reason {
+	case ReasonBlocklist, ReasonAbuseReport, ReasonAdminReview:
+	default:
+		return fmt.Errorf("%w: reason must be blocklist, abuse_report or admin_review", ErrInvalidModeration)
+	}
+	if m.Actor == "" {
+		return fmt.Errorf("%w: actor is required", ErrInvalidModeration)
+	}
+	if len(m.Note) > MaxModerationNote {
+		return fmt.Errorf("%w: note is longer than %d bytes", ErrInvalidModeration, MaxModerationNote)
+	}
+	return nil
+}
+
+// CheckModeration validates next and that a link in status current may take it.
+func CheckModeration(current ModerationStatus, next Moderation) error {
+	if err := next.Validate(); err != nil {
+		return err
+	}
+	if !current.CanBecome(next.Status) {
+		return fmt.Errorf("%w: %s to %s", ErrModerationTransition, current, next.Status)
+	}
+	return nil
+}
+
+// ModerationEvent is one applied decision of the audit log of a link.
+type ModerationEvent struct {
+	From ModerationStatus `json:"from"`
+	Moderation
+}
+
+// ModeratedLink is a link with its current moderation, as listed to admins.
+type ModeratedLink struct {
+	ShortURL   string     `json:"shortURL"`
+	UserID     string     `json:"user_id"`
+	Moderation Moderation `json:"moderation"`
+}
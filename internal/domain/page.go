@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrQueryUnsupported is returned by repositories that cannot search the original
+// URLs they store, such as those encrypting them.
+var ErrQueryUnsupported = errors.New("searching links is not supported by this storage")
+
+// LinkSort is the order links of a user are listed in.
+type LinkSort string
+
+const (
+	// SortByCreated lists links by creation time, then short code; it is the default.
+	SortByCreated  LinkSort = "created_at"
+	SortByShortURL LinkSort = "short_url"
+)
+
+// Valid reports whether s is SortByCreated or SortByShortURL.
+func (s LinkSort) Valid() bool {
+	return s == SortByCreated || s == SortByShortURL
+}
+
+// LinkCursor is a position in the links of a user listed in the order Sort, empty
+// for SortByCreated: the sort key of the last link of a page.
+type LinkCursor struct {
+	CreatedAt time.Time
+	ShortURL  string
+	Sort      LinkSort
+}
+
+// CursorOf returns the position right after url in a listing in the order sort.
+// Positions by creation leave Sort empty, like the cursors issued before links
+// could be sorted otherwise.
+func CursorOf(url URL, sort LinkSort) LinkCursor {
+	if sort == SortByCreated {
+		sort = ""
+	}
+	return LinkCursor{CreatedAt: url.CreatedAt, ShortURL: url.ShortURL, Sort: sort}
+}
+
+// Precedes reports whether url is listed after the position c.
+func (c LinkCursor) Precedes(url URL) bool {
+	if c.Sort == SortByShortURL || url.CreatedAt.Equal(c.CreatedAt) {
+		return url.ShortURL > c.ShortURL
+	}
+	return url.CreatedAt.After(c.CreatedAt)
+}
+
+// LinkPage selects up to Limit links of a listing in the order Sort: those after
+// After when it is set, otherwise those after the first Offset ones. Links created
+// while a client pages with After by creation come last, so they neither shift nor
+// repeat earlier pages.
+type LinkPage struct {
+	After  *LinkCursor
+	Offset int
+	Limit  int
+	Sort   LinkSort
+	// Query keeps only the links whose original URL contains it, in any case.
+	Query string
+}
+
+// Matches reports whether url is kept by the Query of p.
+func (p LinkPage) Matches(url URL) bool {
+	return strings.Contains(strings.ToLower(url.OriginalURL), strings.ToLower(p.Query))
+}
@@ -0,0 +1,37 @@
+package domain
+
+import "errors"
+
+var ErrInvalidPrivacy = errors.New("invalid privacy mode")
+
+// Privacy is what a redirect hides from the destination about where visitors come from.
+type Privacy string
+
+const (
+	// PrivacyDefault leaves the choice to the Redirect.Privacy setting.
+	PrivacyDefault Privacy = ""
+	// PrivacyOff redirects plainly: browsers send their usual Referer.
+	PrivacyOff Privacy = "off"
+	// PrivacyNoReferrer redirects with Referrer-Policy: no-referrer.
+	PrivacyNoReferrer Privacy = "no-referrer"
+	// PrivacyDereferer serves a page that sends the visitor on without a referrer,
+	// for browsers ignoring the policy of a redirect.
+	PrivacyDereferer Privacy = "dereferer"
+)
+
+// Valid reports whether p is one of the privacy modes.
+func (p Privacy) Valid() bool {
+	switch p {
+	case PrivacyDefault, PrivacyOff, PrivacyNoReferrer, PrivacyDereferer:
+		return true
+	}
+	return false
+}
+
+// Or returns p, or fallback when p leaves the choice to the default.
+func (p Privacy) Or(fallback Privacy) Privacy {
+	if p == PrivacyDefault {
+		return fallback
+	}
+	return p
+}
@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Bounds of a short code chosen by a user rather than generated.
+const (
+	MinShortCodeLength = 3
+	MaxShortCodeLength = 32
+)
+
+// Reservation holds a short code for a user until the destination is known.
+type Reservation struct {
+	ShortURL  string    `json:"shortURL" db:"short_url"`
+	UserID    string    `json:"-" db:"user_id"`
+	ExpiresAt time.Time `json:"expires_at" db:"reserved_until"`
+}
+
+// Active reports whether the reservation still holds its code at now.
+func (r Reservation) Active(now time.Time) bool {
+	return now.Before(r.ExpiresAt)
+}
+
+// ReservedPaths are the first path segments the service serves itself. Short links
+// are served at the root, next to them, so no code may take one of their names.
+var ReservedPaths = []string{"api", "debug", "login", "metrics", "ping", "readyz"}
+
+// IsReservedPath reports whether code is one of ReservedPaths, in any case.
+func IsReservedPath(code string) bool {
+	for _, path := range ReservedPaths {
+		if strings.EqualFold(code, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateShortCode checks a code chosen by a user: MinShortCodeLength to
+// MaxShortCodeLength letters, digits, '-' or '_', and none of ReservedPaths.
+func ValidateShortCode(code string) error {
+	if len(code) < MinShortCodeLength || len(code) > MaxShortCodeLength {
+		return fmt.Errorf("%w: length must be %d to %d", ErrInvalidShortCode, MinShortCodeLength, MaxShortCodeLength)
+	}
+	if IsReservedPath(code) {
+		return fmt.Errorf("%w: %q is a path of the service", ErrInvalidShortCode, code)
+	}
+	for _, c := range code {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return fmt.Errorf("%w: unexpected %q", ErrInvalidShortCode, c)
+		}
+	}
+	return nil
+}
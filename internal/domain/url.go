@@ -4,18 +4,72 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"log"
 	"math/big"
+	"net"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const maxInt64 = 1<<63 - 1
 
+// LegacyOwner owns links saved before links had owners, until a user claims them.
+const LegacyOwner = "00000000-0000-0000-0000-000000000000"
+
 type URL struct {
-	UUID        string `json:"-" db:"user_id"`
-	ShortURL    string `json:"shortURL" db:"short_url"`
-	OriginalURL string `json:"longURL" db:"original_url"`
-	DeletedFlag bool   `json:"-" db:"is_deleted"`
+	UUID        string    `json:"-" db:"user_id"`
+	ShortURL    string    `json:"shortURL" db:"short_url"`
+	OriginalURL string    `json:"longURL" db:"original_url"`
+	DeletedFlag bool      `json:"-" db:"is_deleted"`
+	CreatedAt   time.Time `json:"-" db:"created_at"`
+	Archived    bool      `json:"archived,omitempty" db:"archived"`
+
+	LastCheckedAt *time.Time `json:"last_checked_at,omitempty" db:"last_checked_at"`
+	LastStatus    string     `json:"last_status,omitempty" db:"last_status"`
+	Health        string     `json:"health,omitempty" db:"-"`
+
+	// Moderation is the moderation status, empty for links never moderated;
+	// owners only see Policy, set from it when the link is restricted.
+	Moderation ModerationStatus `json:"-" db:"moderation_status"`
+	Policy     string           `json:"policy,omitempty" db:"-"`
+
+	// Privacy overrides the privacy of redirects set in the configuration.
+	Privacy Privacy `json:"privacy,omitempty" db:"privacy"`
+
+	// ExpiresAt is when the link stops redirecting, nil for links that never expire.
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+
+	// Alias is the short code a user asked for instead of a generated one, see
+	// ValidateShortCode. Repositories save the link under ShortURL, set from it.
+	Alias string `json:"alias,omitempty" db:"-"`
+
+	// Degraded is set on links served by a secondary repository while the primary
+	// was unreachable; they may be out of date.
+	Degraded bool `json:"-" db:"-"`
+}
+
+// LinkStats counts the redirects served by a link.
+type LinkStats struct {
+	ShortURL      string     `json:"shortURL" db:"short_url"`
+	Visits        int64      `json:"visits" db:"visits"`
+	LastVisitedAt *time.Time `json:"last_visited_at,omitempty" db:"last_visited_at"`
+}
+
+// Stats counts the live links of a repository, archived ones included, and the
+// users owning them. Reservations and deleted links are left out.
+type Stats struct {
+	URLs  int `json:"urls" db:"urls"`
+	Users int `json:"users" db:"users"`
+}
+
+// LinkCheck is the outcome of checking the destination of a link.
+type LinkCheck struct {
+	ShortURL  string
+	CheckedAt time.Time
+	Status    string
 }
 
 func (u *URL) GenerateShortURL() string {
@@ -30,6 +84,61 @@ func (u *URL) GenerateShortURL() string {
 	return u.ShortURL
 }
 
+// DefaultMaxURLLength bounds the original URLs ValidateURL accepts when given no bound.
+const DefaultMaxURLLength = 2048
+
+// defaultPorts are the ports ValidateURL drops, by scheme.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// ValidateURL checks raw is fit to be the destination of a link, an absolute http or
+// https URL with a host and no userinfo of at most maxLength bytes, DefaultMaxURLLength
+// if maxLength is not positive, and returns it normalized: scheme and host lowercased,
+// the default port of the scheme and the fragment dropped, and an empty path made "/",
+// so that the spellings of one destination get one short code.
+// Otherwise the error wraps ErrInvalidURL.
+func ValidateURL(raw string, maxLength int) (string, error) {
+	if maxLength <= 0 {
+		maxLength = DefaultMaxURLLength
+	}
+	if len(raw) > maxLength {
+		return "", fmt.Errorf("%w: longer than %d bytes", ErrInvalidURL, maxLength)
+	}
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidURL, strings.TrimPrefix(err.Error(), "parse "))
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := defaultPorts[u.Scheme]; !ok {
+		return "", fmt.Errorf("%w: must be an absolute http or https URL", ErrInvalidURL)
+	}
+	if u.Opaque != "" || u.Hostname() == "" {
+		return "", fmt.Errorf("%w: must have a host", ErrInvalidURL)
+	}
+	if u.User != nil {
+		return "", fmt.Errorf("%w: must not have a user name or password", ErrInvalidURL)
+	}
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	if port != "" || strings.Contains(host, ":") {
+		// JoinHostPort puts an IPv6 address back in brackets.
+		u.Host = strings.TrimSuffix(net.JoinHostPort(host, port), ":")
+	} else {
+		u.Host = host
+	}
+	u.Fragment, u.RawFragment = "", ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String(), nil
+}
+
+// Expired reports whether the link has expired at now.
+func (u *URL) Expired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
+}
+
 func NewURL(longURL string) *URL {
 	return &URL{
 		OriginalURL: longURL,
@@ -0,0 +1,157 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/OrtemRepos/shortlink/configs"
+)
+
+// Encrypted values look like "enc:v1:<key id>:<base64 nonce+ciphertext>".
+// Values without the prefix are legacy plaintext and are returned unchanged by Decrypt.
+const prefix = "enc:v1:"
+
+const (
+	keySize      = 32 // AES-256
+	indexKeySize = 32
+)
+
+var ErrNoKeys = errors.New("encryption enabled but no keys configured")
+var ErrUnknownKey = errors.New("value encrypted with unknown key")
+var ErrMalformed = errors.New("malformed encrypted value")
+
+var keyIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Keyring encrypts values with its primary key and decrypts with any key it holds,
+// so keys can be rotated by adding a new primary and re-encrypting.
+type Keyring struct {
+	primary  string
+	aeads    map[string]cipher.AEAD
+	indexKey []byte
+}
+
+// NewKeyring builds a keyring from raw keys by id; primary must be one of them.
+func NewKeyring(keys map[string][]byte, primary string, indexKey []byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	if len(indexKey) < indexKeySize {
+		return nil, fmt.Errorf("blind index key must be at least %d bytes", indexKeySize)
+	}
+	k := &Keyring{
+		primary:  primary,
+		aeads:    make(map[string]cipher.AEAD, len(keys)),
+		indexKey: indexKey,
+	}
+	for id, key := range keys {
+		if !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("key %q must be %d bytes, got %d", id, keySize, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[id] = aead
+	}
+	if _, ok := k.aeads[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q is not in the keyring", primary)
+	}
+	return k, nil
+}
+
+// FromConfig returns nil when encryption is disabled and an error when it is
+// enabled without usable keys.
+// Keys are configured as "id:base64key" pairs separated by commas.
+func FromConfig(cfg *configs.Config) (*Keyring, error) {
+	if !cfg.Encryption.Enabled {
+		return nil, nil
+	}
+	if strings.TrimSpace(cfg.Encryption.Keys) == "" {
+		return nil, ErrNoKeys
+	}
+	keys := make(map[string][]byte)
+	for _, pair := range strings.Split(cfg.Encryption.Keys, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("key entry must be id:base64key")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		keys[id] = key
+	}
+	indexKey, err := base64.StdEncoding.DecodeString(cfg.Encryption.IndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("blind index key: %w", err)
+	}
+	return NewKeyring(keys, cfg.Encryption.PrimaryKeyID, indexKey)
+}
+
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	aead := k.aeads[k.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(k.primary))
+	return prefix + k.primary + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, prefix) {
+		return value, nil
+	}
+	id, encoded, ok := strings.Cut(value[len(prefix):], ":")
+	if !ok {
+		return "", ErrMalformed
+	}
+	aead, ok := k.aeads[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrMalformed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	return string(plaintext), nil
+}
+
+// BlindIndex returns a deterministic keyed digest of plaintext, usable for
+// equality lookups without storing the plaintext.
+func (k *Keyring) BlindIndex(plaintext string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(plaintext))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Current reports whether value is encrypted with the primary key.
+func (k *Keyring) Current(value string) bool {
+	return strings.HasPrefix(value, k.CurrentPrefix())
+}
+
+// CurrentPrefix is the prefix shared by every value encrypted with the primary key.
+func (k *Keyring) CurrentPrefix() string {
+	return prefix + k.primary + ":"
+}
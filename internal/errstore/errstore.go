@@ -0,0 +1,154 @@
+package errstore
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+)
+
+// Entry is an error with the time it was added.
+type Entry struct {
+	Err   error     `json:"-"`
+	Error string    `json:"error"`
+	At    time.Time `json:"at"`
+}
+
+// Group counts entries with the same error string.
+type Group struct {
+	Error string    `json:"error"`
+	Count int       `json:"count"`
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+}
+
+// Store keeps the last errors of a component in a ring: once full, an added
+// error replaces the oldest one, so memory stays bounded however long nobody reads it.
+type Store struct {
+	mu        sync.Mutex
+	entries   []Entry
+	next      int
+	total     int64
+	dropped   int64
+	collected int64
+	clock     clock.Clock
+}
+
+// NewStore returns a store keeping the last capacity errors, timed by c.
+func NewStore(capacity int, c clock.Clock) *Store {
+	if capacity <= 0 {
+		panic("capacity must be greater than 0")
+	}
+	return &Store{entries: make([]Entry, 0, capacity), clock: clock.OrReal(c)}
+}
+
+// Add records err, dropping the oldest error if the store is full.
+func (s *Store) Add(err error) {
+	entry := Entry{Err: err, Error: err.Error(), At: s.clock.Now()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total++
+	if len(s.entries) < cap(s.entries) {
+		s.entries = append(s.entries, entry)
+		return
+	}
+	s.entries[s.next] = entry
+	s.dropped++
+	s.next = (s.next + 1) % len(s.entries)
+}
+
+// Total returns the number of errors ever added, dropped ones included.
+func (s *Store) Total() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
+
+// Dropped returns the number of errors replaced by newer ones before anyone drained them.
+func (s *Store) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Capacity returns how many errors the store keeps.
+func (s *Store) Capacity() int {
+	return cap(s.entries)
+}
+
+// Recent returns the kept errors, oldest first.
+func (s *Store) Recent() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastLocked(len(s.entries))
+}
+
+// Drain returns the kept errors, oldest first, and forgets them.
+func (s *Store) Drain() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := s.lastLocked(len(s.entries))
+	s.entries = s.entries[:0]
+	s.next = 0
+	s.collected = s.total
+	return entries
+}
+
+// Collect returns the errors added since the last Collect or Drain, oldest first,
+// and how many of them were dropped before being collected. Unlike Drain it
+// keeps the errors for Recent.
+func (s *Store) Collect() (entries []Entry, missed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := s.total - s.collected
+	kept := min(pending, int64(len(s.entries)))
+	s.collected = s.total
+	return s.lastLocked(int(kept)), pending - kept
+}
+
+// lastLocked returns the n newest kept errors, oldest first.
+func (s *Store) lastLocked(n int) []Entry {
+	ordered := make([]Entry, 0, len(s.entries))
+	ordered = append(ordered, s.entries[s.next:]...)
+	ordered = append(ordered, s.entries[:s.next]...)
+	return ordered[len(ordered)-n:]
+}
+
+// GroupByError counts entries by error string, most frequent first.
+func GroupByError(entries []Entry) []Group {
+	index := make(map[string]int)
+	var groups []Group
+	for _, e := range entries {
+		i, ok := index[e.Error]
+		if !ok {
+			i = len(groups)
+			index[e.Error] = i
+			groups = append(groups, Group{Error: e.Error, First: e.At})
+		}
+		groups[i].Count++
+		if e.At.Before(groups[i].First) {
+			groups[i].First = e.At
+		}
+		if e.At.After(groups[i].Last) {
+			groups[i].Last = e.At
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Error < groups[j].Error
+	})
+	return groups
+}
+
+// Join joins the errors of entries, nil if there are none.
+func Join(entries []Entry) error {
+	errs := make([]error, len(entries))
+	for i, e := range entries {
+		errs[i] = e.Err
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,80 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/logger"
+)
+
+const (
+	PersistFailed = "shorten.persist_failed"
+	UsersMerged   = "users.merged"
+	LegacyClaimed = "links.legacy_claimed"
+	LinksImported = "links.imported"
+	QuotaWarning  = "quota.warning"
+	WebhookTest   = "webhook.test"
+)
+
+type Event struct {
+	Type   string            `json:"type"`
+	At     time.Time         `json:"at"`
+	UserID string            `json:"user_id,omitempty"`
+	Attrs  map[string]string `json:"attrs,omitempty"`
+}
+
+type Handler func(Event)
+
+// Bus delivers events synchronously to every subscriber.
+// A panicking subscriber is logged and does not affect the others.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+	log      *zap.Logger
+}
+
+func NewBus() *Bus {
+	return &Bus{log: logger.GetLogger().Named("events")}
+}
+
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, h)
+}
+
+func (b *Bus) Publish(e Event) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+	for _, h := range handlers {
+		b.deliver(h, e)
+	}
+}
+
+func (b *Bus) deliver(h Handler, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.log.Error("event handler panic", zap.String("type", e.Type), zap.Any("recovered", r))
+		}
+	}()
+	h(e)
+}
+
+// AuditLog returns a Handler writing every event as an audit record.
+func AuditLog(log *zap.Logger) Handler {
+	log = log.Named("audit")
+	return func(e Event) {
+		log.Info("audit",
+			zap.String("type", e.Type),
+			zap.Time("at", e.At),
+			zap.String("user_id", e.UserID),
+			zap.Any("attrs", e.Attrs),
+		)
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"net/http"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/OrtemRepos/shortlink/internal/timing"
 )
 
 var AllowedContentTypes = []string{"text/html", "application/json"}
@@ -59,6 +62,7 @@ func GzipMiddleware() gin.HandlerFunc {
 			c.Header("Vary", "Accept-Encoding")
 			c.Header("Content-Length", "")
 
+			defer timing.Record(c.Request.Context(), "gzip", time.Now())
 			gw, err := gzip.NewWriterLevel(originalWriter, gzip.BestSpeed)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
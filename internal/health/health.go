@@ -0,0 +1,193 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrCheckExists = errors.New("health check already registered")
+var ErrInvalidCheck = errors.New("invalid health check")
+
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusFailed  Status = "failed"
+	StatusTimeout Status = "timeout"
+)
+
+// Check probes one dependency. Probe should respect ctx; the result is
+// reported as a timeout once Timeout passes either way.
+type Check struct {
+	Name     string
+	Timeout  time.Duration
+	Critical bool
+	Probe    func(ctx context.Context) error
+}
+
+type Result struct {
+	Name     string        `json:"name"`
+	Status   Status        `json:"status"`
+	Critical bool          `json:"critical"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Report is the readiness of the service. Draining is set by the server once it
+// shuts down; the report is then not ready whatever the checks say.
+type Report struct {
+	Ready     bool      `json:"ready"`
+	Draining  bool      `json:"draining,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	Checks    []Result  `json:"checks"`
+}
+
+// Redacted drops error messages, which may describe the infrastructure.
+func (r Report) Redacted() Report {
+	checks := make([]Result, len(r.Checks))
+	for i, c := range r.Checks {
+		c.Error = ""
+		checks[i] = c
+	}
+	r.Checks = checks
+	return r
+}
+
+// Transition is a change of status of one check.
+type Transition struct {
+	Name  string    `json:"name"`
+	From  Status    `json:"from"`
+	To    Status    `json:"to"`
+	At    time.Time `json:"at"`
+	Error string    `json:"error,omitempty"`
+}
+
+// Registry runs the registered checks concurrently within an overall budget.
+// Reports are cached for cacheTTL so probe storms do not reach the dependencies.
+// Critical checks decide readiness; the others only annotate the report.
+type Registry struct {
+	budget      time.Duration
+	cacheTTL    time.Duration
+	historySize int
+
+	mu      sync.Mutex
+	checks  []Check
+	last    map[string]Status
+	history []Transition
+
+	refresh sync.Mutex
+	cached  *Report
+}
+
+func NewRegistry(budget, cacheTTL time.Duration, historySize int) *Registry {
+	return &Registry{
+		budget:      budget,
+		cacheTTL:    cacheTTL,
+		historySize: historySize,
+		last:        make(map[string]Status),
+	}
+}
+
+func (r *Registry) Register(check Check) error {
+	if check.Name == "" || check.Probe == nil || check.Timeout <= 0 {
+		return fmt.Errorf("%w: name, probe and timeout are required", ErrInvalidCheck)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.checks {
+		if c.Name == check.Name {
+			return fmt.Errorf("%w: %s", ErrCheckExists, check.Name)
+		}
+	}
+	r.checks = append(r.checks, check)
+	return nil
+}
+
+// Check returns the cached report or runs every check.
+// Concurrent callers wait for a single run instead of starting their own.
+func (r *Registry) Check(ctx context.Context) Report {
+	r.refresh.Lock()
+	defer r.refresh.Unlock()
+	if r.cached != nil && time.Since(r.cached.CheckedAt) < r.cacheTTL {
+		return *r.cached
+	}
+	report := r.run(ctx)
+	r.cached = &report
+	return report
+}
+
+func (r *Registry) run(ctx context.Context) Report {
+	r.mu.Lock()
+	checks := append([]Check(nil), r.checks...)
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, r.budget)
+	defer cancel()
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Ready: true, CheckedAt: time.Now(), Checks: results}
+	for _, res := range results {
+		if res.Critical && res.Status != StatusOK {
+			report.Ready = false
+		}
+	}
+	sort.Slice(report.Checks, func(i, j int) bool { return report.Checks[i].Name < report.Checks[j].Name })
+	r.recordTransitions(report)
+	return report
+}
+
+func runCheck(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check.Probe(ctx) }()
+
+	res := Result{Name: check.Name, Critical: check.Critical, Status: StatusOK}
+	select {
+	case err := <-done:
+		if err != nil {
+			res.Status, res.Error = StatusFailed, err.Error()
+		}
+	case <-ctx.Done():
+		res.Status, res.Error = StatusTimeout, ctx.Err().Error()
+	}
+	res.Duration = time.Since(start)
+	return res
+}
+
+func (r *Registry) recordTransitions(report Report) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, res := range report.Checks {
+		prev, seen := r.last[res.Name]
+		r.last[res.Name] = res.Status
+		if !seen || prev == res.Status {
+			continue
+		}
+		r.history = append(r.history, Transition{Name: res.Name, From: prev, To: res.Status, At: report.CheckedAt, Error: res.Error})
+		if len(r.history) > r.historySize {
+			r.history = r.history[len(r.history)-r.historySize:]
+		}
+	}
+}
+
+// History returns the most recent status transitions, oldest first.
+func (r *Registry) History() []Transition {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Transition(nil), r.history...)
+}
@@ -0,0 +1,81 @@
+// Package httpmetrics counts the requests served and how long they took, for Prometheus.
+package httpmetrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+)
+
+// Unmatched is the route of requests no route matched, so unknown paths share a series.
+const Unmatched = "unmatched"
+
+// Metrics holds the request counter and the duration histogram, labelled by route,
+// method and status. Register it with a registry to export them.
+type Metrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	clock    clock.Clock
+}
+
+// New returns the metrics, timing requests with c; nil is the real clock.
+func New(c clock.Clock) *Metrics {
+	labels := []string{"route", "method", "status"}
+	return &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "shortlink_http_requests_total",
+			Help: "Requests served, by route, method and status.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "shortlink_http_request_duration_seconds",
+			Help:    "Time taken to serve requests, by route, method and status.",
+			Buckets: prometheus.DefBuckets,
+		}, labels),
+		clock: clock.OrReal(c),
+	}
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.requests.Describe(ch)
+	m.duration.Describe(ch)
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.requests.Collect(ch)
+	m.duration.Collect(ch)
+}
+
+// Middleware counts and times the requests after it. Routes are the patterns
+// they were registered with, so a series stands for a route, not for a link.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := m.clock.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = Unmatched
+		}
+		labels := prometheus.Labels{
+			"route":  route,
+			"method": method(c.Request.Method),
+			"status": strconv.Itoa(c.Writer.Status()),
+		}
+		m.requests.With(labels).Inc()
+		m.duration.With(labels).Observe(m.clock.Now().Sub(start).Seconds())
+	}
+}
+
+// method returns the standard methods as they are and "other" for the rest,
+// which clients make up at will.
+func method(name string) string {
+	switch name {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return name
+	}
+	return "other"
+}
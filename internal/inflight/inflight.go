@@ -0,0 +1,97 @@
+package inflight
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tracker counts the requests being handled so shutdown can wait for them
+// before closing what handlers hand work to. Its zero value is ready to use, and
+// it counts any other kind of operation through Enter and Leave.
+type Tracker struct {
+	active   atomic.Int64
+	draining atomic.Bool
+	mu       sync.Mutex
+	idle     chan struct{}
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+// InFlight returns the number of requests being handled.
+func (t *Tracker) InFlight() int64 {
+	return t.active.Load()
+}
+
+// Draining reports whether StartDraining was called.
+func (t *Tracker) Draining() bool {
+	return t.draining.Load()
+}
+
+// StartDraining makes the middleware reject new requests.
+func (t *Tracker) StartDraining() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.draining.Store(true)
+}
+
+// Wait starts draining and waits until no request is being handled, or ctx ends.
+func (t *Tracker) Wait(ctx context.Context) error {
+	t.mu.Lock()
+	t.draining.Store(true)
+	if t.active.Load() == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	idle := t.idle
+	t.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Enter counts a request, or reports false once draining; the lock keeps a request
+// from being admitted after Wait saw none. Every admitted request must Leave.
+func (t *Tracker) Enter() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining.Load() {
+		return false
+	}
+	t.active.Add(1)
+	return true
+}
+
+// Leave ends a request counted by Enter.
+func (t *Tracker) Leave() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.active.Add(-1) == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// Middleware counts requests with t and rejects them with 503 while draining.
+func Middleware(t *Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !t.Enter() {
+			c.Header("Connection", "close")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Server is shutting down"})
+			return
+		}
+		defer t.Leave()
+		c.Next()
+	}
+}
@@ -0,0 +1,111 @@
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+
+	"github.com/OrtemRepos/shortlink/internal/outbound"
+)
+
+// Statuses of checks that got no HTTP response. Checks that did record the
+// response status code as a decimal string.
+const (
+	StatusTimeout          = "timeout"
+	StatusDNSError         = "dns_error"
+	StatusRefused          = "refused"
+	StatusNetworkError     = "network_error"
+	StatusTooManyRedirects = "too_many_redirects"
+	StatusInvalidURL       = "invalid_url"
+)
+
+// Health of a link as shown in listings.
+const (
+	HealthUnknown = "unknown"
+	HealthOK      = "ok"
+	HealthBroken  = "broken"
+)
+
+var errTooManyRedirects = errors.New("too many redirects")
+
+// HealthOf maps the last status of a link to its health; a link never checked is unknown.
+func HealthOf(status string) string {
+	if status == "" {
+		return HealthUnknown
+	}
+	if code, err := strconv.Atoi(status); err == nil && code < http.StatusBadRequest {
+		return HealthOK
+	}
+	return HealthBroken
+}
+
+// Checker requests the destination of a link and classifies the outcome.
+type Checker struct {
+	client *http.Client
+}
+
+// NewChecker returns a Checker sending requests with a copy of client that
+// follows at most maxRedirects redirects. Timeouts are the client's.
+func NewChecker(client *http.Client, maxRedirects int) *Checker {
+	c := *client
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxRedirects {
+			return errTooManyRedirects
+		}
+		return nil
+	}
+	return &Checker{client: &c}
+}
+
+// Check sends a HEAD request to target, falling back to GET when the server does not allow HEAD.
+func (c *Checker) Check(ctx context.Context, target string) string {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return StatusInvalidURL
+	}
+	code, err := c.do(ctx, http.MethodHead, u.String())
+	if err == nil && (code == http.StatusMethodNotAllowed || code == http.StatusNotImplemented) {
+		code, err = c.do(ctx, http.MethodGet, u.String())
+	}
+	if err != nil {
+		return classify(err)
+	}
+	return strconv.Itoa(code)
+}
+
+func (c *Checker) do(ctx context.Context, method, target string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// The body is not needed; a short read lets small responses keep the connection.
+	_, _ = io.CopyN(io.Discard, resp.Body, 4096)
+	return resp.StatusCode, nil
+}
+
+func classify(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errTooManyRedirects):
+		return StatusTooManyRedirects
+	case errors.Is(err, outbound.ErrPrivateDestination), errors.Is(err, syscall.ECONNREFUSED):
+		return StatusRefused
+	case errors.As(err, &dnsErr):
+		return StatusDNSError
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return StatusTimeout
+	default:
+		return StatusNetworkError
+	}
+}
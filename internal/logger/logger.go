@@ -5,10 +5,21 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/requestid"
 )
 
 var Logger *zap.Logger
 
+// Level is the lowest level logged by the loggers of InitLogger, info by default.
+var Level = zap.NewAtomicLevelAt(zap.InfoLevel)
+
+// SetLevel sets Level from its name, such as debug or warn, for the loggers built
+// before as well as after.
+func SetLevel(name string) error {
+	return Level.UnmarshalText([]byte(name))
+}
+
 func GetLogger() *zap.Logger {
 	if Logger == nil {
 		var err error
@@ -21,7 +32,9 @@ func GetLogger() *zap.Logger {
 }
 
 func InitLogger() (*zap.Logger, error) {
-	return zap.NewProduction()
+	cfg := zap.NewProductionConfig()
+	cfg.Level = Level
+	return cfg.Build()
 }
 
 func LoggerMiddleware(logger *zap.Logger) gin.HandlerFunc {
@@ -45,6 +58,7 @@ func LoggerMiddleware(logger *zap.Logger) gin.HandlerFunc {
 			zap.String("ip", clientIP),
 			zap.Duration("duration", duration),
 			zap.String("query", raw),
+			requestid.Field(c.Request.Context()),
 		)
 	}
 }
@@ -0,0 +1,75 @@
+// Package logsample thins out logs repeated for the same key, such as a lookup
+// logged for every visit of a popular link.
+package logsample
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+)
+
+type entry struct {
+	key    string
+	logged time.Time
+}
+
+// Sampler lets a key be logged at most once per interval. It remembers the last
+// size keys logged, least recently seen first out: a key pushed out by others may
+// be logged again before its interval is over, never more than once per interval
+// while it is seen often enough to stay. It is safe for concurrent use.
+type Sampler struct {
+	size     int
+	interval time.Duration
+	clock    clock.Clock
+
+	mu    sync.Mutex
+	order *list.List
+	keys  map[string]*list.Element
+}
+
+// New returns a sampler of size keys logged once per interval on clock c, nil for
+// the real clock. Panics if size is not positive.
+func New(size int, interval time.Duration, c clock.Clock) *Sampler {
+	if size <= 0 {
+		panic("sampler size must be greater than 0")
+	}
+	return &Sampler{
+		size:     size,
+		interval: interval,
+		clock:    clock.OrReal(c),
+		order:    list.New(),
+		keys:     make(map[string]*list.Element, size),
+	}
+}
+
+// Allow reports whether key may be logged now, counting it as logged if so.
+func (s *Sampler) Allow(key string) bool {
+	now := s.clock.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.keys[key]; ok {
+		s.order.MoveToFront(el)
+		e := el.Value.(*entry)
+		if now.Sub(e.logged) < s.interval {
+			return false
+		}
+		e.logged = now
+		return true
+	}
+	if s.order.Len() >= s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.keys, oldest.Value.(*entry).key)
+	}
+	s.keys[key] = s.order.PushFront(&entry{key: key, logged: now})
+	return true
+}
+
+// Len counts the keys remembered.
+func (s *Sampler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
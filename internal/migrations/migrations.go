@@ -0,0 +1,126 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/logger"
+)
+
+// Migration is one schema change. Migrations run in Version order and each runs once.
+// NoTx migrations run outside a transaction, which statements such as
+// CREATE INDEX CONCURRENTLY require. They must be a single statement (several
+// statements in one query run in an implicit transaction) and idempotent,
+// because a failure can leave them partially applied. The invalid index a failed
+// CREATE INDEX CONCURRENTLY leaves is dropped before the migration runs again.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+	NoTx    bool
+}
+
+// lockKey serializes migration runs of concurrently starting instances.
+const lockKey = 727_310_001
+
+const versionTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       TEXT NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);`
+
+// Run applies every migration not yet recorded in schema_migrations.
+func Run(ctx context.Context, db *sqlx.DB, list []Migration) error {
+	log := logger.GetLogger().Named("migrations")
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("migrations: acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return fmt.Errorf("migrations: acquire lock: %w", err)
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+	}()
+
+	if _, err := conn.ExecContext(ctx, versionTable); err != nil {
+		return fmt.Errorf("migrations: create version table: %w", err)
+	}
+	applied := make(map[int]bool)
+	var versions []int
+	if err := conn.SelectContext(ctx, &versions, "SELECT version FROM schema_migrations"); err != nil {
+		return fmt.Errorf("migrations: read versions: %w", err)
+	}
+	for _, v := range versions {
+		applied[v] = true
+	}
+
+	sorted := append([]Migration(nil), list...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for _, m := range sorted {
+		if applied[m.Version] {
+			continue
+		}
+		if err := apply(ctx, conn, m); err != nil {
+			return fmt.Errorf("migrations: %d_%s: %w", m.Version, m.Name, err)
+		}
+		log.Info("migration applied", zap.Int("version", m.Version), zap.String("name", m.Name))
+	}
+	return nil
+}
+
+// concurrentIndex matches the index a NoTx migration builds concurrently.
+var concurrentIndex = regexp.MustCompile(`(?i)CREATE\s+(?:UNIQUE\s+)?INDEX\s+CONCURRENTLY\s+IF\s+NOT\s+EXISTS\s+(\w+)`)
+
+// dropInvalidIndex drops name if an earlier concurrent build of it failed: such a
+// build leaves an invalid index behind, which IF NOT EXISTS would take for done.
+// Runs hold the migration lock, so no other run is building it meanwhile.
+func dropInvalidIndex(ctx context.Context, conn *sqlx.Conn, name string) error {
+	var invalid bool
+	err := conn.GetContext(ctx, &invalid, `
+		SELECT EXISTS (SELECT 1 FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid
+			WHERE c.relname = $1 AND c.relnamespace = current_schema()::regnamespace AND NOT i.indisvalid)`, name)
+	if err != nil || !invalid {
+		return err
+	}
+	logger.GetLogger().Named("migrations").Warn("dropping invalid index", zap.String("index", name))
+	_, err = conn.ExecContext(ctx, "DROP INDEX CONCURRENTLY IF EXISTS "+name)
+	return err
+}
+
+func apply(ctx context.Context, conn *sqlx.Conn, m Migration) error {
+	const record = "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)"
+	if m.NoTx {
+		if match := concurrentIndex.FindStringSubmatch(m.SQL); match != nil {
+			if err := dropInvalidIndex(ctx, conn, match[1]); err != nil {
+				return err
+			}
+		}
+		if _, err := conn.ExecContext(ctx, m.SQL); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx, record, m.Version, m.Name)
+		return err
+	}
+	tx, err := conn.BeginTxx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, m.Version, m.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
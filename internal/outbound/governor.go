@@ -0,0 +1,209 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/clock"
+)
+
+// maxBuckets bounds the per-host state; full buckets are dropped beyond it.
+const maxBuckets = 10000
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type Stats struct {
+	Allowed       uint64 `json:"allowed"`
+	Throttled     uint64 `json:"throttled"`
+	TimedOut      uint64 `json:"timed_out"`
+	Refused       uint64 `json:"refused"`
+	InFlight      int    `json:"in_flight"`
+	MaxConcurrent int    `json:"max_concurrent"`
+	Hosts         int    `json:"hosts"`
+}
+
+// Governor limits outbound requests with a token bucket per destination host
+// and a cap on concurrent requests across all hosts.
+type Governor struct {
+	rate   float64
+	burst  float64
+	global chan struct{}
+	clock  clock.Clock
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+
+	allowed   atomic.Uint64
+	throttled atomic.Uint64
+	timedOut  atomic.Uint64
+	refused   atomic.Uint64
+}
+
+type GovernorOption func(*Governor)
+
+// WithClock sets the clock that refills buckets and times waits; the default is the real clock.
+func WithClock(c clock.Clock) GovernorOption {
+	return func(g *Governor) {
+		g.clock = clock.OrReal(c)
+	}
+}
+
+func NewGovernor(cfg *configs.Config, opts ...GovernorOption) *Governor {
+	if cfg.Outbound.RatePerHost <= 0 || cfg.Outbound.BurstPerHost <= 0 || cfg.Outbound.MaxConcurrent <= 0 {
+		panic("outbound rate, burst and concurrency must be greater than 0")
+	}
+	g := &Governor{
+		rate:    cfg.Outbound.RatePerHost,
+		burst:   float64(cfg.Outbound.BurstPerHost),
+		global:  make(chan struct{}, cfg.Outbound.MaxConcurrent),
+		clock:   clock.Real{},
+		buckets: make(map[string]*bucket),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// Acquire waits for a token of host and a global slot.
+// The wait ends with ctx, so queued requests time out with the task that made them.
+// release must be called once the request, body included, is done.
+func (g *Governor) Acquire(ctx context.Context, host string) (release func(), err error) {
+	host = strings.ToLower(host)
+	for waited := false; ; waited = true {
+		wait := g.reserve(host)
+		if wait == 0 {
+			break
+		}
+		if !waited {
+			g.throttled.Add(1)
+		}
+		select {
+		case <-ctx.Done():
+			g.timedOut.Add(1)
+			return nil, fmt.Errorf("outbound request to %s: %w", host, ctx.Err())
+		case <-g.clock.After(wait):
+		}
+	}
+	select {
+	case g.global <- struct{}{}:
+	default:
+		select {
+		case g.global <- struct{}{}:
+		case <-ctx.Done():
+			g.timedOut.Add(1)
+			return nil, fmt.Errorf("outbound request to %s: %w", host, ctx.Err())
+		}
+	}
+	g.allowed.Add(1)
+	var once sync.Once
+	return func() { once.Do(func() { <-g.global }) }, nil
+}
+
+// reserve takes a token of host and returns 0, or returns how long until one is available.
+func (g *Governor) reserve(host string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.clock.Now()
+	b, ok := g.buckets[host]
+	if !ok {
+		if len(g.buckets) >= maxBuckets {
+			g.dropFullLocked(now)
+		}
+		b = &bucket{tokens: g.burst, last: now}
+		g.buckets[host] = b
+	}
+	b.tokens = min(g.burst, b.tokens+now.Sub(b.last).Seconds()*g.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / g.rate * float64(time.Second))
+}
+
+func (g *Governor) dropFullLocked(now time.Time) {
+	for host, b := range g.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*g.rate >= g.burst {
+			delete(g.buckets, host)
+		}
+	}
+}
+
+func (g *Governor) Stats() Stats {
+	g.mu.Lock()
+	hosts := len(g.buckets)
+	g.mu.Unlock()
+	return Stats{
+		Allowed:       g.allowed.Load(),
+		Throttled:     g.throttled.Load(),
+		TimedOut:      g.timedOut.Load(),
+		Refused:       g.refused.Load(),
+		InFlight:      len(g.global),
+		MaxConcurrent: cap(g.global),
+		Hosts:         hosts,
+	}
+}
+
+// Client returns an HTTP client for outbound fetches: every request is
+// governed and connections to non-public addresses are refused.
+func (g *Governor) Client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialControl}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &governedTransport{governor: g, next: transport},
+	}
+}
+
+type governedTransport struct {
+	governor *Governor
+	next     http.RoundTripper
+}
+
+func (t *governedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if ip := net.ParseIP(req.URL.Hostname()); ip != nil {
+		if err := CheckIP(ip); err != nil {
+			t.governor.refused.Add(1)
+			return nil, err
+		}
+	}
+	release, err := t.governor.Acquire(req.Context(), req.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		if errors.Is(err, ErrPrivateDestination) {
+			t.governor.refused.Add(1)
+		}
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,236 @@
+package pages
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/logger"
+)
+
+// Pages rendered by a Renderer, with the data each one is executed with.
+const (
+	// Tombstone is shown for a deleted link, with TombstoneData.
+	Tombstone = "tombstone"
+	// Interstitial is shown before redirecting to a destination, with InterstitialData.
+	Interstitial = "interstitial"
+	// Unlock asks for the password of a protected link, with UnlockData.
+	Unlock = "unlock"
+	// Dereferer sends the visitor on to a destination without a referrer, with DerefererData.
+	Dereferer = "dereferer"
+)
+
+// DefaultLanguage is rendered when no language of Accept-Language has the page.
+const DefaultLanguage = "en"
+
+var ErrUnknownPage = errors.New("unknown page")
+
+type TombstoneData struct {
+	ShortURL string
+}
+
+type InterstitialData struct {
+	ShortURL    string
+	Destination string
+}
+
+type DerefererData struct {
+	Destination string
+}
+
+type UnlockData struct {
+	ShortURL string
+	// Action is the URL the password form is posted to.
+	Action string
+	Error  string
+}
+
+// sampleData is the data override templates are checked with at startup.
+var sampleData = map[string]any{
+	Tombstone:    TombstoneData{},
+	Interstitial: InterstitialData{},
+	Unlock:       UnlockData{},
+	Dereferer:    DerefererData{},
+}
+
+// styleFile holds the "style" template every page may include.
+const styleFile = "style.html"
+
+//go:embed templates
+var embedded embed.FS
+
+// Renderer renders pages from templates embedded in the binary, or from a directory
+// laid out the same way, whose files take precedence: style.html and <language>/<page>.html.
+type Renderer struct {
+	// pages holds the templates by language, then page.
+	pages map[string]map[string]*template.Template
+	log   *zap.Logger
+}
+
+type RendererOption func(*Renderer)
+
+// WithLogger sets the logger override problems are reported to; the default is the application logger.
+func WithLogger(log *zap.Logger) RendererOption {
+	return func(r *Renderer) {
+		if log != nil {
+			r.log = log
+		}
+	}
+}
+
+// NewRenderer returns a Renderer of the embedded templates overridden by the ones in
+// overrideDir, if set. An override directory that is missing, or has a template that
+// does not parse or render, is ignored as a whole with a warning.
+func NewRenderer(overrideDir string, opts ...RendererOption) *Renderer {
+	r := &Renderer{log: logger.GetLogger()}
+	for _, opt := range opts {
+		opt(r)
+	}
+	base, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		panic(err)
+	}
+	files, err := readTemplates(base)
+	if err != nil {
+		panic(err)
+	}
+	if overrideDir != "" {
+		pages, err := loadOverrides(files, os.DirFS(overrideDir))
+		if err == nil {
+			r.pages = pages
+			return r
+		}
+		r.log.Warn("page template overrides ignored, using embedded templates",
+			zap.String("dir", overrideDir), zap.Error(err))
+	}
+	r.pages, err = build(files)
+	if err != nil {
+		panic(fmt.Sprintf("embedded page templates: %v", err))
+	}
+	return r
+}
+
+func loadOverrides(files map[string]string, dir fs.FS) (map[string]map[string]*template.Template, error) {
+	overrides, err := readTemplates(dir)
+	if err != nil {
+		return nil, err
+	}
+	merged := make(map[string]string, len(files)+len(overrides))
+	for name, text := range files {
+		merged[name] = text
+	}
+	for name, text := range overrides {
+		merged[name] = text
+	}
+	return build(merged)
+}
+
+// readTemplates reads the .html files of fsys by slash-separated path.
+func readTemplates(fsys fs.FS) (map[string]string, error) {
+	files := make(map[string]string)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(name) != ".html" {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		files[name] = string(data)
+		return nil
+	})
+	return files, err
+}
+
+// build parses every <language>/<page>.html with the style and checks it renders sample data.
+func build(files map[string]string) (map[string]map[string]*template.Template, error) {
+	pages := make(map[string]map[string]*template.Template)
+	for name, text := range files {
+		if name == styleFile {
+			continue
+		}
+		lang, file := path.Split(name)
+		lang = strings.ToLower(strings.TrimSuffix(lang, "/"))
+		page := strings.TrimSuffix(file, ".html")
+		data, ok := sampleData[page]
+		if lang == "" || strings.Contains(lang, "/") || !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPage, name)
+		}
+		tmpl, err := template.New(page).Parse(files[styleFile])
+		if err == nil {
+			_, err = tmpl.Parse(text)
+		}
+		if err == nil {
+			err = tmpl.Execute(io.Discard, data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", name, err)
+		}
+		if pages[lang] == nil {
+			pages[lang] = make(map[string]*template.Template)
+		}
+		pages[lang][page] = tmpl
+	}
+	return pages, nil
+}
+
+// Render writes page with data in the language of acceptLanguage it has, falling back
+// to DefaultLanguage, and returns the language used.
+func (r *Renderer) Render(w io.Writer, page, acceptLanguage string, data any) (string, error) {
+	for _, lang := range append(Languages(acceptLanguage), DefaultLanguage) {
+		if tmpl, ok := r.pages[lang][page]; ok {
+			return lang, tmpl.Execute(w, data)
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownPage, page)
+}
+
+// Languages returns the languages of an Accept-Language header, most preferred first,
+// each tag followed by its base language: "pt-BR, en;q=0.5" gives pt-br, pt, en.
+// Languages with q=0 and the * wildcard are left out.
+func Languages(acceptLanguage string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if tag == "" || tag == "*" || q <= 0 {
+			continue
+		}
+		tags = append(tags, weighted{tag, q})
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	var langs []string
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		base, _, _ := strings.Cut(t.tag, "-")
+		for _, lang := range []string{t.tag, base} {
+			if !seen[lang] {
+				seen[lang] = true
+				langs = append(langs, lang)
+			}
+		}
+	}
+	return langs
+}
@@ -2,15 +2,194 @@ package ports
 
 import (
 	"context"
+	"time"
 
 	"github.com/OrtemRepos/shortlink/internal/domain"
 )
 
+// URLRepositoryPort stores links under the short codes they are given; codes are
+// generated above the repository, see shortener.Service. Save and BatchSave
+// return domain.ErrShortURLRequired for a link without a code and
+// domain.ErrShortURLTaken for a code in use.
 type URLRepositoryPort interface {
 	Save(ctx context.Context, url *domain.URL) error
 	BatchSave(ctx context.Context, url []*domain.URL) error
-	BatchDelete(ctx context.Context, ids map[string][]string) error
+	// Exists reports whether shortURL is in use: by a link, archived or deleted ones
+	// included, or by a reservation.
+	Exists(ctx context.Context, shortURL string) (bool, error)
+	// BatchDelete soft-deletes the listed links of every user and returns how many were deleted.
+	// Users fail independently; the error joins the failures of every user.
+	BatchDelete(ctx context.Context, ids map[string][]string) (int, error)
 	Find(ctx context.Context, shortURL string) (*domain.URL, error)
-	Close() error
+	// Archive moves links created before olderThan and not visited since idleSince to
+	// cold storage and returns how many were moved.
+	Archive(ctx context.Context, olderThan, idleSince time.Time) (int, error)
+	// Unarchive moves the given links back to the hot store and returns how many were restored.
+	Unarchive(ctx context.Context, shortURLs []string) (int, error)
+	// ReassignOwner moves every link of user from to user to and returns how many were moved.
+	// When both own the same original URL, the older link is kept and the other is
+	// soft-deleted and left with from. Running it again moves nothing.
+	ReassignOwner(ctx context.Context, from, to string) (int, error)
+	// FindByUserAndHost returns the short codes of the live, not archived, links of userID
+	// matching the normalized filter.
+	FindByUserAndHost(ctx context.Context, userID string, filter domain.URLFilter) ([]string, error)
+	// FindByUser returns the page of the live links of userID, archived ones included,
+	// in the order of the page, with their check and moderation status. Return
+	// domain.ErrQueryUnsupported for a page with a Query the repository cannot search.
+	FindByUser(ctx context.Context, userID string, page domain.LinkPage) ([]domain.URL, error)
+	// CountByQuery returns how many links FindByUser lists for userID and query
+	// over every page, with the same errors.
+	CountByQuery(ctx context.Context, userID, query string) (int, error)
+	// IncrementVisit counts a redirect served by the link shortURL, archived ones
+	// included, at the current time. Return domain.ErrURLNotFound for an unknown link.
+	IncrementVisit(ctx context.Context, shortURL string) error
+	// Stats counts the live links and their owners, see domain.Stats.
+	Stats(ctx context.Context) (domain.Stats, error)
+	// Close lets the operations in progress end, up to the deadline of ctx, then
+	// releases the repository. It is called once, at shutdown.
+	Close(ctx context.Context) error
 	Ping(ctx context.Context) error
 }
+
+// URLCachePort is implemented by repository decorators that cache lookups.
+type URLCachePort interface {
+	Prime(url *domain.URL)
+	Evict(shortURL string)
+}
+
+// URLExportPort is implemented by repositories that can list every link of a user.
+type URLExportPort interface {
+	// ExportByUser returns the live links of userID, archived ones included, by short code.
+	ExportByUser(ctx context.Context, userID string) ([]domain.URL, error)
+}
+
+// URLFindManyPort is implemented by repositories that look up many links at once.
+type URLFindManyPort interface {
+	// FindMany returns the links among shortURLs by code, deleted and archived ones
+	// included, with their moderation status. Unknown codes and reservations are left out.
+	FindMany(ctx context.Context, shortURLs []string) (map[string]domain.URL, error)
+}
+
+// URLCountPort is implemented by repositories that count the links of a user.
+type URLCountPort interface {
+	// CountByUser returns how many live links userID owns, archived ones included.
+	CountByUser(ctx context.Context, userID string) (int, error)
+}
+
+// URLTotalPort is implemented by repositories that count every link they hold.
+type URLTotalPort interface {
+	// CountLinks returns how many links are stored, deleted, archived and reserved ones included.
+	CountLinks(ctx context.Context) (int, error)
+}
+
+// URLMirrorPort is implemented by repositories that can stand in for another one
+// while it is unreachable, serving the copies of its links they were given.
+type URLMirrorPort interface {
+	Find(ctx context.Context, shortURL string) (*domain.URL, error)
+	// Mirror keeps a copy of url as read from the other repository. Links that must
+	// not resolve, deleted or blocked ones, are forgotten instead.
+	Mirror(ctx context.Context, url domain.URL) error
+}
+
+// URLSnapshotPort is implemented by repositories holding links in memory that
+// can write them out, so they survive a restart.
+type URLSnapshotPort interface {
+	SaveSnapshot(ctx context.Context) error
+}
+
+// URLLegacyPort is implemented by repositories that may hold links loaded without an owner.
+// Such links belong to a sentinel owner until an admin hands them to a user.
+type URLLegacyPort interface {
+	// LegacyLinks returns the links still owned by the sentinel.
+	LegacyLinks(ctx context.Context) ([]domain.URL, error)
+	// ClaimLegacy gives the listed sentinel-owned links to owner and returns how many were claimed.
+	// Codes that are unknown or already owned are skipped.
+	ClaimLegacy(ctx context.Context, owner string, shortURLs []string) (int, error)
+}
+
+// URLHealthPort is implemented by repositories that record destination checks of links.
+type URLHealthPort interface {
+	// LinksToCheck returns up to limit live links never checked or last checked before checkedBefore,
+	// least recently checked first, skipping users who opted out.
+	LinksToCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]domain.URL, error)
+	RecordChecks(ctx context.Context, checks []domain.LinkCheck) error
+	// SetLinkChecks opts userID in or out of link checks.
+	SetLinkChecks(ctx context.Context, userID string, enabled bool) error
+}
+
+// URLReencryptPort is implemented by repositories encrypting original URLs at rest.
+// Reencrypt rewrites values not yet encrypted with the primary key and returns how many changed.
+type URLReencryptPort interface {
+	Reencrypt(ctx context.Context, batchSize int) (int, error)
+}
+
+// URLReservationPort is implemented by repositories that can hold a short code for a user
+// before the original URL is known. Find returns domain.ErrCodeReserved for an active
+// reservation and domain.ErrURLNotFound for an expired one.
+type URLReservationPort interface {
+	// Reserve holds code for userID for ttl. Return domain.ErrShortURLTaken if code is
+	// a link or an active reservation, the caller's own included.
+	Reserve(ctx context.Context, userID, code string, ttl time.Duration) error
+	// CompleteReservation turns the active reservation of code into a link to originalURL.
+	// Return domain.ErrReservationNotFound if there is none and
+	// domain.ErrNotReservationOwner if it is not held by userID.
+	CompleteReservation(ctx context.Context, userID, code, originalURL string) error
+	// Reservations returns the active reservations of userID by short code.
+	Reservations(ctx context.Context, userID string) ([]domain.Reservation, error)
+	// PurgeExpiredReservations removes the reservations expired at now and returns how many were removed.
+	PurgeExpiredReservations(ctx context.Context, now time.Time) (int, error)
+}
+
+// URLStatsPort is implemented by repositories that report the visits counted by
+// URLRepositoryPort.IncrementVisit.
+type URLStatsPort interface {
+	// LinkStats returns the visits of the link shortURL of userID, archived ones included.
+	// Return domain.ErrURLNotFound if userID owns no such live link.
+	LinkStats(ctx context.Context, userID, shortURL string) (domain.LinkStats, error)
+}
+
+// URLExpiryPort is implemented by repositories storing links that expire, see
+// domain.URL.ExpiresAt. Find still returns expired links, the caller decides.
+type URLExpiryPort interface {
+	// PurgeExpiredLinks retires the links, archived ones included, expired at now and
+	// returns how many were retired: soft-deleted where deleted links are kept, removed otherwise.
+	PurgeExpiredLinks(ctx context.Context, now time.Time) (int, error)
+}
+
+// URLModerationPort is implemented by repositories that record moderation decisions
+// on links. Decisions are checked with domain.CheckModeration and kept in an audit log.
+type URLModerationPort interface {
+	// Moderate applies change to the link shortURL, archived ones included, stamping it
+	// with the current time. Return domain.ErrURLNotFound for an unknown link,
+	// domain.ErrInvalidModeration for an invalid change and
+	// domain.ErrModerationTransition if the link cannot move to its status.
+	Moderate(ctx context.Context, shortURL string, change domain.Moderation) (domain.Moderation, error)
+	// Moderation returns the current moderation of shortURL, clean with no log if it
+	// was never moderated, and its audit log, oldest first.
+	Moderation(ctx context.Context, shortURL string) (domain.Moderation, []domain.ModerationEvent, error)
+	// ModeratedLinks returns the links currently in status, by short code.
+	ModeratedLinks(ctx context.Context, status domain.ModerationStatus) ([]domain.ModeratedLink, error)
+}
+
+// URLPrivacyPort is implemented by repositories that change the privacy mode of
+// existing links; Save stores the mode of new ones.
+type URLPrivacyPort interface {
+	// SetPrivacy sets the privacy mode of the live link shortURL of userID, archived
+	// ones included. Return domain.ErrURLNotFound if userID owns no such link.
+	SetPrivacy(ctx context.Context, userID, shortURL string, privacy domain.Privacy) error
+}
+
+// CloseWithin runs close, a Close that takes no context such as those written
+// before URLRepositoryPort.Close took one, and returns ctx.Err() if ctx ends first;
+// close then goes on in the background. A repository implements the port with
+// func (r *Repo) Close(ctx context.Context) error { return ports.CloseWithin(ctx, r.close) }.
+func CloseWithin(ctx context.Context, close func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- close() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
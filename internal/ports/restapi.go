@@ -1,5 +1,7 @@
 package ports
 
+import "context"
+
 type RestAPIPort interface {
-	Serve()
+	Serve(ctx context.Context) error
 }
@@ -0,0 +1,153 @@
+// Package quota caps the links a user may own and warns users nearing the cap.
+package quota
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+)
+
+var ErrQuotaExceeded = errors.New("link quota exceeded")
+
+// Usage is how much of the quota of a user is used. Warning is set from WarnAt links on.
+type Usage struct {
+	Used      int  `json:"used"`
+	Limit     int  `json:"limit"`
+	Remaining int  `json:"remaining"`
+	WarnAt    int  `json:"warn_at"`
+	Warning   bool `json:"warning"`
+}
+
+// Crossed reports whether the last n links taken brought the usage to the warning threshold.
+func (u Usage) Crossed(n int) bool {
+	return u.Warning && u.Used-n < u.WarnAt
+}
+
+type count struct {
+	used     int
+	loadedAt time.Time
+}
+
+// Tracker keeps the link count of every user it was asked about, so checking the
+// quota does not count links on each request. Counts are loaded on first use and
+// again once older than ttl, or after Invalidate: callers invalidate a user whenever
+// links are added or removed other than through Reserve and Release.
+type Tracker struct {
+	counter ports.URLCountPort
+	limit   int
+	warnAt  int
+	ttl     time.Duration
+	clock   clock.Clock
+
+	mu     sync.Mutex
+	counts map[string]count
+}
+
+// New returns a tracker allowing limit links per user and warning from warnPercent
+// of them, with counts kept for ttl on clock c, nil for the real clock.
+// Panics if limit is not positive or warnPercent not within 1 to 100.
+func New(counter ports.URLCountPort, limit, warnPercent int, ttl time.Duration, c clock.Clock) *Tracker {
+	if limit <= 0 {
+		panic("quota limit must be greater than 0")
+	}
+	if warnPercent <= 0 || warnPercent > 100 {
+		panic("quota warning percentage must be within 1 and 100")
+	}
+	return &Tracker{
+		counter: counter,
+		limit:   limit,
+		warnAt:  (limit*warnPercent + 99) / 100,
+		ttl:     ttl,
+		clock:   clock.OrReal(c),
+		counts:  make(map[string]count),
+	}
+}
+
+// Usage returns the usage of userID.
+func (t *Tracker) Usage(ctx context.Context, userID string) (Usage, error) {
+	loaded, err := t.load(ctx, userID)
+	if err != nil {
+		return Usage{}, err
+	}
+	return t.usage(loaded.used), nil
+}
+
+// Reserve counts n more links for userID and returns the usage with them. Return
+// ErrQuotaExceeded, with the usage unchanged, if they do not fit. Links that are not
+// created after all must be given back with Release.
+func (t *Tracker) Reserve(ctx context.Context, userID string, n int) (Usage, error) {
+	loaded, err := t.load(ctx, userID)
+	if err != nil {
+		return Usage{}, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.counts[userID]
+	if !ok {
+		// Invalidated meanwhile: count from what was just loaded.
+		c = loaded
+	}
+	if c.used+n > t.limit {
+		return t.usage(c.used), ErrQuotaExceeded
+	}
+	c.used += n
+	t.counts[userID] = c
+	return t.usage(c.used), nil
+}
+
+// Release gives back n links reserved for userID.
+func (t *Tracker) Release(userID string, n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.counts[userID]; ok {
+		c.used = max(c.used-n, 0)
+		t.counts[userID] = c
+	}
+}
+
+// Invalidate forgets the counts of userIDs, to be loaded again on next use.
+func (t *Tracker) Invalidate(userIDs ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, userID := range userIDs {
+		delete(t.counts, userID)
+	}
+}
+
+// load returns the count of userID, loading it if needed. Loads run outside the
+// lock; of two concurrent loads, the first one stored wins.
+func (t *Tracker) load(ctx context.Context, userID string) (count, error) {
+	now := t.clock.Now()
+	t.mu.Lock()
+	c, ok := t.counts[userID]
+	t.mu.Unlock()
+	if ok && now.Sub(c.loadedAt) < t.ttl {
+		return c, nil
+	}
+	used, err := t.counter.CountByUser(ctx, userID)
+	if err != nil {
+		return count{}, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if stored, ok := t.counts[userID]; ok && !stored.loadedAt.Equal(c.loadedAt) {
+		return stored, nil
+	}
+	loaded := count{used: used, loadedAt: now}
+	t.counts[userID] = loaded
+	return loaded, nil
+}
+
+func (t *Tracker) usage(used int) Usage {
+	return Usage{
+		Used:      used,
+		Limit:     t.limit,
+		Remaining: max(t.limit-used, 0),
+		WarnAt:    t.warnAt,
+		Warning:   used >= t.warnAt,
+	}
+}
@@ -0,0 +1,159 @@
+// Package ratelimit limits requests with a token bucket per client.
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/subnet"
+)
+
+// maxBuckets bounds the per-client state; full buckets are dropped beyond it.
+const maxBuckets = 10000
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Stats counts the requests seen by a limiter and the clients it tracks.
+type Stats struct {
+	Allowed  uint64 `json:"allowed"`
+	Rejected uint64 `json:"rejected"`
+	Clients  int    `json:"clients"`
+}
+
+// Limiter allows each client rate requests per second, in bursts of up to burst.
+type Limiter struct {
+	rate  float64
+	burst float64
+	clock clock.Clock
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+
+	allowed  atomic.Uint64
+	rejected atomic.Uint64
+}
+
+// New returns a limiter timed by clock c, nil for the real clock.
+func New(rate float64, burst int, c clock.Clock) *Limiter {
+	if rate <= 0 || burst <= 0 {
+		panic("rate limit and burst must be greater than 0")
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		clock:   clock.OrReal(c),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token of client and returns 0, or returns how long until one is available.
+func (l *Limiter) Allow(client string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.dropFullLocked(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		l.allowed.Add(1)
+		return 0
+	}
+	l.rejected.Add(1)
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// Sweep forgets the clients idle long enough for their bucket to refill and
+// returns how many were forgotten; call it periodically to bound memory.
+func (l *Limiter) Sweep() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.dropFullLocked(l.clock.Now())
+}
+
+// dropFullLocked forgets clients whose bucket refilled, which New would recreate as is.
+func (l *Limiter) dropFullLocked(now time.Time) int {
+	dropped := 0
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// Stats returns the counters of l.
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	clients := len(l.buckets)
+	l.mu.Unlock()
+	return Stats{Allowed: l.allowed.Load(), Rejected: l.rejected.Load(), Clients: clients}
+}
+
+// KeyFunc names the client of a request.
+type KeyFunc func(c *gin.Context) string
+
+// ClientIP tells clients apart by IP. X-Real-IP is only believed from proxies,
+// see subnet.ClientIP, so clients cannot pick their own bucket.
+func ClientIP(proxies []*net.IPNet) KeyFunc {
+	return func(c *gin.Context) string {
+		return clientIP(c, proxies)
+	}
+}
+
+// UserOrIP tells clients apart by the UserID set by auth.AuthMiddleware, and by IP
+// for requests without one, as ClientIP does.
+func UserOrIP(proxies []*net.IPNet) KeyFunc {
+	return func(c *gin.Context) string {
+		if userID := c.GetString("UserID"); userID != "" {
+			return "user:" + userID
+		}
+		return "ip:" + clientIP(c, proxies)
+	}
+}
+
+// clientIP falls back to the peer address when a proxy sent no usable X-Real-IP.
+func clientIP(c *gin.Context, proxies []*net.IPNet) string {
+	if ip := subnet.ClientIP(c, proxies); ip != nil {
+		return ip.String()
+	}
+	return c.RemoteIP()
+}
+
+// Middleware answers 429 with Retry-After, in whole seconds, to clients over the
+// limit of l. Clients are told apart by IP, see ClientIP.
+func Middleware(l *Limiter, proxies ...*net.IPNet) gin.HandlerFunc {
+	return KeyedMiddleware(l, ClientIP(proxies))
+}
+
+// KeyedMiddleware is Middleware telling clients apart by key.
+func KeyedMiddleware(l *Limiter, key KeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wait := l.Allow(key(c))
+		if wait == 0 {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+	}
+}
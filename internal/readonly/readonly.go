@@ -0,0 +1,25 @@
+package readonly
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware rejects every request that may mutate state with 503,
+// pointing the client at the primary instance when one is configured.
+func Middleware(primaryAddress string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		body := gin.H{"error": "This instance is a read-only replica"}
+		if primaryAddress != "" {
+			body["primary"] = primaryAddress
+			c.Header("Location", primaryAddress+c.Request.URL.RequestURI())
+		}
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, body)
+	}
+}
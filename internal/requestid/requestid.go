@@ -0,0 +1,70 @@
+// Package requestid tags each request with an ID, taken from the client or
+// generated, so reports of a failure can be matched with its logs.
+package requestid
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Header carries the ID of a request, on the request and on its response.
+const Header = "X-Request-ID"
+
+// Key holds the request ID in the gin context.
+const Key = "RequestID"
+
+// maxLength bounds the IDs accepted from clients; longer ones are replaced.
+const maxLength = 128
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying the request ID id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID ctx carries, empty if none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Field returns the request ID ctx carries as a log field, skipped if none.
+func Field(ctx context.Context) zap.Field {
+	id := FromContext(ctx)
+	if id == "" {
+		return zap.Skip()
+	}
+	return zap.String("request_id", id)
+}
+
+// Middleware takes the ID of a request from Header, or generates one when it is
+// missing or not a short printable string, and puts it in the request context
+// under Key and in Header of the response.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if !valid(id) {
+			id = uuid.NewString()
+		}
+		c.Set(Key, id)
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), id))
+		c.Header(Header, id)
+		c.Next()
+	}
+}
+
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
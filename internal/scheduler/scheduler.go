@@ -0,0 +1,308 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/logger"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+var ErrJobRunning = errors.New("job is already running")
+var ErrJobExists = errors.New("job already registered")
+var ErrInvalidSpec = errors.New("invalid job spec")
+var ErrNotLeader = errors.New("instance is not the leader")
+
+// Job is a unit of periodic work.
+// Run should respect ctx.Done() to abort on shutdown.
+type Job interface {
+	Run(ctx context.Context) error
+}
+
+type JobFunc func(ctx context.Context) error
+
+func (f JobFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Spec describes when a job runs. Exactly one of Interval and Cron must be set.
+type Spec struct {
+	Name           string
+	Interval       time.Duration
+	Cron           string
+	RequiresLeader bool
+}
+
+// Leader reports whether this instance may run leader-only jobs.
+type Leader interface {
+	IsLeader() bool
+}
+
+// Standalone is the Leader of a single-instance deployment: it always leads.
+type Standalone struct{}
+
+func (Standalone) IsLeader() bool { return true }
+
+type JobStatus struct {
+	Name           string        `json:"name"`
+	Schedule       string        `json:"schedule"`
+	RequiresLeader bool          `json:"requires_leader"`
+	Running        bool          `json:"running"`
+	Runs           int           `json:"runs"`
+	Failures       int           `json:"failures"`
+	LastRun        time.Time     `json:"last_run,omitempty"`
+	LastDuration   time.Duration `json:"last_duration"`
+	LastError      string        `json:"last_error,omitempty"`
+	NextRun        time.Time     `json:"next_run,omitempty"`
+}
+
+type entry struct {
+	spec    Spec
+	cron    *Cron
+	job     Job
+	running atomic.Bool
+
+	mu           sync.Mutex
+	runs         int
+	failures     int
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastErr      error
+	nextRun      time.Time
+}
+
+func (e *entry) next(now time.Time) time.Time {
+	if e.cron != nil {
+		return e.cron.Next(now)
+	}
+	return now.Add(e.spec.Interval)
+}
+
+func (e *entry) schedule() string {
+	if e.cron != nil {
+		return "cron " + e.cron.String()
+	}
+	return "every " + e.spec.Interval.String()
+}
+
+func (e *entry) record(start time.Time, duration time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.runs++
+	e.lastRun = start
+	e.lastDuration = duration
+	e.lastErr = err
+	if err != nil {
+		e.failures++
+	}
+}
+
+func (e *entry) status() JobStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	status := JobStatus{
+		Name:           e.spec.Name,
+		Schedule:       e.schedule(),
+		RequiresLeader: e.spec.RequiresLeader,
+		Running:        e.running.Load(),
+		Runs:           e.runs,
+		Failures:       e.failures,
+		LastRun:        e.lastRun,
+		LastDuration:   e.lastDuration,
+		NextRun:        e.nextRun,
+	}
+	if e.lastErr != nil {
+		status.LastError = e.lastErr.Error()
+	}
+	return status
+}
+
+// jobTask adapts a scheduled run to worker.Task.
+type jobTask struct {
+	entry *entry
+	log   *zap.Logger
+}
+
+func (t *jobTask) Execute(ctx context.Context) error {
+	defer t.entry.running.Store(false)
+	start := time.Now()
+	err := t.entry.job.Run(ctx)
+	duration := time.Since(start)
+	t.entry.record(start, duration, err)
+	if err != nil {
+		t.log.Error("job failed", zap.String("job", t.entry.spec.Name), zap.Duration("duration", duration), zap.Error(err))
+		return fmt.Errorf("job %s: %w", t.entry.spec.Name, err)
+	}
+	t.log.Debug("job completed", zap.String("job", t.entry.spec.Name), zap.Duration("duration", duration))
+	return nil
+}
+
+func (t *jobTask) Stringer() string {
+	return "job:" + t.entry.spec.Name
+}
+
+// Scheduler runs registered jobs on their schedule by submitting them to a worker pool.
+// A job never overlaps with itself: a tick that fires while the previous run is active is skipped.
+type Scheduler struct {
+	pool    worker.WorkerPool
+	leader  Leader
+	entries map[string]*entry
+	mu      sync.RWMutex
+	started bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	log     *zap.Logger
+}
+
+// NewScheduler returns a Scheduler that executes jobs on pool.
+// The pool is owned by the caller and must be started separately.
+func NewScheduler(pool worker.WorkerPool, leader Leader) *Scheduler {
+	if leader == nil {
+		leader = Standalone{}
+	}
+	return &Scheduler{
+		pool:    pool,
+		leader:  leader,
+		entries: make(map[string]*entry),
+		log:     logger.GetLogger().Named("scheduler"),
+	}
+}
+
+// Register adds a job. Jobs must be registered before Start.
+func (s *Scheduler) Register(spec Spec, job Job) error {
+	if spec.Name == "" || job == nil {
+		return fmt.Errorf("%w: name and job are required", ErrInvalidSpec)
+	}
+	if (spec.Interval > 0) == (spec.Cron != "") {
+		return fmt.Errorf("%w: %s: exactly one of interval and cron must be set", ErrInvalidSpec, spec.Name)
+	}
+	e := &entry{spec: spec, job: job}
+	if spec.Cron != "" {
+		cron, err := ParseCron(spec.Cron)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrInvalidSpec, spec.Name, err)
+		}
+		e.cron = cron
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return fmt.Errorf("%w: %s: scheduler already started", ErrInvalidSpec, spec.Name)
+	}
+	if _, ok := s.entries[spec.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrJobExists, spec.Name)
+	}
+	s.entries[spec.Name] = e
+	return nil
+}
+
+// Start launches one timer loop per registered job.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	ctx, s.cancel = context.WithCancel(ctx)
+	for _, e := range s.entries {
+		s.wg.Add(1)
+		go func(e *entry) {
+			defer s.wg.Done()
+			s.loop(ctx, e)
+		}(e)
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	for {
+		next := e.next(time.Now())
+		if next.IsZero() {
+			s.log.Warn("job will never run again", zap.String("job", e.spec.Name))
+			return
+		}
+		e.mu.Lock()
+		e.nextRun = next
+		e.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if e.spec.RequiresLeader && !s.leader.IsLeader() {
+			s.log.Debug("skipping leader-only job", zap.String("job", e.spec.Name))
+			continue
+		}
+		if err := s.submit(ctx, e); err != nil {
+			s.log.Warn("job skipped", zap.String("job", e.spec.Name), zap.Error(err))
+		}
+	}
+}
+
+func (s *Scheduler) submit(ctx context.Context, e *entry) error {
+	if !e.running.CompareAndSwap(false, true) {
+		return ErrJobRunning
+	}
+	if err := s.pool.Submit(ctx, &jobTask{entry: e, log: s.log}); err != nil {
+		e.running.Store(false)
+		return err
+	}
+	return nil
+}
+
+// Trigger runs the named job now, outside of its schedule.
+func (s *Scheduler) Trigger(ctx context.Context, name string) error {
+	s.mu.RLock()
+	e, ok := s.entries[name]
+	s.mu.RUnlock()
+	if !ok {
+		return ErrJobNotFound
+	}
+	if e.spec.RequiresLeader && !s.leader.IsLeader() {
+		return ErrNotLeader
+	}
+	return s.submit(ctx, e)
+}
+
+// Jobs returns the status of every registered job sorted by name.
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]JobStatus, 0, len(s.entries))
+	for _, e := range s.entries {
+		result = append(result, e.status())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Stop halts the timer loops. Runs already submitted to the pool are left to the pool's own shutdown.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
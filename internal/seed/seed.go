@@ -0,0 +1,249 @@
+// Package seed generates demo data, the same for the same seed, and loads it
+// through the repository layer. Generate is free of side effects, so benchmarks
+// and load tests can build their data with it too.
+package seed
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+)
+
+var ErrInvalidOptions = errors.New("invalid seed options")
+
+// ErrProductionStore is returned by Guard for a production store that holds links.
+var ErrProductionStore = errors.New("refusing to seed a non-empty production store")
+
+// Shares of the generated links deleted, flagged and blocked after they are saved.
+const (
+	deletedShare = 0.05
+	flaggedShare = 0.02
+	blockedShare = 0.01
+)
+
+// batchSize bounds the links of one BatchSave.
+const batchSize = 500
+
+// destinations are the hosts links point to, weighted by how common they are.
+var destinations = []struct {
+	host   string
+	weight int
+}{
+	{"github.com", 20},
+	{"www.youtube.com", 18},
+	{"en.wikipedia.org", 14},
+	{"docs.google.com", 10},
+	{"stackoverflow.com", 8},
+	{"medium.com", 8},
+	{"www.reddit.com", 7},
+	{"news.ycombinator.com", 5},
+	{"habr.com", 5},
+	{"example.com", 5},
+}
+
+var pathWords = []string{
+	"blog", "docs", "watch", "wiki", "questions", "articles", "releases", "pulls", "issues",
+	"guide", "talks", "news", "post", "item", "spreadsheets", "reference", "tutorial",
+}
+
+// Options sizes the data: Clicks are spread over the links of Users.
+type Options struct {
+	Users  int
+	Links  int
+	Clicks int
+	Seed   int64
+}
+
+// Link is a generated link and what happens to it once saved.
+type Link struct {
+	URL        domain.URL
+	Clicks     int
+	Deleted    bool
+	Moderation domain.ModerationStatus
+}
+
+type Dataset struct {
+	Users []string
+	Links []Link
+}
+
+// Generate returns the data of opts. Owners and clicks both follow a zipfian
+// distribution, so a few users own most links and a few links get most clicks;
+// destinations are drawn from a weighted list of hosts. About 5% of the links are
+// to be deleted, 2% flagged and 1% blocked. Return ErrInvalidOptions unless there
+// are users and links, and clicks are not negative.
+func Generate(opts Options) (Dataset, error) {
+	if opts.Users <= 0 || opts.Links <= 0 || opts.Clicks < 0 {
+		return Dataset{}, fmt.Errorf("%w: users and links must be greater than 0, clicks not negative", ErrInvalidOptions)
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	ds := Dataset{Users: make([]string, opts.Users), Links: make([]Link, opts.Links)}
+	for i := range ds.Users {
+		id, err := uuid.NewRandomFromReader(rng)
+		if err != nil {
+			return Dataset{}, err
+		}
+		ds.Users[i] = id.String()
+	}
+
+	owners := zipf(rng, opts.Users)
+	codes := make(map[string]bool, opts.Links)
+	for i := range ds.Links {
+		link := &ds.Links[i]
+		link.URL = domain.URL{
+			ShortURL:    code(rng, codes),
+			OriginalURL: destination(rng, i),
+			UUID:        ds.Users[owners()],
+		}
+		switch roll := rng.Float64(); {
+		case roll < deletedShare:
+			link.Deleted = true
+		case roll < deletedShare+blockedShare:
+			link.Moderation = domain.ModerationBlocked
+		case roll < deletedShare+blockedShare+flaggedShare:
+			link.Moderation = domain.ModerationFlagged
+		}
+	}
+
+	// The most clicked links are spread over the dataset rather than the first ones.
+	order := rng.Perm(opts.Links)
+	clicked := zipf(rng, opts.Links)
+	for range opts.Clicks {
+		ds.Links[order[clicked()]].Clicks++
+	}
+	return ds, nil
+}
+
+// zipf returns a draw of indexes below n, 0 the most likely.
+func zipf(rng *rand.Rand, n int) func() int {
+	if n == 1 {
+		return func() int { return 0 }
+	}
+	z := rand.NewZipf(rng, 1.1, 1, uint64(n-1))
+	return func() int { return int(z.Uint64()) }
+}
+
+// code returns a short code not in taken, in the format of domain.URL.GenerateShortURL.
+func code(rng *rand.Rand, taken map[string]bool) string {
+	b := make([]byte, 4)
+	for {
+		rng.Read(b)
+		if c := hex.EncodeToString(b); !taken[c] {
+			taken[c] = true
+			return c
+		}
+	}
+}
+
+// destination returns the URL of the i-th link, unique since repositories give
+// a URL saved twice the code it already has.
+func destination(rng *rand.Rand, i int) string {
+	total := 0
+	for _, d := range destinations {
+		total += d.weight
+	}
+	pick := rng.Intn(total)
+	host := destinations[len(destinations)-1].host
+	for _, d := range destinations {
+		if pick < d.weight {
+			host = d.host
+			break
+		}
+		pick -= d.weight
+	}
+	path := []string{pathWords[rng.Intn(len(pathWords))], pathWords[rng.Intn(len(pathWords))]}
+	url := fmt.Sprintf("https://%s/%s/%d", host, strings.Join(path, "/"), i)
+	if rng.Intn(4) == 0 {
+		url += "?utm_source=seed&utm_campaign=" + pathWords[rng.Intn(len(pathWords))]
+	}
+	return url
+}
+
+// Summary is what Load stored. Clicks are only counted: there is no store for them.
+type Summary struct {
+	Users   int
+	Links   int
+	Deleted int
+	Flagged int
+	Blocked int
+	Clicks  int
+}
+
+// Load saves the links of ds through repo, then deletes and moderates those meant
+// to be. Links are moderated only if repo implements ports.URLModerationPort.
+// Loading the same data twice saves nothing new, as repositories keep the code a
+// URL already has.
+func Load(ctx context.Context, repo ports.URLRepositoryPort, ds Dataset) (Summary, error) {
+	summary := Summary{Users: len(ds.Users)}
+	urls := make([]*domain.URL, 0, batchSize)
+	for start := 0; start < len(ds.Links); start += batchSize {
+		urls = urls[:0]
+		for i := start; i < min(start+batchSize, len(ds.Links)); i++ {
+			url := ds.Links[i].URL
+			urls = append(urls, &url)
+		}
+		if err := repo.BatchSave(ctx, urls); err != nil {
+			return summary, fmt.Errorf("save links: %w", err)
+		}
+		summary.Links += len(urls)
+	}
+
+	deleted := make(map[string][]string)
+	moderation, _ := repo.(ports.URLModerationPort)
+	for _, link := range ds.Links {
+		summary.Clicks += link.Clicks
+		if link.Deleted {
+			deleted[link.URL.UUID] = append(deleted[link.URL.UUID], link.URL.ShortURL)
+		}
+		if link.Moderation == "" || moderation == nil {
+			continue
+		}
+		_, err := moderation.Moderate(ctx, link.URL.ShortURL, domain.Moderation{
+			Status: link.Moderation, Reason: domain.ReasonAdminReview, Actor: "seed",
+		})
+		switch {
+		case errors.Is(err, domain.ErrModerationTransition):
+			// Moderated by an earlier load.
+		case err != nil:
+			return summary, fmt.Errorf("moderate %s: %w", link.URL.ShortURL, err)
+		case link.Moderation == domain.ModerationFlagged:
+			summary.Flagged++
+		default:
+			summary.Blocked++
+		}
+	}
+	n, err := repo.BatchDelete(ctx, deleted)
+	summary.Deleted = n
+	if err != nil {
+		return summary, fmt.Errorf("delete links: %w", err)
+	}
+	return summary, nil
+}
+
+// Guard returns ErrProductionStore if environment is production and repo holds
+// links, or cannot count them.
+func Guard(ctx context.Context, repo ports.URLRepositoryPort, environment string) error {
+	if !strings.EqualFold(environment, "production") {
+		return nil
+	}
+	total, ok := repo.(ports.URLTotalPort)
+	if !ok {
+		return fmt.Errorf("%w: the repository cannot count its links", ErrProductionStore)
+	}
+	n, err := total.CountLinks(ctx)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("%w: it holds %d links", ErrProductionStore, n)
+	}
+	return nil
+}
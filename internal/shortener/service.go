@@ -0,0 +1,147 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/logger"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+)
+
+// DefaultMaxAttempts bounds the codes tried for one link, see WithMaxAttempts.
+const DefaultMaxAttempts = 5
+
+// ErrNoFreeCode is returned when every generated code was taken.
+var ErrNoFreeCode = errors.New("no free short code found")
+
+// CodeGenerator returns a candidate short code for originalURL. Candidates
+// need not be unique: the Service checks them against the repository.
+type CodeGenerator interface {
+	Generate(originalURL string) string
+}
+
+// GeneratorFunc adapts a function to CodeGenerator.
+type GeneratorFunc func(originalURL string) string
+
+func (f GeneratorFunc) Generate(originalURL string) string {
+	return f(originalURL)
+}
+
+// RandomGenerator is the default generator, see domain.URL.GenerateShortURL.
+var RandomGenerator = GeneratorFunc(func(originalURL string) string {
+	return domain.NewURL(originalURL).GenerateShortURL()
+})
+
+// Service owns the generation of short codes for every repository: a code is
+// checked with Exists before the insert, and the unique constraint of the
+// storage, reported as domain.ErrShortURLTaken, makes the save retry with a new one.
+// Codes chosen by the caller are saved as they are, without retries.
+type Service struct {
+	repo        ports.URLRepositoryPort
+	generator   CodeGenerator
+	maxAttempts int
+	log         *zap.Logger
+}
+
+type Option func(*Service)
+
+// WithGenerator sets the generator of candidate codes; the default is RandomGenerator.
+func WithGenerator(generator CodeGenerator) Option {
+	return func(s *Service) {
+		if generator != nil {
+			s.generator = generator
+		}
+	}
+}
+
+// WithMaxAttempts sets how many codes are tried for one link; non-positive values keep DefaultMaxAttempts.
+func WithMaxAttempts(n int) Option {
+	return func(s *Service) {
+		if n > 0 {
+			s.maxAttempts = n
+		}
+	}
+}
+
+func NewService(repo ports.URLRepositoryPort, opts ...Option) *Service {
+	s := &Service{
+		repo:        repo,
+		generator:   RandomGenerator,
+		maxAttempts: DefaultMaxAttempts,
+		log:         logger.GetLogger(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Code returns a generated code the repository reports free, and that is none of
+// domain.ReservedPaths. Return ErrNoFreeCode if every attempt collided.
+func (s *Service) Code(ctx context.Context, originalURL string) (string, error) {
+	for attempt := 1; attempt <= s.maxAttempts; attempt++ {
+		code := s.generator.Generate(originalURL)
+		if domain.IsReservedPath(code) {
+			s.log.Warn("generated short code is a reserved path", zap.String("short_url", code), zap.Int("attempt", attempt))
+			continue
+		}
+		taken, err := s.repo.Exists(ctx, code)
+		if err != nil {
+			return "", fmt.Errorf("unable to check short code: %w", err)
+		}
+		if !taken {
+			return code, nil
+		}
+		s.log.Warn("generated short code is taken", zap.String("short_url", code), zap.Int("attempt", attempt))
+	}
+	return "", fmt.Errorf("%w after %d attempts", ErrNoFreeCode, s.maxAttempts)
+}
+
+// Save saves url, generating its code unless one is set.
+func (s *Service) Save(ctx context.Context, url *domain.URL) error {
+	if url.ShortURL != "" {
+		return s.repo.Save(ctx, url)
+	}
+	return s.retry(ctx, []*domain.URL{url}, func() error { return s.repo.Save(ctx, url) })
+}
+
+// BatchSave saves urls in one repository call, generating the codes not set.
+// A collision makes the whole batch retry with new generated codes.
+func (s *Service) BatchSave(ctx context.Context, urls []*domain.URL) error {
+	generated := make([]*domain.URL, 0, len(urls))
+	for _, url := range urls {
+		if url.ShortURL == "" {
+			generated = append(generated, url)
+		}
+	}
+	if len(generated) == 0 {
+		return s.repo.BatchSave(ctx, urls)
+	}
+	return s.retry(ctx, generated, func() error { return s.repo.BatchSave(ctx, urls) })
+}
+
+// retry gives generated new codes and calls save until it succeeds or fails
+// otherwise than with a taken code. A code taken on the last attempt gives ErrNoFreeCode.
+func (s *Service) retry(ctx context.Context, generated []*domain.URL, save func() error) error {
+	for attempt := 1; ; attempt++ {
+		for _, url := range generated {
+			code, err := s.Code(ctx, url.OriginalURL)
+			if err != nil {
+				return err
+			}
+			url.ShortURL = code
+		}
+		err := save()
+		if !errors.Is(err, domain.ErrShortURLTaken) {
+			return err
+		}
+		if attempt == s.maxAttempts {
+			return fmt.Errorf("%w after %d attempts: %w", ErrNoFreeCode, attempt, err)
+		}
+		s.log.Warn("generated short code taken on insert, retrying", zap.Int("attempt", attempt))
+	}
+}
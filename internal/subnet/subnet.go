@@ -0,0 +1,88 @@
+package subnet
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/logger"
+)
+
+var log = logger.GetLogger()
+
+// ParseSubnet parses a CIDR string; an empty string means no subnet is trusted.
+func ParseSubnet(cidr string) (*net.IPNet, error) {
+	if cidr == "" {
+		return nil, nil
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted subnet %q: %w", cidr, err)
+	}
+	return ipNet, nil
+}
+
+// ParseProxies parses a comma separated list of CIDRs or single IPs; an empty
+// string means no proxy is trusted.
+func ParseProxies(list string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+// ClientIP returns the peer address of the request, or its X-Real-IP header when
+// the peer is one of proxies. Nil if the address does not parse.
+func ClientIP(c *gin.Context, proxies []*net.IPNet) net.IP {
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil || !contains(proxies, ip) {
+		return ip
+	}
+	return net.ParseIP(strings.TrimSpace(c.GetHeader("X-Real-IP")))
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustedSubnetMiddleware rejects requests whose client address is outside trusted.
+// The client address is the peer address of the connection; forwarding headers are
+// only believed from proxies, see ClientIP.
+func TrustedSubnetMiddleware(trusted *net.IPNet, proxies ...*net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := ClientIP(c, proxies)
+		if trusted == nil || ip == nil || !trusted.Contains(ip) {
+			log.Warn("Request from untrusted address", zap.String("ip", c.RemoteIP()),
+				zap.String("real_ip", c.GetHeader("X-Real-IP")), zap.String("path", c.Request.URL.Path))
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
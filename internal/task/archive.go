@@ -0,0 +1,40 @@
+package task
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/logger"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+)
+
+// ArchiveJob moves links older than maxAge and not visited for idleFor to the
+// repository's cold storage.
+type ArchiveJob struct {
+	storage ports.URLRepositoryPort
+	maxAge  time.Duration
+	idleFor time.Duration
+	log     *zap.Logger
+}
+
+func NewArchiveJob(storage ports.URLRepositoryPort, maxAge, idleFor time.Duration) *ArchiveJob {
+	return &ArchiveJob{
+		storage: storage,
+		maxAge:  maxAge,
+		idleFor: idleFor,
+		log:     logger.GetLogger(),
+	}
+}
+
+func (a *ArchiveJob) Run(ctx context.Context) error {
+	now := time.Now()
+	moved, err := a.storage.Archive(ctx, now.Add(-a.maxAge), now.Add(-a.idleFor))
+	if err != nil {
+		return err
+	}
+	a.log.Info("ArchiveJob: archived links", zap.Int("count", moved),
+		zap.Duration("max_age", a.maxAge), zap.Duration("idle_for", a.idleFor))
+	return nil
+}
@@ -5,12 +5,31 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/errstore"
 	"github.com/OrtemRepos/shortlink/internal/logger"
 	"github.com/OrtemRepos/shortlink/internal/ports"
+	"github.com/OrtemRepos/shortlink/internal/taskgroup"
+)
+
+// ErrFlushTimeout wraps the error of a flush whose BatchDelete outlived its timeout.
+var ErrFlushTimeout = errors.New("delete flush timed out")
+
+// FlushGoroutine names the goroutines of flushes in the task group of a BatcherDeleteTask.
+const FlushGoroutine = "batcher.flush"
+
+// maxErrors bounds the flush errors kept by a BatcherDeleteTask.
+const maxErrors = 100
+
+// Default flush timeouts, see WithFlushTimeouts.
+const (
+	DefaultFlushTimeout      = 10 * time.Second
+	DefaultFinalFlushTimeout = 30 * time.Second
 )
 
 type Task struct {
@@ -18,112 +37,320 @@ type Task struct {
 	CreatedAt string `json:"created_at"`
 }
 
+// DeleteMetrics counts the flushes of a BatcherDeleteTask.
+type DeleteMetrics struct {
+	Flushes   int64 `json:"flushes"`
+	Requested int64 `json:"requested"`
+	Deleted   int64 `json:"deleted"`
+	Failed    int64 `json:"failed"`
+	TimedOut  int64 `json:"timed_out"`
+}
+
+// DeleteRequest asks a BatcherDeleteTask to delete the short URLs of each user in IDs.
+// RequestID is the ID of the request asking for it, if any, logged with its flush.
+type DeleteRequest struct {
+	IDs       map[string][]string
+	RequestID string
+}
+
 type BatcherDeleteTask struct {
 	storage    ports.URLRepositoryPort
 	bufferSize int
 	buffer     map[string][]string
+	requestIDs []string
 	mu         sync.Mutex
-	errMu      sync.Mutex
-	inputChan  <-chan map[string][]string
+	inputChan  <-chan DeleteRequest
 	timeout    time.Duration
-	errSlice   []error
+	errors     *errstore.Store
+	clock      clock.Clock
+	tasks      *taskgroup.Group
 	log        *zap.Logger
+
+	flushTimeout      time.Duration
+	finalFlushTimeout time.Duration
+	flushing          sync.WaitGroup
+	onFlushed         func(userIDs []string)
+
+	flushes   atomic.Int64
+	requested atomic.Int64
+	deleted   atomic.Int64
+	failed    atomic.Int64
+	timedOut  atomic.Int64
+}
+
+type BatcherOption func(*BatcherDeleteTask)
+
+// WithBatcherClock sets the clock driving the flush ticker; the default is the real clock.
+func WithBatcherClock(c clock.Clock) BatcherOption {
+	return func(b *BatcherDeleteTask) {
+		b.clock = clock.OrReal(c)
+	}
+}
+
+// WithBatcherLogger sets the logger of flushes; the default is the application logger.
+func WithBatcherLogger(log *zap.Logger) BatcherOption {
+	return func(b *BatcherDeleteTask) {
+		b.log = log
+	}
+}
+
+// WithBatcherTaskGroup runs flushes in tasks, as FlushGoroutine. A cap on
+// FlushGoroutine makes a flush wait for an earlier one to end.
+func WithBatcherTaskGroup(tasks *taskgroup.Group) BatcherOption {
+	return func(b *BatcherDeleteTask) {
+		b.tasks = tasks
+	}
+}
+
+// WithFlushTimeouts bounds each BatchDelete call: regular for flushes while running,
+// final for the flush made when the batcher stops. Non-positive values keep the defaults.
+func WithFlushTimeouts(regular, final time.Duration) BatcherOption {
+	return func(b *BatcherDeleteTask) {
+		if regular > 0 {
+			b.flushTimeout = regular
+		}
+		if final > 0 {
+			b.finalFlushTimeout = final
+		}
+	}
+}
+
+// WithOnFlushed calls onFlushed with the users of every flush once BatchDelete
+// returned, failed or not, say to forget what was cached about their links.
+func WithOnFlushed(onFlushed func(userIDs []string)) BatcherOption {
+	return func(b *BatcherDeleteTask) {
+		b.onFlushed = onFlushed
+	}
 }
 
 func NewBatcherDeleteTask(
-	inputChan <-chan map[string][]string,
+	inputChan <-chan DeleteRequest,
 	storage ports.URLRepositoryPort,
-	bufferSize int, timeout time.Duration) *BatcherDeleteTask {
-	return &BatcherDeleteTask{
+	bufferSize int, timeout time.Duration,
+	opts ...BatcherOption) *BatcherDeleteTask {
+	b := &BatcherDeleteTask{
 		storage:    storage,
 		bufferSize: bufferSize,
 		buffer:     make(map[string][]string, bufferSize),
 		inputChan:  inputChan,
 		timeout:    timeout,
-		errSlice:   make([]error, 0, bufferSize),
+		clock:      clock.Real{},
 		log:        logger.GetLogger(),
+
+		flushTimeout:      DefaultFlushTimeout,
+		finalFlushTimeout: DefaultFinalFlushTimeout,
+	}
+	for _, opt := range opts {
+		opt(b)
 	}
+	b.errors = errstore.NewStore(maxErrors, b.clock)
+	return b
 }
 
 func (b *BatcherDeleteTask) run(ctx context.Context) {
-	ticker := time.NewTicker(b.timeout)
+	ticker := b.clock.NewTicker(b.timeout)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
-			b.flush(ctx)
+			b.flush(ctx, true)
 			return
-		case <-ticker.C:
-			b.flush(ctx)
-		case ids, ok := <-b.inputChan:
+		case <-ticker.C():
+			b.flush(ctx, false)
+		case req, ok := <-b.inputChan:
 			if !ok {
-				b.flush(ctx)
+				b.flush(ctx, true)
 				return
 			}
-			if len(b.buffer)+len(ids) >= b.bufferSize {
-				b.flush(ctx)
+			b.add(ctx, req)
+		}
+	}
+}
+
+// add buffers req, flushing first if it would fill the buffer.
+func (b *BatcherDeleteTask) add(ctx context.Context, req DeleteRequest) {
+	b.mu.Lock()
+	full := len(b.buffer)+len(req.IDs) >= b.bufferSize
+	b.mu.Unlock()
+	if full {
+		b.flush(ctx, false)
+	}
+	b.addToBuffer(req)
+}
+
+// drainInput buffers the requests waiting in the input without blocking and
+// reports whether the input is closed.
+func (b *BatcherDeleteTask) drainInput(ctx context.Context) bool {
+	for {
+		select {
+		case req, ok := <-b.inputChan:
+			if !ok {
+				return true
 			}
-			b.addToBuffer(ids)
+			b.add(ctx, req)
+		default:
+			return false
 		}
 	}
 }
 
-func (b *BatcherDeleteTask) addToBuffer(ids map[string][]string) {
+func (b *BatcherDeleteTask) addToBuffer(req DeleteRequest) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	b.log.Info("BatcherDeleteTask: adding ids to buffer", zap.Any("ids", ids))
-	for key, value := range ids {
+	b.log.Info("BatcherDeleteTask: adding ids to buffer", zap.Any("ids", req.IDs), zap.String("request_id", req.RequestID))
+	for key, value := range req.IDs {
 		b.buffer[key] = append(b.buffer[key], value...)
 	}
+	if req.RequestID != "" {
+		b.requestIDs = append(b.requestIDs, req.RequestID)
+	}
 }
 
-func (b *BatcherDeleteTask) flush(ctx context.Context) {
+// flush deletes the buffered ids in the background. The deletion does not end with ctx,
+// so the final flush of a stopping batcher completes, but it is bounded by a flush timeout.
+func (b *BatcherDeleteTask) flush(ctx context.Context, final bool) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	if len(b.buffer) == 0 {
 		return
 	}
-	idsToDelete := b.buffer
-	b.buffer = make(map[string][]string, b.bufferSize)
-	b.log.Info("BatcherDeleteTask: flushing buffer", zap.Any("ids", idsToDelete))
-	go func(ctx context.Context, idsToDelete map[string][]string) {
-		b.log.Info("BatcherDeleteTask: deleting ids", zap.Any("ids", idsToDelete))
-		err := b.storage.BatchDelete(ctx, idsToDelete)
+	idsToDelete, requestIDs := b.buffer, b.requestIDs
+	b.buffer, b.requestIDs = make(map[string][]string, b.bufferSize), nil
+	timeout := b.flushTimeout
+	if final {
+		timeout = b.finalFlushTimeout
+	}
+	log := b.log.With(zap.Strings("request_ids", requestIDs))
+	log.Info("BatcherDeleteTask: flushing buffer", zap.Any("ids", idsToDelete), zap.Bool("final", final))
+	flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	b.flushing.Add(1)
+	err := b.tasks.Go(ctx, FlushGoroutine, func() {
+		defer b.flushing.Done()
+		defer cancel()
+		log.Info("BatcherDeleteTask: deleting ids", zap.Any("ids", idsToDelete))
+		deleted, err := b.storage.BatchDelete(flushCtx, idsToDelete)
+		if err != nil && errors.Is(flushCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("%w after %s: %w", ErrFlushTimeout, timeout, err)
+			b.timedOut.Add(1)
+		}
+		if b.onFlushed != nil {
+			userIDs := make([]string, 0, len(idsToDelete))
+			for userID := range idsToDelete {
+				userIDs = append(userIDs, userID)
+			}
+			b.onFlushed(userIDs)
+		}
+		b.flushes.Add(1)
+		b.deleted.Add(int64(deleted))
+		for _, shortURLs := range idsToDelete {
+			b.requested.Add(int64(len(shortURLs)))
+		}
 		if err != nil {
-			b.reportError(err)
-			b.log.Error("BatcherDeleteTask: failed to delete ids", zap.Error(err), zap.Any("ids", idsToDelete))
+			b.failed.Add(1)
+			b.errors.Add(err)
+			log.Error("BatcherDeleteTask: failed to delete ids", zap.Error(err), zap.Any("ids", idsToDelete))
 		}
-		b.log.Info("BatcherDeleteTask: deleted ids", zap.Any("ids", idsToDelete))
-	}(ctx, idsToDelete)
+		log.Info("BatcherDeleteTask: deleted ids", zap.Any("ids", idsToDelete), zap.Int("deleted", deleted))
+	})
+	if err != nil {
+		// No flush slot freed up before ctx ended: keep the ids for the next flush.
+		b.flushing.Done()
+		cancel()
+		for key, value := range idsToDelete {
+			b.buffer[key] = append(b.buffer[key], value...)
+		}
+		b.requestIDs = append(b.requestIDs, requestIDs...)
+		log.Warn("BatcherDeleteTask: flush postponed", zap.Error(err))
+	}
 }
 
+// Execute batches deletions until ctx ends or the input is closed, holding a worker
+// all along. A pool can run FlushTask with SubmitEvery instead.
 func (b *BatcherDeleteTask) Execute(ctx context.Context) error {
 	b.log.Info("BatcherDeleteTask: starting")
-	errBuffer := 100
-	b.errSlice = make([]error, 0, errBuffer)
-	go b.run(ctx)
-	<-ctx.Done()
-	return b.getErr()
+	// run returns when ctx is done or the input channel is closed.
+	b.run(ctx)
+	b.flushing.Wait()
+	return errstore.Join(b.errors.Recent())
+}
+
+// FlushTask returns the task emptying the input into the buffer and flushing it,
+// meant to be run with WorkerPool.SubmitEvery at the flush interval. Once the input
+// is closed it makes the final flush; FinalFlush must still be called after the
+// last run to wait for the deletions.
+func (b *BatcherDeleteTask) FlushTask() *BatcherFlushTask {
+	return &BatcherFlushTask{batcher: b}
 }
 
-func (b *BatcherDeleteTask) getErr() error {
-	b.errMu.Lock()
-	defer b.errMu.Unlock()
-	err := errors.Join(b.errSlice...)
-	return err
+// FinalFlush buffers what is left in the closed input, flushes it with the final
+// flush timeout and waits for every flush to end. It must be called once no run of
+// FlushTask can start anymore, after the input is closed.
+func (b *BatcherDeleteTask) FinalFlush(ctx context.Context) error {
+	b.drainInput(ctx)
+	b.flush(ctx, true)
+	b.flushing.Wait()
+	return errstore.Join(b.errors.Recent())
 }
 
-func (b *BatcherDeleteTask) reportError(err error) {
-	b.errMu.Lock()
-	defer b.errMu.Unlock()
-	b.errSlice = append(b.errSlice, err)
+// BatcherFlushTask is one flush of a BatcherDeleteTask, see FlushTask.
+type BatcherFlushTask struct {
+	batcher *BatcherDeleteTask
 }
 
+func (t *BatcherFlushTask) Execute(ctx context.Context) error {
+	closed := t.batcher.drainInput(ctx)
+	t.batcher.flush(ctx, closed)
+	return nil
+}
+
+func (t *BatcherFlushTask) Stringer() string {
+	return fmt.Sprintf("BatcherFlushTask{bufferSize: %d}", t.batcher.bufferSize)
+}
+
+func (t *BatcherFlushTask) Kind() string { return DeleteKind }
+
+// Metrics returns the counters of completed flushes. Failed counts flushes where any user failed,
+// TimedOut those of them that ran out of time.
+func (b *BatcherDeleteTask) Metrics() DeleteMetrics {
+	return DeleteMetrics{
+		Flushes:   b.flushes.Load(),
+		Requested: b.requested.Load(),
+		Deleted:   b.deleted.Load(),
+		Failed:    b.failed.Load(),
+		TimedOut:  b.timedOut.Load(),
+	}
+}
+
+// BatcherConfig is what a BatcherDeleteTask runs with: it flushes every FlushInterval,
+// or as soon as BufferSize users are buffered.
+type BatcherConfig struct {
+	BufferSize        int           `json:"buffer_size"`
+	FlushInterval     time.Duration `json:"flush_interval"`
+	FlushTimeout      time.Duration `json:"flush_timeout"`
+	FinalFlushTimeout time.Duration `json:"final_flush_timeout"`
+}
+
+// Config returns the settings the batcher runs with.
+func (b *BatcherDeleteTask) Config() BatcherConfig {
+	return BatcherConfig{
+		BufferSize:        b.bufferSize,
+		FlushInterval:     b.timeout,
+		FlushTimeout:      b.flushTimeout,
+		FinalFlushTimeout: b.finalFlushTimeout,
+	}
+}
+
+// Errors returns the store of the last flush errors.
+func (b *BatcherDeleteTask) Errors() *errstore.Store {
+	return b.errors
+}
+
+// Stringer leaves out the buffer: it holds user IDs and is written by running flushes.
 func (b *BatcherDeleteTask) Stringer() string {
-	str := fmt.Sprintf(`BatcherDeleteTask{
-		storage: %v,
-		buffer: %v,
-		errSlice: %v,
-	}`, b.storage, b.buffer, b.errSlice)
-	return str
+	return fmt.Sprintf("BatcherDeleteTask{bufferSize: %d}", b.bufferSize)
 }
+
+// DeleteKind counts the tasks of the delete batcher apart in the metrics of their pool.
+const DeleteKind = "delete"
+
+func (b *BatcherDeleteTask) Kind() string { return DeleteKind }
@@ -0,0 +1,48 @@
+package task
+
+import (
+	"context"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/errstore"
+	"github.com/OrtemRepos/shortlink/internal/logger"
+)
+
+// ErrorLogJob logs the errors added to stores since its last run, one line per
+// distinct error of a store, so errors nobody asks for still reach the logs.
+type ErrorLogJob struct {
+	stores map[string]*errstore.Store
+	log    *zap.Logger
+}
+
+// NewErrorLogJob returns a job logging the errors of stores, keyed by the name of their component.
+func NewErrorLogJob(stores map[string]*errstore.Store) *ErrorLogJob {
+	return &ErrorLogJob{stores: stores, log: logger.GetLogger()}
+}
+
+func (j *ErrorLogJob) Run(ctx context.Context) error {
+	names := make([]string, 0, len(j.stores))
+	for name := range j.stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		entries, missed := j.stores[name].Collect()
+		for _, group := range errstore.GroupByError(entries) {
+			j.log.Error("ErrorLogJob: errors reported",
+				zap.String("source", name),
+				zap.String("error", group.Error),
+				zap.Int("count", group.Count),
+				zap.Time("first", group.First),
+				zap.Time("last", group.Last),
+			)
+		}
+		if missed > 0 {
+			j.log.Warn("ErrorLogJob: errors dropped before being logged",
+				zap.String("source", name), zap.Int64("count", missed))
+		}
+	}
+	return nil
+}
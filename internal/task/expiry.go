@@ -0,0 +1,31 @@
+package task
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/logger"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+)
+
+// ExpiredLinksJob retires expired links in storage. Expired links already answer
+// 410 Gone before the job reaches them; it keeps lists and counts of users clean.
+type ExpiredLinksJob struct {
+	storage ports.URLExpiryPort
+	log     *zap.Logger
+}
+
+func NewExpiredLinksJob(storage ports.URLExpiryPort) *ExpiredLinksJob {
+	return &ExpiredLinksJob{storage: storage, log: logger.GetLogger()}
+}
+
+func (j *ExpiredLinksJob) Run(ctx context.Context) error {
+	purged, err := j.storage.PurgeExpiredLinks(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	j.log.Info("ExpiredLinksJob: retired expired links", zap.Int("count", purged))
+	return nil
+}
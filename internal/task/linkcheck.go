@@ -0,0 +1,121 @@
+package task
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/linkcheck"
+	"github.com/OrtemRepos/shortlink/internal/logger"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+	"github.com/OrtemRepos/shortlink/internal/taskgroup"
+)
+
+// CheckGoroutine names the goroutines of checks in the task group of a LinkCheckJob.
+const CheckGoroutine = "linkcheck.check"
+
+// LinkCheckJob checks the destinations of links not checked for recheckAfter,
+// batchSize links per run, and records the outcome of every check.
+type LinkCheckJob struct {
+	storage      ports.URLHealthPort
+	checker      *linkcheck.Checker
+	recheckAfter time.Duration
+	batchSize    int
+	concurrency  int
+	clock        clock.Clock
+	tasks        *taskgroup.Group
+	log          *zap.Logger
+}
+
+type LinkCheckOption func(*LinkCheckJob)
+
+// WithLinkCheckClock sets the clock check times are taken from; the default is the real clock.
+func WithLinkCheckClock(c clock.Clock) LinkCheckOption {
+	return func(j *LinkCheckJob) {
+		j.clock = clock.OrReal(c)
+	}
+}
+
+// WithLinkCheckTaskGroup runs checks in tasks, as CheckGoroutine.
+func WithLinkCheckTaskGroup(tasks *taskgroup.Group) LinkCheckOption {
+	return func(j *LinkCheckJob) {
+		j.tasks = tasks
+	}
+}
+
+func NewLinkCheckJob(storage ports.URLHealthPort, checker *linkcheck.Checker,
+	recheckAfter time.Duration, batchSize, concurrency int, opts ...LinkCheckOption) *LinkCheckJob {
+	if batchSize <= 0 || concurrency <= 0 {
+		panic("link check batch size and concurrency must be greater than 0")
+	}
+	j := &LinkCheckJob{
+		storage:      storage,
+		checker:      checker,
+		recheckAfter: recheckAfter,
+		batchSize:    batchSize,
+		concurrency:  concurrency,
+		clock:        clock.Real{},
+		log:          logger.GetLogger(),
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
+}
+
+// Run records the checks that completed even when ctx ends the run early.
+func (j *LinkCheckJob) Run(ctx context.Context) error {
+	links, err := j.storage.LinksToCheck(ctx, j.clock.Now().Add(-j.recheckAfter), j.batchSize)
+	if err != nil {
+		return err
+	}
+	checks := make([]domain.LinkCheck, 0, len(links))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, j.concurrency)
+	for _, link := range links {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		err := j.tasks.Go(ctx, CheckGoroutine, func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			status := j.checker.Check(ctx, link.OriginalURL)
+			if ctx.Err() != nil {
+				return
+			}
+			mu.Lock()
+			checks = append(checks, domain.LinkCheck{ShortURL: link.ShortURL, CheckedAt: j.clock.Now(), Status: status})
+			mu.Unlock()
+		})
+		if err != nil {
+			wg.Done()
+			<-sem
+			break
+		}
+	}
+	wg.Wait()
+	if len(checks) > 0 {
+		// The run context may be done; the checks made are still worth keeping.
+		if err := j.storage.RecordChecks(context.WithoutCancel(ctx), checks); err != nil {
+			return err
+		}
+	}
+	broken := 0
+	for _, check := range checks {
+		if linkcheck.HealthOf(check.Status) == linkcheck.HealthBroken {
+			broken++
+		}
+	}
+	j.log.Info("LinkCheckJob: checked links", zap.Int("count", len(checks)), zap.Int("broken", broken))
+	return ctx.Err()
+}
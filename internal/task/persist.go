@@ -0,0 +1,72 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/events"
+	"github.com/OrtemRepos/shortlink/internal/logger"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+)
+
+// PersistTask saves a link whose short code was already handed to the client.
+// If the save fails or the repository keeps a different code, the cache entry
+// primed for the optimistic code is evicted and a PersistFailed event is published.
+type PersistTask struct {
+	storage ports.URLRepositoryPort
+	cache   ports.URLCachePort
+	bus     *events.Bus
+	url     domain.URL
+	log     *zap.Logger
+}
+
+// NewPersistTask returns a task persisting url; cache may be nil.
+func NewPersistTask(storage ports.URLRepositoryPort, cache ports.URLCachePort,
+	bus *events.Bus, url domain.URL) *PersistTask {
+	return &PersistTask{
+		storage: storage,
+		cache:   cache,
+		bus:     bus,
+		url:     url,
+		log:     logger.GetLogger(),
+	}
+}
+
+func (p *PersistTask) Execute(ctx context.Context) error {
+	optimistic := p.url.ShortURL
+	url := p.url
+	err := p.storage.Save(ctx, &url)
+	if errors.Is(err, domain.ErrURLAlreadyExists) && url.ShortURL != optimistic {
+		err = fmt.Errorf("%w under code %s", err, url.ShortURL)
+	} else if errors.Is(err, domain.ErrURLAlreadyExists) {
+		err = nil
+	}
+	if err == nil {
+		return nil
+	}
+	p.compensate(optimistic, err)
+	return fmt.Errorf("persist %s: %w", optimistic, err)
+}
+
+func (p *PersistTask) compensate(shortURL string, err error) {
+	if p.cache != nil {
+		p.cache.Evict(shortURL)
+	}
+	p.log.Error("PersistTask: optimistic save failed", zap.String("short_url", shortURL), zap.Error(err))
+	p.bus.Publish(events.Event{
+		Type:   events.PersistFailed,
+		UserID: p.url.UUID,
+		Attrs: map[string]string{
+			"short_url": shortURL,
+			"error":     err.Error(),
+		},
+	})
+}
+
+func (p *PersistTask) Stringer() string {
+	return fmt.Sprintf("PersistTask{short_url: %s}", p.url.ShortURL)
+}
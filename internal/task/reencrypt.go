@@ -0,0 +1,35 @@
+package task
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/logger"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+)
+
+// ReencryptJob brings every stored original URL onto the primary encryption key,
+// encrypting legacy plaintext rows and rows written with a rotated-out key.
+type ReencryptJob struct {
+	storage   ports.URLReencryptPort
+	batchSize int
+	log       *zap.Logger
+}
+
+func NewReencryptJob(storage ports.URLReencryptPort, batchSize int) *ReencryptJob {
+	return &ReencryptJob{
+		storage:   storage,
+		batchSize: batchSize,
+		log:       logger.GetLogger(),
+	}
+}
+
+func (j *ReencryptJob) Run(ctx context.Context) error {
+	updated, err := j.storage.Reencrypt(ctx, j.batchSize)
+	if err != nil {
+		return err
+	}
+	j.log.Info("ReencryptJob: re-encrypted links", zap.Int("count", updated))
+	return nil
+}
@@ -0,0 +1,31 @@
+package task
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/logger"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+)
+
+// ReservationCleanupJob removes expired reservations, freeing their codes in storage.
+// Expired reservations already resolve as unknown links before the job reaches them.
+type ReservationCleanupJob struct {
+	storage ports.URLReservationPort
+	log     *zap.Logger
+}
+
+func NewReservationCleanupJob(storage ports.URLReservationPort) *ReservationCleanupJob {
+	return &ReservationCleanupJob{storage: storage, log: logger.GetLogger()}
+}
+
+func (j *ReservationCleanupJob) Run(ctx context.Context) error {
+	purged, err := j.storage.PurgeExpiredReservations(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	j.log.Info("ReservationCleanupJob: removed expired reservations", zap.Int("count", purged))
+	return nil
+}
@@ -0,0 +1,21 @@
+package task
+
+import (
+	"context"
+
+	"github.com/OrtemRepos/shortlink/internal/ports"
+)
+
+// SnapshotJob writes the links a repository holds in memory to disk, so a secondary
+// repository still knows them after a restart.
+type SnapshotJob struct {
+	storage ports.URLSnapshotPort
+}
+
+func NewSnapshotJob(storage ports.URLSnapshotPort) *SnapshotJob {
+	return &SnapshotJob{storage: storage}
+}
+
+func (j *SnapshotJob) Run(ctx context.Context) error {
+	return j.storage.SaveSnapshot(ctx)
+}
@@ -0,0 +1,30 @@
+package task
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/OrtemRepos/shortlink/internal/ports"
+)
+
+// VisitTask counts one redirect served by a link. It is submitted once the
+// visitor was answered, so a failure only loses the count.
+type VisitTask struct {
+	storage  ports.URLRepositoryPort
+	shortURL string
+}
+
+func NewVisitTask(storage ports.URLRepositoryPort, shortURL string) *VisitTask {
+	return &VisitTask{storage: storage, shortURL: shortURL}
+}
+
+func (v *VisitTask) Execute(ctx context.Context) error {
+	if err := v.storage.IncrementVisit(ctx, v.shortURL); err != nil {
+		return fmt.Errorf("count visit of %s: %w", v.shortURL, err)
+	}
+	return nil
+}
+
+func (v *VisitTask) Stringer() string {
+	return fmt.Sprintf("VisitTask{short_url: %s}", v.shortURL)
+}
@@ -0,0 +1,170 @@
+// Package taskgroup launches the background goroutines of the service under a name,
+// so the ones still running can be counted, capped and waited for on shutdown.
+package taskgroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/logger"
+)
+
+// ErrStillRunning is returned by Wait when goroutines outlive its ctx.
+var ErrStillRunning = errors.New("goroutines still running")
+
+// Group counts the goroutines it launched that are still running, by name.
+// A nil Group launches goroutines untracked, so components work without one.
+type Group struct {
+	mu      sync.Mutex
+	running map[string]int
+	total   int
+	idle    chan struct{}
+	slots   map[string]chan struct{}
+	log     *zap.Logger
+}
+
+type Option func(*Group)
+
+// WithLimit caps the goroutines of name running at once to n; Go waits for one
+// of them to end past it. Non-positive n leaves name unlimited.
+func WithLimit(name string, n int) Option {
+	return func(g *Group) {
+		if n > 0 {
+			g.slots[name] = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithLogger sets the logger Wait reports leftover goroutines to; the default is
+// the application logger.
+func WithLogger(log *zap.Logger) Option {
+	return func(g *Group) {
+		if log != nil {
+			g.log = log
+		}
+	}
+}
+
+func New(opts ...Option) *Group {
+	g := &Group{
+		running: make(map[string]int),
+		slots:   make(map[string]chan struct{}),
+		log:     logger.GetLogger(),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// Go runs fn in a new goroutine counted under name until fn returns. If name is
+// capped and at its limit, Go first waits for a slot and returns ctx.Err() without
+// running fn if ctx ends meanwhile; otherwise it returns nil at once.
+func (g *Group) Go(ctx context.Context, name string, fn func()) error {
+	if g == nil {
+		go fn()
+		return nil
+	}
+	slots := g.slots[name]
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	g.enter(name)
+	go func() {
+		defer g.leave(name, slots)
+		fn()
+	}()
+	return nil
+}
+
+// Running returns the goroutines still running by name; names with none are left out.
+func (g *Group) Running() map[string]int {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return maps.Clone(g.running)
+}
+
+// Wait waits until no goroutine of g is running. If ctx ends first it logs the names
+// still running and returns ErrStillRunning listing them.
+func (g *Group) Wait(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	if g.total == 0 {
+		g.mu.Unlock()
+		return nil
+	}
+	if g.idle == nil {
+		g.idle = make(chan struct{})
+	}
+	idle := g.idle
+	g.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+	}
+	running := g.Running()
+	names := slices.Sorted(maps.Keys(running))
+	g.log.Error("goroutines still running after shutdown", zap.Strings("names", names), zap.Any("running", running))
+	return fmt.Errorf("%w: %v: %w", ErrStillRunning, names, ctx.Err())
+}
+
+func (g *Group) enter(name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.running[name]++
+	g.total++
+}
+
+func (g *Group) leave(name string, slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.running[name]--; g.running[name] == 0 {
+		delete(g.running, name)
+	}
+	if g.total--; g.total == 0 && g.idle != nil {
+		close(g.idle)
+		g.idle = nil
+	}
+}
+
+var goroutinesDesc = prometheus.NewDesc("shortlink_goroutines",
+	"Background goroutines still running, by name.", []string{"name"}, nil)
+
+// Collector exports Running as the shortlink_goroutines gauge, labelled by name.
+func (g *Group) Collector() prometheus.Collector {
+	return collector{g}
+}
+
+type collector struct {
+	group *Group
+}
+
+func (c collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- goroutinesDesc
+}
+
+func (c collector) Collect(ch chan<- prometheus.Metric) {
+	for name, n := range c.group.Running() {
+		ch <- prometheus.MustNewConstMetric(goroutinesDesc, prometheus.GaugeValue, float64(n), name)
+	}
+}
@@ -0,0 +1,175 @@
+package timing
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/requestid"
+)
+
+// HeaderName is the response header carrying the phase breakdown.
+const HeaderName = "Server-Timing"
+
+// preallocated phases per request; more are appended as needed.
+const defaultPhases = 8
+
+type Phase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Collector accumulates the named phases of one request.
+// All methods are safe on a nil Collector, so callers need not check for one.
+type Collector struct {
+	mu     sync.Mutex
+	phases []Phase
+	start  time.Time
+}
+
+var collectors = sync.Pool{
+	New: func() any { return &Collector{phases: make([]Phase, 0, defaultPhases)} },
+}
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, c *Collector) context.Context {
+	return context.WithValue(ctx, ctxKey{}, c)
+}
+
+func FromContext(ctx context.Context) *Collector {
+	c, _ := ctx.Value(ctxKey{}).(*Collector)
+	return c
+}
+
+// Record adds the phase name, started at start, to the collector of ctx if any.
+// Meant to be deferred: defer timing.Record(ctx, "repo.Find", time.Now()).
+func Record(ctx context.Context, name string, start time.Time) {
+	FromContext(ctx).Add(name, time.Since(start))
+}
+
+func (c *Collector) Add(name string, d time.Duration) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.phases = append(c.phases, Phase{Name: name, Duration: d})
+	c.mu.Unlock()
+}
+
+func (c *Collector) Phases() []Phase {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Phase(nil), c.phases...)
+}
+
+// AppendHeader appends the phases and the time elapsed so far as "total",
+// in Server-Timing syntax: "name;dur=1.234, total;dur=2.5" (milliseconds).
+func (c *Collector) AppendHeader(dst []byte) []byte {
+	if c == nil {
+		return dst
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range c.phases {
+		dst = appendMetric(dst, p.Name, p.Duration)
+		dst = append(dst, ", "...)
+	}
+	return appendMetric(dst, "total", time.Since(c.start))
+}
+
+func appendMetric(dst []byte, name string, d time.Duration) []byte {
+	dst = append(dst, name...)
+	dst = append(dst, ";dur="...)
+	return strconv.AppendFloat(dst, float64(d.Microseconds())/1000, 'f', -1, 64)
+}
+
+func (c *Collector) reset() {
+	c.phases = c.phases[:0]
+	c.start = time.Now()
+}
+
+// headerWriter sets the Server-Timing header just before the response headers
+// are sent, so it covers every phase recorded until then.
+type headerWriter struct {
+	gin.ResponseWriter
+	ctx       *gin.Context
+	collector *Collector
+	trusted   *net.IPNet
+	written   bool
+}
+
+func (w *headerWriter) setHeader() {
+	if w.written || w.ResponseWriter.Written() {
+		return
+	}
+	w.written = true
+	if !w.allowed() {
+		return
+	}
+	var buf [256]byte
+	w.Header().Set(HeaderName, string(w.collector.AppendHeader(buf[:0])))
+}
+
+// allowed limits the header to authenticated users and internal callers,
+// as phase names and durations describe the infrastructure.
+func (w *headerWriter) allowed() bool {
+	if w.ctx.GetString("UserID") != "" {
+		return true
+	}
+	ip := net.ParseIP(w.ctx.RemoteIP())
+	return w.trusted != nil && ip != nil && w.trusted.Contains(ip)
+}
+
+func (w *headerWriter) WriteHeaderNow() {
+	w.setHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *headerWriter) WriteString(s string) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Middleware puts a Collector in the request context.
+// With header set, authenticated and trusted callers get a Server-Timing header.
+// Requests slower than slowRequest are logged with their phases; zero disables the log.
+func Middleware(header bool, trusted *net.IPNet, slowRequest time.Duration, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collector := collectors.Get().(*Collector)
+		collector.reset()
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), collector))
+		if header {
+			original := c.Writer
+			c.Writer = &headerWriter{ResponseWriter: original, ctx: c, collector: collector, trusted: trusted}
+			defer func() { c.Writer = original }()
+		}
+
+		c.Next()
+
+		if elapsed := time.Since(collector.start); slowRequest > 0 && elapsed > slowRequest {
+			log.Warn("slow request",
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.FullPath()),
+				zap.Int("status", c.Writer.Status()),
+				zap.Duration("duration", elapsed),
+				zap.ByteString("phases", collector.AppendHeader(nil)),
+				requestid.Field(c.Request.Context()),
+			)
+		}
+		collectors.Put(collector)
+	}
+}
@@ -0,0 +1,94 @@
+// Package webhook delivers events to the HTTP endpoints of users, signed so they
+// can verify them with client.VerifyWebhookSignature.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/events"
+	"github.com/OrtemRepos/shortlink/pkg/client"
+)
+
+// ErrDeliveryRejected is returned when the receiver answers outside 2xx.
+var ErrDeliveryRejected = errors.New("webhook delivery rejected")
+
+// Delivery is the outcome of sending an event: the status answered, zero if none
+// was, and how long sending took.
+type Delivery struct {
+	StatusCode int           `json:"status_code"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// Sender posts events as JSON with their SignatureHeader.
+type Sender struct {
+	client *http.Client
+	clock  clock.Clock
+}
+
+type SenderOption func(*Sender)
+
+// WithClock sets the clock that stamps and times deliveries; the default is the real clock.
+func WithClock(c clock.Clock) SenderOption {
+	return func(s *Sender) {
+		s.clock = clock.OrReal(c)
+	}
+}
+
+// NewSender returns a sender posting through httpClient, which should be the
+// governed client of outbound.Governor in production.
+func NewSender(httpClient *http.Client, opts ...SenderOption) *Sender {
+	s := &Sender{client: httpClient, clock: clock.Real{}}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// TestEvent returns the event sent to check the configuration of a webhook of userID.
+func TestEvent(userID string) events.Event {
+	return events.Event{Type: events.WebhookTest, UserID: userID}
+}
+
+// Send posts e to target signed with secret. Return client.ErrPayloadTooLarge,
+// without sending, for events encoding past client.MaxPayload, and
+// ErrDeliveryRejected for a status outside 2xx.
+func (s *Sender) Send(ctx context.Context, target, secret string, e events.Event) (Delivery, error) {
+	start := s.clock.Now()
+	if e.At.IsZero() {
+		e.At = start
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return Delivery{}, err
+	}
+	if len(body) > client.MaxPayload {
+		return Delivery{}, client.ErrPayloadTooLarge
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return Delivery{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(client.SignatureHeader, client.SignWebhook(secret, start, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return Delivery{Duration: s.clock.Now().Sub(start)}, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the answer so the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	delivery := Delivery{StatusCode: resp.StatusCode, Duration: s.clock.Now().Sub(start)}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return delivery, fmt.Errorf("%w: status %d", ErrDeliveryRejected, resp.StatusCode)
+	}
+	return delivery, nil
+}
@@ -0,0 +1,118 @@
+package webhook
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+)
+
+// MaxPerUser bounds the webhooks a user may register.
+const MaxPerUser = 10
+
+var (
+	// ErrWebhookNotFound is returned for a webhook that does not exist or belongs to another user.
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrInvalidTarget is returned for a target that is not an absolute http or https URL.
+	ErrInvalidTarget = errors.New("webhook url must be an absolute http or https URL")
+	// ErrTooManyWebhooks is returned when a user already has MaxPerUser webhooks.
+	ErrTooManyWebhooks = errors.New("too many webhooks")
+)
+
+// Webhook is an endpoint of a user that events are posted to, signed with Secret.
+type Webhook struct {
+	ID        string    `json:"id"`
+	Target    string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store keeps the webhooks of users in memory: they are lost on restart and each
+// instance has its own.
+type Store struct {
+	clock clock.Clock
+
+	mu    sync.RWMutex
+	hooks map[string]map[string]Webhook
+}
+
+// NewStore returns an empty store stamping webhooks with c; nil is the real clock.
+func NewStore(c clock.Clock) *Store {
+	return &Store{clock: clock.OrReal(c), hooks: make(map[string]map[string]Webhook)}
+}
+
+// Add registers target for userID with a new secret, returned only by Add and Get.
+func (s *Store) Add(userID, target string) (Webhook, error) {
+	if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, ErrInvalidTarget
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Webhook{}, err
+	}
+	hook := Webhook{ID: uuid.NewString(), Target: target, Secret: hex.EncodeToString(secret), CreatedAt: s.clock.Now()}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hooks, ok := s.hooks[userID]
+	if !ok {
+		hooks = make(map[string]Webhook)
+		s.hooks[userID] = hooks
+	}
+	if len(hooks) >= MaxPerUser {
+		return Webhook{}, ErrTooManyWebhooks
+	}
+	hooks[hook.ID] = hook
+	return hook, nil
+}
+
+// Get returns the webhook id of userID, secret included.
+func (s *Store) Get(userID, id string) (Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	hook, ok := s.hooks[userID][id]
+	if !ok {
+		return Webhook{}, ErrWebhookNotFound
+	}
+	return hook, nil
+}
+
+// List returns the webhooks of userID without their secrets, oldest first.
+func (s *Store) List(userID string) []Webhook {
+	s.mu.RLock()
+	hooks := make([]Webhook, 0, len(s.hooks[userID]))
+	for _, hook := range s.hooks[userID] {
+		hook.Secret = ""
+		hooks = append(hooks, hook)
+	}
+	s.mu.RUnlock()
+	slices.SortFunc(hooks, func(a, b Webhook) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return hooks
+}
+
+// Delete removes the webhook id of userID.
+func (s *Store) Delete(userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.hooks[userID][id]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(s.hooks[userID], id)
+	if len(s.hooks[userID]) == 0 {
+		delete(s.hooks, userID)
+	}
+	return nil
+}
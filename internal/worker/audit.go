@@ -0,0 +1,169 @@
+package worker
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// AuditBuffer bounds the audit records waiting to be written; past it they are dropped.
+const AuditBuffer = 1024
+
+// AuditEvent is what happened to a task in an AuditRecord.
+type AuditEvent string
+
+const (
+	AuditSubmitted AuditEvent = "submitted"
+	AuditStarted   AuditEvent = "started"
+	AuditCompleted AuditEvent = "completed"
+	AuditFailed    AuditEvent = "failed"
+	// AuditDropped is a task the pool gave up on before a worker took it, for the
+	// Reason of the record: a full queue, or the pool closing.
+	AuditDropped AuditEvent = "dropped"
+)
+
+// AuditRecord is one line of the audit trail of WithAudit.
+type AuditRecord struct {
+	Time   time.Time  `json:"time"`
+	Pool   string     `json:"pool"`
+	Event  AuditEvent `json:"event"`
+	TaskID uint64     `json:"task_id"`
+	Task   string     `json:"task"`
+	Kind   string     `json:"kind"`
+	// Duration is how long a completed or failed task ran, retries included.
+	Duration time.Duration `json:"duration_ns,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Reason   string        `json:"reason,omitempty"`
+	// Values are those of SubmitWithValues.
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// WithAudit writes the lifecycle of every task of the pool to w as JSON lines of
+// AuditRecord, whatever the log level, for operations to tail. Records are written
+// by a goroutine of their own: workers and producers never wait for w, and when
+// more than AuditBuffer records are waiting the newer ones are dropped, counted in
+// MetricsResult.AuditDropped. Records are in the order the events happened, except
+// that several workers may log theirs at the same time. The pool writes what is
+// waiting once it stopped, then no more. A nil w turns the audit off.
+func WithAudit(w io.Writer) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.auditLog = nil
+		if w != nil {
+			wp.auditLog = &auditLog{w: w}
+		}
+	}
+}
+
+// auditLog passes records to the goroutine writing them to w.
+type auditLog struct {
+	w        io.Writer
+	records  chan AuditRecord
+	dropped  atomic.Int64
+	quit     chan struct{}
+	finished chan struct{}
+	once     sync.Once
+}
+
+// start runs the goroutine writing records, logging to log the writes that fail.
+func (a *auditLog) start(log *zap.Logger) {
+	a.records = make(chan AuditRecord, AuditBuffer)
+	a.quit = make(chan struct{})
+	a.finished = make(chan struct{})
+	go func() {
+		defer close(a.finished)
+		enc := json.NewEncoder(a.w)
+		write := func(record AuditRecord) {
+			if err := enc.Encode(record); err != nil {
+				a.dropped.Add(1)
+				log.Warn("audit record not written", zap.Uint64("task_id", record.TaskID), zap.Error(err))
+			}
+		}
+		for {
+			select {
+			case record := <-a.records:
+				write(record)
+			case <-a.quit:
+				for {
+					select {
+					case record := <-a.records:
+						write(record)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// close writes the records waiting and stops the goroutine; later records are dropped.
+func (a *auditLog) close() {
+	if a == nil {
+		return
+	}
+	a.once.Do(func() {
+		close(a.quit)
+		<-a.finished
+	})
+}
+
+// audit records event for env, if the pool has an audit log. extra fills in the
+// fields that depend on the event.
+func (wp *IWorkerPool) audit(env envelope, event AuditEvent, extra func(*AuditRecord)) {
+	a := wp.auditLog
+	if a == nil {
+		return
+	}
+	record := AuditRecord{
+		Time:   wp.clock.Now(),
+		Pool:   wp.name,
+		Event:  event,
+		TaskID: env.id,
+		Task:   env.task.Stringer(),
+		Kind:   env.kind,
+		Values: env.values,
+	}
+	if extra != nil {
+		extra(&record)
+	}
+	select {
+	case <-a.finished:
+		a.dropped.Add(1)
+		return
+	default:
+	}
+	select {
+	case a.records <- record:
+	default:
+		a.dropped.Add(1)
+	}
+}
+
+// auditDropped records env as dropped for reason.
+func (wp *IWorkerPool) auditDropped(env envelope, reason string) {
+	wp.audit(env, AuditDropped, func(r *AuditRecord) { r.Reason = reason })
+}
+
+// auditEnded records env as completed, or failed with err, after running for d.
+func (wp *IWorkerPool) auditEnded(env envelope, err error, d time.Duration) {
+	if err == nil {
+		wp.audit(env, AuditCompleted, func(r *AuditRecord) { r.Duration = d })
+		return
+	}
+	wp.audit(env, AuditFailed, func(r *AuditRecord) {
+		r.Duration = d
+		r.Error = err.Error()
+	})
+}
+
+// auditDroppedCount counts the audit records dropped, zero without an audit log.
+func (wp *IWorkerPool) auditDroppedCount() int64 {
+	if wp.auditLog == nil {
+		return 0
+	}
+	return wp.auditLog.dropped.Load()
+}
@@ -0,0 +1,36 @@
+package worker
+
+import "time"
+
+// PoolConfig is what a pool runs with, read from the pool itself rather than from
+// the configuration it was built from, so it tells what options and Resize made of it.
+// Retry backoffs are functions and are left out.
+type PoolConfig struct {
+	Workers          int           `json:"workers"`
+	BufferSize       int           `json:"buffer_size"`
+	ErrMaximumAmount int           `json:"err_maximum_amount"`
+	TaskTimeout      time.Duration `json:"task_timeout"`
+	MaxAttempts      int           `json:"max_attempts"`
+	RetryPanics      bool          `json:"retry_panics"`
+	RateLimit        float64       `json:"rate_limit,omitempty"`
+	RateBurst        int           `json:"rate_burst,omitempty"`
+}
+
+// Config returns the settings the pool runs with.
+func (wp *IWorkerPool) Config() PoolConfig {
+	wp.workersMu.RLock()
+	workers := len(wp.workers)
+	wp.workersMu.RUnlock()
+	cfg := PoolConfig{
+		Workers:          workers,
+		BufferSize:       wp.capacity(),
+		ErrMaximumAmount: wp.errors.Capacity(),
+		TaskTimeout:      wp.taskTimeout,
+		MaxAttempts:      max(wp.retry.MaxAttempts, 1),
+		RetryPanics:      wp.retry.RetryPanics,
+	}
+	if wp.limiter != nil {
+		cfg.RateLimit, cfg.RateBurst = float64(wp.limiter.Limit()), wp.limiter.Burst()
+	}
+	return cfg
+}
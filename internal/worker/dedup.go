@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// ErrDuplicateTask is returned when submitting a task whose DedupKey is the key of
+// a task still waiting in the queue.
+var ErrDuplicateTask = errors.New("duplicate task already queued")
+
+// Deduplicated is implemented by tasks that are pointless to queue twice. Submit,
+// SubmitWithPriority, SubmitTracked and SubmitWait refuse such a task with
+// ErrDuplicateTask while a task of the same key, of any priority, is queued; the key
+// is free again once a worker takes that task, or Shutdown drops it. Delayed and
+// recurring tasks are not deduplicated. An empty key opts the task out.
+type Deduplicated interface {
+	DedupKey() string
+}
+
+// dedupKey returns the key of task, empty if it is not deduplicated.
+func dedupKey(task Task) string {
+	if d, ok := task.(Deduplicated); ok {
+		return d.DedupKey()
+	}
+	return ""
+}
+
+// claim marks the key of env as queued, or reports false if it already is.
+func (wp *IWorkerPool) claim(env envelope) bool {
+	if env.dedupKey == "" {
+		return true
+	}
+	wp.pendingMu.Lock()
+	defer wp.pendingMu.Unlock()
+	if _, ok := wp.pending[env.dedupKey]; ok {
+		wp.metrics.incrementDeduplicated()
+		if wp.debugTask(env.id) {
+			wp.log.Debug("duplicate task not queued", append(env.fields(), zap.String("dedup_key", env.dedupKey))...)
+		}
+		return false
+	}
+	wp.pending[env.dedupKey] = struct{}{}
+	return true
+}
+
+// release frees the key of env once it left the queue, or was never queued.
+func (wp *IWorkerPool) release(env envelope) {
+	if env.dedupKey == "" {
+		return
+	}
+	wp.pendingMu.Lock()
+	defer wp.pendingMu.Unlock()
+	delete(wp.pending, env.dedupKey)
+}
+
+// pendingKeys counts the keys of queued tasks.
+func (wp *IWorkerPool) pendingKeys() int {
+	wp.pendingMu.Lock()
+	defer wp.pendingMu.Unlock()
+	return len(wp.pending)
+}
@@ -0,0 +1,159 @@
+package worker
+
+import (
+	"container/heap"
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// delayedTask is a task submitted with SubmitAt, waiting for at.
+type delayedTask struct {
+	at  time.Time
+	seq uint64
+	env envelope
+}
+
+// delayQueue is a min-heap of delayed tasks by due time, then submission order.
+type delayQueue []delayedTask
+
+func (q delayQueue) Len() int { return len(q) }
+
+func (q delayQueue) Less(i, j int) bool {
+	if !q[i].at.Equal(q[j].at) {
+		return q[i].at.Before(q[j].at)
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q delayQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *delayQueue) Push(x any) { *q = append(*q, x.(delayedTask)) }
+
+func (q *delayQueue) Pop() any {
+	old := *q
+	last := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return last
+}
+
+// SubmitAfter is SubmitAt for delay from now on the pool clock.
+func (wp *IWorkerPool) SubmitAfter(ctx context.Context, task Task, delay time.Duration) error {
+	return wp.SubmitAt(ctx, task, wp.clock.Now().Add(delay))
+}
+
+// SubmitAt queues task with normal priority once at has come. Until then it waits
+// in a timer heap, counted by PoolMetrics.TasksScheduled; the goroutine that moves
+// due tasks to the queue is started by the first call.
+// Drain still queues the tasks due when it is called and drops the others;
+// Shutdown drops them all. Dropped tasks are counted by PoolMetrics.ScheduledDropped.
+// Return ErrWorkerPoolClosed after Drain or Shutdown.
+func (wp *IWorkerPool) SubmitAt(ctx context.Context, task Task, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := wp.enter(); err != nil {
+		return err
+	}
+	defer wp.producers.Done()
+	wp.delayOnce.Do(func() {
+		// The delay loop queues tasks, so Drain waits for it like for any producer.
+		wp.producers.Add(1)
+		go wp.runDelayed()
+	})
+	env := wp.envelope(task)
+	wp.delayMu.Lock()
+	if wp.delayClosed {
+		wp.delayMu.Unlock()
+		return ErrWorkerPoolClosed
+	}
+	wp.delaySeq++
+	heap.Push(&wp.delayed, delayedTask{at: at, seq: wp.delaySeq, env: env})
+	wp.metrics.addScheduled(1)
+	wp.delayMu.Unlock()
+	if wp.debugTask(env.id) {
+		wp.log.Debug("task scheduled", append(env.fields(), zap.Time("at", at))...)
+	}
+	select {
+	case wp.delayWake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// runDelayed queues delayed tasks as they come due, until the pool closes.
+func (wp *IWorkerPool) runDelayed() {
+	defer wp.producers.Done()
+	for {
+		now := wp.clock.Now()
+		for _, d := range wp.popDue(now) {
+			wp.deliver(d)
+		}
+		var timer <-chan time.Time
+		wp.delayMu.Lock()
+		if len(wp.delayed) > 0 {
+			timer = wp.clock.After(wp.delayed[0].at.Sub(now))
+		}
+		wp.delayMu.Unlock()
+		select {
+		case <-timer:
+		case <-wp.delayWake:
+		case <-wp.done:
+			wp.closeDelayed()
+			return
+		}
+	}
+}
+
+// popDue removes the tasks due at now from the heap, earliest first.
+func (wp *IWorkerPool) popDue(now time.Time) []delayedTask {
+	wp.delayMu.Lock()
+	defer wp.delayMu.Unlock()
+	var due []delayedTask
+	for len(wp.delayed) > 0 && !wp.delayed[0].at.After(now) {
+		due = append(due, heap.Pop(&wp.delayed).(delayedTask))
+	}
+	return due
+}
+
+// closeDelayed refuses further delayed tasks, queues the due ones and drops the rest.
+func (wp *IWorkerPool) closeDelayed() {
+	wp.delayMu.Lock()
+	wp.delayClosed = true
+	wp.delayMu.Unlock()
+	for _, d := range wp.popDue(wp.clock.Now()) {
+		wp.deliver(d)
+	}
+	wp.delayMu.Lock()
+	pending := wp.delayed
+	wp.delayed = nil
+	wp.delayMu.Unlock()
+	for _, d := range pending {
+		wp.dropDelayed(d, "pool closed before the task was due")
+	}
+}
+
+// deliver waits for room in the queue for a due task; Shutdown drops it instead.
+func (wp *IWorkerPool) deliver(d delayedTask) {
+	queue, _ := PriorityNormal.queue()
+	d.env.queuedAt = wp.clock.Now()
+	select {
+	case wp.shards[wp.nextShard()][queue] <- d.env:
+		wp.woken()
+		wp.metrics.addScheduled(-1)
+		wp.submitted(d.env)
+	case <-wp.stop:
+		wp.dropDelayed(d, "pool shut down before the task was queued")
+	}
+}
+
+func (wp *IWorkerPool) dropDelayed(d delayedTask, reason string) {
+	wp.metrics.addScheduled(-1)
+	wp.metrics.incrementScheduledDropped()
+	wp.auditDropped(d.env, reason)
+	wp.log.Warn("scheduled task dropped", append(d.env.fields(),
+		zap.Time("at", d.at),
+		zap.String("reason", reason),
+	)...)
+}
@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrDrainForced is returned by DrainWithTimeout when tasks outlived the grace period
+// and the pool was stopped under them.
+var ErrDrainForced = errors.New("drain forced")
+
+// DrainWithTimeout is Drain giving tasks graceful to finish. Past it, the pool takes
+// the path of Shutdown: running tasks are aborted, queued ones dropped, and once every
+// worker exited it returns ErrDrainForced with how many tasks were abandoned, also
+// counted in TasksAbandoned. Return ctx.Err() if ctx ends first, either way.
+func (wp *IWorkerPool) DrainWithTimeout(ctx context.Context, graceful time.Duration) error {
+	drained, err := wp.startDrain(ctx)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-wp.clock.After(graceful):
+	}
+
+	abandoned := make(chan int, 1)
+	err = wp.tasks.Go(ctx, ShutdownGoroutine, func() {
+		running := wp.halt()
+		<-drained
+		abandoned <- running + wp.abandonQueued()
+	})
+	if err != nil {
+		return err
+	}
+	select {
+	case n := <-abandoned:
+		wp.log.Warn("drain forced after grace period", zap.Duration("grace", graceful), zap.Int("abandoned", n))
+		return fmt.Errorf("%w after %s: %d tasks abandoned", ErrDrainForced, graceful, n)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startDrain closes the pool to new tasks, resumes it if paused, and returns a channel
+// closed once producers are gone and every worker exited.
+func (wp *IWorkerPool) startDrain(ctx context.Context) (<-chan struct{}, error) {
+	wp.closeIntake()
+	wp.Resume()
+	done := make(chan struct{})
+	err := wp.tasks.Go(ctx, DrainGoroutine, func() {
+		wp.producers.Wait()
+		wp.drainOnce.Do(func() { close(wp.drain) })
+		wp.wg.Wait()
+		wp.stopped()
+		close(done)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// halt makes workers exit without emptying the queue and cancels the tasks they run.
+// It returns how many tasks were running, the first time it is called, so that the
+// tasks it aborts are counted once.
+func (wp *IWorkerPool) halt() int {
+	wp.closeIntake()
+	wp.closedMu.Lock()
+	defer wp.closedMu.Unlock()
+	running := 0
+	wp.stopOnce.Do(func() {
+		close(wp.stop)
+		running = int(wp.running.Load())
+		wp.metrics.addAbandoned(running)
+	})
+	for _, cancel := range wp.cancels {
+		cancel()
+	}
+	wp.cancelRunning()
+	return running
+}
@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// TaskGroup is a set of tasks submitted to a pool to be waited for together, like an
+// errgroup whose goroutines are the workers of the pool. Other tasks of the pool are
+// not waited for, and the pool is not closed by Wait. A group may be used from
+// several goroutines, its members included.
+type TaskGroup struct {
+	pool    *IWorkerPool
+	mu      sync.Mutex
+	handles []*TaskHandle
+}
+
+// Group returns an empty TaskGroup of the pool.
+func (wp *IWorkerPool) Group() *TaskGroup {
+	return &TaskGroup{pool: wp}
+}
+
+// Submit queues task like SubmitTracked and adds it to the group. A task the pool
+// refused, with the error returned, is not a member.
+func (g *TaskGroup) Submit(ctx context.Context, task Task) error {
+	handle, err := g.pool.SubmitTracked(ctx, task)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	g.handles = append(g.handles, handle)
+	g.mu.Unlock()
+	return nil
+}
+
+// Wait blocks until every member has ended, those submitted while it waits included,
+// and returns their errors joined, in the order they were submitted, panics as
+// errors matching ErrTaskPanicked. If ctx ends first it returns ctx.Err(): the
+// members go on running and a later Wait still sees their errors.
+func (g *TaskGroup) Wait(ctx context.Context) error {
+	var errs []error
+	for i := 0; ; i++ {
+		g.mu.Lock()
+		if i == len(g.handles) {
+			g.mu.Unlock()
+			return errors.Join(errs...)
+		}
+		handle := g.handles[i]
+		g.mu.Unlock()
+		select {
+		case <-handle.Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err := handle.Err(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+}
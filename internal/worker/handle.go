@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrTaskPanicked matches the error of a task that panicked.
+var ErrTaskPanicked = errors.New("task panicked")
+
+// ErrTaskAborted is the error of a tracked task that a worker gave up on without
+// an outcome, or that Shutdown or a forced DrainWithTimeout left in the queue.
+var ErrTaskAborted = errors.New("task aborted")
+
+// TaskHandle follows one task submitted with SubmitTracked. Err and Duration are
+// set once Done is closed.
+type TaskHandle struct {
+	done     chan struct{}
+	once     sync.Once
+	err      error
+	duration time.Duration
+}
+
+func newTaskHandle() *TaskHandle {
+	return &TaskHandle{done: make(chan struct{})}
+}
+
+// Done is closed when the task has ended, after its retries.
+func (h *TaskHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Err returns the error the task ended with, nil before Done is closed.
+// A panic gives an error matching ErrTaskPanicked.
+func (h *TaskHandle) Err() error {
+	select {
+	case <-h.done:
+		return h.err
+	default:
+		return nil
+	}
+}
+
+// Duration returns how long the task ran, retries included; zero before Done is closed.
+func (h *TaskHandle) Duration() time.Duration {
+	select {
+	case <-h.done:
+		return h.duration
+	default:
+		return 0
+	}
+}
+
+// finish records the outcome once; a nil handle, from Submit, is not tracked.
+func (h *TaskHandle) finish(err error, duration time.Duration) {
+	if h == nil {
+		return
+	}
+	h.once.Do(func() {
+		h.err = err
+		h.duration = duration
+		close(h.done)
+	})
+}
+
+// SubmitTracked is Submit returning a handle to wait for the task. Only tracked
+// tasks carry a handle, so fire-and-forget Submit keeps nothing per task.
+// Done is never closed for a task left in the queue when the ctx given to Start ends;
+// waiters should select on their own ctx too.
+func (wp *IWorkerPool) SubmitTracked(ctx context.Context, task Task) (*TaskHandle, error) {
+	handle := newTaskHandle()
+	if err := wp.submit(ctx, task, handle, PriorityNormal, nil); err != nil {
+		return nil, err
+	}
+	return handle, nil
+}
+
+// abandonQueued finishes the handles of tasks Shutdown left in the queues, counts
+// them in TasksAbandoned and returns how many there were. It runs once workers and
+// producers are gone, so only another abandonQueued takes from the queues.
+func (wp *IWorkerPool) abandonQueued() int {
+	n := 0
+	for _, shard := range wp.shards {
+		for _, queue := range shard {
+			for empty := false; !empty; {
+				select {
+				case env := <-queue:
+					wp.release(env)
+					env.handle.finish(ErrTaskAborted, 0)
+					wp.auditDropped(env, "pool shut down before the task ran")
+					n++
+				default:
+					empty = true
+				}
+			}
+		}
+	}
+	wp.metrics.addAbandoned(n)
+	return n
+}
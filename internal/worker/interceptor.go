@@ -0,0 +1,117 @@
+package worker
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// TaskInterceptor runs around each execution of a task, retries included. It calls
+// next to go on with the chain, and may return without calling it to skip the task:
+// what it returns is the outcome of the task either way. A panic in an interceptor
+// fails the task like a panic in Execute, and next then returns it to the outer ones.
+type TaskInterceptor func(ctx context.Context, task Task, next func(ctx context.Context) error) error
+
+// WithInterceptors sets the chain run around every task, the first interceptor
+// outermost. It replaces DefaultInterceptors, so they must be listed to keep the
+// worker metrics and the task logs; user interceptors go before or after them.
+func WithInterceptors(interceptors ...TaskInterceptor) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.interceptors = interceptors
+	}
+}
+
+// DefaultInterceptors are the chain of a pool built without WithInterceptors.
+func DefaultInterceptors() []TaskInterceptor {
+	return []TaskInterceptor{MetricsInterceptor(), LoggingInterceptor()}
+}
+
+// execution is the task a worker runs, kept in the ctx of the chain for the built-in interceptors.
+type execution struct {
+	worker *IWorker
+	env    envelope
+}
+
+type executionKey struct{}
+
+func executionFrom(ctx context.Context) (execution, bool) {
+	e, ok := ctx.Value(executionKey{}).(execution)
+	return e, ok
+}
+
+// MetricsInterceptor counts the task as started, then as succeeded or failed, in the
+// metrics of the worker running it, and records how long it ran, retries included.
+func MetricsInterceptor() TaskInterceptor {
+	return func(ctx context.Context, task Task, next func(ctx context.Context) error) error {
+		e, ok := executionFrom(ctx)
+		if !ok {
+			return next(ctx)
+		}
+		metrics := e.worker.metricsWorker
+		metrics.incrementStarted()
+		start := e.worker.pool.clock.Now()
+		err := next(ctx)
+		metrics.observeDuration(e.worker.pool.clock.Now().Sub(start))
+		if err != nil {
+			metrics.incrementFailed()
+		} else {
+			metrics.incrementSucceeded()
+		}
+		return err
+	}
+}
+
+// LoggingInterceptor logs the start and the outcome of the task with its ID,
+// Stringer and the values of SubmitWithValues; panics are logged with their stack
+// where they are recovered.
+func LoggingInterceptor() TaskInterceptor {
+	return func(ctx context.Context, task Task, next func(ctx context.Context) error) error {
+		e, ok := executionFrom(ctx)
+		if !ok {
+			return next(ctx)
+		}
+		w := e.worker
+		// The task is named before it runs, as it was submitted, but its fields are
+		// only put together for the lines that are logged.
+		name := TaskField(task)
+		fields := func(extra zap.Field) []zap.Field {
+			return []zap.Field{zap.Uint64("task_id", e.env.id), name, zap.Int("worker_id", w.id), valuesField(e.env.values), extra}
+		}
+		debug := w.pool.debugTask(e.env.id)
+		if debug {
+			w.pool.log.Debug("task started", fields(zap.Skip())...)
+		}
+		start := w.pool.clock.Now()
+		err := next(ctx)
+		var panicked *panicError
+		switch {
+		case errors.As(err, &panicked):
+		case err != nil:
+			w.pool.log.Error("task failed", fields(zap.Error(err))...)
+		case debug:
+			w.pool.log.Debug("task completed", fields(zap.Duration("duration", w.pool.clock.Now().Sub(start)))...)
+		}
+		return err
+	}
+}
+
+// intercept runs the interceptors from i on, then the attempts of the task.
+// Each call is recovered on its own, so a panic, say from logging, only fails
+// the task and the layers outside it see it as the error of next.
+func (w *IWorker) intercept(ctx context.Context, env envelope, i int) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			w.pool.recovered("task interceptor panic occurred", env.task, r,
+				append(env.fields(), zap.Int("worker_id", w.id), zap.Int("interceptor", i))...)
+			err = &panicError{recovered: r}
+		}
+	}()
+	interceptors := w.pool.interceptors
+	if i == len(interceptors) {
+		return w.attempts(ctx, env)
+	}
+	return interceptors[i](ctx, env.task, func(ctx context.Context) error {
+		return w.intercept(ctx, env, i+1)
+	})
+}
@@ -0,0 +1,133 @@
+package worker
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Kinded is implemented by tasks that tell where they come from, so that the tasks
+// of several sources sharing a pool are counted apart in TasksByKind.
+type Kinded interface {
+	Kind() string
+}
+
+const (
+	// DefaultKind counts the tasks that are not Kinded or have an empty kind.
+	DefaultKind = "default"
+	// OtherKind counts the tasks of the kinds seen once MaxKinds kinds are counted.
+	OtherKind = "other"
+	// MaxKinds bounds the kinds a pool counts, OtherKind included, so that a task
+	// making up kinds cannot grow the metrics without end.
+	MaxKinds = 32
+)
+
+// kindOf returns the kind of task, DefaultKind if it tells none.
+func kindOf(task Task) string {
+	if k, ok := task.(Kinded); ok {
+		if kind := k.Kind(); kind != "" {
+			return kind
+		}
+	}
+	return DefaultKind
+}
+
+// KindCounts counts the tasks of one kind: accepted by the pool, taken by a worker,
+// and failed after their retries.
+type KindCounts struct {
+	Enqueued int `json:"enqueued"`
+	Started  int `json:"started"`
+	Failed   int `json:"failed"`
+}
+
+// kindEvent is what happened to a task counted by kind.
+type kindEvent int
+
+const (
+	kindEnqueued kindEvent = iota
+	kindStarted
+	kindFailed
+)
+
+func (e kindEvent) String() string {
+	switch e {
+	case kindEnqueued:
+		return "enqueued"
+	case kindStarted:
+		return "started"
+	default:
+		return "failed"
+	}
+}
+
+type kindCounter [kindFailed + 1]atomic.Int64
+
+// kindCounters counts tasks by kind. Kinds are added as they are seen, up to
+// MaxKinds; the tasks of later kinds are counted under OtherKind.
+type kindCounters struct {
+	mu    sync.RWMutex
+	kinds map[string]*kindCounter
+}
+
+// count counts event for a task of kind and returns the kind it was counted under.
+func (k *kindCounters) count(kind string, event kindEvent) string {
+	k.mu.RLock()
+	counter, ok := k.kinds[kind]
+	k.mu.RUnlock()
+	if !ok {
+		kind, counter = k.add(kind)
+	}
+	counter[event].Add(1)
+	return kind
+}
+
+func (k *kindCounters) add(kind string) (string, *kindCounter) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.kinds == nil {
+		k.kinds = make(map[string]*kindCounter)
+	}
+	if counter, ok := k.kinds[kind]; ok {
+		return kind, counter
+	}
+	named := len(k.kinds)
+	if _, ok := k.kinds[OtherKind]; ok {
+		named--
+	}
+	if named >= MaxKinds-1 {
+		kind = OtherKind
+		if counter, ok := k.kinds[kind]; ok {
+			return kind, counter
+		}
+	}
+	counter := &kindCounter{}
+	k.kinds[kind] = counter
+	return kind, counter
+}
+
+func (k *kindCounters) counts() map[string]KindCounts {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	result := make(map[string]KindCounts, len(k.kinds))
+	for kind, counter := range k.kinds {
+		result[kind] = KindCounts{
+			Enqueued: int(counter[kindEnqueued].Load()),
+			Started:  int(counter[kindStarted].Load()),
+			Failed:   int(counter[kindFailed].Load()),
+		}
+	}
+	return result
+}
+
+// reset zeroes the counts, keeping the kinds seen, and returns them as they were.
+func (k *kindCounters) reset() map[string]*kindCounter {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	old := make(map[string]*kindCounter, len(k.kinds))
+	for kind, counter := range k.kinds {
+		old[kind] = &kindCounter{}
+		for i := range counter {
+			old[kind][i].Store(counter[i].Swap(0))
+		}
+	}
+	return old
+}
@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrWorkerPoolStarted is returned by Start on a pool already started.
+var ErrWorkerPoolStarted = errors.New("worker pool already started")
+
+// ErrPoolNotStarted is returned by the Submit methods of a pool built WithRequireStart
+// until Start is called.
+var ErrPoolNotStarted = errors.New("worker pool not started")
+
+// WithRequireStart, if required, makes the pool refuse tasks with ErrPoolNotStarted
+// until Start, for callers that would rather fail than have tasks wait for a Start
+// nobody calls. By default tasks submitted before Start are queued: the first one is
+// logged as a warning and they are counted in MetricsResult.QueuedBeforeStart.
+func WithRequireStart(required bool) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.requireStart = required
+	}
+}
+
+// PoolState is where a pool is in its life. A pool goes through the states in order,
+// possibly skipping Running, and never back: a stopped pool cannot be restarted, a
+// new one has to be created.
+type PoolState int32
+
+const (
+	// StateCreated pools accept tasks and queue them until Start.
+	StateCreated PoolState = iota
+	// StateRunning pools run tasks.
+	StateRunning
+	// StateDraining pools refuse tasks while workers finish, after Drain or Shutdown.
+	StateDraining
+	// StateStopped pools have no worker left.
+	StateStopped
+)
+
+func (s PoolState) String() string {
+	switch s {
+	case StateCreated:
+		return "created"
+	case StateRunning:
+		return "running"
+	case StateDraining:
+		return "draining"
+	case StateStopped:
+		return "stopped"
+	}
+	return fmt.Sprintf("PoolState(%d)", int32(s))
+}
+
+// State returns the state of the pool.
+func (wp *IWorkerPool) State() PoolState {
+	return PoolState(wp.state.Load())
+}
+
+// startable moves the pool to StateRunning, or tells why it cannot start. The caller
+// holds closedMu, so closeIntake cannot run in between.
+func (wp *IWorkerPool) startable() error {
+	switch state := wp.State(); state {
+	case StateCreated:
+		wp.state.Store(int32(StateRunning))
+		return nil
+	case StateRunning:
+		wp.log.Warn("worker pool already started, ignoring Start")
+		return ErrWorkerPoolStarted
+	default:
+		return fmt.Errorf("%w: pool is %s", ErrWorkerPoolClosed, state)
+	}
+}
+
+// queuedBeforeStart counts env if it was queued before Start, warning of the first.
+func (wp *IWorkerPool) queuedBeforeStart(env envelope) {
+	if wp.State() != StateCreated {
+		return
+	}
+	wp.preStart.Add(1)
+	wp.preStartOnce.Do(func() {
+		wp.log.Warn("task queued before Start, it waits for the pool to be started", env.fields()...)
+	})
+}
+
+// stopped marks the pool stopped once every worker exited and writes out its audit log.
+func (wp *IWorkerPool) stopped() {
+	wp.state.Store(int32(StateStopped))
+	wp.auditLog.close()
+}
@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TaskObserver is told of every task a worker runs, say to open and end a tracing
+// span. TaskStarted is called before the first attempt, then either TaskCompleted
+// or TaskFailed once the task ended, after its retries, with how long it ran. The
+// calls are made by the worker running the task, concurrently from several workers,
+// with the ctx the task runs with: TaskID tells the tasks apart. A panic in an
+// observer is logged and changes nothing else.
+type TaskObserver interface {
+	TaskStarted(ctx context.Context, task Task)
+	TaskCompleted(ctx context.Context, task Task, d time.Duration)
+	TaskFailed(ctx context.Context, task Task, err error, d time.Duration)
+}
+
+// WithObserver adds observers to those of the pool, told of tasks in the order given.
+// Unlike interceptors they are kept by WithInterceptors.
+func WithObserver(observers ...TaskObserver) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.observers = append(wp.observers, observers...)
+	}
+}
+
+// TaskID returns the ID the pool gave the task running with ctx, as logged with it,
+// or false if ctx is not that of a task.
+func TaskID(ctx context.Context) (uint64, bool) {
+	e, ok := executionFrom(ctx)
+	return e.env.id, ok
+}
+
+// observe calls notify with every observer of the pool, recovering their panics.
+func (w *IWorker) observe(env envelope, notify func(o TaskObserver)) {
+	for _, o := range w.pool.observers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					w.pool.log.Error("task observer panic occurred", append(env.fields(),
+						zap.Int("worker_id", w.id),
+						zap.Any("recovered", r),
+					)...)
+				}
+			}()
+			notify(o)
+		}()
+	}
+}
@@ -0,0 +1,124 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// pauseGate tells workers whether to take tasks. paused is closed while the pool
+// is paused and resumed while it is not; each is replaced when it opens again, so
+// a worker waits on whichever it took from pauseState without holding the lock.
+type pauseGate struct {
+	paused   chan struct{}
+	resumed  chan struct{}
+	pausedAt time.Time
+}
+
+func newPauseGate() pauseGate {
+	resumed := make(chan struct{})
+	close(resumed)
+	return pauseGate{paused: make(chan struct{}), resumed: resumed}
+}
+
+// Pause makes workers stop taking tasks once they are done with their current one.
+// Submit keeps accepting tasks until the queue is full, and delayed and recurring
+// tasks keep being queued. Pausing a paused pool does nothing.
+// Return ErrWorkerPoolClosed after Drain or Shutdown: Drain resumes the pool to empty it.
+func (wp *IWorkerPool) Pause() error {
+	wp.closedMu.RLock()
+	defer wp.closedMu.RUnlock()
+	select {
+	case <-wp.done:
+		return ErrWorkerPoolClosed
+	default:
+	}
+	wp.pauseMu.Lock()
+	defer wp.pauseMu.Unlock()
+	if wp.isPaused() {
+		return nil
+	}
+	close(wp.gate.paused)
+	wp.gate.resumed = make(chan struct{})
+	wp.gate.pausedAt = wp.clock.Now()
+	wp.log.Info("worker pool paused")
+	return nil
+}
+
+// Resume lets workers take tasks again. Resuming a running pool does nothing.
+func (wp *IWorkerPool) Resume() {
+	wp.pauseMu.Lock()
+	defer wp.pauseMu.Unlock()
+	if !wp.isPaused() {
+		return
+	}
+	close(wp.gate.resumed)
+	wp.gate.paused = make(chan struct{})
+	wp.log.Info("worker pool resumed", zap.Duration("paused_for", wp.clock.Now().Sub(wp.gate.pausedAt)))
+	wp.gate.pausedAt = time.Time{}
+}
+
+// isPaused must be called with pauseMu held.
+func (wp *IWorkerPool) isPaused() bool {
+	select {
+	case <-wp.gate.paused:
+		return true
+	default:
+		return false
+	}
+}
+
+// pauseState returns the channels of the gate.
+func (wp *IWorkerPool) pauseState() (paused, resumed <-chan struct{}) {
+	wp.pauseMu.Lock()
+	defer wp.pauseMu.Unlock()
+	return wp.gate.paused, wp.gate.resumed
+}
+
+// pausedFor reports whether the pool is paused and since how long.
+func (wp *IWorkerPool) pausedFor() (bool, time.Duration) {
+	wp.pauseMu.Lock()
+	defer wp.pauseMu.Unlock()
+	if !wp.isPaused() {
+		return false, 0
+	}
+	return true, wp.clock.Now().Sub(wp.gate.pausedAt)
+}
+
+// awaitResume waits while the pool is paused and reports false if the worker
+// should exit meanwhile.
+func (w *IWorker) awaitResume(ctx context.Context) bool {
+	_, resumed := w.pool.pauseState()
+	select {
+	case <-resumed:
+		return true
+	case <-w.quit:
+		return false
+	case <-w.pool.stop:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// executeResumed executes a task already taken from the queue, after a resume if
+// the pool was paused while the worker took it. Retiring does not drop the task;
+// Shutdown does, finishing its handle with ErrTaskAborted.
+func (w *IWorker) executeResumed(ctx context.Context, env envelope) {
+	_, resumed := w.pool.pauseState()
+	select {
+	case <-resumed:
+	case <-w.pool.stop:
+		w.pool.release(env)
+		env.handle.finish(ErrTaskAborted, 0)
+		w.pool.auditDropped(env, "pool shut down before the task ran")
+		return
+	case <-ctx.Done():
+		w.pool.release(env)
+		env.handle.finish(ErrTaskAborted, 0)
+		w.pool.auditDropped(env, "pool stopped before the task ran")
+		return
+	}
+	w.execute(ctx, env)
+}
@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidPriority = errors.New("invalid task priority")
+
+// Priority orders queued tasks: workers take high priority tasks first, then
+// normal, then low. The zero value is normal, the priority of Submit.
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+	PriorityLow
+)
+
+// priorities lists the priorities by queue, from the highest.
+var priorities = [...]Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+// fairPickInterval makes every fairPickInterval-th pick of a worker start one
+// queue lower, alternately at normal and at low. While higher priority tasks
+// keep arriving, normal and low tasks each still get one pick in
+// 2*fairPickInterval of every worker.
+const fairPickInterval = 8
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityHigh:
+		return "high"
+	case PriorityNormal:
+		return "normal"
+	case PriorityLow:
+		return "low"
+	}
+	return fmt.Sprintf("Priority(%d)", int(p))
+}
+
+// queue returns the index of the queue of p, or false for an unknown priority.
+func (p Priority) queue() (int, bool) {
+	for i, priority := range priorities {
+		if priority == p {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// SubmitWithPriority is Submit for a task of the given priority.
+// Return ErrInvalidPriority for an unknown priority.
+func (wp *IWorkerPool) SubmitWithPriority(ctx context.Context, task Task, priority Priority) error {
+	return wp.submit(ctx, task, nil, priority, nil)
+}
+
+// next takes a queued task without waiting, from the highest priority queue
+// that has one, except on fair picks, see fairPickInterval.
+func (w *IWorker) next() (envelope, bool) {
+	w.picks++
+	first := 0
+	if w.picks%fairPickInterval == 0 {
+		first = 1 + (w.picks/fairPickInterval)%2
+	}
+	home := w.pool.shards[w.home]
+	for i := range home {
+		queue := (first + i) % len(home)
+		select {
+		case env := <-home[queue]:
+			return env, true
+		default:
+		}
+		if len(w.pool.shards) > 1 {
+			if env, ok := w.steal(queue); ok {
+				return env, true
+			}
+		}
+	}
+	return envelope{}, false
+}
+
+// queuedWithPriority returns the number of tasks waiting in the queue of p.
+func (wp *IWorkerPool) queuedWithPriority(p Priority) int {
+	queue, ok := p.queue()
+	if !ok {
+		return 0
+	}
+	n := 0
+	for _, shard := range wp.shards {
+		n += len(shard[queue])
+	}
+	return n
+}
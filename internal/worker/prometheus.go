@@ -0,0 +1,285 @@
+package worker
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const metricsNamespace = "shortlink_worker"
+
+// PrometheusMetrics exports the counters of one pool to Prometheus. Collectors are
+// shared by every pool of a Registerer and told apart by the pool label.
+// The counts are still kept in BasicMetrics, so Metrics and Snapshot work as before.
+type PrometheusMetrics struct {
+	pool       string
+	registerer prometheus.Registerer
+	enqueued   prometheus.Counter
+	byPriority [len(priorities)]prometheus.Counter
+	byKind     *prometheus.CounterVec
+	started    *prometheus.CounterVec
+	completed  *prometheus.CounterVec
+	failed     *prometheus.CounterVec
+	retried    *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	wait       prometheus.Observer
+	throttled  prometheus.Counter
+	throttle   prometheus.Counter
+	duplicates prometheus.Counter
+	abandoned  prometheus.Counter
+	lastWorker atomic.Int64
+}
+
+// NewPrometheusMetrics registers the collectors of pool poolName with registerer.
+// Collectors already registered by another pool are reused.
+func NewPrometheusMetrics(registerer prometheus.Registerer, poolName string) (*PrometheusMetrics, error) {
+	enqueued, err := register(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "tasks_enqueued_total", Help: "Tasks accepted by the pool.",
+	}, []string{"pool"}))
+	if err != nil {
+		return nil, err
+	}
+	m := &PrometheusMetrics{pool: poolName, registerer: registerer, enqueued: enqueued.WithLabelValues(poolName)}
+	byPriority, err := register(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "tasks_enqueued_by_priority_total",
+		Help: "Tasks accepted by the pool, by priority; restored counts are left out.",
+	}, []string{"pool", "priority"}))
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range priorities {
+		m.byPriority[i] = byPriority.WithLabelValues(poolName, p.String())
+	}
+	m.byKind, err = register(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "tasks_by_kind_total",
+		Help: "Tasks of the pool enqueued, started and failed, by kind; see worker.Kinded.",
+	}, []string{"pool", "kind", "event"}))
+	if err != nil {
+		return nil, err
+	}
+	wait, err := register(registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace, Name: "task_wait_seconds",
+		Help:    "Time tasks waited in a queue before a worker took them.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"pool"}))
+	if err != nil {
+		return nil, err
+	}
+	m.wait = wait.WithLabelValues(poolName)
+	m.duration, err = register(registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace, Name: "task_duration_seconds",
+		Help:    "Time tasks ran on a worker, retries included.",
+		Buckets: []float64{0.01, 0.1, 1},
+	}, []string{"pool", "worker"}))
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range []struct {
+		counter *prometheus.Counter
+		name    string
+		help    string
+	}{
+		{&m.throttled, "tasks_throttled_total", "Executions that waited for the rate limiter of the pool."},
+		{&m.throttle, "throttle_wait_seconds_total", "Time executions waited for the rate limiter of the pool."},
+		{&m.duplicates, "tasks_deduplicated_total", "Submissions refused as duplicates of a queued task."},
+		{&m.abandoned, "tasks_abandoned_total", "Tasks aborted or dropped from the queue when the pool was stopped."},
+	} {
+		vec, err := register(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: c.name, Help: c.help,
+		}, []string{"pool"}))
+		if err != nil {
+			return nil, err
+		}
+		*c.counter = vec.WithLabelValues(poolName)
+	}
+	for _, c := range []struct {
+		vec  **prometheus.CounterVec
+		name string
+		help string
+	}{
+		{&m.started, "tasks_started_total", "Tasks started by a worker."},
+		{&m.completed, "tasks_completed_total", "Tasks that succeeded or failed on a worker."},
+		{&m.failed, "tasks_failed_total", "Tasks that failed on a worker, panics included."},
+		{&m.retried, "tasks_retried_total", "Extra attempts of failed tasks on a worker."},
+	} {
+		*c.vec, err = register(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace, Name: c.name, Help: c.help,
+		}, []string{"pool", "worker"}))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func register[V prometheus.Collector](registerer prometheus.Registerer, vec V) (V, error) {
+	err := registerer.Register(vec)
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		if existing, ok := registered.ExistingCollector.(V); ok {
+			return existing, nil
+		}
+	}
+	return vec, err
+}
+
+// Pool returns the pool counters to pass to NewWorkerPool.
+func (m *PrometheusMetrics) Pool() poolMetricsIncrement {
+	return &promPoolMetrics{prom: m}
+}
+
+// Workers returns the worker metrics fabric to pass to NewWorkerPool. Workers are
+// labelled in the order the fabric is called, which is the order of their IDs.
+func (m *PrometheusMetrics) Workers() func() metricsIncrement {
+	return func() metricsIncrement {
+		worker := strconv.FormatInt(m.lastWorker.Add(1), 10)
+		return &promWorkerMetrics{
+			started:   m.started.WithLabelValues(m.pool, worker),
+			completed: m.completed.WithLabelValues(m.pool, worker),
+			failed:    m.failed.WithLabelValues(m.pool, worker),
+			retried:   m.retried.WithLabelValues(m.pool, worker),
+			duration:  m.duration.WithLabelValues(m.pool, worker),
+		}
+	}
+}
+
+// WithPrometheus replaces the metrics of the pool with PrometheusMetrics registered
+// with registerer. If they cannot be registered the pool keeps its metrics and logs why.
+func WithPrometheus(registerer prometheus.Registerer) PoolOption {
+	return func(wp *IWorkerPool) {
+		m, err := NewPrometheusMetrics(registerer, wp.name)
+		if err != nil {
+			wp.log.Error("Prometheus metrics not registered", zap.String("pool", wp.name), zap.Error(err))
+			return
+		}
+		wp.metrics = m.Pool()
+		wp.newMetrics = m.Workers()
+	}
+}
+
+type promPoolMetrics struct {
+	BasicPoolMetrics
+	prom *PrometheusMetrics
+}
+
+func (m *promPoolMetrics) incrementEnqueued(p Priority) {
+	m.BasicPoolMetrics.incrementEnqueued(p)
+	m.prom.enqueued.Inc()
+	if queue, ok := p.queue(); ok {
+		m.prom.byPriority[queue].Inc()
+	}
+}
+
+func (m *promPoolMetrics) seedEnqueued(n int) {
+	m.BasicPoolMetrics.seedEnqueued(n)
+	m.prom.enqueued.Add(float64(n))
+}
+
+// observeQueue exports the queue depth and capacity of the pool as gauges.
+func (m *promPoolMetrics) observeQueue(depth func(p Priority) int, capacity int) {
+	m.BasicPoolMetrics.observeQueue(depth, capacity)
+	_ = m.prom.registerer.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   metricsNamespace,
+		Name:        "queue_depth",
+		Help:        "Tasks waiting in the queue of the pool.",
+		ConstLabels: prometheus.Labels{"pool": m.prom.pool},
+	}, func() float64 { return float64(m.QueueDepth()) }))
+	_ = m.prom.registerer.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   metricsNamespace,
+		Name:        "queue_capacity",
+		Help:        "Tasks the queue of each priority of the pool holds.",
+		ConstLabels: prometheus.Labels{"pool": m.prom.pool},
+	}, func() float64 { return float64(m.QueueCapacity()) }))
+}
+
+// observeWorkers exports the tasks in flight and the workers inside Execute as gauges.
+func (m *promPoolMetrics) observeWorkers(inFlight, active func() int) {
+	m.BasicPoolMetrics.observeWorkers(inFlight, active)
+	_ = m.prom.registerer.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   metricsNamespace,
+		Name:        "tasks_in_flight",
+		Help:        "Tasks taken by a worker of the pool and not ended yet.",
+		ConstLabels: prometheus.Labels{"pool": m.prom.pool},
+	}, func() float64 { return float64(m.InFlight()) }))
+	_ = m.prom.registerer.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   metricsNamespace,
+		Name:        "active_workers",
+		Help:        "Workers of the pool inside the Execute of a task.",
+		ConstLabels: prometheus.Labels{"pool": m.prom.pool},
+	}, func() float64 { return float64(m.ActiveWorkers()) }))
+}
+
+func (m *promPoolMetrics) observeWait(d time.Duration) {
+	m.BasicPoolMetrics.observeWait(d)
+	m.prom.wait.Observe(d.Seconds())
+}
+
+func (m *promPoolMetrics) observeThrottle(d time.Duration) {
+	m.BasicPoolMetrics.observeThrottle(d)
+	m.prom.throttled.Inc()
+	m.prom.throttle.Add(d.Seconds())
+}
+
+func (m *promPoolMetrics) incrementDeduplicated() {
+	m.BasicPoolMetrics.incrementDeduplicated()
+	m.prom.duplicates.Inc()
+}
+
+func (m *promPoolMetrics) addAbandoned(n int) {
+	m.BasicPoolMetrics.addAbandoned(n)
+	m.prom.abandoned.Add(float64(n))
+}
+
+// countKind labels the counter with the kind counted under, so it has at most MaxKinds kinds.
+func (m *promPoolMetrics) countKind(kind string, event kindEvent) string {
+	kind = m.BasicPoolMetrics.countKind(kind, event)
+	m.prom.byKind.WithLabelValues(m.prom.pool, kind, event.String()).Inc()
+	return kind
+}
+
+type promWorkerMetrics struct {
+	BasicMetrics
+	started   prometheus.Counter
+	completed prometheus.Counter
+	failed    prometheus.Counter
+	retried   prometheus.Counter
+	duration  prometheus.Observer
+}
+
+func (m *promWorkerMetrics) incrementStarted() {
+	m.BasicMetrics.incrementStarted()
+	m.started.Inc()
+}
+
+func (m *promWorkerMetrics) incrementSucceeded() {
+	m.BasicMetrics.incrementSucceeded()
+	m.completed.Inc()
+}
+
+func (m *promWorkerMetrics) incrementFailed() {
+	m.BasicMetrics.incrementFailed()
+	m.completed.Inc()
+	m.failed.Inc()
+}
+
+func (m *promWorkerMetrics) incrementRetried() {
+	m.BasicMetrics.incrementRetried()
+	m.retried.Inc()
+}
+
+func (m *promWorkerMetrics) observeDuration(d time.Duration) {
+	m.BasicMetrics.observeDuration(d)
+	m.duration.Observe(d.Seconds())
+}
+
+func (m *promWorkerMetrics) seed(s WorkerSnapshot) {
+	m.BasicMetrics.seed(s)
+	m.started.Add(float64(s.TasksStarted))
+	m.completed.Add(float64(s.TasksSucceeded + s.TasksFailed))
+	m.failed.Add(float64(s.TasksFailed))
+	m.retried.Add(float64(s.TasksRetried))
+}
@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// WithRateLimit lets the workers of the pool, all together, execute tasks at most
+// r times a second with bursts of burst, retries included. A worker waits for the
+// limiter after taking a task and before each Execute, so the task timeout does not
+// run meanwhile; Shutdown and the end of the worker ctx abort the wait and the task
+// with ErrTaskAborted. The limiter runs on the pool clock. Panics if burst is not
+// positive, unless r is rate.Inf.
+func WithRateLimit(r rate.Limit, burst int) PoolOption {
+	if burst <= 0 && r != rate.Inf {
+		panic("burst must be greater than 0")
+	}
+	return func(wp *IWorkerPool) {
+		wp.limiter = rate.NewLimiter(r, burst)
+	}
+}
+
+// throttle waits until the limiter of the pool, if any, lets the task execute.
+// It reports false, giving the reservation back, if the worker must stop first.
+func (w *IWorker) throttle(ctx context.Context, env envelope) bool {
+	limiter := w.pool.limiter
+	if limiter == nil {
+		return true
+	}
+	now := w.pool.clock.Now()
+	reservation := limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay <= 0 {
+		return true
+	}
+	if w.pool.debugTask(env.id) {
+		w.pool.log.Debug("task throttled", append(env.fields(),
+			zap.Int("worker_id", w.id),
+			zap.Duration("delay", delay),
+		)...)
+	}
+	waited := w.wait(ctx, delay)
+	end := w.pool.clock.Now()
+	w.pool.metrics.observeThrottle(end.Sub(now))
+	if !waited {
+		reservation.CancelAt(end)
+	}
+	return waited
+}
@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var ErrInvalidInterval = errors.New("interval must be greater than 0")
+
+// CancelFunc stops a recurring task. A run already queued or running is left to finish.
+type CancelFunc func()
+
+type recurringConfig struct {
+	overlap bool
+}
+
+type RecurringOption func(*recurringConfig)
+
+// WithOverlap queues a run of a recurring task on every tick, even while the
+// previous run is still queued or running.
+func WithOverlap() RecurringOption {
+	return func(c *recurringConfig) {
+		c.overlap = true
+	}
+}
+
+// recurringRun is one run of a recurring task. Without overlap it clears running when it ends.
+type recurringRun struct {
+	task    Task
+	running *atomic.Bool
+}
+
+func (r recurringRun) Execute(ctx context.Context) error {
+	if r.running != nil {
+		defer r.running.Store(false)
+	}
+	return r.task.Execute(ctx)
+}
+
+func (r recurringRun) Stringer() string {
+	return r.task.Stringer()
+}
+
+func (r recurringRun) Kind() string {
+	return kindOf(r.task)
+}
+
+// SubmitEvery queues task with normal priority every interval on the pool clock, the
+// first time one interval after the call, until the returned CancelFunc is called, ctx
+// ends, or Drain or Shutdown is called. No worker is held between runs.
+// A tick is skipped while the previous run is still queued or running, unless
+// WithOverlap is given, and when the queue is full. Skipped ticks are counted by
+// PoolMetrics.RecurringSkipped.
+// Return ErrInvalidInterval for a non-positive interval and ErrWorkerPoolClosed after
+// Drain or Shutdown.
+func (wp *IWorkerPool) SubmitEvery(ctx context.Context, task Task, interval time.Duration, opts ...RecurringOption) (CancelFunc, error) {
+	if interval <= 0 {
+		return nil, ErrInvalidInterval
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var cfg recurringConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	// The ticker goroutine queues tasks, so Drain waits for it like for any producer.
+	if err := wp.enter(); err != nil {
+		return nil, err
+	}
+	ticker := wp.clock.NewTicker(interval)
+	cancelled := make(chan struct{})
+	var once sync.Once
+	go wp.runRecurring(ctx, task, cfg, ticker.C(), cancelled, ticker.Stop)
+	wp.log.Debug("recurring task submitted", TaskField(task), zap.Duration("interval", interval))
+	return func() { once.Do(func() { close(cancelled) }) }, nil
+}
+
+// runRecurring queues a run of task on every tick until cancelled, ctx ends or the pool closes.
+func (wp *IWorkerPool) runRecurring(ctx context.Context, task Task, cfg recurringConfig,
+	ticks <-chan time.Time, cancelled <-chan struct{}, stop func(),
+) {
+	defer wp.producers.Done()
+	defer stop()
+	var running *atomic.Bool
+	if !cfg.overlap {
+		running = &atomic.Bool{}
+	}
+	queue, _ := PriorityNormal.queue()
+	for {
+		select {
+		case <-ticks:
+		case <-cancelled:
+			return
+		case <-ctx.Done():
+			return
+		case <-wp.done:
+			return
+		}
+		if running != nil && !running.CompareAndSwap(false, true) {
+			wp.skipRecurring(task, "previous run still active")
+			continue
+		}
+		env := wp.envelope(recurringRun{task: task, running: running})
+		if wp.offer(env, queue) {
+			wp.submitted(env)
+			continue
+		}
+		if running != nil {
+			running.Store(false)
+		}
+		wp.auditDropped(env, "task queue is full")
+		wp.skipRecurring(task, "task queue is full")
+	}
+}
+
+func (wp *IWorkerPool) skipRecurring(task Task, reason string) {
+	wp.metrics.incrementRecurringSkipped()
+	if wp.log.Core().Enabled(zap.DebugLevel) {
+		wp.log.Debug("recurring task run skipped", TaskField(task), zap.String("reason", reason))
+	}
+}
@@ -0,0 +1,244 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/errstore"
+	"github.com/OrtemRepos/shortlink/internal/logger"
+)
+
+var ErrPoolNotConfigured = errors.New("worker pool is not configured")
+var ErrPoolExists = errors.New("worker pool already registered")
+
+// Stage orders pools on shutdown.
+type Stage string
+
+const (
+	// StageIngest pools take work from requests and jobs and may feed flush pools.
+	StageIngest Stage = "ingest"
+	// StageFlush pools write out what ingest pools produced, so they are drained last.
+	StageFlush Stage = "flush"
+)
+
+var stageOrder = []Stage{StageIngest, StageFlush}
+
+// Registry owns the application's worker pools by name.
+type Registry struct {
+	pools  map[string]WorkerPool
+	stages map[string]Stage
+	mu     sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		pools:  make(map[string]WorkerPool),
+		stages: make(map[string]Stage),
+	}
+}
+
+// NewRegistryFromConfig builds one pool per entry of cfg.Pools; opts apply to every pool
+// and override its configured settings.
+func NewRegistryFromConfig(cfg *configs.Config, opts ...PoolOption) (*Registry, error) {
+	r := NewRegistry()
+	restored := loadRestored(cfg)
+	for name, pc := range cfg.Pools {
+		workers, buffer, errMax := pc.Workers, pc.BufferSize, pc.ErrMaximumAmount
+		if workers == 0 {
+			workers = cfg.Worker.WorkersCount
+		}
+		if buffer == 0 {
+			buffer = cfg.Worker.BufferSize
+		}
+		if errMax == 0 {
+			errMax = cfg.Worker.ErrMaximumAmount
+		}
+		stage := Stage(pc.Stage)
+		if stage == "" {
+			stage = StageIngest
+		}
+		poolOpts := []PoolOption{
+			WithWorkers(workers),
+			WithBuffer(buffer),
+			WithErrorCap(errMax),
+			WithTaskTimeout(pc.TaskTimeout),
+			WithShutdownTimeout(pc.ShutdownTimeout),
+			WithSharding(pc.Sharded),
+			WithRequireStart(pc.RequireStart),
+		}
+		if pc.MaxAttempts > 1 {
+			backoffMax := max(pc.RetryBackoffMax, pc.RetryBackoff)
+			poolOpts = append(poolOpts, WithRetry(RetryPolicy{
+				MaxAttempts: pc.MaxAttempts,
+				Backoff:     ExponentialBackoff(pc.RetryBackoff, backoffMax),
+			}))
+		}
+		if pc.RateLimit > 0 {
+			poolOpts = append(poolOpts, WithRateLimit(rate.Limit(pc.RateLimit), max(pc.RateBurst, 1)))
+		}
+		if pc.LogSampling > 0 {
+			poolOpts = append(poolOpts, WithLogSampling(pc.LogSampling))
+		}
+		if snapshot, ok := restored.Pools[name]; ok {
+			poolOpts = append(poolOpts, WithRestoredMetrics(snapshot, cfg.PoolMetrics.Merge))
+		}
+		poolOpts = append(poolOpts, opts...)
+		pool, err := NewPool(name, poolOpts...)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.Register(name, stage, pool); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// loadRestored reads the counters saved by the last graceful shutdown. They are
+// only statistics, so a snapshot that cannot be used is ignored with a warning.
+func loadRestored(cfg *configs.Config) Snapshot {
+	if cfg.PoolMetrics.Path == "" {
+		return Snapshot{}
+	}
+	snapshot, err := LoadSnapshot(cfg.PoolMetrics.Path, cfg.PoolMetrics.MaxAge, time.Now())
+	if err != nil {
+		logger.GetLogger().Warn("Ignoring saved worker pool metrics", zap.Error(err))
+		return Snapshot{}
+	}
+	return snapshot
+}
+
+func (r *Registry) Register(name string, stage Stage, pool WorkerPool) error {
+	if stage != StageIngest && stage != StageFlush {
+		return fmt.Errorf("worker pool %q: unknown stage %q", name, stage)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.pools[name]; ok {
+		return fmt.Errorf("%w: %s", ErrPoolExists, name)
+	}
+	r.pools[name] = pool
+	r.stages[name] = stage
+	return nil
+}
+
+func (r *Registry) Get(name string) (WorkerPool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	pool, ok := r.pools[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPoolNotConfigured, name)
+	}
+	return pool, nil
+}
+
+// MustGet is Get for constructors: a missing pool is a configuration error
+// that must stop startup rather than surface on first use.
+func (r *Registry) MustGet(name string) WorkerPool {
+	pool, err := r.Get(name)
+	if err != nil {
+		panic(err)
+	}
+	return pool
+}
+
+// Names returns the registered pool names sorted.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.pools))
+	for name := range r.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Registry) Metrics() map[string]MetricsResult {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make(map[string]MetricsResult, len(r.pools))
+	for name, pool := range r.pools {
+		result[name] = pool.Metrics()
+	}
+	return result
+}
+
+// SnapshotAndReset resets the metrics of every pool and returns them by name as
+// they were before, see WorkerPool.SnapshotAndReset.
+func (r *Registry) SnapshotAndReset() map[string]MetricsResult {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make(map[string]MetricsResult, len(r.pools))
+	for name, pool := range r.pools {
+		result[name] = pool.SnapshotAndReset()
+	}
+	return result
+}
+
+// Configs returns the settings every pool runs with by name.
+func (r *Registry) Configs() map[string]PoolConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make(map[string]PoolConfig, len(r.pools))
+	for name, pool := range r.pools {
+		result[name] = pool.Config()
+	}
+	return result
+}
+
+// Errors returns the error store of every pool by name.
+func (r *Registry) Errors() map[string]*errstore.Store {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make(map[string]*errstore.Store, len(r.pools))
+	for name, pool := range r.pools {
+		result[name] = pool.Errors()
+	}
+	return result
+}
+
+// DrainStage drains every pool of stage and waits for all of them.
+func (r *Registry) DrainStage(ctx context.Context, stage Stage) error {
+	r.mu.RLock()
+	pools := make(map[string]WorkerPool)
+	for name, pool := range r.pools {
+		if r.stages[name] == stage {
+			pools[name] = pool
+		}
+	}
+	r.mu.RUnlock()
+
+	errs := make(chan error, len(pools))
+	for name, pool := range pools {
+		go func(name string, pool WorkerPool) {
+			if err := pool.Drain(ctx); err != nil {
+				errs <- fmt.Errorf("drain %s: %w", name, err)
+				return
+			}
+			errs <- nil
+		}(name, pool)
+	}
+	var result []error
+	for range pools {
+		result = append(result, <-errs)
+	}
+	return errors.Join(result...)
+}
+
+// Drain drains ingest pools, then flush pools.
+func (r *Registry) Drain(ctx context.Context) error {
+	var errs []error
+	for _, stage := range stageOrder {
+		errs = append(errs, r.DrainStage(ctx, stage))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,116 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrTaskCancelled is the error of a Future cancelled before its task ran.
+var ErrTaskCancelled = errors.New("task cancelled")
+
+// ResultPool submits functions returning a T to a pool and gives their results back
+// as futures, so callers need no Task type of their own to carry them. The tasks are
+// tracked tasks of the pool: they are counted in its metrics, retried and timed out
+// by its options, and aborted by its Shutdown like any other.
+type ResultPool[T any] struct {
+	pool WorkerPool
+	name string
+}
+
+// NewResultPool returns a ResultPool submitting to pool tasks named name, or after
+// the signature of their function if name is empty.
+func NewResultPool[T any](pool WorkerPool, name string) *ResultPool[T] {
+	if name == "" {
+		name = "func(context.Context) (" + reflect.TypeFor[T]().String() + ", error)"
+	}
+	return &ResultPool[T]{pool: pool, name: name}
+}
+
+// Submit queues fn like SubmitTracked and returns the future of its result.
+func (p *ResultPool[T]) Submit(ctx context.Context, fn func(ctx context.Context) (T, error)) (*Future[T], error) {
+	future := &Future[T]{cancelled: make(chan struct{})}
+	handle, err := p.pool.SubmitTracked(ctx, resultTask[T]{name: p.name, fn: fn, future: future})
+	if err != nil {
+		return nil, err
+	}
+	future.handle = handle
+	return future, nil
+}
+
+const (
+	futurePending int32 = iota
+	futureRunning
+	futureCancelled
+)
+
+// Future is the result of a function submitted to a ResultPool.
+type Future[T any] struct {
+	handle    *TaskHandle
+	state     atomic.Int32
+	cancelled chan struct{}
+	mu        sync.Mutex
+	value     T
+}
+
+// Get waits for the function to return and returns its result: its value if it
+// succeeded, its error otherwise, as TaskHandle.Err gives it. Return ErrTaskCancelled
+// after Cancel and ctx.Err() if ctx ends first.
+func (f *Future[T]) Get(ctx context.Context) (T, error) {
+	var zero T
+	select {
+	case <-f.handle.Done():
+	case <-f.cancelled:
+		return zero, ErrTaskCancelled
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+	if err := f.handle.Err(); err != nil {
+		return zero, err
+	}
+	if f.state.Load() == futureCancelled {
+		return zero, ErrTaskCancelled
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.value, nil
+}
+
+// Cancel keeps the function from running if no worker took it yet, and reports
+// whether it did. The task stays in the queue until a worker skips it.
+func (f *Future[T]) Cancel() bool {
+	if !f.state.CompareAndSwap(futurePending, futureCancelled) {
+		return false
+	}
+	close(f.cancelled)
+	return true
+}
+
+// resultTask runs the function of a future and keeps its value.
+type resultTask[T any] struct {
+	name   string
+	fn     func(ctx context.Context) (T, error)
+	future *Future[T]
+}
+
+func (t resultTask[T]) Execute(ctx context.Context) error {
+	if !t.future.state.CompareAndSwap(futurePending, futureRunning) && t.future.state.Load() == futureCancelled {
+		return nil
+	}
+	value, err := t.fn(ctx)
+	if err != nil {
+		return err
+	}
+	// An attempt left behind by WithTaskTimeout has its ctx ended: its value is not
+	// the result, which is ErrTaskTimeout or that of a later attempt.
+	if ctx.Err() == nil {
+		t.future.mu.Lock()
+		t.future.value = value
+		t.future.mu.Unlock()
+	}
+	return nil
+}
+
+func (t resultTask[T]) Stringer() string { return t.name }
@@ -0,0 +1,108 @@
+package worker
+
+// queueSet holds one queue per priority, indexed like priorities.
+type queueSet [len(priorities)]chan envelope
+
+// WithSharding, if sharded, gives each worker the pool starts with a queue set of its
+// own, a shard, holding its part of the buffer, instead of one set shared by every
+// worker. Submit spreads tasks over the shards in turn and a worker takes from its
+// own shard first, then steals from the longest one, so workers rarely contend on
+// the same channel. Priorities still come first: a worker takes a high priority task
+// from another shard before a normal one of its own. Workers added by Resize share
+// the shards round the ring. By default the pool has one shard, which fits a few
+// workers and a few CPUs best; BenchmarkSharding tells where sharding starts to pay.
+func WithSharding(sharded bool) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.size.sharded = sharded
+	}
+}
+
+// makeShards makes n shards holding buffer tasks of each priority between them.
+func (wp *IWorkerPool) makeShards(n, buffer int) {
+	perShard := (buffer + n - 1) / n
+	wp.shards = make([]queueSet, n)
+	for i := range wp.shards {
+		for j := range wp.shards[i] {
+			wp.shards[i][j] = make(chan envelope, perShard)
+		}
+	}
+	if n > 1 {
+		wp.wake = make(chan struct{}, 1)
+	}
+}
+
+// capacity returns how many tasks of each priority the shards hold between them.
+func (wp *IWorkerPool) capacity() int {
+	return len(wp.shards) * cap(wp.shards[0][0])
+}
+
+// nextShard returns the index of the shard the next task goes to.
+func (wp *IWorkerPool) nextShard() int {
+	if len(wp.shards) == 1 {
+		return 0
+	}
+	return int(wp.shardTurn.Add(1) % uint64(len(wp.shards)))
+}
+
+// offer queues env without waiting, in the next shard or, if it is full, the first
+// of the following ones with room, and reports whether it did.
+func (wp *IWorkerPool) offer(env envelope, queue int) bool {
+	first := wp.nextShard()
+	for i := range wp.shards {
+		select {
+		case wp.shards[(first+i)%len(wp.shards)][queue] <- env:
+			wp.woken()
+			return true
+		default:
+		}
+	}
+	return false
+}
+
+// woken tells an idle worker of a sharded pool that a task was queued, in a shard
+// that may not be its own.
+func (wp *IWorkerPool) woken() {
+	if wp.wake == nil {
+		return
+	}
+	select {
+	case wp.wake <- struct{}{}:
+	default:
+	}
+}
+
+// steal takes a task of queue from the shard other than the worker's own holding the
+// most, if any.
+func (w *IWorker) steal(queue int) (envelope, bool) {
+	for {
+		victim, most := -1, 0
+		for i := range w.pool.shards {
+			if n := len(w.pool.shards[i][queue]); i != w.home && n > most {
+				victim, most = i, n
+			}
+		}
+		if victim < 0 {
+			return envelope{}, false
+		}
+		select {
+		case env := <-w.pool.shards[victim][queue]:
+			return env, true
+		default:
+			// Another worker took it first: look again.
+		}
+	}
+}
+
+// shardDepths returns the tasks waiting in each shard, nil if the pool is not sharded.
+func (wp *IWorkerPool) shardDepths() []int {
+	if len(wp.shards) == 1 {
+		return nil
+	}
+	depths := make([]int, len(wp.shards))
+	for i, shard := range wp.shards {
+		for _, queue := range shard {
+			depths[i] += len(queue)
+		}
+	}
+	return depths
+}
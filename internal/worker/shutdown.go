@@ -0,0 +1,76 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrShutdownTimeout is returned by Shutdown when tasks ignored their cancelled ctx
+// past the timeout of WithShutdownTimeout.
+var ErrShutdownTimeout = errors.New("shutdown timed out")
+
+// WithShutdownTimeout bounds how long Shutdown waits for running tasks once it has
+// cancelled their ctx. Past it, the tasks still running are logged with their
+// Stringer and Shutdown returns ErrShutdownTimeout, leaving their workers behind:
+// the pool is stopped whenever they return. Zero, the default, waits as long as the
+// ctx given to Shutdown allows.
+func WithShutdownTimeout(timeout time.Duration) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.shutdownTimeout = timeout
+	}
+}
+
+// runningTask is a task inside execute, with the cancel of its ctx.
+type runningTask struct {
+	env      envelope
+	workerID int
+	since    time.Time
+	cancel   context.CancelFunc
+}
+
+// track derives the ctx of one execution of env by worker w, which halt cancels,
+// and returns it with the func to call once the execution is over.
+func (wp *IWorkerPool) track(ctx context.Context, w *IWorker, env envelope) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	wp.runningMu.Lock()
+	wp.runningTasks[env.id] = runningTask{env: env, workerID: w.id, since: wp.clock.Now(), cancel: cancel}
+	wp.runningMu.Unlock()
+	return ctx, func() {
+		wp.runningMu.Lock()
+		delete(wp.runningTasks, env.id)
+		wp.runningMu.Unlock()
+		cancel()
+	}
+}
+
+// cancelRunning cancels the ctx of every task inside execute.
+func (wp *IWorkerPool) cancelRunning() {
+	wp.runningMu.Lock()
+	defer wp.runningMu.Unlock()
+	for _, task := range wp.runningTasks {
+		task.cancel()
+	}
+}
+
+// logStuck logs the tasks still inside execute, oldest first, and returns how many there are.
+func (wp *IWorkerPool) logStuck() int {
+	wp.runningMu.Lock()
+	stuck := make([]runningTask, 0, len(wp.runningTasks))
+	for _, task := range wp.runningTasks {
+		stuck = append(stuck, task)
+	}
+	wp.runningMu.Unlock()
+	sort.Slice(stuck, func(i, j int) bool { return stuck[i].env.id < stuck[j].env.id })
+	now := wp.clock.Now()
+	for _, task := range stuck {
+		wp.log.Error("task still running after shutdown timeout", append(task.env.fields(),
+			zap.Int("worker_id", task.workerID),
+			zap.Duration("running_for", now.Sub(task.since)),
+		)...)
+	}
+	return len(stuck)
+}
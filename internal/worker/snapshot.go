@@ -0,0 +1,154 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrSnapshotStale = errors.New("metrics snapshot is stale")
+
+// Snapshot is the file the counters of every pool are saved to on graceful shutdown.
+type Snapshot struct {
+	SavedAt time.Time               `json:"saved_at"`
+	Pools   map[string]PoolSnapshot `json:"pools"`
+}
+
+// PoolSnapshot holds the counters of one pool, by worker ID.
+type PoolSnapshot struct {
+	TasksEnqueued int                    `json:"tasks_enqueued"`
+	Workers       map[int]WorkerSnapshot `json:"workers"`
+}
+
+type WorkerSnapshot struct {
+	TasksStarted   int `json:"tasks_started"`
+	TasksSucceeded int `json:"tasks_succeeded"`
+	TasksFailed    int `json:"tasks_failed"`
+	TasksRetried   int `json:"tasks_retried"`
+}
+
+// RestoredMetrics shows restored counters next to the live ones, summed over workers.
+type RestoredMetrics struct {
+	TasksEnqueued  int `json:"restored_tasks_enqueued"`
+	TasksStarted   int `json:"restored_tasks_started"`
+	TasksSucceeded int `json:"restored_tasks_succeeded"`
+	TasksFailed    int `json:"restored_tasks_failed"`
+	TasksRetried   int `json:"restored_tasks_retried"`
+}
+
+func (s PoolSnapshot) restoredMetrics() *RestoredMetrics {
+	m := &RestoredMetrics{TasksEnqueued: s.TasksEnqueued}
+	for _, w := range s.Workers {
+		m.TasksStarted += w.TasksStarted
+		m.TasksSucceeded += w.TasksSucceeded
+		m.TasksFailed += w.TasksFailed
+		m.TasksRetried += w.TasksRetried
+	}
+	return m
+}
+
+func (s WorkerSnapshot) add(other WorkerSnapshot) WorkerSnapshot {
+	s.TasksStarted += other.TasksStarted
+	s.TasksSucceeded += other.TasksSucceeded
+	s.TasksFailed += other.TasksFailed
+	s.TasksRetried += other.TasksRetried
+	return s
+}
+
+func snapshotOf(m Metrics) WorkerSnapshot {
+	return WorkerSnapshot{
+		TasksStarted:   m.TasksStarted(),
+		TasksSucceeded: m.TasksSucceeded(),
+		TasksFailed:    m.TasksFailed(),
+		TasksRetried:   m.TasksRetried(),
+	}
+}
+
+// WithRestoredMetrics starts the pool from counters saved before a restart.
+// Merged counters are added to the live ones; otherwise they are reported as
+// restored_* fields of MetricsResult. Either way they are saved again by Snapshot.
+func WithRestoredMetrics(s PoolSnapshot, merge bool) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.restored = &s
+		wp.merge = merge
+	}
+}
+
+// seed adds s to the counters of the workers with the same IDs.
+// Counters of workers the pool no longer has go to the first worker.
+func (wp *IWorkerPool) seed(s PoolSnapshot) {
+	wp.metrics.seedEnqueued(s.TasksEnqueued)
+	byID := make(map[int]*IWorker, len(wp.workers))
+	for _, w := range wp.workers {
+		byID[w.getID()] = w.(*IWorker)
+	}
+	for id, counters := range s.Workers {
+		w, ok := byID[id]
+		if !ok {
+			w = wp.workers[0].(*IWorker)
+		}
+		w.metricsWorker.seed(counters)
+	}
+}
+
+func (wp *IWorkerPool) Snapshot() PoolSnapshot {
+	s := PoolSnapshot{
+		TasksEnqueued: wp.metrics.TasksEnqueued(),
+		Workers:       make(map[int]WorkerSnapshot),
+	}
+	for id, m := range wp.Metrics().WorkersMetrics {
+		s.Workers[id] = snapshotOf(m)
+	}
+	if wp.restored != nil && !wp.merge {
+		s.TasksEnqueued += wp.restored.TasksEnqueued
+		for id, counters := range wp.restored.Workers {
+			s.Workers[id] = s.Workers[id].add(counters)
+		}
+	}
+	return s
+}
+
+// SaveSnapshot writes the counters of every pool to path, replacing the file atomically.
+func (r *Registry) SaveSnapshot(path string, now time.Time) error {
+	r.mu.RLock()
+	snapshot := Snapshot{SavedAt: now, Pools: make(map[string]PoolSnapshot, len(r.pools))}
+	for name, pool := range r.pools {
+		snapshot.Pools[name] = pool.Snapshot()
+	}
+	r.mu.RUnlock()
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadSnapshot reads a snapshot saved by SaveSnapshot. A missing file is an empty
+// snapshot; one saved more than maxAge before now is ErrSnapshotStale.
+func LoadSnapshot(path string, maxAge time.Duration, now time.Time) (Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Snapshot{}, nil
+	}
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return Snapshot{}, fmt.Errorf("corrupt metrics snapshot %s: %w", path, err)
+	}
+	if maxAge > 0 && now.Sub(snapshot.SavedAt) > maxAge {
+		return Snapshot{}, fmt.Errorf("%w: saved at %s", ErrSnapshotStale, snapshot.SavedAt.Format(time.RFC3339))
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"context"
+	"maps"
+	"sort"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// SubmitWithValues is Submit carrying kv with the task, say the ID of the request
+// and the user it was submitted for, so the task can log them without fields of its
+// own: ValuesFromContext returns them from the ctx the task runs with, and the
+// LoggingInterceptor logs them as values. kv is copied.
+func (wp *IWorkerPool) SubmitWithValues(ctx context.Context, task Task, kv map[string]string) error {
+	return wp.submit(ctx, task, nil, PriorityNormal, maps.Clone(kv))
+}
+
+// ValuesFromContext returns a copy of the values the running task was submitted
+// with by SubmitWithValues, nil for a task submitted otherwise or outside a task.
+func ValuesFromContext(ctx context.Context) map[string]string {
+	e, ok := executionFrom(ctx)
+	if !ok {
+		return nil
+	}
+	return maps.Clone(e.env.values)
+}
+
+// valuesField logs values in the order of their keys, if there are any.
+func valuesField(values map[string]string) zap.Field {
+	if len(values) == 0 {
+		return zap.Skip()
+	}
+	return zap.Object("values", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			enc.AddString(k, values[k])
+		}
+		return nil
+	}))
+}
@@ -4,33 +4,78 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"runtime/debug"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/errstore"
 	"github.com/OrtemRepos/shortlink/internal/logger"
+	"github.com/OrtemRepos/shortlink/internal/logsample"
+	"github.com/OrtemRepos/shortlink/internal/taskgroup"
 )
 
 type worker interface {
 	start(ctx context.Context)
-	stop()
 	getID() int
 	metrics() Metrics
+	resetMetrics() Metrics
+	retire()
 }
 
 type WorkerPool interface {
-	Start(ctx context.Context)
+	Start(ctx context.Context) error
 	Drain(ctx context.Context) error
+	DrainWithTimeout(ctx context.Context, graceful time.Duration) error
 	Shutdown(ctx context.Context) error
 	Submit(ctx context.Context, task Task) error
+	SubmitWithPriority(ctx context.Context, task Task, priority Priority) error
+	SubmitWithValues(ctx context.Context, task Task, kv map[string]string) error
+	SubmitAfter(ctx context.Context, task Task, delay time.Duration) error
+	SubmitAt(ctx context.Context, task Task, at time.Time) error
+	SubmitEvery(ctx context.Context, task Task, interval time.Duration, opts ...RecurringOption) (CancelFunc, error)
+	SubmitTracked(ctx context.Context, task Task) (*TaskHandle, error)
+	SubmitWait(ctx context.Context, task Task) error
+	SubmitBatch(ctx context.Context, tasks []Task) (accepted int, err error)
+	// Group returns a TaskGroup to submit tasks to the pool and wait for them together.
+	Group() *TaskGroup
+	Resize(ctx context.Context, n int) error
+	Pause() error
+	Resume()
 	Metrics() MetricsResult
+	// ResetMetrics zeroes the counters of the pool and of its workers, see SnapshotAndReset.
+	ResetMetrics()
+	// SnapshotAndReset zeroes the counters of the pool and of its workers and returns
+	// the metrics with their values before, so a poller can add up deltas without
+	// missing or counting twice a task. Each counter is swapped atomically, while
+	// workers go on counting: a task running meanwhile may have its start counted
+	// before the reset and its end after. Gauges, such as queue depth and tasks in
+	// flight, are not reset, nor are RestoredMetrics or Prometheus metrics, which
+	// are meant to only ever grow.
+	SnapshotAndReset() MetricsResult
+	State() PoolState
+	Config() PoolConfig
+	// Snapshot returns the counters to persist, restored ones included.
+	Snapshot() PoolSnapshot
+	// Errors returns the store of the last task errors of the pool. Its Recent
+	// returns a copy and forgets nothing, so any number of readers can use it.
+	Errors() *errstore.Store
+	// Error returns the errors kept in Errors and forgets them, so of two callers
+	// only the first sees them; use Errors or WithOnError to share them.
+	// Nothing is forgotten once ctx is done.
 	Error(ctx context.Context) error
 }
 
 var ErrWorkerPoolClosed = errors.New("worker pool closed")
 var ErrWorkerPoolFull = errors.New("worker queue full")
+var ErrTaskTimeout = errors.New("task timed out")
+var ErrInvalidWorkerCount = errors.New("worker count must be greater than 0")
 
 // Should respect ctx.Done() to abort on shutdown
 // Stringer() should return a string representation of the task without any sensitive data
@@ -39,182 +84,1015 @@ type Task interface {
 	Stringer() string
 }
 
+// PoolMetrics are the counters of a pool. They are marshaled as the "pool" object
+// of MetricsResult, so implementations must marshal themselves.
 type PoolMetrics interface {
+	json.Marshaler
 	TasksEnqueued() int
+	// TasksEnqueuedWithPriority counts the tasks of one priority enqueued since
+	// the pool was created; restored counters are in TasksEnqueued only.
+	TasksEnqueuedWithPriority(p Priority) int
+	// TasksByKind counts the tasks of each kind, see Kinded, since the pool was created.
+	TasksByKind() map[string]KindCounts
+	// TasksScheduled counts the tasks of SubmitAt and SubmitAfter not due yet.
+	TasksScheduled() int
+	// ScheduledDropped counts the scheduled tasks dropped by Drain or Shutdown.
+	ScheduledDropped() int
+	// RecurringSkipped counts the ticks of SubmitEvery that queued no run.
+	RecurringSkipped() int
+	// QueueDepth counts the tasks waiting in the queues of the pool, and
+	// QueueDepthWithPriority those of one priority.
+	QueueDepth() int
+	QueueDepthWithPriority(p Priority) int
+	// QueueCapacity is the size of the queue of each priority: Submit fails with
+	// ErrWorkerPoolFull once the queue of its priority holds that many tasks.
+	QueueCapacity() int
+	// TaskWait sums up how long tasks waited in a queue before a worker took them.
+	TaskWait() WaitStats
+	// TasksDeduplicated counts the submissions refused with ErrDuplicateTask.
+	TasksDeduplicated() int
+	// TasksThrottled counts the executions that waited for the limiter of
+	// WithRateLimit, and ThrottleWait how long they waited in all.
+	TasksThrottled() int
+	ThrottleWait() time.Duration
+	// TasksAbandoned counts the tasks Shutdown or a forced DrainWithTimeout aborted
+	// while running or dropped from the queue.
+	TasksAbandoned() int
+	// InFlight counts the tasks taken by a worker and not ended yet, waits between
+	// attempts included. ActiveWorkers counts the workers inside Execute right now;
+	// a task left behind by WithTaskTimeout counts until it returns.
+	InFlight() int
+	ActiveWorkers() int
 }
 
+// WaitStats are the shortest, mean and longest queue waits of the Count tasks
+// taken by a worker since the pool was created.
+type WaitStats struct {
+	Count int           `json:"count"`
+	Min   time.Duration `json:"min"`
+	Avg   time.Duration `json:"avg"`
+	Max   time.Duration `json:"max"`
+}
+
+// MetricsResult is the state of a pool at At, restored counters included.
 type MetricsResult struct {
+	// Name is the name of the pool, and At the time of its clock Metrics was called at.
+	Name           string
+	At             time.Time
 	PoolMetrics    PoolMetrics
 	WorkersMetrics map[int]Metrics
+	// RetiredWorkers are the IDs of the workers removed by Resize; their counters
+	// stay in WorkersMetrics.
+	RetiredWorkers []int
+	// RecentFailures are the last failed tasks of the pool, oldest first.
+	RecentFailures []FailedTask
+	// Paused tells whether the pool is paused, and PausedFor since when.
+	Paused    bool
+	PausedFor time.Duration
+	// QueuedKeys counts the Deduplicated keys held by queued tasks.
+	QueuedKeys int
+	// QueuedBeforeStart counts the tasks queued before Start, see WithRequireStart.
+	QueuedBeforeStart int64
+	// AuditDropped counts the records of WithAudit dropped, for a full buffer or a
+	// failed write.
+	AuditDropped int64
+	// ShardDepths counts the tasks queued in each shard of a pool built WithSharding,
+	// by the index of the shard; a worker's is its ID minus one, modulo their number.
+	ShardDepths []int
+	// InFlight and ActiveWorkers are those of PoolMetrics when Metrics was called.
+	InFlight      int
+	ActiveWorkers int
+	// ErrorsDropped counts the task errors pushed out of Errors by newer ones
+	// before being drained; WithOnError still saw them.
+	ErrorsDropped int64
+	// Config is what the pool runs with.
+	Config PoolConfig
+	// RestoredMetrics are the counters restored from before the last restart,
+	// when they are not merged into the live ones.
+	*RestoredMetrics
+}
+
+// FailedTask identifies a failed task by the ID the pool gave it on submit.
+type FailedTask struct {
+	ID    uint64    `json:"id"`
+	Task  string    `json:"task"`
+	Error string    `json:"error"`
+	At    time.Time `json:"at"`
+}
+
+func (m MetricsResult) MarshalJSON() ([]byte, error) {
+	workers := make(map[string]Metrics, len(m.WorkersMetrics))
+	for id, metrics := range m.WorkersMetrics {
+		workers[strconv.Itoa(id)] = metrics
+	}
+	return json.Marshal(struct {
+		Name              string             `json:"name"`
+		At                time.Time          `json:"at"`
+		Pool              PoolMetrics        `json:"pool"`
+		Workers           map[string]Metrics `json:"workers"`
+		RetiredWorkers    []int              `json:"retired_workers"`
+		RecentFailures    []FailedTask       `json:"recent_failures"`
+		Paused            bool               `json:"paused"`
+		PausedFor         time.Duration      `json:"paused_for"`
+		QueuedKeys        int                `json:"queued_keys"`
+		QueuedBeforeStart int64              `json:"queued_before_start"`
+		AuditDropped      int64              `json:"audit_dropped"`
+		ShardDepths       []int              `json:"queue_depth_by_shard,omitempty"`
+		InFlight          int                `json:"in_flight"`
+		ActiveWorkers     int                `json:"active_workers"`
+		ErrorsDropped     int64              `json:"errors_dropped"`
+		Config            PoolConfig         `json:"config"`
+		*RestoredMetrics
+	}{
+		Name:              m.Name,
+		At:                m.At,
+		Pool:              m.PoolMetrics,
+		Workers:           workers,
+		RetiredWorkers:    orEmpty(m.RetiredWorkers),
+		RecentFailures:    orEmpty(m.RecentFailures),
+		Paused:            m.Paused,
+		PausedFor:         m.PausedFor,
+		QueuedKeys:        m.QueuedKeys,
+		QueuedBeforeStart: m.QueuedBeforeStart,
+		AuditDropped:      m.AuditDropped,
+		ShardDepths:       m.ShardDepths,
+		InFlight:          m.InFlight,
+		ActiveWorkers:     m.ActiveWorkers,
+		ErrorsDropped:     m.ErrorsDropped,
+		Config:            m.Config,
+		RestoredMetrics:   m.RestoredMetrics,
+	})
+}
+
+// orEmpty returns s, empty rather than nil, so it is marshaled as [] rather than null.
+func orEmpty[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+// maxRecentFailures bounds the failures kept for MetricsResult.
+const maxRecentFailures = 20
+
+// envelope carries a task through the queue with its ID, handle, queue time and dedup key.
+type envelope struct {
+	id       uint64
+	task     Task
+	priority Priority
+	handle   *TaskHandle
+	queuedAt time.Time
+	dedupKey string
+	kind     string
+	// values are those of SubmitWithValues.
+	values map[string]string
+}
+
+func (e envelope) fields() []zap.Field {
+	return []zap.Field{zap.Uint64("task_id", e.id), TaskField(e.task)}
+}
+
+// TaskField logs task as its Stringer. Tasks must never be logged otherwise, say with
+// zap.Any: reflection would dump every field, sensitive ones included.
+func TaskField(task Task) zap.Field {
+	return zap.String("task", task.Stringer())
 }
 
 type poolMetricsIncrement interface {
 	PoolMetrics
-	incrementEnqueued()
+	incrementEnqueued(p Priority)
+	addScheduled(delta int)
+	incrementScheduledDropped()
+	incrementRecurringSkipped()
+	seedEnqueued(n int)
+	// observeQueue gives the metrics the depth of the queue of each priority and their capacity.
+	observeQueue(depth func(p Priority) int, capacity int)
+	// observeWorkers gives the metrics the tasks in flight and the workers inside Execute.
+	observeWorkers(inFlight, active func() int)
+	observeWait(d time.Duration)
+	observeThrottle(d time.Duration)
+	incrementDeduplicated()
+	addAbandoned(n int)
+	// countKind counts event for a task of kind and returns the kind it was counted under.
+	countKind(kind string, event kindEvent) string
+	// reset zeroes the counters and returns metrics holding their values before.
+	reset() PoolMetrics
 }
 
+// Metrics counts tasks of a worker; every started task ends as succeeded or failed.
 type Metrics interface {
 	TasksStarted() int
-	TasksCompleted() int
+	TasksSucceeded() int
 	TasksFailed() int
-	MarshalJSON() ([]byte, error)
+	TasksCompleted() int
+	TasksRetried() int
+	WorkerRestarts() int
+	TotalDuration() time.Duration
+	MaxDuration() time.Duration
+	DurationBuckets() DurationBuckets
+	// MarshalJSON gives the objects of the "workers" object of MetricsResult.
+	json.Marshaler
+}
+
+// durationBounds are the upper bounds of DurationBuckets but the last one.
+var durationBounds = [...]time.Duration{10 * time.Millisecond, 100 * time.Millisecond, time.Second}
+
+// DurationBuckets counts tasks by how long they ran.
+type DurationBuckets struct {
+	Under10ms  int `json:"lt_10ms"`
+	Under100ms int `json:"lt_100ms"`
+	Under1s    int `json:"lt_1s"`
+	Over1s     int `json:"ge_1s"`
 }
 
 type metricsIncrement interface {
 	Metrics
 	incrementStarted()
-	incrementCompleted()
+	incrementSucceeded()
 	incrementFailed()
+	incrementRetried()
+	incrementRestarts()
+	observeDuration(d time.Duration)
+	seed(s WorkerSnapshot)
+	// reset zeroes the counters and returns metrics holding their values before.
+	reset() Metrics
 	MarshalJSON() ([]byte, error)
 }
 
 type NewMetricsFunc func() metricsIncrement
 
+// IWorkerPool never closes its queues, so a producer cannot panic racing Drain or
+// Shutdown; done, drain and stop tell workers and producers when to stop instead.
 type IWorkerPool struct {
-	workers    []worker
-	tasks      chan Task
-	metrics    poolMetricsIncrement
-	isClosed   bool
-	errSlice   []error
-	errMaximum int
-	errMu      sync.Mutex
-	closedMu   sync.RWMutex
-	wg         sync.WaitGroup
-	once       sync.Once
-	log        *zap.Logger
+	name            string
+	workers         []worker
+	retired         []worker
+	workersMu       sync.RWMutex
+	lastID          int
+	newMetrics      func() metricsIncrement
+	runCtx          context.Context
+	shards          []queueSet
+	shardTurn       atomic.Uint64
+	wake            chan struct{}
+	delayed         delayQueue
+	delaySeq        uint64
+	delayClosed     bool
+	delayMu         sync.Mutex
+	delayWake       chan struct{}
+	delayOnce       sync.Once
+	nextID          atomic.Uint64
+	running         atomic.Int64
+	active          atomic.Int64
+	state           atomic.Int32
+	metrics         poolMetricsIncrement
+	errors          *errstore.Store
+	failures        []FailedTask
+	errMu           sync.Mutex
+	closedMu        sync.RWMutex
+	done            chan struct{}
+	drain           chan struct{}
+	stop            chan struct{}
+	gate            pauseGate
+	pauseMu         sync.Mutex
+	cancels         []context.CancelFunc
+	producers       sync.WaitGroup
+	wg              sync.WaitGroup
+	doneOnce        sync.Once
+	drainOnce       sync.Once
+	stopOnce        sync.Once
+	clock           clock.Clock
+	taskTimeout     time.Duration
+	retry           RetryPolicy
+	interceptors    []TaskInterceptor
+	observers       []TaskObserver
+	limiter         *rate.Limiter
+	pending         map[string]struct{}
+	pendingMu       sync.Mutex
+	tasks           *taskgroup.Group
+	onError         func(error)
+	onPanic         PanicHandler
+	restored        *PoolSnapshot
+	merge           bool
+	size            poolSize
+	log             *zap.Logger
+	logEvery        uint64
+	fullLog         *logsample.Sampler
+	fullDropped     atomic.Int64
+	runningTasks    map[uint64]runningTask
+	runningMu       sync.Mutex
+	shutdownTimeout time.Duration
+	auditLog        *auditLog
+	requireStart    bool
+	preStart        atomic.Int64
+	preStartOnce    sync.Once
+}
+
+// RetryPolicy executes a failed task again, up to MaxAttempts executions in all,
+// waiting Backoff between attempts.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     func(attempt int) time.Duration
+	RetryPanics bool
+}
+
+// ExponentialBackoff doubles base after every attempt, up to max.
+func ExponentialBackoff(base, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		d := base
+		for i := 1; i < attempt && d < max; i++ {
+			d *= 2
+		}
+		return min(d, max)
+	}
+}
+
+func (p RetryPolicy) retries(err error, attempt int) bool {
+	var panicked *panicError
+	if attempt >= p.MaxAttempts || (errors.As(err, &panicked) && !p.RetryPanics) {
+		return false
+	}
+	return true
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	if p.Backoff == nil {
+		return 0
+	}
+	return p.Backoff(attempt)
+}
+
+type PoolOption func(*IWorkerPool)
+
+// WithLogger sets the logger the pool names after itself; the default is the application logger.
+func WithLogger(log *zap.Logger) PoolOption {
+	return func(wp *IWorkerPool) {
+		if log != nil {
+			wp.log = log
+		}
+	}
+}
+
+// WithLogSampling logs the Debug lines of one task in every; warnings and errors
+// are always logged.
+func WithLogSampling(every int) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.size.logEvery = every
+	}
+}
+
+// debugTask reports whether the Debug lines of the task of id are logged, so that
+// their fields are only built when they are.
+func (wp *IWorkerPool) debugTask(id uint64) bool {
+	return wp.log.Core().Enabled(zap.DebugLevel) && id%wp.logEvery == 0
+}
+
+// WithTaskTimeout bounds each execution of a task; a task past it fails with
+// ErrTaskTimeout and is left behind.
+func WithTaskTimeout(timeout time.Duration) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.taskTimeout = timeout
+	}
+}
+
+// WithRetry retries failed tasks by policy; by default a task is executed once.
+func WithRetry(policy RetryPolicy) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.retry = policy
+	}
+}
+
+// WithOnError calls onError with every task error, from the worker that ran the task.
+func WithOnError(onError func(error)) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.onError = onError
+	}
+}
+
+// PanicHandler is given the panics the pool recovers, with a nil task for those
+// escaping the worker loop.
+type PanicHandler func(task Task, recovered any, stack []byte)
+
+// WithPanicHandler passes recovered panics to handler instead of logging them.
+func WithPanicHandler(handler PanicHandler) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.onPanic = handler
+	}
+}
+
+// Names of the goroutines a pool runs in its task group, see WithTaskGroup.
+const (
+	TaskGoroutine     = "worker.task"
+	DrainGoroutine    = "worker.drain"
+	ShutdownGoroutine = "worker.shutdown"
+)
+
+// WithTaskGroup runs in tasks the goroutines Drain, Shutdown and task timeouts leave behind.
+func WithTaskGroup(tasks *taskgroup.Group) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.tasks = tasks
+	}
+}
+
+// WithClock sets the clock used to time tasks; the default is the real clock.
+func WithClock(c clock.Clock) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.clock = clock.OrReal(c)
+	}
 }
 
 type IWorker struct {
 	id            int
 	metricsWorker metricsIncrement
-	shutdown      context.CancelFunc
 	pool          *IWorkerPool
+	quit          chan struct{}
+	picks         int
+	// home is the index of the shard the worker takes from first.
+	home int
 }
 
 type BasicMetrics struct {
 	started   atomic.Int64
-	completed atomic.Int64
+	succeeded atomic.Int64
 	failed    atomic.Int64
+	retried   atomic.Int64
+	restarts  atomic.Int64
+	duration  atomic.Int64
+	longest   atomic.Int64
+	buckets   [len(durationBounds) + 1]atomic.Int64
 }
 
 func (m *BasicMetrics) TasksStarted() int {
 	return int(m.started.Load())
 }
 
+func (m *BasicMetrics) TasksSucceeded() int {
+	return int(m.succeeded.Load())
+}
+
 func (m *BasicMetrics) TasksCompleted() int {
-	return int(m.completed.Load())
+	return m.TasksSucceeded() + m.TasksFailed()
 }
 
 func (m *BasicMetrics) TasksFailed() int {
 	return int(m.failed.Load())
 }
 
+func (m *BasicMetrics) TasksRetried() int {
+	return int(m.retried.Load())
+}
+
+func (m *BasicMetrics) WorkerRestarts() int {
+	return int(m.restarts.Load())
+}
+
+func (m *BasicMetrics) TotalDuration() time.Duration {
+	return time.Duration(m.duration.Load())
+}
+
+func (m *BasicMetrics) MaxDuration() time.Duration {
+	return time.Duration(m.longest.Load())
+}
+
+func (m *BasicMetrics) DurationBuckets() DurationBuckets {
+	return DurationBuckets{
+		Under10ms:  int(m.buckets[0].Load()),
+		Under100ms: int(m.buckets[1].Load()),
+		Under1s:    int(m.buckets[2].Load()),
+		Over1s:     int(m.buckets[3].Load()),
+	}
+}
+
+func (m *BasicMetrics) observeDuration(d time.Duration) {
+	m.duration.Add(int64(d))
+	for longest := m.longest.Load(); int64(d) > longest; longest = m.longest.Load() {
+		if m.longest.CompareAndSwap(longest, int64(d)) {
+			break
+		}
+	}
+	bucket := len(durationBounds)
+	for i, bound := range durationBounds {
+		if d < bound {
+			bucket = i
+			break
+		}
+	}
+	m.buckets[bucket].Add(1)
+}
+
 func (m *BasicMetrics) incrementStarted() {
 	m.started.Add(1)
 }
 
-func (m *BasicMetrics) incrementCompleted() {
-	m.completed.Add(1)
+func (m *BasicMetrics) incrementSucceeded() {
+	m.succeeded.Add(1)
 }
 
 func (m *BasicMetrics) incrementFailed() {
 	m.failed.Add(1)
 }
 
+func (m *BasicMetrics) incrementRetried() {
+	m.retried.Add(1)
+}
+
+func (m *BasicMetrics) incrementRestarts() {
+	m.restarts.Add(1)
+}
+
+func (m *BasicMetrics) reset() Metrics {
+	old := &BasicMetrics{}
+	old.started.Store(m.started.Swap(0))
+	old.succeeded.Store(m.succeeded.Swap(0))
+	old.failed.Store(m.failed.Swap(0))
+	old.retried.Store(m.retried.Swap(0))
+	old.restarts.Store(m.restarts.Swap(0))
+	old.duration.Store(m.duration.Swap(0))
+	old.longest.Store(m.longest.Swap(0))
+	for i := range m.buckets {
+		old.buckets[i].Store(m.buckets[i].Swap(0))
+	}
+	return old
+}
+
+func (m *BasicMetrics) seed(s WorkerSnapshot) {
+	m.started.Add(int64(s.TasksStarted))
+	m.succeeded.Add(int64(s.TasksSucceeded))
+	m.failed.Add(int64(s.TasksFailed))
+	m.retried.Add(int64(s.TasksRetried))
+}
+
 func (m *BasicMetrics) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
 		TasksStarted   int `json:"tasks_started"`
-		TasksCompleted int `json:"tasks_completed"`
+		TasksSucceeded int `json:"tasks_succeeded"`
 		TasksFailed    int `json:"tasks_failed"`
+		TasksCompleted int `json:"tasks_completed"`
+		TasksRetried   int `json:"tasks_retried"`
+		WorkerRestarts int `json:"worker_restarts"`
+
+		TotalDuration   time.Duration   `json:"total_duration"`
+		MaxDuration     time.Duration   `json:"max_duration"`
+		DurationBuckets DurationBuckets `json:"duration_buckets"`
 	}{
 		TasksStarted:   m.TasksStarted(),
-		TasksCompleted: m.TasksCompleted(),
+		TasksSucceeded: m.TasksSucceeded(),
 		TasksFailed:    m.TasksFailed(),
+		TasksCompleted: m.TasksCompleted(),
+		TasksRetried:   m.TasksRetried(),
+		WorkerRestarts: m.WorkerRestarts(),
+
+		TotalDuration:   m.TotalDuration(),
+		MaxDuration:     m.MaxDuration(),
+		DurationBuckets: m.DurationBuckets(),
 	})
 }
 
 type BasicPoolMetrics struct {
-	enqueued atomic.Int64
+	enqueued   atomic.Int64
+	byPriority [len(priorities)]atomic.Int64
+	scheduled  atomic.Int64
+	dropped    atomic.Int64
+	skipped    atomic.Int64
+	depth      func(p Priority) int
+	capacity   int
+	inFlight   func() int
+	active     func() int
+	wait       WaitStats
+	waitTotal  time.Duration
+	waitMu     sync.Mutex
+	throttled  atomic.Int64
+	throttle   atomic.Int64
+	duplicates atomic.Int64
+	abandoned  atomic.Int64
+	kinds      kindCounters
 }
 
 func (m *BasicPoolMetrics) TasksEnqueued() int { return int(m.enqueued.Load()) }
 
-func (m *BasicPoolMetrics) incrementEnqueued() { m.enqueued.Add(1) }
+func (m *BasicPoolMetrics) TasksEnqueuedWithPriority(p Priority) int {
+	queue, ok := p.queue()
+	if !ok {
+		return 0
+	}
+	return int(m.byPriority[queue].Load())
+}
+
+func (m *BasicPoolMetrics) TasksByKind() map[string]KindCounts { return m.kinds.counts() }
+
+func (m *BasicPoolMetrics) countKind(kind string, event kindEvent) string {
+	return m.kinds.count(kind, event)
+}
+
+func (m *BasicPoolMetrics) TasksScheduled() int { return int(m.scheduled.Load()) }
+
+func (m *BasicPoolMetrics) ScheduledDropped() int { return int(m.dropped.Load()) }
+
+func (m *BasicPoolMetrics) RecurringSkipped() int { return int(m.skipped.Load()) }
+
+func (m *BasicPoolMetrics) QueueDepth() int {
+	n := 0
+	for _, p := range priorities {
+		n += m.QueueDepthWithPriority(p)
+	}
+	return n
+}
+
+func (m *BasicPoolMetrics) QueueDepthWithPriority(p Priority) int {
+	if m.depth == nil {
+		return 0
+	}
+	return m.depth(p)
+}
+
+func (m *BasicPoolMetrics) QueueCapacity() int { return m.capacity }
+
+func (m *BasicPoolMetrics) InFlight() int {
+	if m.inFlight == nil {
+		return 0
+	}
+	return m.inFlight()
+}
+
+func (m *BasicPoolMetrics) ActiveWorkers() int {
+	if m.active == nil {
+		return 0
+	}
+	return m.active()
+}
+
+func (m *BasicPoolMetrics) TaskWait() WaitStats {
+	m.waitMu.Lock()
+	defer m.waitMu.Unlock()
+	stats := m.wait
+	if stats.Count > 0 {
+		stats.Avg = m.waitTotal / time.Duration(stats.Count)
+	}
+	return stats
+}
+
+func (m *BasicPoolMetrics) TasksThrottled() int { return int(m.throttled.Load()) }
+
+func (m *BasicPoolMetrics) ThrottleWait() time.Duration { return time.Duration(m.throttle.Load()) }
+
+func (m *BasicPoolMetrics) observeThrottle(d time.Duration) {
+	m.throttled.Add(1)
+	m.throttle.Add(int64(d))
+}
+
+func (m *BasicPoolMetrics) TasksDeduplicated() int { return int(m.duplicates.Load()) }
+
+func (m *BasicPoolMetrics) incrementDeduplicated() { m.duplicates.Add(1) }
+
+func (m *BasicPoolMetrics) TasksAbandoned() int { return int(m.abandoned.Load()) }
+
+func (m *BasicPoolMetrics) addAbandoned(n int) { m.abandoned.Add(int64(n)) }
+
+func (m *BasicPoolMetrics) incrementRecurringSkipped() { m.skipped.Add(1) }
+
+func (m *BasicPoolMetrics) observeQueue(depth func(p Priority) int, capacity int) {
+	m.depth = depth
+	m.capacity = capacity
+}
+
+func (m *BasicPoolMetrics) observeWorkers(inFlight, active func() int) {
+	m.inFlight = inFlight
+	m.active = active
+}
+
+func (m *BasicPoolMetrics) observeWait(d time.Duration) {
+	m.waitMu.Lock()
+	defer m.waitMu.Unlock()
+	if m.wait.Count == 0 || d < m.wait.Min {
+		m.wait.Min = d
+	}
+	m.wait.Max = max(m.wait.Max, d)
+	m.wait.Count++
+	m.waitTotal += d
+}
+
+func (m *BasicPoolMetrics) addScheduled(delta int) { m.scheduled.Add(int64(delta)) }
+
+func (m *BasicPoolMetrics) incrementScheduledDropped() { m.dropped.Add(1) }
+
+func (m *BasicPoolMetrics) incrementEnqueued(p Priority) {
+	m.enqueued.Add(1)
+	if queue, ok := p.queue(); ok {
+		m.byPriority[queue].Add(1)
+	}
+}
+
+func (m *BasicPoolMetrics) seedEnqueued(n int) { m.enqueued.Add(int64(n)) }
+
+// reset zeroes the counters and returns metrics holding their values before, with
+// the gauges as they are now.
+func (m *BasicPoolMetrics) reset() PoolMetrics {
+	old := &BasicPoolMetrics{capacity: m.capacity}
+	old.enqueued.Store(m.enqueued.Swap(0))
+	for i := range m.byPriority {
+		old.byPriority[i].Store(m.byPriority[i].Swap(0))
+	}
+	old.scheduled.Store(m.scheduled.Load())
+	old.dropped.Store(m.dropped.Swap(0))
+	old.skipped.Store(m.skipped.Swap(0))
+	old.throttled.Store(m.throttled.Swap(0))
+	old.throttle.Store(m.throttle.Swap(0))
+	old.duplicates.Store(m.duplicates.Swap(0))
+	old.abandoned.Store(m.abandoned.Swap(0))
+	old.kinds.kinds = m.kinds.reset()
+	m.waitMu.Lock()
+	old.wait, old.waitTotal = m.wait, m.waitTotal
+	m.wait, m.waitTotal = WaitStats{}, 0
+	m.waitMu.Unlock()
+
+	depth := make(map[Priority]int, len(priorities))
+	for _, p := range priorities {
+		depth[p] = m.QueueDepthWithPriority(p)
+	}
+	inFlight, active := m.InFlight(), m.ActiveWorkers()
+	old.observeQueue(func(p Priority) int { return depth[p] }, m.capacity)
+	old.observeWorkers(func() int { return inFlight }, func() int { return active })
+	return old
+}
 
 func (m *BasicPoolMetrics) MarshalJSON() ([]byte, error) {
+	byPriority := make(map[string]int, len(priorities))
+	depthByPriority := make(map[string]int, len(priorities))
+	for _, p := range priorities {
+		byPriority[p.String()] = m.TasksEnqueuedWithPriority(p)
+		depthByPriority[p.String()] = m.QueueDepthWithPriority(p)
+	}
 	return json.Marshal(struct {
-		TasksEnqueued int `json:"tasks_enqueued"`
+		TasksEnqueued           int                   `json:"tasks_enqueued"`
+		TasksEnqueuedByPriority map[string]int        `json:"tasks_enqueued_by_priority"`
+		TasksByKind             map[string]KindCounts `json:"tasks_by_kind"`
+		TasksScheduled          int                   `json:"tasks_scheduled"`
+		ScheduledDropped        int                   `json:"scheduled_dropped"`
+		RecurringSkipped        int                   `json:"recurring_skipped"`
+		QueueDepth              int                   `json:"queue_depth"`
+		QueueDepthByPriority    map[string]int        `json:"queue_depth_by_priority"`
+		QueueCapacity           int                   `json:"queue_capacity"`
+		TaskWait                WaitStats             `json:"task_wait"`
+		TasksDeduplicated       int                   `json:"tasks_deduplicated"`
+		TasksThrottled          int                   `json:"tasks_throttled"`
+		ThrottleWait            time.Duration         `json:"throttle_wait"`
+		TasksAbandoned          int                   `json:"tasks_abandoned"`
+		InFlight                int                   `json:"in_flight"`
+		ActiveWorkers           int                   `json:"active_workers"`
 	}{
-		TasksEnqueued: m.TasksEnqueued(),
+		TasksEnqueued:           m.TasksEnqueued(),
+		TasksEnqueuedByPriority: byPriority,
+		TasksByKind:             m.TasksByKind(),
+		TasksScheduled:          m.TasksScheduled(),
+		ScheduledDropped:        m.ScheduledDropped(),
+		RecurringSkipped:        m.RecurringSkipped(),
+		QueueDepth:              m.QueueDepth(),
+		QueueDepthByPriority:    depthByPriority,
+		QueueCapacity:           m.QueueCapacity(),
+		TaskWait:                m.TaskWait(),
+		TasksDeduplicated:       m.TasksDeduplicated(),
+		TasksThrottled:          m.TasksThrottled(),
+		ThrottleWait:            m.ThrottleWait(),
+		TasksAbandoned:          m.TasksAbandoned(),
+		InFlight:                m.InFlight(),
+		ActiveWorkers:           m.ActiveWorkers(),
 	})
 }
 
+// Restarts of a worker loop after a panic wait workerRestartBackoff, doubled after
+// every restart up to maxWorkerRestartBackoff; after maxWorkerRestarts the worker exits.
+const (
+	maxWorkerRestarts       = 10
+	workerRestartBackoff    = 10 * time.Millisecond
+	maxWorkerRestartBackoff = time.Second
+)
+
+var restartBackoff = ExponentialBackoff(workerRestartBackoff, maxWorkerRestartBackoff)
+
+// start runs the worker loop, restarting it when a panic escapes a task, say from
+// logging or metrics, so the pool keeps its capacity.
 func (w *IWorker) start(ctx context.Context) {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	w.shutdown = cancel
+	for restarts := 0; w.loop(ctx); restarts++ {
+		if restarts == maxWorkerRestarts {
+			w.pool.log.Error("worker gave up after repeated panics",
+				zap.Int("worker_id", w.id),
+				zap.Int("restarts", restarts),
+			)
+			return
+		}
+		w.metricsWorker.incrementRestarts()
+		if !w.wait(ctx, restartBackoff(restarts+1)) {
+			return
+		}
+	}
+}
 
+// loop takes tasks until the pool, ctx or retire tells it to stop. It reports
+// whether it stopped on a panic instead.
+func (w *IWorker) loop(ctx context.Context) (panicked bool) {
 	defer func() {
 		if r := recover(); r != nil {
-			w.pool.log.Error("worker recovered from panic",
-				zap.Any("recovered", r),
-				zap.Stack("stack"),
-				zap.Int("worker_id", w.id),
-			)
+			w.pool.recovered("worker recovered from panic, restarting", nil, r, zap.Int("worker_id", w.id))
+			panicked = true
 		}
 	}()
 
+	queues := w.pool.shards[w.home]
 	for {
 		select {
-		case task, ok := <-w.pool.tasks:
-			if !ok {
-				return
-			}
-			w.metricsWorker.incrementStarted()
-			w.pool.log.Debug("task started",
-				zap.Int("worker_id", w.id),
-				zap.Any("task", task),
-			)
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						w.metricsWorker.incrementFailed()
-						w.pool.log.Error("task panic occurred",
-							zap.Int("worker_id", w.id),
-							zap.Any("task", task),
-							zap.Any("recovered", r),
-							zap.Stack("stack"),
-						)
-					}
-				}()
-
-				start := time.Now()
-
-				if err := task.Execute(ctx); err != nil {
-					w.metricsWorker.incrementFailed()
-					w.pool.log.Error("task failed",
-						zap.Int("worker_id", w.id),
-						zap.Any("task", task),
-						zap.Error(err),
-					)
-					w.pool.reportError(err)
+		case <-w.quit:
+			return
+		case <-w.pool.stop:
+			return
+		case <-ctx.Done():
+			return
+		default:
+		}
+		if !w.awaitResume(ctx) {
+			return
+		}
+		if env, ok := w.next(); ok {
+			w.executeResumed(ctx, env)
+			continue
+		}
+		// Every queue is empty: wait for the first task of any priority, or for a pause.
+		paused, _ := w.pool.pauseState()
+		select {
+		case env := <-queues[0]:
+			w.executeResumed(ctx, env)
+		case env := <-queues[1]:
+			w.executeResumed(ctx, env)
+		case env := <-queues[2]:
+			w.executeResumed(ctx, env)
+		case <-w.pool.wake:
+			// A task was queued in another shard: steal it on the next turn.
+		case <-paused:
+		case <-w.pool.drain:
+			// No producer is left: finish what is queued, then exit.
+			for {
+				select {
+				case <-w.pool.stop:
+					return
+				default:
+				}
+				env, ok := w.next()
+				if !ok {
+					return
 				}
+				w.execute(ctx, env)
+			}
+		case <-w.quit:
+			return
+		case <-w.pool.stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// panicError is the failure of a task that panicked.
+type panicError struct {
+	recovered any
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.recovered)
+}
+
+func (e *panicError) Is(target error) bool {
+	return target == ErrTaskPanicked
+}
+
+// execute runs the interceptors of the pool around the attempts of the task and
+// records its failure, if any.
+func (w *IWorker) execute(ctx context.Context, env envelope) {
+	w.pool.release(env)
+	w.pool.running.Add(1)
+	defer w.pool.running.Add(-1)
+	start := w.pool.clock.Now()
+	w.pool.metrics.observeWait(start.Sub(env.queuedAt))
+	w.pool.metrics.countKind(env.kind, kindStarted)
+	// err stays ErrTaskAborted if a panic outside the task ends execute early.
+	err := ErrTaskAborted
+	defer func() { env.handle.finish(err, w.pool.clock.Now().Sub(start)) }()
+	ctx, done := w.pool.track(ctx, w, env)
+	defer done()
+	ctx = context.WithValue(ctx, executionKey{}, execution{worker: w, env: env})
+
+	w.observe(env, func(o TaskObserver) { o.TaskStarted(ctx, env.task) })
+	w.pool.audit(env, AuditStarted, nil)
+	begin := w.pool.clock.Now()
+	err = w.intercept(ctx, env, 0)
+	took := w.pool.clock.Now().Sub(begin)
+	w.pool.auditEnded(env, err, took)
+	if err == nil {
+		w.observe(env, func(o TaskObserver) { o.TaskCompleted(ctx, env.task, took) })
+		return
+	}
+	w.observe(env, func(o TaskObserver) { o.TaskFailed(ctx, env.task, err, took) })
+	w.pool.recordFailure(env, err)
+	w.pool.metrics.countKind(env.kind, kindFailed)
+	var panicked *panicError
+	if !errors.As(err, &panicked) {
+		w.pool.reportError(fmt.Errorf("task %d (%s): %w", env.id, env.task.Stringer(), err))
+	}
+}
 
-				w.metricsWorker.incrementCompleted()
+// recovered passes a recovered panic to the WithPanicHandler handler, or logs it
+// as msg with fields and its stack when there is none.
+func (wp *IWorkerPool) recovered(msg string, task Task, r any, fields ...zap.Field) {
+	if wp.onPanic != nil {
+		wp.onPanic(task, r, debug.Stack())
+		return
+	}
+	wp.log.Error(msg, append(fields, zap.Any("recovered", r), zap.Stack("stack"))...)
+}
 
-				w.pool.log.Debug("task completed",
-					zap.Duration("duration", time.Since(start)),
-				)
+// reportError passes err to the WithOnError callback, if any, then keeps it in Errors.
+func (wp *IWorkerPool) reportError(err error) {
+	if wp.onError != nil {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					wp.log.Error("error callback panic occurred", zap.Any("recovered", r), zap.Error(err))
+				}
 			}()
+			wp.onError(err)
+		}()
+	}
+	wp.errors.Add(err)
+}
 
-		case <-ctx.Done():
-			return
+// attempts executes the task, again after a failure while the retry policy allows.
+func (w *IWorker) attempts(ctx context.Context, env envelope) error {
+	if !w.throttle(ctx, env) {
+		return ErrTaskAborted
+	}
+	err := w.runWithTimeout(ctx, env)
+	for attempt := 1; err != nil && w.pool.retry.retries(err, attempt); attempt++ {
+		backoff := w.pool.retry.backoff(attempt)
+		w.pool.log.Warn("task will be retried", append(env.fields(),
+			zap.Int("worker_id", w.id),
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)...)
+		if !w.wait(ctx, backoff) || !w.throttle(ctx, env) {
+			break
 		}
+		w.metricsWorker.incrementRetried()
+		err = w.runWithTimeout(ctx, env)
 	}
+	return err
 }
 
-func (w *IWorker) stop() {
-	w.shutdown()
+// wait sleeps d on the pool clock and reports false if the pool is shut down meanwhile.
+func (w *IWorker) wait(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-w.pool.clock.After(d):
+		return true
+	case <-w.pool.stop:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// runWithTimeout runs the task under the pool's task timeout, if any.
+func (w *IWorker) runWithTimeout(ctx context.Context, env envelope) error {
+	timeout := w.pool.taskTimeout
+	if timeout <= 0 {
+		return w.run(ctx, env)
+	}
+	taskCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result := make(chan error, 1)
+	if err := w.pool.tasks.Go(ctx, TaskGoroutine, func() { result <- w.run(taskCtx, env) }); err != nil {
+		return err
+	}
+	var err error
+	select {
+	case err = <-result:
+	case <-taskCtx.Done():
+		err = taskCtx.Err()
+	}
+	if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w after %s", ErrTaskTimeout, timeout)
+	}
+	return err
+}
+
+// run executes the task and turns a panic into a panicError, logged with its stack.
+func (w *IWorker) run(ctx context.Context, env envelope) (err error) {
+	w.pool.active.Add(1)
+	defer w.pool.active.Add(-1)
+	defer func() {
+		if r := recover(); r != nil {
+			w.pool.recovered("task panic occurred", env.task, r, append(env.fields(), zap.Int("worker_id", w.id))...)
+			err = &panicError{recovered: r}
+		}
+	}()
+	return env.task.Execute(ctx)
 }
 
 func (w *IWorker) getID() int {
@@ -225,29 +1103,124 @@ func (w *IWorker) metrics() Metrics {
 	return w.metricsWorker
 }
 
-func (wp *IWorkerPool) Start(ctx context.Context) {
-	wp.wg.Add(len(wp.workers))
-	for _, workerFromPool := range wp.workers {
-		go func(w worker) {
-			defer wp.wg.Done()
-			w.start(ctx)
-		}(workerFromPool)
-	}
+func (w *IWorker) resetMetrics() Metrics {
+	return w.metricsWorker.reset()
 }
 
-// Drain waits for all tasks to be processed.
-func (wp *IWorkerPool) Drain(ctx context.Context) error {
+// retire makes the worker exit once it is done with its current task.
+func (w *IWorker) retire() {
+	close(w.quit)
+}
+
+// Start runs the workers until ctx ends, Drain or Shutdown.
+func (wp *IWorkerPool) Start(ctx context.Context) error {
 	wp.closedMu.Lock()
 	defer wp.closedMu.Unlock()
-	wp.once.Do(func() {
-		close(wp.tasks)
-		wp.isClosed = true
-	})
-	done := make(chan struct{})
+	if err := wp.startable(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	wp.cancels = append(wp.cancels, cancel)
+	wp.runCtx = ctx
+	wp.workersMu.RLock()
+	defer wp.workersMu.RUnlock()
+	for _, w := range wp.workers {
+		wp.spawn(ctx, w)
+	}
+	if n := wp.preStart.Load(); n > 0 {
+		wp.log.Info("worker pool started with tasks queued before Start", zap.Int64("queued_before_start", n))
+	}
+	return nil
+}
+
+func (wp *IWorkerPool) spawn(ctx context.Context, w worker) {
+	wp.wg.Add(1)
 	go func() {
-		wp.wg.Wait()
-		close(done)
+		defer wp.wg.Done()
+		w.start(ctx)
 	}()
+}
+
+func (wp *IWorkerPool) newWorker() *IWorker {
+	wp.lastID++
+	return &IWorker{
+		id:            wp.lastID,
+		home:          (wp.lastID - 1) % len(wp.shards),
+		pool:          wp,
+		metricsWorker: wp.newMetrics(),
+		quit:          make(chan struct{}),
+	}
+}
+
+// Resize changes the number of workers to n; workers beyond n retire after their task.
+func (wp *IWorkerPool) Resize(ctx context.Context, n int) error {
+	if n <= 0 {
+		return ErrInvalidWorkerCount
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	wp.closedMu.Lock()
+	defer wp.closedMu.Unlock()
+	select {
+	case <-wp.done:
+		return ErrWorkerPoolClosed
+	default:
+	}
+	wp.workersMu.Lock()
+	defer wp.workersMu.Unlock()
+	for len(wp.workers) < n {
+		w := wp.newWorker()
+		wp.workers = append(wp.workers, w)
+		if wp.runCtx != nil {
+			wp.spawn(wp.runCtx, w)
+		}
+	}
+	for len(wp.workers) > n {
+		last := len(wp.workers) - 1
+		w := wp.workers[last]
+		wp.workers = wp.workers[:last]
+		w.retire()
+		wp.retired = append(wp.retired, w)
+	}
+	wp.log.Info("worker pool resized", zap.Int("workers", n))
+	return nil
+}
+
+// closeIntake closes done. Taking the write lock waits out every Submit
+// between its closed check and producers.Add, so none can start after.
+func (wp *IWorkerPool) closeIntake() {
+	wp.closedMu.Lock()
+	defer wp.closedMu.Unlock()
+	wp.doneOnce.Do(func() {
+		close(wp.done)
+		wp.state.Store(int32(StateDraining))
+	})
+}
+
+// enter registers a producer. Return ErrWorkerPoolClosed once the pool is closed,
+// and ErrPoolNotStarted before Start if the pool was built WithRequireStart.
+func (wp *IWorkerPool) enter() error {
+	wp.closedMu.RLock()
+	defer wp.closedMu.RUnlock()
+	select {
+	case <-wp.done:
+		return ErrWorkerPoolClosed
+	default:
+	}
+	if wp.requireStart && wp.State() == StateCreated {
+		return ErrPoolNotStarted
+	}
+	wp.producers.Add(1)
+	return nil
+}
+
+// Drain waits for all tasks to be processed, resuming the pool if it is paused.
+func (wp *IWorkerPool) Drain(ctx context.Context) error {
+	done, err := wp.startDrain(ctx)
+	if err != nil {
+		return err
+	}
 
 	select {
 	case <-done:
@@ -257,80 +1230,242 @@ func (wp *IWorkerPool) Drain(ctx context.Context) error {
 	}
 }
 
-// Shutdown does not wait for tasks to finish, just aborts them.
+// Shutdown does not wait for tasks to finish, just aborts them, then waits for them
+// to return until ctx ends or the shutdown timeout.
 func (wp *IWorkerPool) Shutdown(ctx context.Context) error {
-	wp.closedMu.Lock()
-	defer wp.closedMu.Unlock()
-	wp.once.Do(func() {
-		close(wp.tasks)
-		wp.isClosed = true
-	})
-	for _, workerFromPool := range wp.workers {
-		workerFromPool.stop()
-	}
+	halted := make(chan struct{})
 	done := make(chan struct{})
-	go func() {
+	err := wp.tasks.Go(ctx, ShutdownGoroutine, func() {
+		wp.halt()
+		close(halted)
 		wp.wg.Wait()
+		wp.producers.Wait()
+		wp.abandonQueued()
+		wp.stopped()
 		close(done)
-	}()
+	})
+	if err != nil {
+		return err
+	}
+	<-halted
 
+	var timeout <-chan time.Time
+	if wp.shutdownTimeout > 0 {
+		timeout = wp.clock.After(wp.shutdownTimeout)
+	}
 	select {
 	case <-done:
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
+	case <-timeout:
+		stuck := wp.logStuck()
+		return fmt.Errorf("%w after %s: %d tasks still running", ErrShutdownTimeout, wp.shutdownTimeout, stuck)
 	}
 }
 
 // Return ErrWorkerPoolClosed after Shutdown or Drain.
+// Return ErrPoolNotStarted before Start if the pool was built WithRequireStart.
 // Return ErrWorkerPoolFull if the task queue is full.
+// Return ErrDuplicateTask if a task of the same Deduplicated key is queued.
 func (wp *IWorkerPool) Submit(ctx context.Context, task Task) error {
-	wp.closedMu.RLock()
-	defer wp.closedMu.RUnlock()
-	if wp.isClosed {
-		return ErrWorkerPoolClosed
+	return wp.submit(ctx, task, nil, PriorityNormal, nil)
+}
+
+func (wp *IWorkerPool) submit(ctx context.Context, task Task, handle *TaskHandle, priority Priority, values map[string]string) error {
+	queue, ok := priority.queue()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrInvalidPriority, priority)
+	}
+	if err := wp.enter(); err != nil {
+		return err
+	}
+	defer wp.producers.Done()
+	env := wp.envelope(task)
+	env.handle = handle
+	env.priority = priority
+	env.values = values
+	env.dedupKey = dedupKey(task)
+	if !wp.claim(env) {
+		return ErrDuplicateTask
+	}
+	if wp.offer(env, queue) {
+		wp.submitted(env)
+		return nil
+	}
+	wp.release(env)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	wp.warnFull(env)
+	wp.auditDropped(env, "task queue is full")
+	return ErrWorkerPoolFull
+}
+
+// fullLogInterval bounds how often a pool warns that it drops tasks: a full queue
+// drops every task submitted until it drains, which would flood the log.
+const fullLogInterval = 10 * time.Second
+
+// warnFull warns that the task of env was dropped, at most once per fullLogInterval,
+// counting the tasks dropped since the previous warning.
+func (wp *IWorkerPool) warnFull(env envelope) {
+	wp.fullDropped.Add(1)
+	if !wp.fullLog.Allow("") {
+		return
+	}
+	wp.log.Warn("task queue is full, dropping tasks", append(env.fields(),
+		zap.Int64("dropped", wp.fullDropped.Swap(0)),
+		zap.Duration("interval", fullLogInterval),
+	)...)
+}
+
+// SubmitWait is Submit that waits for queue space instead of returning ErrWorkerPoolFull.
+func (wp *IWorkerPool) SubmitWait(ctx context.Context, task Task) error {
+	if err := wp.enter(); err != nil {
+		return err
+	}
+	defer wp.producers.Done()
+	env := wp.envelope(task)
+	env.dedupKey = dedupKey(task)
+	if !wp.claim(env) {
+		return ErrDuplicateTask
+	}
+	queue, _ := PriorityNormal.queue()
+	if wp.offer(env, queue) {
+		wp.submitted(env)
+		return nil
 	}
 	select {
-	case wp.tasks <- task:
-		wp.log.Debug("task submitted", zap.Any("task", task))
-		wp.metrics.incrementEnqueued()
+	case wp.shards[wp.nextShard()][queue] <- env:
+		wp.woken()
+		wp.submitted(env)
 		return nil
 	case <-ctx.Done():
+		wp.release(env)
 		return ctx.Err()
-	default:
-		wp.log.Warn("task queue is full, dropping task", zap.Any("task", task))
-		return ErrWorkerPoolFull
+	case <-wp.done:
+		wp.release(env)
+		return ErrWorkerPoolClosed
 	}
 }
 
+// SubmitBatch submits tasks in order while they fit and returns how many were queued.
+func (wp *IWorkerPool) SubmitBatch(ctx context.Context, tasks []Task) (accepted int, err error) {
+	if err := wp.enter(); err != nil {
+		return 0, err
+	}
+	defer wp.producers.Done()
+	queue, _ := PriorityNormal.queue()
+	for _, task := range tasks {
+		if err := ctx.Err(); err != nil {
+			return accepted, err
+		}
+		env := wp.envelope(task)
+		env.dedupKey = dedupKey(task)
+		if !wp.claim(env) {
+			return accepted, ErrDuplicateTask
+		}
+		if !wp.offer(env, queue) {
+			wp.release(env)
+			wp.log.Warn("task queue is full, dropping rest of batch", append(env.fields(),
+				zap.Int("accepted", accepted),
+				zap.Int("dropped", len(tasks)-accepted),
+			)...)
+			wp.auditDropped(env, "task queue is full")
+			return accepted, ErrWorkerPoolFull
+		}
+		wp.submitted(env)
+		accepted++
+	}
+	return accepted, nil
+}
+
+// envelope gives task the next ID of the pool, IDs starting at 1, and stamps it as queued now.
+func (wp *IWorkerPool) envelope(task Task) envelope {
+	return envelope{id: wp.nextID.Add(1), task: task, queuedAt: wp.clock.Now(), kind: kindOf(task)}
+}
+
+func (wp *IWorkerPool) submitted(env envelope) {
+	if wp.debugTask(env.id) {
+		wp.log.Debug("task submitted", append(env.fields(), zap.Stringer("priority", env.priority))...)
+	}
+	wp.metrics.incrementEnqueued(env.priority)
+	wp.metrics.countKind(env.kind, kindEnqueued)
+	wp.queuedBeforeStart(env)
+	wp.audit(env, AuditSubmitted, nil)
+}
+
 func (wp *IWorkerPool) Metrics() MetricsResult {
+	return wp.metricsResult(false)
+}
+
+func (wp *IWorkerPool) ResetMetrics() {
+	wp.metricsResult(true)
+}
+
+func (wp *IWorkerPool) SnapshotAndReset() MetricsResult {
+	return wp.metricsResult(true)
+}
+
+// metricsResult returns the metrics of the pool, resetting them first if reset is set.
+func (wp *IWorkerPool) metricsResult(reset bool) MetricsResult {
 	result := MetricsResult{
+		Name:           wp.name,
+		At:             wp.clock.Now(),
 		WorkersMetrics: make(map[int]Metrics),
 		PoolMetrics:    wp.metrics,
 	}
+	metricsOf := worker.metrics
+	if reset {
+		result.PoolMetrics = wp.metrics.reset()
+		metricsOf = worker.resetMetrics
+	}
+	wp.workersMu.RLock()
 	for _, worker := range wp.workers {
-		result.WorkersMetrics[worker.getID()] = worker.metrics()
+		result.WorkersMetrics[worker.getID()] = metricsOf(worker)
+	}
+	for _, worker := range wp.retired {
+		result.WorkersMetrics[worker.getID()] = metricsOf(worker)
+		result.RetiredWorkers = append(result.RetiredWorkers, worker.getID())
+	}
+	wp.workersMu.RUnlock()
+	wp.errMu.Lock()
+	result.RecentFailures = append([]FailedTask(nil), wp.failures...)
+	wp.errMu.Unlock()
+	result.Paused, result.PausedFor = wp.pausedFor()
+	result.QueuedKeys = wp.pendingKeys()
+	result.ShardDepths = wp.shardDepths()
+	result.QueuedBeforeStart = wp.preStart.Load()
+	result.AuditDropped = wp.auditDroppedCount()
+	result.InFlight = wp.metrics.InFlight()
+	result.ActiveWorkers = wp.metrics.ActiveWorkers()
+	result.ErrorsDropped = wp.errors.Dropped()
+	result.Config = wp.Config()
+	if wp.restored != nil && !wp.merge {
+		result.RestoredMetrics = wp.restored.restoredMetrics()
 	}
 	return result
 }
 
-func (wp *IWorkerPool) reportError(err error) {
+func (wp *IWorkerPool) recordFailure(env envelope, err error) {
+	failure := FailedTask{ID: env.id, Task: env.task.Stringer(), Error: err.Error(), At: wp.clock.Now()}
 	wp.errMu.Lock()
-	if len(wp.errSlice) >= wp.errMaximum {
-		wp.errMu.Unlock()
-		wp.log.Warn("error buffer full, dropping error", zap.Error(err))
-		return
+	defer wp.errMu.Unlock()
+	if len(wp.failures) >= maxRecentFailures {
+		wp.failures = append(wp.failures[:0], wp.failures[1:]...)
 	}
-	wp.errSlice = append(wp.errSlice, err)
-	wp.errMu.Unlock()
+	wp.failures = append(wp.failures, failure)
+}
+
+func (wp *IWorkerPool) Errors() *errstore.Store {
+	return wp.errors
 }
 
 func (wp *IWorkerPool) Error(ctx context.Context) error {
-	wp.errMu.Lock()
-	err := errors.Join(wp.errSlice...)
-	wp.errSlice = nil
-	wp.errMu.Unlock()
-	return err
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errstore.Join(wp.errors.Drain())
 }
 
 func NewPoolMetrics() poolMetricsIncrement {
@@ -341,40 +1476,132 @@ func NewWorkerMetrics() metricsIncrement {
 	return &BasicMetrics{}
 }
 
+// Defaults of a pool built with NewPool.
+const (
+	DefaultWorkers    = 1
+	DefaultBufferSize = 100
+	DefaultErrorCap   = 100
+)
+
+// ErrInvalidPool is returned by NewPool for options it cannot build a pool with.
+var ErrInvalidPool = errors.New("invalid worker pool")
+
+// poolSize is what NewPool builds the pool with, set by WithWorkers, WithBuffer,
+// WithErrorCap, WithLogSampling and WithSharding.
+type poolSize struct {
+	workers, buffer, errCap, logEvery int
+	sharded                           bool
+}
+
+// WithWorkers sets the count of workers the pool starts with; the default is DefaultWorkers.
+func WithWorkers(n int) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.size.workers = n
+	}
+}
+
+// WithBuffer sets the capacity of each priority queue; the default is DefaultBufferSize.
+func WithBuffer(n int) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.size.buffer = n
+	}
+}
+
+// WithErrorCap bounds the task errors kept in Errors: past it each new error replaces
+// the oldest one, counted in MetricsResult.ErrorsDropped. The default is DefaultErrorCap.
+func WithErrorCap(n int) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.size.errCap = n
+	}
+}
+
+// WithMetrics sets the metrics of the pool and of each worker, unique to them.
+func WithMetrics(poolMetrics poolMetricsIncrement, workersMetricsFabric func() metricsIncrement) PoolOption {
+	return func(wp *IWorkerPool) {
+		wp.metrics = poolMetrics
+		wp.newMetrics = workersMetricsFabric
+	}
+}
+
+// NewPool returns a pool named name built by opts. Return an error wrapping
+// ErrInvalidPool if a size is not positive or the metrics are nil.
+func NewPool(name string, opts ...PoolOption) (WorkerPool, error) {
+	pool := &IWorkerPool{
+		name:         name,
+		size:         poolSize{workers: DefaultWorkers, buffer: DefaultBufferSize, errCap: DefaultErrorCap, logEvery: 1},
+		newMetrics:   NewWorkerMetrics,
+		metrics:      NewPoolMetrics(),
+		log:          logger.GetLogger(),
+		done:         make(chan struct{}),
+		drain:        make(chan struct{}),
+		stop:         make(chan struct{}),
+		delayWake:    make(chan struct{}, 1),
+		gate:         newPauseGate(),
+		pending:      make(map[string]struct{}),
+		clock:        clock.Real{},
+		runningTasks: make(map[uint64]runningTask),
+	}
+	pool.interceptors = DefaultInterceptors()
+	for _, opt := range opts {
+		opt(pool)
+	}
+	switch {
+	case pool.size.workers <= 0:
+		return nil, fmt.Errorf("%w %q: workers must be greater than 0", ErrInvalidPool, name)
+	case pool.size.buffer <= 0:
+		return nil, fmt.Errorf("%w %q: buffer size must be greater than 0", ErrInvalidPool, name)
+	case pool.size.errCap <= 0:
+		return nil, fmt.Errorf("%w %q: error cap must be greater than 0", ErrInvalidPool, name)
+	case pool.size.logEvery <= 0:
+		return nil, fmt.Errorf("%w %q: log sampling must be greater than 0", ErrInvalidPool, name)
+	case pool.metrics == nil || pool.newMetrics == nil:
+		return nil, fmt.Errorf("%w %q: metrics must not be nil", ErrInvalidPool, name)
+	}
+	shards := 1
+	if pool.size.sharded {
+		shards = pool.size.workers
+	}
+	pool.makeShards(shards, pool.size.buffer)
+	pool.log = pool.log.Named(name)
+	if pool.auditLog != nil {
+		pool.auditLog.start(pool.log)
+	}
+	pool.logEvery = uint64(pool.size.logEvery)
+	pool.fullLog = logsample.New(1, fullLogInterval, pool.clock)
+	pool.errors = errstore.NewStore(pool.size.errCap, pool.clock)
+	pool.metrics.observeQueue(pool.queuedWithPriority, pool.capacity())
+	pool.metrics.observeWorkers(
+		func() int { return int(pool.running.Load()) },
+		func() int { return int(pool.active.Load()) },
+	)
+	pool.workers = make([]worker, pool.size.workers)
+	for i := range pool.workers {
+		pool.workers[i] = pool.newWorker()
+	}
+	if pool.restored != nil && pool.merge {
+		pool.seed(*pool.restored)
+	}
+	return pool, nil
+}
+
 // Returns new WorkerPool.
 // poolMetrics must be unique per pool.
 // workersMetricsFabric must return unique metrics per worker.
+// Panics where NewPool returns an error.
 func NewWorkerPool(workerPoolName string,
 	workerCount, bufferSize, errMaximumAmount int,
 	poolMetrics poolMetricsIncrement,
 	workersMetricsFabric func() metricsIncrement,
+	opts ...PoolOption,
 ) WorkerPool {
-	if workerCount <= 0 {
-		panic("workerCount must be greater than 0")
-	}
-	if bufferSize <= 0 {
-		panic("bufferSize must be greater than 0")
-	}
-	if errMaximumAmount <= 0 {
-		panic("errMaximumAmount must be greater than 0")
-	}
-	tasks := make(chan Task, bufferSize)
-	log := logger.GetLogger()
-	log = log.Named(workerPoolName)
-	workers := make([]worker, workerCount)
-	pool := &IWorkerPool{
-		workers:    workers,
-		metrics:    poolMetrics,
-		tasks:      tasks,
-		log:        log,
-		errMaximum: errMaximumAmount,
-	}
-	for i := 0; i < workerCount; i++ {
-		workers[i] = &IWorker{
-			id:            i + 1,
-			pool:          pool,
-			metricsWorker: workersMetricsFabric(),
-		}
+	pool, err := NewPool(workerPoolName, append([]PoolOption{
+		WithWorkers(workerCount),
+		WithBuffer(bufferSize),
+		WithErrorCap(errMaximumAmount),
+		WithMetrics(poolMetrics, workersMetricsFabric),
+	}, opts...)...)
+	if err != nil {
+		panic(err.Error())
 	}
 	return pool
 }
@@ -0,0 +1,90 @@
+// Package client holds what consumers of the service need on their side, starting
+// with the verification of the webhooks it sends.
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries the signature of a webhook: its timestamp, then one or
+// more signatures, as in "t=1700000000,v1=5257a869...". Each v1 is the hex
+// HMAC-SHA256, under the secret of the webhook, of the timestamp, a dot and the body.
+const SignatureHeader = "X-Shortlink-Signature"
+
+// DefaultTolerance is how far the timestamp of a webhook may be from the clock of
+// its receiver before VerifyWebhookSignature rejects it as a replay.
+const DefaultTolerance = 5 * time.Minute
+
+// MaxPayload is the largest webhook body sent, and accepted by VerifyWebhookSignature.
+const MaxPayload = 64 << 10
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+var ErrSignatureExpired = errors.New("webhook signature outside the tolerated window")
+var ErrPayloadTooLarge = errors.New("webhook payload too large")
+
+// SignWebhook returns the SignatureHeader value of body sent at timestamp.
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac(secret, t, body))
+}
+
+// VerifyWebhookSignature checks header, the SignatureHeader of a webhook received
+// now, against its body, allowing DefaultTolerance. Return ErrInvalidSignature for
+// a malformed header or a signature not matching, ErrSignatureExpired for a
+// timestamp too old or too far ahead, and ErrPayloadTooLarge past MaxPayload.
+func VerifyWebhookSignature(secret, header string, body []byte) error {
+	return VerifyWebhookSignatureAt(secret, header, body, time.Now(), DefaultTolerance)
+}
+
+// VerifyWebhookSignatureAt is VerifyWebhookSignature for a webhook received at now,
+// allowing tolerance.
+func VerifyWebhookSignatureAt(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	if len(body) > MaxPayload {
+		return ErrPayloadTooLarge
+	}
+	var t string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			// Several signatures are sent while a secret is rotated.
+			if signature, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	// The timestamp is checked once signed, so a replay cannot refresh it.
+	expected := mac(secret, t, body)
+	valid := false
+	for _, signature := range signatures {
+		valid = hmac.Equal(signature, expected) || valid
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrSignatureExpired
+	}
+	return nil
+}
+
+func mac(secret, timestamp string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
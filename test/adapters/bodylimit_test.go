@@ -0,0 +1,62 @@
+package adapters_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestBodyLimits(t *testing.T) {
+	cfg := getConfig(t)
+	cfg.Server.MaxBodyBytes = 64
+	cfg.Server.MaxBatchSize = 2
+	env := newReservationEnv(t, cfg, "alice")
+	// sized pads a shorten request of path with spaces to exactly n bytes.
+	sized := func(path string, n int) string {
+		body := fmt.Sprintf(`{"longURL":"https://example.com/%s"}`, path)
+		return body + strings.Repeat(" ", n-len(body))
+	}
+	chunked := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(body))
+		req.ContentLength = -1
+		req.AddCookie(&http.Cookie{Name: "auth", Value: env.tokens["alice"]})
+		env.router.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		body         string
+		expectedCode int
+		expectedBody string
+	}{
+		{"At the limit", "/api/shorten", sized("a", 64), http.StatusCreated, `"result"`},
+		{"Over the limit", "/api/shorten", sized("b", 65), http.StatusRequestEntityTooLarge, "larger than 64 bytes"},
+		{"Unknown field", "/api/shorten", `{"longUrl":"https://example.com/typo"}`, http.StatusBadRequest, `unknown field \"longUrl\"`},
+		{"Output field", "/api/shorten", `{"longURL":"https://example.com/o","archived":true}`, http.StatusBadRequest, `unknown field \"archived\"`},
+		{"Short URL field", "/api/shorten", `{"longURL":"https://example.com/s","shortURL":"mine"}`, http.StatusBadRequest, `unknown field \"shortURL\"`},
+		{"Batch at the cap", "/api/batch_shorten", `{"a":"https://a.example.com","b":"https://b.example.com"}`, http.StatusCreated, "a.example.com"},
+		{"Batch over the cap", "/api/batch_shorten", `{"a":"https://a.com","b":"https://b.com","c":"https://c.com"}`, http.StatusRequestEntityTooLarge, "at most 2 links"},
+		{"Batch over the limit", "/api/batch_shorten", fmt.Sprintf(`{"a":"https://example.com/%s"}`, strings.Repeat("a", 64)), http.StatusRequestEntityTooLarge, "larger than 64 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := env.do(http.MethodPost, tt.path, "alice", tt.body)
+			assert.Equal(t, tt.expectedCode, w.Code, w.Body.String())
+			assert.Contains(t, w.Body.String(), tt.expectedBody)
+		})
+	}
+
+	t.Run("Chunked body over the limit", func(t *testing.T) {
+		w := chunked(sized("c", 65))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+		assert.Equal(t, http.StatusCreated, chunked(sized("d", 64)).Code, "a body of unknown length within the limit")
+	})
+}
@@ -0,0 +1,162 @@
+package adapters_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/bundle"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/events"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+)
+
+type bundleEnv struct {
+	repo   *adapters.InMemoryURLRepository
+	api    *adapters.RestAPI
+	router *gin.Engine
+	token  string
+}
+
+// newBundleEnv returns an environment named name with a user to export from or import to.
+func newBundleEnv(t *testing.T, name, user string) *bundleEnv {
+	t.Helper()
+	repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+	require.NoError(t, err)
+	cfg := getConfig(t)
+	cfg.Server.Environment = name
+	router := setupRouter()
+	api := adapters.NewRestAPI(repo, router, cfg, adapters.WithExport(repo))
+	require.NoError(t, api.RegisterRoutes())
+	token := buildToken(t, cfg, user)
+	return &bundleEnv{repo: repo, api: api, router: router, token: token}
+}
+
+func (e *bundleEnv) do(t *testing.T, method, path string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "auth", Value: e.token})
+	e.router.ServeHTTP(w, req)
+	return w
+}
+
+type importResponse struct {
+	Counts  map[string]int `json:"counts"`
+	Results []struct {
+		RequestedShortURL string `json:"requested_short_url"`
+		ShortURL          string `json:"short_url"`
+		Status            string `json:"status"`
+	} `json:"results"`
+}
+
+func (e *bundleEnv) importBundle(t *testing.T, query string, body []byte) importResponse {
+	t.Helper()
+	w := e.do(t, http.MethodPost, "/api/user/urls/import_bundle"+query, body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp importResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+// exportBundle saves links for user on staging and returns their export.
+func exportBundle(t *testing.T, user string, originals ...string) (bundle.Bundle, []byte) {
+	t.Helper()
+	staging := newBundleEnv(t, "staging", user)
+	for _, original := range originals {
+		require.NoError(t, shortener.NewService(staging.repo).Save(context.TODO(), &domain.URL{OriginalURL: original, UUID: user}))
+	}
+	assert.Equal(t, http.StatusBadRequest, staging.do(t, http.MethodGet, "/api/user/urls/export?format=csv", nil).Code)
+	w := staging.do(t, http.MethodGet, "/api/user/urls/export?format=bundle", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var b bundle.Bundle
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &b))
+	require.Len(t, b.Links, len(originals))
+	assert.Equal(t, "staging", b.Environment)
+	return b, w.Body.Bytes()
+}
+
+func TestImportBundleReportsConflicts(t *testing.T) {
+	user := uuid.NewString()
+	b, body := exportBundle(t, user, "https://example.com/a", "https://example.com/b")
+	prod := newBundleEnv(t, "production", user)
+	taken := b.Links[0].ShortURL
+	require.NoError(t, shortener.NewService(prod.repo).Save(context.TODO(),
+		&domain.URL{ShortURL: taken, OriginalURL: "https://other.example.com", UUID: uuid.NewString()}))
+	var imported []events.Event
+	prod.api.Events().Subscribe(func(e events.Event) { imported = append(imported, e) })
+
+	resp := prod.importBundle(t, "", body)
+	assert.Equal(t, map[string]int{"created": 1, "renamed": 1}, resp.Counts)
+	for i, result := range resp.Results {
+		assert.Equal(t, b.Links[i].ShortURL, result.RequestedShortURL)
+		url, err := prod.repo.Find(context.TODO(), result.ShortURL)
+		require.NoError(t, err)
+		assert.Equal(t, b.Links[i].OriginalURL, url.OriginalURL)
+		assert.Equal(t, user, url.UUID)
+	}
+	assert.Equal(t, "renamed", resp.Results[0].Status)
+	assert.NotEqual(t, taken, resp.Results[0].ShortURL)
+	assert.Equal(t, "created", resp.Results[1].Status)
+	assert.Equal(t, b.Links[1].ShortURL, resp.Results[1].ShortURL, "a free code is kept")
+
+	require.Len(t, imported, 1)
+	assert.Equal(t, events.LinksImported, imported[0].Type)
+	assert.Equal(t, user, imported[0].UserID)
+	assert.Equal(t, "staging", imported[0].Attrs["environment"])
+	assert.Equal(t, "true", imported[0].Attrs["verified"])
+}
+
+func TestImportBundleIsIdempotent(t *testing.T) {
+	user := uuid.NewString()
+	b, body := exportBundle(t, user, "https://example.com/a", "https://example.com/b")
+	prod := newBundleEnv(t, "production", user)
+	require.NoError(t, shortener.NewService(prod.repo).Save(context.TODO(),
+		&domain.URL{ShortURL: b.Links[0].ShortURL, OriginalURL: "https://other.example.com", UUID: uuid.NewString()}))
+
+	first := prod.importBundle(t, "", body)
+	second := prod.importBundle(t, "", body)
+	assert.Equal(t, map[string]int{"unchanged": 1, "exists": 1}, second.Counts)
+	for i := range first.Results {
+		assert.Equal(t, first.Results[i].ShortURL, second.Results[i].ShortURL, "a re-run keeps the codes")
+	}
+	urls, err := prod.repo.ExportByUser(context.TODO(), user)
+	require.NoError(t, err)
+	assert.Len(t, urls, 2, "a re-run creates no links")
+}
+
+func TestImportBundleSignature(t *testing.T) {
+	user := uuid.NewString()
+	b, _ := exportBundle(t, user, "https://example.com/a")
+	b.Links[0].OriginalURL = "https://example.com/tampered"
+	tampered, err := json.Marshal(b)
+	require.NoError(t, err)
+	prod := newBundleEnv(t, "production", user)
+
+	w := prod.do(t, http.MethodPost, "/api/user/urls/import_bundle", tampered)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "signature")
+	urls, err := prod.repo.ExportByUser(context.TODO(), user)
+	require.NoError(t, err)
+	assert.Empty(t, urls)
+
+	resp := prod.importBundle(t, "?unsafe=true", tampered)
+	assert.Equal(t, map[string]int{"created": 1}, resp.Counts)
+
+	b.Version = bundle.Version + 1
+	unsupported, err := json.Marshal(b)
+	require.NoError(t, err)
+	w = prod.do(t, http.MethodPost, "/api/user/urls/import_bundle?unsafe=true", unsupported)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "unsafe does not skip the version check")
+}
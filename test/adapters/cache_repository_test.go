@@ -0,0 +1,182 @@
+package adapters_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+// deletingRepo soft-deletes links, which the in-memory repository does not.
+type deletingRepo struct {
+	*adapters.InMemoryURLRepository
+	mu      sync.Mutex
+	deleted map[string]bool
+}
+
+func (r *deletingRepo) BatchDelete(_ context.Context, ids map[string][]string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, shortURLs := range ids {
+		for _, short := range shortURLs {
+			r.deleted[short] = true
+		}
+	}
+	return len(ids), nil
+}
+
+func (r *deletingRepo) Find(ctx context.Context, shortURL string) (*domain.URL, error) {
+	url, err := r.InMemoryURLRepository.Find(ctx, shortURL)
+	if err == nil {
+		r.mu.Lock()
+		url.DeletedFlag = r.deleted[shortURL]
+		r.mu.Unlock()
+	}
+	return url, err
+}
+
+func (r *deletingRepo) FindMany(ctx context.Context, shortURLs []string) (map[string]domain.URL, error) {
+	found, err := r.InMemoryURLRepository.FindMany(ctx, shortURLs)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for short, url := range found {
+		url.DeletedFlag = r.deleted[short]
+		found[short] = url
+	}
+	return found, err
+}
+
+// staleCache returns a cache with a soft TTL of 10s and a TTL of 1m holding one link,
+// refreshed on a pool that is not started yet.
+func staleCache(t *testing.T) (*adapters.CachedRepository, *deletingRepo, worker.WorkerPool, *clock.Fake, *domain.URL) {
+	t.Helper()
+	inMemory, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "urls.json"))
+	require.NoError(t, err)
+	repo := &deletingRepo{InMemoryURLRepository: inMemory, deleted: make(map[string]bool)}
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	pool := worker.NewWorkerPool("cacheWorker", 1, 10, 10, worker.NewPoolMetrics(), worker.NewWorkerMetrics)
+	cache := adapters.NewCachedRepository(repo, time.Minute, 10,
+		adapters.WithCacheClock(fake), adapters.WithStaleWhileRevalidate(10*time.Second, pool))
+	url := domain.NewURL("https://example.com/swr")
+	url.UUID = "user-1"
+	require.NoError(t, shortener.NewService(repo).Save(context.Background(), url))
+	_, err = cache.Find(context.Background(), url.ShortURL)
+	require.NoError(t, err)
+	return cache, repo, pool, fake, url
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	cache, repo, pool, fake, url := staleCache(t)
+	_, err := repo.Archive(context.Background(), time.Now().Add(time.Hour), time.Now())
+	require.NoError(t, err)
+
+	fake.Advance(15 * time.Second)
+	for i := 0; i < 3; i++ {
+		stale, err := cache.Find(context.Background(), url.ShortURL)
+		require.NoError(t, err)
+		assert.False(t, stale.Archived, "a stale entry is served while it is refreshed")
+	}
+	assert.Equal(t, 1, pool.Metrics().PoolMetrics.TasksEnqueued(), "one refresh per link at a time")
+
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+	fresh, err := cache.Find(context.Background(), url.ShortURL)
+	require.NoError(t, err)
+	assert.True(t, fresh.Archived)
+	assert.Equal(t, adapters.CacheStats{Hits: 1, Misses: 1, StaleServes: 3, Refreshes: 1}, cache.CacheStats())
+
+	// Past the TTL the link is read before it is served.
+	fake.Advance(time.Minute)
+	_, err = cache.Find(context.Background(), url.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cache.CacheStats().Misses)
+}
+
+func TestCacheDeleteBypassesSoftTTL(t *testing.T) {
+	cache, _, _, _, url := staleCache(t)
+	_, err := cache.BatchDelete(context.Background(), map[string][]string{url.UUID: {url.ShortURL}})
+	require.NoError(t, err)
+	deleted, err := cache.Find(context.Background(), url.ShortURL)
+	require.NoError(t, err)
+	assert.True(t, deleted.DeletedFlag, "a deleted link is not served from a fresh entry")
+}
+
+func TestCacheDeleteDuringRefresh(t *testing.T) {
+	cache, _, pool, fake, url := staleCache(t)
+	fake.Advance(15 * time.Second)
+	_, err := cache.Find(context.Background(), url.ShortURL)
+	require.NoError(t, err)
+	_, err = cache.BatchDelete(context.Background(), map[string][]string{url.UUID: {url.ShortURL}})
+	require.NoError(t, err)
+
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+	deleted, err := cache.Find(context.Background(), url.ShortURL)
+	require.NoError(t, err)
+	assert.True(t, deleted.DeletedFlag)
+	assert.Equal(t, int64(1), cache.CacheStats().Refreshes)
+}
+
+// countingFinder counts the calls and codes of FindMany.
+type countingFinder struct {
+	*adapters.InMemoryURLRepository
+	calls atomic.Int64
+	codes atomic.Int64
+}
+
+func (f *countingFinder) FindMany(ctx context.Context, shortURLs []string) (map[string]domain.URL, error) {
+	f.calls.Add(1)
+	f.codes.Add(int64(len(shortURLs)))
+	return f.InMemoryURLRepository.FindMany(ctx, shortURLs)
+}
+
+func TestCacheFindMany(t *testing.T) {
+	inMemory, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "urls.json"))
+	require.NoError(t, err)
+	finder := &countingFinder{InMemoryURLRepository: inMemory}
+	cache := adapters.NewCachedRepository(inMemory, time.Minute, 10, adapters.WithCacheFindMany(finder))
+	service := shortener.NewService(inMemory)
+	a := &domain.URL{OriginalURL: "https://example.com/a", UUID: "user-1"}
+	b := &domain.URL{OriginalURL: "https://example.com/b", UUID: "user-1"}
+	require.NoError(t, service.Save(context.Background(), a))
+	require.NoError(t, service.Save(context.Background(), b))
+	_, err = cache.Find(context.Background(), a.ShortURL)
+	require.NoError(t, err)
+
+	found, err := cache.FindMany(context.Background(), []string{a.ShortURL, b.ShortURL, "unknown"})
+	require.NoError(t, err)
+	assert.Len(t, found, 2)
+	assert.Equal(t, b.OriginalURL, found[b.ShortURL].OriginalURL)
+	assert.Equal(t, int64(1), finder.calls.Load(), "misses are read in one call")
+	assert.Equal(t, int64(2), finder.codes.Load(), "hits are not read")
+
+	found, err = cache.FindMany(context.Background(), []string{a.ShortURL, b.ShortURL})
+	require.NoError(t, err)
+	assert.Len(t, found, 2)
+	assert.Equal(t, int64(1), finder.calls.Load(), "links read by FindMany are primed")
+	assert.Equal(t, adapters.CacheStats{Hits: 3, Misses: 3}, cache.CacheStats())
+}
+
+func TestCacheFindManyWithoutFinder(t *testing.T) {
+	inMemory, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "urls.json"))
+	require.NoError(t, err)
+	cache := adapters.NewCachedRepository(adapters.NewMetricsRepository(inMemory, nil), time.Minute, 10)
+	url := &domain.URL{OriginalURL: "https://example.com/a", UUID: "user-1"}
+	require.NoError(t, shortener.NewService(inMemory).Save(context.Background(), url))
+
+	found, err := cache.FindMany(context.Background(), []string{url.ShortURL, "unknown"})
+	require.NoError(t, err)
+	assert.Len(t, found, 1)
+	assert.Equal(t, url.OriginalURL, found[url.ShortURL].OriginalURL, "misses are read with Find")
+}
@@ -0,0 +1,64 @@
+package adapters_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+)
+
+func TestTokenExpiresOnClock(t *testing.T) {
+	cfg := &configs.Config{}
+	cfg.Auth.TokenExp = 60
+	cfg.Auth.SecretKey = strings.Repeat("k", adapters.MinSecretKeyLength)
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	provider, err := adapters.NewProviderJWT(cfg, adapters.WithTokenClock(fake))
+	require.NoError(t, err)
+
+	token, err := provider.BuildJWTString("user-1")
+	require.NoError(t, err)
+
+	fake.Advance(59 * time.Second)
+	claims, err := provider.GetClaims(token)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.UserID)
+
+	fake.Advance(2 * time.Second)
+	_, err = provider.GetClaims(token)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+}
+
+func TestCacheEntriesExpireOnClock(t *testing.T) {
+	repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "urls.json"))
+	require.NoError(t, err)
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := adapters.NewCachedRepository(repo, time.Minute, 10, adapters.WithCacheClock(fake))
+	url := domain.NewURL("https://example.com/ttl")
+	url.UUID = "user-1"
+	require.NoError(t, shortener.NewService(repo).Save(context.Background(), url))
+
+	_, err = cache.Find(context.Background(), url.ShortURL)
+	require.NoError(t, err)
+	_, err = repo.Archive(context.Background(), time.Now().Add(time.Hour), time.Now())
+	require.NoError(t, err)
+
+	cached, err := cache.Find(context.Background(), url.ShortURL)
+	require.NoError(t, err)
+	assert.False(t, cached.Archived, "the entry is served from the cache until it expires")
+
+	fake.Advance(time.Minute)
+	fresh, err := cache.Find(context.Background(), url.ShortURL)
+	require.NoError(t, err)
+	assert.True(t, fresh.Archived)
+}
@@ -0,0 +1,135 @@
+package adapters_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+)
+
+// slowDriver is a database whose statements block until released, recording the
+// end of each statement and the close of the database in order.
+type slowDriver struct {
+	started chan struct{}
+	release chan struct{}
+	mu      sync.Mutex
+	events  []string
+}
+
+func newSlowDriver() *slowDriver {
+	return &slowDriver{started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (d *slowDriver) record(event string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.events = append(d.events, event)
+}
+
+func (d *slowDriver) Events() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.events...)
+}
+
+func (d *slowDriver) Connect(context.Context) (driver.Conn, error) { return slowConn{d}, nil }
+
+func (d *slowDriver) Driver() driver.Driver { return nil }
+
+func (d *slowDriver) Close() error {
+	d.record("close")
+	return nil
+}
+
+type slowConn struct{ d *slowDriver }
+
+func (c slowConn) ExecContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Result, error) {
+	c.d.started <- struct{}{}
+	select {
+	case <-c.d.release:
+		c.d.record("exec")
+		return driver.RowsAffected(1), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c slowConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+
+func (c slowConn) Close() error { return nil }
+
+func (c slowConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func slowRepository() (*adapters.PostgreRepository, *slowDriver) {
+	d := newSlowDriver()
+	return &adapters.PostgreRepository{Database: sqlx.NewDb(sql.OpenDB(d), "pgx")}, d
+}
+
+func TestPostgreCloseWaitsForOperations(t *testing.T) {
+	repo, d := slowRepository()
+	archived := make(chan error, 1)
+	go func() {
+		_, err := repo.Archive(context.Background(), time.Now(), time.Now())
+		archived <- err
+	}()
+	<-d.started
+
+	closed := make(chan error, 1)
+	go func() { closed <- repo.Close(context.Background()) }()
+	require.Eventually(t, func() bool {
+		return errors.Is(repo.Ping(context.Background()), adapters.ErrRepositoryClosed)
+	}, time.Second, time.Millisecond, "operations are refused once Close started")
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the operation ended")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(d.release)
+	require.NoError(t, <-archived)
+	require.NoError(t, <-closed)
+	assert.Equal(t, []string{"exec", "close"}, d.Events())
+}
+
+func TestPostgreCloseGivesUpAtDeadline(t *testing.T) {
+	repo, d := slowRepository()
+	go func() { _, _ = repo.Archive(context.Background(), time.Now(), time.Now()) }()
+	<-d.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := repo.Close(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "1 operations still in progress")
+	assert.Equal(t, []string{"close"}, d.Events(), "the database is closed anyway")
+	close(d.release)
+}
+
+func TestInMemoryCloseFlushesMirroredLinks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	repo, err := adapters.NewInMemoryURLRepository(path)
+	require.NoError(t, err)
+	require.NoError(t, repo.Close(context.Background()))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "nothing to flush, nothing written")
+
+	require.NoError(t, repo.Mirror(context.Background(), domain.URL{ShortURL: "abc", OriginalURL: "https://example.com", UUID: "user-1"}))
+	require.NoError(t, repo.Close(context.Background()))
+	reopened, err := adapters.NewInMemoryURLRepository(path)
+	require.NoError(t, err)
+	url, err := reopened.Find(context.Background(), "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", url.OriginalURL)
+}
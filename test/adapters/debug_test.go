@@ -0,0 +1,62 @@
+package adapters_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+)
+
+func TestDebugEndpoints(t *testing.T) {
+	tests := []struct {
+		name         string
+		enabled      bool
+		proxies      string
+		remoteAddr   string
+		realIP       string
+		path         string
+		expectedCode int
+		expectedBody string
+	}{
+		{"pprof index", true, "", "192.0.2.10:4000", "", "/debug/pprof/", http.StatusOK, "goroutine"},
+		{"pprof profile", true, "", "192.0.2.10:4000", "", "/debug/pprof/heap?debug=1", http.StatusOK, "heap profile"},
+		{"pprof cmdline", true, "", "192.0.2.10:4000", "", "/debug/pprof/cmdline", http.StatusOK, ""},
+		{"expvar", true, "", "192.0.2.10:4000", "", "/debug/vars", http.StatusOK, `"memstats"`},
+		{"Untrusted address", true, "", "10.0.0.1:4000", "", "/debug/vars", http.StatusForbidden, "Forbidden"},
+		{"X-Real-IP without proxies", true, "", "10.0.0.1:4000", "192.0.2.10", "/debug/vars", http.StatusForbidden, "Forbidden"},
+		{"X-Real-IP from an untrusted proxy", true, "10.0.0.2", "10.0.0.1:4000", "192.0.2.10", "/debug/vars", http.StatusForbidden, "Forbidden"},
+		{"X-Real-IP from a proxy", true, "10.0.0.0/24", "10.0.0.1:4000", "192.0.2.10", "/debug/vars", http.StatusOK, `"memstats"`},
+		{"Untrusted X-Real-IP from a proxy", true, "10.0.0.0/24", "10.0.0.1:4000", "10.0.0.3", "/debug/vars", http.StatusForbidden, "Forbidden"},
+		{"Disabled", false, "", "192.0.2.10:4000", "", "/debug/vars", http.StatusNotFound, ""},
+		{"Disabled pprof", false, "", "192.0.2.10:4000", "", "/debug/pprof/", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+			require.NoError(t, err)
+			cfg := getConfig(t)
+			cfg.Server.TrustedSubnet = "192.0.2.0/24"
+			cfg.Server.TrustedProxies = tt.proxies
+			cfg.Server.DebugEnabled = tt.enabled
+			router := setupRouter()
+			api := adapters.NewRestAPI(repo, router, cfg)
+			require.NoError(t, api.RegisterRoutes())
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code, w.Body.String())
+			assert.Contains(t, w.Body.String(), tt.expectedBody)
+		})
+	}
+}
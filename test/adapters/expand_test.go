@@ -0,0 +1,123 @@
+package adapters_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+)
+
+func expandBatch(router *gin.Engine, body, ip string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/expand_batch", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":1234"
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestExpandBatch(t *testing.T) {
+	inMemory, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+	require.NoError(t, err)
+	repo := &deletingRepo{InMemoryURLRepository: inMemory, deleted: make(map[string]bool)}
+	cfg := getConfig(t)
+	cfg.Expand.BatchBurst = 100
+	router := setupRouter()
+	api := adapters.NewRestAPI(repo, router, cfg)
+	require.NoError(t, api.RegisterRoutes())
+
+	service := shortener.NewService(repo)
+	links := make(map[string]*domain.URL)
+	for _, name := range []string{"live", "deleted", "flagged"} {
+		url := &domain.URL{OriginalURL: "https://example.com/" + name, UUID: "user-1"}
+		require.NoError(t, service.Save(context.Background(), url))
+		links[name] = url
+	}
+	repo.deleted[links["deleted"].ShortURL] = true
+	_, err = repo.Moderate(context.Background(), links["flagged"].ShortURL, domain.Moderation{
+		Status: domain.ModerationFlagged, Reason: domain.ReasonAbuseReport, Actor: "admin"})
+	require.NoError(t, err)
+
+	w := expandBatch(router, fmt.Sprintf(`[%q, %q, %q, "unknown"]`,
+		links["live"].ShortURL, links["deleted"].ShortURL, links["flagged"].ShortURL), "192.0.2.1")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var results map[string]struct {
+		OriginalURL string `json:"original_url"`
+		Status      string `json:"status"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+	assert.Len(t, results, 4)
+	assert.Equal(t, "ok", results[links["live"].ShortURL].Status)
+	assert.Equal(t, "https://example.com/live", results[links["live"].ShortURL].OriginalURL)
+	assert.Equal(t, "gone", results[links["deleted"].ShortURL].Status)
+	assert.Empty(t, results[links["deleted"].ShortURL].OriginalURL)
+	assert.Equal(t, "blocked", results[links["flagged"].ShortURL].Status)
+	assert.Empty(t, results[links["flagged"].ShortURL].OriginalURL)
+	assert.Equal(t, "not_found", results["unknown"].Status)
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"), "unknown and blocked links may change")
+
+	w = expandBatch(router, fmt.Sprintf(`[%q, %q]`, links["live"].ShortURL, links["deleted"].ShortURL), "192.0.2.1")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "public, max-age=86400, immutable", w.Header().Get("Cache-Control"))
+
+	tooMany := make([]string, cfg.Expand.BatchMax+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("code%d", i)
+	}
+	body, err := json.Marshal(tooMany)
+	require.NoError(t, err)
+	tests := []struct {
+		name         string
+		body         string
+		expectedBody string
+	}{
+		{"Not an array", `{"codes":["a"]}`, "JSON array"},
+		{"Empty", `[]`, "JSON array"},
+		{"Too many", string(body), "At most 100 codes"},
+		{"Duplicate", `["a","b","a"]`, `"code":"a"`},
+		{"Empty code", `["a",""]`, "Empty short code"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := expandBatch(router, tt.body, "192.0.2.1")
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tt.expectedBody)
+		})
+	}
+}
+
+func TestExpandBatchRateLimitedPerIP(t *testing.T) {
+	repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+	require.NoError(t, err)
+	cfg := getConfig(t)
+	router := setupRouter()
+	api := adapters.NewRestAPI(repo, router, cfg)
+	require.NoError(t, api.RegisterRoutes())
+
+	for i := 0; i < cfg.Expand.BatchBurst; i++ {
+		require.Equal(t, http.StatusOK, expandBatch(router, `["a"]`, "192.0.2.1").Code)
+	}
+	w := expandBatch(router, `["a"]`, "192.0.2.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, expandBatch(router, `["a"]`, "192.0.2.2").Code, "other clients have their own budget")
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/"+strings.Repeat("a", 8), nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	router.ServeHTTP(w, req)
+	assert.NotEqual(t, http.StatusTooManyRequests, w.Code, "single expands are not limited")
+}
@@ -0,0 +1,132 @@
+package adapters_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+)
+
+// newExpiryEnv serves the API with its clock at fake, for the user alice.
+func newExpiryEnv(t *testing.T, fake *clock.Fake) (*reservationEnv, *adapters.InMemoryURLRepository) {
+	t.Helper()
+	cfg := getConfig(t)
+	repo, _ := newReservationRepo(t)
+	router := setupRouter()
+	api := adapters.NewRestAPI(repo, router, cfg, adapters.WithClock(fake))
+	require.NoError(t, api.RegisterRoutes())
+	return &reservationEnv{router: router, tokens: map[string]string{"alice": buildToken(t, cfg, "alice")}}, repo
+}
+
+// shortCode returns the code of the link in the result of a shorten request.
+func shortCode(t *testing.T, body []byte) string {
+	t.Helper()
+	var result struct {
+		Result string `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(body, &result))
+	return filepath.Base(result.Result)
+}
+
+func TestLinkExpires(t *testing.T) {
+	fake := clock.NewFake(time.Now().Truncate(time.Second))
+	env, _ := newExpiryEnv(t, fake)
+
+	w := env.do(http.MethodPost, "/api/shorten", "alice", `{"longURL":"https://example.com/ttl","ttl":"1h"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	ttl := shortCode(t, w.Body.Bytes())
+	deadline := fake.Now().Add(90 * time.Minute).UTC().Format(time.RFC3339)
+	w = env.do(http.MethodPost, "/api/shorten", "alice", `{"longURL":"https://example.com/deadline","expires_at":"`+deadline+`"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	dated := shortCode(t, w.Body.Bytes())
+	w = env.do(http.MethodPost, "/api/batch_shorten?ttl=1h", "alice", `{"a":"https://example.com/batch"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	w = env.do(http.MethodGet, "/api/user/urls", "alice", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var listed struct {
+		URLs []domain.URL `json:"urls"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed.URLs, 3)
+	for _, link := range listed.URLs {
+		require.NotNil(t, link.ExpiresAt, "the list shows when %s expires", link.ShortURL)
+	}
+
+	assert.Equal(t, http.StatusTemporaryRedirect, env.do(http.MethodGet, "/api/"+ttl, "", "").Code)
+	fake.Advance(time.Hour)
+	w = env.do(http.MethodGet, "/api/"+ttl, "", "")
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Equal(t, "URL has expired", w.Body.String())
+	assert.Equal(t, http.StatusTemporaryRedirect, env.do(http.MethodGet, "/api/"+dated, "", "").Code)
+	fake.Advance(30 * time.Minute)
+	assert.Equal(t, http.StatusGone, env.do(http.MethodGet, "/api/"+dated, "", "").Code)
+}
+
+func TestLinkExpiryRejected(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	env, _ := newExpiryEnv(t, fake)
+	past := fake.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name, path, body, field string
+	}{
+		{"Invalid ttl", "/api/shorten", `{"longURL":"https://example.com/a","ttl":"soon"}`, "ttl"},
+		{"Negative ttl", "/api/shorten", `{"longURL":"https://example.com/a","ttl":"-1h"}`, "ttl"},
+		{"Both", "/api/shorten", `{"longURL":"https://example.com/a","ttl":"1h","expires_at":"` + past + `"}`, "ttl"},
+		{"Past deadline", "/api/shorten", `{"longURL":"https://example.com/a","expires_at":"` + past + `"}`, "expires_at"},
+		{"Batch invalid deadline", "/api/batch_shorten?expires_at=tomorrow", `{"a":"https://example.com/a"}`, "expires_at"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := env.do(http.MethodPost, tt.path, "alice", tt.body)
+			require.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			var body struct {
+				Message string `json:"message"`
+				Field   string `json:"field"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, tt.field, body.Field)
+			assert.Contains(t, body.Message, domain.ErrInvalidExpiry.Error())
+		})
+	}
+}
+
+func TestPurgeExpiredLinks(t *testing.T) {
+	repo, path := newReservationRepo(t)
+	ctx := context.Background()
+	service := shortener.NewService(repo)
+	now := time.Now()
+	expiresAt := now.Add(time.Hour).UTC().Truncate(time.Second)
+	expiring := &domain.URL{UUID: "alice", OriginalURL: "https://example.com/expiring", ExpiresAt: &expiresAt}
+	lasting := &domain.URL{UUID: "alice", OriginalURL: "https://example.com/lasting"}
+	require.NoError(t, service.Save(ctx, expiring))
+	require.NoError(t, service.Save(ctx, lasting))
+
+	reloaded, err := adapters.NewInMemoryURLRepository(path)
+	require.NoError(t, err)
+	found, err := reloaded.Find(ctx, expiring.ShortURL)
+	require.NoError(t, err)
+	require.NotNil(t, found.ExpiresAt, "the expiry is kept in the save file")
+	assert.True(t, found.ExpiresAt.Equal(expiresAt))
+
+	purged, err := reloaded.PurgeExpiredLinks(ctx, now)
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+	purged, err = reloaded.PurgeExpiredLinks(ctx, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = reloaded.Find(ctx, expiring.ShortURL)
+	assert.ErrorIs(t, err, domain.ErrURLNotFound)
+	_, err = reloaded.Find(ctx, lasting.ShortURL)
+	assert.NoError(t, err)
+}
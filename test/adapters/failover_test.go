@@ -0,0 +1,143 @@
+package adapters_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+)
+
+// faultyRepo fails every call with a connection error while down.
+type faultyRepo struct {
+	*adapters.InMemoryURLRepository
+	down atomic.Bool
+}
+
+func (r *faultyRepo) fault() error {
+	return fmt.Errorf("find: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+}
+
+func (r *faultyRepo) Find(ctx context.Context, shortURL string) (*domain.URL, error) {
+	if r.down.Load() {
+		return nil, r.fault()
+	}
+	return r.InMemoryURLRepository.Find(ctx, shortURL)
+}
+
+func (r *faultyRepo) Save(ctx context.Context, url *domain.URL) error {
+	if r.down.Load() {
+		return r.fault()
+	}
+	return r.InMemoryURLRepository.Save(ctx, url)
+}
+
+func newFailover(t *testing.T) (*faultyRepo, *adapters.InMemoryURLRepository, *adapters.FailoverRepository) {
+	t.Helper()
+	inMemory, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+	require.NoError(t, err)
+	primary := &faultyRepo{InMemoryURLRepository: inMemory}
+	secondary, err := adapters.NewSecondaryRepository(adapters.SecondaryFile, filepath.Join(t.TempDir(), "failover.json"), nil)
+	require.NoError(t, err)
+	return primary, secondary, adapters.NewFailoverRepository(primary, secondary)
+}
+
+func TestFailoverServesFromSecondary(t *testing.T) {
+	primary, _, failover := newFailover(t)
+	url := &domain.URL{OriginalURL: "https://example.com/a", UUID: uuid.NewString()}
+	require.NoError(t, shortener.NewService(failover).Save(context.Background(), url))
+
+	_, err := failover.Find(context.Background(), "unknown")
+	assert.ErrorIs(t, err, domain.ErrURLNotFound, "a link unknown to the primary is not looked up elsewhere")
+
+	primary.down.Store(true)
+	found, err := failover.Find(context.Background(), url.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, url.OriginalURL, found.OriginalURL)
+	assert.True(t, found.Degraded)
+
+	_, err = failover.Find(context.Background(), "unknown")
+	var opErr *net.OpError
+	assert.ErrorAs(t, err, &opErr, "the secondary not knowing a link does not make it unknown")
+	assert.ErrorIs(t, failover.Save(context.Background(), &domain.URL{OriginalURL: "https://example.com/b", ShortURL: "b", UUID: uuid.NewString()}),
+		syscall.ECONNREFUSED, "writes need the primary")
+
+	assert.Equal(t, adapters.FailoverStats{DegradedServes: 1, SecondaryMisses: 1}, failover.FailoverStats())
+}
+
+func TestFailoverSecondaryForgetsDeletedLinks(t *testing.T) {
+	primary, secondary, failover := newFailover(t)
+	url := domain.URL{OriginalURL: "https://example.com/a", ShortURL: "a", UUID: uuid.NewString()}
+	require.NoError(t, secondary.Mirror(context.Background(), url))
+	url.DeletedFlag = true
+	require.NoError(t, secondary.Mirror(context.Background(), url))
+
+	primary.down.Store(true)
+	_, err := failover.Find(context.Background(), "a")
+	assert.Error(t, err)
+	assert.Zero(t, failover.FailoverStats().DegradedServes)
+}
+
+func TestFailoverSnapshotSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failover.json")
+	secondary, err := adapters.NewSecondaryRepository(adapters.SecondaryFile, path, nil)
+	require.NoError(t, err)
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, secondary.Mirror(context.Background(),
+		domain.URL{OriginalURL: "https://example.com/a", ShortURL: "a", UUID: uuid.NewString(), CreatedAt: created}))
+	require.NoError(t, secondary.SaveSnapshot(context.Background()))
+
+	restarted, err := adapters.NewSecondaryRepository(adapters.SecondaryFile, path, nil)
+	require.NoError(t, err)
+	found, err := restarted.Find(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/a", found.OriginalURL)
+	assert.True(t, created.Equal(found.CreatedAt))
+
+	_, err = adapters.NewSecondaryRepository("redis", path, nil)
+	assert.ErrorIs(t, err, adapters.ErrUnsupportedSecondary)
+}
+
+func TestRedirectDuringPrimaryOutage(t *testing.T) {
+	primary, _, failover := newFailover(t)
+	cache := adapters.NewCachedRepository(failover, time.Minute, 100)
+	cfg := getConfig(t)
+	router := setupRouter()
+	api := adapters.NewRestAPI(cache, router, cfg, adapters.WithFailover(failover))
+	require.NoError(t, api.RegisterRoutes())
+	url := &domain.URL{OriginalURL: "https://example.com/a", UUID: uuid.NewString()}
+	require.NoError(t, shortener.NewService(failover).Save(context.Background(), url))
+
+	redirect := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/"+url.ShortURL, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	primary.down.Store(true)
+	for i := 0; i < 2; i++ {
+		w := redirect()
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, url.OriginalURL, w.Header().Get("Location"))
+		assert.Equal(t, "secondary", w.Header().Get(adapters.DegradedHeader))
+	}
+	assert.Equal(t, int64(2), failover.FailoverStats().DegradedServes, "degraded answers are not cached")
+
+	primary.down.Store(false)
+	w := redirect()
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Empty(t, w.Header().Get(adapters.DegradedHeader))
+}
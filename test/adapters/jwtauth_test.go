@@ -0,0 +1,107 @@
+package adapters_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+)
+
+var (
+	oldSecret = strings.Repeat("o", adapters.MinSecretKeyLength)
+	newSecret = strings.Repeat("n", adapters.MinSecretKeyLength)
+)
+
+func authConfig(keyID, secret, previous string) *configs.Config {
+	cfg := &configs.Config{}
+	cfg.Auth.TokenExp = 60
+	cfg.Auth.KeyID = keyID
+	cfg.Auth.SecretKey = secret
+	cfg.Auth.PreviousKeys = previous
+	return cfg
+}
+
+func TestProviderRejectsWeakKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		previous string
+		message  string
+	}{
+		{"empty", "", "", "is empty"},
+		{"short", "mySecretKey", "", "11 bytes, at least 32"},
+		{"short previous", newSecret, "old:short", `key "old" is 5 bytes`},
+		{"empty previous", newSecret, "old:", `key "old" is empty`},
+		{"not id:secret", newSecret, oldSecret, "not id:secret"},
+		{"duplicate id", newSecret, "primary:" + oldSecret, "duplicate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := adapters.NewProviderJWT(authConfig("primary", tt.secret, tt.previous))
+			assert.ErrorIs(t, err, adapters.ErrInvalidSigningKey)
+			assert.ErrorContains(t, err, tt.message)
+		})
+	}
+}
+
+func TestEmptyKeyFailsStartup(t *testing.T) {
+	cfg := getConfig(t)
+	cfg.Auth.SecretKey = ""
+	repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "urls.json"))
+	require.NoError(t, err)
+	assert.Panics(t, func() { adapters.NewRestAPI(repo, gin.New(), cfg) })
+
+	_, err = (&adapters.ProviderJWT{}).BuildJWTString("user-1")
+	assert.ErrorIs(t, err, adapters.ErrInvalidSigningKey, "a provider without a key never signs")
+}
+
+func TestExampleSecretKey(t *testing.T) {
+	assert.True(t, adapters.ExampleSecretKey(getConfig(t).Auth.SecretKey), "the example config warns on startup")
+	assert.False(t, adapters.ExampleSecretKey(newSecret))
+}
+
+func TestProviderKeyRotation(t *testing.T) {
+	before, err := adapters.NewProviderJWT(authConfig("k1", oldSecret, ""))
+	require.NoError(t, err)
+	unnamed, err := adapters.NewProviderJWT(authConfig("", oldSecret, ""))
+	require.NoError(t, err)
+	core, logs := observer.New(zapcore.DebugLevel)
+	after, err := adapters.NewProviderJWT(authConfig("k2", newSecret, "k1:"+oldSecret), adapters.WithTokenLogger(zap.New(core)))
+	require.NoError(t, err)
+
+	for name, provider := range map[string]*adapters.ProviderJWT{"k1": before, "no kid": unnamed, "k2": after} {
+		token, err := provider.BuildJWTString("user-1")
+		require.NoError(t, err)
+		claims, err := after.GetClaims(token)
+		require.NoError(t, err, name)
+		assert.Equal(t, "user-1", claims.UserID)
+	}
+	assert.Zero(t, logs.Len())
+
+	token, err := after.BuildJWTString("user-1")
+	require.NoError(t, err)
+	_, err = before.GetClaims(token)
+	assert.Error(t, err, "a key id unknown to the verifier")
+
+	// Signed with neither key: both are tried.
+	forged, err := adapters.NewProviderJWT(authConfig("", strings.Repeat("f", adapters.MinSecretKeyLength), ""))
+	require.NoError(t, err)
+	token, err = forged.BuildJWTString("user-1")
+	require.NoError(t, err)
+	_, err = after.GetClaims(token)
+	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+
+	failures := logs.FilterMessage("token verification failed").All()
+	require.Len(t, failures, 1)
+	assert.Equal(t, []interface{}{"k2", "k1"}, failures[0].ContextMap()["tried_key_ids"])
+}
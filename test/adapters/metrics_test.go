@@ -0,0 +1,174 @@
+package adapters_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/backpressure"
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden files of the tests")
+
+// goldenTask fails with err, if set, and is counted under kind.
+type goldenTask struct {
+	err  error
+	kind string
+}
+
+func (t goldenTask) Execute(context.Context) error { return t.err }
+func (t goldenTask) Stringer() string              { return "golden" }
+func (t goldenTask) Kind() string                  { return t.kind }
+
+func TestWorkerPoolMetricsGolden(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	pools := worker.NewRegistry()
+	for _, name := range []string{"deleteWorker", "jobWorker", "persistWorker"} {
+		pool, err := worker.NewPool(name, worker.WithClock(fake), worker.WithWorkers(1), worker.WithBuffer(10), worker.WithErrorCap(10))
+		require.NoError(t, err)
+		require.NoError(t, pools.Register(name, worker.StageIngest, pool))
+	}
+	persist := pools.MustGet("persistWorker")
+	require.NoError(t, persist.Submit(context.Background(), goldenTask{}))
+	require.NoError(t, persist.Submit(context.Background(), goldenTask{err: errors.New("disk full")}))
+	require.NoError(t, persist.Submit(context.Background(), goldenTask{kind: "click"}))
+	persist.Start(context.Background())
+	require.NoError(t, persist.Drain(context.Background()))
+
+	repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+	require.NoError(t, err)
+	router := setupRouter()
+	api := adapters.NewRestAPI(repo, router, getConfig(t), adapters.WithPools(pools))
+	router.GET("/metrics", api.WorkerPoolMetrics)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var got bytes.Buffer
+	require.NoError(t, json.Indent(&got, w.Body.Bytes(), "", "  "))
+	got.WriteByte('\n')
+
+	golden := filepath.Join("testdata", "worker_metrics.golden.json")
+	if *update {
+		require.NoError(t, os.WriteFile(golden, got.Bytes(), 0o644))
+	}
+	want, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), got.String())
+}
+
+func TestLookupCounts(t *testing.T) {
+	inMemory, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+	require.NoError(t, err)
+	repo := adapters.NewMetricsRepository(inMemory, nil)
+	url := &domain.URL{OriginalURL: "https://example.com/a", UUID: uuid.NewString()}
+	require.NoError(t, shortener.NewService(repo).Save(context.Background(), url))
+	for range 3 {
+		_, err := repo.Find(context.Background(), url.ShortURL)
+		require.NoError(t, err)
+	}
+	_, err = repo.Find(context.Background(), "unknown")
+	assert.ErrorIs(t, err, domain.ErrURLNotFound)
+	assert.Equal(t, map[string]adapters.LookupCounts{"memory": {Found: 3, NotFound: 1}}, repo.Lookups())
+
+	primary, _, failover := newFailover(t)
+	repo = adapters.NewMetricsRepository(failover, nil)
+	require.NoError(t, shortener.NewService(repo).Save(context.Background(), url))
+	primary.down.Store(true)
+	_, err = repo.Find(context.Background(), url.ShortURL)
+	require.NoError(t, err)
+	_, err = repo.Find(context.Background(), "unknown")
+	require.Error(t, err)
+	assert.Equal(t, map[string]adapters.LookupCounts{"other": {Errors: 1}, "secondary": {Found: 1}}, repo.Lookups(),
+		"links the secondary answers for count against it")
+}
+
+func TestUserLinksThroughDecorators(t *testing.T) {
+	_, _, failover := newFailover(t)
+	cfg := getConfig(t)
+	monitor := backpressure.NewMonitor(cfg)
+	repo := adapters.NewCachedRepository(adapters.NewMetricsRepository(failover, monitor), time.Minute, 100)
+	router := setupRouter()
+	require.NoError(t, adapters.NewRestAPI(repo, router, cfg).RegisterRoutes())
+	url := &domain.URL{OriginalURL: "https://example.com/listed", UUID: "user-1"}
+	require.NoError(t, shortener.NewService(repo).Save(context.Background(), url))
+
+	w := listUserLinks(t, router, buildToken(t, cfg, "user-1"), "?q=listed")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), url.ShortURL)
+	methods := monitor.Stats().Methods
+	assert.Contains(t, methods, "FindByUser", "the listing is timed")
+	assert.Contains(t, methods, "CountByQuery", "the listing is timed")
+}
+
+func TestRepositoryLatency(t *testing.T) {
+	inMemory, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+	require.NoError(t, err)
+	repo := adapters.NewMetricsRepository(inMemory, nil)
+	url := &domain.URL{OriginalURL: "https://example.com/a", ShortURL: "abc", UUID: "user-1"}
+	require.NoError(t, repo.Save(context.Background(), url))
+	_, err = repo.Find(context.Background(), "abc")
+	require.NoError(t, err)
+	_, err = repo.BatchDelete(context.Background(), map[string][]string{"user-1": {"abc"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, testutil.CollectAndCount(repo.Collector()), "one series per operation")
+	problems, err := testutil.CollectAndLint(repo.Collector())
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestResetWorkerPoolMetrics(t *testing.T) {
+	pools := worker.NewRegistry()
+	for _, name := range []string{"deleteWorker", "jobWorker", "persistWorker"} {
+		pool, err := worker.NewPool(name, worker.WithWorkers(1), worker.WithBuffer(10))
+		require.NoError(t, err)
+		require.NoError(t, pools.Register(name, worker.StageIngest, pool))
+	}
+	pool := pools.MustGet("deleteWorker")
+	require.NoError(t, pool.Submit(context.Background(), goldenTask{}))
+
+	repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+	require.NoError(t, err)
+	cfg := getConfig(t)
+	router := setupRouter()
+	api := adapters.NewRestAPI(repo, router, cfg, adapters.WithPools(pools))
+	require.NoError(t, api.RegisterRoutes())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/metrics/reset", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, 1, pool.Metrics().PoolMetrics.TasksEnqueued(), "nothing is reset without auth")
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/metrics/reset", nil)
+	req.AddCookie(&http.Cookie{Name: "auth", Value: buildToken(t, cfg, "admin")})
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var got map[string]struct {
+		Pool struct {
+			Enqueued int `json:"tasks_enqueued"`
+		} `json:"pool"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, 1, got["deleteWorker"].Pool.Enqueued, "the values before the reset are returned")
+	assert.Zero(t, pool.Metrics().PoolMetrics.TasksEnqueued())
+}
@@ -0,0 +1,128 @@
+package adapters_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+)
+
+func TestModerationAudited(t *testing.T) {
+	repo, path := newReservationRepo(t)
+	ctx := context.Background()
+	url := &domain.URL{OriginalURL: "https://spam.example.com", UUID: uuid.NewString()}
+	require.NoError(t, shortener.NewService(repo).Save(ctx, url))
+
+	current, history, err := repo.Moderation(ctx, url.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ModerationClean, current.Status)
+	assert.Empty(t, history)
+
+	flagged, err := repo.Moderate(ctx, url.ShortURL, domain.Moderation{
+		Status: domain.ModerationFlagged, Reason: domain.ReasonBlocklist, Actor: "blocklist", Note: "listed host",
+	})
+	require.NoError(t, err)
+	assert.False(t, flagged.At.IsZero())
+	_, err = repo.Moderate(ctx, url.ShortURL, domain.Moderation{
+		Status: domain.ModerationFlagged, Reason: domain.ReasonAdminReview, Actor: "admin",
+	})
+	assert.ErrorIs(t, err, domain.ErrModerationTransition)
+	_, err = repo.Moderate(ctx, url.ShortURL, domain.Moderation{
+		Status: domain.ModerationBlocked, Reason: domain.ReasonAdminReview, Actor: "admin",
+	})
+	require.NoError(t, err)
+	_, err = repo.Moderate(ctx, "missing", domain.Moderation{
+		Status: domain.ModerationFlagged, Reason: domain.ReasonAdminReview, Actor: "admin",
+	})
+	assert.ErrorIs(t, err, domain.ErrURLNotFound)
+
+	found, err := repo.Find(ctx, url.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ModerationBlocked, found.Moderation)
+
+	// Moderation survives a restart and the archiving of the link.
+	_, err = repo.Archive(ctx, time.Now().Add(time.Hour), time.Now())
+	require.NoError(t, err)
+	reloaded, err := adapters.NewInMemoryURLRepository(path)
+	require.NoError(t, err)
+	current, history, err = reloaded.Moderation(ctx, url.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ModerationBlocked, current.Status)
+	assert.Equal(t, "admin", current.Actor)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, domain.ModerationClean, history[0].From)
+		assert.Equal(t, domain.ModerationFlagged, history[0].Status)
+		assert.Equal(t, "listed host", history[0].Note)
+		assert.Equal(t, domain.ModerationFlagged, history[1].From)
+		assert.Equal(t, domain.ModerationBlocked, history[1].Status)
+	}
+
+	blocked, err := reloaded.ModeratedLinks(ctx, domain.ModerationBlocked)
+	require.NoError(t, err)
+	if assert.Len(t, blocked, 1) {
+		assert.Equal(t, url.ShortURL, blocked[0].ShortURL)
+		assert.Equal(t, url.UUID, blocked[0].UserID)
+	}
+	flaggedLinks, err := reloaded.ModeratedLinks(ctx, domain.ModerationFlagged)
+	require.NoError(t, err)
+	assert.Empty(t, flaggedLinks)
+}
+
+func TestModerationEndpoints(t *testing.T) {
+	repo, _ := newReservationRepo(t)
+	url := &domain.URL{OriginalURL: "https://spam.example.com", UUID: uuid.NewString()}
+	require.NoError(t, shortener.NewService(repo).Save(context.Background(), url))
+
+	cfg := getConfig(t)
+	cfg.Server.TrustedSubnet = "192.0.2.0/24"
+	router := setupRouter()
+	api := adapters.NewRestAPI(repo, router, cfg, adapters.WithModeration(repo))
+	require.NoError(t, api.RegisterRoutes())
+
+	moderation := "/api/internal/urls/" + url.ShortURL + "/moderation"
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		expectedCode int
+		expectedBody string
+	}{
+		{"Never moderated", http.MethodGet, moderation, "", http.StatusOK, `"history":[]`},
+		{"Not a decision", http.MethodPost, moderation, `[]`, http.StatusBadRequest, "status"},
+		{"No actor", http.MethodPost, moderation, `{"status":"flagged","reason":"admin_review"}`, http.StatusBadRequest, "actor"},
+		{"Clear clean", http.MethodPost, moderation, `{"status":"cleared","reason":"admin_review","actor":"admin"}`, http.StatusConflict, "clean to cleared"},
+		{"Unknown link", http.MethodPost, "/api/internal/urls/missing/moderation", `{"status":"flagged","reason":"admin_review","actor":"admin"}`, http.StatusNotFound, ""},
+		{"Flag", http.MethodPost, moderation, `{"status":"flagged","reason":"abuse_report","actor":"reports","note":"phishing"}`, http.StatusOK, `"status":"flagged"`},
+		{"Redirects while flagged", http.MethodGet, "/api/" + url.ShortURL, "", http.StatusTemporaryRedirect, ""},
+		{"List flagged", http.MethodGet, "/api/internal/moderation", "", http.StatusOK, `"shortURL":"` + url.ShortURL + `"`},
+		{"List other status", http.MethodGet, "/api/internal/moderation?status=clean", "", http.StatusBadRequest, "status"},
+		{"Block", http.MethodPost, moderation, `{"status":"blocked","reason":"admin_review","actor":"admin"}`, http.StatusOK, `"status":"blocked"`},
+		{"Blocked does not redirect", http.MethodGet, "/api/" + url.ShortURL, "", http.StatusUnavailableForLegalReasons, "policy"},
+		{"History", http.MethodGet, moderation, "", http.StatusOK, `"from":"flagged"`},
+		{"Clear", http.MethodPost, moderation, `{"status":"cleared","reason":"admin_review","actor":"admin"}`, http.StatusOK, `"status":"cleared"`},
+		{"Redirects when cleared", http.MethodGet, "/api/" + url.ShortURL, "", http.StatusTemporaryRedirect, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.RemoteAddr = "192.0.2.10:4000"
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.expectedBody)
+		})
+	}
+}
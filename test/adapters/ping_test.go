@@ -0,0 +1,86 @@
+package adapters_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+)
+
+// pingRepo answers pings with ping instead of the in-memory repository.
+type pingRepo struct {
+	*adapters.InMemoryURLRepository
+	ping func(ctx context.Context) error
+}
+
+func (r *pingRepo) Ping(ctx context.Context) error {
+	return r.ping(ctx)
+}
+
+func TestPing(t *testing.T) {
+	tests := []struct {
+		name         string
+		timeout      time.Duration
+		ping         func(ctx context.Context) error
+		expectedCode int
+		expectedRepo string
+	}{
+		{"Healthy", 50 * time.Millisecond, func(context.Context) error { return nil }, http.StatusOK, "ok"},
+		{"Repository down", 50 * time.Millisecond, func(context.Context) error { return errors.New("connection refused") }, http.StatusServiceUnavailable, "down"},
+		{"Slow repository", 50 * time.Millisecond, func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Minute):
+				return nil
+			}
+		}, http.StatusServiceUnavailable, "timeout"},
+		{"Zero timeout", 0, func(ctx context.Context) error {
+			deadline, ok := ctx.Deadline()
+			if !ok || time.Until(deadline) < time.Second {
+				return context.DeadlineExceeded
+			}
+			return ctx.Err()
+		}, http.StatusOK, "ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+			require.NoError(t, err)
+			cfg := getConfig(t)
+			cfg.Readiness.PingTimeout = tt.timeout
+			router := setupRouter()
+			api := adapters.NewRestAPI(&pingRepo{InMemoryURLRepository: mem, ping: tt.ping}, router, cfg)
+			require.NoError(t, api.RegisterRoutes())
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/ping", nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			var body struct {
+				Repository string `json:"repository"`
+				Pools      map[string]struct {
+					State      string `json:"state"`
+					Closed     bool   `json:"closed"`
+					QueueDepth int    `json:"queue_depth"`
+				} `json:"pools"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), w.Body.String())
+			assert.Equal(t, tt.expectedRepo, body.Repository)
+			assert.NotContains(t, w.Body.String(), "connection refused")
+			require.Contains(t, body.Pools, "deleteWorker")
+			assert.Equal(t, "created", body.Pools["deleteWorker"].State)
+			assert.False(t, body.Pools["deleteWorker"].Closed)
+		})
+	}
+}
@@ -0,0 +1,403 @@
+package adapters_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/migrations"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// dsnEnv names a key/value DSN of a disposable Postgres; the tests are skipped without it.
+const dsnEnv = "SHORTLINK_TEST_DATABASE_DSN"
+
+// openPostgres returns a repository on a fresh, migrated schema dropped after the test.
+func openPostgres(t *testing.T) *adapters.PostgreRepository {
+	t.Helper()
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", dsnEnv)
+	}
+	admin, err := sqlx.Open("pgx", dsn)
+	require.NoError(t, err)
+	schema := fmt.Sprintf("adapters_test_%d", time.Now().UnixNano())
+	admin.MustExec("CREATE SCHEMA " + schema)
+	t.Cleanup(func() {
+		admin.MustExec("DROP SCHEMA " + schema + " CASCADE")
+		_ = admin.Close()
+	})
+
+	db, err := sqlx.Open("pgx", dsn+" search_path="+schema)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	require.NoError(t, migrations.Run(context.Background(), db, adapters.PostgreMigrations()))
+	return &adapters.PostgreRepository{Database: db}
+}
+
+type ownedLink struct {
+	UserID    string `db:"user_id"`
+	IsDeleted bool   `db:"is_deleted"`
+}
+
+func linkOwner(t *testing.T, repo *adapters.PostgreRepository, shortURL string) ownedLink {
+	t.Helper()
+	var link ownedLink
+	require.NoError(t, repo.Database.Get(&link, "SELECT user_id, is_deleted FROM urls WHERE short_url = $1", shortURL))
+	return link
+}
+
+func TestPostgreReassignOwner(t *testing.T) {
+	repo := openPostgres(t)
+	ctx := context.Background()
+	source, target := uuid.NewString(), uuid.NewString()
+	save := func(owner, longURL string, createdAt time.Time) *domain.URL {
+		url := domain.NewURL(longURL)
+		url.UUID = owner
+		require.NoError(t, shortener.NewService(repo).Save(ctx, url))
+		repo.Database.MustExec("UPDATE urls SET created_at = $1 WHERE short_url = $2", createdAt, url.ShortURL)
+		return url
+	}
+	now := time.Now()
+	onlySource := save(source, "https://only-source.example.com", now)
+	olderSource := save(source, "https://shared-a.example.com", now.Add(-time.Hour))
+	newerTarget := save(target, "https://shared-a.example.com", now)
+	newerSource := save(source, "https://shared-b.example.com", now)
+	olderTarget := save(target, "https://shared-b.example.com", now.Add(-time.Hour))
+
+	moved, err := repo.ReassignOwner(ctx, source, target)
+	require.NoError(t, err)
+	assert.Equal(t, 2, moved)
+
+	assert.Equal(t, ownedLink{UserID: target}, linkOwner(t, repo, onlySource.ShortURL))
+	assert.Equal(t, ownedLink{UserID: target}, linkOwner(t, repo, olderSource.ShortURL))
+	assert.Equal(t, ownedLink{UserID: source, IsDeleted: true}, linkOwner(t, repo, newerTarget.ShortURL))
+	assert.Equal(t, ownedLink{UserID: source, IsDeleted: true}, linkOwner(t, repo, newerSource.ShortURL))
+	assert.Equal(t, ownedLink{UserID: target}, linkOwner(t, repo, olderTarget.ShortURL))
+
+	moved, err = repo.ReassignOwner(ctx, source, target)
+	require.NoError(t, err)
+	assert.Equal(t, 0, moved, "merging again moves nothing")
+}
+
+func TestPostgreBatchDelete(t *testing.T) {
+	repo := openPostgres(t)
+	ctx := context.Background()
+	first, second := uuid.NewString(), uuid.NewString()
+	save := func(owner, longURL string) *domain.URL {
+		url := domain.NewURL(longURL)
+		url.UUID = owner
+		require.NoError(t, shortener.NewService(repo).Save(ctx, url))
+		return url
+	}
+	a := save(first, "https://a.example.com")
+	b := save(first, "https://b.example.com")
+	c := save(second, "https://c.example.com")
+
+	deleted, err := repo.BatchDelete(ctx, map[string][]string{
+		first:  {a.ShortURL, b.ShortURL},
+		second: {a.ShortURL, c.ShortURL},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, deleted, "a user cannot delete links of another")
+	assert.True(t, linkOwner(t, repo, c.ShortURL).IsDeleted)
+
+	deleted, err = repo.BatchDelete(ctx, map[string][]string{first: {a.ShortURL}})
+	require.NoError(t, err)
+	assert.Equal(t, 0, deleted, "deleting again changes nothing")
+}
+
+func TestPostgreLinkChecks(t *testing.T) {
+	repo := openPostgres(t)
+	ctx := context.Background()
+	user, optedOut := uuid.NewString(), uuid.NewString()
+	save := func(owner, longURL string) *domain.URL {
+		url := domain.NewURL(longURL)
+		url.UUID = owner
+		require.NoError(t, shortener.NewService(repo).Save(ctx, url))
+		return url
+	}
+	checked := save(user, "https://checked.example.com")
+	unchecked := save(user, "https://unchecked.example.com")
+	save(optedOut, "https://opted-out.example.com")
+	require.NoError(t, repo.SetLinkChecks(ctx, optedOut, false))
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	require.NoError(t, repo.RecordChecks(ctx, []domain.LinkCheck{{ShortURL: checked.ShortURL, CheckedAt: now, Status: "404"}}))
+
+	due, err := repo.LinksToCheck(ctx, now, 10)
+	require.NoError(t, err)
+	if assert.Len(t, due, 1) {
+		assert.Equal(t, unchecked.ShortURL, due[0].ShortURL)
+	}
+	due, err = repo.LinksToCheck(ctx, now.Add(time.Second), 10)
+	require.NoError(t, err)
+	if assert.Len(t, due, 2) {
+		assert.Equal(t, unchecked.ShortURL, due[0].ShortURL, "links never checked come first")
+		assert.Equal(t, "404", due[1].LastStatus)
+	}
+
+	require.NoError(t, repo.SetLinkChecks(ctx, optedOut, true))
+	due, err = repo.LinksToCheck(ctx, now, 10)
+	require.NoError(t, err)
+	assert.Len(t, due, 2)
+}
+
+func TestPostgreFindByUserAndHost(t *testing.T) {
+	repo := openPostgres(t)
+	ctx := context.Background()
+	user := uuid.NewString()
+	save := func(owner, longURL string) *domain.URL {
+		url := domain.NewURL(longURL)
+		url.UUID = owner
+		require.NoError(t, shortener.NewService(repo).Save(ctx, url))
+		return url
+	}
+	apex := save(user, "https://old-domain.com/a")
+	sub := save(user, "https://CDN.old-domain.com/docs/b")
+	save(user, "https://notold-domain.com/c")
+	save(uuid.NewString(), "https://old-domain.com/d")
+	deleted := save(user, "https://old-domain.com/deleted")
+	_, err := repo.BatchDelete(ctx, map[string][]string{user: {deleted.ShortURL}})
+	require.NoError(t, err)
+
+	var hostRev string
+	require.NoError(t, repo.Database.Get(&hostRev, "SELECT dest_host_rev FROM urls WHERE short_url = $1", sub.ShortURL))
+	assert.Equal(t, "com.old-domain.cdn.", hostRev)
+
+	suffix := domain.URLFilter{HostSuffix: "old-domain.com"}
+	require.NoError(t, suffix.Normalize())
+	found, err := repo.FindByUserAndHost(ctx, user, suffix)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{apex.ShortURL, sub.ShortURL}, found)
+
+	prefix := domain.URLFilter{URLPrefix: "https://cdn.old-domain.com/docs"}
+	require.NoError(t, prefix.Normalize())
+	found, err = repo.FindByUserAndHost(ctx, user, prefix)
+	require.NoError(t, err)
+	assert.Equal(t, []string{sub.ShortURL}, found)
+}
+
+func TestPostgreFindByUserSortAndQuery(t *testing.T) {
+	repo := openPostgres(t)
+	ctx := context.Background()
+	user := uuid.NewString()
+	var codes []string
+	for i := 0; i < 4; i++ {
+		url := domain.NewURL(fmt.Sprintf("https://example.com/Docs/%d", i))
+		if i%2 == 1 {
+			url = domain.NewURL(fmt.Sprintf("https://other.org/%d", i))
+		}
+		url.UUID = user
+		require.NoError(t, shortener.NewService(repo).Save(ctx, url))
+		codes = append(codes, url.ShortURL)
+	}
+	slices.Sort(codes)
+
+	first, err := repo.FindByUser(ctx, user, domain.LinkPage{Limit: 2, Sort: domain.SortByShortURL})
+	require.NoError(t, err)
+	require.Len(t, first, 2)
+	after := domain.CursorOf(first[1], domain.SortByShortURL)
+	rest, err := repo.FindByUser(ctx, user, domain.LinkPage{After: &after, Limit: 10, Sort: domain.SortByShortURL})
+	require.NoError(t, err)
+	var listed []string
+	for _, url := range append(first, rest...) {
+		listed = append(listed, url.ShortURL)
+	}
+	assert.Equal(t, codes, listed)
+
+	byCreated, err := repo.FindByUser(ctx, user, domain.LinkPage{Limit: 3, Sort: domain.SortByCreated})
+	require.NoError(t, err)
+	require.Len(t, byCreated, 3)
+	after = domain.CursorOf(byCreated[2], domain.SortByCreated)
+	last, err := repo.FindByUser(ctx, user, domain.LinkPage{After: &after, Limit: 10, Sort: domain.SortByCreated})
+	require.NoError(t, err)
+	require.Len(t, last, 1, "the cursor query lists the link after the first page")
+	for _, url := range byCreated {
+		assert.NotEqual(t, url.ShortURL, last[0].ShortURL)
+	}
+
+	docs, err := repo.FindByUser(ctx, user, domain.LinkPage{Limit: 10, Sort: domain.SortByCreated, Query: "docs"})
+	require.NoError(t, err)
+	assert.Len(t, docs, 2)
+	total, err := repo.CountByQuery(ctx, user, "DOCS")
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+}
+
+func TestPostgreReservations(t *testing.T) {
+	repo := openPostgres(t)
+	ctx := context.Background()
+	alice, bob := uuid.NewString(), uuid.NewString()
+
+	require.NoError(t, repo.Reserve(ctx, alice, "launch", time.Hour))
+	assert.ErrorIs(t, repo.Reserve(ctx, bob, "launch", time.Hour), domain.ErrShortURLTaken)
+	assert.ErrorIs(t, repo.CompleteReservation(ctx, bob, "launch", "https://bob.example.com"), domain.ErrNotReservationOwner)
+	require.NoError(t, repo.Reserve(ctx, alice, "expired", -time.Second))
+	assert.ErrorIs(t, repo.CompleteReservation(ctx, alice, "expired", "https://late.example.com"), domain.ErrReservationNotFound)
+	require.NoError(t, repo.Reserve(ctx, bob, "expired", time.Hour))
+
+	reservations, err := repo.Reservations(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, reservations, 1)
+	require.NoError(t, repo.CompleteReservation(ctx, alice, "launch", "https://alice.example.com"))
+	reservations, err = repo.Reservations(ctx, alice)
+	require.NoError(t, err)
+	assert.Empty(t, reservations)
+
+	purged, err := repo.PurgeExpiredReservations(ctx, time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+}
+
+func TestPostgreModeration(t *testing.T) {
+	repo := openPostgres(t)
+	ctx := context.Background()
+	url := &domain.URL{OriginalURL: "https://spam.example.com", UUID: uuid.NewString()}
+	require.NoError(t, shortener.NewService(repo).Save(ctx, url))
+
+	flag := domain.Moderation{Status: domain.ModerationFlagged, Reason: domain.ReasonBlocklist, Actor: "blocklist"}
+	_, err := repo.Moderate(ctx, "missing", flag)
+	assert.ErrorIs(t, err, domain.ErrURLNotFound)
+	_, err = repo.Moderate(ctx, url.ShortURL, flag)
+	require.NoError(t, err)
+	_, err = repo.Moderate(ctx, url.ShortURL, flag)
+	assert.ErrorIs(t, err, domain.ErrModerationTransition)
+	_, err = repo.Moderate(ctx, url.ShortURL, domain.Moderation{Status: domain.ModerationBlocked, Reason: domain.ReasonAdminReview, Actor: "admin"})
+	require.NoError(t, err)
+
+	found, err := repo.Find(ctx, url.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, domain.ModerationBlocked, found.Moderation)
+	current, history, err := repo.Moderation(ctx, url.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, "admin", current.Actor)
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, domain.ModerationClean, history[0].From)
+		assert.Equal(t, domain.ModerationFlagged, history[1].From)
+	}
+	blocked, err := repo.ModeratedLinks(ctx, domain.ModerationBlocked)
+	require.NoError(t, err)
+	if assert.Len(t, blocked, 1) {
+		assert.Equal(t, url.UUID, blocked[0].UserID)
+	}
+}
+
+func TestPostgreAliases(t *testing.T) {
+	checkAliases(t, openPostgres(t), uuid.NewString(), uuid.NewString())
+}
+
+func TestPostgreExpiredLinks(t *testing.T) {
+	repo := openPostgres(t)
+	ctx := context.Background()
+	alice := uuid.NewString()
+	now := time.Now()
+	expiresAt := now.Add(time.Hour).UTC().Truncate(time.Microsecond)
+	expiring := &domain.URL{UUID: alice, OriginalURL: "https://example.com/expiring", ExpiresAt: &expiresAt}
+	require.NoError(t, shortener.NewService(repo).Save(ctx, expiring))
+
+	found, err := repo.Find(ctx, expiring.ShortURL)
+	require.NoError(t, err)
+	require.NotNil(t, found.ExpiresAt)
+	assert.True(t, found.ExpiresAt.Equal(expiresAt))
+
+	purged, err := repo.PurgeExpiredLinks(ctx, now)
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+	purged, err = repo.PurgeExpiredLinks(ctx, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.True(t, linkOwner(t, repo, expiring.ShortURL).IsDeleted, "expired links are soft-deleted")
+}
+
+func TestPostgreVisits(t *testing.T) {
+	repo := openPostgres(t)
+	ctx := context.Background()
+	alice := uuid.NewString()
+	url := &domain.URL{UUID: alice, OriginalURL: "https://example.com/visited"}
+	require.NoError(t, shortener.NewService(repo).Save(ctx, url))
+
+	stats, err := repo.LinkStats(ctx, alice, url.ShortURL)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Visits)
+	assert.Nil(t, stats.LastVisitedAt)
+	for range 2 {
+		require.NoError(t, repo.IncrementVisit(ctx, url.ShortURL))
+	}
+	assert.ErrorIs(t, repo.IncrementVisit(ctx, "unknown"), domain.ErrURLNotFound)
+
+	_, err = repo.Archive(ctx, time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, repo.IncrementVisit(ctx, url.ShortURL), "archived links are counted too")
+	stats, err = repo.LinkStats(ctx, alice, url.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Visits)
+	assert.NotNil(t, stats.LastVisitedAt)
+	_, err = repo.LinkStats(ctx, uuid.NewString(), url.ShortURL)
+	assert.ErrorIs(t, err, domain.ErrURLNotFound)
+}
+
+func TestPostgreStats(t *testing.T) {
+	repo := openPostgres(t)
+	ctx := context.Background()
+	alice, bob, carol, dave := uuid.NewString(), uuid.NewString(), uuid.NewString(), uuid.NewString()
+	save := func(owner, longURL string) *domain.URL {
+		url := domain.NewURL(longURL)
+		url.UUID = owner
+		require.NoError(t, shortener.NewService(repo).Save(ctx, url))
+		return url
+	}
+	save(alice, "https://a1.example.com")
+	deleted := save(alice, "https://a2.example.com")
+	archived := save(bob, "https://b1.example.com")
+	gone := save(dave, "https://d1.example.com")
+	require.NoError(t, repo.Reserve(ctx, carol, "launch", time.Hour))
+	_, err := repo.BatchDelete(ctx, map[string][]string{alice: {deleted.ShortURL}, dave: {gone.ShortURL}})
+	require.NoError(t, err)
+	repo.Database.MustExec("UPDATE urls SET created_at = $1 WHERE short_url = $2", time.Now().Add(-48*time.Hour), archived.ShortURL)
+	moved, err := repo.Archive(ctx, time.Now().Add(-24*time.Hour), time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 1, moved)
+
+	stats, err := repo.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, domain.Stats{URLs: 2, Users: 2}, stats,
+		"archived links count, deleted links and reservations do not")
+}
+
+func TestPostgreArchiveKeepsVisitedLinks(t *testing.T) {
+	repo := openPostgres(t)
+	ctx := context.Background()
+	alice := uuid.NewString()
+	visited := &domain.URL{UUID: alice, OriginalURL: "https://example.com/visited"}
+	idle := &domain.URL{UUID: alice, OriginalURL: "https://example.com/idle"}
+	stale := &domain.URL{UUID: alice, OriginalURL: "https://example.com/stale"}
+	for _, url := range []*domain.URL{visited, idle, stale} {
+		require.NoError(t, shortener.NewService(repo).Save(ctx, url))
+	}
+	require.NoError(t, repo.IncrementVisit(ctx, visited.ShortURL))
+	require.NoError(t, repo.IncrementVisit(ctx, stale.ShortURL))
+	repo.Database.MustExec("UPDATE url_visits SET last_visited_at = $1 WHERE short_url = $2",
+		time.Now().Add(-48*time.Hour), stale.ShortURL)
+
+	moved, err := repo.Archive(ctx, time.Now().Add(time.Hour), time.Now().Add(-24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, moved, "links never visited or not visited lately are archived")
+	for url, archived := range map[*domain.URL]bool{visited: false, idle: true, stale: true} {
+		found, err := repo.Find(ctx, url.ShortURL)
+		require.NoError(t, err)
+		assert.Equal(t, archived, found.Archived, url.OriginalURL)
+	}
+}
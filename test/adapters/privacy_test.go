@@ -0,0 +1,177 @@
+package adapters_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+)
+
+func newPrivacyEnv(t *testing.T, cfg *configs.Config, users ...string) (*reservationEnv, *adapters.InMemoryURLRepository) {
+	t.Helper()
+	repo, _ := newReservationRepo(t)
+	router := setupRouter()
+	api := adapters.NewRestAPI(repo, router, cfg)
+	require.NoError(t, api.RegisterRoutes())
+	env := &reservationEnv{router: router, tokens: make(map[string]string)}
+	for _, user := range users {
+		env.tokens[user] = buildToken(t, cfg, user)
+	}
+	return env, repo
+}
+
+func saveWithPrivacy(t *testing.T, repo *adapters.InMemoryURLRepository, user, originalURL string, privacy domain.Privacy) string {
+	t.Helper()
+	url := &domain.URL{OriginalURL: originalURL, UUID: user, Privacy: privacy}
+	require.NoError(t, shortener.NewService(repo).Save(context.Background(), url))
+	return url.ShortURL
+}
+
+func TestRedirectPrivacy(t *testing.T) {
+	tests := []struct {
+		name          string
+		global        string
+		link          domain.Privacy
+		originalURL   string
+		expectedCode  int
+		expectedRefer string
+	}{
+		{"Off by default", "", domain.PrivacyDefault, "https://example.com", http.StatusTemporaryRedirect, ""},
+		{"Global no-referrer", "no-referrer", domain.PrivacyDefault, "https://example.com", http.StatusTemporaryRedirect, "no-referrer"},
+		{"Global dereferer", "dereferer", domain.PrivacyDefault, "https://example.com", http.StatusOK, "no-referrer"},
+		{"Unknown global is off", "hidden", domain.PrivacyDefault, "https://example.com", http.StatusTemporaryRedirect, ""},
+		{"Link overrides global", "dereferer", domain.PrivacyOff, "https://example.com", http.StatusTemporaryRedirect, ""},
+		{"Link no-referrer", "off", domain.PrivacyNoReferrer, "https://example.com", http.StatusTemporaryRedirect, "no-referrer"},
+		{"Link dereferer", "no-referrer", domain.PrivacyDereferer, "https://example.com", http.StatusOK, "no-referrer"},
+		{"Dereferer only for http", "dereferer", domain.PrivacyDefault, "ftp://example.com/file", http.StatusTemporaryRedirect, "no-referrer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := getConfig(t)
+			cfg.Redirect.Privacy = tt.global
+			env, repo := newPrivacyEnv(t, cfg)
+			code := saveWithPrivacy(t, repo, "user-1", tt.originalURL, tt.link)
+
+			w := env.do(http.MethodGet, "/api/"+code, "", "")
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedRefer, w.Header().Get("Referrer-Policy"))
+			if tt.expectedCode == http.StatusOK {
+				body := w.Body.String()
+				assert.Contains(t, body, `<meta name="referrer" content="no-referrer">`)
+				assert.Contains(t, body, `href="`+tt.originalURL+`" rel="noopener noreferrer"`)
+				assert.Empty(t, w.Header().Get("Location"))
+			} else {
+				assert.Equal(t, tt.originalURL, w.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestRedirectCodeAndCaching(t *testing.T) {
+	tests := []struct {
+		name         string
+		code         int
+		maxAge       time.Duration
+		expectedCode int
+		cacheControl string
+	}{
+		{"Default", 0, 0, http.StatusTemporaryRedirect, "no-store"},
+		{"301", http.StatusMovedPermanently, 0, http.StatusMovedPermanently, "no-store"},
+		{"302", http.StatusFound, 0, http.StatusFound, "no-store"},
+		{"307", http.StatusTemporaryRedirect, 0, http.StatusTemporaryRedirect, "no-store"},
+		{"308", http.StatusPermanentRedirect, 0, http.StatusPermanentRedirect, "no-store"},
+		{"Max age", http.StatusMovedPermanently, 90 * time.Second, http.StatusMovedPermanently, "max-age=90"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := getConfig(t)
+			cfg.Server.RedirectCode = tt.code
+			cfg.Server.RedirectMaxAge = tt.maxAge
+			env, repo := newPrivacyEnv(t, cfg)
+			code := saveWithPrivacy(t, repo, "user-1", "https://example.com", domain.PrivacyDefault)
+
+			w := env.do(http.MethodGet, "/api/"+code, "", "")
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, "https://example.com", w.Header().Get("Location"))
+			assert.Equal(t, tt.cacheControl, w.Header().Get("Cache-Control"))
+		})
+	}
+
+	cfg := getConfig(t)
+	cfg.Redirect.Privacy = "dereferer"
+	env, repo := newPrivacyEnv(t, cfg)
+	code := saveWithPrivacy(t, repo, "user-1", "https://example.com", domain.PrivacyDefault)
+	w := env.do(http.MethodGet, "/api/"+code, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"), "the dereferer page is not cached either")
+}
+
+func TestUpdateLinkPrivacy(t *testing.T) {
+	cfg := getConfig(t)
+	cfg.Redirect.Privacy = "no-referrer"
+	env, repo := newPrivacyEnv(t, cfg, "user-1", "user-2")
+
+	w := env.do(http.MethodPost, "/api/shorten", "user-1", `{"longURL":"https://example.com","privacy":"dereferer"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct{ Result string }
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	code := created.Result[strings.LastIndex(created.Result, "/")+1:]
+	found, err := repo.Find(context.Background(), code)
+	require.NoError(t, err)
+	assert.Equal(t, domain.PrivacyDereferer, found.Privacy)
+
+	link := "/api/user/urls/" + code
+	tests := []struct {
+		name         string
+		user         string
+		body         string
+		expectedCode int
+		expectedBody string
+	}{
+		{"Unknown mode", "user-1", `{"privacy":"hidden"}`, http.StatusBadRequest, "privacy"},
+		{"No mode", "user-1", `{}`, http.StatusBadRequest, "privacy"},
+		{"Someone else's link", "user-2", `{"privacy":"off"}`, http.StatusNotFound, ""},
+		{"Turn off", "user-1", `{"privacy":"off"}`, http.StatusOK, `"privacy":"off"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := env.do(http.MethodPatch, link, tt.user, tt.body)
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.expectedBody)
+		})
+	}
+	w = env.do(http.MethodGet, "/api/"+code, "", "")
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Empty(t, w.Header().Get("Referrer-Policy"), "the link overrides the global default")
+
+	require.Equal(t, http.StatusOK, env.do(http.MethodPatch, link, "user-1", `{"privacy":""}`).Code)
+	w = env.do(http.MethodGet, "/api/"+code, "", "")
+	assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"), "back to the global default")
+
+	w = env.do(http.MethodPost, "/api/shorten", "user-1", `{"longURL":"https://example.org","privacy":"hidden"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPrivacySurvivesRestart(t *testing.T) {
+	repo, path := newReservationRepo(t)
+	ctx := context.Background()
+	code := saveWithPrivacy(t, repo, "user-1", "https://example.com", domain.PrivacyNoReferrer)
+	require.NoError(t, repo.SetPrivacy(ctx, "user-1", code, domain.PrivacyDereferer))
+	assert.ErrorIs(t, repo.SetPrivacy(ctx, "user-1", "missing", domain.PrivacyOff), domain.ErrURLNotFound)
+
+	reloaded, err := adapters.NewInMemoryURLRepository(path)
+	require.NoError(t, err)
+	found, err := reloaded.Find(ctx, code)
+	require.NoError(t, err)
+	assert.Equal(t, domain.PrivacyDereferer, found.Privacy)
+}
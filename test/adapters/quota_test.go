@@ -0,0 +1,152 @@
+package adapters_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/events"
+	"github.com/OrtemRepos/shortlink/internal/quota"
+)
+
+// quotaRepo deletes links for real, unlike the in-memory repository, and counts
+// how often links are counted.
+type quotaRepo struct {
+	*adapters.InMemoryURLRepository
+	mu      sync.Mutex
+	deleted map[string]bool
+	counts  atomic.Int64
+}
+
+func (r *quotaRepo) BatchDelete(_ context.Context, ids map[string][]string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, shortURLs := range ids {
+		for _, short := range shortURLs {
+			r.deleted[short] = true
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *quotaRepo) CountByUser(ctx context.Context, userID string) (int, error) {
+	r.counts.Add(1)
+	links, err := r.ExportByUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, link := range links {
+		if !r.deleted[link.ShortURL] {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func shortenAs(router *gin.Engine, token, longURL string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"longURL":"`+longURL+`"}`))
+	req.AddCookie(&http.Cookie{Name: "auth", Value: token})
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestQuotaWarningsAndLimit(t *testing.T) {
+	inMemory, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+	require.NoError(t, err)
+	repo := &quotaRepo{InMemoryURLRepository: inMemory, deleted: make(map[string]bool)}
+	cfg := getConfig(t)
+	cfg.Quota.MaxLinks = 5
+	cfg.Quota.WarnPercent = 80
+	router := setupRouter()
+	api := adapters.NewRestAPI(repo, router, cfg)
+	require.NoError(t, api.RegisterRoutes())
+	var warnings []events.Event
+	api.Events().Subscribe(func(e events.Event) {
+		if e.Type == events.QuotaWarning {
+			warnings = append(warnings, e)
+		}
+	})
+	token := buildToken(t, cfg, "user-1")
+
+	for i, remaining := range []string{"4", "3", "2"} {
+		w := shortenAs(router, token, "https://example.com/"+string(rune('a'+i)))
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		assert.Equal(t, remaining, w.Header().Get("X-Quota-Remaining"))
+		assert.NotContains(t, w.Body.String(), "warnings")
+	}
+	assert.Empty(t, warnings)
+
+	w := shortenAs(router, token, "https://example.com/d")
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Quota-Remaining"))
+	assert.Contains(t, w.Body.String(), `"warnings":["4 of your 5 links are used"]`)
+	require.Len(t, warnings, 1, "the threshold was crossed")
+	assert.Equal(t, "user-1", warnings[0].UserID)
+	assert.Equal(t, map[string]string{"used": "4", "limit": "5"}, warnings[0].Attrs)
+
+	w = shortenAs(router, token, "https://example.com/a")
+	assert.Equal(t, http.StatusConflict, w.Code, "an existing link takes no quota")
+	w = shortenAs(router, token, "https://example.com/e")
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-Quota-Remaining"))
+	assert.Len(t, warnings, 1, "already warned")
+
+	w = shortenAs(router, token, "https://example.com/f")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Link quota exceeded")
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "/api/batch_shorten", bytes.NewBufferString(`{"x":"https://example.com/x"}`))
+	req.AddCookie(&http.Cookie{Name: "auth", Value: token})
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, http.StatusCreated, shortenAs(router, buildToken(t, cfg, "user-2"), "https://example.com/f").Code,
+		"other users have their own quota")
+
+	usage := getUsage(t, router, token)
+	assert.Equal(t, quota.Usage{Used: 5, Limit: 5, WarnAt: 4, Warning: true}, usage)
+	assert.Equal(t, int64(2), repo.counts.Load(), "links are counted once per user")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest(http.MethodPost, "/api/user/urls/delete_by_filter",
+		bytes.NewBufferString(`{"url_prefix":"https://example.com/"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "auth", Value: token})
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, 5, getUsage(t, router, token).Used, "not deleted until flushed")
+
+	require.NoError(t, api.Shutdown(context.Background()))
+	assert.Equal(t, quota.Usage{Used: 0, Limit: 5, Remaining: 5, WarnAt: 4}, getUsage(t, router, token))
+	assert.Equal(t, http.StatusCreated, shortenAs(router, token, "https://example.com/g").Code, "deletions freed the quota")
+}
+
+func getUsage(t *testing.T, router *gin.Engine, token string) quota.Usage {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/api/user/usage", nil)
+	req.AddCookie(&http.Cookie{Name: "auth", Value: token})
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var usage quota.Usage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &usage))
+	assert.Equal(t, w.Header().Get("X-Quota-Remaining"), strconv.Itoa(usage.Remaining))
+	return usage
+}
@@ -0,0 +1,109 @@
+package adapters_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/clock"
+)
+
+func TestAPIRateLimitedPerUser(t *testing.T) {
+	fake := clock.NewFake(time.Now().Truncate(time.Second))
+	cfg := getConfig(t)
+	cfg.RateLimit.Rate, cfg.RateLimit.Burst = 1, 2
+	repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+	require.NoError(t, err)
+	router := setupRouter()
+	registry := prometheus.NewRegistry()
+	api := adapters.NewRestAPI(repo, router, cfg, adapters.WithClock(fake), adapters.WithPrometheus(registry))
+	require.NoError(t, api.RegisterRoutes())
+	env := &reservationEnv{router: router, tokens: map[string]string{
+		"alice": buildToken(t, cfg, "alice"),
+		"bob":   buildToken(t, cfg, "bob"),
+	}}
+	shorten := func(user string, i int) int {
+		return env.do(http.MethodPost, "/api/shorten", user, fmt.Sprintf(`{"longURL":"https://example.com/%s/%d"}`, user, i)).Code
+	}
+
+	require.Equal(t, http.StatusCreated, shorten("alice", 1))
+	require.Equal(t, http.StatusCreated, shorten("alice", 2))
+	w := env.do(http.MethodPost, "/api/shorten", "alice", `{"longURL":"https://example.com/alice/3"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusCreated, shorten("bob", 1), "other users have their own budget")
+
+	fake.Advance(time.Second)
+	assert.Equal(t, http.StatusCreated, shorten("alice", 3), "a token refilled")
+	assert.Equal(t, http.StatusTooManyRequests, shorten("alice", 4))
+
+	assert.Equal(t, map[string]float64{"user/allowed": 4, "user/rejected": 2}, rateLimitCounts(t, registry))
+}
+
+func TestAPIRateLimitedPerIP(t *testing.T) {
+	fake := clock.NewFake(time.Now().Truncate(time.Second))
+	cfg := getConfig(t)
+	cfg.RateLimit.IPRate, cfg.RateLimit.IPBurst = 1, 2
+	repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+	require.NoError(t, err)
+	router := setupRouter()
+	registry := prometheus.NewRegistry()
+	api := adapters.NewRestAPI(repo, router, cfg, adapters.WithClock(fake), adapters.WithPrometheus(registry))
+	require.NoError(t, api.RegisterRoutes())
+	do := func(method, path, remote, forwarded string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = remote + ":1234"
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+			req.Header.Set("X-Real-IP", forwarded)
+		}
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/user/urls", "192.0.2.1", ""))
+	require.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/user/urls", "192.0.2.1", "198.51.100.1"))
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodGet, "/api/user/urls", "192.0.2.1", "198.51.100.2"),
+		"anonymous requests are limited before auth, and forwarding headers of untrusted peers are ignored")
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "/login", "192.0.2.1", ""),
+		"logins share the budget of the IP")
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/login", "192.0.2.2", ""))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/login", "192.0.2.2", ""))
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "/login", "192.0.2.2", ""),
+		"an IP cannot mint users, with fresh budgets, at will")
+
+	fake.Advance(time.Second)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/login", "192.0.2.2", ""), "a token refilled")
+	assert.Equal(t, map[string]float64{"ip/allowed": 5, "ip/rejected": 3}, rateLimitCounts(t, registry))
+}
+
+// rateLimitCounts returns the rate limit counters of registry by client kind and result.
+func rateLimitCounts(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	t.Helper()
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	counts := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "shortlink_rate_limit_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			counts[labels["client"]+"/"+labels["result"]] = metric.GetCounter().GetValue()
+		}
+	}
+	return counts
+}
@@ -1,11 +1,19 @@
 package adapters_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/OrtemRepos/shortlink/internal/adapters"
 	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/encryption"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
 )
 
 func getRepository() *adapters.InMemoryURLRepository {
@@ -26,7 +34,7 @@ func TestCreateRepository(t *testing.T) {
 func TestSave(t *testing.T) {
 	repo := getRepository()
 	url := domain.NewURL("https://github.com")
-	err := repo.Save(context.TODO(), url)
+	err := shortener.NewService(repo).Save(context.TODO(), url)
 	if err != domain.ErrURLAlreadyExists && err != nil {
 		t.Errorf("Expected %v, got %v", nil, err)
 	}
@@ -42,7 +50,7 @@ func TestSave(t *testing.T) {
 func TestSaveAlredyExist(t *testing.T) {
 	repo := getRepository()
 	url := domain.NewURL("https://github.com")
-	if err := repo.Save(context.TODO(), url); err != domain.ErrURLAlreadyExists {
+	if err := shortener.NewService(repo).Save(context.TODO(), url); err != domain.ErrURLAlreadyExists {
 		t.Errorf("Expected %v, got %v", domain.ErrURLAlreadyExists, err)
 	}
 }
@@ -50,7 +58,7 @@ func TestSaveAlredyExist(t *testing.T) {
 func TestFind(t *testing.T) {
 	repo := getRepository()
 	url := domain.NewURL("https://github.com")
-	err := repo.Save(context.TODO(), url)
+	err := shortener.NewService(repo).Save(context.TODO(), url)
 	if err != nil && err != domain.ErrURLAlreadyExists {
 		t.Errorf("Expected %v, got %v", nil, err)
 	}
@@ -72,9 +80,9 @@ func TestFindNotExist(t *testing.T) {
 func TestIndempotencySave(t *testing.T) {
 	repo := getRepository()
 	url := domain.NewURL("https://github.com")
-	_ = repo.Save(context.TODO(), url)
+	_ = shortener.NewService(repo).Save(context.TODO(), url)
 	firstShortURL := &url.ShortURL
-	_ = repo.Save(context.TODO(), url)
+	_ = shortener.NewService(repo).Save(context.TODO(), url)
 	secondShortURL := &url.ShortURL
 	if firstShortURL != secondShortURL {
 		t.Errorf("Expected firstSortURL=%v and secondShortURL=%v not equal", firstShortURL, secondShortURL)
@@ -83,3 +91,407 @@ func TestIndempotencySave(t *testing.T) {
 		t.Errorf("Expected %v, got %v", 1, len(repo.GetAll()))
 	}
 }
+
+func TestArchiveFallThrough(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	repo, err := adapters.NewInMemoryURLRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := domain.NewURL("https://example.com/old")
+	if err := shortener.NewService(repo).Save(context.TODO(), url); err != nil {
+		t.Fatal(err)
+	}
+
+	moved, err := repo.Archive(context.TODO(), time.Now().Add(time.Hour), time.Now())
+	if err != nil || moved != 1 {
+		t.Fatalf("Expected 1 archived link, got %d (%v)", moved, err)
+	}
+	if len(repo.GetAll()) != 0 {
+		t.Errorf("Expected hot store to be empty, got %v", repo.GetAll())
+	}
+
+	repo, err = adapters.NewInMemoryURLRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := repo.Find(context.TODO(), url.ShortURL)
+	if err != nil {
+		t.Fatalf("Expected archived link to resolve, got %v", err)
+	}
+	if !found.Archived || found.OriginalURL != url.OriginalURL {
+		t.Errorf("Expected archived %s, got %+v", url.OriginalURL, found)
+	}
+
+	restored, err := repo.Unarchive(context.TODO(), []string{url.ShortURL, "missing"})
+	if err != nil || restored != 1 {
+		t.Fatalf("Expected 1 restored link, got %d (%v)", restored, err)
+	}
+	found, err = repo.Find(context.TODO(), url.ShortURL)
+	if err != nil || found.Archived {
+		t.Errorf("Expected restored link in hot store, got %+v (%v)", found, err)
+	}
+}
+
+func TestArchiveKeepsVisitedLinks(t *testing.T) {
+	repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "urls.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	visited := domain.NewURL("https://example.com/visited")
+	idle := domain.NewURL("https://example.com/idle")
+	for _, url := range []*domain.URL{visited, idle} {
+		if err := shortener.NewService(repo).Save(context.TODO(), url); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.IncrementVisit(context.TODO(), visited.ShortURL); err != nil {
+		t.Fatal(err)
+	}
+
+	moved, err := repo.Archive(context.TODO(), time.Now().Add(time.Hour), time.Now().Add(-time.Hour))
+	if err != nil || moved != 1 {
+		t.Fatalf("Expected 1 archived link, got %d (%v)", moved, err)
+	}
+	if _, ok := repo.GetAll()[visited.ShortURL]; !ok {
+		t.Errorf("Expected the visited link %s to stay hot", visited.ShortURL)
+	}
+	if _, ok := repo.GetAll()[idle.ShortURL]; ok {
+		t.Errorf("Expected the idle link %s to be archived", idle.ShortURL)
+	}
+
+	moved, err = repo.Archive(context.TODO(), time.Now().Add(time.Hour), time.Now().Add(time.Hour))
+	if err != nil || moved != 1 {
+		t.Fatalf("Expected the visited link archived once idle, got %d (%v)", moved, err)
+	}
+}
+
+func TestArchiveRehydrate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	repo, err := adapters.NewInMemoryURLRepository(path, adapters.WithRehydrate(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := domain.NewURL("https://example.com/hot-again")
+	if err := shortener.NewService(repo).Save(context.TODO(), url); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Archive(context.TODO(), time.Now().Add(time.Hour), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := repo.Find(context.TODO(), url.ShortURL)
+	if err != nil || found.Archived {
+		t.Fatalf("Expected rehydrated link, got %+v (%v)", found, err)
+	}
+	if _, ok := repo.GetAll()[url.ShortURL]; !ok {
+		t.Errorf("Expected %s back in the hot store", url.ShortURL)
+	}
+}
+
+func TestLoadLegacyFlatFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	if err := os.WriteFile(path, []byte(`{"abc12345": "https://legacy.example.com"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := adapters.NewInMemoryURLRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := repo.Find(context.TODO(), "abc12345")
+	if err != nil || found.OriginalURL != "https://legacy.example.com" {
+		t.Errorf("Expected legacy entry, got %+v (%v)", found, err)
+	}
+}
+
+func newKeyring(t *testing.T, primary string) *encryption.Keyring {
+	t.Helper()
+	kr, err := encryption.NewKeyring(map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 32),
+	}, primary, bytes.Repeat([]byte{3}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kr
+}
+
+func TestEncryptedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	repo, err := adapters.NewInMemoryURLRepository(path, adapters.WithKeyring(newKeyring(t, "k1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := domain.NewURL("https://secret.example.com")
+	if err := shortener.NewService(repo).Save(context.TODO(), url); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret.example.com")) {
+		t.Errorf("Expected no plaintext in %s", data)
+	}
+
+	repo, err = adapters.NewInMemoryURLRepository(path, adapters.WithKeyring(newKeyring(t, "k1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, err := repo.Find(context.TODO(), url.ShortURL); err != nil || found.OriginalURL != url.OriginalURL {
+		t.Errorf("Expected %s, got %v (%v)", url.OriginalURL, found, err)
+	}
+	dup := domain.NewURL("https://secret.example.com")
+	if err := shortener.NewService(repo).Save(context.TODO(), dup); err != domain.ErrURLAlreadyExists || dup.ShortURL != url.ShortURL {
+		t.Errorf("Expected %v with %s, got %v with %s", domain.ErrURLAlreadyExists, url.ShortURL, err, dup.ShortURL)
+	}
+}
+
+func TestReencryptRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	if err := os.WriteFile(path, []byte(`{"legacy":"https://plain.example.com"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := adapters.NewInMemoryURLRepository(path, adapters.WithKeyring(newKeyring(t, "k1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shortener.NewService(repo).Save(context.TODO(), domain.NewURL("https://old.example.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err = adapters.NewInMemoryURLRepository(path, adapters.WithKeyring(newKeyring(t, "k2")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := repo.Reencrypt(context.TODO(), 100); err != nil || n != 2 {
+		t.Fatalf("Expected 2 re-encrypted, got %d (%v)", n, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("enc:v1:k1:")) || bytes.Contains(data, []byte("plain.example.com")) {
+		t.Errorf("Expected only k2 ciphertexts in %s", data)
+	}
+
+	onlyNew, err := encryption.NewKeyring(map[string][]byte{"k2": bytes.Repeat([]byte{2}, 32)}, "k2", bytes.Repeat([]byte{3}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err = adapters.NewInMemoryURLRepository(path, adapters.WithKeyring(onlyNew))
+	if err != nil {
+		t.Fatalf("Expected file readable without the retired key, got %v", err)
+	}
+	if found, err := repo.Find(context.TODO(), "legacy"); err != nil || found.OriginalURL != "https://plain.example.com" {
+		t.Errorf("Expected legacy link, got %v (%v)", found, err)
+	}
+}
+
+func TestReassignOwner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	repo, err := adapters.NewInMemoryURLRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hot := domain.NewURL("https://hot.example.com")
+	hot.UUID = "source"
+	old := domain.NewURL("https://old.example.com")
+	old.UUID = "source"
+	other := domain.NewURL("https://other.example.com")
+	other.UUID = "someone"
+	if err := shortener.NewService(repo).BatchSave(context.TODO(), []*domain.URL{old, hot, other}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Archive(context.TODO(), old.CreatedAt.Add(time.Nanosecond), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := repo.ReassignOwner(context.TODO(), "source", "target"); err != nil || n != 2 {
+		t.Fatalf("Expected 2 moved, got %d (%v)", n, err)
+	}
+	if n, err := repo.ReassignOwner(context.TODO(), "source", "target"); err != nil || n != 0 {
+		t.Errorf("Expected a repeated merge to move nothing, got %d (%v)", n, err)
+	}
+
+	repo, err = adapters.NewInMemoryURLRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for short, owner := range map[string]string{hot.ShortURL: "target", old.ShortURL: "target", other.ShortURL: "someone"} {
+		found, err := repo.Find(context.TODO(), short)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.UUID != owner {
+			t.Errorf("Expected %s owned by %s, got %s", short, owner, found.UUID)
+		}
+	}
+}
+
+func TestLegacyOwnerBackfill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	legacy := `{
+		"flat0001": "https://flat.example.com",
+		"record01": {"original_url": "https://record.example.com", "created_at": "2020-01-01T00:00:00Z"},
+		"owned001": {"original_url": "https://owned.example.com", "user_id": "someone", "created_at": "2020-01-01T00:00:00Z"}
+	}`
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := adapters.NewInMemoryURLRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, err := repo.LegacyLinks(context.TODO())
+	if err != nil || len(links) != 2 || links[0].ShortURL != "flat0001" || links[1].ShortURL != "record01" {
+		t.Fatalf("Expected the two ownerless links, got %+v (%v)", links, err)
+	}
+	if links[0].UUID != domain.LegacyOwner {
+		t.Errorf("Expected legacy owner, got %s", links[0].UUID)
+	}
+
+	sentinel := domain.NewURL("https://new.example.com")
+	sentinel.UUID = domain.LegacyOwner
+	if err := repo.Save(context.TODO(), sentinel); err != domain.ErrOwnerRequired {
+		t.Errorf("Expected %v, got %v", domain.ErrOwnerRequired, err)
+	}
+
+	claimed, err := repo.ClaimLegacy(context.TODO(), "claimer", []string{"flat0001", "owned001", "missing"})
+	if err != nil || claimed != 1 {
+		t.Fatalf("Expected 1 claimed link, got %d (%v)", claimed, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(`"version": 2`)) {
+		t.Errorf("Expected a versioned save file, got %s", data)
+	}
+	repo, err = adapters.NewInMemoryURLRepository(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for short, owner := range map[string]string{"flat0001": "claimer", "record01": domain.LegacyOwner, "owned001": "someone"} {
+		found, err := repo.Find(context.TODO(), short)
+		if err != nil || found.UUID != owner {
+			t.Errorf("Expected %s owned by %s, got %+v (%v)", short, owner, found, err)
+		}
+	}
+}
+
+func TestUnsupportedFileVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.json")
+	if err := os.WriteFile(path, []byte(`{"version": 99, "urls": {}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := adapters.NewInMemoryURLRepository(path); !errors.Is(err, adapters.ErrUnsupportedFormat) {
+		t.Errorf("Expected %v, got %v", adapters.ErrUnsupportedFormat, err)
+	}
+}
+
+func TestFindByUserAndHost(t *testing.T) {
+	repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "urls.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := []*domain.URL{
+		{OriginalURL: "https://old-domain.com/a", ShortURL: "a", UUID: "user"},
+		{OriginalURL: "https://cdn.old-domain.com/b", ShortURL: "b", UUID: "user"},
+		{OriginalURL: "https://new-domain.com/c", ShortURL: "c", UUID: "user"},
+		{OriginalURL: "https://old-domain.com/d", ShortURL: "d", UUID: "someone"},
+	}
+	if err := shortener.NewService(repo).BatchSave(context.TODO(), links); err != nil {
+		t.Fatal(err)
+	}
+	filter := domain.URLFilter{HostSuffix: "old-domain.com"}
+	if err := filter.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	found, err := repo.FindByUserAndHost(context.TODO(), "user", filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0] != "a" || found[1] != "b" {
+		t.Errorf("Expected [a b], got %v", found)
+	}
+}
+
+// checkAliases saves links under codes their owners chose and checks repo keeps
+// the code and refuses it to another link.
+func checkAliases(t *testing.T, repo ports.URLRepositoryPort, alice, bob string) {
+	t.Helper()
+	ctx := context.Background()
+	service := shortener.NewService(repo)
+
+	url := &domain.URL{UUID: alice, OriginalURL: "https://example.com/promo", Alias: "promo-2024", ShortURL: "promo-2024"}
+	if err := service.Save(ctx, url); err != nil {
+		t.Fatalf("Expected %v, got %v", nil, err)
+	}
+	if url.ShortURL != "promo-2024" {
+		t.Errorf("Expected %s, got %s", "promo-2024", url.ShortURL)
+	}
+	if found, err := repo.Find(ctx, "promo-2024"); err != nil || found.OriginalURL != url.OriginalURL {
+		t.Errorf("Expected %s, got %v, %v", url.OriginalURL, found, err)
+	}
+
+	taken := &domain.URL{UUID: bob, OriginalURL: "https://bob.example.com", Alias: "promo-2024", ShortURL: "promo-2024"}
+	if err := service.Save(ctx, taken); !errors.Is(err, domain.ErrShortURLTaken) {
+		t.Errorf("Expected %v, got %v", domain.ErrShortURLTaken, err)
+	}
+	if found, err := repo.Find(ctx, "promo-2024"); err != nil || found.UUID != alice {
+		t.Errorf("Expected the alias to stay with its owner, got %v, %v", found, err)
+	}
+}
+
+func TestSaveAlias(t *testing.T) {
+	repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkAliases(t, repo, "alice", "bob")
+}
+
+func TestStats(t *testing.T) {
+	repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "urls.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var links []*domain.URL
+	for longURL, owner := range map[string]string{
+		"https://a1.example.com": "alice",
+		"https://a2.example.com": "alice",
+		"https://b1.example.com": "bob",
+	} {
+		url := domain.NewURL(longURL)
+		url.UUID = owner
+		links = append(links, url)
+	}
+	if err := shortener.NewService(repo).BatchSave(context.TODO(), links); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Archive(context.TODO(), time.Now().Add(time.Hour), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Reserve(context.TODO(), "carol", "launch", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := shortener.NewService(repo).Save(context.TODO(), &domain.URL{OriginalURL: "https://c1.example.com", UUID: "carol"}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := repo.Stats(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (domain.Stats{URLs: 4, Users: 3}); stats != want {
+		t.Errorf("Expected %+v, got %+v", want, stats)
+	}
+	if err := repo.Reserve(context.TODO(), "dave", "soon", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if stats, _ := repo.Stats(context.TODO()); stats.Users != 3 {
+		t.Errorf("Expected reservations to leave the users out, got %+v", stats)
+	}
+}
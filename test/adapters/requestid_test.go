@@ -0,0 +1,111 @@
+package adapters_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/logger"
+	"github.com/OrtemRepos/shortlink/internal/requestid"
+)
+
+// brokenDeleteRepo fails every deletion.
+type brokenDeleteRepo struct {
+	*adapters.InMemoryURLRepository
+}
+
+func (brokenDeleteRepo) BatchDelete(context.Context, map[string][]string) (int, error) {
+	return 0, errors.New("database is down")
+}
+
+func TestRequestID(t *testing.T) {
+	mem, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+	require.NoError(t, err)
+	core, logs := observer.New(zapcore.InfoLevel)
+	cfg := getConfig(t)
+	router := setupRouter()
+	router.Use(logger.LoggerMiddleware(zap.New(core)))
+	api := adapters.NewRestAPI(brokenDeleteRepo{mem}, router, cfg, adapters.WithLogger(zap.New(core)))
+	require.NoError(t, api.RegisterRoutes())
+	token := buildToken(t, cfg, "user-1")
+	do := func(method, path, id, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if id != "" {
+			req.Header.Set(requestid.Header, id)
+		}
+		req.AddCookie(&http.Cookie{Name: "auth", Value: token})
+		router.ServeHTTP(w, req)
+		return w
+	}
+	// loggedIDs returns the request IDs of the request log entries for path.
+	loggedIDs := func(path string) []any {
+		var ids []any
+		for _, entry := range logs.FilterMessage("request").All() {
+			if entry.ContextMap()["path"] == path {
+				ids = append(ids, entry.ContextMap()["request_id"])
+			}
+		}
+		return ids
+	}
+
+	t.Run("Round trip", func(t *testing.T) {
+		w := do(http.MethodGet, "/api/user/urls", "trace-42", "")
+		assert.Equal(t, "trace-42", w.Header().Get(requestid.Header))
+		assert.Equal(t, []any{"trace-42"}, loggedIDs("/api/user/urls"))
+	})
+
+	t.Run("Generated", func(t *testing.T) {
+		tests := []struct {
+			name string
+			id   string
+		}{
+			{"Missing", ""},
+			{"Too long", strings.Repeat("a", 129)},
+			{"Not printable", "trace\t42"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				w := do(http.MethodGet, "/api/user/usage", tt.id, "")
+				id := w.Header().Get(requestid.Header)
+				_, err := uuid.Parse(id)
+				assert.NoError(t, err, "the ID %q is replaced", tt.id)
+				assert.Contains(t, loggedIDs("/api/user/usage"), id)
+			})
+		}
+	})
+
+	t.Run("Rejected by auth", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		req.Header.Set(requestid.Header, "anonymous-1")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "anonymous-1", w.Header().Get(requestid.Header))
+	})
+
+	t.Run("Failed deletion", func(t *testing.T) {
+		require.Equal(t, http.StatusAccepted, do(http.MethodDelete, "/api/user/urls", "delete-1", `["abc"]`).Code)
+		require.Equal(t, http.StatusAccepted, do(http.MethodDelete, "/api/user/urls", "delete-2", `["def"]`).Code)
+		assert.ErrorContains(t, api.Shutdown(context.Background()), "database is down")
+
+		failures := logs.FilterMessage("BatcherDeleteTask: failed to delete ids").All()
+		require.Len(t, failures, 1)
+		assert.Equal(t, []any{"delete-1", "delete-2"}, failures[0].ContextMap()["request_ids"],
+			"the failure names the requests of the flush")
+	})
+}
@@ -0,0 +1,194 @@
+package adapters_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+)
+
+func newReservationRepo(t *testing.T) (*adapters.InMemoryURLRepository, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data.json")
+	repo, err := adapters.NewInMemoryURLRepository(path)
+	require.NoError(t, err)
+	return repo, path
+}
+
+func TestReserveConflicts(t *testing.T) {
+	repo, _ := newReservationRepo(t)
+	ctx := context.Background()
+	alice, bob := uuid.NewString(), uuid.NewString()
+
+	require.NoError(t, repo.Reserve(ctx, alice, "launch", time.Hour))
+	assert.ErrorIs(t, repo.Reserve(ctx, alice, "launch", time.Hour), domain.ErrShortURLTaken)
+	assert.ErrorIs(t, repo.Reserve(ctx, bob, "launch", time.Hour), domain.ErrShortURLTaken)
+
+	// Another user's alias cannot take the reserved code.
+	err := repo.Save(ctx, &domain.URL{OriginalURL: "https://bob.example.com", ShortURL: "launch", UUID: bob})
+	assert.ErrorIs(t, err, domain.ErrShortURLTaken)
+
+	url := &domain.URL{OriginalURL: "https://taken.example.com", UUID: bob}
+	require.NoError(t, shortener.NewService(repo).Save(ctx, url))
+	assert.ErrorIs(t, repo.Reserve(ctx, alice, url.ShortURL, time.Hour), domain.ErrShortURLTaken)
+}
+
+func TestReservationResolvesUntilCompleted(t *testing.T) {
+	repo, path := newReservationRepo(t)
+	ctx := context.Background()
+	alice, bob := uuid.NewString(), uuid.NewString()
+	require.NoError(t, repo.Reserve(ctx, alice, "launch", time.Hour))
+
+	_, err := repo.Find(ctx, "launch")
+	assert.ErrorIs(t, err, domain.ErrCodeReserved)
+	export, err := repo.ExportByUser(ctx, alice)
+	require.NoError(t, err)
+	assert.Empty(t, export)
+
+	assert.ErrorIs(t, repo.CompleteReservation(ctx, bob, "launch", "https://bob.example.com"), domain.ErrNotReservationOwner)
+	assert.ErrorIs(t, repo.CompleteReservation(ctx, alice, "unknown", "https://alice.example.com"), domain.ErrReservationNotFound)
+
+	reloaded, err := adapters.NewInMemoryURLRepository(path)
+	require.NoError(t, err)
+	reservations, err := reloaded.Reservations(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, reservations, 1)
+	assert.Equal(t, "launch", reservations[0].ShortURL)
+
+	require.NoError(t, repo.CompleteReservation(ctx, alice, "launch", "https://alice.example.com"))
+	url, err := repo.Find(ctx, "launch")
+	require.NoError(t, err)
+	assert.Equal(t, "https://alice.example.com", url.OriginalURL)
+	assert.Equal(t, alice, url.UUID)
+	reservations, err = repo.Reservations(ctx, alice)
+	require.NoError(t, err)
+	assert.Empty(t, reservations)
+	assert.ErrorIs(t, repo.CompleteReservation(ctx, alice, "launch", "https://other.example.com"), domain.ErrReservationNotFound)
+}
+
+func TestReservationExpiry(t *testing.T) {
+	repo, _ := newReservationRepo(t)
+	ctx := context.Background()
+	alice, bob := uuid.NewString(), uuid.NewString()
+	require.NoError(t, repo.Reserve(ctx, alice, "short-lived", time.Millisecond))
+	require.NoError(t, repo.Reserve(ctx, alice, "long-lived", time.Hour))
+	time.Sleep(5 * time.Millisecond)
+
+	_, err := repo.Find(ctx, "short-lived")
+	assert.ErrorIs(t, err, domain.ErrURLNotFound)
+	assert.ErrorIs(t, repo.CompleteReservation(ctx, alice, "short-lived", "https://late.example.com"), domain.ErrReservationNotFound)
+	reservations, err := repo.Reservations(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, reservations, 1)
+	assert.Equal(t, "long-lived", reservations[0].ShortURL)
+
+	// An expired code is free before the cleanup job reaches it.
+	require.NoError(t, repo.Reserve(ctx, bob, "short-lived", time.Hour))
+	require.NoError(t, repo.Reserve(ctx, alice, "stale", time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+
+	purged, err := repo.PurgeExpiredReservations(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	purged, err = repo.PurgeExpiredReservations(ctx, time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged)
+	_, err = repo.Find(ctx, "long-lived")
+	assert.ErrorIs(t, err, domain.ErrURLNotFound)
+}
+
+type reservationEnv struct {
+	router *gin.Engine
+	tokens map[string]string
+}
+
+func newReservationEnv(t *testing.T, cfg *configs.Config, users ...string) *reservationEnv {
+	t.Helper()
+	repo, _ := newReservationRepo(t)
+	router := setupRouter()
+	api := adapters.NewRestAPI(repo, router, cfg, adapters.WithReservations(repo))
+	require.NoError(t, api.RegisterRoutes())
+	env := &reservationEnv{router: router, tokens: make(map[string]string)}
+	for _, user := range users {
+		env.tokens[user] = buildToken(t, cfg, user)
+	}
+	return env
+}
+
+func (e *reservationEnv) do(method, path, user, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token, ok := e.tokens[user]; ok {
+		req.AddCookie(&http.Cookie{Name: "auth", Value: token})
+	}
+	e.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestReservationEndpoints(t *testing.T) {
+	cfg := getConfig(t)
+	cfg.Reservation.Status = http.StatusGone
+	alice, bob := uuid.NewString(), uuid.NewString()
+	env := newReservationEnv(t, cfg, alice, bob)
+
+	tests := []struct {
+		name         string
+		user         string
+		method       string
+		path         string
+		body         string
+		expectedCode int
+	}{
+		{"Invalid code", alice, http.MethodPost, "/api/reserve", `{"code":"a!"}`, http.StatusBadRequest},
+		{"Reserved path", alice, http.MethodPost, "/api/reserve", `{"code":"Metrics"}`, http.StatusBadRequest},
+		{"TTL above maximum", alice, http.MethodPost, "/api/reserve", `{"code":"launch","ttl":"10000h"}`, http.StatusBadRequest},
+		{"Reserve", alice, http.MethodPost, "/api/reserve", `{"code":"launch","ttl":"1h"}`, http.StatusCreated},
+		{"Reserve again", bob, http.MethodPost, "/api/reserve", `{"code":"launch"}`, http.StatusConflict},
+		{"Resolve reserved", "", http.MethodGet, "/api/launch", "", http.StatusGone},
+		{"Complete for someone else", bob, http.MethodPost, "/api/reserve/launch/complete", `{"url":"https://bob.example.com"}`, http.StatusForbidden},
+		{"Complete unknown", alice, http.MethodPost, "/api/reserve/nothing/complete", `{"url":"https://alice.example.com"}`, http.StatusNotFound},
+		{"Complete", alice, http.MethodPost, "/api/reserve/launch/complete", `{"url":"https://alice.example.com"}`, http.StatusCreated},
+		{"Resolve completed", "", http.MethodGet, "/api/launch", "", http.StatusTemporaryRedirect},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := env.do(tt.method, tt.path, tt.user, tt.body)
+			assert.Equal(t, tt.expectedCode, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestListReservationsEndpoint(t *testing.T) {
+	alice, bob := uuid.NewString(), uuid.NewString()
+	env := newReservationEnv(t, getConfig(t), alice, bob)
+	require.Equal(t, http.StatusCreated, env.do(http.MethodPost, "/api/reserve", alice, `{"code":"b-code"}`).Code)
+	require.Equal(t, http.StatusCreated, env.do(http.MethodPost, "/api/reserve", alice, `{"code":"a-code"}`).Code)
+	require.Equal(t, http.StatusCreated, env.do(http.MethodPost, "/api/reserve", bob, `{"code":"c-code"}`).Code)
+	assert.Equal(t, http.StatusNotFound, env.do(http.MethodGet, "/api/a-code", "", "").Code)
+
+	w := env.do(http.MethodGet, "/api/user/reservations", alice, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Reservations []domain.Reservation `json:"reservations"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Reservations, 2)
+	assert.Equal(t, "a-code", resp.Reservations[0].ShortURL)
+	assert.Equal(t, "b-code", resp.Reservations[1].ShortURL)
+	assert.WithinDuration(t, time.Now().Add(getConfig(t).Reservation.DefaultTTL), resp.Reservations[0].ExpiresAt, time.Minute)
+}
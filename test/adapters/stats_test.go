@@ -0,0 +1,72 @@
+package adapters_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+)
+
+func TestInternalStatsCounts(t *testing.T) {
+	tests := []struct {
+		name         string
+		subnet       string
+		proxies      string
+		remoteAddr   string
+		headers      map[string]string
+		expectedCode int
+	}{
+		{"Trusted address", "192.0.2.0/24", "", "192.0.2.10:4000", nil, http.StatusOK},
+		{"Untrusted address", "192.0.2.0/24", "", "10.0.0.1:4000", nil, http.StatusForbidden},
+		{"Spoofed X-Real-IP", "192.0.2.0/24", "", "10.0.0.1:4000", map[string]string{"X-Real-IP": "192.0.2.10"}, http.StatusForbidden},
+		{"Spoofed X-Forwarded-For", "192.0.2.0/24", "", "10.0.0.1:4000", map[string]string{"X-Forwarded-For": "192.0.2.10"}, http.StatusForbidden},
+		{"Spoofed through a proxy", "192.0.2.0/24", "10.0.0.0/24", "10.0.0.1:4000", map[string]string{"X-Forwarded-For": "192.0.2.10"}, http.StatusForbidden},
+		{"Trusted through a proxy", "192.0.2.0/24", "10.0.0.0/24", "10.0.0.1:4000", map[string]string{"X-Real-IP": "192.0.2.10"}, http.StatusOK},
+		{"No trusted subnet", "", "", "192.0.2.10:4000", nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+			require.NoError(t, err)
+			for longURL, owner := range map[string]string{
+				"https://a1.example.com": "alice",
+				"https://a2.example.com": "alice",
+				"https://b1.example.com": "bob",
+			} {
+				require.NoError(t, shortener.NewService(repo).Save(context.Background(), &domain.URL{OriginalURL: longURL, UUID: owner}))
+			}
+			cfg := getConfig(t)
+			cfg.Server.TrustedSubnet = tt.subnet
+			cfg.Server.TrustedProxies = tt.proxies
+			router := setupRouter()
+			api := adapters.NewRestAPI(repo, router, cfg)
+			require.NoError(t, api.RegisterRoutes())
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, tt.expectedCode, w.Code, w.Body.String())
+			if tt.expectedCode != http.StatusOK {
+				assert.NotContains(t, w.Body.String(), `"urls"`)
+				return
+			}
+			var stats domain.Stats
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+			assert.Equal(t, domain.Stats{URLs: 3, Users: 2}, stats)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package adapters_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+)
+
+var migratedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// storeFixtures writes a save file of every supported version and returns their paths.
+func storeFixtures(t *testing.T) map[string]string {
+	t.Helper()
+	dir := t.TempDir()
+	paths := map[string]string{"v0": filepath.Join(dir, "v0.json"), "v1": filepath.Join(dir, "v1.json")}
+	require.NoError(t, os.WriteFile(paths["v0"], []byte(`{
+		"flat0001": "https://flat.example.com",
+		"flat0002": "https://flat.example.com/2"
+	}`), 0600))
+	require.NoError(t, os.WriteFile(paths["v1"], []byte(`{
+		"flat0001": "https://flat.example.com",
+		"record01": {"original_url": "https://record.example.com", "created_at": "2020-01-01T00:00:00Z"},
+		"owned001": {"original_url": "https://owned.example.com", "user_id": "someone", "created_at": "2020-01-01T00:00:00Z"}
+	}`), 0600))
+
+	// v2 is what the current code writes.
+	paths["v2"] = filepath.Join(dir, "v2.json")
+	repo, err := adapters.NewInMemoryURLRepository(paths["v2"])
+	require.NoError(t, err)
+	ctx := context.Background()
+	url := &domain.URL{OriginalURL: "https://current.example.com", UUID: uuid.NewString()}
+	require.NoError(t, shortener.NewService(repo).Save(ctx, url))
+	require.NoError(t, repo.Reserve(ctx, url.UUID, "launch", time.Hour))
+	return paths
+}
+
+// storedRecords returns the records of the save file at path, as written in version 2.
+func storedRecords(t *testing.T, path string) map[string]map[string]any {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "records.json")
+	_, err := adapters.MigrateStore(adapters.StoreMigration{From: path, To: out, Version: 2, Now: migratedAt})
+	require.NoError(t, err)
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	var file struct {
+		Version int                       `json:"version"`
+		URLs    map[string]map[string]any `json:"urls"`
+	}
+	require.NoError(t, json.Unmarshal(data, &file))
+	require.Equal(t, 2, file.Version)
+	return file.URLs
+}
+
+func TestMigrateStoreRoundTrips(t *testing.T) {
+	paths := storeFixtures(t)
+	for from, path := range paths {
+		want := storedRecords(t, path)
+		for _, there := range []int{1, 2} {
+			for _, back := range []int{1, 2} {
+				dir := t.TempDir()
+				converted := filepath.Join(dir, "converted.json")
+				summary, err := adapters.MigrateStore(adapters.StoreMigration{From: path, To: converted, Version: there, Now: migratedAt})
+				require.NoError(t, err, from)
+				assert.Equal(t, len(want), summary.Converted, from)
+				assert.Zero(t, summary.Skipped, from)
+
+				restored := filepath.Join(dir, "restored.json")
+				summary, err = adapters.MigrateStore(adapters.StoreMigration{From: converted, To: restored, Version: back, Now: migratedAt})
+				require.NoError(t, err, from)
+				assert.Equal(t, there, summary.FromVersion)
+				assert.Equal(t, want, storedRecords(t, restored), "%s to v%d to v%d", from, there, back)
+
+				_, err = adapters.NewInMemoryURLRepository(restored)
+				require.NoError(t, err, "the server loads what the converter writes")
+			}
+		}
+	}
+}
+
+func TestMigrateStoreDetectsVersions(t *testing.T) {
+	paths := storeFixtures(t)
+	for name, version := range map[string]int{"v0": 0, "v1": 1, "v2": 2} {
+		summary, err := adapters.MigrateStore(adapters.StoreMigration{From: paths[name], Version: 2, Check: true})
+		require.NoError(t, err)
+		assert.Equal(t, version, summary.FromVersion, name)
+	}
+
+	summary, err := adapters.MigrateStore(adapters.StoreMigration{From: paths["v1"], Version: 2, Check: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"1 URL strings became records owned by " + domain.LegacyOwner,
+		"1 records without an owner were given " + domain.LegacyOwner,
+	}, summary.Warnings)
+
+	legacy := storedRecords(t, paths["v1"])
+	assert.Equal(t, domain.LegacyOwner, legacy["record01"]["user_id"])
+	assert.Equal(t, "someone", legacy["owned001"]["user_id"])
+}
+
+func TestMigrateStoreSkipsInvalidEntries(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "old.json")
+	to := filepath.Join(dir, "new.json")
+	require.NoError(t, os.WriteFile(from, []byte(`{
+		"good0001": {"original_url": "https://good.example.com", "user_id": "someone", "created_at": "2020-01-01T00:00:00Z"},
+		"nourl001": {"user_id": "someone", "created_at": "2020-01-01T00:00:00Z"},
+		"number01": 42,
+		"bad/code": "https://bad.example.com"
+	}`), 0600))
+	_, err := adapters.NewInMemoryURLRepository(from)
+	assert.ErrorIs(t, err, adapters.ErrInvalidEntry, "the server refuses what the converter skips")
+
+	summary, err := adapters.MigrateStore(adapters.StoreMigration{From: from, To: to, Version: 2, Check: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, summary.Converted)
+	assert.Equal(t, 3, summary.Skipped)
+	assert.Contains(t, summary.Warnings[0], `"bad/code"`)
+	_, err = os.Stat(to)
+	assert.ErrorIs(t, err, os.ErrNotExist, "--check writes nothing")
+
+	_, err = adapters.MigrateStore(adapters.StoreMigration{From: from, To: to, Version: 2})
+	require.NoError(t, err)
+	repo, err := adapters.NewInMemoryURLRepository(to)
+	require.NoError(t, err)
+	found, err := repo.Find(context.Background(), "good0001")
+	require.NoError(t, err)
+	assert.Equal(t, "https://good.example.com", found.OriginalURL)
+
+	_, err = adapters.MigrateStore(adapters.StoreMigration{From: from, To: to, Version: 0})
+	assert.ErrorIs(t, err, adapters.ErrUnsupportedFormat)
+	require.NoError(t, os.WriteFile(from, []byte(`{"version": 3, "urls": {}}`), 0600))
+	_, err = adapters.MigrateStore(adapters.StoreMigration{From: from, To: to, Version: 2})
+	assert.ErrorIs(t, err, adapters.ErrUnsupportedFormat)
+}
@@ -0,0 +1,127 @@
+package adapters_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+)
+
+func TestLinkStatsCountsRedirects(t *testing.T) {
+	cfg := getConfig(t)
+	repo, path := newReservationRepo(t)
+	router := setupRouter()
+	api := adapters.NewRestAPI(repo, router, cfg)
+	require.NoError(t, api.RegisterRoutes())
+	api.StartBackground(context.Background())
+	env := &reservationEnv{router: router, tokens: map[string]string{
+		"alice": buildToken(t, cfg, "alice"),
+		"bob":   buildToken(t, cfg, "bob"),
+	}}
+
+	w := env.do(http.MethodPost, "/api/shorten", "alice", `{"longURL":"https://example.com/visited"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	code := shortCode(t, w.Body.Bytes())
+	var stats domain.LinkStats
+	w = env.do(http.MethodGet, "/api/user/urls/"+code+"/stats", "alice", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, domain.LinkStats{ShortURL: code}, stats, "a link never visited")
+
+	for range 3 {
+		require.Equal(t, http.StatusTemporaryRedirect, env.do(http.MethodGet, "/api/"+code, "", "").Code)
+	}
+	assert.Equal(t, http.StatusNotFound, env.do(http.MethodGet, "/api/unknown", "", "").Code)
+	require.NoError(t, api.Shutdown(context.Background()), "counts are drained with the pools")
+
+	w = env.do(http.MethodGet, "/api/user/urls/"+code+"/stats", "alice", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, int64(3), stats.Visits)
+	require.NotNil(t, stats.LastVisitedAt)
+
+	assert.Equal(t, http.StatusNotFound, env.do(http.MethodGet, "/api/user/urls/"+code+"/stats", "bob", "").Code,
+		"only the owner sees the stats")
+	assert.Equal(t, http.StatusNotFound, env.do(http.MethodGet, "/api/user/urls/unknown/stats", "alice", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, env.do(http.MethodGet, "/api/user/urls/"+code+"/stats", "", "").Code)
+
+	require.NoError(t, repo.Close(context.Background()))
+	reloaded, err := adapters.NewInMemoryURLRepository(path)
+	require.NoError(t, err)
+	stats, err = reloaded.LinkStats(context.Background(), "alice", code)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Visits, "counts are written out on Close")
+}
+
+func TestLinkStatsThroughDecorators(t *testing.T) {
+	cfg := getConfig(t)
+	mem, _ := newReservationRepo(t)
+	repo := adapters.NewCachedRepository(adapters.NewMetricsRepository(mem, nil), time.Minute, 100)
+	router := setupRouter()
+	api := adapters.NewRestAPI(repo, router, cfg, adapters.WithLinkStats(mem))
+	require.NoError(t, api.RegisterRoutes())
+	api.StartBackground(context.Background())
+	env := &reservationEnv{router: router, tokens: map[string]string{"alice": buildToken(t, cfg, "alice")}}
+
+	w := env.do(http.MethodPost, "/api/shorten", "alice", `{"longURL":"https://example.com/decorated"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	code := shortCode(t, w.Body.Bytes())
+	require.Equal(t, http.StatusTemporaryRedirect, env.do(http.MethodGet, "/api/"+code, "", "").Code)
+	require.NoError(t, api.Shutdown(context.Background()))
+
+	w = env.do(http.MethodGet, "/api/user/urls/"+code+"/stats", "alice", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var stats domain.LinkStats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, int64(1), stats.Visits, "redirects are counted through the decorators")
+}
+
+func TestVisitsDroppedWhenPoolIsFull(t *testing.T) {
+	cfg := getConfig(t)
+	visits := cfg.Pools["visitWorker"]
+	visits.BufferSize = 1
+	cfg.Pools["visitWorker"] = visits
+	repo, _ := newReservationRepo(t)
+	router := setupRouter()
+	registry := prometheus.NewRegistry()
+	api := adapters.NewRestAPI(repo, router, cfg, adapters.WithPrometheus(registry))
+	require.NoError(t, api.RegisterRoutes())
+	router.GET("/api/internal/stats", api.Stats)
+	env := &reservationEnv{router: router, tokens: map[string]string{"alice": buildToken(t, cfg, "alice")}}
+
+	w := env.do(http.MethodPost, "/api/shorten", "alice", `{"longURL":"https://example.com/busy"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	code := shortCode(t, w.Body.Bytes())
+	// The pool is not started, so the first count fills its queue.
+	for range 3 {
+		require.Equal(t, http.StatusTemporaryRedirect, env.do(http.MethodGet, "/api/"+code, "", "").Code,
+			"redirects do not wait for the count")
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var stats struct {
+		Visits struct {
+			Dropped int64 `json:"dropped"`
+		} `json:"visits"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, int64(2), stats.Visits.Dropped)
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP shortlink_visits_dropped_total Redirects not counted because the visitWorker pool was full.
+# TYPE shortlink_visits_dropped_total counter
+shortlink_visits_dropped_total 2
+`), "shortlink_visits_dropped_total"))
+}
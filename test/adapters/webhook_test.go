@@ -0,0 +1,99 @@
+package adapters_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/events"
+	"github.com/OrtemRepos/shortlink/internal/webhook"
+	"github.com/OrtemRepos/shortlink/pkg/client"
+)
+
+// testDelivery is the answer of POST /api/user/webhooks/:id/test.
+type testDelivery struct {
+	Delivered  bool   `json:"delivered"`
+	StatusCode int    `json:"status_code"`
+	Error      string `json:"error"`
+}
+
+func TestWebhookEndpoints(t *testing.T) {
+	var secret string
+	received := make(chan events.Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if !assert.NoError(t, err) {
+			return
+		}
+		if err := client.VerifyWebhookSignature(secret, r.Header.Get(client.SignatureHeader), body); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var e events.Event
+		assert.NoError(t, json.Unmarshal(body, &e))
+		received <- e
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := getConfig(t)
+	repo, _ := newReservationRepo(t)
+	router := setupRouter()
+	store := webhook.NewStore(nil)
+	api := adapters.NewRestAPI(repo, router, cfg, adapters.WithWebhooks(store, webhook.NewSender(srv.Client())))
+	require.NoError(t, api.RegisterRoutes())
+	env := &reservationEnv{router: router, tokens: map[string]string{
+		"alice": buildToken(t, cfg, "alice"),
+		"bob":   buildToken(t, cfg, "bob"),
+	}}
+
+	assert.Equal(t, http.StatusBadRequest, env.do(http.MethodPost, "/api/user/webhooks", "alice", `{"url":"ftp://example.com"}`).Code)
+	w := env.do(http.MethodPost, "/api/user/webhooks", "alice", fmt.Sprintf(`{"url":%q}`, srv.URL))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var hook webhook.Webhook
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &hook))
+	require.NotEmpty(t, hook.Secret)
+	secret = hook.Secret
+
+	w = env.do(http.MethodGet, "/api/user/webhooks", "alice", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), hook.Secret, "secrets are not listed")
+	assert.Contains(t, w.Body.String(), hook.ID)
+
+	test := "/api/user/webhooks/" + hook.ID + "/test"
+	assert.Equal(t, http.StatusNotFound, env.do(http.MethodPost, test, "bob", "").Code, "webhooks of other users are not found")
+
+	t.Run("Delivered", func(t *testing.T) {
+		w := env.do(http.MethodPost, test, "alice", "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var result testDelivery
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		assert.True(t, result.Delivered)
+		assert.Equal(t, http.StatusNoContent, result.StatusCode)
+		assert.Empty(t, result.Error)
+		e := <-received
+		assert.Equal(t, events.WebhookTest, e.Type)
+		assert.Equal(t, "alice", e.UserID)
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		secret = "rotated by the receiver"
+		w := env.do(http.MethodPost, test, "alice", "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var result testDelivery
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		assert.False(t, result.Delivered)
+		assert.Equal(t, http.StatusUnauthorized, result.StatusCode)
+		assert.Contains(t, result.Error, "rejected")
+	})
+
+	assert.Equal(t, http.StatusNoContent, env.do(http.MethodDelete, "/api/user/webhooks/"+hook.ID, "alice", "").Code)
+	assert.Equal(t, http.StatusNotFound, env.do(http.MethodPost, test, "alice", "").Code)
+}
@@ -0,0 +1,40 @@
+package app_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/app"
+)
+
+func TestMigrateStoreCommand(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "old.json")
+	to := filepath.Join(dir, "new.json")
+	require.NoError(t, os.WriteFile(from, []byte(`{"flat0001": "https://flat.example.com"}`), 0600))
+
+	var stdout, stderr bytes.Buffer
+	code := app.MigrateStore([]string{"--from", from, "--check"}, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "v0 to v2: 1 entries valid, 0 skipped, 1 warnings")
+	_, err := os.Stat(to)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	stdout.Reset()
+	code = app.MigrateStore([]string{"--from", from, "--to", to, "--format", "v1"}, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "v0 to v1: 1 entries converted")
+	data, err := os.ReadFile(to)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"original_url": "https://flat.example.com"`)
+
+	stderr.Reset()
+	assert.Equal(t, 2, app.MigrateStore([]string{"--from", from}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "--to")
+	assert.Equal(t, 1, app.MigrateStore([]string{"--from", from, "--to", to, "--format", "v9"}, &stdout, &stderr))
+}
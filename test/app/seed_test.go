@@ -0,0 +1,43 @@
+package app_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/app"
+)
+
+func TestSeedCommand(t *testing.T) {
+	t.Setenv("IN_MEMORY", "true")
+	save := filepath.Join(t.TempDir(), "urls.json")
+	args := []string{"--users", "4", "--links", "300", "--clicks", "900", "--seed", "1",
+		"--", "-c", "../../configs/config.yml", "-s", save}
+
+	var stdout, stderr bytes.Buffer
+	code := app.Seed(args, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	assert.FileExists(t, save, "the links are saved in the store given by -s")
+	assert.NoDirExists(t, "data")
+	assert.Contains(t, stdout.String(), "seed 1: 4 users, 300 links")
+	assert.Contains(t, stdout.String(), "900 clicks generated")
+	assert.Equal(t, 3, strings.Count(stdout.String(), "curl --cookie auth="))
+
+	t.Setenv("ENVIRONMENT", "production")
+	stdout.Reset()
+	stderr.Reset()
+	assert.Equal(t, 1, app.Seed(args, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "non-empty production store")
+	assert.Empty(t, stdout.String())
+
+	stderr.Reset()
+	force := append([]string{"--force"}, args...)
+	require.Equal(t, 0, app.Seed(force, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stderr.String(), "seeding anyway")
+
+	assert.Equal(t, 2, app.Seed([]string{"--users", "0"}, &stdout, &stderr))
+}
@@ -0,0 +1,111 @@
+package backpressure_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/backpressure"
+	"github.com/OrtemRepos/shortlink/internal/clock"
+)
+
+func newMonitor(shedFraction float64) *backpressure.Monitor {
+	cfg := &configs.Config{}
+	cfg.Backpressure.LatencyP95 = 100 * time.Millisecond
+	cfg.Backpressure.InFlight = 10
+	cfg.Backpressure.RecoveryFactor = 0.5
+	cfg.Backpressure.ShedFraction = shedFraction
+	cfg.Backpressure.Window = 20
+	return backpressure.NewMonitor(cfg)
+}
+
+func observe(m *backpressure.Monitor, latency time.Duration, n int) {
+	for i := 0; i < n; i++ {
+		m.Observe("Save", latency)
+	}
+}
+
+func TestStateMachine(t *testing.T) {
+	m := newMonitor(1)
+
+	observe(m, 10*time.Millisecond, 20)
+	assert.Equal(t, backpressure.Healthy, m.State())
+
+	observe(m, 200*time.Millisecond, 1)
+	assert.Equal(t, backpressure.Healthy, m.State(), "a single slow call is below p95")
+
+	observe(m, 200*time.Millisecond, 2)
+	assert.Equal(t, backpressure.Degraded, m.State())
+
+	// Below the threshold but above the recovery level: hysteresis keeps it degraded.
+	observe(m, 80*time.Millisecond, 20)
+	assert.Equal(t, backpressure.Degraded, m.State())
+
+	observe(m, 40*time.Millisecond, 20)
+	assert.Equal(t, backpressure.Healthy, m.State())
+
+	stats := m.Stats()
+	assert.Equal(t, uint64(2), stats.Transitions)
+	assert.Equal(t, 20, stats.Methods["Save"].Samples)
+	assert.Equal(t, 40*time.Millisecond, stats.Methods["Save"].P95)
+}
+
+func TestInFlightThreshold(t *testing.T) {
+	m := newMonitor(1)
+	done := make([]func(), 0, 11)
+	for i := 0; i < 11; i++ {
+		done = append(done, m.Begin("Find"))
+	}
+	assert.Equal(t, backpressure.Degraded, m.State())
+	assert.Equal(t, int64(11), m.Stats().Methods["Find"].InFlight)
+
+	for _, end := range done {
+		end()
+	}
+	assert.Equal(t, backpressure.Healthy, m.State())
+}
+
+func TestCooldown(t *testing.T) {
+	cfg := &configs.Config{}
+	cfg.Backpressure.LatencyP95 = 100 * time.Millisecond
+	cfg.Backpressure.RecoveryFactor = 0.5
+	cfg.Backpressure.Cooldown = time.Hour
+	cfg.Backpressure.Window = 20
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	m := backpressure.NewMonitor(cfg, backpressure.WithClock(fake))
+
+	observe(m, 200*time.Millisecond, 20)
+	observe(m, time.Millisecond, 20)
+	assert.Equal(t, backpressure.Degraded, m.State(), "recovery waits for the cooldown")
+
+	fake.Advance(time.Hour)
+	observe(m, time.Millisecond, 1)
+	assert.Equal(t, backpressure.Healthy, m.State())
+}
+
+func TestMiddlewareSheds(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newMonitor(1)
+	engine := gin.New()
+	engine.POST("/shorten", backpressure.Middleware(m, 1500*time.Millisecond), func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/shorten", nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	observe(m, time.Second, 20)
+	require.Equal(t, backpressure.Degraded, m.State())
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/shorten", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, uint64(1), m.Stats().Shed)
+}
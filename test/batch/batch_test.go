@@ -0,0 +1,104 @@
+package batch_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/batch"
+)
+
+var errUserFailed = errors.New("user failed")
+
+func countValues(_ context.Context, _ string, values []string) (int, error) {
+	return len(values), nil
+}
+
+func TestPerKeyIsolatesErrors(t *testing.T) {
+	groups := map[string][]string{
+		"user-1": {"a", "b"},
+		"broken": {"c"},
+		"user-2": {"d"},
+	}
+	total, err := batch.PerKey(context.Background(), groups, 2, func(ctx context.Context, key string, values []string) (int, error) {
+		if key == "broken" {
+			return 0, errUserFailed
+		}
+		return countValues(ctx, key, values)
+	})
+	assert.Equal(t, 3, total, "the other users are still deleted")
+	require.ErrorIs(t, err, errUserFailed)
+	assert.Contains(t, err.Error(), "broken")
+	assert.NotContains(t, err.Error(), "user-1")
+}
+
+func TestPerKeyBoundsConcurrency(t *testing.T) {
+	groups := make(map[string][]string, 20)
+	for i := 0; i < 20; i++ {
+		groups[fmt.Sprint("user-", i)] = []string{"a"}
+	}
+	var running, peak atomic.Int64
+	total, err := batch.PerKey(context.Background(), groups, 3, func(ctx context.Context, key string, values []string) (int, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		return countValues(ctx, key, values)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 20, total)
+	assert.LessOrEqual(t, peak.Load(), int64(3))
+}
+
+func TestPerKeyStopsOnCancel(t *testing.T) {
+	groups := make(map[string][]string, 10)
+	for i := 0; i < 10; i++ {
+		groups[fmt.Sprint("user-", i)] = []string{"a"}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var started atomic.Int64
+	total, err := batch.PerKey(ctx, groups, 1, func(ctx context.Context, key string, values []string) (int, error) {
+		started.Add(1)
+		cancel()
+		return countValues(ctx, key, values)
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int64(1), started.Load(), "no group starts after cancellation")
+	assert.Equal(t, 1, total)
+}
+
+// BenchmarkPerKeySlowUser shows one slow user no longer delaying the rest:
+// the batch takes about as long as the slow user, not the sum of all users.
+func BenchmarkPerKeySlowUser(b *testing.B) {
+	groups := map[string][]string{"slow": {"a"}}
+	for i := 0; i < 15; i++ {
+		groups[fmt.Sprint("user-", i)] = []string{"a"}
+	}
+	deleteUser := func(ctx context.Context, key string, values []string) (int, error) {
+		delay := time.Millisecond
+		if key == "slow" {
+			delay = 10 * time.Millisecond
+		}
+		time.Sleep(delay)
+		return len(values), nil
+	}
+	for _, limit := range []int{1, 4} {
+		b.Run(fmt.Sprint("concurrency-", limit), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := batch.PerKey(context.Background(), groups, limit, deleteUser); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
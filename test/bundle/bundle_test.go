@@ -0,0 +1,37 @@
+package bundle_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/bundle"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	links := []bundle.Link{{ShortURL: "abc", OriginalURL: "https://example.com"}}
+	b, err := bundle.New("staging", "user-1", time.Now(), links, secret)
+	require.NoError(t, err)
+	require.NoError(t, b.Verify(secret))
+
+	assert.ErrorIs(t, b.Verify([]byte("other")), bundle.ErrInvalidSignature)
+
+	tampered := b
+	tampered.Links = []bundle.Link{{ShortURL: "abc", OriginalURL: "https://evil.example.com"}}
+	assert.ErrorIs(t, tampered.Verify(secret), bundle.ErrInvalidSignature)
+
+	tampered = b
+	tampered.Environment = "production"
+	assert.ErrorIs(t, tampered.Verify(secret), bundle.ErrInvalidSignature)
+
+	tampered = b
+	tampered.Signature = "not hex"
+	assert.ErrorIs(t, tampered.Verify(secret), bundle.ErrInvalidSignature)
+
+	tampered = b
+	tampered.Version = bundle.Version + 1
+	assert.ErrorIs(t, tampered.Verify(secret), bundle.ErrUnsupportedVersion)
+}
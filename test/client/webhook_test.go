@@ -0,0 +1,55 @@
+package client_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/OrtemRepos/shortlink/pkg/client"
+)
+
+var sentAt = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestWebhookSignatureRoundTrip(t *testing.T) {
+	body := []byte(`{"type":"webhook.test"}`)
+	header := client.SignWebhook("secret", sentAt, body)
+	assert.True(t, strings.HasPrefix(header, "t=1704110400,v1="))
+
+	assert.NoError(t, client.VerifyWebhookSignatureAt("secret", header, body, sentAt.Add(time.Minute), client.DefaultTolerance))
+	assert.ErrorIs(t, client.VerifyWebhookSignatureAt("other", header, body, sentAt, client.DefaultTolerance),
+		client.ErrInvalidSignature)
+	assert.ErrorIs(t, client.VerifyWebhookSignatureAt("secret", header, []byte(`{"type":"quota.warning"}`), sentAt,
+		client.DefaultTolerance), client.ErrInvalidSignature, "the body is signed")
+
+	rotated := header + ",v1=" + strings.TrimPrefix(client.SignWebhook("old", sentAt, body), "t=1704110400,v1=")
+	assert.NoError(t, client.VerifyWebhookSignatureAt("old", rotated, body, sentAt, client.DefaultTolerance),
+		"any of the signatures may match")
+}
+
+func TestWebhookSignatureReplayRejected(t *testing.T) {
+	body := []byte(`{}`)
+	header := client.SignWebhook("secret", sentAt, body)
+
+	assert.NoError(t, client.VerifyWebhookSignatureAt("secret", header, body, sentAt.Add(5*time.Minute), 5*time.Minute))
+	assert.ErrorIs(t, client.VerifyWebhookSignatureAt("secret", header, body, sentAt.Add(6*time.Minute), 5*time.Minute),
+		client.ErrSignatureExpired)
+	assert.ErrorIs(t, client.VerifyWebhookSignatureAt("secret", header, body, sentAt.Add(-6*time.Minute), 5*time.Minute),
+		client.ErrSignatureExpired, "timestamps ahead of the clock are refused too")
+
+	refreshed := strings.Replace(header, "t=1704110400", "t=1704110700", 1)
+	assert.ErrorIs(t, client.VerifyWebhookSignatureAt("secret", refreshed, body, sentAt.Add(6*time.Minute), 5*time.Minute),
+		client.ErrInvalidSignature, "the timestamp is signed")
+}
+
+func TestWebhookSignatureMalformed(t *testing.T) {
+	body := []byte(`{}`)
+	for _, header := range []string{"", "v1=abcd", "t=1704110400", "t=now,v1=abcd", "t=1704110400,v1=zz"} {
+		assert.ErrorIs(t, client.VerifyWebhookSignatureAt("secret", header, body, sentAt, client.DefaultTolerance),
+			client.ErrInvalidSignature, header)
+	}
+	large := make([]byte, client.MaxPayload+1)
+	assert.ErrorIs(t, client.VerifyWebhookSignatureAt("secret", client.SignWebhook("secret", sentAt, large), large, sentAt,
+		client.DefaultTolerance), client.ErrPayloadTooLarge)
+}
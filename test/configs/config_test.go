@@ -0,0 +1,63 @@
+package configs_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/configs"
+)
+
+func TestRedirectCodeValidated(t *testing.T) {
+	cfg, err := configs.GetConfig([]string{"-c", "../../configs/config.yml"})
+	require.NoError(t, err)
+	assert.Equal(t, 307, cfg.Server.RedirectCode)
+
+	for _, code := range configs.RedirectCodes {
+		cfg.Server.RedirectCode = code
+		assert.NoError(t, cfg.Validate())
+	}
+	cfg.Server.RedirectCode = 308
+	cfg.Server.RedirectMaxAge = -1
+	assert.Error(t, cfg.Validate())
+
+	t.Setenv("REDIRECT_CODE", "303")
+	_, err = configs.GetConfig([]string{"-c", "../../configs/config.yml"})
+	assert.ErrorContains(t, err, "server.redirectCode 303")
+}
+
+func TestCORSWildcardWithCredentialsRejected(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com, *")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	_, err := configs.GetConfig([]string{"-c", "../../configs/config.yml"})
+	assert.ErrorContains(t, err, "cors.allowedOrigins *")
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com")
+	cfg, err := configs.GetConfig([]string{"-c", "../../configs/config.yml"})
+	require.NoError(t, err)
+	assert.True(t, cfg.CORS.AllowCredentials)
+}
+
+func TestDebugNeedsTrustedSubnet(t *testing.T) {
+	t.Setenv("DEBUG_ENABLED", "true")
+	_, err := configs.GetConfig([]string{"-c", "../../configs/config.yml"})
+	assert.ErrorContains(t, err, "server.debugEnabled needs server.trustedSubnet")
+
+	t.Setenv("TRUSTED_SUBNET", "10.0.0.0/8")
+	cfg, err := configs.GetConfig([]string{"-c", "../../configs/config.yml"})
+	require.NoError(t, err)
+	assert.True(t, cfg.Server.DebugEnabled)
+}
+
+func TestFlagsOverride(t *testing.T) {
+	cfg, err := configs.GetConfig([]string{"-c", "../../configs/config.yml",
+		"-im", "-s", "/tmp/urls.json", "-a", ":9090", "-db-port", "6543", "-t", "7", "-wc", "3"})
+	require.NoError(t, err)
+	assert.True(t, cfg.Repository.InMemory)
+	assert.Equal(t, "/tmp/urls.json", cfg.Repository.SavePath)
+	assert.Equal(t, ":9090", cfg.Server.Address)
+	assert.Equal(t, "6543", cfg.Database.Port)
+	assert.Equal(t, 7, cfg.Auth.TokenExp)
+	assert.Equal(t, 3, cfg.Worker.WorkersCount)
+}
@@ -0,0 +1,156 @@
+package cors_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+)
+
+const origin = "https://app.example.com"
+
+func newRouter(t *testing.T, configure func(cfg *configs.Config)) (*gin.Engine, *configs.Config) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg, err := configs.GetConfig([]string{"-c", "../../configs/config.yml"})
+	require.NoError(t, err)
+	cfg.CORS.AllowedOrigins = origin + ", https://admin.example.com"
+	configure(cfg)
+	repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+	require.NoError(t, err)
+	router := gin.New()
+	api := adapters.NewRestAPI(repo, router, cfg)
+	require.NoError(t, api.RegisterRoutes())
+	return router, cfg
+}
+
+func request(router *gin.Engine, method, path, from string, cookie *http.Cookie, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if from != "" {
+		req.Header.Set("Origin", from)
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func authCookie(t *testing.T, cfg *configs.Config) *http.Cookie {
+	t.Helper()
+	provider, err := adapters.NewProviderJWT(cfg)
+	require.NoError(t, err)
+	token, err := provider.BuildJWTString(uuid.NewString())
+	require.NoError(t, err)
+	return &http.Cookie{Name: "auth", Value: token}
+}
+
+func assertCORS(t *testing.T, w *httptest.ResponseRecorder) {
+	t.Helper()
+	assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Request-ID, Retry-After, Link, X-Total-Count", w.Header().Get("Access-Control-Expose-Headers"))
+	assert.Contains(t, w.Header().Values("Vary"), "Origin")
+}
+
+func TestCORSHeadersOnResponses(t *testing.T) {
+	router, cfg := newRouter(t, func(cfg *configs.Config) {
+		// One queued delete fills the intake: the batcher is not started.
+		cfg.Worker.BufferSize = 1
+	})
+	cookie := authCookie(t, cfg)
+
+	w := request(router, http.MethodPost, "/api/shorten", origin, cookie, `{"longURL":"https://example.com"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assertCORS(t, w)
+
+	w = request(router, http.MethodGet, "/ping", origin, nil, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assertCORS(t, w)
+
+	w = request(router, http.MethodGet, "/api/user/urls", origin, nil, "")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	assertCORS(t, w)
+
+	body := `{"host_suffix":"example.com"}`
+	require.Equal(t, http.StatusAccepted, request(router, http.MethodPost, "/api/user/urls/delete_by_filter", origin, cookie, body).Code)
+	w = request(router, http.MethodPost, "/api/user/urls/delete_by_filter", origin, cookie, body)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assertCORS(t, w)
+}
+
+func TestCORSPreflight(t *testing.T) {
+	router, _ := newRouter(t, func(cfg *configs.Config) {
+		cfg.CORS.MaxAge = 10 * time.Minute
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodOptions, "/api/shorten", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code, "preflights carry no auth cookie")
+	assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), http.MethodPost)
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Content-Type")
+}
+
+func TestCORSPreflightDeleteWithCustomHeaders(t *testing.T) {
+	router, _ := newRouter(t, func(cfg *configs.Config) {
+		cfg.CORS.AllowedHeaders = "Content-Type, X-Client-Version"
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodOptions, "/api/user/urls", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+	req.Header.Set("Access-Control-Request-Headers", "content-type, x-client-version")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code, "the delete handler and auth are not run")
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST, PUT, PATCH, DELETE", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type, X-Client-Version", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Contains(t, w.Header().Values("Vary"), "Origin")
+}
+
+func TestCORSOtherOrigins(t *testing.T) {
+	router, _ := newRouter(t, func(cfg *configs.Config) {})
+	w := request(router, http.MethodGet, "/ping", "https://evil.example.com", nil, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	router, _ = newRouter(t, func(cfg *configs.Config) { cfg.CORS.AllowedOrigins = "*" })
+	w = request(router, http.MethodGet, "/ping", "https://any.example.com", nil, "")
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+
+	router, _ = newRouter(t, func(cfg *configs.Config) {
+		cfg.CORS.AllowedOrigins = "*, " + origin
+		cfg.CORS.AllowCredentials = true
+	})
+	w = request(router, http.MethodGet, "/ping", "https://any.example.com", nil, "")
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), "* never matches with credentials")
+	w = request(router, http.MethodGet, "/ping", origin, nil, "")
+	assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"), "credentials need the origin named")
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+
+	router, _ = newRouter(t, func(cfg *configs.Config) { cfg.CORS.AllowedOrigins = "" })
+	w = request(router, http.MethodGet, "/ping", origin, nil, "")
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Values("Vary"))
+}
@@ -0,0 +1,72 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/OrtemRepos/shortlink/internal/domain"
+)
+
+func TestURLFilterNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  domain.URLFilter
+		valid   bool
+		reverse string
+	}{
+		{"host suffix", domain.URLFilter{HostSuffix: "Old-Domain.COM."}, true, "com.old-domain."},
+		{"url prefix", domain.URLFilter{URLPrefix: "HTTPS://Example.com/docs"}, true, "com.example."},
+		{"both", domain.URLFilter{HostSuffix: "example.com", URLPrefix: "https://example.com"}, false, ""},
+		{"neither", domain.URLFilter{}, false, ""},
+		{"wildcard", domain.URLFilter{HostSuffix: "*.example.com"}, false, ""},
+		{"pattern", domain.URLFilter{HostSuffix: "exam%le.com"}, false, ""},
+		{"not http", domain.URLFilter{URLPrefix: "ftp://example.com"}, false, ""},
+		{"no host", domain.URLFilter{URLPrefix: "/relative"}, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := tt.filter
+			err := filter.Normalize()
+			if !tt.valid {
+				if !errors.Is(err, domain.ErrInvalidFilter) {
+					t.Errorf("Expected ErrInvalidFilter, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.ReversedHost(); got != tt.reverse {
+				t.Errorf("Expected reversed host %s, got %s", tt.reverse, got)
+			}
+		})
+	}
+}
+
+func TestURLFilterMatches(t *testing.T) {
+	suffix := domain.URLFilter{HostSuffix: "old-domain.com"}
+	prefix := domain.URLFilter{URLPrefix: "https://example.com/docs"}
+	for _, f := range []*domain.URLFilter{&suffix, &prefix} {
+		if err := f.Normalize(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		filter domain.URLFilter
+		url    string
+		match  bool
+	}{
+		{suffix, "https://old-domain.com/page", true},
+		{suffix, "http://www.OLD-DOMAIN.com:8080/", true},
+		{suffix, "https://notold-domain.com/", false},
+		{suffix, "https://old-domain.com.evil.net/", false},
+		{prefix, "https://EXAMPLE.com/docs/intro", true},
+		{prefix, "https://example.com/blog", false},
+		{prefix, "http://example.com/docs", false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Matches(tt.url); got != tt.match {
+			t.Errorf("%+v matching %s: expected %v, got %v", tt.filter, tt.url, tt.match, got)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package domain_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/OrtemRepos/shortlink/internal/domain"
+)
+
+func TestCheckModeration(t *testing.T) {
+	decision := func(status domain.ModerationStatus) domain.Moderation {
+		return domain.Moderation{Status: status, Reason: domain.ReasonAdminReview, Actor: "admin"}
+	}
+	tests := []struct {
+		name    string
+		current domain.ModerationStatus
+		next    domain.Moderation
+		err     error
+	}{
+		{"flag clean", domain.ModerationClean, decision(domain.ModerationFlagged), nil},
+		{"block clean", domain.ModerationClean, decision(domain.ModerationBlocked), nil},
+		{"block flagged", domain.ModerationFlagged, decision(domain.ModerationBlocked), nil},
+		{"clear flagged", domain.ModerationFlagged, decision(domain.ModerationCleared), nil},
+		{"clear blocked", domain.ModerationBlocked, decision(domain.ModerationCleared), nil},
+		{"flag cleared", domain.ModerationCleared, decision(domain.ModerationFlagged), nil},
+		{"clear clean", domain.ModerationClean, decision(domain.ModerationCleared), domain.ErrModerationTransition},
+		{"flag flagged", domain.ModerationFlagged, decision(domain.ModerationFlagged), domain.ErrModerationTransition},
+		{"flag blocked", domain.ModerationBlocked, decision(domain.ModerationFlagged), domain.ErrModerationTransition},
+		{"clear cleared", domain.ModerationCleared, decision(domain.ModerationCleared), domain.ErrModerationTransition},
+		{"back to clean", domain.ModerationFlagged, decision(domain.ModerationClean), domain.ErrInvalidModeration},
+		{"unknown status", domain.ModerationClean, decision("hidden"), domain.ErrInvalidModeration},
+		{"unknown reason", domain.ModerationClean, domain.Moderation{Status: domain.ModerationFlagged, Reason: "spam", Actor: "admin"}, domain.ErrInvalidModeration},
+		{"no actor", domain.ModerationClean, domain.Moderation{Status: domain.ModerationFlagged, Reason: domain.ReasonBlocklist}, domain.ErrInvalidModeration},
+		{"long note", domain.ModerationClean, domain.Moderation{Status: domain.ModerationFlagged, Reason: domain.ReasonAbuseReport, Actor: "reports",
+			Note: strings.Repeat("x", domain.MaxModerationNote+1)}, domain.ErrInvalidModeration},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := domain.CheckModeration(tt.current, tt.next)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestModerationRestricted(t *testing.T) {
+	for status, restricted := range map[domain.ModerationStatus]bool{
+		"":                       false,
+		domain.ModerationClean:   false,
+		domain.ModerationFlagged: true,
+		domain.ModerationBlocked: true,
+		domain.ModerationCleared: false,
+	} {
+		if status.Restricted() != restricted {
+			t.Errorf("Expected %q restricted to be %v", status, restricted)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/OrtemRepos/shortlink/internal/domain"
+)
+
+func TestPrivacyOr(t *testing.T) {
+	for privacy, expected := range map[domain.Privacy]domain.Privacy{
+		domain.PrivacyDefault:    domain.PrivacyNoReferrer,
+		domain.PrivacyOff:        domain.PrivacyOff,
+		domain.PrivacyNoReferrer: domain.PrivacyNoReferrer,
+		domain.PrivacyDereferer:  domain.PrivacyDereferer,
+	} {
+		if !privacy.Valid() {
+			t.Errorf("Expected %q to be valid", privacy)
+		}
+		if got := privacy.Or(domain.PrivacyNoReferrer); got != expected {
+			t.Errorf("Expected %q or no-referrer to be %q, got %q", privacy, expected, got)
+		}
+	}
+	if domain.Privacy("hidden").Valid() {
+		t.Error("Expected an unknown mode to be invalid")
+	}
+}
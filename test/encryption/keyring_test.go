@@ -0,0 +1,125 @@
+package encryption_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/encryption"
+)
+
+var (
+	oldKey   = bytes.Repeat([]byte{1}, 32)
+	newKey   = bytes.Repeat([]byte{2}, 32)
+	indexKey = bytes.Repeat([]byte{3}, 32)
+)
+
+func TestRoundTrip(t *testing.T) {
+	kr, err := encryption.NewKeyring(map[string][]byte{"k1": oldKey}, "k1", indexKey)
+	require.NoError(t, err)
+
+	enc, err := kr.Encrypt("https://example.com/secret")
+	require.NoError(t, err)
+	assert.NotContains(t, enc, "example.com")
+	assert.True(t, kr.Current(enc))
+
+	again, err := kr.Encrypt("https://example.com/secret")
+	require.NoError(t, err)
+	assert.NotEqual(t, enc, again, "encryption must be randomized")
+
+	plain, err := kr.Decrypt(enc)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/secret", plain)
+}
+
+func TestDecryptPlaintextPassthrough(t *testing.T) {
+	kr, err := encryption.NewKeyring(map[string][]byte{"k1": oldKey}, "k1", indexKey)
+	require.NoError(t, err)
+
+	plain, err := kr.Decrypt("https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", plain)
+	assert.False(t, kr.Current("https://example.com"))
+}
+
+func TestDecryptTampered(t *testing.T) {
+	kr, err := encryption.NewKeyring(map[string][]byte{"k1": oldKey}, "k1", indexKey)
+	require.NoError(t, err)
+
+	enc, err := kr.Encrypt("https://example.com")
+	require.NoError(t, err)
+	tampered := enc[:len(enc)-2] + "AA"
+	_, err = kr.Decrypt(tampered)
+	assert.ErrorIs(t, err, encryption.ErrMalformed)
+
+	_, err = kr.Decrypt(strings.Replace(enc, ":k1:", ":k9:", 1))
+	assert.ErrorIs(t, err, encryption.ErrUnknownKey)
+}
+
+func TestBlindIndex(t *testing.T) {
+	kr, err := encryption.NewKeyring(map[string][]byte{"k1": oldKey}, "k1", indexKey)
+	require.NoError(t, err)
+	other, err := encryption.NewKeyring(map[string][]byte{"k1": oldKey}, "k1", bytes.Repeat([]byte{4}, 32))
+	require.NoError(t, err)
+
+	assert.Equal(t, kr.BlindIndex("https://example.com"), kr.BlindIndex("https://example.com"))
+	assert.NotEqual(t, kr.BlindIndex("https://example.com"), kr.BlindIndex("https://example.org"))
+	assert.NotEqual(t, kr.BlindIndex("https://example.com"), other.BlindIndex("https://example.com"))
+}
+
+func TestRotation(t *testing.T) {
+	before, err := encryption.NewKeyring(map[string][]byte{"k1": oldKey}, "k1", indexKey)
+	require.NoError(t, err)
+	after, err := encryption.NewKeyring(map[string][]byte{"k1": oldKey, "k2": newKey}, "k2", indexKey)
+	require.NoError(t, err)
+
+	enc, err := before.Encrypt("https://example.com")
+	require.NoError(t, err)
+	assert.False(t, after.Current(enc))
+
+	plain, err := after.Decrypt(enc)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", plain)
+
+	reenc, err := after.Encrypt(plain)
+	require.NoError(t, err)
+	assert.True(t, after.Current(reenc))
+	assert.True(t, strings.HasPrefix(reenc, "enc:v1:k2:"))
+	assert.Equal(t, before.BlindIndex(plain), after.BlindIndex(plain), "index key is not rotated with encryption keys")
+}
+
+func TestInvalidKeys(t *testing.T) {
+	_, err := encryption.NewKeyring(nil, "k1", indexKey)
+	assert.ErrorIs(t, err, encryption.ErrNoKeys)
+
+	_, err = encryption.NewKeyring(map[string][]byte{"k1": oldKey[:16]}, "k1", indexKey)
+	assert.Error(t, err)
+
+	_, err = encryption.NewKeyring(map[string][]byte{"k1": oldKey}, "k2", indexKey)
+	assert.Error(t, err)
+
+	_, err = encryption.NewKeyring(map[string][]byte{"k1": oldKey}, "k1", indexKey[:8])
+	assert.Error(t, err)
+}
+
+func TestFromConfig(t *testing.T) {
+	cfg := &configs.Config{}
+	kr, err := encryption.FromConfig(cfg)
+	require.NoError(t, err)
+	assert.Nil(t, kr, "disabled encryption yields no keyring")
+
+	cfg.Encryption.Enabled = true
+	_, err = encryption.FromConfig(cfg)
+	assert.ErrorIs(t, err, encryption.ErrNoKeys, "enabled without keys must fail startup")
+
+	cfg.Encryption.Keys = "k1:AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+	cfg.Encryption.PrimaryKeyID = "k1"
+	cfg.Encryption.IndexKey = "AwMDAwMDAwMDAwMDAwMDAwMDAwMDAwMDAwMDAwMDAwM="
+	kr, err = encryption.FromConfig(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, kr)
+}
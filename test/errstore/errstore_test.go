@@ -0,0 +1,82 @@
+package errstore_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/errstore"
+)
+
+func TestStoreStaysBounded(t *testing.T) {
+	store := errstore.NewStore(50, nil)
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2500; i++ {
+				store.Add(errors.New("db down"))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, store.Recent(), 50)
+	assert.Equal(t, int64(10000), store.Total())
+	assert.Equal(t, int64(9950), store.Dropped())
+
+	entries, missed := store.Collect()
+	assert.Len(t, entries, 50)
+	assert.Equal(t, int64(9950), missed)
+}
+
+func TestStoreKeepsNewest(t *testing.T) {
+	store := errstore.NewStore(3, nil)
+	for i := 1; i <= 5; i++ {
+		store.Add(fmt.Errorf("error %d", i))
+	}
+	messages := func(entries []errstore.Entry) []string {
+		var result []string
+		for _, e := range entries {
+			result = append(result, e.Error)
+		}
+		return result
+	}
+	assert.Equal(t, []string{"error 3", "error 4", "error 5"}, messages(store.Recent()))
+
+	_, _ = store.Collect()
+	store.Add(errors.New("error 6"))
+	entries, missed := store.Collect()
+	assert.Equal(t, []string{"error 6"}, messages(entries), "Collect returns what it has not returned yet")
+	assert.Zero(t, missed)
+	assert.Equal(t, []string{"error 4", "error 5", "error 6"}, messages(store.Recent()), "Collect keeps errors")
+
+	drained := store.Drain()
+	assert.Len(t, drained, 3)
+	assert.Empty(t, store.Recent())
+	assert.Equal(t, int64(3), store.Dropped(), "drained errors are not dropped")
+	assert.ErrorContains(t, errstore.Join(drained), "error 6")
+	assert.NoError(t, errstore.Join(store.Drain()))
+}
+
+func TestGroupByError(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := errstore.NewStore(10, fake)
+	for _, message := range []string{"timeout", "refused", "timeout", "auth", "timeout", "refused"} {
+		store.Add(errors.New(message))
+		fake.Advance(time.Second)
+	}
+	groups := errstore.GroupByError(store.Recent())
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.Len(t, groups, 3)
+	assert.Equal(t, errstore.Group{Error: "timeout", Count: 3, First: start, Last: start.Add(4 * time.Second)}, groups[0])
+	assert.Equal(t, errstore.Group{Error: "refused", Count: 2, First: start.Add(time.Second), Last: start.Add(5 * time.Second)}, groups[1])
+	assert.Equal(t, "auth", groups[2].Error)
+	assert.Empty(t, errstore.GroupByError(nil))
+}
@@ -0,0 +1,115 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/health"
+)
+
+var errDown = errors.New("connection refused")
+
+func probe(err error) func(context.Context) error {
+	return func(context.Context) error { return err }
+}
+
+func TestTimeoutEnforced(t *testing.T) {
+	r := health.NewRegistry(time.Second, 0, 10)
+	release := make(chan struct{})
+	defer close(release)
+	require.NoError(t, r.Register(health.Check{
+		Name:     "stuck",
+		Timeout:  20 * time.Millisecond,
+		Critical: true,
+		// Ignores ctx on purpose: the registry must not wait for it.
+		Probe: func(context.Context) error { <-release; return nil },
+	}))
+	require.NoError(t, r.Register(health.Check{Name: "fast", Timeout: time.Second, Probe: probe(nil)}))
+
+	start := time.Now()
+	report := r.Check(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.False(t, report.Ready)
+	require.Len(t, report.Checks, 2)
+	assert.Equal(t, health.StatusOK, report.Checks[0].Status)
+	assert.Equal(t, "stuck", report.Checks[1].Name)
+	assert.Equal(t, health.StatusTimeout, report.Checks[1].Status)
+}
+
+func TestOverallBudget(t *testing.T) {
+	r := health.NewRegistry(20*time.Millisecond, 0, 10)
+	require.NoError(t, r.Register(health.Check{
+		Name:    "slow",
+		Timeout: time.Minute,
+		Probe: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}))
+	start := time.Now()
+	report := r.Check(context.Background())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, health.StatusTimeout, report.Checks[0].Status)
+}
+
+func TestCriticality(t *testing.T) {
+	r := health.NewRegistry(time.Second, 0, 10)
+	require.NoError(t, r.Register(health.Check{Name: "cache", Timeout: time.Second, Probe: probe(errDown)}))
+	require.NoError(t, r.Register(health.Check{Name: "database", Timeout: time.Second, Critical: true, Probe: probe(nil)}))
+
+	report := r.Check(context.Background())
+	assert.True(t, report.Ready, "a failing non-critical check only annotates")
+	assert.Equal(t, health.StatusFailed, report.Checks[0].Status)
+	assert.Equal(t, errDown.Error(), report.Checks[0].Error)
+	assert.Empty(t, report.Redacted().Checks[0].Error)
+
+	r = health.NewRegistry(time.Second, 0, 10)
+	require.NoError(t, r.Register(health.Check{Name: "database", Timeout: time.Second, Critical: true, Probe: probe(errDown)}))
+	assert.False(t, r.Check(context.Background()).Ready)
+}
+
+func TestResultsCached(t *testing.T) {
+	var calls atomic.Int32
+	var fail atomic.Bool
+	r := health.NewRegistry(time.Second, 50*time.Millisecond, 10)
+	require.NoError(t, r.Register(health.Check{
+		Name:    "counted",
+		Timeout: time.Second,
+		Probe: func(context.Context) error {
+			calls.Add(1)
+			if fail.Load() {
+				return errDown
+			}
+			return nil
+		},
+	}))
+
+	for i := 0; i < 5; i++ {
+		r.Check(context.Background())
+	}
+	assert.Equal(t, int32(1), calls.Load())
+
+	fail.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	report := r.Check(context.Background())
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, health.StatusFailed, report.Checks[0].Status)
+
+	history := r.History()
+	require.Len(t, history, 1)
+	assert.Equal(t, health.StatusOK, history[0].From)
+	assert.Equal(t, health.StatusFailed, history[0].To)
+}
+
+func TestRegisterValidation(t *testing.T) {
+	r := health.NewRegistry(time.Second, 0, 10)
+	require.NoError(t, r.Register(health.Check{Name: "a", Timeout: time.Second, Probe: probe(nil)}))
+	assert.ErrorIs(t, r.Register(health.Check{Name: "a", Timeout: time.Second, Probe: probe(nil)}), health.ErrCheckExists)
+	assert.ErrorIs(t, r.Register(health.Check{Name: "b", Probe: probe(nil)}), health.ErrInvalidCheck)
+}
@@ -0,0 +1,73 @@
+package httpmetrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/httpmetrics"
+)
+
+func TestRequestsByRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fake := clock.NewFake(time.Unix(0, 0))
+	metrics := httpmetrics.New(fake)
+	router := gin.New()
+	router.Use(metrics.Middleware())
+	router.GET("/links/:code", func(c *gin.Context) {
+		fake.Advance(30 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/links/a"},
+		{http.MethodGet, "/links/b"},
+		{"BREW", "/coffee"},
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	expected := `
+# HELP shortlink_http_request_duration_seconds Time taken to serve requests, by route, method and status.
+# TYPE shortlink_http_request_duration_seconds histogram
+shortlink_http_request_duration_seconds_bucket{method="GET",route="/links/:code",status="200",le="0.005"} 0
+shortlink_http_request_duration_seconds_bucket{method="GET",route="/links/:code",status="200",le="0.01"} 0
+shortlink_http_request_duration_seconds_bucket{method="GET",route="/links/:code",status="200",le="0.025"} 0
+shortlink_http_request_duration_seconds_bucket{method="GET",route="/links/:code",status="200",le="0.05"} 2
+shortlink_http_request_duration_seconds_bucket{method="GET",route="/links/:code",status="200",le="0.1"} 2
+shortlink_http_request_duration_seconds_bucket{method="GET",route="/links/:code",status="200",le="0.25"} 2
+shortlink_http_request_duration_seconds_bucket{method="GET",route="/links/:code",status="200",le="0.5"} 2
+shortlink_http_request_duration_seconds_bucket{method="GET",route="/links/:code",status="200",le="1"} 2
+shortlink_http_request_duration_seconds_bucket{method="GET",route="/links/:code",status="200",le="2.5"} 2
+shortlink_http_request_duration_seconds_bucket{method="GET",route="/links/:code",status="200",le="5"} 2
+shortlink_http_request_duration_seconds_bucket{method="GET",route="/links/:code",status="200",le="10"} 2
+shortlink_http_request_duration_seconds_bucket{method="GET",route="/links/:code",status="200",le="+Inf"} 2
+shortlink_http_request_duration_seconds_sum{method="GET",route="/links/:code",status="200"} 0.06
+shortlink_http_request_duration_seconds_count{method="GET",route="/links/:code",status="200"} 2
+shortlink_http_request_duration_seconds_bucket{method="other",route="unmatched",status="404",le="0.005"} 1
+shortlink_http_request_duration_seconds_bucket{method="other",route="unmatched",status="404",le="0.01"} 1
+shortlink_http_request_duration_seconds_bucket{method="other",route="unmatched",status="404",le="0.025"} 1
+shortlink_http_request_duration_seconds_bucket{method="other",route="unmatched",status="404",le="0.05"} 1
+shortlink_http_request_duration_seconds_bucket{method="other",route="unmatched",status="404",le="0.1"} 1
+shortlink_http_request_duration_seconds_bucket{method="other",route="unmatched",status="404",le="0.25"} 1
+shortlink_http_request_duration_seconds_bucket{method="other",route="unmatched",status="404",le="0.5"} 1
+shortlink_http_request_duration_seconds_bucket{method="other",route="unmatched",status="404",le="1"} 1
+shortlink_http_request_duration_seconds_bucket{method="other",route="unmatched",status="404",le="2.5"} 1
+shortlink_http_request_duration_seconds_bucket{method="other",route="unmatched",status="404",le="5"} 1
+shortlink_http_request_duration_seconds_bucket{method="other",route="unmatched",status="404",le="10"} 1
+shortlink_http_request_duration_seconds_bucket{method="other",route="unmatched",status="404",le="+Inf"} 1
+shortlink_http_request_duration_seconds_sum{method="other",route="unmatched",status="404"} 0
+shortlink_http_request_duration_seconds_count{method="other",route="unmatched",status="404"} 1
+# HELP shortlink_http_requests_total Requests served, by route, method and status.
+# TYPE shortlink_http_requests_total counter
+shortlink_http_requests_total{method="GET",route="/links/:code",status="200"} 2
+shortlink_http_requests_total{method="other",route="unmatched",status="404"} 1
+`
+	require.NoError(t, testutil.CollectAndCompare(metrics, strings.NewReader(expected)))
+}
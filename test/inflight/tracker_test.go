@@ -0,0 +1,43 @@
+package inflight_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/inflight"
+)
+
+func TestWaitBoundedByContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tracker := inflight.NewTracker()
+	router := gin.New()
+	entered, release := make(chan struct{}), make(chan struct{})
+	router.GET("/", inflight.Middleware(tracker), func(c *gin.Context) {
+		close(entered)
+		<-release
+		c.Status(http.StatusOK)
+	})
+	go router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, tracker.Wait(ctx), context.DeadlineExceeded)
+	assert.True(t, tracker.Draining())
+	assert.Equal(t, int64(1), tracker.InFlight())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	close(release)
+	require.NoError(t, tracker.Wait(context.Background()))
+	assert.Zero(t, tracker.InFlight())
+}
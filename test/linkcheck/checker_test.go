@@ -0,0 +1,84 @@
+package linkcheck_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/OrtemRepos/shortlink/internal/linkcheck"
+)
+
+func destination(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/get-only", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/hop1", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	mux.HandleFunc("/hop3", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/hop2", http.StatusFound)
+	})
+	mux.HandleFunc("/hop2", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/hop1", http.StatusFound)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheck(t *testing.T) {
+	server := destination(t)
+	client := server.Client()
+	client.Timeout = 100 * time.Millisecond
+	checker := linkcheck.NewChecker(client, 2)
+
+	tests := []struct {
+		path   string
+		status string
+		health string
+	}{
+		{"/ok", "200", linkcheck.HealthOK},
+		{"/gone", "404", linkcheck.HealthBroken},
+		{"/get-only", "200", linkcheck.HealthOK},
+		{"/hop2", "200", linkcheck.HealthOK},
+		{"/hop3", linkcheck.StatusTooManyRedirects, linkcheck.HealthBroken},
+		{"/slow", linkcheck.StatusTimeout, linkcheck.HealthBroken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			status := checker.Check(context.Background(), server.URL+tt.path)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.health, linkcheck.HealthOf(status))
+		})
+	}
+}
+
+func TestCheckNetworkErrors(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	closedURL := server.URL
+	server.Close()
+	checker := linkcheck.NewChecker(&http.Client{Timeout: time.Second}, 2)
+
+	assert.Equal(t, linkcheck.StatusRefused, checker.Check(context.Background(), closedURL))
+	assert.Equal(t, linkcheck.StatusDNSError, checker.Check(context.Background(), "http://shortlink-check.invalid/"))
+	assert.Equal(t, linkcheck.StatusInvalidURL, checker.Check(context.Background(), "ftp://example.com/file"))
+	assert.Equal(t, linkcheck.HealthUnknown, linkcheck.HealthOf(""))
+}
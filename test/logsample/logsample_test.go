@@ -0,0 +1,99 @@
+package logsample_test
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/logsample"
+)
+
+func newSampler(size int) (*logsample.Sampler, *clock.Fake) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	return logsample.New(size, time.Minute, fake), fake
+}
+
+func TestOncePerInterval(t *testing.T) {
+	sampler, fake := newSampler(10)
+	assert.True(t, sampler.Allow("a"))
+	assert.False(t, sampler.Allow("a"))
+	assert.True(t, sampler.Allow("b"), "keys are sampled apart")
+	fake.Advance(59 * time.Second)
+	assert.False(t, sampler.Allow("a"))
+	fake.Advance(time.Second)
+	assert.True(t, sampler.Allow("a"))
+	assert.False(t, sampler.Allow("a"), "the interval starts over once logged")
+}
+
+func TestBounded(t *testing.T) {
+	sampler, _ := newSampler(2)
+	assert.True(t, sampler.Allow("hot"))
+	assert.True(t, sampler.Allow("a"))
+	assert.False(t, sampler.Allow("hot"), "seeing a key keeps it")
+	assert.True(t, sampler.Allow("b"), "pushes out a, the least recently seen")
+	assert.Equal(t, 2, sampler.Len())
+	assert.False(t, sampler.Allow("hot"))
+	assert.True(t, sampler.Allow("a"), "forgotten keys are logged again")
+	assert.Equal(t, 2, sampler.Len())
+}
+
+func TestConcurrentAllow(t *testing.T) {
+	sampler, _ := newSampler(100)
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				if sampler.Allow(fmt.Sprintf("code-%d", (i+j)%10)) {
+					allowed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(10), allowed.Load())
+}
+
+func TestInvalidSize(t *testing.T) {
+	assert.Panics(t, func() { logsample.New(0, time.Minute, nil) })
+}
+
+func jsonLogger(level zapcore.Level) *zap.Logger {
+	return zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(io.Discard), level))
+}
+
+// BenchmarkFindLogging compares the logging of lookups of a popular link, as
+// PostgreRepository.Find did it and as it does now, with debug logs off and on.
+func BenchmarkFindLogging(b *testing.B) {
+	url := domain.URL{ShortURL: "abcd1234", OriginalURL: "https://example.com/viral", UUID: "user", CreatedAt: time.Now()}
+	b.Run("info every lookup", func(b *testing.B) {
+		log := jsonLogger(zap.InfoLevel)
+		b.ReportAllocs()
+		for range b.N {
+			log.Info("Find in storage", zap.Any("url", url))
+		}
+	})
+	for name, level := range map[string]zapcore.Level{"sampled debug off": zap.InfoLevel, "sampled debug on": zap.DebugLevel} {
+		b.Run(name, func(b *testing.B) {
+			log := jsonLogger(level)
+			sampler := logsample.New(1024, time.Minute, nil)
+			b.ReportAllocs()
+			for range b.N {
+				if log.Core().Enabled(zap.DebugLevel) && sampler.Allow(url.ShortURL) {
+					log.Debug("Find in storage", zap.String("short_url", url.ShortURL))
+				}
+			}
+		})
+	}
+}
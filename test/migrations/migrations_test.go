@@ -0,0 +1,294 @@
+package migrations_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/migrations"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// dsnEnv names a key/value DSN of a disposable Postgres; the tests are skipped without it.
+const dsnEnv = "SHORTLINK_TEST_DATABASE_DSN"
+
+const legacySchema = `
+CREATE TABLE urls (
+	user_id      UUID NOT NULL,
+	short_url    TEXT NOT NULL UNIQUE,
+	original_url TEXT NOT NULL,
+	is_deleted   BOOLEAN DEFAULT FALSE,
+	PRIMARY KEY (user_id, original_url)
+);
+CREATE INDEX idx_short_url ON urls (short_url);
+CREATE INDEX idx_user_id ON urls (user_id);`
+
+// openIsolated returns a connection pool bound to a fresh schema dropped after the test.
+func openIsolated(t *testing.T) *sqlx.DB {
+	t.Helper()
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", dsnEnv)
+	}
+	admin, err := sqlx.Open("pgx", dsn)
+	require.NoError(t, err)
+	schema := fmt.Sprintf("migrations_test_%d", time.Now().UnixNano())
+	admin.MustExec("CREATE SCHEMA " + schema)
+	t.Cleanup(func() {
+		admin.MustExec("DROP SCHEMA " + schema + " CASCADE")
+		_ = admin.Close()
+	})
+
+	db, err := sqlx.Open("pgx", dsn+" search_path="+schema)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+type index struct {
+	Valid bool   `db:"valid"`
+	Def   string `db:"def"`
+}
+
+// indexes returns the indexes of urls and urls_archive by name, with their
+// definitions as pg_indexes.indexdef prints them, schema left out.
+func indexes(t *testing.T, db *sqlx.DB) map[string]index {
+	t.Helper()
+	var rows []struct {
+		Name string `db:"name"`
+		index
+	}
+	err := db.Select(&rows, `
+		SELECT c.relname AS name, i.indisvalid AS valid,
+			replace(pg_get_indexdef(i.indexrelid), current_schema() || '.', '') AS def
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		JOIN pg_class t ON t.oid = i.indrelid
+		WHERE t.relname IN ('urls', 'urls_archive') AND t.relnamespace = current_schema()::regnamespace`)
+	require.NoError(t, err)
+	result := make(map[string]index, len(rows))
+	for _, r := range rows {
+		result[r.Name] = r.index
+	}
+	return result
+}
+
+// createIndex matches the indexes the migrations create, by name and definition.
+var createIndex = regexp.MustCompile(`CREATE (?:UNIQUE )?INDEX (?:CONCURRENTLY )?IF NOT EXISTS (\w+)\s+(ON [^;]+);`)
+
+// noops are the applied migrations that create nothing, kept as they shipped.
+var noops = map[int]bool{17: true}
+
+// TestPostgreMigrationsUnique guards against a migration reusing the name of an
+// index with another definition: IF NOT EXISTS would then silently create nothing.
+func TestPostgreMigrationsUnique(t *testing.T) {
+	versions := make(map[int]bool)
+	names := make(map[string]bool)
+	defs := make(map[string]string)
+	for _, m := range adapters.PostgreMigrations() {
+		assert.False(t, versions[m.Version], "version %d is reused", m.Version)
+		versions[m.Version] = true
+		if noops[m.Version] {
+			continue
+		}
+		assert.False(t, names[m.Name], "name %s is reused", m.Name)
+		names[m.Name] = true
+		for _, match := range createIndex.FindAllStringSubmatch(m.SQL, -1) {
+			def := strings.Join(strings.Fields(match[2]), " ")
+			if prev, ok := defs[match[1]]; ok {
+				assert.Equal(t, prev, def, "%d_%s redefines %s", m.Version, m.Name, match[1])
+			}
+			defs[match[1]] = def
+		}
+	}
+	assert.Contains(t, defs, "idx_urls_user_created_short")
+}
+
+func TestPostgreMigrationsFromLegacySchema(t *testing.T) {
+	db := openIsolated(t)
+	ctx := context.Background()
+	db.MustExec(legacySchema)
+
+	require.NoError(t, migrations.Run(ctx, db, adapters.PostgreMigrations()))
+	require.NoError(t, migrations.Run(ctx, db, adapters.PostgreMigrations()), "second run must be a no-op")
+
+	var versions []int
+	require.NoError(t, db.Select(&versions, "SELECT version FROM schema_migrations ORDER BY version"))
+	assert.Len(t, versions, len(adapters.PostgreMigrations()))
+
+	idx := indexes(t, db)
+	assert.NotContains(t, idx, "idx_short_url")
+	assert.NotContains(t, idx, "idx_user_id")
+	want := map[string]string{
+		"urls_short_url_key":     "CREATE UNIQUE INDEX urls_short_url_key ON urls USING btree (short_url)",
+		"idx_urls_user_created":  "CREATE INDEX idx_urls_user_created ON urls USING btree (user_id, created_at)",
+		"idx_urls_deleted":       "CREATE INDEX idx_urls_deleted ON urls USING btree (is_deleted, updated_at) WHERE is_deleted",
+		"idx_urls_user_host_rev": "CREATE INDEX idx_urls_user_host_rev ON urls USING btree (user_id, dest_host_rev text_pattern_ops) WHERE (NOT is_deleted)",
+		"idx_urls_user_created_short": "CREATE INDEX idx_urls_user_created_short ON urls " +
+			"USING btree (user_id, created_at, short_url) WHERE (NOT is_deleted)",
+		"idx_urls_archive_user_created": "CREATE INDEX idx_urls_archive_user_created ON urls_archive " +
+			"USING btree (user_id, created_at, short_url) WHERE (NOT is_deleted)",
+	}
+	for name, def := range want {
+		if assert.Contains(t, idx, name) {
+			assert.True(t, idx[name].Valid, name)
+			assert.Equal(t, def, idx[name].Def)
+		}
+	}
+}
+
+func TestPostgreMigrationsBackfillHost(t *testing.T) {
+	db := openIsolated(t)
+	ctx := context.Background()
+	db.MustExec(legacySchema)
+	db.MustExec(`INSERT INTO urls (user_id, short_url, original_url) VALUES
+		('00000000-0000-0000-0000-000000000001', 'plain', 'HTTPS://user@Sub.Example.com:8443/path'),
+		('00000000-0000-0000-0000-000000000001', 'other', 'mailto:someone@example.com')`)
+	require.NoError(t, migrations.Run(ctx, db, adapters.PostgreMigrations()))
+
+	var rows []struct {
+		ShortURL string  `db:"short_url"`
+		HostRev  *string `db:"dest_host_rev"`
+	}
+	require.NoError(t, db.Select(&rows, "SELECT short_url, dest_host_rev FROM urls ORDER BY short_url"))
+	require.Len(t, rows, 2)
+	assert.Nil(t, rows[0].HostRev, "URLs without an http host are left alone")
+	if assert.NotNil(t, rows[1].HostRev) {
+		assert.Equal(t, "com.example.sub.", *rows[1].HostRev)
+	}
+}
+
+func TestPostgreMigrationsRebuildInvalidIndex(t *testing.T) {
+	db := openIsolated(t)
+	ctx := context.Background()
+	list := []migrations.Migration{
+		{Version: 1, Name: "create_items", SQL: `CREATE TABLE items (v INTEGER);`},
+		{Version: 2, Name: "create_idx_items_v", SQL: `CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS idx_items_v ON items (v);`, NoTx: true},
+	}
+	require.NoError(t, migrations.Run(ctx, db, list[:1]))
+	db.MustExec("INSERT INTO items VALUES (1), (1)")
+	require.Error(t, migrations.Run(ctx, db, list), "duplicates fail the unique build")
+	valid := func() []bool {
+		var valid []bool
+		require.NoError(t, db.Select(&valid, `SELECT i.indisvalid FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid
+			WHERE c.relname = 'idx_items_v' AND c.relnamespace = current_schema()::regnamespace`))
+		return valid
+	}
+	require.Equal(t, []bool{false}, valid(), "the failed build leaves an invalid index")
+
+	db.MustExec("DELETE FROM items WHERE ctid = (SELECT max(ctid) FROM items)")
+	require.NoError(t, migrations.Run(ctx, db, list))
+	assert.Equal(t, []bool{true}, valid(), "the invalid index is rebuilt, not taken for done")
+}
+
+func TestPostgreMigrationsFreshDatabase(t *testing.T) {
+	db := openIsolated(t)
+	require.NoError(t, migrations.Run(context.Background(), db, adapters.PostgreMigrations()))
+
+	db.MustExec(`INSERT INTO urls (user_id, short_url, original_url)
+		VALUES ('00000000-0000-0000-0000-000000000001', 'abc', 'https://example.com')`)
+	var createdSet bool
+	require.NoError(t, db.Get(&createdSet, "SELECT created_at IS NOT NULL AND updated_at IS NOT NULL FROM urls"))
+	assert.True(t, createdSet)
+}
+
+// TestPostgreIndexPlans checks that the queries each index was added for can use
+// it. Sequential scans are disabled: the tables are too small for the planner to
+// prefer an index otherwise.
+func TestPostgreIndexPlans(t *testing.T) {
+	db := openIsolated(t)
+	ctx := context.Background()
+	require.NoError(t, migrations.Run(ctx, db, adapters.PostgreMigrations()))
+	db.MustExec(`INSERT INTO urls (user_id, short_url, original_url, is_deleted)
+		SELECT ('00000000-0000-0000-0000-' || lpad((i % 50)::text, 12, '0'))::uuid,
+			'code' || i, 'https://example.com/' || i, i % 10 = 0
+		FROM generate_series(1, 2000) AS i`)
+	db.MustExec("ANALYZE urls")
+
+	const user = "'00000000-0000-0000-0000-000000000007'"
+	tests := []struct {
+		name  string
+		query string
+		index string
+	}{
+		{"Lookup", "SELECT original_url FROM urls WHERE short_url = 'code42'", "urls_short_url_key"},
+		{"Listing", "SELECT short_url FROM urls WHERE user_id = " + user + " ORDER BY created_at", "idx_urls_user_created"},
+		{"Purge", "SELECT short_url FROM urls WHERE is_deleted AND updated_at < now()", "idx_urls_deleted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := db.MustBegin()
+			defer func() { _ = tx.Rollback() }()
+			tx.MustExec("SET LOCAL enable_seqscan = off")
+			var lines []string
+			require.NoError(t, tx.Select(&lines, "EXPLAIN "+tt.query))
+			plan := strings.Join(lines, "\n")
+			t.Log(plan)
+			assert.Regexp(t, `Index (Only )?Scan (using|on) `+tt.index+`\b`, plan)
+			assert.NotContains(t, plan, "Sort", "the index gives the order")
+		})
+	}
+}
+
+// sortNode matches a Sort or Incremental Sort node of a plan, not the Sort Key of a Merge Append.
+var sortNode = regexp.MustCompile(`(?m)^\s*(->\s+)?(Incremental )?Sort\s+\(`)
+
+// cursorSeek matches an index condition seeking to the cursor of findByUserAfterQuery.
+var cursorSeek = regexp.MustCompile(`Index Cond: .*ROW\((\w+\.)?created_at, (\w+\.)?short_url\) > ROW\(\$2, \$3\)`)
+
+// TestPostgreUserLinksPlans checks the generic plans of the queries of FindByUser,
+// those a prepared statement settles on: both tables are read in order from their
+// indexes, and past a cursor the indexes seek to it.
+func TestPostgreUserLinksPlans(t *testing.T) {
+	db := openIsolated(t)
+	ctx := context.Background()
+	require.NoError(t, migrations.Run(ctx, db, adapters.PostgreMigrations()))
+	for _, table := range []string{"urls", "urls_archive"} {
+		db.MustExec(`INSERT INTO ` + table + ` (user_id, short_url, original_url, is_deleted, created_at)
+			SELECT ('00000000-0000-0000-0000-' || lpad((i % 50)::text, 12, '0'))::uuid,
+				'` + table + `' || i, 'https://example.com/' || i, i % 10 = 0, now() - i * interval '1 minute'
+			FROM generate_series(1, 2000) AS i`)
+		db.MustExec("ANALYZE " + table)
+	}
+
+	const user = "'00000000-0000-0000-0000-000000000007'"
+	queries := adapters.PostgreUserLinksQueries()
+	tests := []struct {
+		name string
+		args string
+		seek bool
+	}{
+		{"first", user + ", 10, 0, ''", false},
+		{"after", user + ", now() - interval '1 day', 'urls1', 10, ''", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := db.MustBegin()
+			defer func() { _ = tx.Rollback() }()
+			tx.MustExec("SET LOCAL enable_seqscan = off")
+			tx.MustExec("SET LOCAL plan_cache_mode = force_generic_plan")
+			tx.MustExec("PREPARE user_links_" + tt.name + " AS " + queries[tt.name])
+			var lines []string
+			require.NoError(t, tx.Select(&lines, "EXPLAIN EXECUTE user_links_"+tt.name+"("+tt.args+")"))
+			plan := strings.Join(lines, "\n")
+			t.Log(plan)
+			for _, index := range []string{"idx_urls_user_created_short", "idx_urls_archive_user_created"} {
+				assert.Regexp(t, `Index (Only )?Scan (using|on) `+index+`\b`, plan)
+			}
+			assert.NotRegexp(t, sortNode, plan, "the indexes give the order")
+			if tt.seek {
+				assert.Len(t, cursorSeek.FindAllString(plan, -1), 2, "both indexes seek to the cursor")
+			}
+		})
+	}
+}
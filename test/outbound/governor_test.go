@@ -0,0 +1,140 @@
+package outbound_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/outbound"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newGovernor(rate float64, burst, concurrent int, opts ...outbound.GovernorOption) *outbound.Governor {
+	cfg := &configs.Config{}
+	cfg.Outbound.RatePerHost = rate
+	cfg.Outbound.BurstPerHost = burst
+	cfg.Outbound.MaxConcurrent = concurrent
+	return outbound.NewGovernor(cfg, opts...)
+}
+
+// canceled makes Acquire give up as soon as it would have to wait.
+func canceled() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func TestHostsLimitedIndependently(t *testing.T) {
+	g := newGovernor(1, 1, 10, outbound.WithClock(clock.NewFake(epoch)))
+
+	release, err := g.Acquire(context.Background(), "a.example.com")
+	require.NoError(t, err)
+	release()
+
+	_, err = g.Acquire(canceled(), "a.example.com")
+	assert.ErrorIs(t, err, context.Canceled, "a.example.com has no tokens left")
+
+	release, err = g.Acquire(canceled(), "b.example.com")
+	require.NoError(t, err, "b.example.com has its own bucket")
+	release()
+
+	stats := g.Stats()
+	assert.Equal(t, uint64(2), stats.Allowed)
+	assert.Equal(t, uint64(1), stats.Throttled)
+	assert.Equal(t, uint64(1), stats.TimedOut)
+	assert.Equal(t, 2, stats.Hosts)
+}
+
+func TestTokensRefill(t *testing.T) {
+	fake := clock.NewFake(epoch)
+	g := newGovernor(10, 1, 10, outbound.WithClock(fake))
+
+	release, err := g.Acquire(context.Background(), "a.example.com")
+	require.NoError(t, err)
+	release()
+
+	done := make(chan error, 1)
+	go func() {
+		release, err := g.Acquire(context.Background(), "a.example.com")
+		if err == nil {
+			release()
+		}
+		done <- err
+	}()
+	fake.BlockUntil(1)
+	fake.Advance(50 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("a token takes 100ms to refill")
+	default:
+	}
+
+	fake.Advance(50 * time.Millisecond)
+	require.NoError(t, <-done)
+	assert.Equal(t, uint64(1), g.Stats().Throttled, "a request is throttled once however long it waits")
+
+	fake.Advance(time.Hour)
+	release, err = g.Acquire(canceled(), "a.example.com")
+	require.NoError(t, err, "the bucket refills up to the burst")
+	release()
+	_, err = g.Acquire(canceled(), "a.example.com")
+	assert.ErrorIs(t, err, context.Canceled, "the bucket never holds more than the burst")
+}
+
+func TestGlobalConcurrencyCap(t *testing.T) {
+	g := newGovernor(1000, 100, 2, outbound.WithClock(clock.NewFake(epoch)))
+
+	first, err := g.Acquire(context.Background(), "a.example.com")
+	require.NoError(t, err)
+	second, err := g.Acquire(context.Background(), "b.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, 2, g.Stats().InFlight)
+
+	_, err = g.Acquire(canceled(), "c.example.com")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	first()
+	first()
+	third, err := g.Acquire(context.Background(), "c.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, 2, g.Stats().InFlight, "releasing twice frees one slot")
+	second()
+	third()
+	assert.Equal(t, 0, g.Stats().InFlight)
+}
+
+func TestPrivateDestinationsRefused(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	g := newGovernor(1000, 100, 2)
+	client := g.Client(time.Second)
+
+	_, err := client.Get(server.URL)
+	assert.ErrorIs(t, err, outbound.ErrPrivateDestination)
+
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	_, err = client.Get("http://localhost:" + port)
+	assert.ErrorIs(t, err, outbound.ErrPrivateDestination, "names resolving to loopback are refused at dial time")
+
+	assert.Equal(t, uint64(2), g.Stats().Refused)
+	assert.Equal(t, 0, g.Stats().InFlight)
+}
+
+func TestCheckIP(t *testing.T) {
+	for _, ip := range []string{"10.0.0.1", "172.16.0.1", "192.168.1.1", "127.0.0.1", "169.254.169.254", "100.64.0.1", "::1", "fc00::1", "0.0.0.0"} {
+		assert.ErrorIs(t, outbound.CheckIP(net.ParseIP(ip)), outbound.ErrPrivateDestination, ip)
+	}
+	assert.NoError(t, outbound.CheckIP(net.ParseIP("93.184.216.34")))
+}
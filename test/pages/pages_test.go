@@ -0,0 +1,114 @@
+package pages_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/OrtemRepos/shortlink/internal/pages"
+)
+
+func render(t *testing.T, r *pages.Renderer, page, acceptLanguage string, data any) (string, string) {
+	t.Helper()
+	var body strings.Builder
+	lang, err := r.Render(&body, page, acceptLanguage, data)
+	require.NoError(t, err)
+	return lang, body.String()
+}
+
+func TestLanguages(t *testing.T) {
+	assert.Equal(t, []string{"pt-br", "pt", "en"}, pages.Languages("en;q=0.5, pt-BR"))
+	assert.Equal(t, []string{"de"}, pages.Languages("fr;q=0, *, de;q=0.3"))
+	assert.Empty(t, pages.Languages(""))
+}
+
+func TestRenderPicksLanguage(t *testing.T) {
+	r := pages.NewRenderer("")
+	data := pages.TombstoneData{ShortURL: "abc"}
+
+	lang, body := render(t, r, pages.Tombstone, "ru-RU,ru;q=0.9,en;q=0.8", data)
+	assert.Equal(t, "ru", lang)
+	assert.Contains(t, body, "Эта ссылка удалена")
+
+	lang, body = render(t, r, pages.Tombstone, "de-DE", data)
+	assert.Equal(t, "en", lang, "English is the fallback")
+	assert.Contains(t, body, "This link has been deleted")
+
+	_, err := r.Render(&strings.Builder{}, "missing", "", data)
+	assert.ErrorIs(t, err, pages.ErrUnknownPage)
+}
+
+func TestRenderEscapes(t *testing.T) {
+	r := pages.NewRenderer("")
+	_, body := render(t, r, pages.Tombstone, "", pages.TombstoneData{ShortURL: "<script>alert(1)</script>"})
+	assert.NotContains(t, body, "<script>alert(1)")
+	assert.Contains(t, body, "&lt;script&gt;alert(1)&lt;/script&gt;")
+
+	_, body = render(t, r, pages.Interstitial, "", pages.InterstitialData{
+		ShortURL:    "abc",
+		Destination: `https://example.com/?q="><script>alert(1)</script>`,
+	})
+	assert.NotContains(t, body, `"><script>`)
+	assert.Contains(t, body, `href="https://example.com/?q=%22%3e%3cscript%3ealert%281%29%3c/script%3e"`)
+
+	_, body = render(t, r, pages.Interstitial, "", pages.InterstitialData{Destination: "javascript:alert(1)"})
+	assert.NotContains(t, body, `href="javascript:`)
+	assert.Contains(t, body, `href="#ZgotmplZ"`, "unsafe URL schemes are neutralized")
+
+	_, body = render(t, r, pages.Unlock, "", pages.UnlockData{Action: `/unlock/abc" onmouseover="x`, Error: "<b>"})
+	assert.NotContains(t, body, `" onmouseover="x`)
+	assert.Contains(t, body, "&lt;b&gt;")
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(text), 0644))
+	}
+	return dir
+}
+
+func TestOverrideDirectory(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"en/tombstone.html": `{{template "style"}}<h1>Gone: {{.ShortURL}}</h1>`,
+		"de/tombstone.html": `<h1>Gelöscht: {{.ShortURL}}</h1>`,
+	})
+	r := pages.NewRenderer(dir)
+	data := pages.TombstoneData{ShortURL: "abc"}
+
+	_, body := render(t, r, pages.Tombstone, "en", data)
+	assert.Contains(t, body, "<h1>Gone: abc</h1>")
+	assert.Contains(t, body, "<style>", "the embedded style is kept")
+	lang, body := render(t, r, pages.Tombstone, "de", data)
+	assert.Equal(t, "de", lang)
+	assert.Contains(t, body, "Gelöscht: abc")
+	_, body = render(t, r, pages.Tombstone, "ru", data)
+	assert.Contains(t, body, "Эта ссылка удалена", "pages not overridden stay embedded")
+}
+
+func TestMalformedOverrideFallsBack(t *testing.T) {
+	for name, dir := range map[string]string{
+		"parse error":   writeFiles(t, map[string]string{"en/tombstone.html": `<h1>{{.ShortURL</h1>`}),
+		"unknown field": writeFiles(t, map[string]string{"en/interstitial.html": `<a href="{{.Target}}">`}),
+		"unknown page":  writeFiles(t, map[string]string{"en/landing.html": `<h1>Hi</h1>`}),
+		"missing":       filepath.Join(t.TempDir(), "missing"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.WarnLevel)
+			r := pages.NewRenderer(dir, pages.WithLogger(zap.New(core)))
+			_, body := render(t, r, pages.Tombstone, "en", pages.TombstoneData{ShortURL: "abc"})
+			assert.Contains(t, body, "This link has been deleted")
+			assert.Equal(t, 1, logs.FilterMessage("page template overrides ignored, using embedded templates").Len())
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package pagination_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/pagination"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	codec := pagination.NewCodec([]byte("secret"), time.Hour, nil)
+	for _, sort := range []domain.LinkSort{"", domain.SortByShortURL} {
+		position := domain.LinkCursor{CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 123, time.UTC), ShortURL: "abc123", Sort: sort}
+		cursor, err := codec.Encode("user-1", position)
+		require.NoError(t, err)
+
+		decoded, err := codec.Decode("user-1", cursor)
+		require.NoError(t, err)
+		assert.Equal(t, position, decoded)
+	}
+}
+
+func TestCursorTamperingRejected(t *testing.T) {
+	codec := pagination.NewCodec([]byte("secret"), time.Hour, nil)
+	cursor, err := codec.Encode("user-1", domain.LinkCursor{CreatedAt: time.Now(), ShortURL: "abc123"})
+	require.NoError(t, err)
+	payload, mac, _ := strings.Cut(cursor, ".")
+	flipped := "A" + mac[1:]
+	if mac[0] == 'A' {
+		flipped = "B" + mac[1:]
+	}
+	forged, err := pagination.NewCodec([]byte("other"), time.Hour, nil).Encode("user-1", domain.LinkCursor{ShortURL: "abc123"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		user   string
+		cursor string
+	}{
+		{"Garbage", "user-1", "not-a-cursor"},
+		{"Payload changed", "user-1", payload + "x." + mac},
+		{"MAC changed", "user-1", payload + "." + flipped},
+		{"Other secret", "user-1", forged},
+		{"Other user", "user-2", cursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := codec.Decode(tt.user, tt.cursor)
+			assert.ErrorIs(t, err, pagination.ErrInvalidCursor)
+		})
+	}
+}
+
+func TestCursorExpires(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	codec := pagination.NewCodec([]byte("secret"), time.Hour, fake)
+	cursor, err := codec.Encode("user-1", domain.LinkCursor{ShortURL: "abc123"})
+	require.NoError(t, err)
+
+	fake.Advance(59 * time.Minute)
+	_, err = codec.Decode("user-1", cursor)
+	require.NoError(t, err)
+	fake.Advance(time.Minute)
+	_, err = codec.Decode("user-1", cursor)
+	assert.ErrorIs(t, err, pagination.ErrExpiredCursor)
+}
@@ -0,0 +1,97 @@
+package quota_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/quota"
+)
+
+// fixedCounter counts links of every user as its own map says, and counts its calls.
+type fixedCounter struct {
+	links map[string]int
+	calls int
+	err   error
+}
+
+func (c *fixedCounter) CountByUser(_ context.Context, userID string) (int, error) {
+	c.calls++
+	return c.links[userID], c.err
+}
+
+func TestReserveUpToLimit(t *testing.T) {
+	counter := &fixedCounter{links: map[string]int{"user-1": 6}}
+	tracker := quota.New(counter, 10, 80, time.Minute, nil)
+
+	usage, err := tracker.Reserve(context.Background(), "user-1", 1)
+	require.NoError(t, err)
+	assert.Equal(t, quota.Usage{Used: 7, Limit: 10, Remaining: 3, WarnAt: 8}, usage)
+	assert.False(t, usage.Crossed(1))
+
+	usage, err = tracker.Reserve(context.Background(), "user-1", 2)
+	require.NoError(t, err)
+	assert.True(t, usage.Warning)
+	assert.True(t, usage.Crossed(2), "7 to 9 crosses 8")
+
+	usage, err = tracker.Reserve(context.Background(), "user-1", 1)
+	require.NoError(t, err)
+	assert.True(t, usage.Warning)
+	assert.False(t, usage.Crossed(1), "already past the threshold")
+	assert.Zero(t, usage.Remaining)
+
+	usage, err = tracker.Reserve(context.Background(), "user-1", 1)
+	assert.ErrorIs(t, err, quota.ErrQuotaExceeded)
+	assert.Equal(t, 10, usage.Used)
+
+	tracker.Release("user-1", 2)
+	usage, err = tracker.Usage(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, 8, usage.Used)
+	assert.Equal(t, 1, counter.calls, "counted once")
+
+	_, err = tracker.Reserve(context.Background(), "user-2", 11)
+	assert.ErrorIs(t, err, quota.ErrQuotaExceeded, "a batch must fit as a whole")
+}
+
+func TestCountsReloaded(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	counter := &fixedCounter{links: map[string]int{"user-1": 9}}
+	tracker := quota.New(counter, 10, 80, time.Minute, fake)
+	_, err := tracker.Reserve(context.Background(), "user-1", 1)
+	require.NoError(t, err)
+
+	counter.links["user-1"] = 3
+	tracker.Invalidate("user-1")
+	usage, err := tracker.Usage(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, usage.Used, "links deleted meanwhile free the quota")
+	assert.False(t, usage.Warning)
+
+	counter.links["user-1"] = 5
+	fake.Advance(time.Minute)
+	usage, err = tracker.Usage(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, 5, usage.Used, "counts expire")
+	assert.Equal(t, 3, counter.calls)
+
+	counter.err = errors.New("database is down")
+	tracker.Invalidate("user-1")
+	_, err = tracker.Reserve(context.Background(), "user-1", 1)
+	assert.ErrorContains(t, err, "database is down")
+}
+
+func TestNewValidates(t *testing.T) {
+	counter := &fixedCounter{}
+	assert.Panics(t, func() { quota.New(counter, 0, 80, time.Minute, nil) })
+	assert.Panics(t, func() { quota.New(counter, 10, 0, time.Minute, nil) })
+	assert.Panics(t, func() { quota.New(counter, 10, 101, time.Minute, nil) })
+	usage, err := quota.New(counter, 3, 50, time.Minute, nil).Usage(context.Background(), "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, usage.WarnAt, "rounded up")
+}
@@ -0,0 +1,87 @@
+package ratelimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/ratelimit"
+	"github.com/OrtemRepos/shortlink/internal/subnet"
+)
+
+func TestClientsLimitedIndependently(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	l := ratelimit.New(2, 2, fake)
+
+	assert.Zero(t, l.Allow("192.0.2.1"))
+	assert.Zero(t, l.Allow("192.0.2.1"))
+	assert.Equal(t, 500*time.Millisecond, l.Allow("192.0.2.1"))
+	assert.Zero(t, l.Allow("192.0.2.2"), "192.0.2.2 has its own bucket")
+
+	fake.Advance(500 * time.Millisecond)
+	assert.Zero(t, l.Allow("192.0.2.1"), "a token refilled")
+	assert.Positive(t, l.Allow("192.0.2.1"))
+
+	stats := l.Stats()
+	assert.Equal(t, uint64(4), stats.Allowed)
+	assert.Equal(t, uint64(2), stats.Rejected)
+	assert.Equal(t, 2, stats.Clients)
+}
+
+func TestSweepForgetsIdleClients(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	l := ratelimit.New(1, 2, fake)
+	l.Allow("idle")
+	l.Allow("idle")
+	fake.Advance(time.Second)
+	l.Allow("busy")
+	l.Allow("busy")
+
+	assert.Zero(t, l.Sweep(), "the bucket of idle is not full yet")
+	fake.Advance(time.Second)
+	assert.Equal(t, 1, l.Sweep())
+	assert.Equal(t, 1, l.Stats().Clients)
+}
+
+func TestUserOrIP(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.RemoteAddr = "192.0.2.1:1234"
+	assert.Equal(t, "ip:192.0.2.1", ratelimit.UserOrIP(nil)(c))
+	c.Set("UserID", "alice")
+	assert.Equal(t, "user:alice", ratelimit.UserOrIP(nil)(c))
+}
+
+func TestClientIPForwarded(t *testing.T) {
+	proxies, err := subnet.ParseProxies("10.0.0.1")
+	require.NoError(t, err)
+	tests := []struct {
+		name   string
+		remote string
+		header string
+		want   string
+	}{
+		{"Direct", "192.0.2.1:1234", "", "192.0.2.1"},
+		{"Spoofed", "192.0.2.1:1234", "198.51.100.7", "192.0.2.1"},
+		{"Behind a proxy", "10.0.0.1:1234", "198.51.100.7", "198.51.100.7"},
+		{"Proxy without header", "10.0.0.1:1234", "", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			c.Request.RemoteAddr = tt.remote
+			c.Request.Header.Set("X-Forwarded-For", "203.0.113.9")
+			if tt.header != "" {
+				c.Request.Header.Set("X-Real-IP", tt.header)
+			}
+			assert.Equal(t, tt.want, ratelimit.ClientIP(proxies)(c))
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/scheduler"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func newPool(t *testing.T) worker.WorkerPool {
+	t.Helper()
+	pool := worker.NewWorkerPool("testJobs", 2, 10, 10, worker.NewPoolMetrics(), worker.NewWorkerMetrics)
+	pool.Start(context.Background())
+	t.Cleanup(func() { _ = pool.Drain(context.Background()) })
+	return pool
+}
+
+func TestParseCron(t *testing.T) {
+	base := time.Date(2024, time.March, 10, 10, 17, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.March, 10, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.March, 10, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2024, time.March, 11, 3, 0, 0, 0, time.UTC)},
+		{"30 9-17 * * 1-5", time.Date(2024, time.March, 11, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 1,7 *", time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			cron, err := scheduler.ParseCron(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.next, cron.Next(base))
+		})
+	}
+
+	for _, bad := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := scheduler.ParseCron(bad)
+		assert.ErrorIs(t, err, scheduler.ErrInvalidCron, bad)
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	s := scheduler.NewScheduler(newPool(t), nil)
+	noop := scheduler.JobFunc(func(context.Context) error { return nil })
+
+	assert.ErrorIs(t, s.Register(scheduler.Spec{Name: "none"}, noop), scheduler.ErrInvalidSpec)
+	assert.ErrorIs(t, s.Register(scheduler.Spec{Name: "both", Interval: time.Second, Cron: "* * * * *"}, noop),
+		scheduler.ErrInvalidSpec)
+	assert.ErrorIs(t, s.Register(scheduler.Spec{Name: "cron", Cron: "bad"}, noop), scheduler.ErrInvalidSpec)
+	require.NoError(t, s.Register(scheduler.Spec{Name: "ok", Interval: time.Second}, noop))
+	assert.ErrorIs(t, s.Register(scheduler.Spec{Name: "ok", Interval: time.Second}, noop), scheduler.ErrJobExists)
+}
+
+func TestIntervalJobRecordsStatus(t *testing.T) {
+	s := scheduler.NewScheduler(newPool(t), nil)
+	var runs atomic.Int32
+	errBoom := errors.New("boom")
+	require.NoError(t, s.Register(scheduler.Spec{Name: "tick", Interval: 10 * time.Millisecond},
+		scheduler.JobFunc(func(context.Context) error {
+			if runs.Add(1) == 1 {
+				return errBoom
+			}
+			return nil
+		})))
+
+	s.Start(context.Background())
+	assert.Eventually(t, func() bool { return runs.Load() >= 3 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, s.Stop(context.Background()))
+
+	jobs := s.Jobs()
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "tick", jobs[0].Name)
+	assert.GreaterOrEqual(t, jobs[0].Runs, 3)
+	assert.Equal(t, 1, jobs[0].Failures)
+	assert.False(t, jobs[0].LastRun.IsZero())
+	assert.Empty(t, jobs[0].LastError)
+}
+
+func TestTriggerSkipsOverlappingRun(t *testing.T) {
+	s := scheduler.NewScheduler(newPool(t), nil)
+	release := make(chan struct{})
+	var runs atomic.Int32
+	require.NoError(t, s.Register(scheduler.Spec{Name: "slow", Interval: time.Hour},
+		scheduler.JobFunc(func(context.Context) error {
+			runs.Add(1)
+			<-release
+			return nil
+		})))
+	s.Start(context.Background())
+	defer func() { _ = s.Stop(context.Background()) }()
+
+	require.NoError(t, s.Trigger(context.Background(), "slow"))
+	assert.ErrorIs(t, s.Trigger(context.Background(), "slow"), scheduler.ErrJobRunning)
+	assert.ErrorIs(t, s.Trigger(context.Background(), "missing"), scheduler.ErrJobNotFound)
+	close(release)
+
+	assert.Eventually(t, func() bool { return s.Jobs()[0].Runs == 1 && !s.Jobs()[0].Running },
+		time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(1), runs.Load())
+}
+
+type follower struct{}
+
+func (follower) IsLeader() bool { return false }
+
+func TestLeaderOnlyJobSkippedOnFollower(t *testing.T) {
+	s := scheduler.NewScheduler(newPool(t), follower{})
+	var runs atomic.Int32
+	require.NoError(t, s.Register(scheduler.Spec{Name: "leader", Interval: 5 * time.Millisecond, RequiresLeader: true},
+		scheduler.JobFunc(func(context.Context) error {
+			runs.Add(1)
+			return nil
+		})))
+	s.Start(context.Background())
+	time.Sleep(30 * time.Millisecond)
+	require.NoError(t, s.Stop(context.Background()))
+
+	assert.Zero(t, runs.Load())
+	assert.ErrorIs(t, s.Trigger(context.Background(), "leader"), scheduler.ErrNotLeader)
+}
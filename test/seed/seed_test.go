@@ -0,0 +1,130 @@
+package seed_test
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/seed"
+)
+
+var opts = seed.Options{Users: 20, Links: 2000, Clicks: 50000, Seed: 42}
+
+func TestGenerateDeterministic(t *testing.T) {
+	first, err := seed.Generate(opts)
+	require.NoError(t, err)
+	again, err := seed.Generate(opts)
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+
+	other := opts
+	other.Seed = 43
+	different, err := seed.Generate(other)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Users, different.Users)
+	assert.NotEqual(t, first.Links[0].URL, different.Links[0].URL)
+}
+
+func TestGenerateRealistic(t *testing.T) {
+	ds, err := seed.Generate(opts)
+	require.NoError(t, err)
+	require.Len(t, ds.Users, opts.Users)
+	require.Len(t, ds.Links, opts.Links)
+
+	codes := make(map[string]bool)
+	destinations := make(map[string]bool)
+	owned := make(map[string]int)
+	clicks := make([]int, 0, len(ds.Links))
+	total, deleted, moderated := 0, 0, 0
+	for _, link := range ds.Links {
+		assert.Len(t, link.URL.ShortURL, 8)
+		codes[link.URL.ShortURL] = true
+		destinations[link.URL.OriginalURL] = true
+		owned[link.URL.UUID]++
+		clicks = append(clicks, link.Clicks)
+		total += link.Clicks
+		if link.Deleted {
+			deleted++
+		}
+		if link.Moderation != "" {
+			moderated++
+		}
+	}
+	assert.Len(t, codes, opts.Links, "codes are unique")
+	assert.Len(t, destinations, opts.Links, "destinations are unique")
+	assert.Equal(t, opts.Clicks, total)
+	assert.InDelta(t, 0.05*float64(opts.Links), deleted, 40)
+	assert.InDelta(t, 0.03*float64(opts.Links), moderated, 30)
+
+	sort.Sort(sort.Reverse(sort.IntSlice(clicks)))
+	assert.Greater(t, clicks[0], 10*clicks[len(clicks)/2], "a few links get most clicks")
+	most := 0
+	for _, n := range owned {
+		most = max(most, n)
+	}
+	assert.Greater(t, most, 3*opts.Links/opts.Users, "a few users own most links")
+}
+
+func TestGenerateInvalid(t *testing.T) {
+	for name, invalid := range map[string]seed.Options{
+		"no users":        {Links: 1},
+		"no links":        {Users: 1},
+		"negative clicks": {Users: 1, Links: 1, Clicks: -1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := seed.Generate(invalid)
+			assert.ErrorIs(t, err, seed.ErrInvalidOptions)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, seed.Guard(ctx, repo, "production"), "an empty store may be seeded")
+
+	small := seed.Options{Users: 5, Links: 600, Clicks: 1000, Seed: 7}
+	ds, err := seed.Generate(small)
+	require.NoError(t, err)
+	summary, err := seed.Load(ctx, repo, ds)
+	require.NoError(t, err)
+	assert.Equal(t, 5, summary.Users)
+	assert.Equal(t, 600, summary.Links)
+	assert.Equal(t, 1000, summary.Clicks)
+	assert.NotZero(t, summary.Flagged+summary.Blocked)
+
+	count, err := repo.CountLinks(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 600, count)
+	for _, link := range ds.Links {
+		found, err := repo.Find(ctx, link.URL.ShortURL)
+		require.NoError(t, err)
+		assert.Equal(t, link.URL.OriginalURL, found.OriginalURL)
+		if link.Moderation != "" {
+			assert.Equal(t, link.Moderation, found.Moderation)
+		}
+	}
+
+	_, err = seed.Load(ctx, repo, ds)
+	require.NoError(t, err, "loading again is harmless")
+	count, err = repo.CountLinks(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 600, count)
+
+	assert.ErrorIs(t, seed.Guard(ctx, repo, "production"), seed.ErrProductionStore)
+	assert.NoError(t, seed.Guard(ctx, repo, "development"))
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	for range b.N {
+		if _, err := seed.Generate(opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package shortener_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+)
+
+func newRepo(t *testing.T) *adapters.InMemoryURLRepository {
+	t.Helper()
+	repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "data.json"))
+	require.NoError(t, err)
+	return repo
+}
+
+// sequence returns the given codes in order, then repeats the last one.
+func sequence(codes ...string) shortener.GeneratorFunc {
+	i := 0
+	return func(string) string {
+		code := codes[min(i, len(codes)-1)]
+		i++
+		return code
+	}
+}
+
+// racingRepo reports every code free, like a check that lost the race to a
+// concurrent insert, so only the unique constraint catches the collision.
+type racingRepo struct {
+	ports.URLRepositoryPort
+}
+
+func (racingRepo) Exists(context.Context, string) (bool, error) {
+	return false, nil
+}
+
+func TestServiceRetriesTakenCode(t *testing.T) {
+	repo := newRepo(t)
+	ctx := context.Background()
+	require.NoError(t, repo.Save(ctx, &domain.URL{OriginalURL: "https://taken.example.com", ShortURL: "taken"}))
+
+	svc := shortener.NewService(repo, shortener.WithGenerator(sequence("taken", "free")))
+	url := domain.NewURL("https://example.com")
+	require.NoError(t, svc.Save(ctx, url))
+	assert.Equal(t, "free", url.ShortURL)
+
+	found, err := repo.Find(ctx, "free")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", found.OriginalURL)
+}
+
+func TestServiceRetriesCollisionOnInsert(t *testing.T) {
+	repo := newRepo(t)
+	ctx := context.Background()
+	require.NoError(t, repo.Save(ctx, &domain.URL{OriginalURL: "https://taken.example.com", ShortURL: "taken"}))
+
+	svc := shortener.NewService(racingRepo{repo}, shortener.WithGenerator(sequence("taken", "free")))
+	url := domain.NewURL("https://example.com")
+	require.NoError(t, svc.Save(ctx, url))
+	assert.Equal(t, "free", url.ShortURL)
+}
+
+func TestServiceSkipsReservedPaths(t *testing.T) {
+	svc := shortener.NewService(newRepo(t), shortener.WithGenerator(sequence("ping", "api", "free")))
+	code, err := svc.Code(context.Background(), "https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "free", code)
+}
+
+func TestServiceGivesUpAfterMaxAttempts(t *testing.T) {
+	repo := newRepo(t)
+	ctx := context.Background()
+	require.NoError(t, repo.Save(ctx, &domain.URL{OriginalURL: "https://taken.example.com", ShortURL: "taken"}))
+
+	svc := shortener.NewService(repo, shortener.WithGenerator(sequence("taken")), shortener.WithMaxAttempts(3))
+	_, err := svc.Code(ctx, "https://example.com")
+	assert.ErrorIs(t, err, shortener.ErrNoFreeCode)
+
+	svc = shortener.NewService(racingRepo{repo}, shortener.WithGenerator(sequence("taken")), shortener.WithMaxAttempts(3))
+	err = svc.Save(ctx, domain.NewURL("https://example.com"))
+	assert.ErrorIs(t, err, shortener.ErrNoFreeCode)
+	assert.ErrorIs(t, err, domain.ErrShortURLTaken)
+}
+
+func TestServiceKeepsCallerCode(t *testing.T) {
+	repo := newRepo(t)
+	ctx := context.Background()
+	require.NoError(t, repo.Save(ctx, &domain.URL{OriginalURL: "https://taken.example.com", ShortURL: "taken"}))
+
+	svc := shortener.NewService(repo, shortener.WithGenerator(sequence("free")))
+	url := &domain.URL{OriginalURL: "https://example.com", ShortURL: "taken"}
+	assert.ErrorIs(t, svc.Save(ctx, url), domain.ErrShortURLTaken)
+	assert.Equal(t, "taken", url.ShortURL)
+}
+
+func TestServiceBatchSave(t *testing.T) {
+	repo := newRepo(t)
+	ctx := context.Background()
+	require.NoError(t, repo.Save(ctx, &domain.URL{OriginalURL: "https://taken.example.com", ShortURL: "taken"}))
+
+	svc := shortener.NewService(racingRepo{repo}, shortener.WithGenerator(sequence("taken", "retried")))
+	urls := []*domain.URL{
+		domain.NewURL("https://one.example.com"),
+		{OriginalURL: "https://two.example.com", ShortURL: "chosen"},
+	}
+	require.NoError(t, svc.BatchSave(ctx, urls))
+	assert.Equal(t, "retried", urls[0].ShortURL, "the whole batch is retried with a new code")
+	assert.Equal(t, "chosen", urls[1].ShortURL)
+
+	found, err := repo.Find(ctx, "chosen")
+	require.NoError(t, err)
+	assert.Equal(t, "https://two.example.com", found.OriginalURL)
+}
+
+func TestRepositoryRequiresCode(t *testing.T) {
+	repo := newRepo(t)
+	ctx := context.Background()
+	assert.ErrorIs(t, repo.Save(ctx, domain.NewURL("https://example.com")), domain.ErrShortURLRequired)
+	assert.ErrorIs(t, repo.BatchSave(ctx, []*domain.URL{domain.NewURL("https://example.com")}), domain.ErrShortURLRequired)
+}
@@ -0,0 +1,237 @@
+package task_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+	"github.com/OrtemRepos/shortlink/internal/task"
+	"github.com/OrtemRepos/shortlink/internal/taskgroup"
+)
+
+type recordingDeleteRepo struct {
+	ports.URLRepositoryPort
+	deleted chan map[string][]string
+}
+
+func (r *recordingDeleteRepo) BatchDelete(_ context.Context, ids map[string][]string) (int, error) {
+	r.deleted <- ids
+	n := 0
+	for _, shortURLs := range ids {
+		n += len(shortURLs)
+	}
+	return n, nil
+}
+
+func startBatcher(t *testing.T, bufferSize int) (*task.BatcherDeleteTask, chan<- task.DeleteRequest, *recordingDeleteRepo, *clock.Fake, <-chan error) {
+	t.Helper()
+	input := make(chan task.DeleteRequest)
+	repo := &recordingDeleteRepo{deleted: make(chan map[string][]string, 10)}
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	batcher := task.NewBatcherDeleteTask(input, repo, bufferSize, time.Second, task.WithBatcherClock(fake))
+	done := make(chan error, 1)
+	go func() { done <- batcher.Execute(context.Background()) }()
+	fake.BlockUntil(1)
+	return batcher, input, repo, fake, done
+}
+
+func TestBatcherFlushesOnTick(t *testing.T) {
+	batcher, input, repo, fake, done := startBatcher(t, 10)
+
+	input <- task.DeleteRequest{IDs: map[string][]string{"user-1": {"a"}}}
+	input <- task.DeleteRequest{IDs: map[string][]string{"user-1": {"b"}, "user-2": {"c"}}}
+	select {
+	case ids := <-repo.deleted:
+		t.Fatalf("flushed before the tick: %v", ids)
+	default:
+	}
+
+	fake.Advance(time.Second)
+	assert.Equal(t, map[string][]string{"user-1": {"a", "b"}, "user-2": {"c"}}, <-repo.deleted)
+	assert.Eventually(t, func() bool {
+		return batcher.Metrics() == task.DeleteMetrics{Flushes: 1, Requested: 3, Deleted: 3}
+	}, time.Second, time.Millisecond)
+
+	close(input)
+	require.NoError(t, <-done)
+}
+
+func TestBatcherFlushesWhenBufferFull(t *testing.T) {
+	_, input, repo, _, done := startBatcher(t, 2)
+
+	input <- task.DeleteRequest{IDs: map[string][]string{"user-1": {"a"}}}
+	input <- task.DeleteRequest{IDs: map[string][]string{"user-2": {"b"}}}
+	assert.Equal(t, map[string][]string{"user-1": {"a"}}, <-repo.deleted, "the second user fills the buffer")
+
+	close(input)
+	require.NoError(t, <-done)
+	assert.Equal(t, map[string][]string{"user-2": {"b"}}, <-repo.deleted, "closing the input flushes the rest")
+}
+
+type ctxRecordingDeleteRepo struct {
+	ports.URLRepositoryPort
+	ctxErr chan error
+}
+
+func (r *ctxRecordingDeleteRepo) BatchDelete(ctx context.Context, ids map[string][]string) (int, error) {
+	r.ctxErr <- ctx.Err()
+	return len(ids), nil
+}
+
+func TestBatcherFinalFlushOutlivesRunContext(t *testing.T) {
+	input := make(chan task.DeleteRequest)
+	repo := &ctxRecordingDeleteRepo{ctxErr: make(chan error, 1)}
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	batcher := task.NewBatcherDeleteTask(input, repo, 10, time.Second, task.WithBatcherClock(fake))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- batcher.Execute(ctx) }()
+
+	input <- task.DeleteRequest{IDs: map[string][]string{"user-1": {"a"}}}
+	cancel()
+	require.NoError(t, <-done)
+	select {
+	case err := <-repo.ctxErr:
+		assert.NoError(t, err, "the final flush is not cancelled with the run context")
+	default:
+		t.Fatal("Execute returned before the final flush")
+	}
+	assert.Equal(t, int64(1), batcher.Metrics().Flushes)
+}
+
+// hungDeleteRepo blocks every BatchDelete until its context ends.
+type hungDeleteRepo struct {
+	ports.URLRepositoryPort
+}
+
+func (hungDeleteRepo) BatchDelete(ctx context.Context, _ map[string][]string) (int, error) {
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+func TestBatcherFlushTimeout(t *testing.T) {
+	input := make(chan task.DeleteRequest)
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	batcher := task.NewBatcherDeleteTask(input, hungDeleteRepo{}, 10, time.Second,
+		task.WithBatcherClock(fake), task.WithFlushTimeouts(10*time.Millisecond, 20*time.Millisecond))
+	done := make(chan error, 1)
+	go func() { done <- batcher.Execute(context.Background()) }()
+	fake.BlockUntil(1)
+
+	input <- task.DeleteRequest{IDs: map[string][]string{"user-1": {"a"}}}
+	fake.Advance(time.Second)
+	assert.Eventually(t, func() bool {
+		return batcher.Metrics() == task.DeleteMetrics{Flushes: 1, Requested: 1, Failed: 1, TimedOut: 1}
+	}, time.Second, time.Millisecond)
+
+	input <- task.DeleteRequest{IDs: map[string][]string{"user-2": {"b"}}}
+	close(input)
+	err := <-done
+	assert.ErrorIs(t, err, task.ErrFlushTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int64(2), batcher.Metrics().TimedOut, "the final flush is bounded too")
+}
+
+type failingDeleteRepo struct {
+	ports.URLRepositoryPort
+}
+
+func (failingDeleteRepo) BatchDelete(context.Context, map[string][]string) (int, error) {
+	return 0, errors.New("database is down")
+}
+
+func TestBatcherErrorsStayBounded(t *testing.T) {
+	input := make(chan task.DeleteRequest)
+	batcher := task.NewBatcherDeleteTask(input, failingDeleteRepo{}, 1, time.Hour)
+	done := make(chan error, 1)
+	go func() { done <- batcher.Execute(context.Background()) }()
+
+	// A buffer of one flushes on every input.
+	for i := 0; i < 300; i++ {
+		input <- task.DeleteRequest{IDs: map[string][]string{"user-1": {"a"}}}
+	}
+	close(input)
+	err := <-done
+	assert.ErrorContains(t, err, "database is down")
+	assert.Equal(t, int64(300), batcher.Metrics().Failed)
+	assert.Equal(t, int64(300), batcher.Errors().Total())
+	assert.Len(t, batcher.Errors().Recent(), 100, "only the last errors are kept")
+}
+
+func TestBatcherFlushTask(t *testing.T) {
+	input := make(chan task.DeleteRequest, 10)
+	repo := &recordingDeleteRepo{deleted: make(chan map[string][]string, 10)}
+	batcher := task.NewBatcherDeleteTask(input, repo, 3, time.Second)
+	flush := batcher.FlushTask()
+
+	require.NoError(t, flush.Execute(context.Background()), "nothing to flush")
+	input <- task.DeleteRequest{IDs: map[string][]string{"user-1": {"a"}}}
+	input <- task.DeleteRequest{IDs: map[string][]string{"user-2": {"b"}}}
+	input <- task.DeleteRequest{IDs: map[string][]string{"user-3": {"c"}}}
+	require.NoError(t, flush.Execute(context.Background()))
+	// The third user fills the buffer; the run then flushes what is left. Flushes run concurrently.
+	assert.ElementsMatch(t, []map[string][]string{
+		{"user-1": {"a"}, "user-2": {"b"}},
+		{"user-3": {"c"}},
+	}, []map[string][]string{<-repo.deleted, <-repo.deleted})
+
+	input <- task.DeleteRequest{IDs: map[string][]string{"user-4": {"d"}}}
+	close(input)
+	require.NoError(t, batcher.FinalFlush(context.Background()))
+	assert.Equal(t, map[string][]string{"user-4": {"d"}}, <-repo.deleted)
+	assert.Equal(t, int64(3), batcher.Metrics().Flushes)
+}
+
+// leakyDeleteRepo ignores the context of BatchDelete and blocks until released.
+type leakyDeleteRepo struct {
+	ports.URLRepositoryPort
+	release chan struct{}
+}
+
+func (r leakyDeleteRepo) BatchDelete(context.Context, map[string][]string) (int, error) {
+	<-r.release
+	return 0, nil
+}
+
+func TestBatcherFlushLeakShowsInTaskGroup(t *testing.T) {
+	input := make(chan task.DeleteRequest, 1)
+	repo := leakyDeleteRepo{release: make(chan struct{})}
+	tasks := taskgroup.New()
+	batcher := task.NewBatcherDeleteTask(input, repo, 10, time.Second,
+		task.WithBatcherTaskGroup(tasks), task.WithFlushTimeouts(10*time.Millisecond, 10*time.Millisecond))
+	input <- task.DeleteRequest{IDs: map[string][]string{"user-1": {"a"}}}
+	require.NoError(t, batcher.FlushTask().Execute(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, tasks.Wait(ctx), taskgroup.ErrStillRunning, "the flush outlives its timeout")
+	expected := `
+# HELP shortlink_goroutines Background goroutines still running, by name.
+# TYPE shortlink_goroutines gauge
+shortlink_goroutines{name="batcher.flush"} 1
+`
+	require.NoError(t, testutil.CollectAndCompare(tasks.Collector(), strings.NewReader(expected)))
+
+	close(repo.release)
+	require.NoError(t, tasks.Wait(context.Background()))
+	assert.Zero(t, testutil.CollectAndCount(tasks.Collector()))
+}
+
+func TestBatcherConfig(t *testing.T) {
+	batcher := task.NewBatcherDeleteTask(nil, &recordingDeleteRepo{}, 50, 2*time.Second,
+		task.WithFlushTimeouts(time.Second, 0))
+	assert.Equal(t, task.BatcherConfig{
+		BufferSize:        50,
+		FlushInterval:     2 * time.Second,
+		FlushTimeout:      time.Second,
+		FinalFlushTimeout: task.DefaultFinalFlushTimeout,
+	}, batcher.Config())
+}
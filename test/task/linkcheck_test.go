@@ -0,0 +1,77 @@
+package task_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/linkcheck"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+	"github.com/OrtemRepos/shortlink/internal/task"
+)
+
+func TestLinkCheckJob(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.json")
+	repo, err := adapters.NewInMemoryURLRepository(path)
+	require.NoError(t, err)
+	const alice, bob = "11111111-1111-1111-1111-111111111111", "22222222-2222-2222-2222-222222222222"
+	links := []*domain.URL{
+		{OriginalURL: server.URL + "/ok", ShortURL: "ok", UUID: alice},
+		{OriginalURL: server.URL + "/gone", ShortURL: "gone", UUID: alice},
+		{OriginalURL: server.URL + "/ok?bob", ShortURL: "bob", UUID: bob},
+	}
+	require.NoError(t, shortener.NewService(repo).BatchSave(ctx, links))
+	require.NoError(t, repo.SetLinkChecks(ctx, bob, false))
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	job := task.NewLinkCheckJob(repo, linkcheck.NewChecker(server.Client(), 2), time.Hour, 10, 2,
+		task.WithLinkCheckClock(fake))
+	require.NoError(t, job.Run(ctx))
+
+	for short, status := range map[string]string{"ok": "200", "gone": "404"} {
+		url, err := repo.Find(ctx, short)
+		require.NoError(t, err)
+		assert.Equal(t, status, url.LastStatus, short)
+		require.NotNil(t, url.LastCheckedAt, short)
+		assert.True(t, fake.Now().Equal(*url.LastCheckedAt), short)
+	}
+	url, err := repo.Find(ctx, "bob")
+	require.NoError(t, err)
+	assert.Nil(t, url.LastCheckedAt, "opted-out users are not checked")
+
+	due, err := repo.LinksToCheck(ctx, fake.Now(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, due, "links checked now are not due")
+	fake.Advance(2 * time.Hour)
+	due, err = repo.LinksToCheck(ctx, fake.Now().Add(-time.Hour), 1)
+	require.NoError(t, err)
+	assert.Len(t, due, 1)
+
+	reloaded, err := adapters.NewInMemoryURLRepository(path)
+	require.NoError(t, err)
+	url, err = reloaded.Find(ctx, "gone")
+	require.NoError(t, err)
+	assert.Equal(t, "404", url.LastStatus, "checks are persisted")
+	due, err = reloaded.LinksToCheck(ctx, fake.Now(), 10)
+	require.NoError(t, err)
+	for _, link := range due {
+		assert.NotEqual(t, bob, link.UUID, "opt-outs are persisted")
+	}
+}
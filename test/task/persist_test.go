@@ -0,0 +1,106 @@
+package task_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/events"
+	"github.com/OrtemRepos/shortlink/internal/ports"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+	"github.com/OrtemRepos/shortlink/internal/task"
+)
+
+var errDatabaseDown = errors.New("database down")
+
+type failingSaveRepo struct {
+	ports.URLRepositoryPort
+}
+
+func (f *failingSaveRepo) Save(context.Context, *domain.URL) error {
+	return errDatabaseDown
+}
+
+func newInMemory(t *testing.T) *adapters.InMemoryURLRepository {
+	t.Helper()
+	repo, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "urls.json"))
+	require.NoError(t, err)
+	return repo
+}
+
+func collect(bus *events.Bus) *[]events.Event {
+	var got []events.Event
+	bus.Subscribe(func(e events.Event) { got = append(got, e) })
+	return &got
+}
+
+func optimisticURL() domain.URL {
+	url := domain.NewURL("https://example.com/optimistic")
+	url.UUID = "user-1"
+	url.GenerateShortURL()
+	return *url
+}
+
+func TestPersistTaskSuccess(t *testing.T) {
+	cache := adapters.NewCachedRepository(newInMemory(t), time.Minute, 10)
+	bus := events.NewBus()
+	published := collect(bus)
+	url := optimisticURL()
+	cache.Prime(&url)
+
+	err := task.NewPersistTask(cache, cache, bus, url).Execute(context.Background())
+	require.NoError(t, err)
+
+	cache.Evict(url.ShortURL)
+	found, err := cache.Find(context.Background(), url.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, url.OriginalURL, found.OriginalURL)
+	assert.Empty(t, *published)
+}
+
+func TestPersistTaskFailureCompensates(t *testing.T) {
+	cache := adapters.NewCachedRepository(&failingSaveRepo{newInMemory(t)}, time.Minute, 10)
+	bus := events.NewBus()
+	published := collect(bus)
+	url := optimisticURL()
+	cache.Prime(&url)
+
+	found, err := cache.Find(context.Background(), url.ShortURL)
+	require.NoError(t, err, "primed link must resolve before the write lands")
+	assert.Equal(t, url.OriginalURL, found.OriginalURL)
+
+	err = task.NewPersistTask(cache, cache, bus, url).Execute(context.Background())
+	assert.ErrorIs(t, err, errDatabaseDown)
+
+	_, err = cache.Find(context.Background(), url.ShortURL)
+	assert.ErrorIs(t, err, domain.ErrURLNotFound, "failed persist must evict the primed entry")
+	require.Len(t, *published, 1)
+	assert.Equal(t, events.PersistFailed, (*published)[0].Type)
+	assert.Equal(t, "user-1", (*published)[0].UserID)
+	assert.Equal(t, url.ShortURL, (*published)[0].Attrs["short_url"])
+}
+
+func TestPersistTaskDeduplicatedToOtherCode(t *testing.T) {
+	repo := newInMemory(t)
+	existing := domain.NewURL("https://example.com/optimistic")
+	require.NoError(t, shortener.NewService(repo).Save(context.Background(), existing))
+
+	cache := adapters.NewCachedRepository(repo, time.Minute, 10)
+	bus := events.NewBus()
+	published := collect(bus)
+	url := optimisticURL()
+	cache.Prime(&url)
+
+	err := task.NewPersistTask(cache, cache, bus, url).Execute(context.Background())
+	assert.ErrorIs(t, err, domain.ErrURLAlreadyExists)
+	_, err = cache.Find(context.Background(), url.ShortURL)
+	assert.ErrorIs(t, err, domain.ErrURLNotFound)
+	assert.Len(t, *published, 1)
+}
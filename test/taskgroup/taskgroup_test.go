@@ -0,0 +1,86 @@
+package taskgroup_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/OrtemRepos/shortlink/internal/taskgroup"
+)
+
+func TestRunningByName(t *testing.T) {
+	tasks := taskgroup.New()
+	release := make(chan struct{})
+	for _, name := range []string{"flush", "flush", "check"} {
+		require.NoError(t, tasks.Go(context.Background(), name, func() { <-release }))
+	}
+	assert.Equal(t, map[string]int{"flush": 2, "check": 1}, tasks.Running())
+
+	expected := `
+# HELP shortlink_goroutines Background goroutines still running, by name.
+# TYPE shortlink_goroutines gauge
+shortlink_goroutines{name="check"} 1
+shortlink_goroutines{name="flush"} 2
+`
+	require.NoError(t, testutil.CollectAndCompare(tasks.Collector(), strings.NewReader(expected)))
+
+	close(release)
+	require.NoError(t, tasks.Wait(context.Background()))
+	assert.Empty(t, tasks.Running())
+}
+
+func TestLimitWaitsForSlot(t *testing.T) {
+	tasks := taskgroup.New(taskgroup.WithLimit("flush", 1))
+	release := make(chan struct{})
+	require.NoError(t, tasks.Go(context.Background(), "flush", func() { <-release }))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	ran := false
+	assert.ErrorIs(t, tasks.Go(ctx, "flush", func() { ran = true }), context.DeadlineExceeded)
+	require.NoError(t, tasks.Go(context.Background(), "other", func() {}), "other names are not capped")
+
+	second := make(chan struct{})
+	go func() {
+		assert.NoError(t, tasks.Go(context.Background(), "flush", func() { close(second) }))
+	}()
+	close(release)
+	<-second
+	require.NoError(t, tasks.Wait(context.Background()))
+	assert.False(t, ran)
+}
+
+func TestWaitReportsStillRunning(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	tasks := taskgroup.New(taskgroup.WithLogger(zap.New(core)))
+	release := make(chan struct{})
+	defer close(release)
+	require.NoError(t, tasks.Go(context.Background(), "leak", func() { <-release }))
+	require.NoError(t, tasks.Go(context.Background(), "done", func() {}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := tasks.Wait(ctx)
+	assert.ErrorIs(t, err, taskgroup.ErrStillRunning)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	entries := logs.FilterMessage("goroutines still running after shutdown").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, []any{"leak"}, entries[0].ContextMap()["names"])
+}
+
+func TestNilGroup(t *testing.T) {
+	var tasks *taskgroup.Group
+	ran := make(chan struct{})
+	require.NoError(t, tasks.Go(context.Background(), "untracked", func() { close(ran) }))
+	<-ran
+	assert.Empty(t, tasks.Running())
+	assert.NoError(t, tasks.Wait(context.Background()))
+}
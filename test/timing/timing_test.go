@@ -0,0 +1,103 @@
+package timing_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/adapters"
+	"github.com/OrtemRepos/shortlink/internal/domain"
+	"github.com/OrtemRepos/shortlink/internal/shortener"
+	"github.com/OrtemRepos/shortlink/internal/timing"
+)
+
+var metric = `[A-Za-z0-9._-]+;dur=\d+(\.\d+)?`
+var headerFormat = regexp.MustCompile(`^` + metric + `(, ` + metric + `)*$`)
+
+func newEngine(t *testing.T, trusted *net.IPNet) (*gin.Engine, *domain.URL) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	inMemory, err := adapters.NewInMemoryURLRepository(filepath.Join(t.TempDir(), "urls.json"))
+	require.NoError(t, err)
+	url := domain.NewURL("https://example.com")
+	require.NoError(t, shortener.NewService(inMemory).Save(context.Background(), url))
+	repo := adapters.NewMetricsRepository(inMemory, nil)
+
+	engine := gin.New()
+	engine.Use(timing.Middleware(true, trusted, 0, zap.NewNop()))
+	engine.GET("/:short", func(c *gin.Context) {
+		if c.GetHeader("X-User") != "" {
+			c.Set("UserID", c.GetHeader("X-User"))
+		}
+		found, err := repo.Find(c.Request.Context(), c.Param("short"))
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.String(http.StatusOK, found.OriginalURL)
+	})
+	return engine, url
+}
+
+func TestServerTimingHeader(t *testing.T) {
+	engine, url := newEngine(t, nil)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/"+url.ShortURL, nil)
+	req.Header.Set("X-User", "user")
+	engine.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	header := w.Header().Get(timing.HeaderName)
+	assert.Regexp(t, headerFormat, header)
+	assert.Contains(t, header, "repo.Find;dur=")
+	assert.Contains(t, header, "total;dur=")
+}
+
+func TestServerTimingHiddenFromAnonymous(t *testing.T) {
+	engine, url := newEngine(t, nil)
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+url.ShortURL, nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(timing.HeaderName))
+}
+
+func TestServerTimingForTrustedSubnet(t *testing.T) {
+	_, trusted, err := net.ParseCIDR("192.0.2.0/24")
+	require.NoError(t, err)
+	engine, url := newEngine(t, trusted)
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+url.ShortURL, nil))
+
+	assert.Contains(t, w.Header().Get(timing.HeaderName), "repo.Find;dur=")
+}
+
+func TestCollector(t *testing.T) {
+	var nilCollector *timing.Collector
+	nilCollector.Add("ignored", time.Second)
+	timing.Record(context.Background(), "ignored", time.Now())
+
+	c := &timing.Collector{}
+	ctx := timing.NewContext(context.Background(), c)
+	c.Add("db", 1500*time.Microsecond)
+	timing.Record(ctx, "cache.hit", time.Now())
+
+	phases := c.Phases()
+	require.Len(t, phases, 2)
+	assert.Equal(t, "db", phases[0].Name)
+	assert.Equal(t, "cache.hit", phases[1].Name)
+	assert.Regexp(t, `^db;dur=1\.5, cache\.hit;dur=`, string(c.AppendHeader(nil)))
+}
@@ -0,0 +1,87 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/events"
+	"github.com/OrtemRepos/shortlink/internal/webhook"
+	"github.com/OrtemRepos/shortlink/pkg/client"
+)
+
+// receiver verifies the webhooks it gets with secret and answers status to valid ones.
+func receiver(t *testing.T, secret string, status int, received chan<- events.Event) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if !assert.NoError(t, err) {
+			return
+		}
+		if err := client.VerifyWebhookSignature(secret, r.Header.Get(client.SignatureHeader), body); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var e events.Event
+		assert.NoError(t, json.Unmarshal(body, &e))
+		received <- e
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSendTestEvent(t *testing.T) {
+	received := make(chan events.Event, 1)
+	srv := receiver(t, "secret", http.StatusNoContent, received)
+	sender := webhook.NewSender(srv.Client())
+
+	delivery, err := sender.Send(context.Background(), srv.URL, "secret", webhook.TestEvent("user-1"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, delivery.StatusCode)
+	e := <-received
+	assert.Equal(t, events.WebhookTest, e.Type)
+	assert.Equal(t, "user-1", e.UserID)
+	assert.False(t, e.At.IsZero())
+}
+
+func TestSendRejected(t *testing.T) {
+	received := make(chan events.Event, 1)
+	srv := receiver(t, "secret", http.StatusOK, received)
+	sender := webhook.NewSender(srv.Client())
+
+	delivery, err := sender.Send(context.Background(), srv.URL, "wrong", webhook.TestEvent("user-1"))
+	assert.ErrorIs(t, err, webhook.ErrDeliveryRejected)
+	assert.Equal(t, http.StatusUnauthorized, delivery.StatusCode)
+	assert.Empty(t, received)
+}
+
+func TestSendStaleClockRejected(t *testing.T) {
+	received := make(chan events.Event, 1)
+	srv := receiver(t, "secret", http.StatusOK, received)
+	stale := clock.NewFake(time.Now().Add(-time.Hour))
+	sender := webhook.NewSender(srv.Client(), webhook.WithClock(stale))
+
+	_, err := sender.Send(context.Background(), srv.URL, "secret", webhook.TestEvent("user-1"))
+	assert.ErrorIs(t, err, webhook.ErrDeliveryRejected, "the receiver sees a replay")
+}
+
+func TestSendPayloadTooLarge(t *testing.T) {
+	received := make(chan events.Event, 1)
+	srv := receiver(t, "secret", http.StatusOK, received)
+	sender := webhook.NewSender(srv.Client())
+
+	e := webhook.TestEvent("user-1")
+	e.Attrs = map[string]string{"padding": strings.Repeat("x", client.MaxPayload)}
+	_, err := sender.Send(context.Background(), srv.URL, "secret", e)
+	assert.ErrorIs(t, err, client.ErrPayloadTooLarge)
+	assert.Empty(t, received)
+}
@@ -0,0 +1,56 @@
+package webhook_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/webhook"
+)
+
+func TestStore(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := webhook.NewStore(fake)
+
+	first, err := store.Add("alice", "https://example.com/hooks")
+	require.NoError(t, err)
+	assert.Len(t, first.Secret, 64)
+	fake.Advance(time.Second)
+	second, err := store.Add("alice", "http://example.org/hooks")
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Secret, second.Secret)
+
+	got, err := store.Get("alice", first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, first, got)
+	_, err = store.Get("bob", first.ID)
+	assert.ErrorIs(t, err, webhook.ErrWebhookNotFound, "webhooks of other users are not found")
+
+	listed := store.List("alice")
+	require.Len(t, listed, 2)
+	assert.Equal(t, []string{first.ID, second.ID}, []string{listed[0].ID, listed[1].ID})
+	assert.Empty(t, listed[0].Secret, "secrets are not listed")
+
+	assert.ErrorIs(t, store.Delete("bob", first.ID), webhook.ErrWebhookNotFound)
+	require.NoError(t, store.Delete("alice", first.ID))
+	assert.Len(t, store.List("alice"), 1)
+}
+
+func TestStoreRejects(t *testing.T) {
+	store := webhook.NewStore(nil)
+	for _, target := range []string{"", "example.com/hooks", "ftp://example.com", "https://", "/hooks"} {
+		_, err := store.Add("alice", target)
+		assert.ErrorIs(t, err, webhook.ErrInvalidTarget, target)
+	}
+
+	for i := range webhook.MaxPerUser {
+		_, err := store.Add("alice", fmt.Sprintf("https://example.com/%d", i))
+		require.NoError(t, err)
+	}
+	_, err := store.Add("alice", "https://example.com/more")
+	assert.ErrorIs(t, err, webhook.ErrTooManyWebhooks)
+}
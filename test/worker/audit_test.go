@@ -0,0 +1,112 @@
+package worker_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+// auditRecords parses the JSON lines written by WithAudit.
+func auditRecords(t *testing.T, out *bytes.Buffer) []worker.AuditRecord {
+	t.Helper()
+	var records []worker.AuditRecord
+	lines := bufio.NewScanner(out)
+	for lines.Scan() {
+		var record worker.AuditRecord
+		require.NoError(t, json.Unmarshal(lines.Bytes(), &record), lines.Text())
+		records = append(records, record)
+	}
+	require.NoError(t, lines.Err())
+	return records
+}
+
+// events returns the events of records, with the reason of dropped ones.
+func events(records []worker.AuditRecord) []string {
+	var events []string
+	for _, record := range records {
+		event := string(record.Event)
+		if record.Reason != "" {
+			event += ": " + record.Reason
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// blockedWriter holds every Write until release is closed.
+type blockedWriter struct{ release chan struct{} }
+
+func (w blockedWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+func TestAuditTaskLifecycle(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	var out bytes.Buffer
+	pool, err := worker.NewPool("test", worker.WithClock(fake), worker.WithAudit(&out))
+	require.NoError(t, err)
+	require.NoError(t, pool.Submit(context.Background(), slowTask{fake, 5 * time.Millisecond}))
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, pool.Drain(context.Background()))
+
+	records := auditRecords(t, &out)
+	require.Equal(t, []string{"submitted", "started", "completed"}, events(records))
+	for _, record := range records {
+		assert.Equal(t, "test", record.Pool)
+		assert.Equal(t, uint64(1), record.TaskID)
+		assert.Equal(t, "slow", record.Task)
+		assert.Equal(t, worker.DefaultKind, record.Kind)
+	}
+	assert.True(t, records[1].Time.Equal(start))
+	assert.True(t, records[2].Time.Equal(start.Add(5*time.Millisecond)))
+	assert.Equal(t, 5*time.Millisecond, records[2].Duration)
+	assert.Zero(t, pool.Metrics().AuditDropped)
+}
+
+func TestAuditFailedAndDroppedTasks(t *testing.T) {
+	var out bytes.Buffer
+	pool, err := worker.NewPool("test", worker.WithBuffer(1), worker.WithAudit(&out))
+	require.NoError(t, err)
+	require.NoError(t, pool.Submit(context.Background(), failTask{}))
+	require.ErrorIs(t, pool.Submit(context.Background(), failTask{}), worker.ErrWorkerPoolFull)
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, pool.Drain(context.Background()))
+
+	records := auditRecords(t, &out)
+	assert.Equal(t, []string{"submitted", "dropped: task queue is full", "started", "failed"}, events(records))
+	assert.Equal(t, "failed", records[3].Error)
+
+	queued, err := worker.NewPool("test", worker.WithAudit(&out))
+	require.NoError(t, err)
+	require.NoError(t, queued.Submit(context.Background(), failTask{}))
+	require.NoError(t, queued.Shutdown(context.Background()))
+	assert.Equal(t, []string{"submitted", "dropped: pool shut down before the task ran"}, events(auditRecords(t, &out)))
+}
+
+func TestAuditDropsWhenWriterIsSlow(t *testing.T) {
+	writer := blockedWriter{release: make(chan struct{})}
+	pool, err := worker.NewPool("test", worker.WithBuffer(2*worker.AuditBuffer), worker.WithAudit(writer))
+	require.NoError(t, err)
+	executed := new(atomic.Int64)
+	for range 2 * worker.AuditBuffer {
+		require.NoError(t, pool.Submit(context.Background(), countTask{executed}), "producers do not wait for the writer")
+	}
+	assert.GreaterOrEqual(t, pool.Metrics().AuditDropped, int64(worker.AuditBuffer-1))
+
+	close(writer.release)
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Equal(t, int64(2*worker.AuditBuffer), executed.Load())
+}
@@ -0,0 +1,92 @@
+package worker_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+// keyedTask counts its runs and is deduplicated by key.
+type keyedTask struct {
+	countTask
+	key string
+}
+
+func (t keyedTask) DedupKey() string { return t.key }
+
+func TestDuplicateTaskRefusedWhileQueued(t *testing.T) {
+	pool := newPool(1, 10)
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), keyedTask{countTask{executed}, "user-1"}))
+	assert.ErrorIs(t, pool.Submit(context.Background(), keyedTask{countTask{executed}, "user-1"}), worker.ErrDuplicateTask)
+	assert.ErrorIs(t, pool.SubmitWithPriority(context.Background(), keyedTask{countTask{executed}, "user-1"}, worker.PriorityHigh),
+		worker.ErrDuplicateTask, "keys are shared by priorities")
+	_, err := pool.SubmitTracked(context.Background(), keyedTask{countTask{executed}, "user-1"})
+	assert.ErrorIs(t, err, worker.ErrDuplicateTask)
+	assert.ErrorIs(t, pool.SubmitWait(context.Background(), keyedTask{countTask{executed}, "user-1"}), worker.ErrDuplicateTask)
+	require.NoError(t, pool.Submit(context.Background(), keyedTask{countTask{executed}, "user-2"}))
+	require.NoError(t, pool.Submit(context.Background(), keyedTask{countTask{executed}, ""}), "an empty key opts out")
+	require.NoError(t, pool.Submit(context.Background(), keyedTask{countTask{executed}, ""}))
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+
+	metrics := pool.Metrics()
+	assert.Equal(t, 4, metrics.PoolMetrics.TasksDeduplicated())
+	assert.Equal(t, 2, metrics.QueuedKeys)
+
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Equal(t, int64(6), executed.Load())
+	assert.Zero(t, pool.Metrics().QueuedKeys)
+}
+
+func TestDuplicateKeyFreedOnceTaken(t *testing.T) {
+	pool, _ := recurringPool(1)
+	pool.Start(context.Background())
+	gate := gateTask{started: make(chan struct{}, 1), release: make(chan struct{})}
+	require.NoError(t, pool.Submit(context.Background(), gate))
+	<-gate.started
+
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), keyedTask{countTask{executed}, "user-1"}))
+	assert.ErrorIs(t, pool.Submit(context.Background(), keyedTask{countTask{executed}, "user-1"}), worker.ErrDuplicateTask)
+	close(gate.release)
+	require.Eventually(t, func() bool { return executed.Load() == 1 }, time.Second, time.Millisecond)
+	require.NoError(t, pool.Submit(context.Background(), keyedTask{countTask{executed}, "user-1"}), "the key left the queue with its task")
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Equal(t, int64(2), executed.Load())
+}
+
+func TestDuplicateKeyFreedOnRefusal(t *testing.T) {
+	pool := newPool(1, 1)
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	assert.ErrorIs(t, pool.Submit(context.Background(), keyedTask{countTask{executed}, "user-1"}), worker.ErrWorkerPoolFull)
+	assert.Zero(t, pool.Metrics().QueuedKeys)
+
+	pool.Start(context.Background())
+	require.Eventually(t, func() bool { return executed.Load() == 1 }, time.Second, time.Millisecond)
+	require.NoError(t, pool.Submit(context.Background(), keyedTask{countTask{executed}, "user-1"}))
+	require.NoError(t, pool.Drain(context.Background()))
+}
+
+func TestShutdownFreesQueuedKeys(t *testing.T) {
+	pool := newPool(1, 10)
+	executed := new(atomic.Int64)
+	for _, key := range []string{"user-1", "user-2", "user-3"} {
+		require.NoError(t, pool.Submit(context.Background(), keyedTask{countTask{executed}, key}))
+	}
+	require.Equal(t, 3, pool.Metrics().QueuedKeys)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, pool.Shutdown(ctx))
+	assert.Zero(t, pool.Metrics().QueuedKeys)
+	assert.Zero(t, executed.Load())
+}
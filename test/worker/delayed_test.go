@@ -0,0 +1,78 @@
+package worker_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func delayedPool(buffer int) (worker.WorkerPool, *clock.Fake) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	return worker.NewWorkerPool("test", 1, buffer, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithClock(fake)), fake
+}
+
+func TestSubmitAfterRunsWhenDue(t *testing.T) {
+	pool, fake := delayedPool(10)
+	pool.Start(context.Background())
+	rec := &recorder{}
+	require.NoError(t, pool.SubmitAfter(context.Background(), namedTask{"late", rec}, 20*time.Second))
+	require.NoError(t, pool.SubmitAt(context.Background(), namedTask{"early", rec}, fake.Now().Add(10*time.Second)))
+	metrics := pool.Metrics().PoolMetrics
+	assert.Equal(t, 2, metrics.TasksScheduled())
+	assert.Zero(t, metrics.TasksEnqueued(), "scheduled tasks are enqueued when due")
+
+	fake.Advance(15 * time.Second)
+	assert.Eventually(t, func() bool { return len(rec.positions("early")) == 1 }, time.Second, time.Millisecond)
+	assert.Empty(t, rec.positions("late"))
+	assert.Equal(t, 1, metrics.TasksScheduled())
+
+	fake.Advance(5 * time.Second)
+	assert.Eventually(t, func() bool { return len(rec.positions("late")) == 1 }, time.Second, time.Millisecond)
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Equal(t, []string{"early", "late"}, rec.order)
+	assert.Zero(t, metrics.TasksScheduled())
+	assert.Equal(t, 2, metrics.TasksEnqueued())
+}
+
+func TestDrainQueuesDueScheduledTasks(t *testing.T) {
+	pool, fake := delayedPool(1)
+	executed := new(atomic.Int64)
+	// The pool is not started: the first due task fills the queue, the others wait for room.
+	for i := 0; i < 3; i++ {
+		require.NoError(t, pool.SubmitAt(context.Background(), countTask{executed}, fake.Now()))
+	}
+	require.NoError(t, pool.SubmitAfter(context.Background(), countTask{executed}, time.Hour))
+
+	drained := make(chan error, 1)
+	go func() { drained <- pool.Drain(context.Background()) }()
+	pool.Start(context.Background())
+	require.NoError(t, <-drained)
+
+	assert.Equal(t, int64(3), executed.Load(), "tasks already due are run")
+	metrics := pool.Metrics().PoolMetrics
+	assert.Zero(t, metrics.TasksScheduled())
+	assert.Equal(t, 1, metrics.ScheduledDropped(), "tasks not due yet are dropped")
+	assert.ErrorIs(t, pool.SubmitAfter(context.Background(), countTask{executed}, time.Second), worker.ErrWorkerPoolClosed)
+}
+
+func TestShutdownDropsScheduledTasks(t *testing.T) {
+	pool, _ := delayedPool(10)
+	pool.Start(context.Background())
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.SubmitAfter(context.Background(), countTask{executed}, time.Minute))
+	require.NoError(t, pool.SubmitAfter(context.Background(), countTask{executed}, time.Hour))
+	require.NoError(t, pool.Shutdown(context.Background()))
+
+	metrics := pool.Metrics().PoolMetrics
+	assert.Zero(t, executed.Load())
+	assert.Zero(t, metrics.TasksScheduled())
+	assert.Equal(t, 2, metrics.ScheduledDropped())
+}
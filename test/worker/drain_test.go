@@ -0,0 +1,229 @@
+package worker_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/OrtemRepos/shortlink/internal/taskgroup"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func TestDrainWithTimeoutForcesSlowTask(t *testing.T) {
+	tasks := taskgroup.New()
+	pool := worker.NewWorkerPool("test", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithTaskGroup(tasks))
+	pool.Start(context.Background())
+	slow := blockingTask{started: make(chan struct{}), aborted: make(chan struct{})}
+	slowHandle, err := pool.SubmitTracked(context.Background(), slow)
+	require.NoError(t, err)
+	<-slow.started
+	executed := new(atomic.Int64)
+	var queued []*worker.TaskHandle
+	for i := 0; i < 2; i++ {
+		handle, err := pool.SubmitTracked(context.Background(), countTask{executed})
+		require.NoError(t, err)
+		queued = append(queued, handle)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = pool.DrainWithTimeout(ctx, 20*time.Millisecond)
+	require.ErrorIs(t, err, worker.ErrDrainForced)
+	assert.Contains(t, err.Error(), "3 tasks abandoned")
+	assert.Equal(t, 3, pool.Metrics().PoolMetrics.TasksAbandoned())
+
+	<-slow.aborted
+	<-slowHandle.Done()
+	assert.ErrorIs(t, slowHandle.Err(), context.Canceled)
+	for _, handle := range queued {
+		<-handle.Done()
+		assert.ErrorIs(t, handle.Err(), worker.ErrTaskAborted)
+	}
+	assert.Zero(t, executed.Load())
+	assert.Zero(t, pool.Metrics().PoolMetrics.QueueDepth())
+
+	// Every worker has exited: draining again returns at once and nothing runs on.
+	assert.ErrorIs(t, pool.Submit(context.Background(), countTask{executed}), worker.ErrWorkerPoolClosed)
+	require.NoError(t, pool.Drain(ctx))
+	require.NoError(t, pool.Shutdown(ctx))
+	require.NoError(t, tasks.Wait(ctx))
+	assert.Equal(t, 3, pool.Metrics().PoolMetrics.TasksAbandoned(), "stopping again abandons nothing more")
+}
+
+// TestStopWithoutShutdownSlot checks that Shutdown and DrainWithTimeout abort
+// nothing when their ctx ends while the task group has no slot for them.
+func TestStopWithoutShutdownSlot(t *testing.T) {
+	tasks := taskgroup.New(taskgroup.WithLimit(worker.ShutdownGoroutine, 1))
+	release := make(chan struct{})
+	require.NoError(t, tasks.Go(context.Background(), worker.ShutdownGoroutine, func() { <-release }))
+	pool := worker.NewWorkerPool("test", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithTaskGroup(tasks))
+	pool.Start(context.Background())
+	slow := blockingTask{started: make(chan struct{}), aborted: make(chan struct{})}
+	require.NoError(t, pool.Submit(context.Background(), slow))
+	<-slow.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, pool.Shutdown(ctx), context.DeadlineExceeded)
+	assert.Equal(t, worker.StateRunning, pool.State(), "the pool is left as it was")
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, pool.DrainWithTimeout(ctx, time.Millisecond), context.DeadlineExceeded)
+	select {
+	case <-slow.aborted:
+		t.Fatal("the running task was aborted without a shutdown goroutine")
+	default:
+	}
+
+	close(release)
+	require.NoError(t, pool.Shutdown(context.Background()))
+	<-slow.aborted
+	assert.Equal(t, worker.StateStopped, pool.State())
+	assert.Zero(t, executed.Load())
+	assert.Equal(t, 2, pool.Metrics().PoolMetrics.TasksAbandoned(), "the queued task is dropped with the running one")
+	require.NoError(t, tasks.Wait(context.Background()))
+}
+
+func TestDrainWithTimeoutWithinGrace(t *testing.T) {
+	pool := newPool(2, 10)
+	pool.Start(context.Background())
+	executed := new(atomic.Int64)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	}
+
+	require.NoError(t, pool.DrainWithTimeout(context.Background(), time.Second))
+	assert.Equal(t, int64(5), executed.Load())
+	assert.Zero(t, pool.Metrics().PoolMetrics.TasksAbandoned())
+}
+
+// fanoutTask submits child to its pool once released and reports what Submit and
+// SubmitWait returned.
+type fanoutTask struct {
+	pool    worker.WorkerPool
+	started chan struct{}
+	release chan struct{}
+	child   worker.Task
+	errs    chan error
+}
+
+func (t fanoutTask) Execute(ctx context.Context) error {
+	close(t.started)
+	<-t.release
+	t.errs <- t.pool.Submit(ctx, t.child)
+	t.errs <- t.pool.SubmitWait(ctx, t.child)
+	return nil
+}
+
+func (t fanoutTask) Stringer() string { return "fanout" }
+
+func TestTaskSubmitsDuringDrain(t *testing.T) {
+	pool := newPool(1, 10)
+	executed := new(atomic.Int64)
+	task := fanoutTask{
+		pool:    pool,
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+		child:   countTask{executed},
+		errs:    make(chan error, 2),
+	}
+	require.NoError(t, pool.Submit(context.Background(), task))
+	require.NoError(t, pool.Start(context.Background()))
+	<-task.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	drained := make(chan error, 1)
+	go func() { drained <- pool.Drain(ctx) }()
+	require.Eventually(t, func() bool { return pool.State() == worker.StateDraining }, time.Second, time.Millisecond)
+	close(task.release)
+
+	assert.ErrorIs(t, <-task.errs, worker.ErrWorkerPoolClosed)
+	assert.ErrorIs(t, <-task.errs, worker.ErrWorkerPoolClosed)
+	select {
+	case err := <-drained:
+		require.NoError(t, err, "Drain completes although a task submitted while it waited")
+	case <-ctx.Done():
+		t.Fatal("Drain deadlocked on a task submitting a child")
+	}
+	assert.Zero(t, executed.Load())
+}
+
+func TestTaskSubmitsBeforeDrain(t *testing.T) {
+	pool := newPool(1, 10)
+	executed := new(atomic.Int64)
+	task := fanoutTask{
+		pool:    pool,
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+		child:   countTask{executed},
+		errs:    make(chan error, 2),
+	}
+	close(task.release)
+	require.NoError(t, pool.Submit(context.Background(), task))
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, <-task.errs)
+	require.NoError(t, <-task.errs)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, pool.Drain(ctx))
+	assert.Equal(t, int64(2), executed.Load(), "children queued before Drain are run by it")
+}
+
+// stuckTask ignores its ctx, like a blocking call without one, until released.
+type stuckTask struct {
+	started  chan struct{}
+	release  chan struct{}
+	canceled chan struct{}
+}
+
+func (t stuckTask) Execute(ctx context.Context) error {
+	close(t.started)
+	<-t.release
+	if ctx.Err() != nil {
+		close(t.canceled)
+	}
+	return ctx.Err()
+}
+
+func (t stuckTask) Stringer() string { return "stuck" }
+
+func TestShutdownTimeoutLeavesStuckTask(t *testing.T) {
+	core, logs := observer.New(zapcore.ErrorLevel)
+	pool, err := worker.NewPool("test", worker.WithShutdownTimeout(20*time.Millisecond), worker.WithLogger(zap.New(core)))
+	require.NoError(t, err)
+	require.NoError(t, pool.Start(context.Background()))
+	stuck := stuckTask{started: make(chan struct{}), release: make(chan struct{}), canceled: make(chan struct{})}
+	handle, err := pool.SubmitTracked(context.Background(), stuck)
+	require.NoError(t, err)
+	<-stuck.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = pool.Shutdown(ctx)
+	require.ErrorIs(t, err, worker.ErrShutdownTimeout)
+	assert.Contains(t, err.Error(), "1 tasks still running")
+	entries := logs.FilterMessage("task still running after shutdown timeout").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "stuck", entries[0].ContextMap()["task"])
+	assert.Equal(t, worker.StateDraining, pool.State(), "the pool is not stopped under the task")
+
+	close(stuck.release)
+	<-stuck.canceled
+	<-handle.Done()
+	assert.ErrorIs(t, handle.Err(), context.Canceled, "the task saw its ctx cancelled by Shutdown")
+	require.Eventually(t, func() bool { return pool.State() == worker.StateStopped }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,63 @@
+package worker_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+// slowTask appears to run for took by moving the clock of its pool forward.
+type slowTask struct {
+	clock *clock.Fake
+	took  time.Duration
+}
+
+func (t slowTask) Execute(context.Context) error {
+	t.clock.Advance(t.took)
+	return nil
+}
+
+func (t slowTask) Stringer() string { return "slow" }
+
+func TestTaskDurationsRecorded(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	pool := worker.NewWorkerPool("test", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithClock(fake), worker.WithPrometheus(registry))
+	for _, took := range []time.Duration{time.Millisecond, 50 * time.Millisecond, 10 * time.Millisecond, 3 * time.Second} {
+		require.NoError(t, pool.Submit(context.Background(), slowTask{fake, took}))
+	}
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, pool.Drain(context.Background()))
+
+	metrics := pool.Metrics().WorkersMetrics[1]
+	assert.Equal(t, 3061*time.Millisecond, metrics.TotalDuration())
+	assert.Equal(t, 3*time.Second, metrics.MaxDuration())
+	assert.Equal(t, worker.DurationBuckets{Under10ms: 1, Under100ms: 2, Over1s: 1}, metrics.DurationBuckets(),
+		"bounds are exclusive")
+
+	data, err := json.Marshal(metrics)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"duration_buckets":{"lt_10ms":1,"lt_100ms":2,"lt_1s":0,"ge_1s":1}`)
+	assert.Contains(t, string(data), `"max_duration":3000000000`)
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	var observed uint64
+	for _, family := range families {
+		if family.GetName() == "shortlink_worker_task_duration_seconds" {
+			for _, m := range family.GetMetric() {
+				observed += m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	assert.Equal(t, uint64(4), observed)
+}
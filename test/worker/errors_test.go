@@ -0,0 +1,114 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func TestOnErrorSeesDroppedErrors(t *testing.T) {
+	var reported atomic.Int64
+	pool := worker.NewWorkerPool("test", 4, 50, 3, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithOnError(func(err error) {
+			assert.ErrorContains(t, err, "failed")
+			reported.Add(1)
+		}))
+	pool.Start(context.Background())
+
+	// Readers share the errors while workers report them.
+	var readers sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					assert.LessOrEqual(t, len(pool.Errors().Recent()), 3)
+					_ = pool.Metrics()
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		require.NoError(t, pool.Submit(context.Background(), failTask{}))
+	}
+	require.NoError(t, pool.Drain(context.Background()))
+	close(stop)
+	readers.Wait()
+
+	assert.Equal(t, int64(20), reported.Load())
+	assert.Len(t, pool.Errors().Recent(), 3)
+	assert.Len(t, pool.Errors().Recent(), 3, "Recent does not forget")
+	assert.Equal(t, int64(17), pool.Metrics().ErrorsDropped)
+}
+
+func TestOnErrorPanicIsContained(t *testing.T) {
+	pool := worker.NewWorkerPool("test", 1, 10, 10, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithOnError(func(error) { panic("callback broke") }))
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), failTask{}))
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+
+	assert.Equal(t, int64(1), executed.Load())
+	assert.Len(t, pool.Errors().Recent(), 1, "the error is kept anyway")
+	assert.Zero(t, pool.Metrics().WorkersMetrics[1].WorkerRestarts())
+}
+
+func TestErrorKeepsErrorsWhenCtxDone(t *testing.T) {
+	pool := newPool(1, 10)
+	require.NoError(t, pool.Submit(context.Background(), failTask{}))
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, pool.Error(ctx), context.Canceled)
+	assert.ErrorContains(t, pool.Error(context.Background()), "failed")
+	assert.NoError(t, pool.Error(context.Background()), "Error forgets what it returned")
+}
+
+// numberedFailTask fails with its number.
+type numberedFailTask int
+
+func (t numberedFailTask) Execute(context.Context) error {
+	return errors.New("failure " + strconv.Itoa(int(t)))
+}
+
+func (t numberedFailTask) Stringer() string { return "numbered" }
+
+func TestErrorsKeepNewest(t *testing.T) {
+	pool := worker.NewWorkerPool("test", 1, 20, 3, worker.NewPoolMetrics(), worker.NewWorkerMetrics)
+	for i := 1; i <= 10; i++ {
+		require.NoError(t, pool.Submit(context.Background(), numberedFailTask(i)))
+	}
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+
+	var kept []string
+	for _, entry := range pool.Errors().Recent() {
+		kept = append(kept, entry.Error)
+	}
+	assert.Equal(t, []string{"task 8 (numbered): failure 8", "task 9 (numbered): failure 9", "task 10 (numbered): failure 10"},
+		kept, "a full buffer evicts the oldest errors")
+	assert.Equal(t, int64(7), pool.Metrics().ErrorsDropped)
+
+	err := pool.Error(context.Background())
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "failure 7")
+	assert.Contains(t, err.Error(), "failure 10")
+	assert.Equal(t, int64(7), pool.Metrics().ErrorsDropped, "draining does not reset the count")
+}
@@ -0,0 +1,84 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+// spawnTask adds a countTask to its group when it runs.
+type spawnTask struct {
+	group    *worker.TaskGroup
+	executed *atomic.Int64
+}
+
+func (t spawnTask) Execute(ctx context.Context) error {
+	return t.group.Submit(ctx, countTask{t.executed})
+}
+
+func (spawnTask) Stringer() string { return "spawn" }
+
+func TestGroupWaitJoinsErrors(t *testing.T) {
+	pool := newPool(2, 10)
+	require.NoError(t, pool.Start(context.Background()))
+	unrelated := blockingTask{started: make(chan struct{}), aborted: make(chan struct{})}
+	require.NoError(t, pool.Submit(context.Background(), unrelated))
+	<-unrelated.started
+
+	group := pool.Group()
+	executed := new(atomic.Int64)
+	for _, task := range []worker.Task{countTask{executed}, failTask{}, panicTask{}, spawnTask{group, executed}} {
+		require.NoError(t, group.Submit(context.Background(), task))
+	}
+	err := group.Wait(context.Background())
+	require.Error(t, err, "the group does not wait for the task outside it")
+	assert.ErrorContains(t, err, "failed")
+	assert.ErrorIs(t, err, worker.ErrTaskPanicked)
+	assert.Equal(t, int64(2), executed.Load(), "tasks submitted by members are waited for")
+	assert.Equal(t, worker.StateRunning, pool.State())
+
+	require.NoError(t, pool.Shutdown(context.Background()))
+	<-unrelated.aborted
+}
+
+func TestEmptyGroupWait(t *testing.T) {
+	pool := newPool(1, 10)
+	assert.NoError(t, pool.Group().Wait(context.Background()))
+	require.NoError(t, pool.Shutdown(context.Background()))
+}
+
+func TestGroupWaitCancelled(t *testing.T) {
+	pool := newPool(2, 10)
+	require.NoError(t, pool.Start(context.Background()))
+	group := pool.Group()
+	executed := new(atomic.Int64)
+	blocking := blockingTask{started: make(chan struct{}), aborted: make(chan struct{})}
+	require.NoError(t, group.Submit(context.Background(), countTask{executed}))
+	require.NoError(t, group.Submit(context.Background(), blocking))
+	<-blocking.started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	waited := make(chan error, 1)
+	go func() { waited <- group.Wait(ctx) }()
+	cancel()
+	select {
+	case err := <-waited:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("Wait ignored its ctx")
+	}
+
+	require.NoError(t, pool.Shutdown(context.Background()))
+	<-blocking.aborted
+	err := group.Wait(context.Background())
+	assert.True(t, errors.Is(err, context.Canceled) || errors.Is(err, worker.ErrTaskAborted),
+		"the member Shutdown cancelled is still waited for: %v", err)
+	assert.Equal(t, int64(1), executed.Load())
+}
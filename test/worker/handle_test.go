@@ -0,0 +1,83 @@
+package worker_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func waitHandle(t *testing.T, handle *worker.TaskHandle) {
+	t.Helper()
+	select {
+	case <-handle.Done():
+	case <-time.After(time.Second):
+		t.Fatal("task handle not done")
+	}
+}
+
+func TestSubmitTrackedOutcomes(t *testing.T) {
+	pool := newPool(2, 10)
+	pool.Start(context.Background())
+	defer pool.Shutdown(context.Background())
+
+	succeeded, err := pool.SubmitTracked(context.Background(), sleepTask{10 * time.Millisecond})
+	require.NoError(t, err)
+	failed, err := pool.SubmitTracked(context.Background(), failTask{})
+	require.NoError(t, err)
+	waitHandle(t, succeeded)
+	waitHandle(t, failed)
+	assert.NoError(t, succeeded.Err())
+	assert.GreaterOrEqual(t, succeeded.Duration(), 10*time.Millisecond)
+	assert.EqualError(t, failed.Err(), "failed")
+
+	panicked, err := pool.SubmitTracked(context.Background(), panicTask{})
+	require.NoError(t, err)
+	waitHandle(t, panicked)
+	assert.ErrorIs(t, panicked.Err(), worker.ErrTaskPanicked)
+	assert.Contains(t, panicked.Err().Error(), "boom")
+
+	// Fire-and-forget tasks keep working next to tracked ones.
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Equal(t, int64(1), executed.Load())
+}
+
+func TestSubmitTrackedCancelled(t *testing.T) {
+	pool := newPool(1, 10)
+	pool.Start(context.Background())
+	task := blockingTask{started: make(chan struct{}), aborted: make(chan struct{})}
+	running, err := pool.SubmitTracked(context.Background(), task)
+	require.NoError(t, err)
+	<-task.started
+	select {
+	case <-running.Done():
+		t.Fatal("running task reported done")
+	default:
+		assert.NoError(t, running.Err())
+	}
+
+	require.NoError(t, pool.Shutdown(context.Background()))
+	waitHandle(t, running)
+	assert.ErrorIs(t, running.Err(), context.Canceled)
+
+	handle, err := pool.SubmitTracked(context.Background(), failTask{})
+	assert.ErrorIs(t, err, worker.ErrWorkerPoolClosed)
+	assert.Nil(t, handle)
+}
+
+func TestSubmitTrackedLeftInQueue(t *testing.T) {
+	pool := newPool(1, 10)
+	queued, err := pool.SubmitTracked(context.Background(), failTask{})
+	require.NoError(t, err)
+	require.NoError(t, pool.Shutdown(context.Background()))
+	waitHandle(t, queued)
+	assert.ErrorIs(t, queued.Err(), worker.ErrTaskAborted, "a task left in the queue is not waited on forever")
+	assert.Zero(t, queued.Duration())
+}
@@ -0,0 +1,56 @@
+package worker_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func TestInFlightFollowsBlockingTask(t *testing.T) {
+	pool := newPool(2, 10)
+	require.NoError(t, pool.Start(context.Background()))
+	assert.Zero(t, pool.Metrics().InFlight)
+
+	gate := gateTask{started: make(chan struct{}, 1), release: make(chan struct{})}
+	require.NoError(t, pool.Submit(context.Background(), gate))
+	<-gate.started
+	metrics := pool.Metrics()
+	assert.Equal(t, 1, metrics.InFlight)
+	assert.Equal(t, 1, metrics.ActiveWorkers)
+	assert.Equal(t, 1, metrics.PoolMetrics.InFlight())
+	data, err := json.Marshal(metrics.PoolMetrics)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"in_flight":1,"active_workers":1`)
+
+	close(gate.release)
+	require.Eventually(t, func() bool { return pool.Metrics().InFlight == 0 }, time.Second, time.Millisecond)
+	assert.Zero(t, pool.Metrics().ActiveWorkers)
+
+	require.NoError(t, pool.Submit(context.Background(), panicTask{}))
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Zero(t, pool.Metrics().InFlight, "a panic ends the task too")
+	assert.Zero(t, pool.Metrics().ActiveWorkers)
+}
+
+func TestBackoffInFlightButNotActive(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	pool := worker.NewWorkerPool("test", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithClock(fake),
+		worker.WithRetry(worker.RetryPolicy{MaxAttempts: 2, Backoff: func(int) time.Duration { return time.Minute }}))
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, pool.Submit(context.Background(), failTask{}))
+
+	fake.BlockUntil(1)
+	assert.Equal(t, 1, pool.Metrics().InFlight)
+	assert.Zero(t, pool.Metrics().ActiveWorkers, "waiting to retry is not executing")
+	fake.Advance(time.Minute)
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Zero(t, pool.Metrics().InFlight)
+}
@@ -0,0 +1,110 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+// tracing records when it is entered and left, around next.
+func tracing(rec *recorder, name string) worker.TaskInterceptor {
+	return func(ctx context.Context, task worker.Task, next func(ctx context.Context) error) error {
+		rec.record(name + " in")
+		err := next(ctx)
+		rec.record(name + " out")
+		return err
+	}
+}
+
+func TestInterceptorsRunInOrder(t *testing.T) {
+	rec := &recorder{}
+	pool := worker.NewWorkerPool("test", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithInterceptors(append([]worker.TaskInterceptor{tracing(rec, "outer")},
+			append(worker.DefaultInterceptors(), tracing(rec, "inner"))...)...))
+	require.NoError(t, pool.Submit(context.Background(), namedTask{name: "task", rec: rec}))
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+
+	assert.Equal(t, []string{"outer in", "inner in", "task", "inner out", "outer out"}, rec.order)
+	assert.Equal(t, 1, pool.Metrics().WorkersMetrics[1].TasksSucceeded())
+}
+
+func TestInterceptorShortCircuits(t *testing.T) {
+	errSkipped := errors.New("skipped")
+	skip := func(ctx context.Context, task worker.Task, next func(ctx context.Context) error) error {
+		if task.Stringer() == "fail" {
+			return errSkipped
+		}
+		return next(ctx)
+	}
+	pool := worker.NewWorkerPool("test", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithInterceptors(append(worker.DefaultInterceptors(), skip)...))
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), failTask{}))
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+
+	assert.Equal(t, int64(1), executed.Load())
+	metrics := pool.Metrics().WorkersMetrics[1]
+	assert.Equal(t, 1, metrics.TasksFailed())
+	assert.Equal(t, 1, metrics.TasksSucceeded())
+	assert.ErrorIs(t, pool.Error(context.Background()), errSkipped)
+}
+
+func TestInterceptorPanicFailsOnlyItsTask(t *testing.T) {
+	var seen error
+	observe := func(ctx context.Context, task worker.Task, next func(ctx context.Context) error) error {
+		err := next(ctx)
+		if task.Stringer() == "panic" {
+			seen = err
+		}
+		return err
+	}
+	explode := func(ctx context.Context, task worker.Task, next func(ctx context.Context) error) error {
+		if task.Stringer() == "panic" {
+			panic("interceptor broke")
+		}
+		return next(ctx)
+	}
+	pool := worker.NewWorkerPool("test", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithInterceptors(append(worker.DefaultInterceptors(), observe, explode)...))
+	executed := new(atomic.Int64)
+	handle, err := pool.SubmitTracked(context.Background(), namedPanic{})
+	require.NoError(t, err)
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+
+	assert.ErrorIs(t, handle.Err(), worker.ErrTaskPanicked)
+	assert.ErrorIs(t, seen, worker.ErrTaskPanicked, "outer interceptors get the panic as the error of next")
+	assert.Equal(t, int64(1), executed.Load())
+	metrics := pool.Metrics().WorkersMetrics[1]
+	assert.Equal(t, 1, metrics.TasksFailed())
+	assert.Zero(t, metrics.WorkerRestarts())
+}
+
+// namedPanic is a task whose interceptor panics before Execute.
+type namedPanic struct{}
+
+func (namedPanic) Execute(context.Context) error { return nil }
+
+func (namedPanic) Stringer() string { return "panic" }
+
+func TestWithoutInterceptors(t *testing.T) {
+	pool := worker.NewWorkerPool("test", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithInterceptors())
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+
+	assert.Equal(t, int64(1), executed.Load())
+	assert.Zero(t, pool.Metrics().WorkersMetrics[1].TasksStarted(), "worker metrics come from MetricsInterceptor")
+}
@@ -0,0 +1,86 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+// kindTask is counted under kind, and fails if fail is set.
+type kindTask struct {
+	kind string
+	fail bool
+}
+
+func (t kindTask) Execute(context.Context) error {
+	if t.fail {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func (t kindTask) Stringer() string { return "kind " + t.kind }
+func (t kindTask) Kind() string     { return t.kind }
+
+func TestTasksByKind(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	pool := worker.NewWorkerPool("test", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithPrometheus(registry))
+	for _, task := range []worker.Task{
+		kindTask{kind: "delete"}, kindTask{kind: "delete", fail: true}, kindTask{kind: "click"},
+		kindTask{}, failTask{},
+	} {
+		require.NoError(t, pool.Submit(context.Background(), task))
+	}
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, pool.Drain(context.Background()))
+
+	assert.Equal(t, map[string]worker.KindCounts{
+		"delete":           {Enqueued: 2, Started: 2, Failed: 1},
+		"click":            {Enqueued: 1, Started: 1},
+		worker.DefaultKind: {Enqueued: 2, Started: 2, Failed: 1},
+	}, pool.Metrics().PoolMetrics.TasksByKind(), "tasks of no kind are counted under the default one")
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	exported := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "shortlink_worker_tasks_by_kind_total" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range m.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			exported[labels["kind"]+"/"+labels["event"]] = m.GetCounter().GetValue()
+		}
+	}
+	assert.Equal(t, 2.0, exported["delete/enqueued"])
+	assert.Equal(t, 1.0, exported["delete/failed"])
+	assert.Equal(t, 1.0, exported["click/started"])
+
+	before := pool.SnapshotAndReset()
+	assert.Equal(t, 2, before.PoolMetrics.TasksByKind()["delete"].Enqueued)
+	assert.Equal(t, worker.KindCounts{}, pool.Metrics().PoolMetrics.TasksByKind()["delete"])
+}
+
+func TestTasksByKindBounded(t *testing.T) {
+	pool := newPool(1, 2*worker.MaxKinds)
+	for i := range 2 * worker.MaxKinds {
+		require.NoError(t, pool.Submit(context.Background(), kindTask{kind: strconv.Itoa(i)}))
+	}
+
+	kinds := pool.Metrics().PoolMetrics.TasksByKind()
+	assert.Len(t, kinds, worker.MaxKinds)
+	assert.Equal(t, 1, kinds["0"].Enqueued)
+	assert.Equal(t, worker.MaxKinds+1, kinds[worker.OtherKind].Enqueued, "kinds past the bound are counted together")
+	require.NoError(t, pool.Shutdown(context.Background()))
+}
@@ -0,0 +1,124 @@
+package worker_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func TestLifecycleDrain(t *testing.T) {
+	pool := newPool(2, 10)
+	assert.Equal(t, worker.StateCreated, pool.State())
+
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}), "tasks queue until Start")
+	require.NoError(t, pool.Start(context.Background()))
+	assert.Equal(t, worker.StateRunning, pool.State())
+	assert.ErrorIs(t, pool.Start(context.Background()), worker.ErrWorkerPoolStarted)
+	assert.Len(t, pool.Metrics().WorkersMetrics, 2, "a second Start adds no worker")
+
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Equal(t, worker.StateStopped, pool.State())
+	assert.Equal(t, int64(1), executed.Load())
+	assert.ErrorIs(t, pool.Start(context.Background()), worker.ErrWorkerPoolClosed, "a stopped pool cannot restart")
+	assert.ErrorIs(t, pool.Submit(context.Background(), countTask{executed}), worker.ErrWorkerPoolClosed)
+}
+
+func TestLifecycleDraining(t *testing.T) {
+	pool, _ := recurringPool(1)
+	require.NoError(t, pool.Start(context.Background()))
+	gate := gateTask{started: make(chan struct{}, 1), release: make(chan struct{})}
+	require.NoError(t, pool.Submit(context.Background(), gate))
+	<-gate.started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, pool.Drain(ctx), context.Canceled)
+	assert.Equal(t, worker.StateDraining, pool.State(), "the worker is still busy")
+	assert.ErrorIs(t, pool.Start(context.Background()), worker.ErrWorkerPoolClosed)
+
+	close(gate.release)
+	require.Eventually(t, func() bool { return pool.State() == worker.StateStopped }, time.Second, time.Millisecond)
+}
+
+func TestLifecycleShutdownBeforeStart(t *testing.T) {
+	pool := newPool(1, 10)
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+
+	require.NoError(t, pool.Shutdown(context.Background()))
+	assert.Equal(t, worker.StateStopped, pool.State())
+	assert.ErrorIs(t, pool.Start(context.Background()), worker.ErrWorkerPoolClosed)
+	assert.Zero(t, executed.Load())
+	assert.Equal(t, 1, pool.Metrics().PoolMetrics.TasksAbandoned())
+}
+
+func TestSubmitBeforeStartIsCounted(t *testing.T) {
+	pool, logs := observedPool(t, 10)
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	assert.Equal(t, int64(2), pool.Metrics().QueuedBeforeStart)
+	assert.Equal(t, []uint64{1}, taskIDs(logs, "task queued before Start, it waits for the pool to be started"),
+		"only the first task is warned of")
+
+	require.NoError(t, pool.Start(context.Background()))
+	assert.Equal(t, 1, logs.FilterMessage("worker pool started with tasks queued before Start").Len())
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Equal(t, int64(3), executed.Load())
+	assert.Equal(t, int64(2), pool.Metrics().QueuedBeforeStart)
+}
+
+func TestRequireStart(t *testing.T) {
+	pool, err := worker.NewPool("test", worker.WithRequireStart(true))
+	require.NoError(t, err)
+	executed := new(atomic.Int64)
+	task := countTask{executed}
+	assert.ErrorIs(t, pool.Submit(context.Background(), task), worker.ErrPoolNotStarted)
+	assert.ErrorIs(t, pool.SubmitWait(context.Background(), task), worker.ErrPoolNotStarted)
+	_, err = pool.SubmitTracked(context.Background(), task)
+	assert.ErrorIs(t, err, worker.ErrPoolNotStarted)
+	accepted, err := pool.SubmitBatch(context.Background(), []worker.Task{task})
+	assert.ErrorIs(t, err, worker.ErrPoolNotStarted)
+	assert.Zero(t, accepted)
+	assert.ErrorIs(t, pool.SubmitAfter(context.Background(), task, time.Hour), worker.ErrPoolNotStarted)
+	_, err = pool.SubmitEvery(context.Background(), task, time.Hour)
+	assert.ErrorIs(t, err, worker.ErrPoolNotStarted)
+	assert.Zero(t, pool.Metrics().PoolMetrics.TasksEnqueued())
+
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, pool.Submit(context.Background(), task))
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Equal(t, int64(1), executed.Load())
+	assert.Zero(t, pool.Metrics().QueuedBeforeStart)
+}
+
+func TestRequireStartAfterShutdown(t *testing.T) {
+	pool, err := worker.NewPool("test", worker.WithRequireStart(true))
+	require.NoError(t, err)
+	require.NoError(t, pool.Shutdown(context.Background()))
+	assert.ErrorIs(t, pool.Start(context.Background()), worker.ErrWorkerPoolClosed)
+	assert.ErrorIs(t, pool.Submit(context.Background(), countTask{new(atomic.Int64)}), worker.ErrWorkerPoolClosed,
+		"a closed pool says so rather than that it is not started")
+}
+
+func TestDoubleStartWarns(t *testing.T) {
+	pool, logs := observedPool(t, 10)
+	require.NoError(t, pool.Start(context.Background()))
+	assert.ErrorIs(t, pool.Start(context.Background()), worker.ErrWorkerPoolStarted)
+	assert.Equal(t, 1, logs.FilterMessage("worker pool already started, ignoring Start").Len())
+	assert.Len(t, pool.Metrics().WorkersMetrics, 1)
+	require.NoError(t, pool.Shutdown(context.Background()))
+}
+
+func TestPoolStateString(t *testing.T) {
+	assert.Equal(t, "draining", worker.StateDraining.String())
+	assert.Equal(t, "PoolState(7)", worker.PoolState(7).String())
+}
@@ -0,0 +1,225 @@
+package worker_test
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func observedPool(t *testing.T, buffer int) (worker.WorkerPool, *observer.ObservedLogs) {
+	t.Helper()
+	core, logs := observer.New(zapcore.DebugLevel)
+	pool := worker.NewWorkerPool("test", 1, buffer, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithLogger(zap.New(core)))
+	return pool, logs
+}
+
+func taskIDs(logs *observer.ObservedLogs, message string) []uint64 {
+	ids := make([]uint64, 0)
+	for _, entry := range logs.FilterMessage(message).All() {
+		if id, ok := entry.ContextMap()["task_id"].(uint64); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func TestTaskLifecycleLogsShareID(t *testing.T) {
+	pool, logs := observedPool(t, 10)
+	require.NoError(t, pool.Submit(context.Background(), countTask{new(atomic.Int64)}))
+	require.NoError(t, pool.Submit(context.Background(), failTask{}))
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+
+	submitted := taskIDs(logs, "task submitted")
+	require.Equal(t, []uint64{1, 2}, submitted)
+	assert.Equal(t, []uint64{1, 2}, taskIDs(logs, "task started"))
+	assert.Equal(t, []uint64{1}, taskIDs(logs, "task completed"))
+	assert.Equal(t, []uint64{2}, taskIDs(logs, "task failed"))
+
+	for _, entry := range logs.FilterField(zap.Uint64("task_id", 1)).All() {
+		assert.Equal(t, "count", entry.ContextMap()["task"], entry.Message)
+	}
+}
+
+func TestLogSampling(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	pool, err := worker.NewPool("test", worker.WithLogger(zap.New(core)), worker.WithLogSampling(3))
+	require.NoError(t, err)
+	for range 6 {
+		require.NoError(t, pool.Submit(context.Background(), countTask{new(atomic.Int64)}))
+	}
+	require.NoError(t, pool.Submit(context.Background(), failTask{}))
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, pool.Drain(context.Background()))
+
+	assert.Equal(t, []uint64{3, 6}, taskIDs(logs, "task submitted"))
+	assert.Equal(t, []uint64{3, 6}, taskIDs(logs, "task started"))
+	assert.Equal(t, []uint64{3, 6}, taskIDs(logs, "task completed"))
+	assert.Equal(t, []uint64{7}, taskIDs(logs, "task failed"), "errors are never sampled out")
+}
+
+func TestRecentFailures(t *testing.T) {
+	pool, _ := observedPool(t, 30)
+	for i := 0; i < 25; i++ {
+		require.NoError(t, pool.Submit(context.Background(), failTask{}))
+	}
+	require.NoError(t, pool.Submit(context.Background(), panicTask{}))
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+
+	failures := pool.Metrics().RecentFailures
+	require.Len(t, failures, 20, "only the last failures are kept")
+	assert.Equal(t, uint64(7), failures[0].ID)
+	last := failures[len(failures)-1]
+	assert.Equal(t, uint64(26), last.ID)
+	assert.Equal(t, "panic", last.Task)
+	assert.Contains(t, last.Error, "boom")
+
+	err := pool.Error(context.Background())
+	assert.ErrorContains(t, err, "task 25 (fail): failed", "reported errors name the task")
+}
+
+// panickingCore panics on the first entries with message until panics runs out,
+// like a broken log sink would.
+type panickingCore struct {
+	zapcore.Core
+	message string
+	panics  *atomic.Int64
+}
+
+func (c panickingCore) With(fields []zapcore.Field) zapcore.Core {
+	return panickingCore{Core: c.Core.With(fields), message: c.message, panics: c.panics}
+}
+
+func (c panickingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if entry.Message == c.message && c.panics.Add(-1) >= 0 {
+		panic("log sink broke")
+	}
+	return c.Core.Check(entry, checked)
+}
+
+// The task logs are written by LoggingInterceptor, so a broken sink fails the
+// task being logged and leaves the worker running.
+func TestLoggingPanicFailsOnlyItsTask(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	panics := new(atomic.Int64)
+	panics.Store(2)
+	pool := worker.NewWorkerPool("test", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithLogger(zap.New(panickingCore{Core: core, message: "task started", panics: panics})))
+	executed := new(atomic.Int64)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	}
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+
+	assert.Equal(t, int64(3), executed.Load(), "the worker keeps taking tasks after the panics")
+	metrics := pool.Metrics()
+	assert.Zero(t, metrics.WorkersMetrics[1].WorkerRestarts())
+	assert.Equal(t, 2, metrics.WorkersMetrics[1].TasksFailed())
+	require.Len(t, metrics.RecentFailures, 2)
+	assert.Contains(t, metrics.RecentFailures[0].Error, "log sink broke")
+	assert.Equal(t, 2, logs.FilterMessage("task interceptor panic occurred").Len())
+}
+
+// secretTask holds a credential its Stringer leaves out, exported so that
+// reflection would encode it.
+type secretTask struct {
+	failTask
+	Token string
+}
+
+func (secretTask) Stringer() string { return "secret task" }
+
+func TestTasksLoggedWithoutSensitiveFields(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	pool := worker.NewWorkerPool("test", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithLogger(zap.New(core)), worker.WithRetry(worker.RetryPolicy{MaxAttempts: 2}))
+	task := secretTask{Token: "s3cr3t-token"}
+	require.NoError(t, pool.Submit(context.Background(), task))
+	_, err := pool.SubmitTracked(context.Background(), task)
+	require.NoError(t, err)
+	cancel, err := pool.SubmitEvery(context.Background(), task, time.Hour)
+	require.NoError(t, err)
+	defer cancel()
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+
+	require.NotEmpty(t, logs.All())
+	encoder := zapcore.NewJSONEncoder(zap.NewDevelopmentEncoderConfig())
+	for _, entry := range logs.All() {
+		buf, err := encoder.EncodeEntry(entry.Entry, entry.Context)
+		require.NoError(t, err)
+		assert.NotContains(t, buf.String(), "s3cr3t-token", entry.Message)
+		if task, ok := entry.ContextMap()["task"]; ok {
+			assert.Equal(t, "secret task", task, entry.Message)
+		}
+	}
+	assert.NotEmpty(t, logs.FilterField(worker.TaskField(task)).All())
+}
+
+func BenchmarkTaskLogging(b *testing.B) {
+	for _, bench := range []struct {
+		name  string
+		level zapcore.Level
+		opts  []worker.PoolOption
+	}{
+		{"info", zapcore.InfoLevel, nil},
+		{"debug", zapcore.DebugLevel, nil},
+		{"debug sampled 1 in 100", zapcore.DebugLevel, []worker.PoolOption{worker.WithLogSampling(100)}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(io.Discard), bench.level)
+			pool, err := worker.NewPool("bench", append([]worker.PoolOption{
+				worker.WithBuffer(1024), worker.WithLogger(zap.New(core)),
+			}, bench.opts...)...)
+			require.NoError(b, err)
+			require.NoError(b, pool.Start(context.Background()))
+			task := countTask{new(atomic.Int64)}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				if err := pool.SubmitWait(context.Background(), task); err != nil {
+					b.Fatal(err)
+				}
+			}
+			require.NoError(b, pool.Drain(context.Background()))
+		})
+	}
+}
+
+func TestQueueFullWarningThrottled(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	core, logs := observer.New(zapcore.WarnLevel)
+	pool, err := worker.NewPool("test", worker.WithLogger(zap.New(core)), worker.WithBuffer(1), worker.WithClock(fake))
+	require.NoError(t, err)
+	require.NoError(t, pool.Submit(context.Background(), countTask{new(atomic.Int64)}))
+	submit := func(n int) {
+		for range n {
+			assert.ErrorIs(t, pool.Submit(context.Background(), countTask{new(atomic.Int64)}), worker.ErrWorkerPoolFull)
+		}
+	}
+
+	submit(5)
+	warnings := logs.FilterMessage("task queue is full, dropping tasks").All()
+	require.Len(t, warnings, 1, "one warning for a burst of drops")
+	assert.Equal(t, int64(1), warnings[0].ContextMap()["dropped"])
+
+	fake.Advance(10 * time.Second)
+	submit(3)
+	warnings = logs.FilterMessage("task queue is full, dropping tasks").All()
+	require.Len(t, warnings, 2)
+	assert.Equal(t, int64(5), warnings[1].ContextMap()["dropped"], "the drops since the previous warning")
+}
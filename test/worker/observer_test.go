@@ -0,0 +1,112 @@
+package worker_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+// recordingObserver records the calls it gets as "<event> <task id> <task>[ <duration>]".
+type recordingObserver struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (o *recordingObserver) record(ctx context.Context, event string, task worker.Task, d time.Duration) {
+	id, _ := worker.TaskID(ctx)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	line := fmt.Sprintf("%s %d %s", event, id, task.Stringer())
+	if event != "started" {
+		line += " " + d.String()
+	}
+	o.events = append(o.events, line)
+}
+
+func (o *recordingObserver) TaskStarted(ctx context.Context, task worker.Task) {
+	o.record(ctx, "started", task, 0)
+}
+
+func (o *recordingObserver) TaskCompleted(ctx context.Context, task worker.Task, d time.Duration) {
+	o.record(ctx, "completed", task, d)
+}
+
+func (o *recordingObserver) TaskFailed(ctx context.Context, task worker.Task, _ error, d time.Duration) {
+	o.record(ctx, "failed", task, d)
+}
+
+func (o *recordingObserver) recorded() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]string(nil), o.events...)
+}
+
+// panickingObserver panics on every call.
+type panickingObserver struct{ calls *atomic.Int64 }
+
+func (o panickingObserver) TaskStarted(context.Context, worker.Task) {
+	o.calls.Add(1)
+	panic("observer broke")
+}
+
+func (o panickingObserver) TaskCompleted(context.Context, worker.Task, time.Duration) {
+	o.calls.Add(1)
+	panic("observer broke")
+}
+
+func (o panickingObserver) TaskFailed(context.Context, worker.Task, error, time.Duration) {
+	o.calls.Add(1)
+	panic("observer broke")
+}
+
+func TestObserversSeeTaskLifecycle(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	first, second := &recordingObserver{}, &recordingObserver{}
+	pool, err := worker.NewPool("test", worker.WithClock(fake), worker.WithObserver(first), worker.WithObserver(second),
+		worker.WithPanicHandler(func(worker.Task, any, []byte) {}))
+	require.NoError(t, err)
+	require.NoError(t, pool.Submit(context.Background(), slowTask{fake, 5 * time.Millisecond}))
+	require.NoError(t, pool.Submit(context.Background(), failTask{}))
+	require.NoError(t, pool.Submit(context.Background(), panicTask{}))
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, pool.Drain(context.Background()))
+
+	want := []string{
+		"started 1 slow", "completed 1 slow 5ms",
+		"started 2 fail", "failed 2 fail 0s",
+		"started 3 panic", "failed 3 panic 0s",
+	}
+	assert.Equal(t, want, first.recorded())
+	assert.Equal(t, want, second.recorded(), "every observer is told")
+}
+
+func TestObserverPanicsAreContained(t *testing.T) {
+	var calls atomic.Int64
+	recorder := &recordingObserver{}
+	pool, err := worker.NewPool("test", worker.WithObserver(panickingObserver{&calls}, recorder))
+	require.NoError(t, err)
+	executed := new(atomic.Int64)
+	handle, err := pool.SubmitTracked(context.Background(), countTask{executed})
+	require.NoError(t, err)
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, pool.Drain(context.Background()))
+
+	require.NoError(t, handle.Err())
+	assert.Equal(t, int64(1), executed.Load())
+	assert.Equal(t, int64(2), calls.Load())
+	assert.Len(t, recorder.recorded(), 2, "observers after a panicking one are still told")
+	metrics := pool.Metrics().WorkersMetrics[1]
+	assert.Equal(t, 1, metrics.TasksSucceeded())
+	assert.Zero(t, metrics.TasksFailed())
+	assert.Zero(t, metrics.WorkerRestarts())
+	assert.Empty(t, pool.Metrics().RecentFailures)
+}
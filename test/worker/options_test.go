@@ -0,0 +1,76 @@
+package worker_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func TestNewPoolDefaults(t *testing.T) {
+	pool, err := worker.NewPool("test")
+	require.NoError(t, err)
+	cfg := pool.Config()
+	assert.Equal(t, worker.DefaultWorkers, cfg.Workers)
+	assert.Equal(t, worker.DefaultBufferSize, cfg.BufferSize)
+	assert.Equal(t, worker.DefaultErrorCap, cfg.ErrMaximumAmount)
+
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Equal(t, int64(1), executed.Load())
+}
+
+func TestNewPoolOptions(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	pool, err := worker.NewPool("test",
+		worker.WithWorkers(3),
+		worker.WithBuffer(7),
+		worker.WithErrorCap(2),
+		worker.WithMetrics(worker.NewPoolMetrics(), worker.NewWorkerMetrics),
+		worker.WithLogger(zap.New(core)),
+	)
+	require.NoError(t, err)
+	cfg := pool.Config()
+	assert.Equal(t, 3, cfg.Workers)
+	assert.Equal(t, 7, cfg.BufferSize)
+	assert.Equal(t, 2, cfg.ErrMaximumAmount)
+
+	require.NoError(t, pool.Submit(context.Background(), countTask{new(atomic.Int64)}))
+	assert.Equal(t, 1, logs.FilterMessage("task submitted").Len(), "logs go to the given logger")
+}
+
+func TestNewPoolInvalid(t *testing.T) {
+	for name, opt := range map[string]worker.PoolOption{
+		"no workers":       worker.WithWorkers(0),
+		"negative buffer":  worker.WithBuffer(-1),
+		"no error cap":     worker.WithErrorCap(0),
+		"no log sampling":  worker.WithLogSampling(0),
+		"nil pool metrics": worker.WithMetrics(nil, worker.NewWorkerMetrics),
+		"nil metrics":      worker.WithMetrics(worker.NewPoolMetrics(), nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			pool, err := worker.NewPool("test", opt)
+			assert.ErrorIs(t, err, worker.ErrInvalidPool)
+			assert.Nil(t, pool)
+		})
+	}
+	assert.Panics(t, func() {
+		worker.NewWorkerPool("test", 0, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics)
+	}, "the positional constructor keeps panicking")
+}
+
+func TestRegistryRejectsInvalidPool(t *testing.T) {
+	cfg := &configs.Config{Pools: map[string]configs.PoolConfig{"ingest": {Workers: -1, BufferSize: 10, ErrMaximumAmount: 10}}}
+	_, err := worker.NewRegistryFromConfig(cfg)
+	assert.ErrorIs(t, err, worker.ErrInvalidPool)
+}
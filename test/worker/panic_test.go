@@ -0,0 +1,68 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+// unnamedTask fails, then panics when the pool names it to record the failure,
+// outside any task: the worker loop recovers that panic.
+type unnamedTask struct {
+	ran *atomic.Bool
+}
+
+func (t unnamedTask) Execute(context.Context) error {
+	t.ran.Store(true)
+	return errors.New("failed")
+}
+
+func (t unnamedTask) Stringer() string {
+	if t.ran.Load() {
+		panic("no name")
+	}
+	return "unnamed"
+}
+
+// recoveredPanic is a call of a capturing PanicHandler.
+type recoveredPanic struct {
+	task      worker.Task
+	recovered any
+	stack     []byte
+}
+
+func TestPanicHandlerReceivesPanics(t *testing.T) {
+	var mu sync.Mutex
+	var panics []recoveredPanic
+	pool := worker.NewWorkerPool("test", 1, 10, 10, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithPanicHandler(func(task worker.Task, recovered any, stack []byte) {
+			mu.Lock()
+			defer mu.Unlock()
+			panics = append(panics, recoveredPanic{task, recovered, stack})
+		}))
+	require.NoError(t, pool.Submit(context.Background(), panicTask{}))
+	require.NoError(t, pool.Submit(context.Background(), unnamedTask{new(atomic.Bool)}))
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, pool.Drain(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, panics, 2)
+	assert.Equal(t, panicTask{}, panics[0].task)
+	assert.Equal(t, "boom", panics[0].recovered)
+	assert.Contains(t, string(panics[0].stack), "panicTask.Execute")
+	assert.Nil(t, panics[1].task, "worker-level panics have no task")
+	assert.Equal(t, "no name", panics[1].recovered)
+	assert.NotEmpty(t, panics[1].stack)
+
+	metrics := pool.Metrics().WorkersMetrics[1]
+	assert.Equal(t, 2, metrics.TasksFailed(), "panics still fail their task")
+	assert.Equal(t, 1, metrics.WorkerRestarts())
+}
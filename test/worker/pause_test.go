@@ -0,0 +1,92 @@
+package worker_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func TestPauseHoldsQueuedTasks(t *testing.T) {
+	pool, fake := recurringPool(2)
+	pool.Start(context.Background())
+	require.NoError(t, pool.Pause())
+	require.NoError(t, pool.Pause())
+
+	executed := new(atomic.Int64)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	}
+	assert.ErrorIs(t, pool.Submit(context.Background(), countTask{executed}), worker.ErrWorkerPoolFull)
+	assert.Never(t, func() bool { return executed.Load() > 0 }, 50*time.Millisecond, time.Millisecond)
+
+	fake.Advance(3 * time.Second)
+	metrics := pool.Metrics()
+	assert.True(t, metrics.Paused)
+	assert.Equal(t, 3*time.Second, metrics.PausedFor)
+
+	pool.Resume()
+	pool.Resume()
+	require.Eventually(t, func() bool { return executed.Load() == 10 }, time.Second, time.Millisecond)
+	metrics = pool.Metrics()
+	assert.False(t, metrics.Paused)
+	assert.Zero(t, metrics.PausedFor)
+	require.NoError(t, pool.Drain(context.Background()))
+}
+
+func TestPauseLetsRunningTaskFinish(t *testing.T) {
+	pool, _ := recurringPool(1)
+	pool.Start(context.Background())
+	gate := gateTask{started: make(chan struct{}, 1), release: make(chan struct{})}
+	require.NoError(t, pool.Submit(context.Background(), gate))
+	<-gate.started
+
+	require.NoError(t, pool.Pause())
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	close(gate.release)
+	require.Eventually(t, func() bool {
+		return pool.Metrics().WorkersMetrics[1].TasksCompleted() == 1
+	}, time.Second, time.Millisecond)
+	assert.Never(t, func() bool { return executed.Load() > 0 }, 50*time.Millisecond, time.Millisecond)
+
+	pool.Resume()
+	require.Eventually(t, func() bool { return executed.Load() == 1 }, time.Second, time.Millisecond)
+	require.NoError(t, pool.Drain(context.Background()))
+}
+
+func TestDrainResumesPausedPool(t *testing.T) {
+	pool := newPool(2, 10)
+	pool.Start(context.Background())
+	require.NoError(t, pool.Pause())
+	executed := new(atomic.Int64)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	}
+
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Equal(t, int64(5), executed.Load())
+	assert.False(t, pool.Metrics().Paused)
+	assert.ErrorIs(t, pool.Pause(), worker.ErrWorkerPoolClosed)
+}
+
+func TestShutdownAbortsPausedPool(t *testing.T) {
+	pool := newPool(1, 10)
+	pool.Start(context.Background())
+	require.NoError(t, pool.Pause())
+	executed := new(atomic.Int64)
+	handle, err := pool.SubmitTracked(context.Background(), countTask{executed})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, pool.Shutdown(ctx))
+	waitHandle(t, handle)
+	assert.ErrorIs(t, handle.Err(), worker.ErrTaskAborted)
+	assert.Zero(t, executed.Load())
+}
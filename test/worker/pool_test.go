@@ -0,0 +1,315 @@
+package worker_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+type countTask struct {
+	executed *atomic.Int64
+}
+
+func (t countTask) Execute(context.Context) error {
+	t.executed.Add(1)
+	return nil
+}
+
+func (t countTask) Stringer() string { return "count" }
+
+type blockingTask struct {
+	started chan struct{}
+	aborted chan struct{}
+}
+
+func (t blockingTask) Execute(ctx context.Context) error {
+	close(t.started)
+	<-ctx.Done()
+	close(t.aborted)
+	return ctx.Err()
+}
+
+func (t blockingTask) Stringer() string { return "blocking" }
+
+type failTask struct{}
+
+func (failTask) Execute(context.Context) error { return errors.New("failed") }
+
+func (failTask) Stringer() string { return "fail" }
+
+type panicTask struct{}
+
+func (panicTask) Execute(context.Context) error { panic("boom") }
+
+func (panicTask) Stringer() string { return "panic" }
+
+func newPool(workers, buffer int) worker.WorkerPool {
+	return worker.NewWorkerPool("test", workers, buffer, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics)
+}
+
+func TestSubmitAfterClose(t *testing.T) {
+	for name, closePool := range map[string]func(worker.WorkerPool) error{
+		"drain":    func(p worker.WorkerPool) error { return p.Drain(context.Background()) },
+		"shutdown": func(p worker.WorkerPool) error { return p.Shutdown(context.Background()) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			pool := newPool(1, 1)
+			pool.Start(context.Background())
+			require.NoError(t, closePool(pool))
+			assert.ErrorIs(t, pool.Submit(context.Background(), countTask{new(atomic.Int64)}), worker.ErrWorkerPoolClosed)
+			assert.NoError(t, pool.Drain(context.Background()), "closing twice is a no-op")
+			assert.NoError(t, pool.Shutdown(context.Background()))
+		})
+	}
+}
+
+func TestDrainRunsQueuedTasks(t *testing.T) {
+	pool := newPool(3, 50)
+	executed := new(atomic.Int64)
+	for i := 0; i < 50; i++ {
+		require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	}
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Equal(t, int64(50), executed.Load())
+}
+
+func TestShutdownAbortsRunningTask(t *testing.T) {
+	pool := newPool(1, 1)
+	pool.Start(context.Background())
+	task := blockingTask{started: make(chan struct{}), aborted: make(chan struct{})}
+	require.NoError(t, pool.Submit(context.Background(), task))
+	<-task.started
+
+	require.NoError(t, pool.Shutdown(context.Background()))
+	<-task.aborted
+}
+
+func TestMetricsReconcile(t *testing.T) {
+	testMetricsReconcile(t, newPool(2, 30))
+}
+
+func testMetricsReconcile(t *testing.T, pool worker.WorkerPool) {
+	t.Helper()
+	executed := new(atomic.Int64)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+		require.NoError(t, pool.Submit(context.Background(), failTask{}))
+		require.NoError(t, pool.Submit(context.Background(), panicTask{}))
+	}
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+
+	var started, succeeded, failed, completed int
+	for _, m := range pool.Metrics().WorkersMetrics {
+		started += m.TasksStarted()
+		succeeded += m.TasksSucceeded()
+		failed += m.TasksFailed()
+		completed += m.TasksCompleted()
+	}
+	assert.Equal(t, 30, started)
+	assert.Equal(t, 10, succeeded)
+	assert.Equal(t, 20, failed, "errors and panics are failures")
+	assert.Equal(t, started, completed)
+	assert.Equal(t, 30, pool.Metrics().PoolMetrics.TasksEnqueued())
+	assert.Error(t, pool.Error(context.Background()))
+
+	data, err := json.Marshal(pool.Metrics().WorkersMetrics[1])
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"tasks_succeeded"`)
+}
+
+// TestConcurrentSubmitAndClose is meant for -race: producers race Drain and Shutdown
+// and must neither panic nor lose a task that Submit accepted before a plain Drain.
+func TestConcurrentSubmitAndClose(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		withShutdown := i%2 == 1
+		pool := newPool(4, 8)
+		pool.Start(context.Background())
+		executed, accepted := new(atomic.Int64), new(atomic.Int64)
+
+		var producers sync.WaitGroup
+		for p := 0; p < 16; p++ {
+			producers.Add(1)
+			go func() {
+				defer producers.Done()
+				for n := 0; n < 100; n++ {
+					err := pool.Submit(context.Background(), countTask{executed})
+					switch {
+					case err == nil:
+						accepted.Add(1)
+					case errors.Is(err, worker.ErrWorkerPoolClosed):
+						return
+					case !errors.Is(err, worker.ErrWorkerPoolFull):
+						t.Errorf("unexpected error: %v", err)
+						return
+					}
+				}
+			}()
+		}
+
+		var closers sync.WaitGroup
+		closers.Add(2)
+		go func() {
+			defer closers.Done()
+			assert.NoError(t, pool.Drain(context.Background()))
+		}()
+		go func() {
+			defer closers.Done()
+			if withShutdown {
+				assert.NoError(t, pool.Shutdown(context.Background()))
+			}
+		}()
+		closers.Wait()
+		producers.Wait()
+
+		assert.ErrorIs(t, pool.Submit(context.Background(), countTask{executed}), worker.ErrWorkerPoolClosed)
+		if withShutdown {
+			assert.LessOrEqual(t, executed.Load(), accepted.Load())
+		} else {
+			assert.Equal(t, accepted.Load(), executed.Load(), "drain runs every accepted task")
+		}
+	}
+}
+
+// fullPool returns a started pool whose only worker is busy and whose queue of one is full.
+func fullPool(t *testing.T) (worker.WorkerPool, blockingTask) {
+	t.Helper()
+	pool := newPool(1, 1)
+	pool.Start(context.Background())
+	running := blockingTask{started: make(chan struct{}), aborted: make(chan struct{})}
+	require.NoError(t, pool.Submit(context.Background(), running))
+	<-running.started
+	require.NoError(t, pool.Submit(context.Background(), countTask{new(atomic.Int64)}))
+	require.ErrorIs(t, pool.Submit(context.Background(), countTask{new(atomic.Int64)}), worker.ErrWorkerPoolFull)
+	return pool, running
+}
+
+func TestSubmitWaitTimesOutOnFullQueue(t *testing.T) {
+	pool, _ := fullPool(t)
+	defer func() { _ = pool.Shutdown(context.Background()) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, pool.SubmitWait(ctx, countTask{new(atomic.Int64)}), context.DeadlineExceeded)
+	assert.Equal(t, 2, pool.Metrics().PoolMetrics.TasksEnqueued())
+}
+
+func TestSubmitWaitGetsFreedSlot(t *testing.T) {
+	pool := newPool(1, 1)
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+
+	submitted := make(chan error, 1)
+	go func() { submitted <- pool.SubmitWait(context.Background(), countTask{executed}) }()
+	select {
+	case err := <-submitted:
+		t.Fatalf("SubmitWait returned on a full queue: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	pool.Start(context.Background())
+	require.NoError(t, <-submitted)
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Equal(t, int64(2), executed.Load())
+}
+
+func TestSubmitWaitReleasedByClose(t *testing.T) {
+	for name, closePool := range map[string]func(worker.WorkerPool) error{
+		"drain":    func(p worker.WorkerPool) error { return p.Drain(context.Background()) },
+		"shutdown": func(p worker.WorkerPool) error { return p.Shutdown(context.Background()) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			pool, running := fullPool(t)
+			submitted := make(chan error, 1)
+			go func() { submitted <- pool.SubmitWait(context.Background(), countTask{new(atomic.Int64)}) }()
+
+			closed := make(chan error, 1)
+			go func() { closed <- closePool(pool) }()
+			assert.ErrorIs(t, <-submitted, worker.ErrWorkerPoolClosed)
+			if name == "drain" {
+				require.NoError(t, pool.Shutdown(context.Background()), "let the blocking task end")
+			}
+			require.NoError(t, <-closed)
+			<-running.aborted
+			assert.ErrorIs(t, pool.SubmitWait(context.Background(), countTask{new(atomic.Int64)}), worker.ErrWorkerPoolClosed)
+		})
+	}
+}
+
+// TestConcurrentSubmitWaitAndClose is meant for -race: waiting producers on a small
+// queue race Drain and every accepted task still runs.
+func TestConcurrentSubmitWaitAndClose(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		pool := newPool(2, 2)
+		pool.Start(context.Background())
+		executed, accepted := new(atomic.Int64), new(atomic.Int64)
+
+		var producers sync.WaitGroup
+		for p := 0; p < 8; p++ {
+			producers.Add(1)
+			go func() {
+				defer producers.Done()
+				for n := 0; n < 50; n++ {
+					ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+					err := pool.SubmitWait(ctx, countTask{executed})
+					cancel()
+					switch {
+					case err == nil:
+						accepted.Add(1)
+					case errors.Is(err, worker.ErrWorkerPoolClosed):
+						return
+					case !errors.Is(err, context.DeadlineExceeded):
+						t.Errorf("unexpected error: %v", err)
+						return
+					}
+				}
+			}()
+		}
+		require.NoError(t, pool.Drain(context.Background()))
+		producers.Wait()
+		assert.Equal(t, accepted.Load(), executed.Load(), "drain runs every accepted task")
+	}
+}
+
+// sleepTask ignores its context, as a misbehaving task would.
+type sleepTask struct {
+	d time.Duration
+}
+
+func (t sleepTask) Execute(context.Context) error {
+	time.Sleep(t.d)
+	return nil
+}
+
+func (t sleepTask) Stringer() string { return "sleep" }
+
+func TestTaskTimeout(t *testing.T) {
+	pool := worker.NewWorkerPool("test", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithTaskTimeout(20*time.Millisecond))
+	pool.Start(context.Background())
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), sleepTask{time.Second}))
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	require.NoError(t, pool.Drain(ctx), "the worker moves on after the deadline")
+	assert.Equal(t, int64(1), executed.Load())
+
+	m := pool.Metrics().WorkersMetrics[1]
+	assert.Equal(t, 1, m.TasksFailed())
+	assert.Equal(t, 1, m.TasksSucceeded())
+	err := pool.Error(context.Background())
+	assert.ErrorIs(t, err, worker.ErrTaskTimeout)
+	assert.ErrorContains(t, err, "(sleep)")
+}
@@ -0,0 +1,133 @@
+package worker_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+// recorder records the order tasks run in.
+type recorder struct {
+	mu    sync.Mutex
+	order []string
+}
+
+func (r *recorder) record(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.order = append(r.order, name)
+}
+
+func (r *recorder) positions(name string) []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var positions []int
+	for i, n := range r.order {
+		if n == name {
+			positions = append(positions, i+1)
+		}
+	}
+	return positions
+}
+
+type namedTask struct {
+	name string
+	rec  *recorder
+}
+
+func (t namedTask) Execute(context.Context) error {
+	t.rec.record(t.name)
+	return nil
+}
+
+func (t namedTask) Stringer() string { return t.name }
+
+func TestPriorityOrder(t *testing.T) {
+	pool := newPool(1, 10)
+	rec := &recorder{}
+	for _, p := range []worker.Priority{worker.PriorityLow, worker.PriorityNormal, worker.PriorityHigh} {
+		require.NoError(t, pool.SubmitWithPriority(context.Background(), namedTask{p.String(), rec}, p))
+	}
+	require.NoError(t, pool.Submit(context.Background(), namedTask{"normal", rec}))
+	assert.ErrorIs(t, pool.SubmitWithPriority(context.Background(), namedTask{"bad", rec}, worker.Priority(7)),
+		worker.ErrInvalidPriority)
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+
+	assert.Equal(t, []string{"high", "normal", "normal", "low"}, rec.order)
+	metrics := pool.Metrics().PoolMetrics
+	assert.Equal(t, 4, metrics.TasksEnqueued())
+	assert.Equal(t, 1, metrics.TasksEnqueuedWithPriority(worker.PriorityHigh))
+	assert.Equal(t, 2, metrics.TasksEnqueuedWithPriority(worker.PriorityNormal))
+	assert.Equal(t, 1, metrics.TasksEnqueuedWithPriority(worker.PriorityLow))
+}
+
+// floodTask submits another high priority task every time it runs, until stop is set,
+// so the high priority queue never empties.
+type floodTask struct {
+	pool worker.WorkerPool
+	rec  *recorder
+	stop *atomic.Bool
+}
+
+func (t floodTask) Execute(ctx context.Context) error {
+	t.rec.record("high")
+	if !t.stop.Load() {
+		return t.pool.SubmitWithPriority(ctx, t, worker.PriorityHigh)
+	}
+	return nil
+}
+
+func (t floodTask) Stringer() string { return "flood" }
+
+func TestLowPriorityNotStarved(t *testing.T) {
+	pool := newPool(1, 100)
+	rec := &recorder{}
+	stop := new(atomic.Bool)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, pool.SubmitWithPriority(context.Background(), floodTask{pool, rec, stop}, worker.PriorityHigh))
+	}
+	for i := 0; i < 5; i++ {
+		require.NoError(t, pool.SubmitWithPriority(context.Background(), namedTask{"low", rec}, worker.PriorityLow))
+	}
+	pool.Start(context.Background())
+	assert.Eventually(t, func() bool { return len(rec.positions("low")) == 5 }, time.Second, time.Millisecond,
+		"low priority tasks run while high priority ones keep arriving")
+	stop.Store(true)
+	require.NoError(t, pool.Drain(context.Background()))
+
+	// With only high and low tasks queued, every 8th pick of the worker goes to low.
+	assert.Equal(t, []int{8, 16, 24, 32, 40}, rec.positions("low"))
+}
+
+func TestPrometheusEnqueuedByPriority(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	pool := worker.NewWorkerPool("test", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithPrometheus(registry))
+	require.NoError(t, pool.SubmitWithPriority(context.Background(), failTask{}, worker.PriorityHigh))
+	require.NoError(t, pool.Submit(context.Background(), failTask{}))
+	require.NoError(t, pool.Submit(context.Background(), failTask{}))
+
+	expected := `
+# HELP shortlink_worker_tasks_enqueued_by_priority_total Tasks accepted by the pool, by priority; restored counts are left out.
+# TYPE shortlink_worker_tasks_enqueued_by_priority_total counter
+shortlink_worker_tasks_enqueued_by_priority_total{pool="test",priority="high"} 1
+shortlink_worker_tasks_enqueued_by_priority_total{pool="test",priority="low"} 0
+shortlink_worker_tasks_enqueued_by_priority_total{pool="test",priority="normal"} 2
+# HELP shortlink_worker_queue_depth Tasks waiting in the queue of the pool.
+# TYPE shortlink_worker_queue_depth gauge
+shortlink_worker_queue_depth{pool="test"} 3
+`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"shortlink_worker_tasks_enqueued_by_priority_total", "shortlink_worker_queue_depth"))
+}
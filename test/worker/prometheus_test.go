@@ -0,0 +1,71 @@
+package worker_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func TestPrometheusMetricsReconcile(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	pool := worker.NewWorkerPool("test", 2, 30, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithPrometheus(registry))
+	testMetricsReconcile(t, pool)
+
+	expected := `
+# HELP shortlink_worker_tasks_enqueued_total Tasks accepted by the pool.
+# TYPE shortlink_worker_tasks_enqueued_total counter
+shortlink_worker_tasks_enqueued_total{pool="test"} 30
+# HELP shortlink_worker_queue_depth Tasks waiting in the queue of the pool.
+# TYPE shortlink_worker_queue_depth gauge
+shortlink_worker_queue_depth{pool="test"} 0
+`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"shortlink_worker_tasks_enqueued_total", "shortlink_worker_queue_depth"))
+
+	var started, completed, failed float64
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			switch family.GetName() {
+			case "shortlink_worker_tasks_started_total":
+				started += m.GetCounter().GetValue()
+			case "shortlink_worker_tasks_completed_total":
+				completed += m.GetCounter().GetValue()
+			case "shortlink_worker_tasks_failed_total":
+				failed += m.GetCounter().GetValue()
+			}
+		}
+	}
+	assert.Equal(t, 30.0, started)
+	assert.Equal(t, 30.0, completed)
+	assert.Equal(t, 20.0, failed)
+}
+
+func TestPrometheusMetricsSharedByPools(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	a := worker.NewWorkerPool("a", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithPrometheus(registry))
+	b := worker.NewWorkerPool("b", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithPrometheus(registry))
+	require.NoError(t, a.Submit(context.Background(), failTask{}))
+	require.NoError(t, b.Submit(context.Background(), failTask{}))
+	require.NoError(t, b.Submit(context.Background(), failTask{}))
+
+	expected := `
+# HELP shortlink_worker_queue_depth Tasks waiting in the queue of the pool.
+# TYPE shortlink_worker_queue_depth gauge
+shortlink_worker_queue_depth{pool="a"} 1
+shortlink_worker_queue_depth{pool="b"} 2
+`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "shortlink_worker_queue_depth"))
+	assert.Equal(t, 2, b.Metrics().PoolMetrics.TasksEnqueued())
+}
@@ -0,0 +1,88 @@
+package worker_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func TestQueueDepthAndCapacity(t *testing.T) {
+	pool := newPool(1, 5)
+	executed := new(atomic.Int64)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	}
+	require.NoError(t, pool.SubmitWithPriority(context.Background(), countTask{executed}, worker.PriorityHigh))
+
+	metrics := pool.Metrics().PoolMetrics
+	assert.Equal(t, 4, metrics.QueueDepth())
+	assert.Equal(t, 3, metrics.QueueDepthWithPriority(worker.PriorityNormal))
+	assert.Equal(t, 1, metrics.QueueDepthWithPriority(worker.PriorityHigh))
+	assert.Equal(t, 5, metrics.QueueCapacity())
+	body, err := json.Marshal(pool.Metrics())
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"queue_depth":4,"queue_depth_by_priority":{"high":1,"low":0,"normal":3},"queue_capacity":5`)
+
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Zero(t, pool.Metrics().PoolMetrics.QueueDepth())
+}
+
+func TestTaskWait(t *testing.T) {
+	pool, fake := recurringPool(1)
+	assert.Equal(t, worker.WaitStats{}, pool.Metrics().PoolMetrics.TaskWait())
+
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	fake.Advance(2 * time.Second)
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	fake.Advance(time.Second)
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+
+	assert.Equal(t, worker.WaitStats{
+		Count: 3,
+		Min:   time.Second,
+		Avg:   7 * time.Second / 3,
+		Max:   3 * time.Second,
+	}, pool.Metrics().PoolMetrics.TaskWait())
+}
+
+func TestPrometheusTaskWait(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	pool := worker.NewWorkerPool("test", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithPrometheus(registry))
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+
+	count, err := testutil.GatherAndCount(registry, "shortlink_worker_task_wait_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == "shortlink_worker_task_wait_seconds" {
+			assert.Equal(t, uint64(2), family.GetMetric()[0].GetHistogram().GetSampleCount())
+		}
+	}
+	expected := `
+# HELP shortlink_worker_queue_capacity Tasks the queue of each priority of the pool holds.
+# TYPE shortlink_worker_queue_capacity gauge
+shortlink_worker_queue_capacity{pool="test"} 10
+`
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "shortlink_worker_queue_capacity"))
+}
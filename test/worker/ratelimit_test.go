@@ -0,0 +1,66 @@
+package worker_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func TestRateLimitPacesTasks(t *testing.T) {
+	pool := worker.NewWorkerPool("test", 4, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithRateLimit(10, 1))
+	executed := new(atomic.Int64)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	}
+
+	start := time.Now()
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+	elapsed := time.Since(start)
+
+	assert.Equal(t, int64(5), executed.Load())
+	assert.GreaterOrEqual(t, elapsed, 400*time.Millisecond, "the workers share one limiter: a task every 100ms")
+	metrics := pool.Metrics().PoolMetrics
+	assert.Equal(t, 4, metrics.TasksThrottled())
+	assert.GreaterOrEqual(t, metrics.ThrottleWait(), time.Second, "waits of 100, 200, 300 and 400ms")
+	body, err := json.Marshal(pool.Metrics())
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"tasks_throttled":4`)
+}
+
+func TestShutdownAbortsThrottledTask(t *testing.T) {
+	pool := worker.NewWorkerPool("test", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithRateLimit(rate.Every(time.Hour), 1))
+	executed := new(atomic.Int64)
+	first, err := pool.SubmitTracked(context.Background(), countTask{executed})
+	require.NoError(t, err)
+	second, err := pool.SubmitTracked(context.Background(), countTask{executed})
+	require.NoError(t, err)
+	pool.Start(context.Background())
+	waitHandle(t, first)
+	require.Eventually(t, func() bool {
+		return pool.Metrics().WorkersMetrics[1].TasksStarted() == 2
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, pool.Shutdown(ctx), "the wait for the limiter ends with the pool")
+	waitHandle(t, second)
+	assert.ErrorIs(t, second.Err(), worker.ErrTaskAborted)
+	assert.Equal(t, int64(1), executed.Load())
+	assert.Equal(t, 1, pool.Metrics().PoolMetrics.TasksThrottled())
+}
+
+func TestRateLimitRejectsEmptyBurst(t *testing.T) {
+	assert.Panics(t, func() { worker.WithRateLimit(10, 0) })
+	assert.NotPanics(t, func() { worker.WithRateLimit(rate.Inf, 0) })
+}
@@ -0,0 +1,130 @@
+package worker_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func recurringPool(workers int) (worker.WorkerPool, *clock.Fake) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	return worker.NewWorkerPool("test", workers, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithClock(fake)), fake
+}
+
+// gateTask signals each start and holds its worker until released.
+type gateTask struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (t gateTask) Execute(context.Context) error {
+	t.started <- struct{}{}
+	<-t.release
+	return nil
+}
+
+func (t gateTask) Stringer() string { return "gate" }
+
+// tick advances the clock one interval and waits for the pool to handle the tick.
+func tick(t *testing.T, pool worker.WorkerPool, fake *clock.Fake, interval time.Duration) {
+	t.Helper()
+	metrics := pool.Metrics().PoolMetrics
+	before := metrics.TasksEnqueued() + metrics.RecurringSkipped()
+	fake.Advance(interval)
+	require.Eventually(t, func() bool {
+		return metrics.TasksEnqueued()+metrics.RecurringSkipped() == before+1
+	}, time.Second, time.Millisecond)
+}
+
+func TestSubmitEveryRunsOnEachTick(t *testing.T) {
+	pool, fake := recurringPool(1)
+	pool.Start(context.Background())
+	executed := new(atomic.Int64)
+	cancel, err := pool.SubmitEvery(context.Background(), countTask{executed}, time.Second)
+	require.NoError(t, err)
+	assert.Zero(t, pool.Metrics().PoolMetrics.TasksEnqueued(), "the first run is one interval away")
+
+	for i := 1; i <= 3; i++ {
+		tick(t, pool, fake, time.Second)
+		assert.Eventually(t, func() bool { return executed.Load() == int64(i) }, time.Second, time.Millisecond)
+	}
+	cancel()
+	cancel()
+	fake.Advance(time.Second)
+	assert.Never(t, func() bool { return executed.Load() > 3 }, 20*time.Millisecond, time.Millisecond)
+	require.NoError(t, pool.Drain(context.Background()))
+}
+
+func TestSubmitEverySkipsOverlappingRuns(t *testing.T) {
+	pool, fake := recurringPool(2)
+	pool.Start(context.Background())
+	gate := gateTask{started: make(chan struct{}, 4), release: make(chan struct{})}
+	cancel, err := pool.SubmitEvery(context.Background(), gate, time.Second)
+	require.NoError(t, err)
+	defer cancel()
+
+	tick(t, pool, fake, time.Second)
+	<-gate.started
+	tick(t, pool, fake, time.Second)
+	metrics := pool.Metrics().PoolMetrics
+	assert.Equal(t, 1, metrics.RecurringSkipped(), "the first run still holds a worker")
+	assert.Equal(t, 1, metrics.TasksEnqueued())
+
+	gate.release <- struct{}{}
+	require.Eventually(t, func() bool {
+		return pool.Metrics().WorkersMetrics[1].TasksCompleted()+pool.Metrics().WorkersMetrics[2].TasksCompleted() == 1
+	}, time.Second, time.Millisecond)
+	tick(t, pool, fake, time.Second)
+	<-gate.started
+	assert.Equal(t, 2, metrics.TasksEnqueued())
+	close(gate.release)
+}
+
+func TestSubmitEveryWithOverlap(t *testing.T) {
+	pool, fake := recurringPool(2)
+	pool.Start(context.Background())
+	gate := gateTask{started: make(chan struct{}, 4), release: make(chan struct{})}
+	cancel, err := pool.SubmitEvery(context.Background(), gate, time.Second, worker.WithOverlap())
+	require.NoError(t, err)
+	defer cancel()
+
+	tick(t, pool, fake, time.Second)
+	<-gate.started
+	tick(t, pool, fake, time.Second)
+	<-gate.started
+	assert.Zero(t, pool.Metrics().PoolMetrics.RecurringSkipped())
+	close(gate.release)
+}
+
+func TestSubmitEveryStopsWithPool(t *testing.T) {
+	pool, fake := recurringPool(1)
+	_, err := pool.SubmitEvery(context.Background(), countTask{new(atomic.Int64)}, 0)
+	assert.ErrorIs(t, err, worker.ErrInvalidInterval)
+
+	pool.Start(context.Background())
+	executed := new(atomic.Int64)
+	_, err = pool.SubmitEvery(context.Background(), countTask{executed}, time.Second)
+	require.NoError(t, err)
+	tick(t, pool, fake, time.Second)
+
+	// Drain waits for producers, so it returns only once the ticker goroutine has stopped.
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Equal(t, int64(1), executed.Load())
+	_, err = pool.SubmitEvery(context.Background(), countTask{executed}, time.Second)
+	assert.ErrorIs(t, err, worker.ErrWorkerPoolClosed)
+
+	pool, _ = recurringPool(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = pool.SubmitEvery(ctx, countTask{executed}, time.Second)
+	require.NoError(t, err)
+	cancel()
+	require.NoError(t, pool.Shutdown(context.Background()))
+}
@@ -0,0 +1,118 @@
+package worker_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+type recordingPool struct {
+	worker.WorkerPool
+	name  string
+	order *[]string
+	mu    *sync.Mutex
+}
+
+func (p *recordingPool) Drain(context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	*p.order = append(*p.order, p.name)
+	return nil
+}
+
+func TestRegistryLookup(t *testing.T) {
+	r := worker.NewRegistry()
+	pool := worker.NewWorkerPool("a", 1, 1, 1, worker.NewPoolMetrics(), worker.NewWorkerMetrics)
+	require.NoError(t, r.Register("a", worker.StageIngest, pool))
+
+	assert.ErrorIs(t, r.Register("a", worker.StageIngest, pool), worker.ErrPoolExists)
+	assert.Error(t, r.Register("b", worker.Stage("later"), pool))
+
+	got, err := r.Get("a")
+	require.NoError(t, err)
+	assert.Equal(t, pool, got)
+
+	_, err = r.Get("missing")
+	assert.ErrorIs(t, err, worker.ErrPoolNotConfigured)
+	assert.Panics(t, func() { r.MustGet("missing") })
+}
+
+func TestRegistryDrainOrder(t *testing.T) {
+	var order []string
+	mu := &sync.Mutex{}
+	r := worker.NewRegistry()
+	require.NoError(t, r.Register("flush", worker.StageFlush, &recordingPool{name: "flush", order: &order, mu: mu}))
+	require.NoError(t, r.Register("ingest1", worker.StageIngest, &recordingPool{name: "ingest1", order: &order, mu: mu}))
+	require.NoError(t, r.Register("ingest2", worker.StageIngest, &recordingPool{name: "ingest2", order: &order, mu: mu}))
+
+	require.NoError(t, r.Drain(context.Background()))
+	require.Len(t, order, 3)
+	assert.ElementsMatch(t, []string{"ingest1", "ingest2"}, order[:2])
+	assert.Equal(t, "flush", order[2])
+}
+
+func TestRegistryFromConfig(t *testing.T) {
+	cfg := &configs.Config{}
+	cfg.Worker.WorkersCount = 2
+	cfg.Worker.BufferSize = 10
+	cfg.Worker.ErrMaximumAmount = 10
+	cfg.Pools = map[string]configs.PoolConfig{
+		"deleteWorker": {Stage: "flush"},
+		"jobWorker":    {Workers: 1},
+	}
+	r, err := worker.NewRegistryFromConfig(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deleteWorker", "jobWorker"}, r.Names())
+
+	metrics := r.Metrics()
+	assert.Len(t, metrics["deleteWorker"].WorkersMetrics, 2)
+	assert.Len(t, metrics["jobWorker"].WorkersMetrics, 1)
+
+	cfg.Pools = map[string]configs.PoolConfig{"deleteWorker": {Stage: "flush", RateLimit: 10}}
+	r, err = worker.NewRegistryFromConfig(cfg)
+	require.NoError(t, err)
+	pool, err := r.Get("deleteWorker")
+	require.NoError(t, err)
+	executed := new(atomic.Int64)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	}
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Equal(t, 1, pool.Metrics().PoolMetrics.TasksThrottled(), "a burst of one by default")
+
+	cfg.Pools["bad"] = configs.PoolConfig{Stage: "sometime"}
+	_, err = worker.NewRegistryFromConfig(cfg)
+	assert.Error(t, err)
+}
+
+func TestRegistryConfigs(t *testing.T) {
+	cfg := &configs.Config{}
+	cfg.Worker.WorkersCount = 2
+	cfg.Worker.BufferSize = 10
+	cfg.Worker.ErrMaximumAmount = 5
+	cfg.Pools = map[string]configs.PoolConfig{
+		"deleteWorker": {Stage: "flush", TaskTimeout: time.Second, MaxAttempts: 3, RetryBackoff: time.Millisecond},
+		"jobWorker":    {Workers: 1, BufferSize: 4, RateLimit: 10, RateBurst: 2},
+	}
+	r, err := worker.NewRegistryFromConfig(cfg)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]worker.PoolConfig{
+		"deleteWorker": {Workers: 2, BufferSize: 10, ErrMaximumAmount: 5, TaskTimeout: time.Second, MaxAttempts: 3},
+		"jobWorker":    {Workers: 1, BufferSize: 4, ErrMaximumAmount: 5, MaxAttempts: 1, RateLimit: 10, RateBurst: 2},
+	}, r.Configs())
+
+	pool := r.MustGet("jobWorker")
+	require.NoError(t, pool.Resize(context.Background(), 3))
+	assert.Equal(t, 3, pool.Config().Workers, "the live worker count, not the configured one")
+	assert.Equal(t, pool.Config(), pool.Metrics().Config)
+}
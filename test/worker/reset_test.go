@@ -0,0 +1,99 @@
+package worker_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func TestSnapshotAndReset(t *testing.T) {
+	pool := newPool(1, 10)
+	var executed atomic.Int64
+	for range 3 {
+		require.NoError(t, pool.Submit(context.Background(), countTask{&executed}))
+	}
+	require.NoError(t, pool.Submit(context.Background(), failTask{}))
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, pool.Drain(context.Background()))
+
+	before := pool.SnapshotAndReset()
+	assert.Equal(t, 4, before.PoolMetrics.TasksEnqueued())
+	assert.Equal(t, 10, before.PoolMetrics.QueueCapacity(), "gauges are carried")
+	assert.Equal(t, 4, before.WorkersMetrics[1].TasksStarted())
+	assert.Equal(t, 3, before.WorkersMetrics[1].TasksSucceeded())
+	assert.Equal(t, 1, before.WorkersMetrics[1].TasksFailed())
+
+	after := pool.Metrics()
+	assert.Zero(t, after.PoolMetrics.TasksEnqueued())
+	assert.Zero(t, after.PoolMetrics.TaskWait().Count)
+	assert.Equal(t, 10, after.PoolMetrics.QueueCapacity(), "gauges are not reset")
+	assert.Zero(t, after.WorkersMetrics[1].TasksStarted())
+	assert.Zero(t, after.WorkersMetrics[1].TasksCompleted())
+	assert.Zero(t, after.WorkersMetrics[1].TotalDuration())
+	assert.Equal(t, 4, before.WorkersMetrics[1].TasksStarted(), "the snapshot is not reset with the pool")
+
+	pool.ResetMetrics()
+	assert.Zero(t, pool.Metrics().PoolMetrics.TasksEnqueued())
+}
+
+func TestResetWhileRunning(t *testing.T) {
+	const tasks = 2000
+	pool := newPool(4, tasks)
+	var executed atomic.Int64
+	require.NoError(t, pool.Start(context.Background()))
+
+	var (
+		wg       sync.WaitGroup
+		enqueued int
+		started  int
+	)
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			snapshot := pool.SnapshotAndReset()
+			enqueued += snapshot.PoolMetrics.TasksEnqueued()
+			for _, m := range snapshot.WorkersMetrics {
+				started += m.TasksStarted()
+			}
+		}
+	}()
+	for range tasks {
+		require.NoError(t, pool.Submit(context.Background(), countTask{&executed}))
+	}
+	require.NoError(t, pool.Drain(context.Background()))
+	close(done)
+	wg.Wait()
+
+	last := pool.SnapshotAndReset()
+	enqueued += last.PoolMetrics.TasksEnqueued()
+	for _, m := range last.WorkersMetrics {
+		started += m.TasksStarted()
+	}
+	assert.Equal(t, int64(tasks), executed.Load())
+	assert.Equal(t, tasks, enqueued, "no enqueue is lost or counted twice")
+	assert.Equal(t, tasks, started, "no start is lost or counted twice")
+}
+
+func TestRegistrySnapshotAndReset(t *testing.T) {
+	registry := worker.NewRegistry()
+	pool := newPool(1, 10)
+	require.NoError(t, registry.Register("test", worker.StageIngest, pool))
+	var executed atomic.Int64
+	require.NoError(t, pool.Submit(context.Background(), countTask{&executed}))
+
+	assert.Equal(t, 1, registry.SnapshotAndReset()["test"].PoolMetrics.TasksEnqueued())
+	assert.Zero(t, registry.Metrics()["test"].PoolMetrics.TasksEnqueued())
+}
@@ -0,0 +1,76 @@
+package worker_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func TestResizeKeepsRetiredMetrics(t *testing.T) {
+	pool := newPool(1, 10)
+	require.NoError(t, pool.Resize(context.Background(), 3))
+	pool.Start(context.Background())
+	assert.Len(t, pool.Metrics().WorkersMetrics, 3)
+
+	require.NoError(t, pool.Resize(context.Background(), 1))
+	metrics := pool.Metrics()
+	assert.Len(t, metrics.WorkersMetrics, 3)
+	assert.ElementsMatch(t, []int{2, 3}, metrics.RetiredWorkers)
+
+	// New workers get IDs of their own.
+	require.NoError(t, pool.Resize(context.Background(), 2))
+	metrics = pool.Metrics()
+	assert.Contains(t, metrics.WorkersMetrics, 4)
+	assert.Len(t, metrics.WorkersMetrics, 4)
+
+	assert.ErrorIs(t, pool.Resize(context.Background(), 0), worker.ErrInvalidWorkerCount)
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.ErrorIs(t, pool.Resize(context.Background(), 2), worker.ErrWorkerPoolClosed)
+}
+
+// TestResizeWhileTasksFlow is meant for -race: the pool is resized up and down while
+// producers submit, and every accepted task must still run exactly once.
+func TestResizeWhileTasksFlow(t *testing.T) {
+	pool := newPool(2, 16)
+	pool.Start(context.Background())
+	executed := new(atomic.Int64)
+	accepted := new(atomic.Int64)
+
+	var producers sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		producers.Add(1)
+		go func() {
+			defer producers.Done()
+			for i := 0; i < 200; i++ {
+				if pool.SubmitWait(context.Background(), countTask{executed}) == nil {
+					accepted.Add(1)
+				}
+			}
+		}()
+	}
+	resized := make(chan struct{})
+	go func() {
+		defer close(resized)
+		for i := 0; i < 100; i++ {
+			_ = pool.Resize(context.Background(), i%8+1)
+			_ = pool.Metrics()
+		}
+	}()
+	producers.Wait()
+	<-resized
+	require.NoError(t, pool.Drain(context.Background()))
+
+	assert.Equal(t, int64(800), accepted.Load())
+	assert.Equal(t, accepted.Load(), executed.Load())
+	started := 0
+	for _, m := range pool.Metrics().WorkersMetrics {
+		started += m.TasksStarted()
+	}
+	assert.Equal(t, int(accepted.Load()), started, "retired workers keep their counts")
+}
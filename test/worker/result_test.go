@@ -0,0 +1,133 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func TestResultPoolDeliversResults(t *testing.T) {
+	pool := newPool(2, 10)
+	results := worker.NewResultPool[string](pool, "")
+	require.NoError(t, pool.Start(context.Background()))
+	var futures []*worker.Future[string]
+	for i := range 5 {
+		future, err := results.Submit(context.Background(), func(context.Context) (string, error) {
+			return strconv.Itoa(i), nil
+		})
+		require.NoError(t, err)
+		futures = append(futures, future)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i, future := range futures {
+		got, err := future.Get(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, strconv.Itoa(i), got)
+	}
+	require.NoError(t, pool.Drain(ctx))
+	assert.Equal(t, 5, pool.Metrics().PoolMetrics.TasksEnqueued(), "results are tasks of the pool")
+}
+
+func TestResultPoolDeliversErrors(t *testing.T) {
+	pool := newPool(1, 10)
+	results := worker.NewResultPool[int](pool, "lookup")
+	require.NoError(t, pool.Start(context.Background()))
+	errNotFound := errors.New("not found")
+	future, err := results.Submit(context.Background(), func(context.Context) (int, error) {
+		return 42, errNotFound
+	})
+	require.NoError(t, err)
+
+	got, err := future.Get(context.Background())
+	assert.ErrorIs(t, err, errNotFound)
+	assert.Zero(t, got, "the value of a failed function is dropped")
+	require.NoError(t, pool.Drain(context.Background()))
+	failures := pool.Metrics().RecentFailures
+	require.Len(t, failures, 1)
+	assert.Equal(t, "lookup", failures[0].Task)
+}
+
+func TestResultPoolCancelBeforeExecution(t *testing.T) {
+	pool := newPool(1, 10)
+	results := worker.NewResultPool[int](pool, "")
+	var ran atomic.Bool
+	future, err := results.Submit(context.Background(), func(context.Context) (int, error) {
+		ran.Store(true)
+		return 1, nil
+	})
+	require.NoError(t, err)
+
+	require.True(t, future.Cancel())
+	_, err = future.Get(context.Background())
+	assert.ErrorIs(t, err, worker.ErrTaskCancelled, "Get returns without waiting for a worker")
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.False(t, ran.Load())
+	_, err = future.Get(context.Background())
+	assert.ErrorIs(t, err, worker.ErrTaskCancelled)
+
+	late, err := results.Submit(context.Background(), func(context.Context) (int, error) { return 1, nil })
+	assert.ErrorIs(t, err, worker.ErrWorkerPoolClosed)
+	assert.Nil(t, late)
+}
+
+func TestResultPoolCancelAfterExecution(t *testing.T) {
+	pool := newPool(1, 10)
+	results := worker.NewResultPool[int](pool, "")
+	require.NoError(t, pool.Start(context.Background()))
+	future, err := results.Submit(context.Background(), func(context.Context) (int, error) { return 7, nil })
+	require.NoError(t, err)
+	got, err := future.Get(context.Background())
+	require.NoError(t, err)
+
+	assert.False(t, future.Cancel(), "a function that ran cannot be cancelled")
+	again, err := future.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, got, again)
+	require.NoError(t, pool.Drain(context.Background()))
+}
+
+func TestResultPoolShutdownAbortsPendingFutures(t *testing.T) {
+	pool := newPool(1, 10)
+	results := worker.NewResultPool[int](pool, "")
+	var futures []*worker.Future[int]
+	for range 3 {
+		future, err := results.Submit(context.Background(), func(context.Context) (int, error) { return 1, nil })
+		require.NoError(t, err)
+		futures = append(futures, future)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, pool.Shutdown(ctx))
+	for _, future := range futures {
+		_, err := future.Get(ctx)
+		assert.ErrorIs(t, err, worker.ErrTaskAborted)
+	}
+
+	late, err := results.Submit(context.Background(), func(context.Context) (int, error) { return 1, nil })
+	assert.ErrorIs(t, err, worker.ErrWorkerPoolClosed)
+	assert.Nil(t, late)
+}
+
+func TestResultPoolGetHonoursContext(t *testing.T) {
+	pool := newPool(1, 10)
+	results := worker.NewResultPool[int](pool, "")
+	future, err := results.Submit(context.Background(), func(context.Context) (int, error) { return 1, nil })
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = future.Get(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "the pool is not started")
+}
@@ -0,0 +1,119 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/clock"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+// flakyTask fails until it has been executed succeedOn times.
+type flakyTask struct {
+	attempts  *atomic.Int64
+	succeedOn int64
+	panics    bool
+}
+
+func (t flakyTask) Execute(context.Context) error {
+	if t.attempts.Add(1) >= t.succeedOn {
+		return nil
+	}
+	if t.panics {
+		panic("flaky")
+	}
+	return errors.New("flaky")
+}
+
+func (t flakyTask) Stringer() string { return "flaky" }
+
+func retryPool(fake *clock.Fake, policy worker.RetryPolicy) worker.WorkerPool {
+	return worker.NewWorkerPool("test", 1, 10, 100, worker.NewPoolMetrics(), worker.NewWorkerMetrics,
+		worker.WithClock(fake), worker.WithRetry(policy))
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	pool := retryPool(fake, worker.RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     worker.ExponentialBackoff(time.Second, time.Minute),
+	})
+	pool.Start(context.Background())
+	attempts := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), flakyTask{attempts: attempts, succeedOn: 3}))
+
+	fake.BlockUntil(1)
+	assert.Equal(t, int64(1), attempts.Load())
+	fake.Advance(time.Second)
+	fake.BlockUntil(1)
+	assert.Equal(t, int64(2), attempts.Load())
+	fake.Advance(time.Second)
+	assert.Equal(t, int64(2), attempts.Load(), "the second backoff is doubled")
+	fake.Advance(time.Second)
+	require.NoError(t, pool.Drain(context.Background()))
+
+	m := pool.Metrics().WorkersMetrics[1]
+	assert.Equal(t, 3, int(attempts.Load()))
+	assert.Equal(t, 2, m.TasksRetried())
+	assert.Equal(t, 1, m.TasksSucceeded())
+	assert.Equal(t, 0, m.TasksFailed())
+	assert.NoError(t, pool.Error(context.Background()))
+}
+
+func TestRetryExhausted(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	pool := retryPool(fake, worker.RetryPolicy{MaxAttempts: 3})
+	pool.Start(context.Background())
+	attempts := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), flakyTask{attempts: attempts, succeedOn: 10}))
+	require.NoError(t, pool.Drain(context.Background()))
+
+	m := pool.Metrics().WorkersMetrics[1]
+	assert.Equal(t, int64(3), attempts.Load())
+	assert.Equal(t, 2, m.TasksRetried())
+	assert.Equal(t, 1, m.TasksFailed(), "the task fails once, after its last attempt")
+	assert.Equal(t, m.TasksStarted(), m.TasksCompleted())
+	assert.ErrorContains(t, pool.Error(context.Background()), "flaky")
+}
+
+func TestRetryPanics(t *testing.T) {
+	for _, retryPanics := range []bool{false, true} {
+		fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		pool := retryPool(fake, worker.RetryPolicy{MaxAttempts: 2, RetryPanics: retryPanics})
+		pool.Start(context.Background())
+		attempts := new(atomic.Int64)
+		require.NoError(t, pool.Submit(context.Background(), flakyTask{attempts: attempts, succeedOn: 2, panics: true}))
+		require.NoError(t, pool.Drain(context.Background()))
+
+		m := pool.Metrics().WorkersMetrics[1]
+		if retryPanics {
+			assert.Equal(t, 1, m.TasksSucceeded())
+			assert.Equal(t, 1, m.TasksRetried())
+		} else {
+			assert.Equal(t, 1, m.TasksFailed(), "panics are not retried by default")
+			assert.Equal(t, 0, m.TasksRetried())
+		}
+	}
+}
+
+func TestShutdownInterruptsBackoff(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	pool := retryPool(fake, worker.RetryPolicy{MaxAttempts: 5, Backoff: worker.ExponentialBackoff(time.Hour, time.Hour)})
+	pool.Start(context.Background())
+	attempts := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), flakyTask{attempts: attempts, succeedOn: 10}))
+	fake.BlockUntil(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, pool.Shutdown(ctx), "Shutdown does not wait out the backoff")
+	m := pool.Metrics().WorkersMetrics[1]
+	assert.Equal(t, int64(1), attempts.Load())
+	assert.Equal(t, 1, m.TasksFailed())
+}
@@ -0,0 +1,105 @@
+package worker_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func TestShardedPoolRunsEveryTask(t *testing.T) {
+	pool, err := worker.NewPool("test", worker.WithWorkers(4), worker.WithBuffer(40), worker.WithSharding(true))
+	require.NoError(t, err)
+	executed := new(atomic.Int64)
+	for range 40 {
+		require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	}
+	assert.Equal(t, []int{10, 10, 10, 10}, pool.Metrics().ShardDepths, "tasks are spread over the shards in turn")
+	assert.Equal(t, 40, pool.Config().BufferSize)
+	assert.ErrorIs(t, pool.Submit(context.Background(), countTask{executed}), worker.ErrWorkerPoolFull)
+
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Equal(t, int64(40), executed.Load())
+}
+
+func TestShardedSubmitFillsEveryShard(t *testing.T) {
+	pool, err := worker.NewPool("test", worker.WithWorkers(4), worker.WithBuffer(8), worker.WithSharding(true))
+	require.NoError(t, err)
+	executed := new(atomic.Int64)
+	accepted, err := pool.SubmitBatch(context.Background(), []worker.Task{
+		countTask{executed}, countTask{executed}, countTask{executed}, countTask{executed},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 4, accepted)
+	for range 4 {
+		require.NoError(t, pool.Submit(context.Background(), countTask{executed}), "a full shard passes the task on")
+	}
+	assert.ErrorIs(t, pool.Submit(context.Background(), countTask{executed}), worker.ErrWorkerPoolFull)
+	require.NoError(t, pool.Shutdown(context.Background()))
+}
+
+func TestShardedWorkersSteal(t *testing.T) {
+	pool, err := worker.NewPool("test", worker.WithWorkers(2), worker.WithBuffer(10), worker.WithSharding(true))
+	require.NoError(t, err)
+	require.NoError(t, pool.Start(context.Background()))
+	blocking := blockingTask{started: make(chan struct{}), aborted: make(chan struct{})}
+	require.NoError(t, pool.Submit(context.Background(), blocking))
+	<-blocking.started
+
+	executed := new(atomic.Int64)
+	for range 10 {
+		require.NoError(t, pool.SubmitWait(context.Background(), countTask{executed}))
+	}
+	require.Eventually(t, func() bool { return executed.Load() == 10 }, time.Second, time.Millisecond,
+		"the idle worker takes the tasks queued in the shard of the busy one")
+	assert.Equal(t, []int{0, 0}, pool.Metrics().ShardDepths)
+
+	require.NoError(t, pool.Shutdown(context.Background()))
+	<-blocking.aborted
+}
+
+func TestUnshardedPoolHasNoShardDepths(t *testing.T) {
+	pool := newPool(4, 10)
+	require.NoError(t, pool.Submit(context.Background(), countTask{new(atomic.Int64)}))
+	assert.Nil(t, pool.Metrics().ShardDepths)
+	require.NoError(t, pool.Shutdown(context.Background()))
+}
+
+// BenchmarkSharding compares one queue set shared by every worker with a shard per
+// worker, under as many producers as GOMAXPROCS. On a single CPU, where the workers
+// never contend on a channel at the same time, the shared queues did about 2.9µs/op
+// with 8 workers and 4.8µs/op with 64, the shards about 3.4µs/op and 5.4µs/op: the
+// round robin and stealing cost more than they save there. Run it with -cpu on the
+// machine the pool is meant for before turning sharding on.
+func BenchmarkSharding(b *testing.B) {
+	for _, workers := range []int{8, 64} {
+		for _, sharded := range []bool{false, true} {
+			b.Run(fmt.Sprintf("workers=%d/sharded=%t", workers, sharded), func(b *testing.B) {
+				pool, err := worker.NewPool("bench", worker.WithWorkers(workers), worker.WithBuffer(1024),
+					worker.WithSharding(sharded), worker.WithLogger(zap.NewNop()))
+				require.NoError(b, err)
+				require.NoError(b, pool.Start(context.Background()))
+				task := countTask{new(atomic.Int64)}
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						if err := pool.SubmitWait(context.Background(), task); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				})
+				require.NoError(b, pool.Drain(context.Background()))
+			})
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package worker_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/configs"
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func snapshotConfig(path string, merge bool) *configs.Config {
+	cfg := &configs.Config{}
+	cfg.Worker.WorkersCount = 2
+	cfg.Worker.BufferSize = 10
+	cfg.Worker.ErrMaximumAmount = 10
+	cfg.Pools = map[string]configs.PoolConfig{"jobWorker": {}}
+	cfg.PoolMetrics.Path = path
+	cfg.PoolMetrics.MaxAge = time.Hour
+	cfg.PoolMetrics.Merge = merge
+	return cfg
+}
+
+// runAndSave runs 3 successful and 2 failing tasks on the jobWorker pool and saves its counters.
+func runAndSave(t *testing.T, cfg *configs.Config, savedAt time.Time) {
+	r, err := worker.NewRegistryFromConfig(cfg)
+	require.NoError(t, err)
+	pool := r.MustGet("jobWorker")
+	executed := new(atomic.Int64)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+	}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, pool.Submit(context.Background(), failTask{}))
+	}
+	pool.Start(context.Background())
+	require.NoError(t, r.Drain(context.Background()))
+	require.NoError(t, r.SaveSnapshot(cfg.PoolMetrics.Path, savedAt))
+}
+
+func totals(m worker.MetricsResult) (started, succeeded, failed int) {
+	for _, w := range m.WorkersMetrics {
+		started += w.TasksStarted()
+		succeeded += w.TasksSucceeded()
+		failed += w.TasksFailed()
+	}
+	return started, succeeded, failed
+}
+
+func TestSnapshotRoundTripMerged(t *testing.T) {
+	cfg := snapshotConfig(filepath.Join(t.TempDir(), "metrics.json"), true)
+	runAndSave(t, cfg, time.Now())
+
+	r, err := worker.NewRegistryFromConfig(cfg)
+	require.NoError(t, err)
+	metrics := r.Metrics()["jobWorker"]
+	started, succeeded, failed := totals(metrics)
+	assert.Equal(t, 5, started)
+	assert.Equal(t, 3, succeeded)
+	assert.Equal(t, 2, failed)
+	assert.Equal(t, 5, metrics.PoolMetrics.TasksEnqueued())
+	assert.Nil(t, metrics.RestoredMetrics)
+
+	// Saving again keeps the restored counters.
+	runAndSave(t, cfg, time.Now())
+	snapshot, err := worker.LoadSnapshot(cfg.PoolMetrics.Path, time.Hour, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 10, snapshot.Pools["jobWorker"].TasksEnqueued)
+}
+
+func TestSnapshotRoundTripSeparate(t *testing.T) {
+	cfg := snapshotConfig(filepath.Join(t.TempDir(), "metrics.json"), false)
+	runAndSave(t, cfg, time.Now())
+
+	r, err := worker.NewRegistryFromConfig(cfg)
+	require.NoError(t, err)
+	metrics := r.Metrics()["jobWorker"]
+	started, _, _ := totals(metrics)
+	assert.Zero(t, started)
+	require.NotNil(t, metrics.RestoredMetrics)
+	assert.Equal(t, 5, metrics.RestoredMetrics.TasksStarted)
+	assert.Equal(t, 3, metrics.RestoredMetrics.TasksSucceeded)
+	assert.Equal(t, 2, metrics.RestoredMetrics.TasksFailed)
+
+	data, err := json.Marshal(metrics)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"restored_tasks_started":5`)
+	assert.Equal(t, 5, r.MustGet("jobWorker").Snapshot().TasksEnqueued)
+}
+
+func TestStaleSnapshotIgnored(t *testing.T) {
+	cfg := snapshotConfig(filepath.Join(t.TempDir(), "metrics.json"), true)
+	runAndSave(t, cfg, time.Now().Add(-2*time.Hour))
+
+	_, err := worker.LoadSnapshot(cfg.PoolMetrics.Path, time.Hour, time.Now())
+	assert.ErrorIs(t, err, worker.ErrSnapshotStale)
+
+	r, err := worker.NewRegistryFromConfig(cfg)
+	require.NoError(t, err)
+	started, _, _ := totals(r.Metrics()["jobWorker"])
+	assert.Zero(t, started)
+}
+
+func TestCorruptSnapshotIgnored(t *testing.T) {
+	cfg := snapshotConfig(filepath.Join(t.TempDir(), "metrics.json"), false)
+	require.NoError(t, os.WriteFile(cfg.PoolMetrics.Path, []byte("{not json"), 0644))
+
+	_, err := worker.LoadSnapshot(cfg.PoolMetrics.Path, time.Hour, time.Now())
+	assert.Error(t, err)
+
+	r, err := worker.NewRegistryFromConfig(cfg)
+	require.NoError(t, err)
+	assert.Nil(t, r.Metrics()["jobWorker"].RestoredMetrics)
+}
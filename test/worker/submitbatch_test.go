@@ -0,0 +1,89 @@
+package worker_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+func countTasks(executed *atomic.Int64, n int) []worker.Task {
+	tasks := make([]worker.Task, n)
+	for i := range tasks {
+		tasks[i] = countTask{executed}
+	}
+	return tasks
+}
+
+func TestSubmitBatchLargerThanBuffer(t *testing.T) {
+	pool := newPool(1, 3)
+	executed := new(atomic.Int64)
+	require.NoError(t, pool.Submit(context.Background(), countTask{executed}))
+
+	accepted, err := pool.SubmitBatch(context.Background(), countTasks(executed, 4))
+	assert.ErrorIs(t, err, worker.ErrWorkerPoolFull)
+	assert.Equal(t, 2, accepted)
+	assert.Equal(t, 3, pool.Metrics().PoolMetrics.TasksEnqueued())
+
+	pool.Start(context.Background())
+	require.NoError(t, pool.Drain(context.Background()))
+	assert.Equal(t, int64(3), executed.Load())
+
+	accepted, err = pool.SubmitBatch(context.Background(), countTasks(executed, 1))
+	assert.ErrorIs(t, err, worker.ErrWorkerPoolClosed)
+	assert.Zero(t, accepted)
+}
+
+func TestSubmitBatchStopsAtDuplicate(t *testing.T) {
+	pool := newPool(1, 10)
+	executed := new(atomic.Int64)
+	accepted, err := pool.SubmitBatch(context.Background(), []worker.Task{
+		keyedTask{countTask{executed}, "user-1"},
+		countTask{executed},
+		keyedTask{countTask{executed}, "user-1"},
+		countTask{executed},
+	})
+	assert.ErrorIs(t, err, worker.ErrDuplicateTask)
+	assert.Equal(t, 2, accepted)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	accepted, err = pool.SubmitBatch(ctx, countTasks(executed, 2))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, accepted)
+	assert.Equal(t, 2, pool.Metrics().PoolMetrics.TasksEnqueued())
+}
+
+func TestSubmitBatchRacingDrain(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		pool := newPool(4, 1000)
+		pool.Start(context.Background())
+		executed := new(atomic.Int64)
+		var total atomic.Int64
+		var wg sync.WaitGroup
+		for p := 0; p < 4; p++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for b := 0; b < 10; b++ {
+					accepted, err := pool.SubmitBatch(context.Background(), countTasks(executed, 20))
+					total.Add(int64(accepted))
+					if err != nil {
+						assert.ErrorIs(t, err, worker.ErrWorkerPoolClosed)
+						assert.Zero(t, accepted, "a batch is refused whole once the pool is closed")
+						return
+					}
+				}
+			}()
+		}
+		require.NoError(t, pool.Drain(context.Background()))
+		wg.Wait()
+		assert.Equal(t, total.Load(), executed.Load(), "every accepted task ran")
+		assert.Equal(t, int(total.Load()), pool.Metrics().PoolMetrics.TasksEnqueued())
+	}
+}
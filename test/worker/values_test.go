@@ -0,0 +1,57 @@
+package worker_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OrtemRepos/shortlink/internal/worker"
+)
+
+// valuesTask sends the values of its ctx to seen.
+type valuesTask struct{ seen chan map[string]string }
+
+func (t valuesTask) Execute(ctx context.Context) error {
+	t.seen <- worker.ValuesFromContext(ctx)
+	return nil
+}
+
+func (valuesTask) Stringer() string { return "values" }
+
+func TestSubmitWithValues(t *testing.T) {
+	pool, logs := observedPool(t, 10)
+	task := valuesTask{seen: make(chan map[string]string, 2)}
+	kv := map[string]string{"request_id": "req-1", "user_id": "user-1"}
+	require.NoError(t, pool.SubmitWithValues(context.Background(), task, kv))
+	kv["request_id"] = "changed"
+	require.NoError(t, pool.Submit(context.Background(), task))
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, pool.Drain(context.Background()))
+
+	assert.Equal(t, map[string]string{"request_id": "req-1", "user_id": "user-1"}, <-task.seen,
+		"the values are copied when the task is submitted")
+	assert.Nil(t, <-task.seen, "Submit carries no values")
+	assert.Nil(t, worker.ValuesFromContext(context.Background()))
+
+	started := logs.FilterMessage("task started").All()
+	require.Len(t, started, 2)
+	assert.Equal(t, map[string]any{"request_id": "req-1", "user_id": "user-1"}, started[0].ContextMap()["values"])
+	assert.NotContains(t, started[1].ContextMap(), "values")
+}
+
+func TestAuditRecordsValues(t *testing.T) {
+	var out bytes.Buffer
+	pool, err := worker.NewPool("test", worker.WithAudit(&out))
+	require.NoError(t, err)
+	task := valuesTask{seen: make(chan map[string]string, 1)}
+	require.NoError(t, pool.SubmitWithValues(context.Background(), task, map[string]string{"user_id": "user-1"}))
+	require.NoError(t, pool.Start(context.Background()))
+	require.NoError(t, pool.Drain(context.Background()))
+
+	for _, record := range auditRecords(t, &out) {
+		assert.Equal(t, map[string]string{"user_id": "user-1"}, record.Values, record.Event)
+	}
+}